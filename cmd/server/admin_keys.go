@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/internal/domain/adminkey"
+	"gitlab.com/evzpav/user-auth/pkg/env"
+	"gitlab.com/evzpav/user-auth/pkg/log"
+)
+
+const adminKeysUsage = `usage: user-auth admin-keys <command>
+
+commands:
+  create -name <name> -permission <permission>...
+               create a key of the admin API, the key is only shown once
+  list         list the keys
+  revoke <id>  revoke a key
+`
+
+// runAdminKeys runs the admin-keys subcommand, which manages the keys of the admin API, and
+// returns the exit code
+func runAdminKeys(args []string, log log.Logger, out io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(out, adminKeysUsage)
+		return 2
+	}
+
+	env.CheckRequired(log, envVarDatabaseURL)
+
+	storages, err := newStorages(getStorageDriver(), getDatabaseURL(), log)
+	if err != nil {
+		log.Error().Err(err).Sendf("%v", err)
+		return 1
+	}
+	defer storages.db.Close()
+
+	adminKeyService := adminkey.NewService(storages.adminAPIKeys, log)
+
+	ctx := context.Background()
+	switch args[0] {
+	case "create":
+		flags := flag.NewFlagSet("admin-keys create", flag.ContinueOnError)
+		flags.SetOutput(out)
+		name := flags.String("name", "", "name telling what uses the key")
+		var permissions stringsFlag
+		flags.Var(&permissions, "permission", fmt.Sprintf("permission granted to the key, can be repeated, one of %v", domain.Permissions))
+		if err := flags.Parse(args[1:]); err != nil {
+			return 2
+		}
+
+		granted := make([]domain.Permission, 0, len(permissions))
+		for _, permission := range permissions {
+			granted = append(granted, domain.Permission(permission))
+		}
+
+		key, plaintext, err := adminKeyService.Create(ctx, *name, granted)
+		if err != nil {
+			log.Error().Err(err).Sendf("failed to create key: %v", err)
+			return 1
+		}
+
+		fmt.Fprintf(out, "id: %d\n", key.ID)
+		fmt.Fprintf(out, "key: %s\n", plaintext)
+	case "list":
+		keys, err := adminKeyService.List(ctx)
+		if err != nil {
+			log.Error().Err(err).Sendf("%v", err)
+			return 1
+		}
+
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tPREFIX\tPERMISSIONS\tCREATED AT\tLAST USED AT\tREVOKED AT")
+		for _, k := range keys {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n", k.ID, k.Name, k.Prefix, k.Permissions,
+				k.CreatedAt.UTC().Format(time.RFC3339), formatOptionalTime(k.LastUsedAt), formatOptionalTime(k.RevokedAt))
+		}
+		w.Flush()
+	case "revoke":
+		if len(args) != 2 {
+			fmt.Fprint(out, adminKeysUsage)
+			return 2
+		}
+
+		ID, err := strconv.Atoi(args[1])
+		if err != nil {
+			fmt.Fprint(out, adminKeysUsage)
+			return 2
+		}
+
+		if err := adminKeyService.Revoke(ctx, ID); err != nil {
+			log.Error().Err(err).Sendf("failed to revoke key: %v", err)
+			return 1
+		}
+
+		fmt.Fprintf(out, "revoked %d\n", ID)
+	default:
+		fmt.Fprint(out, adminKeysUsage)
+		return 2
+	}
+
+	return 0
+}
+
+func formatOptionalTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/internal/domain/user"
+	"gitlab.com/evzpav/user-auth/pkg/env"
+	"gitlab.com/evzpav/user-auth/pkg/log"
+)
+
+const clientsUsage = `usage: user-auth clients <command>
+
+commands:
+  create -name <name> [-redirect-uri <uri>]... [-post-logout-redirect-uri <uri>]...
+         [-scope <scopes>] [-public]
+                 register a client, the secret of confidential clients is only shown once
+  list           list the registered clients
+  delete <id>    delete a client and revoke its tokens
+`
+
+// stringsFlag collects a flag given several times
+type stringsFlag []string
+
+func (f *stringsFlag) String() string {
+	return strings.Join(*f, " ")
+}
+
+func (f *stringsFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// runClients runs the clients subcommand, which manages the OAuth clients, and returns the exit
+// code
+func runClients(args []string, log log.Logger, out io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(out, clientsUsage)
+		return 2
+	}
+
+	env.CheckRequired(log, envVarDatabaseURL)
+
+	storages, err := newStorages(getStorageDriver(), getDatabaseURL(), log)
+	if err != nil {
+		log.Error().Err(err).Sendf("%v", err)
+		return 1
+	}
+	defer storages.db.Close()
+
+	// managing the clients does not sign tokens
+	oauthService := newOAuthService(storages, user.NewService(storages.users, log), nil, log)
+
+	ctx := context.Background()
+	switch args[0] {
+	case "create":
+		flags := flag.NewFlagSet("clients create", flag.ContinueOnError)
+		flags.SetOutput(out)
+		name := flags.String("name", "", "name shown on the consent page")
+		scope := flags.String("scope", "", "space separated scopes the client can request")
+		public := flags.Bool("public", false, "register a client without secret, e.g. a single page or mobile app")
+		var redirectURIs, postLogoutRedirectURIs stringsFlag
+		flags.Var(&redirectURIs, "redirect-uri", "redirect uri of the client, can be repeated")
+		flags.Var(&postLogoutRedirectURIs, "post-logout-redirect-uri", "uri the client may send the user back to after logout, can be repeated")
+		if err := flags.Parse(args[1:]); err != nil {
+			return 2
+		}
+
+		client, secret, err := oauthService.RegisterClient(ctx, &domain.OAuthClientRegistration{
+			Name:                   *name,
+			RedirectURIs:           redirectURIs,
+			PostLogoutRedirectURIs: postLogoutRedirectURIs,
+			Scopes:                 strings.Fields(*scope),
+			Confidential:           !*public,
+		})
+		if err != nil {
+			log.Error().Err(err).Sendf("failed to create client: %v", err)
+			return 1
+		}
+
+		fmt.Fprintf(out, "client_id: %s\n", client.ClientID)
+		if secret != "" {
+			fmt.Fprintf(out, "client_secret: %s\n", secret)
+		}
+	case "list":
+		clients, err := oauthService.Clients(ctx)
+		if err != nil {
+			log.Error().Err(err).Sendf("%v", err)
+			return 1
+		}
+
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "CLIENT ID\tNAME\tTYPE\tSCOPES\tREDIRECT URIS\tCREATED AT")
+		for _, c := range clients {
+			kind := "public"
+			if c.Confidential() {
+				kind = "confidential"
+			}
+
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", c.ClientID, c.Name, kind, c.Scopes, c.RedirectURIs, c.CreatedAt.UTC().Format(time.RFC3339))
+		}
+		w.Flush()
+	case "delete":
+		if len(args) != 2 {
+			fmt.Fprint(out, clientsUsage)
+			return 2
+		}
+
+		if err := oauthService.DeleteClient(ctx, args[1]); err != nil {
+			log.Error().Err(err).Sendf("failed to delete client: %v", err)
+			return 1
+		}
+
+		fmt.Fprintf(out, "deleted %s\n", args[1])
+	default:
+		fmt.Fprint(out, clientsUsage)
+		return 2
+	}
+
+	return 0
+}
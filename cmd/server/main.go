@@ -1,20 +1,44 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"net/url"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"time"
 
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/internal/domain/admin"
+	"gitlab.com/evzpav/user-auth/internal/domain/adminkey"
+	"gitlab.com/evzpav/user-auth/internal/domain/apikey"
+	"gitlab.com/evzpav/user-auth/internal/domain/audit"
 	"gitlab.com/evzpav/user-auth/internal/domain/auth"
+	"gitlab.com/evzpav/user-auth/internal/domain/job"
+	"gitlab.com/evzpav/user-auth/internal/domain/mfa"
+	"gitlab.com/evzpav/user-auth/internal/domain/oauth"
+	"gitlab.com/evzpav/user-auth/internal/domain/organization"
+	"gitlab.com/evzpav/user-auth/internal/domain/passkey"
+	"gitlab.com/evzpav/user-auth/internal/domain/rbac"
+	"gitlab.com/evzpav/user-auth/internal/domain/session"
 	"gitlab.com/evzpav/user-auth/internal/domain/template"
+	"gitlab.com/evzpav/user-auth/internal/domain/throttle"
+	"gitlab.com/evzpav/user-auth/internal/domain/token"
 	"gitlab.com/evzpav/user-auth/internal/domain/user"
+	githublogin "gitlab.com/evzpav/user-auth/internal/infrastructure/client/github_login"
 	googlemaps "gitlab.com/evzpav/user-auth/internal/infrastructure/client/google_maps"
-	googlesignin "gitlab.com/evzpav/user-auth/internal/infrastructure/client/google_signin"
+	oidclogin "gitlab.com/evzpav/user-auth/internal/infrastructure/client/oidc_login"
 
+	mailers "gitlab.com/evzpav/user-auth/internal/infrastructure/mailer"
 	"gitlab.com/evzpav/user-auth/internal/infrastructure/server/http"
-	mysql "gitlab.com/evzpav/user-auth/internal/infrastructure/storage/mysql"
+	"gitlab.com/evzpav/user-auth/internal/infrastructure/storage/memory"
 	"gitlab.com/evzpav/user-auth/pkg/env"
+	"gitlab.com/evzpav/user-auth/pkg/jwt"
 	"gitlab.com/evzpav/user-auth/pkg/log"
+	"gitlab.com/evzpav/user-auth/pkg/oidc"
+	"gitlab.com/evzpav/user-auth/pkg/webauthn"
 )
 
 const (
@@ -22,16 +46,74 @@ const (
 	envVarPort          = "PORT"
 	envVarPlatformURL   = "PLATFORM_URL"
 	envVarLoggerLevel   = "LOGGER_LEVEL"
-	envVarMySQLURL      = "DATABASE_URL"
+	envVarDatabaseURL   = "DATABASE_URL"
 	envVarEmailPassword = "EMAIL_PASSWORD"
 	envVarEmailFrom     = "EMAIL_FROM"
 	envVarGoogleKey     = "GOOGLE_KEY"
 	envVarGoogleSecret  = "GOOGLE_SECRET"
 	envVarGoogleMapsKey = "GOOGLE_MAPS_API_KEY"
+	envVarGithubID      = "GITHUB_CLIENT_ID"
+	envVarGithubSecret  = "GITHUB_CLIENT_SECRET"
 	envVarSessionKey    = "SESSION_KEY"
+	envVarStorageDriver = "STORAGE_DRIVER"
 
-	defaultProjectPort = "5001"
-	defaultLoggerLevel = "info"
+	envVarLoginProviders = "LOGIN_PROVIDERS"
+	// per provider, e.g. LOGIN_PROVIDER_GITLAB_ISSUER for the provider gitlab
+	envVarLoginProviderPrefix = "LOGIN_PROVIDER_"
+
+	envVarJWTPrivateKeys  = "JWT_PRIVATE_KEYS"
+	envVarJWTSigningKeyID = "JWT_SIGNING_KEY_ID"
+	envVarJWTIssuer       = "JWT_ISSUER"
+	envVarJWTAudience     = "JWT_AUDIENCE"
+	envVarAccessTokenTTL  = "JWT_ACCESS_TOKEN_TTL"
+	envVarRefreshTokenTTL = "JWT_REFRESH_TOKEN_TTL"
+
+	envVarOAuthAccessTokenTTL  = "OAUTH_ACCESS_TOKEN_TTL"
+	envVarOAuthRefreshTokenTTL = "OAUTH_REFRESH_TOKEN_TTL"
+
+	envVarWebAuthnRPID   = "WEBAUTHN_RP_ID"
+	envVarWebAuthnRPName = "WEBAUTHN_RP_NAME"
+	envVarWebAuthnOrigin = "WEBAUTHN_ORIGIN"
+
+	envVarMailerDriver    = "MAILER_DRIVER"
+	envVarMailerOutboxDir = "MAILER_OUTBOX_DIR"
+	envVarSMTPHost        = "SMTP_HOST"
+	envVarSMTPPort        = "SMTP_PORT"
+	envVarSMTPTLS         = "SMTP_TLS"
+	envVarSMTPUsername    = "SMTP_USERNAME"
+	envVarSMTPPassword    = "SMTP_PASSWORD"
+
+	envVarJobWorkers     = "JOB_WORKERS"
+	envVarJobMaxAttempts = "JOB_MAX_ATTEMPTS"
+
+	envVarEmailVerificationPolicy = "EMAIL_VERIFICATION_POLICY"
+	envVarEmailVerificationKey    = "EMAIL_VERIFICATION_KEY"
+	envVarEmailVerificationTTL    = "EMAIL_VERIFICATION_TTL"
+
+	envVarOrgInvitationTTL = "ORG_INVITATION_TTL"
+
+	envVarThrottleStore              = "THROTTLE_STORE"
+	envVarThrottleLoginEmailAttempts = "THROTTLE_LOGIN_EMAIL_ATTEMPTS"
+	envVarThrottleLoginIPAttempts    = "THROTTLE_LOGIN_IP_ATTEMPTS"
+	envVarThrottleLockout            = "THROTTLE_LOCKOUT"
+	envVarThrottleMaxLockout         = "THROTTLE_MAX_LOCKOUT"
+
+	defaultProjectPort     = "5001"
+	defaultLoggerLevel     = "info"
+	defaultWebAuthnRPName  = "user-auth"
+	defaultThrottleStore   = "memory"
+	defaultStorageDriver   = "mysql"
+	defaultMailerDriver    = "smtp"
+	defaultSMTPHost        = "smtp.gmail.com"
+	defaultSMTPPort        = 587
+	defaultVerificationTTL = 48 * 60 * 60      // 48 hours in seconds
+	defaultInvitationTTL   = 7 * 24 * 60 * 60  // 7 days in seconds
+	defaultAccessTokenTTL  = 15 * 60           // 15 minutes in seconds
+	defaultRefreshTokenTTL = 30 * 24 * 60 * 60 // 30 days in seconds
+	defaultOAuthAccessTTL  = 60 * 60           // 1 hour in seconds
+	googleIssuer           = "https://accounts.google.com"
+
+	sessionTTL = 7 * 24 * time.Hour // same as the session cookie
 )
 
 var (
@@ -43,40 +125,162 @@ func main() {
 
 	log.Info().Sendf("user-auth - build:%s; date:%s", build, date)
 
-	env.CheckRequired(log, envVarMySQLURL, envVarEmailFrom, envVarEmailPassword, envVarGoogleKey, envVarGoogleSecret, envVarGoogleMapsKey, envVarPlatformURL)
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrate(os.Args[2:], log, os.Stdout))
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "clients" {
+		os.Exit(runClients(os.Args[2:], log, os.Stdout))
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "roles" {
+		os.Exit(runRoles(os.Args[2:], log, os.Stdout))
+	}
 
-	db, err := mysql.New(getMySQLURL())
+	if len(os.Args) > 1 && os.Args[1] == "admin-keys" {
+		os.Exit(runAdminKeys(os.Args[2:], log, os.Stdout))
+	}
+
+	env.CheckRequired(log, envVarDatabaseURL, envVarEmailFrom, envVarGoogleMapsKey, envVarPlatformURL)
+
+	// storages
+	storages, err := newStorages(getStorageDriver(), getDatabaseURL(), log)
 	if err != nil {
-		log.Fatal().Err(err).Sendf("failed to connect to mysql: %v", err)
+		log.Fatal().Err(err).Sendf("error creating storage: %v", err)
 	}
 
 	defer func() {
-		if err := db.Close(); err != nil {
+		if err := storages.db.Close(); err != nil {
 			log.Error().Err(err).Sendf("error closing database: %v", err)
 		}
 	}()
 
-	// storages
-	userStorage, err := mysql.NewUserStorage(db, log)
+	// an embedded database has no separate deploy step, it is migrated on start
+	if getStorageDriver() == "sqlite" {
+		if _, err := storages.migrator.Up(context.Background()); err != nil {
+			log.Fatal().Err(err).Sendf("failed to migrate database: %v", err)
+		}
+	}
+
+	pending, err := storages.migrator.Pending(context.Background())
 	if err != nil {
-		log.Fatal().Err(err).Sendf("error creating storage: %v", err)
+		log.Fatal().Err(err).Sendf("failed to check migrations: %v", err)
+	}
+
+	if len(pending) > 0 {
+		log.Warn().Sendf("%d pending migrations, run user-auth migrate up", len(pending))
+	}
+
+	var throttleStore domain.ThrottleStore
+	switch getThrottleStore() {
+	case "database", "mysql":
+		throttleStore = storages.throttle
+	case "memory":
+		throttleStore = memory.NewThrottleStore()
+	default:
+		log.Fatal().Sendf("invalid %s %q, use memory or database", envVarThrottleStore, getThrottleStore())
+	}
+
+	var mailer domain.Mailer
+	switch getMailerDriver() {
+	case "smtp":
+		mailer, err = mailers.NewSMTP(mailers.SMTPConfig{
+			Host:     getSMTPHost(),
+			Port:     getSMTPPort(),
+			TLS:      getSMTPTLS(),
+			Username: getSMTPUsername(),
+			Password: getSMTPPassword(),
+			From:     getEmailFrom(),
+		})
+		if err != nil {
+			log.Fatal().Err(err).Sendf("failed to configure smtp: %v", err)
+		}
+	case "outbox":
+		mailer, err = mailers.NewOutbox(getEmailFrom(), getMailerOutboxDir(), os.Stdout)
+		if err != nil {
+			log.Fatal().Err(err).Sendf("failed to create outbox: %v", err)
+		}
+	default:
+		log.Fatal().Sendf("invalid %s %q, use smtp or outbox", envVarMailerDriver, getMailerDriver())
 	}
 
 	//clients
-	googleSigninClient := googlesignin.New(getGoogleKey(), getGoogleSecret(), getPlatformURL()+"/login/google/auth")
+	loginProviders, err := getLoginProviders()
+	if err != nil {
+		log.Fatal().Err(err).Sendf("failed to configure login providers: %v", err)
+	}
+
 	googleMapsClient, err := googlemaps.New(getGoogleMapsKey())
 	if err != nil {
 		log.Warn().Err(err).Sendf("failed to initiate google maps client: %v", err)
 	}
 
 	// services
-	userService := user.NewService(userStorage, log)
-	authService := auth.NewService(userService, getEmailFrom(), getEmailPassword(), googleSigninClient, getPlatformURL(), log)
+	jobService := job.NewService(storages.jobs, getJobConfig(), log)
+	jobService.Register(domain.JobSendEmail, mailers.SendEmailJob(mailer))
+
+	userService := user.NewService(storages.users, log)
 	templateService := template.NewService(googleMapsClient, log)
+	verificationPolicy := domain.EmailVerificationPolicy(getEmailVerificationPolicy())
+	if !verificationPolicy.Valid() {
+		log.Fatal().Sendf("invalid %s %q, use optional, restrict_profile or block_login", envVarEmailVerificationPolicy, verificationPolicy)
+	}
+
+	sessionService := session.NewService(storages.sessions, userService, sessionTTL, log)
+	mfaService := mfa.NewService(userService, "user-auth", log)
+
+	relyingParty, err := webauthn.New(webauthn.Config{
+		RPID:   getWebAuthnRPID(),
+		RPName: getWebAuthnRPName(),
+		Origin: getWebAuthnOrigin(),
+	})
+	if err != nil {
+		log.Fatal().Err(err).Sendf("failed to configure webauthn: %v", err)
+	}
+	webAuthnService := passkey.NewService(relyingParty, storages.webAuthnCredentials, storages.webAuthnChallenges, userService, log)
+	throttleService := throttle.NewService(throttleStore, getThrottleConfig(), log)
+
+	orgService := organization.NewService(storages.organizations, storages.orgInvitations, userService, mailers.NewQueued(jobService), templateService, getPlatformURL(), organization.Config{
+		Key: []byte(getEmailVerificationKey()),
+		TTL: getOrgInvitationTTL(),
+	}, log)
+
+	var tokenService domain.TokenService
+	if keyPaths := getJWTPrivateKeys(); len(keyPaths) > 0 {
+		keys, err := jwt.LoadKeyFiles(keyPaths...)
+		if err != nil {
+			log.Fatal().Err(err).Sendf("failed to load jwt keys: %v", err)
+		}
+
+		tokenService, err = token.NewService(keys, getJWTSigningKeyID(), storages.refreshTokens, userService, orgService, token.Config{
+			Issuer:          getJWTIssuer(),
+			Audience:        getJWTAudience(),
+			AccessTokenTTL:  getAccessTokenTTL(),
+			RefreshTokenTTL: getRefreshTokenTTL(),
+		}, log)
+		if err != nil {
+			log.Fatal().Err(err).Sendf("failed to create token service: %v", err)
+		}
+	}
+
+	authService := auth.NewService(userService, storages.userIdentities, storages.passwordResetTokens, sessionService, tokenService, mailers.NewQueued(jobService), templateService, loginProviders, getPlatformURL(), auth.EmailVerificationConfig{
+		Key:    []byte(getEmailVerificationKey()),
+		TTL:    getEmailVerificationTTL(),
+		Policy: verificationPolicy,
+	}, log)
+
+	oauthService := newOAuthService(storages, userService, tokenService, log)
+	rbacService := rbac.NewService(storages.roles, log)
+	adminService := admin.NewService(userService, rbacService, sessionService, authService, tokenService, log)
+	adminKeyService := adminkey.NewService(storages.adminAPIKeys, log)
+	apiKeyService := apikey.NewService(storages.apiKeys, userService, log)
+	auditService := audit.NewService(storages.auditEvents, log)
 
 	// HTTP Server
-	handler := http.NewHandler(userService, authService, templateService, getSessionKey(), log)
+	handler := http.NewHandler(userService, authService, templateService, sessionService, mfaService, webAuthnService, throttleService, tokenService, oauthService, rbacService, adminService, adminKeyService, apiKeyService, orgService, auditService, getSessionKey(), log)
 	server := http.New(handler, getProjectHost(), getProjectPort(), log)
+	server.OnShutdown(jobService.Stop)
+	jobService.Start()
 	server.ListenAndServe()
 
 	// Graceful shutdown
@@ -102,8 +306,12 @@ func getLoggerLevel() string {
 	return env.GetString(envVarLoggerLevel, defaultLoggerLevel)
 }
 
-func getMySQLURL() string {
-	return env.GetString(envVarMySQLURL)
+func getDatabaseURL() string {
+	return env.GetString(envVarDatabaseURL)
+}
+
+func getStorageDriver() string {
+	return env.GetString(envVarStorageDriver, defaultStorageDriver)
 }
 
 func getEmailFrom() string {
@@ -114,6 +322,37 @@ func getEmailPassword() string {
 	return env.GetString(envVarEmailPassword)
 }
 
+func getMailerDriver() string {
+	return env.GetString(envVarMailerDriver, defaultMailerDriver)
+}
+
+// getMailerOutboxDir is empty to print the emails to stdout
+func getMailerOutboxDir() string {
+	return env.GetString(envVarMailerOutboxDir)
+}
+
+func getSMTPHost() string {
+	return env.GetString(envVarSMTPHost, defaultSMTPHost)
+}
+
+func getSMTPPort() int {
+	return env.GetInt(envVarSMTPPort, defaultSMTPPort)
+}
+
+func getSMTPTLS() string {
+	return env.GetString(envVarSMTPTLS, mailers.TLSStartTLS)
+}
+
+// getSMTPUsername defaults to the sender address, like gmail expects
+func getSMTPUsername() string {
+	return env.GetString(envVarSMTPUsername, getEmailFrom())
+}
+
+// getSMTPPassword defaults to EMAIL_PASSWORD, kept from the gmail only configuration
+func getSMTPPassword() string {
+	return env.GetString(envVarSMTPPassword, getEmailPassword())
+}
+
 func getGoogleKey() string {
 	return env.GetString(envVarGoogleKey)
 }
@@ -122,6 +361,95 @@ func getGoogleSecret() string {
 	return env.GetString(envVarGoogleSecret)
 }
 
+// getLoginProviders creates the providers listed in LOGIN_PROVIDERS, Google when GOOGLE_KEY is set
+// and GitHub when GITHUB_CLIENT_ID is set. Google keeps the callback registered before the
+// providers were configurable.
+func getLoginProviders() ([]domain.LoginProvider, error) {
+	var providers []domain.LoginProvider
+
+	if getGoogleKey() != "" {
+		provider, err := oidclogin.New("google", "Google", oidc.Config{
+			Issuer:       googleIssuer,
+			ClientID:     getGoogleKey(),
+			ClientSecret: getGoogleSecret(),
+			RedirectURL:  getPlatformURL() + "/login/google/auth",
+		})
+		if err != nil {
+			return nil, fmt.Errorf("google: %w", err)
+		}
+
+		providers = append(providers, provider)
+	}
+
+	if getGithubID() != "" {
+		providers = append(providers, githublogin.New(getGithubID(), getGithubSecret(), getPlatformURL()+"/login/github/callback"))
+	}
+
+	for _, name := range strings.Split(env.GetString(envVarLoginProviders), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		if !validProviderName(name) {
+			return nil, fmt.Errorf("invalid provider name %q, use lowercase letters, digits and dashes", name)
+		}
+
+		for _, provider := range providers {
+			if provider.Name() == name {
+				return nil, fmt.Errorf("provider %s configured twice", name)
+			}
+		}
+
+		prefix := envVarLoginProviderPrefix + strings.ToUpper(strings.Replace(name, "-", "_", -1)) + "_"
+
+		var scopes []string
+		if value := env.GetString(prefix + "SCOPES"); value != "" {
+			scopes = strings.Fields(strings.Replace(value, ",", " ", -1))
+		}
+
+		provider, err := oidclogin.New(name, env.GetString(prefix+"DISPLAY_NAME", strings.Title(name)), oidc.Config{
+			Issuer:       env.GetString(prefix + "ISSUER"),
+			ClientID:     env.GetString(prefix + "CLIENT_ID"),
+			ClientSecret: env.GetString(prefix + "CLIENT_SECRET"),
+			RedirectURL:  getPlatformURL() + "/login/" + name + "/callback",
+			Scopes:       scopes,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+
+		providers = append(providers, provider)
+	}
+
+	return providers, nil
+}
+
+// validProviderName accepts names usable in the routes of the providers, except the other
+// routes under /login and the providers configured by their own variables
+func validProviderName(name string) bool {
+	switch name {
+	case "mfa", "passkey", "google", "github":
+		return false
+	}
+
+	for _, c := range name {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' {
+			return false
+		}
+	}
+
+	return true
+}
+
+func getGithubID() string {
+	return env.GetString(envVarGithubID)
+}
+
+func getGithubSecret() string {
+	return env.GetString(envVarGithubSecret)
+}
+
 func getSessionKey() string {
 	return env.GetString(envVarSessionKey)
 }
@@ -129,3 +457,117 @@ func getSessionKey() string {
 func getGoogleMapsKey() string {
 	return env.GetString(envVarGoogleMapsKey)
 }
+
+func getJWTPrivateKeys() []string {
+	value := env.GetString(envVarJWTPrivateKeys)
+	if value == "" {
+		return nil
+	}
+
+	return strings.Split(value, ",")
+}
+
+func getJWTSigningKeyID() string {
+	return env.GetString(envVarJWTSigningKeyID)
+}
+
+func getJWTIssuer() string {
+	return env.GetString(envVarJWTIssuer, getPlatformURL())
+}
+
+func getJWTAudience() string {
+	return env.GetString(envVarJWTAudience)
+}
+
+func getAccessTokenTTL() time.Duration {
+	return time.Duration(env.GetInt(envVarAccessTokenTTL, defaultAccessTokenTTL)) * time.Second
+}
+
+func getRefreshTokenTTL() time.Duration {
+	return time.Duration(env.GetInt(envVarRefreshTokenTTL, defaultRefreshTokenTTL)) * time.Second
+}
+
+// getOAuthAccessTokenTTL is longer than the one of the JWT access tokens, the OAuth tokens are
+// revoked by the clients and checked by introspection
+func getOAuthAccessTokenTTL() time.Duration {
+	return time.Duration(env.GetInt(envVarOAuthAccessTokenTTL, defaultOAuthAccessTTL)) * time.Second
+}
+
+func getOAuthRefreshTokenTTL() time.Duration {
+	return time.Duration(env.GetInt(envVarOAuthRefreshTokenTTL, defaultRefreshTokenTTL)) * time.Second
+}
+
+// newOAuthService makes the authorization server an OpenID Connect provider when the token service
+// can sign ID tokens
+func newOAuthService(storages *storages, userService domain.UserService, tokenService domain.TokenService, log log.Logger) domain.OAuthService {
+	return oauth.NewService(storages.oauthClients, storages.oauthCodes, storages.oauthTokens, storages.oauthConsents, userService, tokenService, oauth.Config{
+		// the discovery document appends the endpoint paths to the issuer
+		Issuer:          strings.TrimRight(getPlatformURL(), "/"),
+		AccessTokenTTL:  getOAuthAccessTokenTTL(),
+		RefreshTokenTTL: getOAuthRefreshTokenTTL(),
+	}, log)
+}
+
+// getWebAuthnRPID defaults to the host name of the platform url
+func getWebAuthnRPID() string {
+	if rpID := env.GetString(envVarWebAuthnRPID); rpID != "" {
+		return rpID
+	}
+
+	platformURL, err := url.Parse(getPlatformURL())
+	if err != nil {
+		return ""
+	}
+
+	return platformURL.Hostname()
+}
+
+func getWebAuthnRPName() string {
+	return env.GetString(envVarWebAuthnRPName, defaultWebAuthnRPName)
+}
+
+func getWebAuthnOrigin() string {
+	return strings.TrimRight(env.GetString(envVarWebAuthnOrigin, getPlatformURL()), "/")
+}
+
+func getThrottleStore() string {
+	return env.GetString(envVarThrottleStore, defaultThrottleStore)
+}
+
+// getThrottleConfig overrides the login thresholds of the default policies
+func getThrottleConfig() throttle.Config {
+	config := throttle.DefaultConfig()
+	for kind, envVar := range map[string]string{"email": envVarThrottleLoginEmailAttempts, "ip": envVarThrottleLoginIPAttempts} {
+		policy := config[domain.ThrottleLogin][kind]
+		policy.MaxAttempts = env.GetInt(envVar, policy.MaxAttempts)
+		policy.Lockout = time.Duration(env.GetInt(envVarThrottleLockout, int(policy.Lockout/time.Second))) * time.Second
+		policy.MaxLockout = time.Duration(env.GetInt(envVarThrottleMaxLockout, int(policy.MaxLockout/time.Second))) * time.Second
+		config[domain.ThrottleLogin][kind] = policy
+	}
+
+	return config
+}
+
+func getEmailVerificationPolicy() string {
+	return env.GetString(envVarEmailVerificationPolicy, string(domain.EmailVerificationOptional))
+}
+
+func getEmailVerificationKey() string {
+	return env.GetString(envVarEmailVerificationKey)
+}
+
+func getEmailVerificationTTL() time.Duration {
+	return time.Duration(env.GetInt(envVarEmailVerificationTTL, defaultVerificationTTL)) * time.Second
+}
+
+func getOrgInvitationTTL() time.Duration {
+	return time.Duration(env.GetInt(envVarOrgInvitationTTL, defaultInvitationTTL)) * time.Second
+}
+
+func getJobConfig() job.Config {
+	config := job.DefaultConfig()
+	config.Workers = env.GetInt(envVarJobWorkers, config.Workers)
+	config.MaxAttempts = env.GetInt(envVarJobMaxAttempts, config.MaxAttempts)
+
+	return config
+}
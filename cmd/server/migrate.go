@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"gitlab.com/evzpav/user-auth/pkg/env"
+	"gitlab.com/evzpav/user-auth/pkg/log"
+	"gitlab.com/evzpav/user-auth/pkg/migrate"
+)
+
+const migrateUsage = `usage: user-auth migrate <command>
+
+commands:
+  up             apply the pending migrations
+  down           revert the last applied migration
+  status         list the migrations and when they were applied
+  create <name>  write the next migration of every driver, run from the repository root
+`
+
+// migrationsDirs of the storage drivers, relative to the repository root
+var migrationsDirs = []string{
+	"internal/infrastructure/storage/mysql/migrations",
+	"internal/infrastructure/storage/postgres/migrations",
+	"internal/infrastructure/storage/sqlite/migrations",
+}
+
+// runMigrate runs the migrate subcommand and returns the exit code
+func runMigrate(args []string, log log.Logger, out io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(out, migrateUsage)
+		return 2
+	}
+
+	if args[0] == "create" {
+		if len(args) != 2 {
+			fmt.Fprint(out, migrateUsage)
+			return 2
+		}
+
+		for _, dir := range migrationsDirs {
+			path, err := migrate.Create(filepath.FromSlash(dir), args[1])
+			if err != nil {
+				log.Error().Err(err).Sendf("failed to create migration: %v", err)
+				return 1
+			}
+
+			fmt.Fprintf(out, "created %s\n", path)
+		}
+
+		return 0
+	}
+
+	env.CheckRequired(log, envVarDatabaseURL)
+
+	db, _, migrator, err := openDatabase(getStorageDriver(), getDatabaseURL())
+	if err != nil {
+		log.Error().Err(err).Sendf("%v", err)
+		return 1
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		for _, m := range applied {
+			fmt.Fprintf(out, "applied %d %s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Error().Err(err).Sendf("%v", err)
+			return 1
+		}
+
+		if len(applied) == 0 {
+			fmt.Fprintln(out, "no pending migrations")
+		}
+	case "down":
+		reverted, err := migrator.Down(ctx)
+		if err != nil {
+			log.Error().Err(err).Sendf("%v", err)
+			return 1
+		}
+
+		if reverted == nil {
+			fmt.Fprintln(out, "no applied migrations")
+			return 0
+		}
+
+		fmt.Fprintf(out, "reverted %d %s\n", reverted.Version, reverted.Name)
+	case "status":
+		status, err := migrator.Status(ctx)
+		if err != nil {
+			log.Error().Err(err).Sendf("%v", err)
+			return 1
+		}
+
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, s := range status {
+			appliedAt := "pending"
+			if s.AppliedAt != nil {
+				appliedAt = s.AppliedAt.UTC().Format(time.RFC3339)
+			}
+
+			fmt.Fprintf(w, "%d\t%s\t%s\n", s.Version, s.Name, appliedAt)
+		}
+		w.Flush()
+	default:
+		fmt.Fprint(out, migrateUsage)
+		return 2
+	}
+
+	return 0
+}
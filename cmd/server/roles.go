@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"gitlab.com/evzpav/user-auth/internal/domain/rbac"
+	"gitlab.com/evzpav/user-auth/internal/domain/user"
+	"gitlab.com/evzpav/user-auth/pkg/env"
+	"gitlab.com/evzpav/user-auth/pkg/log"
+)
+
+const rolesUsage = `usage: user-auth roles <command>
+
+commands:
+  list                   list the roles and their permissions
+  grant <email> <role>   give the role to the user, e.g. grant the first admin
+  revoke <email> <role>  take the role from the user
+`
+
+// runRoles runs the roles subcommand, which assigns the roles of the admin area, and returns the
+// exit code
+func runRoles(args []string, log log.Logger, out io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(out, rolesUsage)
+		return 2
+	}
+
+	env.CheckRequired(log, envVarDatabaseURL)
+
+	storages, err := newStorages(getStorageDriver(), getDatabaseURL(), log)
+	if err != nil {
+		log.Error().Err(err).Sendf("%v", err)
+		return 1
+	}
+	defer storages.db.Close()
+
+	userService := user.NewService(storages.users, log)
+	rbacService := rbac.NewService(storages.roles, log)
+
+	ctx := context.Background()
+	switch args[0] {
+	case "list":
+		roles, err := rbacService.Roles(ctx)
+		if err != nil {
+			log.Error().Err(err).Sendf("%v", err)
+			return 1
+		}
+
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tDESCRIPTION\tPERMISSIONS")
+		for _, role := range roles {
+			permissions := make([]string, 0, len(role.Permissions))
+			for _, permission := range role.Permissions {
+				permissions = append(permissions, string(permission))
+			}
+
+			fmt.Fprintf(w, "%s\t%s\t%s\n", role.Name, role.Description, strings.Join(permissions, " "))
+		}
+		w.Flush()
+	case "grant", "revoke":
+		if len(args) != 3 {
+			fmt.Fprint(out, rolesUsage)
+			return 2
+		}
+
+		u, err := userService.FindByEmail(ctx, args[1])
+		if err != nil {
+			log.Error().Err(err).Sendf("%v", err)
+			return 1
+		}
+
+		if u == nil {
+			log.Error().Sendf("user %s not found", args[1])
+			return 1
+		}
+
+		if args[0] == "grant" {
+			if err := rbacService.AssignRole(ctx, u.ID, args[2]); err != nil {
+				log.Error().Err(err).Sendf("failed to grant role: %v", err)
+				return 1
+			}
+
+			fmt.Fprintf(out, "granted %s to %s\n", args[2], u.Email)
+			break
+		}
+
+		if err := rbacService.RemoveRole(ctx, u.ID, args[2]); err != nil {
+			log.Error().Err(err).Sendf("failed to revoke role: %v", err)
+			return 1
+		}
+
+		fmt.Fprintf(out, "revoked %s from %s\n", args[2], u.Email)
+	default:
+		fmt.Fprint(out, rolesUsage)
+		return 2
+	}
+
+	return 0
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/jinzhu/gorm"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	mysql "gitlab.com/evzpav/user-auth/internal/infrastructure/storage/mysql"
+	mysqlmigrations "gitlab.com/evzpav/user-auth/internal/infrastructure/storage/mysql/migrations"
+	"gitlab.com/evzpav/user-auth/internal/infrastructure/storage/postgres"
+	postgresmigrations "gitlab.com/evzpav/user-auth/internal/infrastructure/storage/postgres/migrations"
+	"gitlab.com/evzpav/user-auth/internal/infrastructure/storage/sqlite"
+	sqlitemigrations "gitlab.com/evzpav/user-auth/internal/infrastructure/storage/sqlite/migrations"
+	"gitlab.com/evzpav/user-auth/internal/infrastructure/storage/sqlstore"
+	"gitlab.com/evzpav/user-auth/pkg/log"
+	"gitlab.com/evzpav/user-auth/pkg/migrate"
+)
+
+// storages of the backend selected by STORAGE_DRIVER
+type storages struct {
+	db       *gorm.DB
+	migrator *migrate.Migrator
+
+	users               domain.UserStorage
+	refreshTokens       domain.RefreshTokenStorage
+	userIdentities      domain.UserIdentityStorage
+	passwordResetTokens domain.PasswordResetTokenStorage
+	sessions            domain.SessionStorage
+	webAuthnCredentials domain.WebAuthnCredentialStorage
+	webAuthnChallenges  domain.WebAuthnChallengeStorage
+	throttle            domain.ThrottleStore
+	jobs                domain.JobStorage
+	oauthClients        domain.OAuthClientStorage
+	oauthCodes          domain.OAuthAuthorizationCodeStorage
+	oauthTokens         domain.OAuthTokenStorage
+	oauthConsents       domain.OAuthConsentStorage
+	roles               domain.RoleStorage
+	adminAPIKeys        domain.AdminAPIKeyStorage
+	apiKeys             domain.APIKeyStorage
+	organizations       domain.OrganizationStorage
+	orgInvitations      domain.OrgInvitationStorage
+	auditEvents         domain.AuditStorage
+}
+
+func newStorages(driver, url string, log log.Logger) (*storages, error) {
+	db, dialect, migrator, err := openDatabase(driver, url)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := newSQLStorages(db, dialect, log)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	s.db = db
+	s.migrator = migrator
+	return s, nil
+}
+
+// openDatabase connects to the database of the driver and creates the migrator of its schema
+func openDatabase(driver, url string) (*gorm.DB, sqlstore.Dialect, *migrate.Migrator, error) {
+	var db *gorm.DB
+	var dialect sqlstore.Dialect
+	var migrations []migrate.Migration
+	var err error
+
+	switch driver {
+	case "mysql":
+		db, err = mysql.New(url)
+		dialect, migrations = mysql.Dialect, mysqlmigrations.All()
+	case "postgres":
+		db, err = postgres.New(url)
+		dialect, migrations = postgres.Dialect, postgresmigrations.All()
+	case "sqlite":
+		db, err = sqlite.New(url)
+		dialect, migrations = sqlite.Dialect, sqlitemigrations.All()
+	default:
+		return nil, dialect, nil, fmt.Errorf("invalid %s %q, use mysql, postgres or sqlite", envVarStorageDriver, driver)
+	}
+	if err != nil {
+		return nil, dialect, nil, fmt.Errorf("failed to open %s database: %v", driver, err)
+	}
+
+	migrator, err := migrate.New(db.DB(), driver, migrations)
+	if err != nil {
+		db.Close()
+		return nil, dialect, nil, err
+	}
+
+	return db, dialect, migrator, nil
+}
+
+// newSQLStorages creates the storages on the database, the dialect is the one of its driver
+func newSQLStorages(db *gorm.DB, dialect sqlstore.Dialect, log log.Logger) (*storages, error) {
+	var err error
+	s := &storages{}
+	if s.users, err = sqlstore.NewUserStorage(db, dialect, log); err != nil {
+		return nil, err
+	}
+
+	if s.userIdentities, err = sqlstore.NewUserIdentityStorage(db, dialect, log); err != nil {
+		return nil, err
+	}
+
+	if s.refreshTokens, err = sqlstore.NewRefreshTokenStorage(db, log); err != nil {
+		return nil, err
+	}
+
+	if s.passwordResetTokens, err = sqlstore.NewPasswordResetTokenStorage(db, log); err != nil {
+		return nil, err
+	}
+
+	if s.sessions, err = sqlstore.NewSessionStorage(db, log); err != nil {
+		return nil, err
+	}
+
+	if s.webAuthnCredentials, err = sqlstore.NewWebAuthnCredentialStorage(db, log); err != nil {
+		return nil, err
+	}
+
+	if s.webAuthnChallenges, err = sqlstore.NewWebAuthnChallengeStorage(db, log); err != nil {
+		return nil, err
+	}
+
+	if s.throttle, err = sqlstore.NewThrottleStore(db, dialect, log); err != nil {
+		return nil, err
+	}
+
+	if s.jobs, err = sqlstore.NewJobStorage(db, dialect, log); err != nil {
+		return nil, err
+	}
+
+	if s.oauthClients, err = sqlstore.NewOAuthClientStorage(db, dialect, log); err != nil {
+		return nil, err
+	}
+
+	if s.oauthCodes, err = sqlstore.NewOAuthAuthorizationCodeStorage(db, log); err != nil {
+		return nil, err
+	}
+
+	if s.oauthTokens, err = sqlstore.NewOAuthTokenStorage(db, log); err != nil {
+		return nil, err
+	}
+
+	if s.oauthConsents, err = sqlstore.NewOAuthConsentStorage(db, dialect, log); err != nil {
+		return nil, err
+	}
+
+	if s.roles, err = sqlstore.NewRoleStorage(db, dialect, log); err != nil {
+		return nil, err
+	}
+
+	if s.adminAPIKeys, err = sqlstore.NewAdminAPIKeyStorage(db, log); err != nil {
+		return nil, err
+	}
+
+	if s.apiKeys, err = sqlstore.NewAPIKeyStorage(db, log); err != nil {
+		return nil, err
+	}
+
+	if s.organizations, err = sqlstore.NewOrganizationStorage(db, log); err != nil {
+		return nil, err
+	}
+
+	if s.orgInvitations, err = sqlstore.NewOrgInvitationStorage(db, log); err != nil {
+		return nil, err
+	}
+
+	if s.auditEvents, err = sqlstore.NewAuditStorage(db, log); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
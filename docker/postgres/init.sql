@@ -0,0 +1,3 @@
+-- the schema is created by the migrations, run user-auth migrate up. citext is created here since
+-- it needs a superuser, the application user may not be one.
+CREATE EXTENSION IF NOT EXISTS citext;
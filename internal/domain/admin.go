@@ -0,0 +1,89 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// AdminUser is an account as shown to the admins
+type AdminUser struct {
+	User     *User
+	Roles    []*Role
+	Sessions []*Session
+}
+
+// AdminUserInput is an account created by an admin, the user chooses a password from the emailed
+// link
+type AdminUserInput struct {
+	Email         string
+	Name          string
+	Address       string
+	Phone         string
+	EmailVerified bool
+}
+
+// AdminUserUpdate changes the fields that are set
+type AdminUserUpdate struct {
+	Email         *string
+	Name          *string
+	Address       *string
+	Phone         *string
+	EmailVerified *bool
+}
+
+// AdminService lets support staff manage the accounts, the permissions are checked by the caller
+type AdminService interface {
+	SearchUsers(ctx context.Context, query string) ([]*User, error)
+	// ListUsers returns a page of the users of the filter and the count of all of them
+	ListUsers(ctx context.Context, filter *UserFilter) ([]*User, int, error)
+	User(ctx context.Context, userID int) (*AdminUser, error)
+	CreateUser(ctx context.Context, input *AdminUserInput) (*User, error)
+	UpdateUser(ctx context.Context, userID int, update *AdminUserUpdate) (*User, error)
+	// DeleteUser keeps the account so it can be restored, the user is signed out everywhere
+	DeleteUser(ctx context.Context, userID int) error
+	RestoreUser(ctx context.Context, userID int) error
+	// DisableUser also signs the user out everywhere. admin is nil for API keys, admins cannot
+	// disable themselves.
+	DisableUser(ctx context.Context, admin *User, userID int) error
+	EnableUser(ctx context.Context, userID int) error
+	// ForcePasswordReset clears the password, signs the user out and emails a reset link
+	ForcePasswordReset(ctx context.Context, userID int) error
+	RevokeSessions(ctx context.Context, userID int) error
+}
+
+// AdminAPIKeyPrefix starts every admin API key so leaked keys are easy to recognize
+const AdminAPIKeyPrefix = "uak_"
+
+// AdminAPIKey authenticates the tools calling the admin API. Only the hash of the key is stored,
+// Prefix keeps its first characters so it can be told apart from the others.
+type AdminAPIKey struct {
+	ID          int        `json:"id"`
+	Name        string     `json:"name"`
+	Prefix      string     `json:"prefix"`
+	KeyHash     string     `json:"-"`
+	Permissions string     `json:"permissions"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastUsedAt  *time.Time `json:"last_used_at"`
+	RevokedAt   *time.Time `json:"revoked_at"`
+}
+
+func (k *AdminAPIKey) HasPermission(permission Permission) bool {
+	return ScopeIncludes(k.Permissions, string(permission))
+}
+
+type AdminAPIKeyService interface {
+	// Create returns the key, the plaintext is only known at creation
+	Create(ctx context.Context, name string, permissions []Permission) (*AdminAPIKey, string, error)
+	List(ctx context.Context) ([]*AdminAPIKey, error)
+	Revoke(ctx context.Context, ID int) error
+	Authenticate(ctx context.Context, key string) (*AdminAPIKey, error)
+}
+
+type AdminAPIKeyStorage interface {
+	Insert(ctx context.Context, key *AdminAPIKey) error
+	FindByHash(ctx context.Context, hash string) (*AdminAPIKey, error)
+	List(ctx context.Context) ([]*AdminAPIKey, error)
+	// Revoke returns false when there is no such key not revoked yet
+	Revoke(ctx context.Context, ID int, revokedAt time.Time) (bool, error)
+	Touch(ctx context.Context, ID int, lastUsedAt time.Time) error
+}
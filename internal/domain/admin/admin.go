@@ -0,0 +1,339 @@
+package admin
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/pkg/errors"
+	"gitlab.com/evzpav/user-auth/pkg/log"
+)
+
+// searchLimit bounds the users listed by a search, admins refine the query to find the others
+const searchLimit = 50
+
+type service struct {
+	userService    domain.UserService
+	rbacService    domain.RBACService
+	sessionService domain.SessionService
+	authService    domain.AuthService
+	tokenService   domain.TokenService
+	now            func() time.Time
+	log            log.Logger
+}
+
+// NewService creates the service of the admin area. tokenService is optional, when set the refresh
+// tokens are revoked together with the sessions.
+func NewService(userService domain.UserService, rbacService domain.RBACService, sessionService domain.SessionService, authService domain.AuthService, tokenService domain.TokenService, log log.Logger) *service {
+	return &service{
+		userService:    userService,
+		rbacService:    rbacService,
+		sessionService: sessionService,
+		authService:    authService,
+		tokenService:   tokenService,
+		now:            time.Now,
+		log:            log,
+	}
+}
+
+func (s *service) SearchUsers(ctx context.Context, query string) ([]*domain.User, error) {
+	return s.userService.List(ctx, &domain.UserFilter{Query: query, Limit: searchLimit})
+}
+
+func (s *service) ListUsers(ctx context.Context, filter *domain.UserFilter) ([]*domain.User, int, error) {
+	users, err := s.userService.List(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	total, err := s.userService.Count(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return users, total, nil
+}
+
+func (s *service) User(ctx context.Context, userID int) (*domain.AdminUser, error) {
+	user, err := s.findUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	roles, err := s.rbacService.UserRoles(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions, err := s.sessionService.List(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.AdminUser{User: user, Roles: roles, Sessions: sessions}, nil
+}
+
+// CreateUser creates an account without password and emails the link to choose one
+func (s *service) CreateUser(ctx context.Context, input *domain.AdminUserInput) (*domain.User, error) {
+	user := &domain.User{
+		Email:   strings.TrimSpace(input.Email),
+		Name:    input.Name,
+		Address: input.Address,
+		Phone:   input.Phone,
+	}
+
+	if input.EmailVerified {
+		now := s.now()
+		user.EmailVerifiedAt = &now
+	}
+
+	if err := user.Validate(); err != nil {
+		return nil, errors.NewInvalidArgument(domain.ErrInvalidProfile).WithMessage(err.Error())
+	}
+
+	if err := s.checkEmailFree(ctx, user.Email); err != nil {
+		return nil, err
+	}
+
+	if err := s.userService.Create(ctx, user); err != nil {
+		return nil, err
+	}
+
+	if err := s.sendPasswordLink(ctx, user); err != nil {
+		return nil, err
+	}
+
+	s.log.Info().Sendf("created the account of user %d", user.ID)
+	return user, nil
+}
+
+func (s *service) UpdateUser(ctx context.Context, userID int, update *domain.AdminUserUpdate) (*domain.User, error) {
+	user, err := s.findUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if update.Email != nil {
+		email := strings.TrimSpace(*update.Email)
+		// the new address is not proven to belong to the user
+		if !strings.EqualFold(email, user.Email) {
+			if err := s.checkEmailFree(ctx, email); err != nil {
+				return nil, err
+			}
+
+			user.EmailVerifiedAt = nil
+		}
+		user.Email = email
+	}
+
+	if update.Name != nil {
+		user.Name = *update.Name
+	}
+
+	if update.Address != nil {
+		user.Address = *update.Address
+	}
+
+	if update.Phone != nil {
+		user.Phone = *update.Phone
+	}
+
+	if update.EmailVerified != nil {
+		switch {
+		case !*update.EmailVerified:
+			user.EmailVerifiedAt = nil
+		case user.EmailVerifiedAt == nil:
+			now := s.now()
+			user.EmailVerifiedAt = &now
+		}
+	}
+
+	if err := user.Validate(); err != nil {
+		return nil, errors.NewInvalidArgument(domain.ErrInvalidProfile).WithMessage(err.Error())
+	}
+
+	if err := s.userService.Update(ctx, user); err != nil {
+		return nil, err
+	}
+
+	s.log.Info().Sendf("updated the account of user %d", user.ID)
+	return user, nil
+}
+
+func (s *service) DeleteUser(ctx context.Context, userID int) error {
+	user, err := s.findUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if user.Deleted() {
+		return nil
+	}
+
+	now := s.now()
+	user.DeletedAt = &now
+	if err := s.userService.Update(ctx, user); err != nil {
+		return err
+	}
+
+	s.log.Info().Sendf("deleted the account of user %d", user.ID)
+	return s.revokeLogins(ctx, user.ID)
+}
+
+func (s *service) RestoreUser(ctx context.Context, userID int) error {
+	user, err := s.findUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if !user.Deleted() {
+		return nil
+	}
+
+	user.DeletedAt = nil
+	if err := s.userService.Update(ctx, user); err != nil {
+		return err
+	}
+
+	s.log.Info().Sendf("restored the account of user %d", user.ID)
+	return nil
+}
+
+func (s *service) DisableUser(ctx context.Context, admin *domain.User, userID int) error {
+	if admin != nil && admin.ID == userID {
+		return errors.NewRuleNotSatisfied(domain.ErrOwnAccount).WithMessage("you cannot disable your own account")
+	}
+
+	user, err := s.findUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if user.Disabled() {
+		return nil
+	}
+
+	now := s.now()
+	user.DisabledAt = &now
+	if err := s.userService.Update(ctx, user); err != nil {
+		return err
+	}
+
+	if admin != nil {
+		s.log.Info().Sendf("user %d disabled the account of user %d", admin.ID, user.ID)
+	} else {
+		s.log.Info().Sendf("disabled the account of user %d", user.ID)
+	}
+
+	return s.revokeLogins(ctx, user.ID)
+}
+
+func (s *service) EnableUser(ctx context.Context, userID int) error {
+	user, err := s.findUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if !user.Disabled() {
+		return nil
+	}
+
+	user.DisabledAt = nil
+	if err := s.userService.Update(ctx, user); err != nil {
+		return err
+	}
+
+	s.log.Info().Sendf("enabled the account of user %d", user.ID)
+	return nil
+}
+
+// ForcePasswordReset is used when the password may be known to someone else, the old password stops
+// working right away and the user chooses a new one from the emailed link
+func (s *service) ForcePasswordReset(ctx context.Context, userID int) error {
+	user, err := s.findUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if user.HasPassword() {
+		user.Password = ""
+		if err := s.userService.Update(ctx, user); err != nil {
+			return err
+		}
+	}
+
+	if err := s.revokeLogins(ctx, user.ID); err != nil {
+		return err
+	}
+
+	if err := s.sendPasswordLink(ctx, user); err != nil {
+		return err
+	}
+
+	s.log.Info().Sendf("forced a password reset of user %d", user.ID)
+	return nil
+}
+
+func (s *service) RevokeSessions(ctx context.Context, userID int) error {
+	user, err := s.findUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	return s.revokeLogins(ctx, user.ID)
+}
+
+// sendPasswordLink emails the link to choose a new password
+func (s *service) sendPasswordLink(ctx context.Context, user *domain.User) error {
+	token, err := s.authService.SetUserRecoveryToken(ctx, user.Email)
+	if err != nil {
+		return err
+	}
+
+	authUser := domain.NewAuthUser(user.Email, "")
+	authUser.RecoveryToken = token
+	s.authService.SendResetPasswordLink(ctx, authUser)
+	return nil
+}
+
+// revokeLogins ends the sessions and the refresh tokens, the signed access tokens already issued
+// stay valid until they expire
+func (s *service) revokeLogins(ctx context.Context, userID int) error {
+	if err := s.sessionService.RevokeAll(ctx, userID); err != nil {
+		return err
+	}
+
+	if s.tokenService == nil {
+		return nil
+	}
+
+	return s.tokenService.RevokeAll(ctx, userID)
+}
+
+func (s *service) findUser(ctx context.Context, userID int) (*domain.User, error) {
+	user, err := s.userService.FindByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if user == nil {
+		return nil, errors.NewNotFound(domain.ErrUserNotFound).WithMessage("user not found")
+	}
+
+	return user, nil
+}
+
+// checkEmailFree also counts the deleted accounts, their email stays taken so they can be restored
+func (s *service) checkEmailFree(ctx context.Context, email string) error {
+	existing, err := s.userService.FindByEmail(ctx, email)
+	if err != nil {
+		return err
+	}
+
+	if existing != nil {
+		return errors.NewDuplicatedRecord(domain.ErrEmailAlreadyUsed).WithMessage("email already being used")
+	}
+
+	return nil
+}
@@ -0,0 +1,253 @@
+package admin
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/pkg/errors"
+	"gitlab.com/evzpav/user-auth/pkg/log"
+)
+
+type fakeUserService struct {
+	domain.UserService
+	users map[int]*domain.User
+}
+
+func (f *fakeUserService) FindByID(ctx context.Context, ID int) (*domain.User, error) {
+	user, ok := f.users[ID]
+	if !ok {
+		return nil, nil
+	}
+
+	copied := *user
+	return &copied, nil
+}
+
+func (f *fakeUserService) FindByEmail(ctx context.Context, email string) (*domain.User, error) {
+	for _, user := range f.users {
+		if strings.EqualFold(user.Email, email) {
+			copied := *user
+			return &copied, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (f *fakeUserService) Create(ctx context.Context, user *domain.User) error {
+	user.ID = len(f.users) + 1
+	f.users[user.ID] = user
+	return nil
+}
+
+func (f *fakeUserService) Update(ctx context.Context, user *domain.User) error {
+	f.users[user.ID] = user
+	return nil
+}
+
+type fakeRBACService struct {
+	domain.RBACService
+}
+
+func (fakeRBACService) UserRoles(ctx context.Context, userID int) ([]*domain.Role, error) {
+	return []*domain.Role{{Name: domain.RoleAdmin}}, nil
+}
+
+type fakeSessionService struct {
+	domain.SessionService
+	revoked []int
+}
+
+func (f *fakeSessionService) List(ctx context.Context, userID int) ([]*domain.Session, error) {
+	return []*domain.Session{{UserID: userID}}, nil
+}
+
+func (f *fakeSessionService) RevokeAll(ctx context.Context, userID int) error {
+	f.revoked = append(f.revoked, userID)
+	return nil
+}
+
+type fakeTokenService struct {
+	domain.TokenService
+	revoked []int
+}
+
+func (f *fakeTokenService) RevokeAll(ctx context.Context, userID int) error {
+	f.revoked = append(f.revoked, userID)
+	return nil
+}
+
+type fakeAuthService struct {
+	domain.AuthService
+	sent []*domain.AuthUser
+}
+
+func (f *fakeAuthService) SetUserRecoveryToken(ctx context.Context, email string) (string, error) {
+	return "recovery-token", nil
+}
+
+func (f *fakeAuthService) SendResetPasswordLink(ctx context.Context, authUser *domain.AuthUser) {
+	f.sent = append(f.sent, authUser)
+}
+
+type fakes struct {
+	users    *fakeUserService
+	sessions *fakeSessionService
+	tokens   *fakeTokenService
+	auth     *fakeAuthService
+}
+
+func newTestService() (*service, *fakes) {
+	f := &fakes{
+		users: &fakeUserService{users: map[int]*domain.User{
+			1: {ID: 1, Email: "admin@example.com", Password: "password-hash"},
+			2: {ID: 2, Email: "user@example.com", Password: "password-hash"},
+		}},
+		sessions: &fakeSessionService{},
+		tokens:   &fakeTokenService{},
+		auth:     &fakeAuthService{},
+	}
+
+	s := NewService(f.users, fakeRBACService{}, f.sessions, f.auth, f.tokens, log.NewZeroLog("", "", log.Error))
+	now := time.Unix(1600000000, 0)
+	s.now = func() time.Time { return now }
+
+	return s, f
+}
+
+func requireCode(t *testing.T, err error, code errors.Code) {
+	t.Helper()
+
+	describer, ok := errors.DescriberCast(err)
+	require.True(t, ok, "expected a described error, got %v", err)
+	assert.Equal(t, code, describer.GetCode())
+}
+
+func TestService_User(t *testing.T) {
+	s, _ := newTestService()
+
+	account, err := s.User(context.Background(), 2)
+	require.NoError(t, err)
+	assert.Equal(t, "user@example.com", account.User.Email)
+	assert.Len(t, account.Roles, 1)
+	assert.Len(t, account.Sessions, 1)
+
+	_, err = s.User(context.Background(), 3)
+	_, ok := errors.NotFoundCast(err)
+	assert.True(t, ok)
+	requireCode(t, err, domain.ErrUserNotFound)
+}
+
+func TestService_DisableAndEnableUser(t *testing.T) {
+	s, f := newTestService()
+	ctx := context.Background()
+	admin := f.users.users[1]
+
+	err := s.DisableUser(ctx, admin, admin.ID)
+	requireCode(t, err, domain.ErrOwnAccount)
+	assert.False(t, f.users.users[1].Disabled())
+
+	require.NoError(t, s.DisableUser(ctx, admin, 2))
+	assert.Equal(t, s.now(), *f.users.users[2].DisabledAt)
+	assert.Equal(t, []int{2}, f.sessions.revoked)
+	assert.Equal(t, []int{2}, f.tokens.revoked)
+
+	require.NoError(t, s.DisableUser(ctx, admin, 2), "disabling again does nothing")
+	assert.Len(t, f.sessions.revoked, 1)
+
+	require.NoError(t, s.EnableUser(ctx, 2))
+	assert.False(t, f.users.users[2].Disabled())
+
+	requireCode(t, s.DisableUser(ctx, admin, 3), domain.ErrUserNotFound)
+}
+
+func TestService_ForcePasswordReset(t *testing.T) {
+	s, f := newTestService()
+
+	require.NoError(t, s.ForcePasswordReset(context.Background(), 2))
+	assert.False(t, f.users.users[2].HasPassword())
+	assert.Equal(t, []int{2}, f.sessions.revoked)
+	assert.Equal(t, []int{2}, f.tokens.revoked)
+
+	require.Len(t, f.auth.sent, 1)
+	assert.Equal(t, "user@example.com", f.auth.sent[0].Email)
+	assert.Equal(t, "recovery-token", f.auth.sent[0].RecoveryToken)
+}
+
+func TestService_RevokeSessionsWithoutTokenService(t *testing.T) {
+	s, f := newTestService()
+	s.tokenService = nil
+
+	require.NoError(t, s.RevokeSessions(context.Background(), 2))
+	assert.Equal(t, []int{2}, f.sessions.revoked)
+	assert.Empty(t, f.tokens.revoked)
+}
+
+func TestService_CreateUser(t *testing.T) {
+	s, f := newTestService()
+	ctx := context.Background()
+
+	user, err := s.CreateUser(ctx, &domain.AdminUserInput{Email: " new@example.com ", Name: "New", EmailVerified: true})
+	require.NoError(t, err)
+	assert.Equal(t, "new@example.com", f.users.users[user.ID].Email)
+	assert.False(t, user.HasPassword())
+	assert.Equal(t, s.now(), *user.EmailVerifiedAt)
+
+	require.Len(t, f.auth.sent, 1, "the user chooses a password from the emailed link")
+	assert.Equal(t, "new@example.com", f.auth.sent[0].Email)
+
+	_, err = s.CreateUser(ctx, &domain.AdminUserInput{Email: "USER@example.com"})
+	requireCode(t, err, domain.ErrEmailAlreadyUsed)
+
+	_, err = s.CreateUser(ctx, &domain.AdminUserInput{Email: "not-an-email"})
+	requireCode(t, err, domain.ErrInvalidProfile)
+}
+
+func TestService_UpdateUser(t *testing.T) {
+	s, f := newTestService()
+	ctx := context.Background()
+	verified := time.Unix(1500000000, 0)
+	f.users.users[2].EmailVerifiedAt = &verified
+
+	name := "Jane"
+	user, err := s.UpdateUser(ctx, 2, &domain.AdminUserUpdate{Name: &name})
+	require.NoError(t, err)
+	assert.Equal(t, "Jane", user.Name)
+	assert.Equal(t, verified, *user.EmailVerifiedAt, "fields not set are kept")
+
+	email := "jane@example.com"
+	user, err = s.UpdateUser(ctx, 2, &domain.AdminUserUpdate{Email: &email})
+	require.NoError(t, err)
+	assert.Equal(t, "jane@example.com", f.users.users[2].Email)
+	assert.Nil(t, user.EmailVerifiedAt, "the new email is not verified")
+
+	taken := "admin@example.com"
+	_, err = s.UpdateUser(ctx, 2, &domain.AdminUserUpdate{Email: &taken})
+	requireCode(t, err, domain.ErrEmailAlreadyUsed)
+
+	_, err = s.UpdateUser(ctx, 3, &domain.AdminUserUpdate{Name: &name})
+	requireCode(t, err, domain.ErrUserNotFound)
+}
+
+func TestService_DeleteAndRestoreUser(t *testing.T) {
+	s, f := newTestService()
+	ctx := context.Background()
+
+	require.NoError(t, s.DeleteUser(ctx, 2))
+	assert.True(t, f.users.users[2].Deleted())
+	assert.False(t, f.users.users[2].Active())
+	assert.Equal(t, []int{2}, f.sessions.revoked)
+	assert.Equal(t, []int{2}, f.tokens.revoked)
+
+	require.NoError(t, s.DeleteUser(ctx, 2), "deleting again does nothing")
+	assert.Len(t, f.sessions.revoked, 1)
+
+	require.NoError(t, s.RestoreUser(ctx, 2))
+	assert.True(t, f.users.users[2].Active())
+}
@@ -0,0 +1,140 @@
+package adminkey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/pkg/errors"
+	"gitlab.com/evzpav/user-auth/pkg/log"
+)
+
+// last used time is only written when older than this to avoid a write per request
+const touchInterval = time.Minute
+
+// the stored prefix is the key prefix and the first characters of the random part
+const prefixLength = len(domain.AdminAPIKeyPrefix) + 8
+
+const maxNameLength = 100
+
+type service struct {
+	storage domain.AdminAPIKeyStorage
+	now     func() time.Time
+	log     log.Logger
+}
+
+func NewService(storage domain.AdminAPIKeyStorage, log log.Logger) *service {
+	return &service{
+		storage: storage,
+		now:     time.Now,
+		log:     log,
+	}
+}
+
+// Create generates a key granting the permissions, only its hash is stored
+func (s *service) Create(ctx context.Context, name string, permissions []domain.Permission) (*domain.AdminAPIKey, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > maxNameLength {
+		return nil, "", errors.NewInvalidArgument(domain.ErrInvalidKeyName).WithMessage("the name is required and at most 100 characters")
+	}
+
+	if len(permissions) == 0 {
+		return nil, "", errors.NewInvalidArgument(domain.ErrInvalidPermission).WithMessage("at least one permission is required")
+	}
+
+	granted := make([]string, 0, len(permissions))
+	seen := make(map[domain.Permission]bool)
+	for _, permission := range permissions {
+		if !permission.Valid() {
+			return nil, "", errors.NewInvalidArgument(domain.ErrInvalidPermission).WithMessage("unknown permission " + string(permission))
+		}
+
+		if !seen[permission] {
+			seen[permission] = true
+			granted = append(granted, string(permission))
+		}
+	}
+
+	plaintext, err := generateKey()
+	if err != nil {
+		return nil, "", err
+	}
+
+	key := &domain.AdminAPIKey{
+		Name:        name,
+		Prefix:      plaintext[:prefixLength],
+		KeyHash:     hashKey(plaintext),
+		Permissions: strings.Join(granted, " "),
+		CreatedAt:   s.now().UTC(),
+	}
+
+	if err := s.storage.Insert(ctx, key); err != nil {
+		return nil, "", err
+	}
+
+	return key, plaintext, nil
+}
+
+func (s *service) List(ctx context.Context) ([]*domain.AdminAPIKey, error) {
+	return s.storage.List(ctx)
+}
+
+func (s *service) Revoke(ctx context.Context, ID int) error {
+	revoked, err := s.storage.Revoke(ctx, ID, s.now().UTC())
+	if err != nil {
+		return err
+	}
+
+	if !revoked {
+		return errors.NewNotFound(domain.ErrAPIKeyNotFound).WithMessage("api key not found")
+	}
+
+	return nil
+}
+
+// Authenticate returns the key when it exists and is not revoked
+func (s *service) Authenticate(ctx context.Context, plaintext string) (*domain.AdminAPIKey, error) {
+	notAuthorized := errors.NewNotAuthorized(domain.ErrInvalidAPIKey).WithMessage("invalid api key")
+
+	if !strings.HasPrefix(plaintext, domain.AdminAPIKeyPrefix) {
+		return nil, notAuthorized
+	}
+
+	key, err := s.storage.FindByHash(ctx, hashKey(plaintext))
+	if err != nil {
+		return nil, err
+	}
+
+	if key == nil || key.RevokedAt != nil {
+		return nil, notAuthorized
+	}
+
+	now := s.now().UTC()
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= touchInterval {
+		key.LastUsedAt = &now
+		if err := s.storage.Touch(ctx, key.ID, now); err != nil {
+			s.log.Warn().Err(err).Sendf("failed to update api key %d last used time", key.ID)
+		}
+	}
+
+	return key, nil
+}
+
+func generateKey() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return domain.AdminAPIKeyPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,139 @@
+package adminkey
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/pkg/errors"
+	"gitlab.com/evzpav/user-auth/pkg/log"
+)
+
+type fakeStorage struct {
+	keys []*domain.AdminAPIKey
+}
+
+func (f *fakeStorage) Insert(ctx context.Context, key *domain.AdminAPIKey) error {
+	key.ID = len(f.keys) + 1
+	f.keys = append(f.keys, key)
+	return nil
+}
+
+func (f *fakeStorage) FindByHash(ctx context.Context, hash string) (*domain.AdminAPIKey, error) {
+	for _, key := range f.keys {
+		if key.KeyHash == hash {
+			copied := *key
+			return &copied, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (f *fakeStorage) List(ctx context.Context) ([]*domain.AdminAPIKey, error) {
+	return f.keys, nil
+}
+
+func (f *fakeStorage) Revoke(ctx context.Context, ID int, revokedAt time.Time) (bool, error) {
+	for _, key := range f.keys {
+		if key.ID == ID && key.RevokedAt == nil {
+			key.RevokedAt = &revokedAt
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (f *fakeStorage) Touch(ctx context.Context, ID int, lastUsedAt time.Time) error {
+	for _, key := range f.keys {
+		if key.ID == ID {
+			key.LastUsedAt = &lastUsedAt
+		}
+	}
+
+	return nil
+}
+
+func newTestService() *service {
+	s := NewService(&fakeStorage{}, log.NewZeroLog("", "", log.Error))
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+	return s
+}
+
+func requireCode(t *testing.T, err error, code errors.Code) {
+	t.Helper()
+
+	describer, ok := errors.DescriberCast(err)
+	require.True(t, ok, "expected a described error, got %v", err)
+	assert.Equal(t, code, describer.GetCode())
+}
+
+func TestService_CreateAndAuthenticate(t *testing.T) {
+	s := newTestService()
+	ctx := context.Background()
+
+	key, plaintext, err := s.Create(ctx, " support tool ", []domain.Permission{
+		domain.PermissionUsersRead, domain.PermissionUsersWrite, domain.PermissionUsersRead,
+	})
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(plaintext, domain.AdminAPIKeyPrefix))
+	assert.Equal(t, "support tool", key.Name)
+	assert.Equal(t, plaintext[:prefixLength], key.Prefix)
+	assert.NotContains(t, key.KeyHash, plaintext, "only the hash is stored")
+	assert.Equal(t, "users:read users:write", key.Permissions)
+
+	found, err := s.Authenticate(ctx, plaintext)
+	require.NoError(t, err)
+	assert.Equal(t, key.ID, found.ID)
+	assert.True(t, found.HasPermission(domain.PermissionUsersWrite))
+	assert.False(t, found.HasPermission(domain.PermissionUsersDelete))
+	require.NotNil(t, found.LastUsedAt)
+	assert.Equal(t, s.now(), *found.LastUsedAt)
+
+	_, err = s.Authenticate(ctx, plaintext+"x")
+	requireCode(t, err, domain.ErrInvalidAPIKey)
+	_, err = s.Authenticate(ctx, "not-a-key")
+	requireCode(t, err, domain.ErrInvalidAPIKey)
+}
+
+func TestService_CreateValidates(t *testing.T) {
+	s := newTestService()
+	ctx := context.Background()
+
+	_, _, err := s.Create(ctx, " ", []domain.Permission{domain.PermissionUsersRead})
+	requireCode(t, err, domain.ErrInvalidKeyName)
+
+	_, _, err = s.Create(ctx, "tool", nil)
+	requireCode(t, err, domain.ErrInvalidPermission)
+
+	_, _, err = s.Create(ctx, "tool", []domain.Permission{"users:everything"})
+	requireCode(t, err, domain.ErrInvalidPermission)
+	_, ok := errors.InvalidArgumentCast(err)
+	assert.True(t, ok)
+}
+
+func TestService_Revoke(t *testing.T) {
+	s := newTestService()
+	ctx := context.Background()
+
+	key, plaintext, err := s.Create(ctx, "tool", []domain.Permission{domain.PermissionUsersRead})
+	require.NoError(t, err)
+
+	require.NoError(t, s.Revoke(ctx, key.ID))
+	_, err = s.Authenticate(ctx, plaintext)
+	requireCode(t, err, domain.ErrInvalidAPIKey)
+
+	requireCode(t, s.Revoke(ctx, key.ID), domain.ErrAPIKeyNotFound)
+
+	keys, err := s.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	assert.NotNil(t, keys[0].RevokedAt)
+}
@@ -0,0 +1,60 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// APIKeyPrefix starts every personal API key so leaked keys are easy to recognize
+const APIKeyPrefix = "upk_"
+
+// API key scopes limit what the scripts using a key can do on behalf of the user
+const (
+	APIKeyScopeProfileRead  = "profile:read"
+	APIKeyScopeProfileWrite = "profile:write"
+)
+
+// APIKeyScopes are the scopes a key can be given
+var APIKeyScopes = []string{APIKeyScopeProfileRead, APIKeyScopeProfileWrite}
+
+// APIKey lets a machine client act on behalf of the user without the browser session. Only the hash
+// of the key is stored, Prefix keeps its first characters so the user can tell the keys apart.
+type APIKey struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"user_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	KeyHash    string     `json:"-"`
+	Scopes     string     `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+func (k *APIKey) HasScope(scope string) bool {
+	return ScopeIncludes(k.Scopes, scope)
+}
+
+// Expired tells whether the key stopped working at the time
+func (k *APIKey) Expired(now time.Time) bool {
+	return !now.Before(k.ExpiresAt)
+}
+
+type APIKeyService interface {
+	// Create returns the key, the plaintext is only known at creation
+	Create(ctx context.Context, user *User, name string, scopes []string, ttl time.Duration) (*APIKey, string, error)
+	List(ctx context.Context, userID int) ([]*APIKey, error)
+	Revoke(ctx context.Context, userID, ID int) error
+	// Authenticate returns the key and its user when the key is valid and the account active
+	Authenticate(ctx context.Context, key string) (*APIKey, *User, error)
+}
+
+type APIKeyStorage interface {
+	Insert(ctx context.Context, key *APIKey) error
+	FindByHash(ctx context.Context, hash string) (*APIKey, error)
+	FindByUserID(ctx context.Context, userID int) ([]*APIKey, error)
+	// Revoke returns false when the user has no such key not revoked yet
+	Revoke(ctx context.Context, userID, ID int, revokedAt time.Time) (bool, error)
+	Touch(ctx context.Context, ID int, lastUsedAt time.Time) error
+}
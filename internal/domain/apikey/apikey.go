@@ -0,0 +1,178 @@
+package apikey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/pkg/errors"
+	"gitlab.com/evzpav/user-auth/pkg/log"
+)
+
+// last used time is only written when older than this to avoid a write per request
+const touchInterval = time.Minute
+
+// the stored prefix is the key prefix and the first characters of the random part
+const prefixLength = len(domain.APIKeyPrefix) + 8
+
+const maxNameLength = 100
+
+// keys always expire, at most a year after their creation
+const (
+	minTTL = 24 * time.Hour
+	maxTTL = 365 * 24 * time.Hour
+)
+
+type service struct {
+	storage     domain.APIKeyStorage
+	userService domain.UserService
+	now         func() time.Time
+	log         log.Logger
+}
+
+func NewService(storage domain.APIKeyStorage, userService domain.UserService, log log.Logger) *service {
+	return &service{
+		storage:     storage,
+		userService: userService,
+		now:         time.Now,
+		log:         log,
+	}
+}
+
+// Create generates a key of the user granting the scopes until the ttl elapsed, only its hash is
+// stored
+func (s *service) Create(ctx context.Context, user *domain.User, name string, scopes []string, ttl time.Duration) (*domain.APIKey, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > maxNameLength {
+		return nil, "", errors.NewInvalidArgument(domain.ErrInvalidKeyName).WithMessage("the name is required and at most 100 characters")
+	}
+
+	if len(scopes) == 0 {
+		return nil, "", errors.NewInvalidArgument(domain.ErrInvalidScope).WithMessage("at least one scope is required")
+	}
+
+	granted := make([]string, 0, len(scopes))
+	seen := make(map[string]bool)
+	for _, scope := range scopes {
+		if !validScope(scope) {
+			return nil, "", errors.NewInvalidArgument(domain.ErrInvalidScope).WithMessage("unknown scope " + scope)
+		}
+
+		if !seen[scope] {
+			seen[scope] = true
+			granted = append(granted, scope)
+		}
+	}
+
+	if ttl < minTTL || ttl > maxTTL {
+		return nil, "", errors.NewInvalidArgument(domain.ErrInvalidExpiration).WithMessage("keys expire after a day to a year")
+	}
+
+	plaintext, err := generateKey()
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := s.now().UTC()
+	key := &domain.APIKey{
+		UserID:    user.ID,
+		Name:      name,
+		Prefix:    plaintext[:prefixLength],
+		KeyHash:   hashKey(plaintext),
+		Scopes:    strings.Join(granted, " "),
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+
+	if err := s.storage.Insert(ctx, key); err != nil {
+		return nil, "", err
+	}
+
+	s.log.Info().Sendf("user %d created api key %d", user.ID, key.ID)
+	return key, plaintext, nil
+}
+
+func (s *service) List(ctx context.Context, userID int) ([]*domain.APIKey, error) {
+	return s.storage.FindByUserID(ctx, userID)
+}
+
+func (s *service) Revoke(ctx context.Context, userID, ID int) error {
+	revoked, err := s.storage.Revoke(ctx, userID, ID, s.now().UTC())
+	if err != nil {
+		return err
+	}
+
+	if !revoked {
+		return errors.NewNotFound(domain.ErrAPIKeyNotFound).WithMessage("api key not found")
+	}
+
+	s.log.Info().Sendf("user %d revoked api key %d", userID, ID)
+	return nil
+}
+
+// Authenticate returns the key and its user when the key exists, is neither revoked nor expired and
+// the account is active
+func (s *service) Authenticate(ctx context.Context, plaintext string) (*domain.APIKey, *domain.User, error) {
+	notAuthorized := errors.NewNotAuthorized(domain.ErrInvalidAPIKey).WithMessage("invalid api key")
+
+	if !strings.HasPrefix(plaintext, domain.APIKeyPrefix) {
+		return nil, nil, notAuthorized
+	}
+
+	key, err := s.storage.FindByHash(ctx, hashKey(plaintext))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := s.now().UTC()
+	if key == nil || key.RevokedAt != nil || key.Expired(now) {
+		return nil, nil, notAuthorized
+	}
+
+	user, err := s.userService.FindByID(ctx, key.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if user == nil || !user.Active() {
+		return nil, nil, notAuthorized
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= touchInterval {
+		key.LastUsedAt = &now
+		if err := s.storage.Touch(ctx, key.ID, now); err != nil {
+			s.log.Warn().Err(err).Sendf("failed to update api key %d last used time", key.ID)
+		}
+	}
+
+	return key, user, nil
+}
+
+func validScope(scope string) bool {
+	for _, s := range domain.APIKeyScopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+func generateKey() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return domain.APIKeyPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,196 @@
+package apikey
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/pkg/errors"
+	"gitlab.com/evzpav/user-auth/pkg/log"
+)
+
+const month = 30 * 24 * time.Hour
+
+type fakeStorage struct {
+	keys []*domain.APIKey
+}
+
+func (f *fakeStorage) Insert(ctx context.Context, key *domain.APIKey) error {
+	key.ID = len(f.keys) + 1
+	stored := *key
+	f.keys = append(f.keys, &stored)
+	return nil
+}
+
+func (f *fakeStorage) FindByHash(ctx context.Context, hash string) (*domain.APIKey, error) {
+	for _, key := range f.keys {
+		if key.KeyHash == hash {
+			copied := *key
+			return &copied, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (f *fakeStorage) FindByUserID(ctx context.Context, userID int) ([]*domain.APIKey, error) {
+	var keys []*domain.APIKey
+	for _, key := range f.keys {
+		if key.UserID == userID {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys, nil
+}
+
+func (f *fakeStorage) Revoke(ctx context.Context, userID, ID int, revokedAt time.Time) (bool, error) {
+	for _, key := range f.keys {
+		if key.ID == ID && key.UserID == userID && key.RevokedAt == nil {
+			key.RevokedAt = &revokedAt
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (f *fakeStorage) Touch(ctx context.Context, ID int, lastUsedAt time.Time) error {
+	for _, key := range f.keys {
+		if key.ID == ID {
+			key.LastUsedAt = &lastUsedAt
+		}
+	}
+
+	return nil
+}
+
+type fakeUserService struct {
+	domain.UserService
+	users map[int]*domain.User
+}
+
+func (f *fakeUserService) FindByID(ctx context.Context, ID int) (*domain.User, error) {
+	return f.users[ID], nil
+}
+
+func newTestService() (*service, *fakeStorage, *fakeUserService) {
+	storage := &fakeStorage{}
+	users := &fakeUserService{users: map[int]*domain.User{
+		1: {ID: 1, Email: "user@example.com"},
+		2: {ID: 2, Email: "other@example.com"},
+	}}
+
+	s := NewService(storage, users, log.NewZeroLog("", "", log.Error))
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+	return s, storage, users
+}
+
+func requireCode(t *testing.T, err error, code errors.Code) {
+	t.Helper()
+
+	describer, ok := errors.DescriberCast(err)
+	require.True(t, ok, "expected a described error, got %v", err)
+	assert.Equal(t, code, describer.GetCode())
+}
+
+func TestService_CreateAndAuthenticate(t *testing.T) {
+	s, storage, users := newTestService()
+	ctx := context.Background()
+
+	key, plaintext, err := s.Create(ctx, users.users[1], " deploy script ", []string{
+		domain.APIKeyScopeProfileRead, domain.APIKeyScopeProfileRead,
+	}, month)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(plaintext, domain.APIKeyPrefix))
+	assert.Equal(t, 1, key.UserID)
+	assert.Equal(t, "deploy script", key.Name)
+	assert.Equal(t, plaintext[:prefixLength], key.Prefix)
+	assert.Equal(t, "profile:read", key.Scopes)
+	assert.Equal(t, s.now().Add(month), key.ExpiresAt)
+	assert.NotContains(t, storage.keys[0].KeyHash, plaintext, "only the hash is stored")
+
+	found, user, err := s.Authenticate(ctx, plaintext)
+	require.NoError(t, err)
+	assert.Equal(t, key.ID, found.ID)
+	assert.Equal(t, 1, user.ID)
+	assert.True(t, found.HasScope(domain.APIKeyScopeProfileRead))
+	assert.False(t, found.HasScope(domain.APIKeyScopeProfileWrite))
+	require.NotNil(t, storage.keys[0].LastUsedAt, "the use is recorded")
+	assert.Equal(t, s.now(), *storage.keys[0].LastUsedAt)
+
+	_, _, err = s.Authenticate(ctx, plaintext+"x")
+	requireCode(t, err, domain.ErrInvalidAPIKey)
+	_, _, err = s.Authenticate(ctx, "not-a-key")
+	requireCode(t, err, domain.ErrInvalidAPIKey)
+}
+
+func TestService_CreateValidates(t *testing.T) {
+	s, _, users := newTestService()
+	ctx := context.Background()
+	user := users.users[1]
+
+	_, _, err := s.Create(ctx, user, " ", []string{domain.APIKeyScopeProfileRead}, month)
+	requireCode(t, err, domain.ErrInvalidKeyName)
+
+	_, _, err = s.Create(ctx, user, "script", nil, month)
+	requireCode(t, err, domain.ErrInvalidScope)
+
+	_, _, err = s.Create(ctx, user, "script", []string{"admin"}, month)
+	requireCode(t, err, domain.ErrInvalidScope)
+
+	_, _, err = s.Create(ctx, user, "script", []string{domain.APIKeyScopeProfileRead}, 0)
+	requireCode(t, err, domain.ErrInvalidExpiration)
+
+	_, _, err = s.Create(ctx, user, "script", []string{domain.APIKeyScopeProfileRead}, 2*maxTTL)
+	requireCode(t, err, domain.ErrInvalidExpiration)
+	_, ok := errors.InvalidArgumentCast(err)
+	assert.True(t, ok)
+}
+
+func TestService_AuthenticateRejects(t *testing.T) {
+	s, _, users := newTestService()
+	ctx := context.Background()
+
+	_, expiring, err := s.Create(ctx, users.users[1], "expiring", []string{domain.APIKeyScopeProfileRead}, minTTL)
+	require.NoError(t, err)
+	_, other, err := s.Create(ctx, users.users[2], "other", []string{domain.APIKeyScopeProfileRead}, month)
+	require.NoError(t, err)
+
+	created := s.now()
+	s.now = func() time.Time { return created.Add(minTTL) }
+	_, _, err = s.Authenticate(ctx, expiring)
+	requireCode(t, err, domain.ErrInvalidAPIKey)
+
+	disabled := created
+	users.users[2].DisabledAt = &disabled
+	_, _, err = s.Authenticate(ctx, other)
+	requireCode(t, err, domain.ErrInvalidAPIKey)
+}
+
+func TestService_Revoke(t *testing.T) {
+	s, _, users := newTestService()
+	ctx := context.Background()
+
+	key, plaintext, err := s.Create(ctx, users.users[1], "script", []string{domain.APIKeyScopeProfileRead}, month)
+	require.NoError(t, err)
+
+	requireCode(t, s.Revoke(ctx, 2, key.ID), domain.ErrAPIKeyNotFound)
+
+	require.NoError(t, s.Revoke(ctx, 1, key.ID))
+	_, _, err = s.Authenticate(ctx, plaintext)
+	requireCode(t, err, domain.ErrInvalidAPIKey)
+
+	requireCode(t, s.Revoke(ctx, 1, key.ID), domain.ErrAPIKeyNotFound)
+
+	keys, err := s.List(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	assert.NotNil(t, keys[0].RevokedAt)
+}
@@ -0,0 +1,138 @@
+package domain
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// AuditEventType is the kind of security relevant event recorded in the audit log
+type AuditEventType string
+
+const (
+	AuditLoginSucceeded         AuditEventType = "login_succeeded"
+	AuditLoginFailed            AuditEventType = "login_failed"
+	AuditLogout                 AuditEventType = "logout"
+	AuditSignup                 AuditEventType = "signup"
+	AuditPasswordResetRequested AuditEventType = "password_reset_requested"
+	AuditPasswordResetCompleted AuditEventType = "password_reset_completed"
+	AuditProfileChanged         AuditEventType = "profile_changed"
+	AuditProviderLinked         AuditEventType = "provider_linked"
+)
+
+// AuditEventTypes lists every type of event
+var AuditEventTypes = []AuditEventType{
+	AuditLoginSucceeded,
+	AuditLoginFailed,
+	AuditLogout,
+	AuditSignup,
+	AuditPasswordResetRequested,
+	AuditPasswordResetCompleted,
+	AuditProfileChanged,
+	AuditProviderLinked,
+}
+
+func (t AuditEventType) Valid() bool {
+	for _, eventType := range AuditEventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AuditEvent is an entry of the audit log, events are only ever appended
+type AuditEvent struct {
+	ID   int            `json:"id"`
+	Type AuditEventType `json:"type"`
+	// ActorID is the user who acted, nil when nobody was signed in, e.g. on a failed login
+	ActorID *int `json:"actor_id"`
+	// AdminAPIKeyID is the admin API key that made the change, the admin API acts without a user
+	AdminAPIKeyID *int `json:"admin_api_key_id"`
+	// UserID is the account the event is about, nil when no account matches, e.g. a login with an
+	// unknown email
+	UserID    *int   `json:"user_id"`
+	IP        string `json:"ip"`
+	UserAgent string `json:"user_agent"`
+	// Changes is the JSON encoded AuditChanges of the event, empty when it changed no field
+	Changes   string    `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ChangeSet decodes the changed fields of the event
+func (e *AuditEvent) ChangeSet() (AuditChanges, error) {
+	changes := make(AuditChanges)
+	if e.Changes == "" {
+		return changes, nil
+	}
+
+	if err := json.Unmarshal([]byte(e.Changes), &changes); err != nil {
+		return nil, err
+	}
+
+	return changes, nil
+}
+
+// AuditChange is the value of a field before and after the event
+type AuditChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// AuditChanges are the changed fields of the user by their JSON name
+type AuditChanges map[string]AuditChange
+
+func (c AuditChanges) add(field string, from, to interface{}) {
+	if from != to {
+		c[field] = AuditChange{From: from, To: to}
+	}
+}
+
+// UserChanges returns the fields of the account that differ between before and after. The secrets
+// of the account are left out, a new password is told by the type of the event.
+func UserChanges(before, after *User) AuditChanges {
+	changes := make(AuditChanges)
+
+	changes.add("name", before.Name, after.Name)
+	changes.add("email", before.Email, after.Email)
+	changes.add("address", before.Address, after.Address)
+	changes.add("phone", before.Phone, after.Phone)
+	changes.add("email_verified", before.EmailVerified(), after.EmailVerified())
+	changes.add("mfa_enabled", before.TOTPEnabled, after.TOTPEnabled)
+	changes.add("disabled", before.Disabled(), after.Disabled())
+	changes.add("deleted", before.Deleted(), after.Deleted())
+
+	return changes
+}
+
+// AuditFilter selects the events to list, the zero value lists every event
+type AuditFilter struct {
+	UserID  *int
+	ActorID *int
+	Type    AuditEventType
+	IP      string
+	// After and Before bound the time of the events, After is inclusive
+	After  *time.Time
+	Before *time.Time
+
+	// Limit and Offset page the results ordered from the newest, they are ignored by Count
+	Limit  int
+	Offset int
+}
+
+type AuditService interface {
+	// Record appends the event with its changed fields, the time of the event is set by the service
+	Record(ctx context.Context, event *AuditEvent, changes AuditChanges) error
+	// List returns a page of the events of the filter, newest first, and the number of events of the
+	// filter
+	List(ctx context.Context, filter *AuditFilter) ([]*AuditEvent, int, error)
+}
+
+// AuditStorage appends and lists the events, it has no way to change nor delete them
+type AuditStorage interface {
+	Insert(ctx context.Context, event *AuditEvent) error
+	// List returns the events of the filter ordered from the newest
+	List(ctx context.Context, filter *AuditFilter) ([]*AuditEvent, error)
+	Count(ctx context.Context, filter *AuditFilter) (int, error)
+}
@@ -0,0 +1,70 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/pkg/errors"
+	"gitlab.com/evzpav/user-auth/pkg/log"
+)
+
+// the user agent is sent by the client, it is cut so a client cannot grow the log at will
+const maxUserAgentLength = 512
+
+type service struct {
+	storage domain.AuditStorage
+	now     func() time.Time
+	log     log.Logger
+}
+
+func NewService(storage domain.AuditStorage, log log.Logger) *service {
+	return &service{
+		storage: storage,
+		now:     time.Now,
+		log:     log,
+	}
+}
+
+// Record appends the event to the log with the JSON of the changed fields
+func (s *service) Record(ctx context.Context, event *domain.AuditEvent, changes domain.AuditChanges) error {
+	if !event.Type.Valid() {
+		return errors.NewInvalidArgument(domain.ErrInvalidAuditType).WithMessage("unknown audit event type " + string(event.Type))
+	}
+
+	if len(changes) > 0 {
+		bs, err := json.Marshal(changes)
+		if err != nil {
+			return err
+		}
+		event.Changes = string(bs)
+	}
+
+	if len(event.UserAgent) > maxUserAgentLength {
+		event.UserAgent = strings.ToValidUTF8(event.UserAgent[:maxUserAgentLength], "")
+	}
+
+	event.CreatedAt = s.now()
+
+	return s.storage.Insert(ctx, event)
+}
+
+func (s *service) List(ctx context.Context, filter *domain.AuditFilter) ([]*domain.AuditEvent, int, error) {
+	if filter.Type != "" && !filter.Type.Valid() {
+		return nil, 0, errors.NewInvalidArgument(domain.ErrInvalidAuditType).WithMessage("unknown audit event type " + string(filter.Type))
+	}
+
+	events, err := s.storage.List(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	total, err := s.storage.Count(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return events, total, nil
+}
@@ -0,0 +1,125 @@
+package audit
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/pkg/errors"
+	"gitlab.com/evzpav/user-auth/pkg/log"
+)
+
+type fakeStorage struct {
+	events []*domain.AuditEvent
+}
+
+func (f *fakeStorage) Insert(ctx context.Context, event *domain.AuditEvent) error {
+	event.ID = len(f.events) + 1
+	f.events = append(f.events, event)
+	return nil
+}
+
+func (f *fakeStorage) List(ctx context.Context, filter *domain.AuditFilter) ([]*domain.AuditEvent, error) {
+	var events []*domain.AuditEvent
+	for i := len(f.events) - 1; i >= 0; i-- {
+		if filter.Type == "" || f.events[i].Type == filter.Type {
+			events = append(events, f.events[i])
+		}
+	}
+
+	return events, nil
+}
+
+func (f *fakeStorage) Count(ctx context.Context, filter *domain.AuditFilter) (int, error) {
+	events, err := f.List(ctx, filter)
+	return len(events), err
+}
+
+func newTestService() (*service, *fakeStorage) {
+	storage := &fakeStorage{}
+	s := NewService(storage, log.NewZeroLog("", "", log.Error))
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+	return s, storage
+}
+
+func requireCode(t *testing.T, err error, code errors.Code) {
+	t.Helper()
+
+	describer, ok := errors.DescriberCast(err)
+	require.True(t, ok, "expected a described error, got %v", err)
+	assert.Equal(t, code, describer.GetCode())
+}
+
+func TestService_Record(t *testing.T) {
+	s, storage := newTestService()
+	ctx := context.Background()
+
+	userID := 7
+	before := &domain.User{ID: userID, Email: "old@example.com", Name: "Ann", Password: "hash"}
+	after := *before
+	after.Email = "new@example.com"
+	after.Password = "new-hash"
+
+	event := &domain.AuditEvent{Type: domain.AuditProfileChanged, ActorID: &userID, UserID: &userID, IP: "203.0.113.7", UserAgent: strings.Repeat("a", 600)}
+	require.NoError(t, s.Record(ctx, event, domain.UserChanges(before, &after)))
+
+	require.Len(t, storage.events, 1)
+	stored := storage.events[0]
+	assert.Equal(t, s.now(), stored.CreatedAt)
+	assert.Len(t, stored.UserAgent, maxUserAgentLength)
+	assert.JSONEq(t, `{"email": {"from": "old@example.com", "to": "new@example.com"}}`, stored.Changes, "the password is left out")
+
+	changes, err := stored.ChangeSet()
+	require.NoError(t, err)
+	assert.Equal(t, domain.AuditChange{From: "old@example.com", To: "new@example.com"}, changes["email"])
+
+	logout := &domain.AuditEvent{Type: domain.AuditLogout, UserID: &userID}
+	require.NoError(t, s.Record(ctx, logout, nil))
+	assert.Empty(t, logout.Changes)
+
+	changes, err = logout.ChangeSet()
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+
+	requireCode(t, s.Record(ctx, &domain.AuditEvent{Type: "password_stolen"}, nil), domain.ErrInvalidAuditType)
+	assert.Len(t, storage.events, 2)
+}
+
+func TestService_List(t *testing.T) {
+	s, _ := newTestService()
+	ctx := context.Background()
+
+	for _, eventType := range []domain.AuditEventType{domain.AuditSignup, domain.AuditLoginFailed, domain.AuditLoginSucceeded, domain.AuditLoginFailed} {
+		require.NoError(t, s.Record(ctx, &domain.AuditEvent{Type: eventType}, nil))
+	}
+
+	events, total, err := s.List(ctx, &domain.AuditFilter{Type: domain.AuditLoginFailed})
+	require.NoError(t, err)
+	assert.Equal(t, 2, total)
+	require.Len(t, events, 2)
+	assert.Equal(t, 4, events[0].ID, "the newest event comes first")
+
+	_, _, err = s.List(ctx, &domain.AuditFilter{Type: "unknown"})
+	requireCode(t, err, domain.ErrInvalidAuditType)
+}
+
+func TestUserChanges(t *testing.T) {
+	verifiedAt := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	before := &domain.User{Name: "Ann", Phone: "123", EmailVerifiedAt: &verifiedAt}
+	after := &domain.User{Name: "Ann", Phone: "456", TOTPEnabled: true, DisabledAt: &verifiedAt}
+
+	assert.Equal(t, domain.AuditChanges{
+		"phone":          {From: "123", To: "456"},
+		"email_verified": {From: true, To: false},
+		"mfa_enabled":    {From: false, To: true},
+		"disabled":       {From: false, To: true},
+	}, domain.UserChanges(before, after))
+
+	assert.Empty(t, domain.UserChanges(before, before))
+}
@@ -8,10 +8,8 @@ import (
 type AuthUser struct {
 	Email         string `json:"email"`
 	Password      string `json:"password"`
-	Token         string `json:"token"`
 	RecoveryToken string `json:"recovery_token"`
 	Name          string `json:"name"`
-	GoogleID      string `json:"google_id"`
 	Errors        map[string]string
 }
 
@@ -48,18 +46,69 @@ func (au *AuthUser) Validate() bool {
 	return len(au.Errors) == 0
 }
 
+// EmailVerificationPolicy tells what users can do before verifying their email
+type EmailVerificationPolicy string
+
+const (
+	// EmailVerificationOptional sends the verification link without restricting the account
+	EmailVerificationOptional EmailVerificationPolicy = "optional"
+	// EmailVerificationRestrictProfile lets users sign in but not edit their profile
+	EmailVerificationRestrictProfile EmailVerificationPolicy = "restrict_profile"
+	// EmailVerificationBlockLogin does not start sessions for unverified users
+	EmailVerificationBlockLogin EmailVerificationPolicy = "block_login"
+)
+
+func (p EmailVerificationPolicy) Valid() bool {
+	switch p {
+	case EmailVerificationOptional, EmailVerificationRestrictProfile, EmailVerificationBlockLogin:
+		return true
+	}
+
+	return false
+}
+
+func (p EmailVerificationPolicy) AllowsLogin(user *User) bool {
+	return p != EmailVerificationBlockLogin || user.EmailVerified()
+}
+
+// AllowsProfileEdit is also false when logins are blocked, sessions started before the policy
+// was enabled must not change the account either
+func (p EmailVerificationPolicy) AllowsProfileEdit(user *User) bool {
+	return p == EmailVerificationOptional || user.EmailVerified()
+}
+
+// ProviderLogin is the user signed in with a login provider
+type ProviderLogin struct {
+	User *User
+	// SignedUp is set when the login created the user
+	SignedUp bool
+	// Linked is the account of the provider the login linked to the user, nil when it was linked
+	// before
+	Linked *UserIdentity
+}
+
 type AuthService interface {
-	Signup(ctx context.Context, authUser *AuthUser) error
+	Signup(ctx context.Context, authUser *AuthUser) (*User, error)
 	Authenticate(ctx context.Context, authUser *AuthUser) (*User, error)
-	AuthenticateToken(ctx context.Context, token string) (*User, error)
 	SetNewPassword(ctx context.Context, user *User, password string) error
 	SetUserRecoveryToken(ctx context.Context, email string) (string, error)
+	ResetPassword(ctx context.Context, token, password string) (*User, error)
 	SendResetPasswordLink(ctx context.Context, authUser *AuthUser)
 	GenerateToken() string
-	SetToken(ctx context.Context, user *User) (*User, error)
 
-	//Google
-	GetGoogleSigninLink(state string) string
-	GetGoogleProfile(code string) (*GoogleUser, error)
-	SignupWithGoogle(ctx context.Context, authUser *AuthUser) (*User, error)
+	// Email verification
+	EmailVerificationPolicy() EmailVerificationPolicy
+	SendVerificationEmail(ctx context.Context, user *User) error
+	VerifyEmail(ctx context.Context, token string) (*User, error)
+
+	// Login providers
+	LoginProviders() []LoginProvider
+	LoginProviderURL(ctx context.Context, provider, state, nonce, codeVerifier string) (string, error)
+	LoginWithProvider(ctx context.Context, provider, code, nonce, codeVerifier string) (*ProviderLogin, error)
+
+	// Linked identities
+	Identities(ctx context.Context, userID int) ([]*UserIdentity, error)
+	LinkProvider(ctx context.Context, user *User, provider, code, nonce, codeVerifier string) (*UserIdentity, error)
+	ReauthenticateWithProvider(ctx context.Context, user *User, provider, code, nonce, codeVerifier string) error
+	UnlinkIdentity(ctx context.Context, user *User, ID int) error
 }
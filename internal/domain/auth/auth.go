@@ -2,9 +2,13 @@ package auth
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
-
-	"net/smtp"
+	"strings"
+	"time"
 
 	uuid "github.com/satori/go.uuid"
 	"gitlab.com/evzpav/user-auth/internal/domain"
@@ -13,34 +17,43 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+// time a password recovery link can be used
+const resetTokenTTL = time.Hour
+
 type service struct {
-	userService     domain.UserService
-	emailFrom       string
-	emailPassword   string
-	googleSigninCli domain.GoogleSigner
-	platformURL     string
-	log             log.Logger
+	userService    domain.UserService
+	identities     domain.UserIdentityStorage
+	resetTokens    domain.PasswordResetTokenStorage
+	sessionService domain.SessionService
+	tokenService   domain.TokenService
+	mailer         domain.Mailer
+	emailRenderer  domain.EmailRenderer
+	providers      []domain.LoginProvider
+	platformURL    string
+	verification   EmailVerificationConfig
+	now            func() time.Time
+	log            log.Logger
 }
 
-func NewService(userService domain.UserService, emailFrom, emailPassword string, googleSigninCli domain.GoogleSigner, platformURL string, log log.Logger) *service {
+// NewService creates the auth service. tokenService is optional, when set the refresh tokens are
+// revoked with the sessions. providers are listed on the login page in the given order.
+func NewService(userService domain.UserService, identities domain.UserIdentityStorage, resetTokens domain.PasswordResetTokenStorage, sessionService domain.SessionService, tokenService domain.TokenService, mailer domain.Mailer, emailRenderer domain.EmailRenderer, providers []domain.LoginProvider, platformURL string, verification EmailVerificationConfig, log log.Logger) *service {
 	return &service{
-		userService:     userService,
-		emailFrom:       emailFrom,
-		emailPassword:   emailPassword,
-		googleSigninCli: googleSigninCli,
-		platformURL:     platformURL,
-		log:             log,
+		userService:    userService,
+		identities:     identities,
+		resetTokens:    resetTokens,
+		sessionService: sessionService,
+		tokenService:   tokenService,
+		mailer:         mailer,
+		emailRenderer:  emailRenderer,
+		providers:      providers,
+		platformURL:    platformURL,
+		verification:   verification.withDefaults(log),
+		now:            time.Now,
+		log:            log,
 	}
 }
 
-func (s *service) GetGoogleSigninLink(state string) string {
-	return s.googleSigninCli.GetLoginURL(state)
-}
-
-func (s *service) GetGoogleProfile(code string) (*domain.GoogleUser, error) {
-	return s.googleSigninCli.GetProfile(code)
-}
-
 func (s *service) hashPassword(password string) (string, error) {
 	hashedPW, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
@@ -65,7 +78,8 @@ func (s *service) Authenticate(ctx context.Context, authUser *domain.AuthUser) (
 		return nil, errors.NewNotAuthorized(domain.ErrInvalidCredentials)
 	}
 
-	if user == nil {
+	// deleted accounts are kept to be restored, until then they sign in like missing ones
+	if user == nil || user.Deleted() {
 		authUser.Errors["Credentials"] = "invalid credentials"
 		return nil, errors.NewNotAuthorized(domain.ErrInvalidCredentials)
 	}
@@ -75,161 +89,198 @@ func (s *service) Authenticate(ctx context.Context, authUser *domain.AuthUser) (
 		return nil, errors.NewNotAuthorized(domain.ErrInvalidCredentials)
 	}
 
-	return s.SetToken(ctx, user)
-}
-
-func (s *service) SetToken(ctx context.Context, user *domain.User) (*domain.User, error) {
-	token := s.GenerateToken()
-	user.Token = token
-
-	if err := s.userService.Update(ctx, user); err != nil {
-		return nil, err
+	// checked after the password so the state of an account is not revealed to anyone guessing
+	if user.Disabled() {
+		authUser.Errors["Credentials"] = "this account is disabled"
+		return nil, accountDisabled()
 	}
 
 	return user, nil
 }
 
-func (s *service) Signup(ctx context.Context, authUser *domain.AuthUser) error {
+func (s *service) Signup(ctx context.Context, authUser *domain.AuthUser) (*domain.User, error) {
 	existingUser, err := s.userService.FindByEmail(ctx, authUser.Email)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if existingUser != nil {
 		authUser.Errors["Credentials"] = "email already being used"
-		return fmt.Errorf("email already being used")
+		return nil, errors.NewDuplicatedRecord(domain.ErrEmailAlreadyUsed).WithMessage("email already being used")
 	}
 
 	hashedPassword, err := s.hashPassword(authUser.Password)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	user := &domain.User{
 		Email:    authUser.Email,
 		Password: hashedPassword,
-		Token:    authUser.Token,
 	}
 
-	return s.userService.Create(ctx, user)
+	if err := s.userService.Create(ctx, user); err != nil {
+		return nil, err
+	}
+
+	return user, nil
 }
 
+func (s *service) generateResetPasswordLink(token string) string {
+	return fmt.Sprintf("%s/password/new?token=%s", s.platformURL, token)
+}
 
-func (s *service) SignupWithGoogle(ctx context.Context, authUser *domain.AuthUser) (*domain.User, error) {
-	existingUser, err := s.userService.FindByEmail(ctx, authUser.Email)
+// sendEmail renders the email template with data and sends it to the address
+func (s *service) sendEmail(ctx context.Context, to, templateName string, data interface{}) error {
+	email, err := s.emailRenderer.RenderEmail(templateName, data)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	if existingUser != nil {
-		return existingUser, nil
-	}
+	email.To = to
 
-	hashedPassword, err := s.hashPassword(authUser.Password)
+	s.log.Debug().Sendf("Sending email %s to %s", templateName, to)
+
+	return s.mailer.Send(ctx, email)
+}
+
+// SetNewPassword changes the password and signs the user out of every device, including the
+// refresh tokens of API clients, so whoever knew the old password loses access
+func (s *service) SetNewPassword(ctx context.Context, user *domain.User, password string) error {
+	hashedPassword, err := s.hashPassword(password)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	user := &domain.User{
-		Email:    authUser.Email,
-		Password: hashedPassword,
-	}
+	user.Password = hashedPassword
 
-	if authUser.Token != "" {
-		user.Token = authUser.Token
+	if err := s.userService.Update(ctx, user); err != nil {
+		return err
 	}
 
-	if authUser.Name != "" {
-		user.Name = authUser.Name
+	if err := s.resetTokens.DeleteByUserID(ctx, user.ID); err != nil {
+		return err
 	}
 
-	if authUser.GoogleID != "" {
-		user.GoogleID = authUser.GoogleID
+	if err := s.sessionService.RevokeAll(ctx, user.ID); err != nil {
+		return err
 	}
 
-	if err = s.userService.Create(ctx, user); err != nil {
-		return nil, err
+	if s.tokenService != nil {
+		return s.tokenService.RevokeAll(ctx, user.ID)
 	}
 
-	return user, nil
+	return nil
 }
 
-func (s *service) AuthenticateToken(ctx context.Context, token string) (*domain.User, error) {
-	user, err := s.userService.FindByToken(ctx, token)
+// SetUserRecoveryToken creates the token of a password recovery link. Only its hash is stored and
+// the previous tokens of the user are deleted so only the last link sent works.
+func (s *service) SetUserRecoveryToken(ctx context.Context, email string) (string, error) {
+	user, err := s.userService.FindByEmail(ctx, email)
 	if err != nil {
-		return nil, errors.NewNotAuthorized(domain.ErrInvalidCredentials)
+		return "", err
 	}
+
 	if user == nil {
-		return nil, errors.NewNotAuthorized(domain.ErrInvalidCredentials)
+		return "", fmt.Errorf("invalid user")
 	}
 
-	// user.Token = s.GenerateToken()
-
-	return user, s.userService.Update(ctx, user)
-}
+	if err := s.resetTokens.DeleteByUserID(ctx, user.ID); err != nil {
+		return "", err
+	}
 
-func (s *service) generateResetPasswordLink(token string) string {
-	return fmt.Sprintf("%s/password/new?token=%s", s.platformURL, token)
-}
+	token, err := generateResetToken()
+	if err != nil {
+		return "", err
+	}
 
-func (s *service) sendEmail(ctx context.Context, message []byte, toEmail string) error {
-	smtpHost := "smtp.gmail.com"
-	smtpPort := "587"
+	now := s.now()
+	resetToken := &domain.PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: hashResetToken(token),
+		CreatedAt: now,
+		ExpiresAt: now.Add(resetTokenTTL),
+	}
 
-	auth := smtp.PlainAuth("", s.emailFrom, s.emailPassword, smtpHost)
+	if err := s.resetTokens.Insert(ctx, resetToken); err != nil {
+		return "", err
+	}
 
-	to := []string{toEmail}
+	return token, nil
+}
 
-	s.log.Debug().Sendf("Sending email with message: %s", message)
+// ResetPassword consumes the token of a recovery link and sets the new password of its user
+func (s *service) ResetPassword(ctx context.Context, token, password string) (*domain.User, error) {
+	invalidLink := errors.NewInvalidArgument(domain.ErrInvalidLink).WithMessage("invalid or expired link")
 
-	return smtp.SendMail(smtpHost+":"+smtpPort, auth, s.emailFrom, to, message)
-}
+	if strings.TrimSpace(token) == "" {
+		return nil, invalidLink
+	}
 
-func (s *service) SetNewPassword(ctx context.Context, user *domain.User, password string) error {
-	hashedPassword, err := s.hashPassword(password)
+	resetToken, err := s.resetTokens.FindByHash(ctx, hashResetToken(token))
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	user.Password = hashedPassword
-	user.RecoveryToken = ""
-
-	return s.userService.Update(ctx, user)
+	now := s.now()
+	if resetToken == nil || resetToken.UsedAt != nil || !now.Before(resetToken.ExpiresAt) {
+		return nil, invalidLink
+	}
 
-}
+	// two requests with the same link race here, only one marks it as used
+	used, err := s.resetTokens.MarkUsed(ctx, resetToken.ID, now)
+	if err != nil {
+		return nil, err
+	}
 
-func (s *service) SetUserRecoveryToken(ctx context.Context, email string) (string, error) {
+	if !used {
+		return nil, invalidLink
+	}
 
-	user, err := s.userService.FindByEmail(ctx, email)
+	user, err := s.userService.FindByID(ctx, resetToken.UserID)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	if user == nil {
-		return "", fmt.Errorf("invalid user")
+		return nil, invalidLink
 	}
 
-	user.RecoveryToken = s.GenerateToken()
+	if err := s.SetNewPassword(ctx, user, password); err != nil {
+		return nil, err
+	}
 
-	if err := s.userService.Update(ctx, user); err != nil {
+	return user, nil
+}
+
+func generateResetToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
 		return "", err
 	}
 
-	return user.RecoveryToken, nil
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
 
+func hashResetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
 
 func (s *service) SendResetPasswordLink(ctx context.Context, authUser *domain.AuthUser) {
-	link := s.generateResetPasswordLink(authUser.RecoveryToken)
-
-	msg := []byte("To: " + authUser.Email + "\r\n" +
-		"Subject: Recover password - user-auth\r\n" +
-		"\r\n" +
-		"Reset password link. Copy it and paste it in the browser: \n" + link + "\r\n")
+	data := struct {
+		Link string
+	}{
+		Link: s.generateResetPasswordLink(authUser.RecoveryToken),
+	}
 
-	if err := s.sendEmail(ctx, msg, authUser.Email); err != nil {
+	if err := s.sendEmail(ctx, authUser.Email, "reset_password", data); err != nil {
 		s.log.Error().Err(err).Sendf("failed to send email")
 		return
 	}
 	s.log.Info().Sendf("sent reset password link to %s", authUser.Email)
 }
+
+func accountDisabled() error {
+	return errors.NewRuleNotSatisfied(domain.ErrAccountDisabled).WithMessage("account disabled")
+}
@@ -0,0 +1,194 @@
+package auth
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/pkg/errors"
+	"gitlab.com/evzpav/user-auth/pkg/log"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type fakeUserService struct {
+	domain.UserService
+	users map[int]*domain.User
+}
+
+func (f *fakeUserService) FindByID(ctx context.Context, ID int) (*domain.User, error) {
+	return f.users[ID], nil
+}
+
+func (f *fakeUserService) FindByEmail(ctx context.Context, email string) (*domain.User, error) {
+	for _, user := range f.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (f *fakeUserService) Update(ctx context.Context, user *domain.User) error {
+	f.users[user.ID] = user
+	return nil
+}
+
+type fakeMailer struct {
+	emails []*domain.Email
+}
+
+func (f *fakeMailer) Send(ctx context.Context, email *domain.Email) error {
+	f.emails = append(f.emails, email)
+	return nil
+}
+
+// fakeRenderer puts the link of the template data in the text body
+type fakeRenderer struct{}
+
+func (fakeRenderer) RenderEmail(name string, data interface{}) (*domain.Email, error) {
+	link := reflect.ValueOf(data).FieldByName("Link").String()
+	return &domain.Email{Subject: name, Text: link}, nil
+}
+
+type fakeResetTokens struct {
+	tokens []*domain.PasswordResetToken
+}
+
+func (f *fakeResetTokens) Insert(ctx context.Context, token *domain.PasswordResetToken) error {
+	token.ID = len(f.tokens) + 1
+	f.tokens = append(f.tokens, token)
+	return nil
+}
+
+func (f *fakeResetTokens) FindByHash(ctx context.Context, hash string) (*domain.PasswordResetToken, error) {
+	for _, token := range f.tokens {
+		if token != nil && token.TokenHash == hash {
+			c := *token
+			return &c, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (f *fakeResetTokens) MarkUsed(ctx context.Context, ID int, usedAt time.Time) (bool, error) {
+	token := f.tokens[ID-1]
+	if token == nil || token.UsedAt != nil {
+		return false, nil
+	}
+
+	token.UsedAt = &usedAt
+	return true, nil
+}
+
+func (f *fakeResetTokens) DeleteByUserID(ctx context.Context, userID int) error {
+	for i, token := range f.tokens {
+		if token != nil && token.UserID == userID {
+			f.tokens[i] = nil
+		}
+	}
+
+	return nil
+}
+
+type fakeSessionService struct {
+	domain.SessionService
+	revoked []int
+}
+
+func (f *fakeSessionService) RevokeAll(ctx context.Context, userID int) error {
+	f.revoked = append(f.revoked, userID)
+	return nil
+}
+
+func newTestService(users map[int]*domain.User) *service {
+	config := EmailVerificationConfig{Key: []byte("secret"), TTL: time.Hour}
+	return NewService(&fakeUserService{users: users}, &fakeIdentities{}, &fakeResetTokens{}, &fakeSessionService{}, nil, &fakeMailer{}, fakeRenderer{}, nil, "http://localhost", config, log.NewZeroLog("", "", log.Error))
+}
+
+func assertInvalidLink(t *testing.T, err error) {
+	describer, ok := errors.InvalidArgumentCast(err)
+	require.True(t, ok, "expected invalid argument, got %v", err)
+	assert.Equal(t, domain.ErrInvalidLink, describer.GetCode())
+}
+
+func TestService_ResetPassword(t *testing.T) {
+	user := &domain.User{ID: 1, Email: "user@example.com"}
+	s := newTestService(map[int]*domain.User{1: user})
+	ctx := context.Background()
+
+	token, err := s.SetUserRecoveryToken(ctx, "user@example.com")
+	require.NoError(t, err)
+
+	stored := s.resetTokens.(*fakeResetTokens).tokens[0]
+	assert.NotEqual(t, token, stored.TokenHash)
+	assert.Equal(t, hashResetToken(token), stored.TokenHash)
+
+	reset, err := s.ResetPassword(ctx, token, "new-password")
+	require.NoError(t, err)
+	assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(reset.Password), []byte("new-password")))
+	assert.Equal(t, []int{1}, s.sessionService.(*fakeSessionService).revoked)
+
+	// a link is used once
+	_, err = s.ResetPassword(ctx, token, "other-password")
+	assertInvalidLink(t, err)
+}
+
+func TestService_ResetPasswordRejected(t *testing.T) {
+	user := &domain.User{ID: 1, Email: "user@example.com"}
+	s := newTestService(map[int]*domain.User{1: user})
+	ctx := context.Background()
+	now := time.Now()
+	s.now = func() time.Time { return now }
+
+	first, err := s.SetUserRecoveryToken(ctx, "user@example.com")
+	require.NoError(t, err)
+
+	// a new link invalidates the previous ones
+	token, err := s.SetUserRecoveryToken(ctx, "user@example.com")
+	require.NoError(t, err)
+
+	_, err = s.ResetPassword(ctx, first, "new-password")
+	assertInvalidLink(t, err)
+
+	_, err = s.ResetPassword(ctx, "", "new-password")
+	assertInvalidLink(t, err)
+
+	_, err = s.ResetPassword(ctx, "unknown", "new-password")
+	assertInvalidLink(t, err)
+
+	s.now = func() time.Time { return now.Add(resetTokenTTL) }
+	_, err = s.ResetPassword(ctx, token, "new-password")
+	assertInvalidLink(t, err)
+
+	assert.Empty(t, user.Password)
+	assert.Empty(t, s.sessionService.(*fakeSessionService).revoked)
+
+	_, err = s.SetUserRecoveryToken(ctx, "unknown@example.com")
+	assert.Error(t, err)
+}
+
+func TestService_AuthenticateDisabledUser(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret-password"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	disabledAt := time.Now()
+	s := newTestService(map[int]*domain.User{1: {ID: 1, Email: "user@example.com", Password: string(hash), DisabledAt: &disabledAt}})
+
+	authUser := domain.NewAuthUser("user@example.com", "wrong-password")
+	_, err = s.Authenticate(context.Background(), authUser)
+	_, ok := errors.NotAuthorizedCast(err)
+	assert.True(t, ok, "a wrong password does not reveal the account is disabled")
+
+	authUser = domain.NewAuthUser("user@example.com", "secret-password")
+	_, err = s.Authenticate(context.Background(), authUser)
+	describer, ok := errors.RuleNotSatisfiedCast(err)
+	require.True(t, ok, "expected rule not satisfied, got %v", err)
+	assert.Equal(t, domain.ErrAccountDisabled, describer.GetCode())
+	assert.Equal(t, "this account is disabled", authUser.Errors["Credentials"])
+}
@@ -0,0 +1,286 @@
+package auth
+
+import (
+	"context"
+	"strings"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/pkg/errors"
+)
+
+func (s *service) LoginProviders() []domain.LoginProvider {
+	return s.providers
+}
+
+func (s *service) loginProvider(name string) (domain.LoginProvider, error) {
+	for _, provider := range s.providers {
+		if provider.Name() == name {
+			return provider, nil
+		}
+	}
+
+	return nil, errors.NewNotFound(domain.ErrProviderNotFound).WithMessage("login provider not found")
+}
+
+func (s *service) LoginProviderURL(ctx context.Context, provider, state, nonce, codeVerifier string) (string, error) {
+	loginProvider, err := s.loginProvider(provider)
+	if err != nil {
+		return "", err
+	}
+
+	return loginProvider.AuthURL(ctx, state, nonce, codeVerifier)
+}
+
+// exchange returns the account the provider redirected back with
+func (s *service) exchange(ctx context.Context, provider, code, nonce, codeVerifier string) (*domain.ExternalUser, error) {
+	loginProvider, err := s.loginProvider(provider)
+	if err != nil {
+		return nil, err
+	}
+
+	externalUser, err := loginProvider.Exchange(ctx, code, nonce, codeVerifier)
+	if err != nil {
+		s.log.Info().Err(err).Sendf("failed to sign in with %s", provider)
+		return nil, errors.NewNotAuthorized(domain.ErrProviderLogin).WithMessage("failed to sign in with the provider")
+	}
+
+	if externalUser.Subject == "" {
+		return nil, errors.NewInvalidArgument(domain.ErrProviderAccount).WithMessage("the provider did not identify the account")
+	}
+
+	return externalUser, nil
+}
+
+// LoginWithProvider exchanges the code the provider redirected back with and returns the user
+// linked to the account. Accounts that are not linked yet sign up a user without a password, or
+// are linked to the user of the same email when both the provider and the user verified it. A
+// user whose email is not verified has to sign in and link the account from the profile, otherwise
+// whoever registers the address at a provider would take the account over. The login tells whether
+// it signed up or linked the user.
+func (s *service) LoginWithProvider(ctx context.Context, provider, code, nonce, codeVerifier string) (*domain.ProviderLogin, error) {
+	externalUser, err := s.exchange(ctx, provider, code, nonce, codeVerifier)
+	if err != nil {
+		return nil, err
+	}
+
+	identity, err := s.identities.FindBySubject(ctx, provider, externalUser.Subject)
+	if err != nil {
+		return nil, err
+	}
+
+	if identity != nil {
+		user, err := s.linkedUser(ctx, identity, externalUser)
+		if err != nil {
+			return nil, err
+		}
+
+		return &domain.ProviderLogin{User: user}, nil
+	}
+
+	if externalUser.Email == "" || !externalUser.EmailVerified {
+		return nil, errors.NewInvalidArgument(domain.ErrProviderAccount).WithMessage("the email of the account is not verified")
+	}
+
+	user, err := s.userService.FindByEmail(ctx, externalUser.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	if user == nil {
+		return s.signupExternalUser(ctx, provider, externalUser)
+	}
+
+	if !user.EmailVerified() {
+		return nil, errors.NewRuleNotSatisfied(domain.ErrAccountNotLinked).WithMessage("a user with this email already exists, sign in and link the account from your profile")
+	}
+
+	identity, err = s.linkIdentity(ctx, user, provider, externalUser)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.updateExternalUser(ctx, user, externalUser); err != nil {
+		return nil, err
+	}
+
+	return &domain.ProviderLogin{User: user, Linked: identity}, nil
+}
+
+// linkedUser returns the user of the identity, a linked account signs in whatever its email is
+func (s *service) linkedUser(ctx context.Context, identity *domain.UserIdentity, externalUser *domain.ExternalUser) (*domain.User, error) {
+	user, err := s.userService.FindByID(ctx, identity.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	if user == nil {
+		s.log.Error().Sendf("user %d of the identity %d not found", identity.UserID, identity.ID)
+		return nil, errors.NewNotAuthorized(domain.ErrProviderLogin).WithMessage("failed to sign in with the provider")
+	}
+
+	if err := s.updateExternalUser(ctx, user, externalUser); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// updateExternalUser verifies the email of the user when the provider verified the same address
+// and fills in the name when the user has none
+func (s *service) updateExternalUser(ctx context.Context, user *domain.User, externalUser *domain.ExternalUser) error {
+	changed := false
+
+	if !user.EmailVerified() && externalUser.EmailVerified && strings.EqualFold(user.Email, externalUser.Email) {
+		verifiedAt := s.now()
+		user.EmailVerifiedAt = &verifiedAt
+		changed = true
+	}
+
+	if user.Name == "" && externalUser.Name != "" {
+		user.Name = externalUser.Name
+		changed = true
+	}
+
+	if !changed {
+		return nil
+	}
+
+	return s.userService.Update(ctx, user)
+}
+
+// signupExternalUser creates the user without a password, it signs in with the provider until a
+// password is set with a recovery link
+func (s *service) signupExternalUser(ctx context.Context, provider string, externalUser *domain.ExternalUser) (*domain.ProviderLogin, error) {
+	verifiedAt := s.now()
+	user := &domain.User{
+		Email:           externalUser.Email,
+		Name:            externalUser.Name,
+		EmailVerifiedAt: &verifiedAt,
+	}
+
+	if err := s.userService.Create(ctx, user); err != nil {
+		return nil, err
+	}
+
+	identity, err := s.linkIdentity(ctx, user, provider, externalUser)
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.ProviderLogin{User: user, SignedUp: true, Linked: identity}, nil
+}
+
+func (s *service) linkIdentity(ctx context.Context, user *domain.User, provider string, externalUser *domain.ExternalUser) (*domain.UserIdentity, error) {
+	identity := &domain.UserIdentity{
+		UserID:   user.ID,
+		Provider: provider,
+		Subject:  externalUser.Subject,
+		Email:    externalUser.Email,
+		LinkedAt: s.now(),
+	}
+
+	if err := s.identities.Insert(ctx, identity); err != nil {
+		if _, ok := errors.DuplicatedRecordCast(err); ok {
+			return nil, errors.NewDuplicatedRecord(domain.ErrIdentityLinked).WithMessage("the account is linked to another user")
+		}
+
+		return nil, err
+	}
+
+	return identity, nil
+}
+
+func (s *service) Identities(ctx context.Context, userID int) ([]*domain.UserIdentity, error) {
+	return s.identities.FindByUserID(ctx, userID)
+}
+
+// LinkProvider links the account the provider redirected back with to the user, who has to be
+// reauthenticated before. The email of the account does not need to match nor be verified since
+// the user proved to own both. A user links one account of each provider.
+func (s *service) LinkProvider(ctx context.Context, user *domain.User, provider, code, nonce, codeVerifier string) (*domain.UserIdentity, error) {
+	externalUser, err := s.exchange(ctx, provider, code, nonce, codeVerifier)
+	if err != nil {
+		return nil, err
+	}
+
+	identity, err := s.identities.FindBySubject(ctx, provider, externalUser.Subject)
+	if err != nil {
+		return nil, err
+	}
+
+	if identity != nil {
+		if identity.UserID == user.ID {
+			return identity, nil
+		}
+
+		return nil, errors.NewDuplicatedRecord(domain.ErrIdentityLinked).WithMessage("the account is linked to another user")
+	}
+
+	identities, err := s.identities.FindByUserID(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, linked := range identities {
+		if linked.Provider == provider {
+			return nil, errors.NewDuplicatedRecord(domain.ErrIdentityLinked).WithMessage("another account of the provider is linked, unlink it first")
+		}
+	}
+
+	identity, err = s.linkIdentity(ctx, user, provider, externalUser)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.updateExternalUser(ctx, user, externalUser); err != nil {
+		return nil, err
+	}
+
+	return identity, nil
+}
+
+// ReauthenticateWithProvider checks the account the provider redirected back with is linked to
+// the user
+func (s *service) ReauthenticateWithProvider(ctx context.Context, user *domain.User, provider, code, nonce, codeVerifier string) error {
+	externalUser, err := s.exchange(ctx, provider, code, nonce, codeVerifier)
+	if err != nil {
+		return err
+	}
+
+	identity, err := s.identities.FindBySubject(ctx, provider, externalUser.Subject)
+	if err != nil {
+		return err
+	}
+
+	if identity == nil || identity.UserID != user.ID {
+		return errors.NewNotAuthorized(domain.ErrInvalidCredentials).WithMessage("the account is not linked to your user")
+	}
+
+	return nil
+}
+
+// UnlinkIdentity removes an identity of the user. Users without a password keep at least one, so
+// they can still sign in.
+func (s *service) UnlinkIdentity(ctx context.Context, user *domain.User, ID int) error {
+	identities, err := s.identities.FindByUserID(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	var identity *domain.UserIdentity
+	for _, linked := range identities {
+		if linked.ID == ID {
+			identity = linked
+		}
+	}
+
+	if identity == nil {
+		return errors.NewNotFound(domain.ErrIdentityNotFound).WithMessage("linked account not found")
+	}
+
+	if !user.HasPassword() && len(identities) == 1 {
+		return errors.NewRuleNotSatisfied(domain.ErrLastLoginMethod).WithMessage("set a password or link another account before unlinking your only way to sign in")
+	}
+
+	return s.identities.Delete(ctx, user.ID, identity.ID)
+}
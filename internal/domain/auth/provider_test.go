@@ -0,0 +1,281 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	pkgerrors "gitlab.com/evzpav/user-auth/pkg/errors"
+)
+
+func (f *fakeUserService) Create(ctx context.Context, user *domain.User) error {
+	user.ID = len(f.users) + 1
+	f.users[user.ID] = user
+	return nil
+}
+
+type fakeIdentities struct {
+	identities []*domain.UserIdentity
+}
+
+func (f *fakeIdentities) Insert(ctx context.Context, identity *domain.UserIdentity) error {
+	for _, stored := range f.identities {
+		if stored.Provider == identity.Provider && stored.Subject == identity.Subject {
+			return pkgerrors.NewDuplicatedRecord("IDENTITY_DUPLICATED")
+		}
+	}
+
+	identity.ID = len(f.identities) + 1
+	f.identities = append(f.identities, identity)
+	return nil
+}
+
+func (f *fakeIdentities) FindBySubject(ctx context.Context, provider, subject string) (*domain.UserIdentity, error) {
+	for _, identity := range f.identities {
+		if identity.Provider == provider && identity.Subject == subject {
+			return identity, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (f *fakeIdentities) FindByUserID(ctx context.Context, userID int) ([]*domain.UserIdentity, error) {
+	var identities []*domain.UserIdentity
+	for _, identity := range f.identities {
+		if identity.UserID == userID {
+			identities = append(identities, identity)
+		}
+	}
+
+	return identities, nil
+}
+
+func (f *fakeIdentities) Delete(ctx context.Context, userID, ID int) error {
+	for i, identity := range f.identities {
+		if identity.UserID == userID && identity.ID == ID {
+			f.identities = append(f.identities[:i], f.identities[i+1:]...)
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// fakeProvider returns its user for any code
+type fakeProvider struct {
+	name string
+	user *domain.ExternalUser
+}
+
+func (p *fakeProvider) Name() string        { return p.name }
+func (p *fakeProvider) DisplayName() string { return p.name }
+
+func (p *fakeProvider) AuthURL(ctx context.Context, state, nonce, codeVerifier string) (string, error) {
+	return "https://" + p.name + "/authorize?state=" + state, nil
+}
+
+func (p *fakeProvider) Exchange(ctx context.Context, code, nonce, codeVerifier string) (*domain.ExternalUser, error) {
+	if p.user == nil {
+		return nil, errors.New("access denied")
+	}
+
+	user := *p.user
+	user.Provider = p.name
+	return &user, nil
+}
+
+func newProviderTestService(users map[int]*domain.User, providers ...domain.LoginProvider) *service {
+	s := newTestService(users)
+	s.providers = providers
+	return s
+}
+
+func newVerifiedUser(ID int, email string) *domain.User {
+	verifiedAt := time.Now()
+	return &domain.User{ID: ID, Email: email, Password: "hash", EmailVerifiedAt: &verifiedAt}
+}
+
+func assertCode(t *testing.T, err error, code pkgerrors.Code) {
+	t.Helper()
+
+	describer, ok := pkgerrors.DescriberCast(err)
+	require.True(t, ok, "expected %s, got %v", code, err)
+	assert.Equal(t, code, describer.GetCode())
+}
+
+func TestService_LoginWithProvider(t *testing.T) {
+	google := &fakeProvider{name: "google", user: &domain.ExternalUser{Subject: "g-1", Email: "user@example.com", EmailVerified: true, Name: "User"}}
+	gitlab := &fakeProvider{name: "gitlab", user: &domain.ExternalUser{Subject: "g-1", Email: "other@example.com", EmailVerified: true}}
+	users := map[int]*domain.User{}
+	s := newProviderTestService(users, google, gitlab)
+	ctx := context.Background()
+
+	authURL, err := s.LoginProviderURL(ctx, "gitlab", "state-1", "nonce", "verifier")
+	require.NoError(t, err)
+	assert.Equal(t, "https://gitlab/authorize?state=state-1", authURL)
+
+	login, err := s.LoginWithProvider(ctx, "google", "code", "nonce", "verifier")
+	require.NoError(t, err)
+	assert.True(t, login.SignedUp)
+	require.NotNil(t, login.Linked)
+	user := login.User
+	assert.Equal(t, "User", user.Name)
+	assert.True(t, user.EmailVerified())
+	assert.False(t, user.HasPassword(), "users signed up with a provider have no password")
+
+	identities, err := s.Identities(ctx, user.ID)
+	require.NoError(t, err)
+	require.Len(t, identities, 1)
+	assert.Equal(t, "google", identities[0].Provider)
+	assert.Equal(t, "g-1", identities[0].Subject)
+	assert.Equal(t, "user@example.com", identities[0].Email)
+
+	// the linked account is found by its subject after the email changed, also unverified
+	google.user.Email = "changed@example.com"
+	google.user.EmailVerified = false
+	again, err := s.LoginWithProvider(ctx, "google", "code", "nonce", "verifier")
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, again.User.ID)
+	assert.False(t, again.SignedUp)
+	assert.Nil(t, again.Linked, "the account was linked before")
+
+	// the same subject at another provider is another account
+	other, err := s.LoginWithProvider(ctx, "gitlab", "code", "nonce", "verifier")
+	require.NoError(t, err)
+	assert.NotEqual(t, user.ID, other.User.ID)
+	assert.Len(t, users, 2)
+}
+
+func TestService_LoginWithProviderExistingUser(t *testing.T) {
+	verified := newVerifiedUser(1, "user@example.com")
+	unverified := &domain.User{ID: 2, Email: "unverified@example.com", Password: "hash"}
+	users := map[int]*domain.User{1: verified, 2: unverified}
+	provider := &fakeProvider{name: "keycloak", user: &domain.ExternalUser{Subject: "k-1", Email: "user@example.com", EmailVerified: true, Name: "User"}}
+	s := newProviderTestService(users, provider)
+	ctx := context.Background()
+
+	// both emails are verified, the account is linked to the user
+	login, err := s.LoginWithProvider(ctx, "keycloak", "code", "nonce", "verifier")
+	require.NoError(t, err)
+	assert.Equal(t, 1, login.User.ID)
+	assert.Equal(t, "User", login.User.Name)
+	assert.False(t, login.SignedUp)
+	require.NotNil(t, login.Linked)
+	assert.Equal(t, "keycloak", login.Linked.Provider)
+
+	identities, err := s.Identities(ctx, 1)
+	require.NoError(t, err)
+	assert.Len(t, identities, 1)
+
+	// whoever registers the email of an unverified user at a provider does not get the account
+	provider.user = &domain.ExternalUser{Subject: "k-2", Email: "unverified@example.com", EmailVerified: true}
+	_, err = s.LoginWithProvider(ctx, "keycloak", "code", "nonce", "verifier")
+	assertCode(t, err, domain.ErrAccountNotLinked)
+	_, ok := pkgerrors.RuleNotSatisfiedCast(err)
+	assert.True(t, ok)
+
+	identities, err = s.Identities(ctx, 2)
+	require.NoError(t, err)
+	assert.Empty(t, identities)
+	assert.False(t, unverified.EmailVerified())
+	assert.Len(t, users, 2)
+}
+
+func TestService_LoginWithProviderErrors(t *testing.T) {
+	provider := &fakeProvider{name: "keycloak"}
+	s := newProviderTestService(map[int]*domain.User{}, provider)
+	ctx := context.Background()
+
+	_, err := s.LoginProviderURL(ctx, "unknown", "state", "nonce", "verifier")
+	_, ok := pkgerrors.NotFoundCast(err)
+	assert.True(t, ok, "unknown provider, got %v", err)
+
+	_, err = s.LoginWithProvider(ctx, "keycloak", "code", "nonce", "verifier")
+	_, ok = pkgerrors.NotAuthorizedCast(err)
+	assert.True(t, ok, "failed exchange, got %v", err)
+
+	provider.user = &domain.ExternalUser{Subject: "k-1", Email: "user@example.com"}
+	_, err = s.LoginWithProvider(ctx, "keycloak", "code", "nonce", "verifier")
+	describer, ok := pkgerrors.InvalidArgumentCast(err)
+	require.True(t, ok, "unverified email, got %v", err)
+	assert.Equal(t, domain.ErrProviderAccount, describer.GetCode())
+
+	provider.user = &domain.ExternalUser{Email: "user@example.com", EmailVerified: true}
+	_, err = s.LoginWithProvider(ctx, "keycloak", "code", "nonce", "verifier")
+	assertCode(t, err, domain.ErrProviderAccount)
+}
+
+func TestService_LinkProvider(t *testing.T) {
+	user := &domain.User{ID: 1, Email: "user@example.com", Password: "hash"}
+	other := newVerifiedUser(2, "other@example.com")
+	github := &fakeProvider{name: "github", user: &domain.ExternalUser{Subject: "1001", Email: "someone@example.com", Name: "Someone"}}
+	s := newProviderTestService(map[int]*domain.User{1: user, 2: other}, github)
+	ctx := context.Background()
+
+	// the email of the account does not need to match nor be verified
+	identity, err := s.LinkProvider(ctx, user, "github", "code", "nonce", "verifier")
+	require.NoError(t, err)
+	assert.Equal(t, 1, identity.UserID)
+	assert.Equal(t, "Someone", user.Name)
+	assert.False(t, user.EmailVerified())
+
+	again, err := s.LinkProvider(ctx, user, "github", "code", "nonce", "verifier")
+	require.NoError(t, err)
+	assert.Equal(t, identity.ID, again.ID, "linking the same account twice is a no-op")
+
+	_, err = s.LinkProvider(ctx, other, "github", "code", "nonce", "verifier")
+	assertCode(t, err, domain.ErrIdentityLinked)
+
+	github.user = &domain.ExternalUser{Subject: "1002"}
+	_, err = s.LinkProvider(ctx, user, "github", "code", "nonce", "verifier")
+	assertCode(t, err, domain.ErrIdentityLinked)
+
+	// the linked account signs the user in
+	github.user = &domain.ExternalUser{Subject: "1001"}
+	loggedIn, err := s.LoginWithProvider(ctx, "github", "code", "nonce", "verifier")
+	require.NoError(t, err)
+	assert.Equal(t, 1, loggedIn.User.ID)
+
+	require.NoError(t, s.ReauthenticateWithProvider(ctx, user, "github", "code", "nonce", "verifier"))
+	err = s.ReauthenticateWithProvider(ctx, other, "github", "code", "nonce", "verifier")
+	assertCode(t, err, domain.ErrInvalidCredentials)
+}
+
+func TestService_UnlinkIdentity(t *testing.T) {
+	google := &fakeProvider{name: "google", user: &domain.ExternalUser{Subject: "g-1", Email: "user@example.com", EmailVerified: true}}
+	github := &fakeProvider{name: "github", user: &domain.ExternalUser{Subject: "1001"}}
+	users := map[int]*domain.User{9: {ID: 9, Email: "other@example.com", Password: "hash"}}
+	s := newProviderTestService(users, google, github)
+	ctx := context.Background()
+
+	login, err := s.LoginWithProvider(ctx, "google", "code", "nonce", "verifier")
+	require.NoError(t, err)
+	user := login.User
+	linked, err := s.LinkProvider(ctx, user, "github", "code", "nonce", "verifier")
+	require.NoError(t, err)
+
+	identities, err := s.Identities(ctx, user.ID)
+	require.NoError(t, err)
+	require.Len(t, identities, 2)
+
+	err = s.UnlinkIdentity(ctx, users[9], linked.ID)
+	assertCode(t, err, domain.ErrIdentityNotFound)
+
+	require.NoError(t, s.UnlinkIdentity(ctx, user, linked.ID))
+
+	// the user has no password, the last identity is the only way to sign in
+	err = s.UnlinkIdentity(ctx, user, identities[0].ID)
+	assertCode(t, err, domain.ErrLastLoginMethod)
+
+	require.NoError(t, s.SetNewPassword(ctx, user, "password"))
+	require.NoError(t, s.UnlinkIdentity(ctx, user, identities[0].ID))
+
+	identities, err = s.Identities(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Empty(t, identities)
+}
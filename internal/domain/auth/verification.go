@@ -0,0 +1,157 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/pkg/errors"
+	"gitlab.com/evzpav/user-auth/pkg/log"
+)
+
+const defaultVerificationTTL = 48 * time.Hour
+
+// EmailVerificationConfig configures the links sent to verify email addresses. Key signs the
+// links, changing it invalidates the links already sent.
+type EmailVerificationConfig struct {
+	Key    []byte
+	TTL    time.Duration
+	Policy domain.EmailVerificationPolicy
+}
+
+func (c EmailVerificationConfig) withDefaults(log log.Logger) EmailVerificationConfig {
+	if c.Policy == "" {
+		c.Policy = domain.EmailVerificationOptional
+	}
+
+	if c.TTL <= 0 {
+		c.TTL = defaultVerificationTTL
+	}
+
+	if len(c.Key) == 0 {
+		c.Key = make([]byte, 32)
+		if _, err := rand.Read(c.Key); err != nil {
+			log.Fatal().Err(err).Sendf("failed to generate email verification key: %v", err)
+		}
+		log.Warn().Sendf("no email verification key configured, links sent before a restart will not be valid")
+	}
+
+	return c
+}
+
+func (s *service) EmailVerificationPolicy() domain.EmailVerificationPolicy {
+	return s.verification.Policy
+}
+
+// SendVerificationEmail sends a link proving the user owns the email. Links are not stored, they
+// hold the user id, the email and the expiration signed with the verification key.
+func (s *service) SendVerificationEmail(ctx context.Context, user *domain.User) error {
+	if user.EmailVerified() {
+		return nil
+	}
+
+	expiresAt := s.now().Add(s.verification.TTL)
+	data := struct {
+		Email     string
+		Link      string
+		ExpiresAt time.Time
+	}{
+		Email:     user.Email,
+		Link:      fmt.Sprintf("%s/email/verify?token=%s", s.platformURL, s.verificationToken(user, expiresAt)),
+		ExpiresAt: expiresAt,
+	}
+
+	if err := s.sendEmail(ctx, user.Email, "verify_email", data); err != nil {
+		return err
+	}
+
+	s.log.Info().Sendf("sent verification link to %s", user.Email)
+	return nil
+}
+
+// VerifyEmail marks the email of the link as verified. The link is rejected when the user changed
+// the email after it was sent.
+func (s *service) VerifyEmail(ctx context.Context, token string) (*domain.User, error) {
+	invalidLink := errors.NewInvalidArgument(domain.ErrInvalidLink).WithMessage("invalid or expired link")
+
+	userID, email, ok := s.parseVerificationToken(token)
+	if !ok {
+		return nil, invalidLink
+	}
+
+	user, err := s.userService.FindByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if user == nil || user.Email != email {
+		return nil, invalidLink
+	}
+
+	if user.EmailVerified() {
+		return user, nil
+	}
+
+	verifiedAt := s.now()
+	user.EmailVerifiedAt = &verifiedAt
+
+	if err := s.userService.Update(ctx, user); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (s *service) verificationToken(user *domain.User, expiresAt time.Time) string {
+	payload := []byte(strconv.Itoa(user.ID) + ":" + strconv.FormatInt(expiresAt.Unix(), 10) + ":" + user.Email)
+
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(s.sign(payload))
+}
+
+func (s *service) parseVerificationToken(token string) (int, string, bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return 0, "", false
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return 0, "", false
+	}
+
+	mac, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(mac, s.sign(payload)) {
+		return 0, "", false
+	}
+
+	fields := strings.SplitN(string(payload), ":", 3)
+	if len(fields) != 3 {
+		return 0, "", false
+	}
+
+	userID, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return 0, "", false
+	}
+
+	expiresAt, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil || s.now().Unix() >= expiresAt {
+		return 0, "", false
+	}
+
+	return userID, fields[2], true
+}
+
+func (s *service) sign(payload []byte) []byte {
+	mac := hmac.New(sha256.New, s.verification.Key)
+	mac.Write([]byte("email-verification:"))
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/evzpav/user-auth/internal/domain"
+)
+
+func TestService_VerifyEmail(t *testing.T) {
+	user := &domain.User{ID: 1, Email: "user@example.com"}
+	s := newTestService(map[int]*domain.User{1: user})
+	ctx := context.Background()
+
+	require.NoError(t, s.SendVerificationEmail(ctx, user))
+	emails := s.mailer.(*fakeMailer).emails
+	require.Len(t, emails, 1)
+	assert.Equal(t, "user@example.com", emails[0].To)
+	assert.Equal(t, "verify_email", emails[0].Subject)
+
+	prefix := "http://localhost/email/verify?token="
+	require.True(t, strings.HasPrefix(emails[0].Text, prefix))
+	token := strings.TrimPrefix(emails[0].Text, prefix)
+
+	verified, err := s.VerifyEmail(ctx, token)
+	require.NoError(t, err)
+	assert.True(t, verified.EmailVerified())
+
+	// verifying twice keeps the first date
+	verifiedAt := *verified.EmailVerifiedAt
+	s.now = func() time.Time { return verifiedAt.Add(time.Minute) }
+	verified, err = s.VerifyEmail(ctx, token)
+	require.NoError(t, err)
+	assert.Equal(t, verifiedAt, *verified.EmailVerifiedAt)
+
+	// verified users are not sent new links
+	require.NoError(t, s.SendVerificationEmail(ctx, verified))
+	assert.Len(t, s.mailer.(*fakeMailer).emails, 1)
+}
+
+func TestService_VerifyEmailRejected(t *testing.T) {
+	user := &domain.User{ID: 1, Email: "user@example.com"}
+	s := newTestService(map[int]*domain.User{1: user})
+	ctx := context.Background()
+	now := time.Now()
+	s.now = func() time.Time { return now }
+
+	token := s.verificationToken(user, now.Add(time.Hour))
+
+	tests := []struct {
+		name  string
+		token string
+		setup func()
+	}{
+		{name: "empty", token: ""},
+		{name: "malformed", token: "abc"},
+		{name: "tampered", token: strings.Replace(token, ".", ".A", 1)},
+		{name: "other key", token: newTestServiceWithKey("other").verificationToken(user, now.Add(time.Hour))},
+		{name: "expired", token: token, setup: func() { s.now = func() time.Time { return now.Add(2 * time.Hour) } }},
+		{name: "unknown user", token: s.verificationToken(&domain.User{ID: 2, Email: "other@example.com"}, now.Add(time.Hour))},
+		{name: "email changed", token: token, setup: func() { user.Email = "new@example.com" }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s.now = func() time.Time { return now }
+			user.Email = "user@example.com"
+			if tt.setup != nil {
+				tt.setup()
+			}
+
+			_, err := s.VerifyEmail(ctx, tt.token)
+			assertInvalidLink(t, err)
+			assert.False(t, user.EmailVerified())
+		})
+	}
+}
+
+func newTestServiceWithKey(key string) *service {
+	s := newTestService(nil)
+	s.verification.Key = []byte(key)
+	return s
+}
+
+func TestEmailVerificationPolicy(t *testing.T) {
+	verifiedAt := time.Now()
+	unverified := &domain.User{}
+	verified := &domain.User{EmailVerifiedAt: &verifiedAt}
+
+	assert.True(t, domain.EmailVerificationOptional.AllowsLogin(unverified))
+	assert.True(t, domain.EmailVerificationOptional.AllowsProfileEdit(unverified))
+
+	assert.True(t, domain.EmailVerificationRestrictProfile.AllowsLogin(unverified))
+	assert.False(t, domain.EmailVerificationRestrictProfile.AllowsProfileEdit(unverified))
+	assert.True(t, domain.EmailVerificationRestrictProfile.AllowsProfileEdit(verified))
+
+	assert.False(t, domain.EmailVerificationBlockLogin.AllowsLogin(unverified))
+	assert.False(t, domain.EmailVerificationBlockLogin.AllowsProfileEdit(unverified))
+	assert.True(t, domain.EmailVerificationBlockLogin.AllowsLogin(verified))
+}
@@ -3,5 +3,63 @@ package domain
 import "gitlab.com/evzpav/user-auth/pkg/errors"
 
 const (
-	ErrInvalidCredentials    errors.Code = "INVALID_CREDENTIALS"
+	ErrInvalidCredentials errors.Code = "INVALID_CREDENTIALS"
+	ErrEmailAlreadyUsed   errors.Code = "EMAIL_ALREADY_USED"
+	ErrInvalidProfile     errors.Code = "INVALID_PROFILE"
+	ErrInvalidLink        errors.Code = "INVALID_LINK"
+	ErrInvalidToken       errors.Code = "INVALID_TOKEN"
+	ErrTokenReused        errors.Code = "TOKEN_REUSED"
+	ErrSessionNotFound    errors.Code = "SESSION_NOT_FOUND"
+	ErrInvalidMFACode     errors.Code = "INVALID_MFA_CODE"
+	ErrMFAAlreadyEnabled  errors.Code = "MFA_ALREADY_ENABLED"
+	ErrMFANotEnabled      errors.Code = "MFA_NOT_ENABLED"
+	ErrInvalidPasskey     errors.Code = "INVALID_PASSKEY"
+	ErrPasskeyNotFound    errors.Code = "PASSKEY_NOT_FOUND"
+	ErrPasskeyRegistered  errors.Code = "PASSKEY_ALREADY_REGISTERED"
+	ErrTooManyAttempts    errors.Code = "TOO_MANY_ATTEMPTS"
+	ErrEmailNotVerified   errors.Code = "EMAIL_NOT_VERIFIED"
+	ErrProviderNotFound   errors.Code = "PROVIDER_NOT_FOUND"
+	ErrProviderLogin      errors.Code = "PROVIDER_LOGIN_FAILED"
+	ErrProviderAccount    errors.Code = "INVALID_PROVIDER_ACCOUNT"
+	ErrAccountNotLinked   errors.Code = "ACCOUNT_NOT_LINKED"
+	ErrIdentityLinked     errors.Code = "IDENTITY_ALREADY_LINKED"
+	ErrIdentityNotFound   errors.Code = "IDENTITY_NOT_FOUND"
+	ErrLastLoginMethod    errors.Code = "LAST_LOGIN_METHOD"
+	ErrAccountDisabled    errors.Code = "ACCOUNT_DISABLED"
+	ErrRoleNotFound       errors.Code = "ROLE_NOT_FOUND"
+	ErrUserNotFound       errors.Code = "USER_NOT_FOUND"
+	ErrOwnAccount         errors.Code = "OWN_ACCOUNT"
+	ErrPermissionDenied   errors.Code = "PERMISSION_DENIED"
+	ErrInvalidPermission  errors.Code = "INVALID_PERMISSION"
+	ErrInvalidAPIKey      errors.Code = "INVALID_API_KEY"
+	ErrAPIKeyNotFound     errors.Code = "API_KEY_NOT_FOUND"
+	ErrInvalidKeyName     errors.Code = "INVALID_KEY_NAME"
+	ErrInvalidScope       errors.Code = "INVALID_SCOPE"
+	ErrInvalidExpiration  errors.Code = "INVALID_EXPIRATION"
+	ErrOrgNotFound        errors.Code = "ORGANIZATION_NOT_FOUND"
+	ErrInvalidOrgName     errors.Code = "INVALID_ORGANIZATION_NAME"
+	ErrInvalidOrgRole     errors.Code = "INVALID_ORGANIZATION_ROLE"
+	ErrInvalidEmail       errors.Code = "INVALID_EMAIL"
+	ErrAlreadyMember      errors.Code = "ALREADY_MEMBER"
+	ErrMemberNotFound     errors.Code = "MEMBER_NOT_FOUND"
+	ErrOwnerMembership    errors.Code = "OWNER_MEMBERSHIP"
+	ErrInvitationNotFound errors.Code = "INVITATION_NOT_FOUND"
+	ErrInvitationEmail    errors.Code = "INVITATION_EMAIL_MISMATCH"
+	ErrInvalidAuditType   errors.Code = "INVALID_AUDIT_EVENT_TYPE"
+)
+
+// OAuth errors are the error codes of RFC 6749, RFC 7009 and RFC 6750, they are returned to the
+// clients as is
+const (
+	ErrOAuthInvalidRequest          errors.Code = "invalid_request"
+	ErrOAuthInvalidClient           errors.Code = "invalid_client"
+	ErrOAuthInvalidGrant            errors.Code = "invalid_grant"
+	ErrOAuthUnauthorizedClient      errors.Code = "unauthorized_client"
+	ErrOAuthUnsupportedGrantType    errors.Code = "unsupported_grant_type"
+	ErrOAuthUnsupportedResponseType errors.Code = "unsupported_response_type"
+	ErrOAuthUnsupportedTokenType    errors.Code = "unsupported_token_type"
+	ErrOAuthInvalidScope            errors.Code = "invalid_scope"
+	ErrOAuthAccessDenied            errors.Code = "access_denied"
+	ErrOAuthInvalidToken            errors.Code = "invalid_token"
+	ErrOAuthInsufficientScope       errors.Code = "insufficient_scope"
 )
@@ -0,0 +1,24 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// UserIdentity links a user to an account at a login provider, which signs the user in
+type UserIdentity struct {
+	ID       int       `json:"id"`
+	UserID   int       `json:"user_id"`
+	Provider string    `json:"provider"`
+	Subject  string    `json:"subject"`
+	Email    string    `json:"email"`
+	LinkedAt time.Time `json:"linked_at"`
+}
+
+type UserIdentityStorage interface {
+	// Insert fails with a duplicated record when the account is linked to a user already
+	Insert(ctx context.Context, identity *UserIdentity) error
+	FindBySubject(ctx context.Context, provider, subject string) (*UserIdentity, error)
+	FindByUserID(ctx context.Context, userID int) ([]*UserIdentity, error)
+	Delete(ctx context.Context, userID, ID int) error
+}
@@ -0,0 +1,54 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// status of a job
+const (
+	JobPending = "pending"
+	JobRunning = "running"
+	JobDone    = "done"
+	JobDead    = "dead"
+)
+
+// kinds of job
+const (
+	JobSendEmail = "send_email"
+)
+
+// Job is a unit of background work, Payload is the JSON encoded argument of its handler. The payload
+// may carry secrets, like the links of the emails, it is cleared once the job is done or dead.
+type Job struct {
+	ID          int
+	Kind        string
+	Payload     string
+	Status      string
+	Attempts    int
+	MaxAttempts int
+	NextRunAt   time.Time
+	LockedUntil *time.Time
+	ClaimToken  string
+	LastError   string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	FinishedAt  *time.Time
+}
+
+// JobHandler runs a job, a failed job is retried until it runs out of attempts
+type JobHandler func(ctx context.Context, payload []byte) error
+
+type JobQueue interface {
+	Enqueue(ctx context.Context, kind string, payload interface{}) error
+}
+
+// JobStorage keeps the jobs. Claim must be atomic so a job is only run by one worker, jobs left
+// running by a stopped worker are claimed again once their lock expires.
+type JobStorage interface {
+	Insert(ctx context.Context, job *Job) error
+	Claim(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*Job, error)
+	// Release stores the status of a claimed job, it is ignored when the job was claimed again
+	Release(ctx context.Context, job *Job) error
+	DeleteFinished(ctx context.Context, before time.Time) error
+}
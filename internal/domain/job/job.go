@@ -0,0 +1,253 @@
+package job
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/pkg/log"
+)
+
+// Config of the workers. A job not finished within Lease is considered lost and claimed again,
+// failed jobs are retried after RetryBase doubled on every attempt up to RetryMax.
+type Config struct {
+	Workers      int
+	PollInterval time.Duration
+	Lease        time.Duration
+	MaxAttempts  int
+	RetryBase    time.Duration
+	RetryMax     time.Duration
+	Retention    time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Workers:      4,
+		PollInterval: time.Second,
+		Lease:        5 * time.Minute,
+		MaxAttempts:  8,
+		RetryBase:    30 * time.Second,
+		RetryMax:     time.Hour,
+		Retention:    7 * 24 * time.Hour,
+	}
+}
+
+type service struct {
+	storage  domain.JobStorage
+	config   Config
+	handlers map[string]domain.JobHandler
+	now      func() time.Time
+	log      log.Logger
+
+	wake     chan struct{}
+	stop     chan struct{}
+	stopOnce sync.Once
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+func NewService(storage domain.JobStorage, config Config, log log.Logger) *service {
+	return &service{
+		storage:  storage,
+		config:   config,
+		handlers: make(map[string]domain.JobHandler),
+		now:      time.Now,
+		log:      log,
+		wake:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+	}
+}
+
+// Register sets the handler of a kind of job, it must be called before Start
+func (s *service) Register(kind string, handler domain.JobHandler) {
+	s.handlers[kind] = handler
+}
+
+// Enqueue stores a job to run as soon as a worker is free
+func (s *service) Enqueue(ctx context.Context, kind string, payload interface{}) error {
+	bs, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	now := s.now()
+	job := &domain.Job{
+		Kind:        kind,
+		Payload:     string(bs),
+		Status:      domain.JobPending,
+		MaxAttempts: s.config.MaxAttempts,
+		NextRunAt:   now,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	if err := s.storage.Insert(ctx, job); err != nil {
+		return err
+	}
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// Start runs the workers until Stop is called
+func (s *service) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+
+	for i := 0; i < s.config.Workers; i++ {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.work(ctx)
+		}()
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.cleanup(ctx)
+	}()
+}
+
+// Stop stops claiming jobs and waits for the running ones. When ctx ends first the running jobs
+// are cancelled, they are retried on the next start.
+func (s *service) Stop(ctx context.Context) error {
+	s.stopOnce.Do(func() { close(s.stop) })
+	if s.cancel == nil {
+		return nil
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		s.cancel()
+		return nil
+	case <-ctx.Done():
+		s.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+func (s *service) work(ctx context.Context) {
+	for {
+		select {
+		case <-s.stop:
+			return
+		default:
+		}
+
+		jobs, err := s.storage.Claim(ctx, s.now(), s.config.Lease, 1)
+		if err != nil {
+			s.log.Error().Err(err).Sendf("failed to claim jobs")
+		}
+
+		if len(jobs) == 0 {
+			select {
+			case <-s.stop:
+				return
+			case <-s.wake:
+			case <-time.After(s.config.PollInterval):
+			}
+			continue
+		}
+
+		for _, job := range jobs {
+			s.run(ctx, job)
+		}
+	}
+}
+
+// run executes the job and stores the outcome, jobs out of attempts are dead-lettered
+func (s *service) run(ctx context.Context, job *domain.Job) {
+	err := s.execute(ctx, job)
+
+	now := s.now()
+	job.UpdatedAt = now
+	job.LockedUntil = nil
+
+	switch {
+	case err == nil:
+		job.Status = domain.JobDone
+		job.Payload = ""
+		job.LastError = ""
+		job.FinishedAt = &now
+	case job.Attempts >= job.MaxAttempts:
+		job.Status = domain.JobDead
+		job.Payload = ""
+		job.LastError = err.Error()
+		job.FinishedAt = &now
+		s.log.Error().Err(err).Sendf("job %d %s failed after %d attempts", job.ID, job.Kind, job.Attempts)
+	default:
+		job.Status = domain.JobPending
+		job.LastError = err.Error()
+		job.NextRunAt = now.Add(s.config.backoff(job.Attempts))
+		s.log.Warn().Err(err).Sendf("job %d %s failed, retrying at %s", job.ID, job.Kind, job.NextRunAt.Format(time.RFC3339))
+	}
+
+	// the outcome is stored even when the workers are being cancelled
+	if err := s.storage.Release(context.Background(), job); err != nil {
+		s.log.Error().Err(err).Sendf("failed to release job %d", job.ID)
+	}
+}
+
+func (s *service) execute(ctx context.Context, job *domain.Job) (err error) {
+	handler, ok := s.handlers[job.Kind]
+	if !ok {
+		job.Attempts = job.MaxAttempts
+		return fmt.Errorf("no handler for job kind %q", job.Kind)
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(ctx, s.config.Lease)
+	defer cancel()
+
+	return handler(ctx, []byte(job.Payload))
+}
+
+// cleanup deletes the jobs done for longer than the retention, dead jobs are kept to be inspected
+func (s *service) cleanup(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		if err := s.storage.DeleteFinished(ctx, s.now().Add(-s.config.Retention)); err != nil {
+			s.log.Error().Err(err).Sendf("failed to delete finished jobs")
+		}
+
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c Config) backoff(attempts int) time.Duration {
+	delay := c.RetryBase
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= c.RetryMax {
+			return c.RetryMax
+		}
+	}
+
+	return delay
+}
@@ -0,0 +1,214 @@
+package job
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/pkg/log"
+)
+
+type fakeStorage struct {
+	mu   sync.Mutex
+	jobs []*domain.Job
+}
+
+func (f *fakeStorage) Insert(ctx context.Context, job *domain.Job) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	job.ID = len(f.jobs) + 1
+	f.jobs = append(f.jobs, job)
+	return nil
+}
+
+func (f *fakeStorage) Claim(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*domain.Job, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var claimed []*domain.Job
+	for _, job := range f.jobs {
+		if len(claimed) == limit {
+			break
+		}
+
+		due := job.Status == domain.JobPending && !job.NextRunAt.After(now)
+		lost := job.Status == domain.JobRunning && !job.LockedUntil.After(now)
+		if !due && !lost {
+			continue
+		}
+
+		lockedUntil := now.Add(lease)
+		job.Status = domain.JobRunning
+		job.Attempts++
+		job.LockedUntil = &lockedUntil
+		job.ClaimToken = fmt.Sprintf("%d-%d", job.ID, job.Attempts)
+
+		c := *job
+		claimed = append(claimed, &c)
+	}
+
+	return claimed, nil
+}
+
+func (f *fakeStorage) Release(ctx context.Context, job *domain.Job) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i, j := range f.jobs {
+		if j.ID == job.ID && j.ClaimToken == job.ClaimToken {
+			c := *job
+			f.jobs[i] = &c
+		}
+	}
+
+	return nil
+}
+
+func (f *fakeStorage) DeleteFinished(ctx context.Context, before time.Time) error {
+	return nil
+}
+
+func (f *fakeStorage) job(ID int) domain.Job {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return *f.jobs[ID-1]
+}
+
+func newTestService() (*service, *fakeStorage) {
+	storage := &fakeStorage{}
+	config := DefaultConfig()
+	config.Workers = 2
+	config.PollInterval = 10 * time.Millisecond
+
+	return NewService(storage, config, log.NewZeroLog("", "", log.Error)), storage
+}
+
+func TestService_RunsJobs(t *testing.T) {
+	s, storage := newTestService()
+
+	payloads := make(chan string, 1)
+	s.Register("greet", func(ctx context.Context, payload []byte) error {
+		payloads <- string(payload)
+		return nil
+	})
+
+	s.Start()
+	require.NoError(t, s.Enqueue(context.Background(), "greet", map[string]string{"name": "user"}))
+
+	select {
+	case payload := <-payloads:
+		assert.Equal(t, `{"name":"user"}`, payload)
+	case <-time.After(time.Second):
+		t.Fatal("job did not run")
+	}
+
+	require.NoError(t, s.Stop(context.Background()))
+
+	job := storage.job(1)
+	assert.Equal(t, domain.JobDone, job.Status)
+	assert.Equal(t, 1, job.Attempts)
+	assert.NotNil(t, job.FinishedAt)
+	assert.Empty(t, job.Payload, "the payload of a done job is cleared")
+}
+
+func TestService_RetriesAndDeadLetters(t *testing.T) {
+	s, storage := newTestService()
+	s.config.MaxAttempts = 2
+	now := time.Date(2020, 5, 1, 10, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	s.Register("fail", func(ctx context.Context, payload []byte) error {
+		return fmt.Errorf("smtp unavailable")
+	})
+	require.NoError(t, s.Enqueue(ctx, "fail", map[string]string{"link": "https://example.com/password/new?token=secret"}))
+
+	jobs, err := storage.Claim(ctx, now, s.config.Lease, 1)
+	require.NoError(t, err)
+	s.run(ctx, jobs[0])
+
+	job := storage.job(1)
+	assert.Equal(t, domain.JobPending, job.Status)
+	assert.Equal(t, "smtp unavailable", job.LastError)
+	assert.Equal(t, now.Add(s.config.RetryBase), job.NextRunAt)
+	assert.Contains(t, job.Payload, "token=secret", "the payload is kept for the retry")
+
+	// not due before the retry delay
+	jobs, err = storage.Claim(ctx, now, s.config.Lease, 1)
+	require.NoError(t, err)
+	assert.Empty(t, jobs)
+
+	now = job.NextRunAt
+	jobs, err = storage.Claim(ctx, now, s.config.Lease, 1)
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+	s.run(ctx, jobs[0])
+
+	job = storage.job(1)
+	assert.Equal(t, domain.JobDead, job.Status)
+	assert.Equal(t, 2, job.Attempts)
+	assert.NotNil(t, job.FinishedAt)
+	assert.Empty(t, job.Payload, "the payload of a dead job is cleared")
+	assert.Equal(t, "smtp unavailable", job.LastError)
+}
+
+func TestService_UnknownKindAndPanic(t *testing.T) {
+	s, storage := newTestService()
+	ctx := context.Background()
+
+	s.Register("panic", func(ctx context.Context, payload []byte) error {
+		panic("boom")
+	})
+	require.NoError(t, s.Enqueue(ctx, "unknown", nil))
+	require.NoError(t, s.Enqueue(ctx, "panic", nil))
+
+	jobs, err := storage.Claim(ctx, s.now(), s.config.Lease, 2)
+	require.NoError(t, err)
+	for _, job := range jobs {
+		s.run(ctx, job)
+	}
+
+	assert.Equal(t, domain.JobDead, storage.job(1).Status)
+	assert.Equal(t, domain.JobPending, storage.job(2).Status)
+	assert.Equal(t, "job panicked: boom", storage.job(2).LastError)
+}
+
+func TestService_StopCancelsRunningJobs(t *testing.T) {
+	s, storage := newTestService()
+
+	started := make(chan struct{})
+	s.Register("slow", func(ctx context.Context, payload []byte) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	s.Start()
+	require.NoError(t, s.Enqueue(context.Background(), "slow", nil))
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, s.Stop(ctx))
+
+	job := storage.job(1)
+	assert.Equal(t, domain.JobPending, job.Status)
+	assert.Equal(t, context.Canceled.Error(), job.LastError)
+}
+
+func TestConfig_Backoff(t *testing.T) {
+	config := Config{RetryBase: 30 * time.Second, RetryMax: 5 * time.Minute}
+
+	assert.Equal(t, 30*time.Second, config.backoff(1))
+	assert.Equal(t, time.Minute, config.backoff(2))
+	assert.Equal(t, 4*time.Minute, config.backoff(4))
+	assert.Equal(t, 5*time.Minute, config.backoff(5))
+	assert.Equal(t, 5*time.Minute, config.backoff(30))
+}
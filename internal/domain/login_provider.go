@@ -0,0 +1,22 @@
+package domain
+
+import "context"
+
+// ExternalUser is the account of a user at a login provider
+type ExternalUser struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// LoginProvider signs users in with an account of another service, e.g. an OpenID Connect
+// provider. The state, nonce and code verifier are generated per login and kept by the caller
+// until the provider redirects back.
+type LoginProvider interface {
+	Name() string
+	DisplayName() string
+	AuthURL(ctx context.Context, state, nonce, codeVerifier string) (string, error)
+	Exchange(ctx context.Context, code, nonce, codeVerifier string) (*ExternalUser, error)
+}
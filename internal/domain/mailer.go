@@ -0,0 +1,22 @@
+package domain
+
+import "context"
+
+// Email is a message rendered from the email templates
+type Email struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Mailer delivers emails, the sender address is part of the mailer configuration
+type Mailer interface {
+	Send(ctx context.Context, email *Email) error
+}
+
+// EmailRenderer builds the email of a template, name is the file name in the emails directory
+// without extension
+type EmailRenderer interface {
+	RenderEmail(name string, data interface{}) (*Email, error)
+}
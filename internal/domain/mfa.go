@@ -0,0 +1,16 @@
+package domain
+
+import "context"
+
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+type MFAService interface {
+	BeginEnrollment(ctx context.Context, user *User) (*TOTPEnrollment, error)
+	ConfirmEnrollment(ctx context.Context, user *User, code string) ([]string, error)
+	Disable(ctx context.Context, user *User, code string) error
+	Verify(ctx context.Context, user *User, code string) error
+	RegenerateRecoveryCodes(ctx context.Context, user *User, code string) ([]string, error)
+}
@@ -0,0 +1,271 @@
+package mfa
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/pkg/errors"
+	"gitlab.com/evzpav/user-auth/pkg/log"
+	"gitlab.com/evzpav/user-auth/pkg/totp"
+)
+
+const (
+	recoveryCodesCount = 10
+	recoveryCodeLength = 10
+	// accepted clock drift, in time steps, between the server and the authenticator
+	allowedSkew = 1
+)
+
+// unambiguous lowercase alphabet for recovery codes
+const recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+type service struct {
+	userService domain.UserService
+	issuer      string
+	now         func() time.Time
+	log         log.Logger
+}
+
+func NewService(userService domain.UserService, issuer string, log log.Logger) *service {
+	return &service{
+		userService: userService,
+		issuer:      issuer,
+		now:         time.Now,
+		log:         log,
+	}
+}
+
+// BeginEnrollment stores a new pending secret. It only takes effect after ConfirmEnrollment.
+func (s *service) BeginEnrollment(ctx context.Context, user *domain.User) (*domain.TOTPEnrollment, error) {
+	if user.TOTPEnabled {
+		return nil, errors.NewRuleNotSatisfied(domain.ErrMFAAlreadyEnabled).WithMessage("two-factor authentication is already enabled")
+	}
+
+	secret, err := totp.NewSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	user.TOTPSecret = secret
+	user.TOTPLastStep = 0
+	if err := s.userService.Update(ctx, user); err != nil {
+		return nil, err
+	}
+
+	return &domain.TOTPEnrollment{
+		Secret: secret,
+		URI:    totp.URI(s.issuer, user.Email, secret),
+	}, nil
+}
+
+// ConfirmEnrollment enables the pending secret when the code matches and returns new recovery codes
+func (s *service) ConfirmEnrollment(ctx context.Context, user *domain.User, code string) ([]string, error) {
+	if user.TOTPEnabled {
+		return nil, errors.NewRuleNotSatisfied(domain.ErrMFAAlreadyEnabled).WithMessage("two-factor authentication is already enabled")
+	}
+
+	if user.TOTPSecret == "" || !s.validateTOTP(user, code) {
+		return nil, invalidCode()
+	}
+
+	codes, err := s.setRecoveryCodes(user)
+	if err != nil {
+		return nil, err
+	}
+
+	user.TOTPEnabled = true
+	if err := s.userService.Update(ctx, user); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+func (s *service) Disable(ctx context.Context, user *domain.User, code string) error {
+	if err := s.Verify(ctx, user, code); err != nil {
+		return err
+	}
+
+	user.TOTPEnabled = false
+	user.TOTPSecret = ""
+	user.TOTPLastStep = 0
+	user.MFARecoveryCodes = ""
+
+	return s.userService.Update(ctx, user)
+}
+
+// Verify accepts either a current TOTP code or one of the unused recovery codes, which is then consumed.
+// The code is used with a conditional update of the stored user, so concurrent requests with the
+// same code cannot both pass.
+func (s *service) Verify(ctx context.Context, user *domain.User, code string) error {
+	if !user.TOTPEnabled {
+		return errors.NewRuleNotSatisfied(domain.ErrMFANotEnabled).WithMessage("two-factor authentication is not enabled")
+	}
+
+	if step, ok := s.totpStep(user, code); ok {
+		used, err := s.userService.UseTOTPStep(ctx, user.ID, step)
+		if err != nil {
+			return err
+		}
+
+		if !used {
+			return invalidCode()
+		}
+
+		user.TOTPLastStep = step
+		return nil
+	}
+
+	if remaining, ok := s.withoutRecoveryCode(user, code); ok {
+		replaced, err := s.userService.ReplaceRecoveryCodes(ctx, user.ID, user.MFARecoveryCodes, remaining)
+		if err != nil {
+			return err
+		}
+
+		if !replaced {
+			return invalidCode()
+		}
+
+		user.MFARecoveryCodes = remaining
+		s.log.Info().Sendf("recovery code used by user %d", user.ID)
+		return nil
+	}
+
+	return invalidCode()
+}
+
+func (s *service) RegenerateRecoveryCodes(ctx context.Context, user *domain.User, code string) ([]string, error) {
+	if err := s.Verify(ctx, user, code); err != nil {
+		return nil, err
+	}
+
+	codes, err := s.setRecoveryCodes(user)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.userService.Update(ctx, user); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// validateTOTP checks the code and records its time step so the same code cannot be replayed
+func (s *service) validateTOTP(user *domain.User, code string) bool {
+	step, ok := s.totpStep(user, code)
+	if !ok {
+		return false
+	}
+
+	user.TOTPLastStep = step
+	return true
+}
+
+// totpStep returns the time step of the code when it is valid and later than the last used one
+func (s *service) totpStep(user *domain.User, code string) (int64, bool) {
+	step, ok := totp.Validate(user.TOTPSecret, code, s.now(), allowedSkew)
+	if !ok || step <= user.TOTPLastStep {
+		return 0, false
+	}
+
+	return step, true
+}
+
+func (s *service) setRecoveryCodes(user *domain.User) ([]string, error) {
+	codes := make([]string, recoveryCodesCount)
+	hashes := make([]string, recoveryCodesCount)
+
+	for i := range codes {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+
+		codes[i] = code
+		hashes[i] = hashRecoveryCode(code)
+	}
+
+	bs, err := json.Marshal(hashes)
+	if err != nil {
+		return nil, err
+	}
+
+	user.MFARecoveryCodes = string(bs)
+	return codes, nil
+}
+
+// withoutRecoveryCode returns the recovery codes of the user without the given one, when it is one of them
+func (s *service) withoutRecoveryCode(user *domain.User, code string) (string, bool) {
+	if user.MFARecoveryCodes == "" {
+		return "", false
+	}
+
+	var hashes []string
+	if err := json.Unmarshal([]byte(user.MFARecoveryCodes), &hashes); err != nil {
+		s.log.Error().Err(err).Sendf("invalid recovery codes of user %d", user.ID)
+		return "", false
+	}
+
+	hash := hashRecoveryCode(code)
+	for i, h := range hashes {
+		if h != hash {
+			continue
+		}
+
+		hashes = append(hashes[:i], hashes[i+1:]...)
+		bs, err := json.Marshal(hashes)
+		if err != nil {
+			return "", false
+		}
+
+		return string(bs), true
+	}
+
+	return "", false
+}
+
+func generateRecoveryCode() (string, error) {
+	// bytes above the largest multiple of the alphabet size are discarded to avoid modulo bias
+	limit := 256 - 256%len(recoveryCodeAlphabet)
+
+	code := make([]byte, 0, recoveryCodeLength+1)
+	b := make([]byte, 1)
+	for len(code) < recoveryCodeLength+1 {
+		if len(code) == recoveryCodeLength/2 {
+			code = append(code, '-')
+			continue
+		}
+
+		if _, err := rand.Read(b); err != nil {
+			return "", err
+		}
+
+		if int(b[0]) >= limit {
+			continue
+		}
+
+		code = append(code, recoveryCodeAlphabet[int(b[0])%len(recoveryCodeAlphabet)])
+	}
+
+	return string(code), nil
+}
+
+// hashRecoveryCode normalizes the code so it is accepted regardless of case, spaces and dashes
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(code)
+	normalized = strings.NewReplacer("-", "", " ", "").Replace(normalized)
+
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+func invalidCode() error {
+	return errors.NewInvalidArgument(domain.ErrInvalidMFACode).WithMessage("invalid authentication code")
+}
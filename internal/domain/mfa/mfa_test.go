@@ -0,0 +1,202 @@
+package mfa
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/pkg/errors"
+	"gitlab.com/evzpav/user-auth/pkg/log"
+	"gitlab.com/evzpav/user-auth/pkg/totp"
+)
+
+// fakeUserService keeps the MFA columns of the stored user, like the storages it uses them
+// atomically
+type fakeUserService struct {
+	domain.UserService
+	mu            sync.Mutex
+	updates       int
+	lastStep      int64
+	recoveryCodes string
+}
+
+func (f *fakeUserService) Update(ctx context.Context, user *domain.User) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.updates++
+	f.lastStep = user.TOTPLastStep
+	f.recoveryCodes = user.MFARecoveryCodes
+	return nil
+}
+
+func (f *fakeUserService) UseTOTPStep(ctx context.Context, userID int, step int64) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.lastStep >= step {
+		return false, nil
+	}
+
+	f.lastStep = step
+	return true, nil
+}
+
+func (f *fakeUserService) ReplaceRecoveryCodes(ctx context.Context, userID int, current, replacement string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.recoveryCodes != current {
+		return false, nil
+	}
+
+	f.recoveryCodes = replacement
+	return true, nil
+}
+
+var fixedNow = time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+
+func newTestService() (*service, *fakeUserService) {
+	users := &fakeUserService{}
+	s := NewService(users, "user-auth", log.NewZeroLog("", "", log.Error))
+	s.now = func() time.Time { return fixedNow }
+	return s, users
+}
+
+func codeAt(t *testing.T, secret string, at time.Time) string {
+	code, err := totp.Code(secret, totp.Step(at), totp.Digits)
+	require.NoError(t, err)
+	return code
+}
+
+func enrolledUser(t *testing.T, s *service) (*domain.User, []string) {
+	user := &domain.User{ID: 1, Email: "user@example.com"}
+
+	enrollment, err := s.BeginEnrollment(context.Background(), user)
+	require.NoError(t, err)
+
+	codes, err := s.ConfirmEnrollment(context.Background(), user, codeAt(t, enrollment.Secret, fixedNow))
+	require.NoError(t, err)
+
+	return user, codes
+}
+
+func TestService_Enrollment(t *testing.T) {
+	s, users := newTestService()
+	ctx := context.Background()
+	user := &domain.User{ID: 1, Email: "user@example.com"}
+
+	enrollment, err := s.BeginEnrollment(ctx, user)
+	require.NoError(t, err)
+	assert.Equal(t, enrollment.Secret, user.TOTPSecret)
+	assert.Contains(t, enrollment.URI, "otpauth://totp/user-auth:user@example.com")
+	assert.False(t, user.TOTPEnabled)
+
+	_, err = s.ConfirmEnrollment(ctx, user, "000000")
+	_, ok := errors.InvalidArgumentCast(err)
+	assert.True(t, ok)
+	assert.False(t, user.TOTPEnabled)
+
+	codes, err := s.ConfirmEnrollment(ctx, user, codeAt(t, enrollment.Secret, fixedNow))
+	require.NoError(t, err)
+	assert.True(t, user.TOTPEnabled)
+	assert.Len(t, codes, recoveryCodesCount)
+	assert.NotContains(t, user.MFARecoveryCodes, codes[0])
+	assert.Equal(t, 2, users.updates)
+
+	_, err = s.BeginEnrollment(ctx, user)
+	_, ok = errors.RuleNotSatisfiedCast(err)
+	assert.True(t, ok)
+}
+
+func TestService_VerifyTOTP(t *testing.T) {
+	s, _ := newTestService()
+	ctx := context.Background()
+	user, _ := enrolledUser(t, s)
+
+	// the enrollment code was already used in this time step
+	assert.Error(t, s.Verify(ctx, user, codeAt(t, user.TOTPSecret, fixedNow)))
+
+	s.now = func() time.Time { return fixedNow.Add(totp.Period) }
+	assert.NoError(t, s.Verify(ctx, user, codeAt(t, user.TOTPSecret, fixedNow.Add(totp.Period))))
+
+	// previous step is within the allowed skew but was already superseded
+	assert.Error(t, s.Verify(ctx, user, codeAt(t, user.TOTPSecret, fixedNow)))
+
+	s.now = func() time.Time { return fixedNow.Add(5 * totp.Period) }
+	assert.Error(t, s.Verify(ctx, user, codeAt(t, user.TOTPSecret, fixedNow.Add(2*totp.Period))))
+	assert.NoError(t, s.Verify(ctx, user, codeAt(t, user.TOTPSecret, fixedNow.Add(4*totp.Period))))
+}
+
+func TestService_RecoveryCodes(t *testing.T) {
+	s, _ := newTestService()
+	ctx := context.Background()
+	user, codes := enrolledUser(t, s)
+
+	assert.NoError(t, s.Verify(ctx, user, codes[0]))
+	assert.Error(t, s.Verify(ctx, user, codes[0]), "recovery codes are single use")
+
+	// case and separators are ignored
+	assert.NoError(t, s.Verify(ctx, user, " "+strings.ToUpper(codes[1])))
+
+	s.now = func() time.Time { return fixedNow.Add(totp.Period) }
+	regenerated, err := s.RegenerateRecoveryCodes(ctx, user, codeAt(t, user.TOTPSecret, fixedNow.Add(totp.Period)))
+	require.NoError(t, err)
+	assert.Len(t, regenerated, recoveryCodesCount)
+
+	assert.Error(t, s.Verify(ctx, user, codes[2]), "old codes are invalidated")
+	assert.NoError(t, s.Verify(ctx, user, regenerated[0]))
+}
+
+func TestService_Disable(t *testing.T) {
+	s, _ := newTestService()
+	ctx := context.Background()
+	user, codes := enrolledUser(t, s)
+
+	assert.Error(t, s.Disable(ctx, user, "123456"))
+	assert.True(t, user.TOTPEnabled)
+
+	require.NoError(t, s.Disable(ctx, user, codes[0]))
+	assert.False(t, user.TOTPEnabled)
+	assert.Empty(t, user.TOTPSecret)
+	assert.Empty(t, user.MFARecoveryCodes)
+
+	_, ok := errors.RuleNotSatisfiedCast(s.Verify(ctx, user, codes[1]))
+	assert.True(t, ok)
+}
+
+func TestService_VerifyConcurrentRequests(t *testing.T) {
+	s, _ := newTestService()
+	ctx := context.Background()
+	user, codes := enrolledUser(t, s)
+
+	s.now = func() time.Time { return fixedNow.Add(totp.Period) }
+	totpCode := codeAt(t, user.TOTPSecret, fixedNow.Add(totp.Period))
+
+	for _, code := range []string{totpCode, codes[0]} {
+		// every request loaded the user before any of them used the code
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		passed := 0
+		for i := 0; i < 2; i++ {
+			loaded := *user
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if s.Verify(ctx, &loaded, code) == nil {
+					mu.Lock()
+					passed++
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+
+		assert.Equal(t, 1, passed, "the code %q is used once", code)
+	}
+}
@@ -0,0 +1,241 @@
+package domain
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// token_type_hint values of RFC 7009, also the kinds of the stored tokens
+const (
+	OAuthAccessToken  = "access_token"
+	OAuthRefreshToken = "refresh_token"
+)
+
+// grant_type values supported by the token endpoint
+const (
+	OAuthGrantAuthorizationCode = "authorization_code"
+	OAuthGrantRefreshToken      = "refresh_token"
+	OAuthGrantClientCredentials = "client_credentials"
+)
+
+// OAuthClient is an application that signs its users in, or calls APIs on its own, through the
+// authorization server. Clients without a secret are public, e.g. single page and mobile apps.
+type OAuthClient struct {
+	ID           int    `json:"id"`
+	ClientID     string `json:"client_id"`
+	SecretHash   string `json:"-"`
+	Name         string `json:"name"`
+	RedirectURIs string `json:"redirect_uris"`
+	// PostLogoutRedirectURIs are where RP-initiated logout may send the user back to
+	PostLogoutRedirectURIs string    `json:"post_logout_redirect_uris"`
+	Scopes                 string    `json:"scopes"`
+	CreatedAt              time.Time `json:"created_at"`
+}
+
+func (c *OAuthClient) Confidential() bool {
+	return c.SecretHash != ""
+}
+
+// AllowsRedirectURI compares the URI with the registered ones exactly, as RFC 6819 recommends
+func (c *OAuthClient) AllowsRedirectURI(uri string) bool {
+	return fieldsInclude(c.RedirectURIs, uri)
+}
+
+// AllowsPostLogoutRedirectURI compares the URI with the registered ones exactly
+func (c *OAuthClient) AllowsPostLogoutRedirectURI(uri string) bool {
+	return fieldsInclude(c.PostLogoutRedirectURIs, uri)
+}
+
+func fieldsInclude(list, value string) bool {
+	for _, field := range strings.Fields(list) {
+		if field == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AllowsScope tells whether every scope of the space separated list was registered for the client
+func (c *OAuthClient) AllowsScope(scope string) bool {
+	return ScopeIncludes(c.Scopes, scope)
+}
+
+// ScopeIncludes tells whether every scope of the space separated list is in the granted ones
+func ScopeIncludes(granted, scope string) bool {
+	allowed := make(map[string]bool)
+	for _, s := range strings.Fields(granted) {
+		allowed[s] = true
+	}
+
+	for _, s := range strings.Fields(scope) {
+		if !allowed[s] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// OAuthAuthorizationCode is issued to the client after the user consented, it is exchanged once
+// for tokens. Only its hash is stored.
+type OAuthAuthorizationCode struct {
+	ID            int        `json:"id"`
+	CodeHash      string     `json:"-"`
+	ClientID      string     `json:"client_id"`
+	UserID        int        `json:"user_id"`
+	RedirectURI   string     `json:"redirect_uri"`
+	Scope         string     `json:"scope"`
+	CodeChallenge string     `json:"-"`
+	Nonce         string     `json:"-"`
+	FamilyID      string     `json:"-"`
+	CreatedAt     time.Time  `json:"created_at"`
+	ExpiresAt     time.Time  `json:"expires_at"`
+	UsedAt        *time.Time `json:"used_at"`
+}
+
+// OAuthToken is an access or refresh token issued to a client. Tokens of the client credentials
+// grant have no user. The tokens issued from one authorization code share the family and are
+// revoked together.
+type OAuthToken struct {
+	ID        int        `json:"id"`
+	TokenHash string     `json:"-"`
+	Kind      string     `json:"kind"`
+	ClientID  string     `json:"client_id"`
+	UserID    int        `json:"user_id"`
+	Scope     string     `json:"scope"`
+	FamilyID  string     `json:"family_id"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+}
+
+// Active tells whether the token can still be used
+func (t *OAuthToken) Active(now time.Time) bool {
+	return t.RevokedAt == nil && now.Before(t.ExpiresAt)
+}
+
+// OAuthConsent keeps the scopes a user granted to a client, later authorizations of the same
+// scopes skip the consent page
+type OAuthConsent struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id"`
+	ClientID  string    `json:"client_id"`
+	Scope     string    `json:"scope"`
+	GrantedAt time.Time `json:"granted_at"`
+}
+
+// OAuthAuthorizationRequest are the parameters of the authorization endpoint
+type OAuthAuthorizationRequest struct {
+	ClientID            string
+	RedirectURI         string
+	ResponseType        string
+	Scope               string
+	State               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	// Nonce is copied to the ID token so the client can tie it to its request
+	Nonce string
+}
+
+// OAuthTokenRequest are the parameters of the token endpoint, the client credentials come from the
+// Authorization header or the form
+type OAuthTokenRequest struct {
+	GrantType    string
+	ClientID     string
+	ClientSecret string
+	Code         string
+	RedirectURI  string
+	CodeVerifier string
+	RefreshToken string
+	Scope        string
+}
+
+type OAuthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+}
+
+// OAuthIntrospection is the response of RFC 7662, inactive tokens only have Active set
+type OAuthIntrospection struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Username  string `json:"username,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	Issuer    string `json:"iss,omitempty"`
+}
+
+// OAuthClientRegistration are the settings of a new client
+type OAuthClientRegistration struct {
+	Name                   string
+	RedirectURIs           []string
+	PostLogoutRedirectURIs []string
+	Scopes                 []string
+	Confidential           bool
+}
+
+type OAuthService interface {
+	// Client registry, the secret of confidential clients is only returned on registration
+	RegisterClient(ctx context.Context, registration *OAuthClientRegistration) (*OAuthClient, string, error)
+	Clients(ctx context.Context) ([]*OAuthClient, error)
+	DeleteClient(ctx context.Context, clientID string) error
+
+	// ValidateAuthorization checks the request and defaults its scope to the scopes of the client.
+	// The client is nil when the client or the redirect URI are invalid, the error must then be
+	// shown to the user instead of being redirected.
+	ValidateAuthorization(ctx context.Context, req *OAuthAuthorizationRequest) (*OAuthClient, error)
+	HasConsent(ctx context.Context, user *User, client *OAuthClient, scope string) (bool, error)
+	// Authorize records the consent of the user and returns the authorization code
+	Authorize(ctx context.Context, user *User, req *OAuthAuthorizationRequest) (string, error)
+
+	Token(ctx context.Context, req *OAuthTokenRequest) (*OAuthTokenResponse, error)
+	Revoke(ctx context.Context, clientID, clientSecret, token, tokenTypeHint string) error
+	Introspect(ctx context.Context, clientID, clientSecret, token string) (*OAuthIntrospection, error)
+
+	// OpenID Connect, only available when the service signs ID tokens
+	OpenIDConfiguration() *OpenIDConfiguration
+	// UserInfo returns the claims granted to an access token with the openid scope
+	UserInfo(ctx context.Context, accessToken string) (*OIDCUserInfo, error)
+	// ValidateLogout checks the ID token hint and that the post logout redirect URI is registered
+	// for the client
+	ValidateLogout(ctx context.Context, req *OIDCLogoutRequest) (*OIDCLogout, error)
+}
+
+type OAuthClientStorage interface {
+	// Insert fails with a duplicated record when the client ID is taken
+	Insert(ctx context.Context, client *OAuthClient) error
+	FindByClientID(ctx context.Context, clientID string) (*OAuthClient, error)
+	List(ctx context.Context) ([]*OAuthClient, error)
+	Delete(ctx context.Context, clientID string) error
+}
+
+type OAuthAuthorizationCodeStorage interface {
+	Insert(ctx context.Context, code *OAuthAuthorizationCode) error
+	FindByHash(ctx context.Context, hash string) (*OAuthAuthorizationCode, error)
+	MarkUsed(ctx context.Context, ID int, usedAt time.Time) (bool, error)
+}
+
+type OAuthTokenStorage interface {
+	Insert(ctx context.Context, token *OAuthToken) error
+	FindByHash(ctx context.Context, hash string) (*OAuthToken, error)
+	MarkUsed(ctx context.Context, ID int, usedAt time.Time) (bool, error)
+	Revoke(ctx context.Context, ID int, revokedAt time.Time) error
+	RevokeFamily(ctx context.Context, familyID string, revokedAt time.Time) error
+	RevokeByClientID(ctx context.Context, clientID string, revokedAt time.Time) error
+}
+
+type OAuthConsentStorage interface {
+	Find(ctx context.Context, userID int, clientID string) (*OAuthConsent, error)
+	// Save inserts the consent or replaces the scope of the existing one
+	Save(ctx context.Context, consent *OAuthConsent) error
+}
@@ -0,0 +1,135 @@
+package oauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/pkg/errors"
+)
+
+const (
+	responseTypeCode = "code"
+	// S256 is the only code challenge method accepted, plain would not protect the code
+	codeChallengeS256 = "S256"
+	// length of a base64url encoded SHA-256 hash
+	codeChallengeLength = 43
+
+	// RFC 7636 bounds of the code verifier
+	minCodeVerifierLength = 43
+	maxCodeVerifierLength = 128
+)
+
+// codeTTL is the time the client has to exchange an authorization code, RFC 6749 recommends at
+// most 10 minutes
+const codeTTL = time.Minute
+
+func (s *service) ValidateAuthorization(ctx context.Context, req *domain.OAuthAuthorizationRequest) (*domain.OAuthClient, error) {
+	client, err := s.clients.FindByClientID(ctx, req.ClientID)
+	if err != nil {
+		return nil, err
+	}
+
+	if client == nil {
+		return nil, errors.NewInvalidArgument(domain.ErrOAuthInvalidClient).WithMessage("unknown client")
+	}
+
+	if !client.AllowsRedirectURI(req.RedirectURI) {
+		return nil, errors.NewInvalidArgument(domain.ErrOAuthInvalidRequest).WithMessage("the redirect uri is not registered for the client")
+	}
+
+	if req.ResponseType != responseTypeCode {
+		return client, errors.NewInvalidArgument(domain.ErrOAuthUnsupportedResponseType).WithMessage("only the code response type is supported")
+	}
+
+	if req.CodeChallenge == "" {
+		return client, errors.NewInvalidArgument(domain.ErrOAuthInvalidRequest).WithMessage("code_challenge is required")
+	}
+
+	if req.CodeChallengeMethod != codeChallengeS256 || len(req.CodeChallenge) != codeChallengeLength {
+		return client, errors.NewInvalidArgument(domain.ErrOAuthInvalidRequest).WithMessage("only S256 code challenges are supported")
+	}
+
+	if req.Scope == "" {
+		req.Scope = client.Scopes
+	}
+
+	if !client.AllowsScope(req.Scope) {
+		return client, errors.NewInvalidArgument(domain.ErrOAuthInvalidScope).WithMessage("the scope is not allowed for the client")
+	}
+
+	req.Scope = normalizeScope(req.Scope)
+	return client, nil
+}
+
+func (s *service) HasConsent(ctx context.Context, user *domain.User, client *domain.OAuthClient, scope string) (bool, error) {
+	consent, err := s.consents.Find(ctx, user.ID, client.ClientID)
+	if err != nil {
+		return false, err
+	}
+
+	return consent != nil && domain.ScopeIncludes(consent.Scope, scope), nil
+}
+
+// Authorize expects a request checked by ValidateAuthorization. The consent keeps the scopes
+// granted before, so authorizing fewer scopes does not ask for the others again.
+func (s *service) Authorize(ctx context.Context, user *domain.User, req *domain.OAuthAuthorizationRequest) (string, error) {
+	granted := req.Scope
+	consent, err := s.consents.Find(ctx, user.ID, req.ClientID)
+	if err != nil {
+		return "", err
+	}
+
+	if consent != nil {
+		granted = normalizeScope(consent.Scope + " " + req.Scope)
+	}
+
+	now := s.now()
+	err = s.consents.Save(ctx, &domain.OAuthConsent{
+		UserID:    user.ID,
+		ClientID:  req.ClientID,
+		Scope:     granted,
+		GrantedAt: now,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	code, err := generateToken()
+	if err != nil {
+		return "", err
+	}
+
+	err = s.codes.Insert(ctx, &domain.OAuthAuthorizationCode{
+		CodeHash:      hashToken(code),
+		ClientID:      req.ClientID,
+		UserID:        user.ID,
+		RedirectURI:   req.RedirectURI,
+		Scope:         req.Scope,
+		CodeChallenge: req.CodeChallenge,
+		Nonce:         req.Nonce,
+		FamilyID:      uuid.NewV4().String(),
+		CreatedAt:     now,
+		ExpiresAt:     now.Add(codeTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return code, nil
+}
+
+// verifyCodeChallenge checks the verifier of RFC 7636 against the S256 challenge
+func verifyCodeChallenge(challenge, verifier string) bool {
+	if len(verifier) < minCodeVerifierLength || len(verifier) > maxCodeVerifierLength {
+		return false
+	}
+
+	sum := sha256.Sum256([]byte(verifier))
+	computed := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
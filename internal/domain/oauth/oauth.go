@@ -0,0 +1,216 @@
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"net/url"
+	"strings"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/pkg/errors"
+	"gitlab.com/evzpav/user-auth/pkg/log"
+)
+
+const (
+	defaultAccessTokenTTL  = time.Hour
+	defaultRefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+type Config struct {
+	// Issuer identifies the authorization server in the introspection responses and ID tokens, it
+	// is also the base URL of the discovery document
+	Issuer          string
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+}
+
+func (c Config) withDefaults() Config {
+	if c.AccessTokenTTL <= 0 {
+		c.AccessTokenTTL = defaultAccessTokenTTL
+	}
+
+	if c.RefreshTokenTTL <= 0 {
+		c.RefreshTokenTTL = defaultRefreshTokenTTL
+	}
+
+	return c
+}
+
+type service struct {
+	clients     domain.OAuthClientStorage
+	codes       domain.OAuthAuthorizationCodeStorage
+	tokens      domain.OAuthTokenStorage
+	consents    domain.OAuthConsentStorage
+	userService domain.UserService
+	signer      domain.TokenService
+	config      Config
+	now         func() time.Time
+	log         log.Logger
+}
+
+// NewService creates the authorization server. The signer is optional, without it the server is not
+// an OpenID Connect provider and issues no ID tokens.
+func NewService(clients domain.OAuthClientStorage, codes domain.OAuthAuthorizationCodeStorage, tokens domain.OAuthTokenStorage, consents domain.OAuthConsentStorage, userService domain.UserService, signer domain.TokenService, config Config, log log.Logger) *service {
+	return &service{
+		clients:     clients,
+		codes:       codes,
+		tokens:      tokens,
+		consents:    consents,
+		userService: userService,
+		signer:      signer,
+		config:      config.withDefaults(),
+		now:         time.Now,
+		log:         log,
+	}
+}
+
+// RegisterClient creates a client, confidential clients get a secret which is only returned here
+func (s *service) RegisterClient(ctx context.Context, registration *domain.OAuthClientRegistration) (*domain.OAuthClient, string, error) {
+	name := strings.TrimSpace(registration.Name)
+	if name == "" {
+		return nil, "", errors.NewInvalidArgument(domain.ErrOAuthInvalidRequest).WithMessage("the client name is required")
+	}
+
+	// public clients can only get tokens through the authorization endpoint
+	if !registration.Confidential && len(registration.RedirectURIs) == 0 {
+		return nil, "", errors.NewInvalidArgument(domain.ErrOAuthInvalidRequest).WithMessage("public clients need a redirect uri")
+	}
+
+	for _, redirectURIs := range [][]string{registration.RedirectURIs, registration.PostLogoutRedirectURIs} {
+		for _, redirectURI := range redirectURIs {
+			if err := validateRedirectURI(redirectURI); err != nil {
+				return nil, "", err
+			}
+		}
+	}
+
+	client := &domain.OAuthClient{
+		ClientID:               uuid.NewV4().String(),
+		Name:                   name,
+		RedirectURIs:           strings.Join(registration.RedirectURIs, " "),
+		PostLogoutRedirectURIs: strings.Join(registration.PostLogoutRedirectURIs, " "),
+		Scopes:                 normalizeScope(strings.Join(registration.Scopes, " ")),
+		CreatedAt:              s.now(),
+	}
+
+	var secret string
+	if registration.Confidential {
+		var err error
+		if secret, err = generateToken(); err != nil {
+			return nil, "", err
+		}
+
+		client.SecretHash = hashToken(secret)
+	}
+
+	if err := s.clients.Insert(ctx, client); err != nil {
+		return nil, "", err
+	}
+
+	return client, secret, nil
+}
+
+// validateRedirectURI accepts absolute URIs without fragment, native apps may use a custom scheme
+func validateRedirectURI(redirectURI string) error {
+	invalid := errors.NewInvalidArgument(domain.ErrOAuthInvalidRequest).WithMessage("invalid redirect uri " + redirectURI)
+
+	u, err := url.Parse(redirectURI)
+	if err != nil || !u.IsAbs() || u.Fragment != "" || strings.ContainsAny(redirectURI, " #") {
+		return invalid
+	}
+
+	if (u.Scheme == "http" || u.Scheme == "https") && u.Host == "" {
+		return invalid
+	}
+
+	return nil
+}
+
+func (s *service) Clients(ctx context.Context) ([]*domain.OAuthClient, error) {
+	return s.clients.List(ctx)
+}
+
+// DeleteClient removes the client and revokes the tokens issued to it
+func (s *service) DeleteClient(ctx context.Context, clientID string) error {
+	client, err := s.clients.FindByClientID(ctx, clientID)
+	if err != nil {
+		return err
+	}
+
+	if client == nil {
+		return errors.NewNotFound(domain.ErrOAuthInvalidClient).WithMessage("client not found")
+	}
+
+	if err := s.clients.Delete(ctx, clientID); err != nil {
+		return err
+	}
+
+	return s.tokens.RevokeByClientID(ctx, clientID, s.now())
+}
+
+// authenticateClient checks the secret of confidential clients, public clients only identify
+// themselves
+func (s *service) authenticateClient(ctx context.Context, clientID, clientSecret string) (*domain.OAuthClient, error) {
+	invalidClient := errors.NewNotAuthorized(domain.ErrOAuthInvalidClient).WithMessage("client authentication failed")
+
+	if clientID == "" {
+		return nil, invalidClient
+	}
+
+	client, err := s.clients.FindByClientID(ctx, clientID)
+	if err != nil {
+		return nil, err
+	}
+
+	if client == nil {
+		return nil, invalidClient
+	}
+
+	if !client.Confidential() {
+		if clientSecret != "" {
+			return nil, invalidClient
+		}
+
+		return client, nil
+	}
+
+	if subtle.ConstantTimeCompare([]byte(client.SecretHash), []byte(hashToken(clientSecret))) != 1 {
+		return nil, invalidClient
+	}
+
+	return client, nil
+}
+
+// normalizeScope removes the repeated and extra spaces of a space separated scope
+func normalizeScope(scope string) string {
+	seen := make(map[string]bool)
+	var scopes []string
+	for _, s := range strings.Fields(scope) {
+		if !seen[s] {
+			seen[s] = true
+			scopes = append(scopes, s)
+		}
+	}
+
+	return strings.Join(scopes, " ")
+}
+
+func generateToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,693 @@
+package oauth
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/pkg/errors"
+	"gitlab.com/evzpav/user-auth/pkg/jwt"
+	"gitlab.com/evzpav/user-auth/pkg/log"
+)
+
+const (
+	testRedirectURI = "https://app.example.com/callback"
+	testVerifier    = "dBjftJeZ4CVP-mJ0kS8hQm7Edq6Bt6NZ5C9zEtJ9Wv8a"
+	// S256 challenge of testVerifier
+	testChallenge = "jLLe2HqtaEdzlpaR7pzawLSWdf2-AR4N1-ScVH0M0ps"
+)
+
+type fakeUserService struct {
+	domain.UserService
+	users map[int]*domain.User
+}
+
+func (f *fakeUserService) FindByID(ctx context.Context, ID int) (*domain.User, error) {
+	return f.users[ID], nil
+}
+
+type fakeClients struct {
+	clients []*domain.OAuthClient
+}
+
+func (f *fakeClients) Insert(ctx context.Context, client *domain.OAuthClient) error {
+	client.ID = len(f.clients) + 1
+	f.clients = append(f.clients, client)
+	return nil
+}
+
+func (f *fakeClients) FindByClientID(ctx context.Context, clientID string) (*domain.OAuthClient, error) {
+	for _, c := range f.clients {
+		if c.ClientID == clientID {
+			copied := *c
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeClients) List(ctx context.Context) ([]*domain.OAuthClient, error) {
+	return f.clients, nil
+}
+
+func (f *fakeClients) Delete(ctx context.Context, clientID string) error {
+	for i, c := range f.clients {
+		if c.ClientID == clientID {
+			f.clients = append(f.clients[:i], f.clients[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+type fakeCodes struct {
+	codes []*domain.OAuthAuthorizationCode
+}
+
+func (f *fakeCodes) Insert(ctx context.Context, code *domain.OAuthAuthorizationCode) error {
+	code.ID = len(f.codes) + 1
+	f.codes = append(f.codes, code)
+	return nil
+}
+
+func (f *fakeCodes) FindByHash(ctx context.Context, hash string) (*domain.OAuthAuthorizationCode, error) {
+	for _, c := range f.codes {
+		if c.CodeHash == hash {
+			copied := *c
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeCodes) MarkUsed(ctx context.Context, ID int, usedAt time.Time) (bool, error) {
+	for _, c := range f.codes {
+		if c.ID == ID && c.UsedAt == nil {
+			c.UsedAt = &usedAt
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+type fakeTokens struct {
+	tokens []*domain.OAuthToken
+}
+
+func (f *fakeTokens) Insert(ctx context.Context, token *domain.OAuthToken) error {
+	token.ID = len(f.tokens) + 1
+	f.tokens = append(f.tokens, token)
+	return nil
+}
+
+func (f *fakeTokens) FindByHash(ctx context.Context, hash string) (*domain.OAuthToken, error) {
+	for _, t := range f.tokens {
+		if t.TokenHash == hash {
+			copied := *t
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeTokens) MarkUsed(ctx context.Context, ID int, usedAt time.Time) (bool, error) {
+	for _, t := range f.tokens {
+		if t.ID == ID && t.UsedAt == nil {
+			t.UsedAt = &usedAt
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (f *fakeTokens) revokeWhere(revokedAt time.Time, match func(*domain.OAuthToken) bool) error {
+	for _, t := range f.tokens {
+		if match(t) && t.RevokedAt == nil {
+			t.RevokedAt = &revokedAt
+		}
+	}
+	return nil
+}
+
+func (f *fakeTokens) Revoke(ctx context.Context, ID int, revokedAt time.Time) error {
+	return f.revokeWhere(revokedAt, func(t *domain.OAuthToken) bool { return t.ID == ID })
+}
+
+func (f *fakeTokens) RevokeFamily(ctx context.Context, familyID string, revokedAt time.Time) error {
+	return f.revokeWhere(revokedAt, func(t *domain.OAuthToken) bool { return t.FamilyID == familyID })
+}
+
+func (f *fakeTokens) RevokeByClientID(ctx context.Context, clientID string, revokedAt time.Time) error {
+	return f.revokeWhere(revokedAt, func(t *domain.OAuthToken) bool { return t.ClientID == clientID })
+}
+
+type fakeConsents struct {
+	consents []*domain.OAuthConsent
+}
+
+func (f *fakeConsents) Find(ctx context.Context, userID int, clientID string) (*domain.OAuthConsent, error) {
+	for _, c := range f.consents {
+		if c.UserID == userID && c.ClientID == clientID {
+			copied := *c
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeConsents) Save(ctx context.Context, consent *domain.OAuthConsent) error {
+	for _, c := range f.consents {
+		if c.UserID == consent.UserID && c.ClientID == consent.ClientID {
+			c.Scope = consent.Scope
+			return nil
+		}
+	}
+	f.consents = append(f.consents, consent)
+	return nil
+}
+
+// fakeSigner signs like the token service, with an ed25519 key
+type fakeSigner struct {
+	domain.TokenService
+	key  *jwt.Key
+	jwks *jwt.JWKS
+}
+
+func newFakeSigner(t *testing.T) *fakeSigner {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	key, err := jwt.NewKey("test", priv)
+	require.NoError(t, err)
+
+	jwks, err := jwt.NewJWKS(key)
+	require.NoError(t, err)
+
+	return &fakeSigner{key: key, jwks: jwks}
+}
+
+func (f *fakeSigner) JWKS() *jwt.JWKS {
+	return f.jwks
+}
+
+func (f *fakeSigner) Sign(claims interface{}) (string, error) {
+	return jwt.Sign(f.key, claims)
+}
+
+func (f *fakeSigner) VerifySignature(token string, claims interface{}) error {
+	return jwt.Verify(token, f.jwks.PublicKeys(), claims)
+}
+
+type testService struct {
+	*service
+	codes    *fakeCodes
+	tokens   *fakeTokens
+	consents *fakeConsents
+}
+
+func newTestService(t *testing.T) *testService {
+	ts := &testService{codes: &fakeCodes{}, tokens: &fakeTokens{}, consents: &fakeConsents{}}
+	verifiedAt := time.Unix(1500000000, 0)
+	users := &fakeUserService{users: map[int]*domain.User{7: {
+		ID:              7,
+		Email:           "user@example.com",
+		EmailVerifiedAt: &verifiedAt,
+		Name:            "Jane Doe",
+		Phone:           "+1 555 0100",
+		Address:         "1 Main Street, Springfield",
+	}}}
+
+	ts.service = NewService(&fakeClients{}, ts.codes, ts.tokens, ts.consents, users, newFakeSigner(t), Config{
+		Issuer:          "user-auth",
+		AccessTokenTTL:  time.Minute,
+		RefreshTokenTTL: time.Hour,
+	}, log.NewZeroLog("", "", log.Error))
+
+	now := time.Unix(1600000000, 0)
+	ts.now = func() time.Time { return now }
+
+	return ts
+}
+
+func assertCode(t *testing.T, err error, code errors.Code) {
+	describer, ok := errors.DescriberCast(err)
+	require.True(t, ok, "expected %s, got %v", code, err)
+	assert.Equal(t, code, describer.GetCode())
+}
+
+func (ts *testService) registerClient(t *testing.T, confidential bool) (*domain.OAuthClient, string) {
+	client, secret, err := ts.RegisterClient(context.Background(), &domain.OAuthClientRegistration{
+		Name:         "Billing",
+		RedirectURIs: []string{testRedirectURI},
+		Scopes:       []string{"profile", "email"},
+		Confidential: confidential,
+	})
+	require.NoError(t, err)
+
+	return client, secret
+}
+
+func authorizationRequest(clientID, scope string) *domain.OAuthAuthorizationRequest {
+	return &domain.OAuthAuthorizationRequest{
+		ClientID:            clientID,
+		RedirectURI:         testRedirectURI,
+		ResponseType:        "code",
+		Scope:               scope,
+		CodeChallenge:       testChallenge,
+		CodeChallengeMethod: "S256",
+	}
+}
+
+// authorize returns the code of an authorization of the user 7
+func (ts *testService) authorize(t *testing.T, clientID, scope string) string {
+	ctx := context.Background()
+	req := authorizationRequest(clientID, scope)
+	_, err := ts.ValidateAuthorization(ctx, req)
+	require.NoError(t, err)
+
+	code, err := ts.Authorize(ctx, &domain.User{ID: 7}, req)
+	require.NoError(t, err)
+
+	return code
+}
+
+func codeRequest(clientID, secret, code string) *domain.OAuthTokenRequest {
+	return &domain.OAuthTokenRequest{
+		GrantType:    domain.OAuthGrantAuthorizationCode,
+		ClientID:     clientID,
+		ClientSecret: secret,
+		Code:         code,
+		RedirectURI:  testRedirectURI,
+		CodeVerifier: testVerifier,
+	}
+}
+
+func TestService_RegisterClient(t *testing.T) {
+	ts := newTestService(t)
+	ctx := context.Background()
+
+	client, secret := ts.registerClient(t, true)
+	assert.NotEmpty(t, client.ClientID)
+	assert.NotEmpty(t, secret)
+	assert.Equal(t, hashToken(secret), client.SecretHash, "only the hash of the secret is stored")
+	assert.Equal(t, "profile email", client.Scopes)
+
+	public, secret := ts.registerClient(t, false)
+	assert.Empty(t, secret)
+	assert.False(t, public.Confidential())
+
+	_, _, err := ts.RegisterClient(ctx, &domain.OAuthClientRegistration{RedirectURIs: []string{testRedirectURI}, Confidential: true})
+	assertCode(t, err, domain.ErrOAuthInvalidRequest)
+
+	_, _, err = ts.RegisterClient(ctx, &domain.OAuthClientRegistration{Name: "Mobile"})
+	assertCode(t, err, domain.ErrOAuthInvalidRequest)
+
+	for _, uri := range []string{"/callback", "https://app.example.com/callback#fragment", "https:///callback"} {
+		_, _, err = ts.RegisterClient(ctx, &domain.OAuthClientRegistration{Name: "Billing", RedirectURIs: []string{uri}, Confidential: true})
+		assertCode(t, err, domain.ErrOAuthInvalidRequest)
+
+		_, _, err = ts.RegisterClient(ctx, &domain.OAuthClientRegistration{Name: "Billing", PostLogoutRedirectURIs: []string{uri}, Confidential: true})
+		assertCode(t, err, domain.ErrOAuthInvalidRequest)
+	}
+
+	// native apps redirect to a custom scheme
+	_, _, err = ts.RegisterClient(ctx, &domain.OAuthClientRegistration{Name: "Mobile", RedirectURIs: []string{"com.example.app:/callback"}})
+	assert.NoError(t, err)
+}
+
+func TestService_ValidateAuthorization(t *testing.T) {
+	ts := newTestService(t)
+	ctx := context.Background()
+	client, _ := ts.registerClient(t, true)
+
+	req := authorizationRequest(client.ClientID, "")
+	validated, err := ts.ValidateAuthorization(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, client.ClientID, validated.ClientID)
+	assert.Equal(t, "profile email", req.Scope, "the scope defaults to the scopes of the client")
+
+	req = authorizationRequest("unknown", "profile")
+	validated, err = ts.ValidateAuthorization(ctx, req)
+	assertCode(t, err, domain.ErrOAuthInvalidClient)
+	assert.Nil(t, validated)
+
+	req = authorizationRequest(client.ClientID, "profile")
+	req.RedirectURI = "https://app.example.com/other"
+	validated, err = ts.ValidateAuthorization(ctx, req)
+	assertCode(t, err, domain.ErrOAuthInvalidRequest)
+	assert.Nil(t, validated, "errors about the redirect uri must not be redirected")
+
+	req = authorizationRequest(client.ClientID, "profile admin")
+	validated, err = ts.ValidateAuthorization(ctx, req)
+	assertCode(t, err, domain.ErrOAuthInvalidScope)
+	assert.NotNil(t, validated)
+
+	req = authorizationRequest(client.ClientID, "profile")
+	req.CodeChallengeMethod = "plain"
+	_, err = ts.ValidateAuthorization(ctx, req)
+	assertCode(t, err, domain.ErrOAuthInvalidRequest)
+
+	req = authorizationRequest(client.ClientID, "profile")
+	req.ResponseType = "token"
+	_, err = ts.ValidateAuthorization(ctx, req)
+	assertCode(t, err, domain.ErrOAuthUnsupportedResponseType)
+}
+
+func TestService_Consent(t *testing.T) {
+	ts := newTestService(t)
+	ctx := context.Background()
+	client, _ := ts.registerClient(t, true)
+	user := &domain.User{ID: 7}
+
+	consented, err := ts.HasConsent(ctx, user, client, "profile")
+	require.NoError(t, err)
+	assert.False(t, consented)
+
+	ts.authorize(t, client.ClientID, "profile")
+	ts.authorize(t, client.ClientID, "email")
+
+	// the scopes granted before are kept
+	consented, err = ts.HasConsent(ctx, user, client, "email profile")
+	require.NoError(t, err)
+	assert.True(t, consented)
+}
+
+func TestService_ExchangeCode(t *testing.T) {
+	ts := newTestService(t)
+	ctx := context.Background()
+	client, secret := ts.registerClient(t, true)
+	other, otherSecret := ts.registerClient(t, true)
+
+	code := ts.authorize(t, client.ClientID, "profile")
+
+	_, err := ts.Token(ctx, codeRequest(other.ClientID, otherSecret, code))
+	assertCode(t, err, domain.ErrOAuthInvalidGrant)
+
+	req := codeRequest(client.ClientID, secret, code)
+	req.RedirectURI = "https://app.example.com/other"
+	_, err = ts.Token(ctx, req)
+	assertCode(t, err, domain.ErrOAuthInvalidGrant)
+
+	req = codeRequest(client.ClientID, secret, code)
+	req.CodeVerifier = "short"
+	_, err = ts.Token(ctx, req)
+	assertCode(t, err, domain.ErrOAuthInvalidGrant)
+
+	resp, err := ts.Token(ctx, codeRequest(client.ClientID, secret, code))
+	require.NoError(t, err)
+	assert.Equal(t, "profile", resp.Scope)
+	assert.Equal(t, 60, resp.ExpiresIn)
+	require.Len(t, ts.tokens.tokens, 2)
+	assert.Equal(t, ts.codes.codes[0].FamilyID, ts.tokens.tokens[0].FamilyID)
+
+	// a code presented again revokes the tokens issued with it
+	_, err = ts.Token(ctx, codeRequest(client.ClientID, secret, code))
+	assertCode(t, err, domain.ErrOAuthInvalidGrant)
+	for _, token := range ts.tokens.tokens {
+		assert.NotNil(t, token.RevokedAt)
+	}
+}
+
+func TestService_ExchangeExpiredCode(t *testing.T) {
+	ts := newTestService(t)
+	client, secret := ts.registerClient(t, true)
+	code := ts.authorize(t, client.ClientID, "profile")
+
+	ts.now = func() time.Time { return time.Unix(1600000000, 0).Add(codeTTL) }
+
+	_, err := ts.Token(context.Background(), codeRequest(client.ClientID, secret, code))
+	assertCode(t, err, domain.ErrOAuthInvalidGrant)
+}
+
+func TestService_Refresh(t *testing.T) {
+	ts := newTestService(t)
+	ctx := context.Background()
+	client, secret := ts.registerClient(t, true)
+	code := ts.authorize(t, client.ClientID, "profile email")
+
+	first, err := ts.Token(ctx, codeRequest(client.ClientID, secret, code))
+	require.NoError(t, err)
+
+	refresh := func(token, scope string) (*domain.OAuthTokenResponse, error) {
+		return ts.Token(ctx, &domain.OAuthTokenRequest{
+			GrantType:    domain.OAuthGrantRefreshToken,
+			ClientID:     client.ClientID,
+			ClientSecret: secret,
+			RefreshToken: token,
+			Scope:        scope,
+		})
+	}
+
+	_, err = refresh(first.AccessToken, "")
+	assertCode(t, err, domain.ErrOAuthInvalidGrant)
+
+	_, err = refresh(first.RefreshToken, "profile admin")
+	assertCode(t, err, domain.ErrOAuthInvalidScope)
+
+	// the scope can be narrowed
+	second, err := refresh(first.RefreshToken, "email")
+	require.NoError(t, err)
+	assert.Equal(t, "email", second.Scope)
+
+	// replaying the first token revokes the family, including the second token
+	_, err = refresh(first.RefreshToken, "")
+	assertCode(t, err, domain.ErrOAuthInvalidGrant)
+
+	_, err = refresh(second.RefreshToken, "")
+	assertCode(t, err, domain.ErrOAuthInvalidGrant)
+}
+
+func TestService_IntrospectAndRevoke(t *testing.T) {
+	ts := newTestService(t)
+	ctx := context.Background()
+	client, secret := ts.registerClient(t, true)
+	code := ts.authorize(t, client.ClientID, "profile")
+
+	resp, err := ts.Token(ctx, codeRequest(client.ClientID, secret, code))
+	require.NoError(t, err)
+
+	introspection, err := ts.Introspect(ctx, client.ClientID, secret, resp.AccessToken)
+	require.NoError(t, err)
+	assert.True(t, introspection.Active)
+	assert.Equal(t, "7", introspection.Subject)
+	assert.Equal(t, "user@example.com", introspection.Username)
+	assert.Equal(t, "Bearer", introspection.TokenType)
+	assert.Equal(t, "user-auth", introspection.Issuer)
+	assert.Equal(t, int64(1600000060), introspection.ExpiresAt)
+
+	_, err = ts.Introspect(ctx, client.ClientID, "wrong", resp.AccessToken)
+	assertCode(t, err, domain.ErrOAuthInvalidClient)
+
+	// tokens of other clients are not revoked
+	other, otherSecret := ts.registerClient(t, true)
+	require.NoError(t, ts.Revoke(ctx, other.ClientID, otherSecret, resp.AccessToken, ""))
+	introspection, err = ts.Introspect(ctx, client.ClientID, secret, resp.AccessToken)
+	require.NoError(t, err)
+	assert.True(t, introspection.Active)
+
+	require.NoError(t, ts.Revoke(ctx, client.ClientID, secret, resp.AccessToken, domain.OAuthAccessToken))
+	introspection, err = ts.Introspect(ctx, client.ClientID, secret, resp.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, &domain.OAuthIntrospection{Active: false}, introspection)
+
+	introspection, err = ts.Introspect(ctx, client.ClientID, secret, resp.RefreshToken)
+	require.NoError(t, err)
+	assert.True(t, introspection.Active, "revoking an access token keeps the refresh token")
+
+	// tokens expire
+	ts.now = func() time.Time { return time.Unix(1600000000, 0).Add(time.Hour) }
+	introspection, err = ts.Introspect(ctx, client.ClientID, secret, resp.RefreshToken)
+	require.NoError(t, err)
+	assert.False(t, introspection.Active)
+}
+
+func TestService_DeleteClient(t *testing.T) {
+	ts := newTestService(t)
+	ctx := context.Background()
+	client, secret := ts.registerClient(t, true)
+
+	_, err := ts.Token(ctx, &domain.OAuthTokenRequest{GrantType: domain.OAuthGrantClientCredentials, ClientID: client.ClientID, ClientSecret: secret})
+	require.NoError(t, err)
+
+	require.NoError(t, ts.DeleteClient(ctx, client.ClientID))
+	assert.NotNil(t, ts.tokens.tokens[0].RevokedAt)
+
+	err = ts.DeleteClient(ctx, client.ClientID)
+	_, ok := errors.NotFoundCast(err)
+	assert.True(t, ok)
+
+	_, err = ts.Token(ctx, &domain.OAuthTokenRequest{GrantType: domain.OAuthGrantClientCredentials, ClientID: client.ClientID, ClientSecret: secret})
+	assertCode(t, err, domain.ErrOAuthInvalidClient)
+}
+
+const testPostLogoutRedirectURI = "https://app.example.com/logged-out"
+
+func (ts *testService) registerOIDCClient(t *testing.T) (*domain.OAuthClient, string) {
+	client, secret, err := ts.RegisterClient(context.Background(), &domain.OAuthClientRegistration{
+		Name:                   "Billing",
+		RedirectURIs:           []string{testRedirectURI},
+		PostLogoutRedirectURIs: []string{testPostLogoutRedirectURI},
+		Scopes:                 []string{"openid", "profile", "email", "phone", "address"},
+		Confidential:           true,
+	})
+	require.NoError(t, err)
+
+	return client, secret
+}
+
+// exchangeOIDC authorizes the scope for the user 7 with a nonce and exchanges the code
+func (ts *testService) exchangeOIDC(t *testing.T, client *domain.OAuthClient, secret, scope string) *domain.OAuthTokenResponse {
+	ctx := context.Background()
+	req := authorizationRequest(client.ClientID, scope)
+	req.Nonce = "n-0S6_WzA2Mj"
+	_, err := ts.ValidateAuthorization(ctx, req)
+	require.NoError(t, err)
+
+	code, err := ts.Authorize(ctx, &domain.User{ID: 7}, req)
+	require.NoError(t, err)
+
+	resp, err := ts.Token(ctx, codeRequest(client.ClientID, secret, code))
+	require.NoError(t, err)
+
+	return resp
+}
+
+func TestService_IDToken(t *testing.T) {
+	ts := newTestService(t)
+	ctx := context.Background()
+	client, secret := ts.registerOIDCClient(t)
+
+	resp := ts.exchangeOIDC(t, client, secret, "openid profile email")
+	require.NotEmpty(t, resp.IDToken)
+
+	var claims domain.IDTokenClaims
+	require.NoError(t, ts.signer.VerifySignature(resp.IDToken, &claims))
+	assert.Equal(t, "user-auth", claims.Issuer)
+	assert.Equal(t, "7", claims.Subject)
+	assert.Equal(t, client.ClientID, claims.Audience)
+	assert.Equal(t, int64(1600000000+60), claims.ExpiresAt)
+	assert.Equal(t, "n-0S6_WzA2Mj", claims.Nonce)
+	assert.Equal(t, "Jane Doe", claims.Name)
+	assert.Equal(t, "user@example.com", claims.Email)
+	require.NotNil(t, claims.EmailVerified)
+	assert.True(t, *claims.EmailVerified)
+	assert.Empty(t, claims.PhoneNumber, "the phone scope was not granted")
+	assert.Nil(t, claims.Address)
+
+	refreshed, err := ts.Token(ctx, &domain.OAuthTokenRequest{
+		GrantType:    domain.OAuthGrantRefreshToken,
+		ClientID:     client.ClientID,
+		ClientSecret: secret,
+		RefreshToken: resp.RefreshToken,
+	})
+	require.NoError(t, err)
+	require.NotEmpty(t, refreshed.IDToken)
+
+	claims = domain.IDTokenClaims{}
+	require.NoError(t, ts.signer.VerifySignature(refreshed.IDToken, &claims))
+	assert.Equal(t, "7", claims.Subject)
+	assert.Empty(t, claims.Nonce, "refreshed ID tokens have no nonce")
+
+	// without the openid scope the client is not asking for an ID token
+	resp = ts.exchangeOIDC(t, client, secret, "profile")
+	assert.Empty(t, resp.IDToken)
+
+	// nor when the service cannot sign them
+	ts.signer = nil
+	resp = ts.exchangeOIDC(t, client, secret, "openid")
+	assert.Empty(t, resp.IDToken)
+}
+
+func TestService_UserInfo(t *testing.T) {
+	ts := newTestService(t)
+	ctx := context.Background()
+	client, secret := ts.registerOIDCClient(t)
+
+	resp := ts.exchangeOIDC(t, client, secret, "openid phone address")
+	userInfo, err := ts.UserInfo(ctx, resp.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, &domain.OIDCUserInfo{
+		Subject: "7",
+		OIDCUserClaims: domain.OIDCUserClaims{
+			PhoneNumber: "+1 555 0100",
+			Address:     &domain.OIDCAddress{Formatted: "1 Main Street, Springfield"},
+		},
+	}, userInfo)
+
+	_, err = ts.UserInfo(ctx, resp.RefreshToken)
+	assertCode(t, err, domain.ErrOAuthInvalidToken)
+
+	_, err = ts.UserInfo(ctx, "unknown")
+	assertCode(t, err, domain.ErrOAuthInvalidToken)
+
+	resp = ts.exchangeOIDC(t, client, secret, "profile")
+	_, err = ts.UserInfo(ctx, resp.AccessToken)
+	assertCode(t, err, domain.ErrOAuthInsufficientScope)
+
+	clientToken, err := ts.Token(ctx, &domain.OAuthTokenRequest{GrantType: domain.OAuthGrantClientCredentials, ClientID: client.ClientID, ClientSecret: secret})
+	require.NoError(t, err)
+	_, err = ts.UserInfo(ctx, clientToken.AccessToken)
+	assertCode(t, err, domain.ErrOAuthInvalidToken)
+}
+
+func TestService_ValidateLogout(t *testing.T) {
+	ts := newTestService(t)
+	ctx := context.Background()
+	client, secret := ts.registerOIDCClient(t)
+	idToken := ts.exchangeOIDC(t, client, secret, "openid").IDToken
+
+	// the hint is accepted after it expired
+	ts.now = func() time.Time { return time.Unix(1600000000, 0).Add(24 * time.Hour) }
+
+	logout, err := ts.ValidateLogout(ctx, &domain.OIDCLogoutRequest{
+		IDTokenHint:           idToken,
+		PostLogoutRedirectURI: testPostLogoutRedirectURI,
+		State:                 "af0ifjsldkj",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, &domain.OIDCLogout{UserID: 7, RedirectURI: testPostLogoutRedirectURI, State: "af0ifjsldkj"}, logout)
+
+	logout, err = ts.ValidateLogout(ctx, &domain.OIDCLogoutRequest{ClientID: client.ClientID, PostLogoutRedirectURI: testPostLogoutRedirectURI})
+	require.NoError(t, err)
+	assert.Equal(t, &domain.OIDCLogout{RedirectURI: testPostLogoutRedirectURI}, logout)
+
+	logout, err = ts.ValidateLogout(ctx, &domain.OIDCLogoutRequest{State: "ignored"})
+	require.NoError(t, err)
+	assert.Equal(t, &domain.OIDCLogout{}, logout)
+
+	for _, req := range []*domain.OIDCLogoutRequest{
+		{IDTokenHint: idToken + "x"},
+		{IDTokenHint: idToken, ClientID: "other"},
+		{PostLogoutRedirectURI: testPostLogoutRedirectURI},
+		{ClientID: client.ClientID, PostLogoutRedirectURI: testRedirectURI},
+	} {
+		_, err = ts.ValidateLogout(ctx, req)
+		assertCode(t, err, domain.ErrOAuthInvalidRequest)
+	}
+
+	_, err = ts.ValidateLogout(ctx, &domain.OIDCLogoutRequest{ClientID: "unknown", PostLogoutRedirectURI: testPostLogoutRedirectURI})
+	assertCode(t, err, domain.ErrOAuthInvalidClient)
+}
+
+func TestService_OpenIDConfiguration(t *testing.T) {
+	ts := newTestService(t)
+	ts.config.Issuer = "https://auth.example.com"
+
+	config := ts.OpenIDConfiguration()
+	require.NotNil(t, config)
+	assert.Equal(t, "https://auth.example.com", config.Issuer)
+	assert.Equal(t, "https://auth.example.com/oauth/authorize", config.AuthorizationEndpoint)
+	assert.Equal(t, "https://auth.example.com/userinfo", config.UserInfoEndpoint)
+	assert.Equal(t, "https://auth.example.com/.well-known/jwks.json", config.JWKSURI)
+	assert.Equal(t, "https://auth.example.com/oauth/logout", config.EndSessionEndpoint)
+	assert.Equal(t, []string{"EdDSA"}, config.IDTokenSigningAlgValuesSupported)
+	assert.Contains(t, config.ScopesSupported, "openid")
+
+	ts.signer = nil
+	assert.Nil(t, ts.OpenIDConfiguration())
+}
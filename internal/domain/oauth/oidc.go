@@ -0,0 +1,215 @@
+package oauth
+
+import (
+	"context"
+	"strconv"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/pkg/errors"
+	"gitlab.com/evzpav/user-auth/pkg/jwt"
+)
+
+// paths of the endpoints served by the HTTP handler, published in the discovery document
+const (
+	authorizationPath = "/oauth/authorize"
+	tokenPath         = "/oauth/token"
+	userInfoPath      = "/userinfo"
+	jwksPath          = "/.well-known/jwks.json"
+	endSessionPath    = "/oauth/logout"
+	revocationPath    = "/oauth/revoke"
+	introspectionPath = "/oauth/introspect"
+)
+
+// OpenIDConfiguration returns the discovery document, or nil when the service does not sign ID
+// tokens
+func (s *service) OpenIDConfiguration() *domain.OpenIDConfiguration {
+	if s.signer == nil {
+		return nil
+	}
+
+	var algorithms []string
+	seen := make(map[string]bool)
+	for _, key := range s.signer.JWKS().Keys {
+		if !seen[key.Algorithm] {
+			seen[key.Algorithm] = true
+			algorithms = append(algorithms, key.Algorithm)
+		}
+	}
+
+	issuer := s.config.Issuer
+	return &domain.OpenIDConfiguration{
+		Issuer:                           issuer,
+		AuthorizationEndpoint:            issuer + authorizationPath,
+		TokenEndpoint:                    issuer + tokenPath,
+		UserInfoEndpoint:                 issuer + userInfoPath,
+		JWKSURI:                          issuer + jwksPath,
+		EndSessionEndpoint:               issuer + endSessionPath,
+		RevocationEndpoint:               issuer + revocationPath,
+		IntrospectionEndpoint:            issuer + introspectionPath,
+		ResponseTypesSupported:           []string{responseTypeCode},
+		SubjectTypesSupported:            []string{"public"},
+		IDTokenSigningAlgValuesSupported: algorithms,
+		ScopesSupported: []string{
+			domain.OIDCScopeOpenID,
+			domain.OIDCScopeProfile,
+			domain.OIDCScopeEmail,
+			domain.OIDCScopePhone,
+			domain.OIDCScopeAddress,
+		},
+		ClaimsSupported: []string{
+			"iss", "sub", "aud", "exp", "iat", "nonce",
+			"name", "email", "email_verified", "phone_number", "address",
+		},
+		GrantTypesSupported: []string{
+			domain.OAuthGrantAuthorizationCode,
+			domain.OAuthGrantRefreshToken,
+			domain.OAuthGrantClientCredentials,
+		},
+		CodeChallengeMethodsSupported:     []string{codeChallengeS256},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+	}
+}
+
+// userClaims maps the profile of the user to the standard claims of the granted scopes
+func userClaims(user *domain.User, scope string) domain.OIDCUserClaims {
+	var claims domain.OIDCUserClaims
+
+	if domain.ScopeIncludes(scope, domain.OIDCScopeProfile) {
+		claims.Name = user.Name
+	}
+
+	if domain.ScopeIncludes(scope, domain.OIDCScopeEmail) {
+		verified := user.EmailVerified()
+		claims.Email = user.Email
+		claims.EmailVerified = &verified
+	}
+
+	if domain.ScopeIncludes(scope, domain.OIDCScopePhone) {
+		claims.PhoneNumber = user.Phone
+	}
+
+	if domain.ScopeIncludes(scope, domain.OIDCScopeAddress) && user.Address != "" {
+		claims.Address = &domain.OIDCAddress{Formatted: user.Address}
+	}
+
+	return claims
+}
+
+// addIDToken signs an ID token for the client when the openid scope was granted
+func (s *service) addIDToken(resp *domain.OAuthTokenResponse, client *domain.OAuthClient, user *domain.User, nonce string) error {
+	if s.signer == nil || !domain.ScopeIncludes(resp.Scope, domain.OIDCScopeOpenID) {
+		return nil
+	}
+
+	now := s.now()
+	idToken, err := s.signer.Sign(domain.IDTokenClaims{
+		Claims: jwt.Claims{
+			Issuer:    s.config.Issuer,
+			Subject:   strconv.Itoa(user.ID),
+			Audience:  client.ClientID,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(s.config.AccessTokenTTL).Unix(),
+		},
+		Nonce:          nonce,
+		OIDCUserClaims: userClaims(user, resp.Scope),
+	})
+	if err != nil {
+		return err
+	}
+
+	resp.IDToken = idToken
+	return nil
+}
+
+// UserInfo returns the claims of the user who granted the access token, the token must have the
+// openid scope
+func (s *service) UserInfo(ctx context.Context, accessToken string) (*domain.OIDCUserInfo, error) {
+	invalidToken := errors.NewNotAuthorized(domain.ErrOAuthInvalidToken).WithMessage("invalid access token")
+
+	if accessToken == "" {
+		return nil, invalidToken
+	}
+
+	token, err := s.tokens.FindByHash(ctx, hashToken(accessToken))
+	if err != nil {
+		return nil, err
+	}
+
+	if token == nil || token.Kind != domain.OAuthAccessToken || !token.Active(s.now()) || token.UserID == 0 {
+		return nil, invalidToken
+	}
+
+	if !domain.ScopeIncludes(token.Scope, domain.OIDCScopeOpenID) {
+		return nil, errors.NewRuleNotSatisfied(domain.ErrOAuthInsufficientScope).WithMessage("the openid scope is required")
+	}
+
+	user, err := s.userService.FindByID(ctx, token.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	if user == nil || !user.Active() {
+		return nil, invalidToken
+	}
+
+	return &domain.OIDCUserInfo{
+		Subject:        strconv.Itoa(user.ID),
+		OIDCUserClaims: userClaims(user, token.Scope),
+	}, nil
+}
+
+// ValidateLogout implements the checks of RP-initiated logout. The ID token hint may have
+// expired, it only identifies the user and the client.
+func (s *service) ValidateLogout(ctx context.Context, req *domain.OIDCLogoutRequest) (*domain.OIDCLogout, error) {
+	logout := &domain.OIDCLogout{}
+	clientID := req.ClientID
+
+	if req.IDTokenHint != "" {
+		invalidHint := errors.NewInvalidArgument(domain.ErrOAuthInvalidRequest).WithMessage("invalid id_token_hint")
+		if s.signer == nil {
+			return nil, invalidHint
+		}
+
+		var claims domain.IDTokenClaims
+		if err := s.signer.VerifySignature(req.IDTokenHint, &claims); err != nil {
+			return nil, invalidHint
+		}
+
+		userID, err := strconv.Atoi(claims.Subject)
+		if err != nil || claims.Issuer != s.config.Issuer {
+			return nil, invalidHint
+		}
+
+		if clientID != "" && clientID != claims.Audience {
+			return nil, errors.NewInvalidArgument(domain.ErrOAuthInvalidRequest).WithMessage("the id_token_hint was not issued to the client")
+		}
+
+		logout.UserID = userID
+		clientID = claims.Audience
+	}
+
+	if req.PostLogoutRedirectURI == "" {
+		return logout, nil
+	}
+
+	if clientID == "" {
+		return nil, errors.NewInvalidArgument(domain.ErrOAuthInvalidRequest).WithMessage("client_id or id_token_hint is required with post_logout_redirect_uri")
+	}
+
+	client, err := s.clients.FindByClientID(ctx, clientID)
+	if err != nil {
+		return nil, err
+	}
+
+	if client == nil {
+		return nil, errors.NewInvalidArgument(domain.ErrOAuthInvalidClient).WithMessage("unknown client")
+	}
+
+	if !client.AllowsPostLogoutRedirectURI(req.PostLogoutRedirectURI) {
+		return nil, errors.NewInvalidArgument(domain.ErrOAuthInvalidRequest).WithMessage("the post logout redirect uri is not registered for the client")
+	}
+
+	logout.RedirectURI = req.PostLogoutRedirectURI
+	logout.State = req.State
+	return logout, nil
+}
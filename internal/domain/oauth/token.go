@@ -0,0 +1,324 @@
+package oauth
+
+import (
+	"context"
+	"strconv"
+
+	uuid "github.com/satori/go.uuid"
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/pkg/errors"
+)
+
+const tokenType = "Bearer"
+
+func (s *service) Token(ctx context.Context, req *domain.OAuthTokenRequest) (*domain.OAuthTokenResponse, error) {
+	client, err := s.authenticateClient(ctx, req.ClientID, req.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	switch req.GrantType {
+	case domain.OAuthGrantAuthorizationCode:
+		return s.exchangeCode(ctx, client, req)
+	case domain.OAuthGrantRefreshToken:
+		return s.refresh(ctx, client, req)
+	case domain.OAuthGrantClientCredentials:
+		return s.clientCredentials(ctx, client, req)
+	}
+
+	return nil, errors.NewInvalidArgument(domain.ErrOAuthUnsupportedGrantType).WithMessage("unsupported grant type")
+}
+
+// exchangeCode redeems an authorization code once. A code presented again was probably stolen,
+// the tokens issued with it are revoked as RFC 6749 recommends.
+func (s *service) exchangeCode(ctx context.Context, client *domain.OAuthClient, req *domain.OAuthTokenRequest) (*domain.OAuthTokenResponse, error) {
+	invalidGrant := errors.NewInvalidArgument(domain.ErrOAuthInvalidGrant).WithMessage("invalid authorization code")
+
+	code, err := s.codes.FindByHash(ctx, hashToken(req.Code))
+	if err != nil {
+		return nil, err
+	}
+
+	if code == nil || code.ClientID != client.ClientID {
+		return nil, invalidGrant
+	}
+
+	now := s.now()
+	if code.UsedAt != nil {
+		return nil, s.revokeReusedFamily(ctx, code.FamilyID, "authorization code")
+	}
+
+	if !now.Before(code.ExpiresAt) || code.RedirectURI != req.RedirectURI {
+		return nil, invalidGrant
+	}
+
+	if !verifyCodeChallenge(code.CodeChallenge, req.CodeVerifier) {
+		return nil, errors.NewInvalidArgument(domain.ErrOAuthInvalidGrant).WithMessage("invalid code verifier")
+	}
+
+	marked, err := s.codes.MarkUsed(ctx, code.ID, now)
+	if err != nil {
+		return nil, err
+	}
+
+	// the code was redeemed concurrently
+	if !marked {
+		return nil, s.revokeReusedFamily(ctx, code.FamilyID, "authorization code")
+	}
+
+	user, err := s.userService.FindByID(ctx, code.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	if user == nil || !user.Active() {
+		return nil, invalidGrant
+	}
+
+	resp, err := s.issue(ctx, client, user.ID, code.Scope, code.FamilyID, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.addIDToken(resp, client, user, code.Nonce); err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// refresh rotates the refresh token, each one is used once and presenting a used one revokes the
+// whole family like the refresh tokens of the API
+func (s *service) refresh(ctx context.Context, client *domain.OAuthClient, req *domain.OAuthTokenRequest) (*domain.OAuthTokenResponse, error) {
+	invalidGrant := errors.NewInvalidArgument(domain.ErrOAuthInvalidGrant).WithMessage("invalid refresh token")
+
+	token, err := s.tokens.FindByHash(ctx, hashToken(req.RefreshToken))
+	if err != nil {
+		return nil, err
+	}
+
+	if token == nil || token.Kind != domain.OAuthRefreshToken || token.ClientID != client.ClientID {
+		return nil, invalidGrant
+	}
+
+	now := s.now()
+	if !token.Active(now) {
+		return nil, invalidGrant
+	}
+
+	if token.UsedAt != nil {
+		return nil, s.revokeReusedFamily(ctx, token.FamilyID, "refresh token")
+	}
+
+	// the new tokens can be restricted to fewer scopes, never more
+	scope := token.Scope
+	if req.Scope != "" {
+		if !domain.ScopeIncludes(token.Scope, req.Scope) {
+			return nil, errors.NewInvalidArgument(domain.ErrOAuthInvalidScope).WithMessage("the scope exceeds the granted scope")
+		}
+
+		scope = normalizeScope(req.Scope)
+	}
+
+	marked, err := s.tokens.MarkUsed(ctx, token.ID, now)
+	if err != nil {
+		return nil, err
+	}
+
+	if !marked {
+		return nil, s.revokeReusedFamily(ctx, token.FamilyID, "refresh token")
+	}
+
+	user, err := s.userService.FindByID(ctx, token.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	if user == nil || !user.Active() {
+		return nil, invalidGrant
+	}
+
+	resp, err := s.issue(ctx, client, user.ID, scope, token.FamilyID, true)
+	if err != nil {
+		return nil, err
+	}
+
+	// OpenID Connect Core 12.2: the refreshed ID token has no nonce
+	if err := s.addIDToken(resp, client, user, ""); err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// clientCredentials issues an access token to a confidential client acting on its own behalf,
+// without refresh token since the client can authenticate again
+func (s *service) clientCredentials(ctx context.Context, client *domain.OAuthClient, req *domain.OAuthTokenRequest) (*domain.OAuthTokenResponse, error) {
+	if !client.Confidential() {
+		return nil, errors.NewInvalidArgument(domain.ErrOAuthUnauthorizedClient).WithMessage("public clients cannot use the client credentials grant")
+	}
+
+	scope := client.Scopes
+	if req.Scope != "" {
+		if !client.AllowsScope(req.Scope) {
+			return nil, errors.NewInvalidArgument(domain.ErrOAuthInvalidScope).WithMessage("the scope is not allowed for the client")
+		}
+
+		scope = normalizeScope(req.Scope)
+	}
+
+	return s.issue(ctx, client, 0, scope, uuid.NewV4().String(), false)
+}
+
+func (s *service) revokeReusedFamily(ctx context.Context, familyID, kind string) error {
+	s.log.Warn().Sendf("oauth %s reuse detected, revoking token family %s", kind, familyID)
+
+	if err := s.tokens.RevokeFamily(ctx, familyID, s.now()); err != nil {
+		return err
+	}
+
+	return errors.NewInvalidArgument(domain.ErrOAuthInvalidGrant).WithMessage(kind + " already used")
+}
+
+// issue stores the hashes of a new access token and, for users, of a refresh token
+func (s *service) issue(ctx context.Context, client *domain.OAuthClient, userID int, scope, familyID string, withRefresh bool) (*domain.OAuthTokenResponse, error) {
+	now := s.now()
+
+	accessToken, err := s.insertToken(ctx, &domain.OAuthToken{
+		Kind:      domain.OAuthAccessToken,
+		ClientID:  client.ClientID,
+		UserID:    userID,
+		Scope:     scope,
+		FamilyID:  familyID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.config.AccessTokenTTL),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &domain.OAuthTokenResponse{
+		AccessToken: accessToken,
+		TokenType:   tokenType,
+		ExpiresIn:   int(s.config.AccessTokenTTL.Seconds()),
+		Scope:       scope,
+	}
+
+	if !withRefresh {
+		return resp, nil
+	}
+
+	resp.RefreshToken, err = s.insertToken(ctx, &domain.OAuthToken{
+		Kind:      domain.OAuthRefreshToken,
+		ClientID:  client.ClientID,
+		UserID:    userID,
+		Scope:     scope,
+		FamilyID:  familyID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.config.RefreshTokenTTL),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+func (s *service) insertToken(ctx context.Context, token *domain.OAuthToken) (string, error) {
+	value, err := generateToken()
+	if err != nil {
+		return "", err
+	}
+
+	token.TokenHash = hashToken(value)
+	if err := s.tokens.Insert(ctx, token); err != nil {
+		return "", err
+	}
+
+	return value, nil
+}
+
+// Revoke implements RFC 7009. Revoking a refresh token also revokes the access tokens of its
+// grant. Unknown tokens and tokens of other clients are ignored, so the response does not tell
+// whether they exist. The hint is not needed since every token is found by its hash.
+func (s *service) Revoke(ctx context.Context, clientID, clientSecret, token, tokenTypeHint string) error {
+	client, err := s.authenticateClient(ctx, clientID, clientSecret)
+	if err != nil {
+		return err
+	}
+
+	if token == "" {
+		return errors.NewInvalidArgument(domain.ErrOAuthInvalidRequest).WithMessage("token is required")
+	}
+
+	stored, err := s.tokens.FindByHash(ctx, hashToken(token))
+	if err != nil {
+		return err
+	}
+
+	if stored == nil || stored.ClientID != client.ClientID || stored.RevokedAt != nil {
+		return nil
+	}
+
+	if stored.Kind == domain.OAuthRefreshToken {
+		return s.tokens.RevokeFamily(ctx, stored.FamilyID, s.now())
+	}
+
+	return s.tokens.Revoke(ctx, stored.ID, s.now())
+}
+
+// Introspect implements RFC 7662 for resource servers, which authenticate as confidential clients
+func (s *service) Introspect(ctx context.Context, clientID, clientSecret, token string) (*domain.OAuthIntrospection, error) {
+	client, err := s.authenticateClient(ctx, clientID, clientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	if !client.Confidential() {
+		return nil, errors.NewNotAuthorized(domain.ErrOAuthInvalidClient).WithMessage("only confidential clients can introspect tokens")
+	}
+
+	if token == "" {
+		return nil, errors.NewInvalidArgument(domain.ErrOAuthInvalidRequest).WithMessage("token is required")
+	}
+
+	stored, err := s.tokens.FindByHash(ctx, hashToken(token))
+	if err != nil {
+		return nil, err
+	}
+
+	inactive := &domain.OAuthIntrospection{Active: false}
+	if stored == nil || !stored.Active(s.now()) || stored.UsedAt != nil {
+		return inactive, nil
+	}
+
+	introspection := &domain.OAuthIntrospection{
+		Active:    true,
+		Scope:     stored.Scope,
+		ClientID:  stored.ClientID,
+		ExpiresAt: stored.ExpiresAt.Unix(),
+		IssuedAt:  stored.CreatedAt.Unix(),
+		Issuer:    s.config.Issuer,
+	}
+
+	if stored.Kind == domain.OAuthAccessToken {
+		introspection.TokenType = tokenType
+	}
+
+	if stored.UserID == 0 {
+		return introspection, nil
+	}
+
+	user, err := s.userService.FindByID(ctx, stored.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	if user == nil || !user.Active() {
+		return inactive, nil
+	}
+
+	introspection.Subject = strconv.Itoa(user.ID)
+	introspection.Username = user.Email
+	return introspection, nil
+}
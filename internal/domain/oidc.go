@@ -0,0 +1,76 @@
+package domain
+
+import "gitlab.com/evzpav/user-auth/pkg/jwt"
+
+// scopes of OpenID Connect, openid asks for an ID token and the others for the claims of the user
+const (
+	OIDCScopeOpenID  = "openid"
+	OIDCScopeProfile = "profile"
+	OIDCScopeEmail   = "email"
+	OIDCScopePhone   = "phone"
+	OIDCScopeAddress = "address"
+)
+
+// OIDCAddress is the address claim, the profile keeps the address as a single text
+type OIDCAddress struct {
+	Formatted string `json:"formatted"`
+}
+
+// OIDCUserClaims are the standard claims of the user, each one is only set when its scope was
+// granted
+type OIDCUserClaims struct {
+	Name          string       `json:"name,omitempty"`
+	Email         string       `json:"email,omitempty"`
+	EmailVerified *bool        `json:"email_verified,omitempty"`
+	PhoneNumber   string       `json:"phone_number,omitempty"`
+	Address       *OIDCAddress `json:"address,omitempty"`
+}
+
+// IDTokenClaims are the claims of the ID tokens, the audience is the client ID
+type IDTokenClaims struct {
+	jwt.Claims
+	Nonce string `json:"nonce,omitempty"`
+	OIDCUserClaims
+}
+
+// OIDCUserInfo is the response of the userinfo endpoint
+type OIDCUserInfo struct {
+	Subject string `json:"sub"`
+	OIDCUserClaims
+}
+
+// OIDCLogoutRequest are the parameters of RP-initiated logout
+type OIDCLogoutRequest struct {
+	IDTokenHint           string
+	ClientID              string
+	PostLogoutRedirectURI string
+	State                 string
+}
+
+// OIDCLogout is a validated logout request. UserID is the subject of the ID token hint, or 0
+// without hint. RedirectURI is empty when the client did not ask to be redirected.
+type OIDCLogout struct {
+	UserID      int
+	RedirectURI string
+	State       string
+}
+
+// OpenIDConfiguration is the discovery document of OpenID Connect Discovery 1.0
+type OpenIDConfiguration struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserInfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	EndSessionEndpoint                string   `json:"end_session_endpoint"`
+	RevocationEndpoint                string   `json:"revocation_endpoint"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+}
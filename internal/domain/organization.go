@@ -0,0 +1,147 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// OrgRole is the role of a member in an organization
+type OrgRole string
+
+const (
+	// OrgRoleOwner is held by a single member, who may do anything including handing the
+	// ownership over
+	OrgRoleOwner OrgRole = "owner"
+	// OrgRoleAdmin may invite and remove members
+	OrgRoleAdmin  OrgRole = "admin"
+	OrgRoleMember OrgRole = "member"
+)
+
+// OrgRoles lists the roles invitations may grant, the ownership is only ever transferred
+var OrgRoles = []OrgRole{OrgRoleAdmin, OrgRoleMember}
+
+// Valid tells whether the role can be granted by an invitation
+func (r OrgRole) Valid() bool {
+	for _, role := range OrgRoles {
+		if r == role {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CanManageMembers tells whether the role may invite and remove members
+func (r OrgRole) CanManageMembers() bool {
+	return r == OrgRoleOwner || r == OrgRoleAdmin
+}
+
+type Organization struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type OrgMembership struct {
+	OrganizationID int       `json:"organization_id"`
+	UserID         int       `json:"user_id"`
+	Role           OrgRole   `json:"role"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// OrgMember is a membership with the user holding it
+type OrgMember struct {
+	*OrgMembership
+	User *User
+}
+
+// UserOrganization is an organization seen by one of its members
+type UserOrganization struct {
+	ID   int     `json:"id"`
+	Name string  `json:"name"`
+	Role OrgRole `json:"role"`
+}
+
+// OrgInvitation invites an email address to join an organization, it is accepted by the user
+// signed in with that address
+type OrgInvitation struct {
+	ID             int        `json:"id"`
+	OrganizationID int        `json:"organization_id"`
+	Email          string     `json:"email"`
+	Role           OrgRole    `json:"role"`
+	InvitedBy      int        `json:"invited_by"`
+	CreatedAt      time.Time  `json:"created_at"`
+	ExpiresAt      time.Time  `json:"expires_at"`
+	AcceptedAt     *time.Time `json:"accepted_at"`
+	RevokedAt      *time.Time `json:"revoked_at"`
+}
+
+func (i *OrgInvitation) Validate() error {
+	if !validateEmail(i.Email) {
+		return fmt.Errorf("invalid email")
+	}
+
+	if !i.Role.Valid() {
+		return fmt.Errorf("invalid role")
+	}
+
+	return nil
+}
+
+// Pending tells whether the invitation can still be accepted
+func (i *OrgInvitation) Pending(now time.Time) bool {
+	return i.AcceptedAt == nil && i.RevokedAt == nil && now.Before(i.ExpiresAt)
+}
+
+// OrganizationService manages the organizations, the actor of each change must be a member
+// allowed to make it
+type OrganizationService interface {
+	// Create creates an organization owned by the user
+	Create(ctx context.Context, user *User, name string) (*UserOrganization, error)
+	List(ctx context.Context, userID int) ([]*UserOrganization, error)
+	// Membership returns the organization of a member, it fails with a not found error for the
+	// other users
+	Membership(ctx context.Context, organizationID, userID int) (*UserOrganization, error)
+	// DefaultOrganization returns the organization the user joined first, nil when none
+	DefaultOrganization(ctx context.Context, userID int) (*UserOrganization, error)
+	Members(ctx context.Context, actor *User, organizationID int) ([]*OrgMember, error)
+	// Invite emails a signed link to join the organization with the role, only owners invite
+	// admins
+	Invite(ctx context.Context, actor *User, organizationID int, email string, role OrgRole) (*OrgInvitation, error)
+	Invitations(ctx context.Context, actor *User, organizationID int) ([]*OrgInvitation, error)
+	RevokeInvitation(ctx context.Context, actor *User, organizationID, invitationID int) error
+	// Invitation returns the pending invitation of a link with its organization
+	Invitation(ctx context.Context, token string) (*OrgInvitation, *Organization, error)
+	// AcceptInvitation makes the user a member, the user must be signed in with the invited email
+	AcceptInvitation(ctx context.Context, user *User, token string) (*UserOrganization, error)
+	// RemoveMember removes a member, members may remove themselves except the owner
+	RemoveMember(ctx context.Context, actor *User, organizationID, userID int) error
+	// TransferOwnership makes another member the owner, the previous owner becomes an admin
+	TransferOwnership(ctx context.Context, actor *User, organizationID, userID int) error
+}
+
+type OrganizationStorage interface {
+	// Insert creates the organization with its owner membership
+	Insert(ctx context.Context, organization *Organization, owner *OrgMembership) error
+	FindByID(ctx context.Context, ID int) (*Organization, error)
+	FindMembership(ctx context.Context, organizationID, userID int) (*OrgMembership, error)
+	// FindMembers returns the members of the organization in the order they joined
+	FindMembers(ctx context.Context, organizationID int) ([]*OrgMembership, error)
+	// FindMemberships returns the memberships of the user in the order they joined
+	FindMemberships(ctx context.Context, userID int) ([]*OrgMembership, error)
+	InsertMembership(ctx context.Context, membership *OrgMembership) error
+	DeleteMembership(ctx context.Context, organizationID, userID int) (bool, error)
+	// TransferOwnership makes the member the owner and the owner an admin at once
+	TransferOwnership(ctx context.Context, organizationID, ownerID, userID int) error
+}
+
+type OrgInvitationStorage interface {
+	Insert(ctx context.Context, invitation *OrgInvitation) error
+	FindByID(ctx context.Context, ID int) (*OrgInvitation, error)
+	// FindPending returns the invitations of the organization not accepted, revoked or expired
+	FindPending(ctx context.Context, organizationID int, now time.Time) ([]*OrgInvitation, error)
+	// Accept marks the invitation accepted, false when it was accepted or revoked already
+	Accept(ctx context.Context, ID int, acceptedAt time.Time) (bool, error)
+	Revoke(ctx context.Context, organizationID, ID int, revokedAt time.Time) (bool, error)
+}
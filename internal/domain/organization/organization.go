@@ -0,0 +1,525 @@
+package organization
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/pkg/errors"
+	"gitlab.com/evzpav/user-auth/pkg/log"
+)
+
+const defaultInvitationTTL = 7 * 24 * time.Hour
+
+const maxNameLength = 100
+
+// Config configures the invitation links. Key signs the links, changing it invalidates the links
+// already sent.
+type Config struct {
+	Key []byte
+	TTL time.Duration
+}
+
+func (c Config) withDefaults(log log.Logger) Config {
+	if c.TTL <= 0 {
+		c.TTL = defaultInvitationTTL
+	}
+
+	if len(c.Key) == 0 {
+		c.Key = make([]byte, 32)
+		if _, err := rand.Read(c.Key); err != nil {
+			log.Fatal().Err(err).Sendf("failed to generate invitation key: %v", err)
+		}
+		log.Warn().Sendf("no invitation key configured, invitations sent before a restart will not be valid")
+	}
+
+	return c
+}
+
+type service struct {
+	storage       domain.OrganizationStorage
+	invitations   domain.OrgInvitationStorage
+	userService   domain.UserService
+	mailer        domain.Mailer
+	emailRenderer domain.EmailRenderer
+	platformURL   string
+	config        Config
+	now           func() time.Time
+	log           log.Logger
+}
+
+func NewService(storage domain.OrganizationStorage, invitations domain.OrgInvitationStorage, userService domain.UserService, mailer domain.Mailer, emailRenderer domain.EmailRenderer, platformURL string, config Config, log log.Logger) *service {
+	return &service{
+		storage:       storage,
+		invitations:   invitations,
+		userService:   userService,
+		mailer:        mailer,
+		emailRenderer: emailRenderer,
+		platformURL:   platformURL,
+		config:        config.withDefaults(log),
+		now:           time.Now,
+		log:           log,
+	}
+}
+
+func (s *service) Create(ctx context.Context, user *domain.User, name string) (*domain.UserOrganization, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > maxNameLength {
+		return nil, errors.NewInvalidArgument(domain.ErrInvalidOrgName).WithMessage("the name is required and at most 100 characters")
+	}
+
+	now := s.now().UTC()
+	organization := &domain.Organization{Name: name, CreatedAt: now}
+	owner := &domain.OrgMembership{UserID: user.ID, Role: domain.OrgRoleOwner, CreatedAt: now}
+
+	if err := s.storage.Insert(ctx, organization, owner); err != nil {
+		return nil, err
+	}
+
+	s.log.Info().Sendf("user %d created organization %d", user.ID, organization.ID)
+	return userOrganization(organization, owner), nil
+}
+
+func (s *service) List(ctx context.Context, userID int) ([]*domain.UserOrganization, error) {
+	memberships, err := s.storage.FindMemberships(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	organizations := make([]*domain.UserOrganization, 0, len(memberships))
+	for _, membership := range memberships {
+		organization, err := s.storage.FindByID(ctx, membership.OrganizationID)
+		if err != nil {
+			return nil, err
+		}
+
+		if organization != nil {
+			organizations = append(organizations, userOrganization(organization, membership))
+		}
+	}
+
+	return organizations, nil
+}
+
+func (s *service) Membership(ctx context.Context, organizationID, userID int) (*domain.UserOrganization, error) {
+	membership, err := s.member(ctx, organizationID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	organization, err := s.storage.FindByID(ctx, organizationID)
+	if err != nil {
+		return nil, err
+	}
+
+	if organization == nil {
+		return nil, errors.NewNotFound(domain.ErrOrgNotFound).WithMessage("organization not found")
+	}
+
+	return userOrganization(organization, membership), nil
+}
+
+func (s *service) DefaultOrganization(ctx context.Context, userID int) (*domain.UserOrganization, error) {
+	organizations, err := s.List(ctx, userID)
+	if err != nil || len(organizations) == 0 {
+		return nil, err
+	}
+
+	return organizations[0], nil
+}
+
+func (s *service) Members(ctx context.Context, actor *domain.User, organizationID int) ([]*domain.OrgMember, error) {
+	if _, err := s.member(ctx, organizationID, actor.ID); err != nil {
+		return nil, err
+	}
+
+	memberships, err := s.storage.FindMembers(ctx, organizationID)
+	if err != nil {
+		return nil, err
+	}
+
+	members := make([]*domain.OrgMember, 0, len(memberships))
+	for _, membership := range memberships {
+		user, err := s.userService.FindByID(ctx, membership.UserID)
+		if err != nil {
+			return nil, err
+		}
+
+		if user != nil {
+			members = append(members, &domain.OrgMember{OrgMembership: membership, User: user})
+		}
+	}
+
+	return members, nil
+}
+
+// Invite stores the invitation and emails its link. Links are signed so they cannot be guessed,
+// the stored invitation makes them single use and revocable.
+func (s *service) Invite(ctx context.Context, actor *domain.User, organizationID int, email string, role domain.OrgRole) (*domain.OrgInvitation, error) {
+	membership, err := s.manager(ctx, organizationID, actor.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if role == domain.OrgRoleAdmin && membership.Role != domain.OrgRoleOwner {
+		return nil, errors.NewRuleNotSatisfied(domain.ErrPermissionDenied).WithMessage("only the owner invites admins")
+	}
+
+	if !role.Valid() {
+		return nil, errors.NewInvalidArgument(domain.ErrInvalidOrgRole).WithMessage("invitations grant the admin or the member role")
+	}
+
+	now := s.now().UTC()
+	invitation := &domain.OrgInvitation{
+		OrganizationID: organizationID,
+		Email:          strings.TrimSpace(email),
+		Role:           role,
+		InvitedBy:      actor.ID,
+		CreatedAt:      now,
+		ExpiresAt:      now.Add(s.config.TTL),
+	}
+
+	if err := invitation.Validate(); err != nil {
+		return nil, errors.NewInvalidArgument(domain.ErrInvalidEmail).WithMessage(err.Error())
+	}
+
+	invited, err := s.userService.FindByEmail(ctx, invitation.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	if invited != nil {
+		existing, err := s.storage.FindMembership(ctx, organizationID, invited.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		if existing != nil {
+			return nil, errors.NewDuplicatedRecord(domain.ErrAlreadyMember).WithMessage("already a member")
+		}
+	}
+
+	organization, err := s.storage.FindByID(ctx, organizationID)
+	if err != nil {
+		return nil, err
+	}
+
+	if organization == nil {
+		return nil, errors.NewNotFound(domain.ErrOrgNotFound).WithMessage("organization not found")
+	}
+
+	if err := s.invitations.Insert(ctx, invitation); err != nil {
+		return nil, err
+	}
+
+	inviter := actor.Name
+	if inviter == "" {
+		inviter = actor.Email
+	}
+
+	data := struct {
+		Organization string
+		Inviter      string
+		Role         domain.OrgRole
+		Email        string
+		Link         string
+		ExpiresAt    time.Time
+	}{
+		Organization: organization.Name,
+		Inviter:      inviter,
+		Role:         invitation.Role,
+		Email:        invitation.Email,
+		Link:         fmt.Sprintf("%s/invitations/accept?token=%s", s.platformURL, s.invitationToken(invitation)),
+		ExpiresAt:    invitation.ExpiresAt,
+	}
+
+	if err := s.sendEmail(ctx, invitation.Email, "org_invitation", data); err != nil {
+		return nil, err
+	}
+
+	s.log.Info().Sendf("user %d invited %s to organization %d", actor.ID, invitation.Email, organizationID)
+	return invitation, nil
+}
+
+func (s *service) Invitations(ctx context.Context, actor *domain.User, organizationID int) ([]*domain.OrgInvitation, error) {
+	if _, err := s.manager(ctx, organizationID, actor.ID); err != nil {
+		return nil, err
+	}
+
+	return s.invitations.FindPending(ctx, organizationID, s.now().UTC())
+}
+
+func (s *service) RevokeInvitation(ctx context.Context, actor *domain.User, organizationID, invitationID int) error {
+	if _, err := s.manager(ctx, organizationID, actor.ID); err != nil {
+		return err
+	}
+
+	revoked, err := s.invitations.Revoke(ctx, organizationID, invitationID, s.now().UTC())
+	if err != nil {
+		return err
+	}
+
+	if !revoked {
+		return errors.NewNotFound(domain.ErrInvitationNotFound).WithMessage("invitation not found")
+	}
+
+	s.log.Info().Sendf("user %d revoked invitation %d of organization %d", actor.ID, invitationID, organizationID)
+	return nil
+}
+
+func (s *service) Invitation(ctx context.Context, token string) (*domain.OrgInvitation, *domain.Organization, error) {
+	invalidLink := errors.NewInvalidArgument(domain.ErrInvalidLink).WithMessage("invalid or expired invitation")
+
+	invitationID, ok := s.parseInvitationToken(token)
+	if !ok {
+		return nil, nil, invalidLink
+	}
+
+	invitation, err := s.invitations.FindByID(ctx, invitationID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if invitation == nil || !invitation.Pending(s.now()) {
+		return nil, nil, invalidLink
+	}
+
+	organization, err := s.storage.FindByID(ctx, invitation.OrganizationID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if organization == nil {
+		return nil, nil, invalidLink
+	}
+
+	return invitation, organization, nil
+}
+
+func (s *service) AcceptInvitation(ctx context.Context, user *domain.User, token string) (*domain.UserOrganization, error) {
+	invitation, organization, err := s.Invitation(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.EqualFold(invitation.Email, user.Email) {
+		return nil, errors.NewRuleNotSatisfied(domain.ErrInvitationEmail).WithMessage("the invitation was sent to another email, sign in with " + invitation.Email)
+	}
+
+	existing, err := s.storage.FindMembership(ctx, organization.ID, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if existing != nil {
+		return nil, errors.NewDuplicatedRecord(domain.ErrAlreadyMember).WithMessage("already a member")
+	}
+
+	now := s.now().UTC()
+	accepted, err := s.invitations.Accept(ctx, invitation.ID, now)
+	if err != nil {
+		return nil, err
+	}
+
+	// someone else accepted the same link concurrently
+	if !accepted {
+		return nil, errors.NewInvalidArgument(domain.ErrInvalidLink).WithMessage("invalid or expired invitation")
+	}
+
+	membership := &domain.OrgMembership{
+		OrganizationID: organization.ID,
+		UserID:         user.ID,
+		Role:           invitation.Role,
+		CreatedAt:      now,
+	}
+
+	if err := s.storage.InsertMembership(ctx, membership); err != nil {
+		return nil, err
+	}
+
+	s.log.Info().Sendf("user %d joined organization %d as %s", user.ID, organization.ID, membership.Role)
+	return userOrganization(organization, membership), nil
+}
+
+// RemoveMember lets the owner remove anyone, the admins remove the members and anyone leave. The
+// owner has to transfer the ownership before leaving.
+func (s *service) RemoveMember(ctx context.Context, actor *domain.User, organizationID, userID int) error {
+	membership, err := s.member(ctx, organizationID, actor.ID)
+	if err != nil {
+		return err
+	}
+
+	target, err := s.storage.FindMembership(ctx, organizationID, userID)
+	if err != nil {
+		return err
+	}
+
+	if target == nil {
+		return errors.NewNotFound(domain.ErrMemberNotFound).WithMessage("member not found")
+	}
+
+	if target.Role == domain.OrgRoleOwner {
+		return errors.NewRuleNotSatisfied(domain.ErrOwnerMembership).WithMessage("transfer the ownership before removing the owner")
+	}
+
+	if userID != actor.ID && !canRemove(membership.Role, target.Role) {
+		return errors.NewRuleNotSatisfied(domain.ErrPermissionDenied).WithMessage("not allowed to remove this member")
+	}
+
+	deleted, err := s.storage.DeleteMembership(ctx, organizationID, userID)
+	if err != nil {
+		return err
+	}
+
+	if !deleted {
+		return errors.NewNotFound(domain.ErrMemberNotFound).WithMessage("member not found")
+	}
+
+	s.log.Info().Sendf("user %d removed user %d from organization %d", actor.ID, userID, organizationID)
+	return nil
+}
+
+func (s *service) TransferOwnership(ctx context.Context, actor *domain.User, organizationID, userID int) error {
+	membership, err := s.member(ctx, organizationID, actor.ID)
+	if err != nil {
+		return err
+	}
+
+	if membership.Role != domain.OrgRoleOwner {
+		return errors.NewRuleNotSatisfied(domain.ErrPermissionDenied).WithMessage("only the owner transfers the ownership")
+	}
+
+	if userID == actor.ID {
+		return errors.NewRuleNotSatisfied(domain.ErrOwnerMembership).WithMessage("already the owner")
+	}
+
+	target, err := s.storage.FindMembership(ctx, organizationID, userID)
+	if err != nil {
+		return err
+	}
+
+	if target == nil {
+		return errors.NewNotFound(domain.ErrMemberNotFound).WithMessage("member not found")
+	}
+
+	if err := s.storage.TransferOwnership(ctx, organizationID, actor.ID, userID); err != nil {
+		return err
+	}
+
+	s.log.Info().Sendf("user %d transferred the ownership of organization %d to user %d", actor.ID, organizationID, userID)
+	return nil
+}
+
+// member returns the membership of the user, other users are told the organization does not exist
+func (s *service) member(ctx context.Context, organizationID, userID int) (*domain.OrgMembership, error) {
+	membership, err := s.storage.FindMembership(ctx, organizationID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if membership == nil {
+		return nil, errors.NewNotFound(domain.ErrOrgNotFound).WithMessage("organization not found")
+	}
+
+	return membership, nil
+}
+
+// manager returns the membership of a user allowed to invite and remove members
+func (s *service) manager(ctx context.Context, organizationID, userID int) (*domain.OrgMembership, error) {
+	membership, err := s.member(ctx, organizationID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !membership.Role.CanManageMembers() {
+		return nil, errors.NewRuleNotSatisfied(domain.ErrPermissionDenied).WithMessage("only the owner and the admins manage the members")
+	}
+
+	return membership, nil
+}
+
+func canRemove(actor, target domain.OrgRole) bool {
+	switch actor {
+	case domain.OrgRoleOwner:
+		return true
+	case domain.OrgRoleAdmin:
+		return target == domain.OrgRoleMember
+	}
+
+	return false
+}
+
+func userOrganization(organization *domain.Organization, membership *domain.OrgMembership) *domain.UserOrganization {
+	return &domain.UserOrganization{
+		ID:   organization.ID,
+		Name: organization.Name,
+		Role: membership.Role,
+	}
+}
+
+func (s *service) sendEmail(ctx context.Context, to, templateName string, data interface{}) error {
+	email, err := s.emailRenderer.RenderEmail(templateName, data)
+	if err != nil {
+		return err
+	}
+
+	email.To = to
+
+	return s.mailer.Send(ctx, email)
+}
+
+// invitationToken signs the invitation id and its expiration, the invitation itself stays the
+// source of truth for whether it can still be accepted
+func (s *service) invitationToken(invitation *domain.OrgInvitation) string {
+	payload := []byte(strconv.Itoa(invitation.ID) + ":" + strconv.FormatInt(invitation.ExpiresAt.Unix(), 10))
+
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(s.sign(payload))
+}
+
+func (s *service) parseInvitationToken(token string) (int, bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return 0, false
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return 0, false
+	}
+
+	mac, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(mac, s.sign(payload)) {
+		return 0, false
+	}
+
+	fields := strings.SplitN(string(payload), ":", 2)
+	if len(fields) != 2 {
+		return 0, false
+	}
+
+	invitationID, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return 0, false
+	}
+
+	expiresAt, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil || s.now().Unix() >= expiresAt {
+		return 0, false
+	}
+
+	return invitationID, true
+}
+
+func (s *service) sign(payload []byte) []byte {
+	mac := hmac.New(sha256.New, s.config.Key)
+	mac.Write([]byte("org-invitation:"))
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,469 @@
+package organization
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/pkg/errors"
+	"gitlab.com/evzpav/user-auth/pkg/log"
+)
+
+type fakeStorage struct {
+	organizations []*domain.Organization
+	memberships   []*domain.OrgMembership
+}
+
+func (f *fakeStorage) Insert(ctx context.Context, organization *domain.Organization, owner *domain.OrgMembership) error {
+	organization.ID = len(f.organizations) + 1
+	f.organizations = append(f.organizations, organization)
+	owner.OrganizationID = organization.ID
+	return f.InsertMembership(ctx, owner)
+}
+
+func (f *fakeStorage) FindByID(ctx context.Context, ID int) (*domain.Organization, error) {
+	for _, organization := range f.organizations {
+		if organization.ID == ID {
+			return organization, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (f *fakeStorage) FindMembership(ctx context.Context, organizationID, userID int) (*domain.OrgMembership, error) {
+	for _, membership := range f.memberships {
+		if membership.OrganizationID == organizationID && membership.UserID == userID {
+			copied := *membership
+			return &copied, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (f *fakeStorage) FindMembers(ctx context.Context, organizationID int) ([]*domain.OrgMembership, error) {
+	var memberships []*domain.OrgMembership
+	for _, membership := range f.memberships {
+		if membership.OrganizationID == organizationID {
+			memberships = append(memberships, membership)
+		}
+	}
+
+	return memberships, nil
+}
+
+func (f *fakeStorage) FindMemberships(ctx context.Context, userID int) ([]*domain.OrgMembership, error) {
+	var memberships []*domain.OrgMembership
+	for _, membership := range f.memberships {
+		if membership.UserID == userID {
+			memberships = append(memberships, membership)
+		}
+	}
+
+	return memberships, nil
+}
+
+func (f *fakeStorage) InsertMembership(ctx context.Context, membership *domain.OrgMembership) error {
+	stored := *membership
+	f.memberships = append(f.memberships, &stored)
+	return nil
+}
+
+func (f *fakeStorage) DeleteMembership(ctx context.Context, organizationID, userID int) (bool, error) {
+	for i, membership := range f.memberships {
+		if membership.OrganizationID == organizationID && membership.UserID == userID {
+			f.memberships = append(f.memberships[:i], f.memberships[i+1:]...)
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (f *fakeStorage) TransferOwnership(ctx context.Context, organizationID, ownerID, userID int) error {
+	for _, membership := range f.memberships {
+		if membership.OrganizationID != organizationID {
+			continue
+		}
+
+		switch membership.UserID {
+		case ownerID:
+			membership.Role = domain.OrgRoleAdmin
+		case userID:
+			membership.Role = domain.OrgRoleOwner
+		}
+	}
+
+	return nil
+}
+
+type fakeInvitations struct {
+	invitations []*domain.OrgInvitation
+}
+
+func (f *fakeInvitations) Insert(ctx context.Context, invitation *domain.OrgInvitation) error {
+	invitation.ID = len(f.invitations) + 1
+	stored := *invitation
+	f.invitations = append(f.invitations, &stored)
+	return nil
+}
+
+func (f *fakeInvitations) FindByID(ctx context.Context, ID int) (*domain.OrgInvitation, error) {
+	for _, invitation := range f.invitations {
+		if invitation.ID == ID {
+			copied := *invitation
+			return &copied, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (f *fakeInvitations) FindPending(ctx context.Context, organizationID int, now time.Time) ([]*domain.OrgInvitation, error) {
+	var invitations []*domain.OrgInvitation
+	for _, invitation := range f.invitations {
+		if invitation.OrganizationID == organizationID && invitation.Pending(now) {
+			invitations = append(invitations, invitation)
+		}
+	}
+
+	return invitations, nil
+}
+
+func (f *fakeInvitations) Accept(ctx context.Context, ID int, acceptedAt time.Time) (bool, error) {
+	for _, invitation := range f.invitations {
+		if invitation.ID == ID && invitation.AcceptedAt == nil && invitation.RevokedAt == nil {
+			invitation.AcceptedAt = &acceptedAt
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (f *fakeInvitations) Revoke(ctx context.Context, organizationID, ID int, revokedAt time.Time) (bool, error) {
+	for _, invitation := range f.invitations {
+		if invitation.ID == ID && invitation.OrganizationID == organizationID && invitation.AcceptedAt == nil && invitation.RevokedAt == nil {
+			invitation.RevokedAt = &revokedAt
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+type fakeUserService struct {
+	domain.UserService
+	users map[int]*domain.User
+}
+
+func (f *fakeUserService) FindByID(ctx context.Context, ID int) (*domain.User, error) {
+	return f.users[ID], nil
+}
+
+func (f *fakeUserService) FindByEmail(ctx context.Context, email string) (*domain.User, error) {
+	for _, user := range f.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+
+	return nil, nil
+}
+
+type fakeMailer struct {
+	emails []*domain.Email
+}
+
+func (f *fakeMailer) Send(ctx context.Context, email *domain.Email) error {
+	f.emails = append(f.emails, email)
+	return nil
+}
+
+// fakeRenderer puts the link of the template data in the text body
+type fakeRenderer struct{}
+
+func (fakeRenderer) RenderEmail(name string, data interface{}) (*domain.Email, error) {
+	link := reflect.ValueOf(data).FieldByName("Link").String()
+	return &domain.Email{Subject: name, Text: link}, nil
+}
+
+var (
+	owner  = &domain.User{ID: 1, Email: "owner@example.com"}
+	admin  = &domain.User{ID: 2, Email: "admin@example.com"}
+	member = &domain.User{ID: 3, Email: "member@example.com"}
+	other  = &domain.User{ID: 4, Email: "other@example.com"}
+)
+
+func newTestService() *service {
+	users := map[int]*domain.User{owner.ID: owner, admin.ID: admin, member.ID: member, other.ID: other}
+	return NewService(&fakeStorage{}, &fakeInvitations{}, &fakeUserService{users: users}, &fakeMailer{}, fakeRenderer{}, "http://localhost", Config{Key: []byte("key")}, log.NewZeroLog("", "", log.Error))
+}
+
+// newTestOrganization creates an organization of owner with admin and member already in
+func newTestOrganization(t *testing.T, s *service) int {
+	ctx := context.Background()
+
+	organization, err := s.Create(ctx, owner, "Acme")
+	require.NoError(t, err)
+
+	for _, membership := range []*domain.OrgMembership{
+		{OrganizationID: organization.ID, UserID: admin.ID, Role: domain.OrgRoleAdmin},
+		{OrganizationID: organization.ID, UserID: member.ID, Role: domain.OrgRoleMember},
+	} {
+		require.NoError(t, s.storage.InsertMembership(ctx, membership))
+	}
+
+	return organization.ID
+}
+
+// inviteToken invites the email and returns the token of the link sent
+func inviteToken(t *testing.T, s *service, actor *domain.User, organizationID int, email string, role domain.OrgRole) string {
+	t.Helper()
+
+	_, err := s.Invite(context.Background(), actor, organizationID, email, role)
+	require.NoError(t, err)
+
+	emails := s.mailer.(*fakeMailer).emails
+	sent := emails[len(emails)-1]
+	assert.Equal(t, email, sent.To)
+	assert.Equal(t, "org_invitation", sent.Subject)
+
+	prefix := "http://localhost/invitations/accept?token="
+	require.True(t, strings.HasPrefix(sent.Text, prefix))
+	return strings.TrimPrefix(sent.Text, prefix)
+}
+
+func assertCode(t *testing.T, err error, code errors.Code) {
+	t.Helper()
+
+	describer, ok := errors.DescriberCast(err)
+	require.True(t, ok, "expected %s, got %v", code, err)
+	assert.Equal(t, code, describer.GetCode())
+}
+
+func TestService_Create(t *testing.T) {
+	s := newTestService()
+	ctx := context.Background()
+
+	_, err := s.Create(ctx, owner, "  ")
+	assertCode(t, err, domain.ErrInvalidOrgName)
+
+	first, err := s.Create(ctx, owner, " Acme ")
+	require.NoError(t, err)
+	assert.Equal(t, "Acme", first.Name)
+	assert.Equal(t, domain.OrgRoleOwner, first.Role)
+
+	_, err = s.Create(ctx, owner, "Globex")
+	require.NoError(t, err)
+
+	organizations, err := s.List(ctx, owner.ID)
+	require.NoError(t, err)
+	require.Len(t, organizations, 2)
+	assert.Equal(t, "Globex", organizations[1].Name)
+
+	defaultOrganization, err := s.DefaultOrganization(ctx, owner.ID)
+	require.NoError(t, err)
+	assert.Equal(t, first, defaultOrganization)
+
+	defaultOrganization, err = s.DefaultOrganization(ctx, other.ID)
+	require.NoError(t, err)
+	assert.Nil(t, defaultOrganization)
+
+	_, err = s.Membership(ctx, first.ID, other.ID)
+	assertCode(t, err, domain.ErrOrgNotFound)
+}
+
+func TestService_Members(t *testing.T) {
+	s := newTestService()
+	ctx := context.Background()
+	organizationID := newTestOrganization(t, s)
+
+	members, err := s.Members(ctx, member, organizationID)
+	require.NoError(t, err)
+	require.Len(t, members, 3)
+	assert.Equal(t, owner, members[0].User)
+	assert.Equal(t, domain.OrgRoleOwner, members[0].Role)
+
+	_, err = s.Members(ctx, other, organizationID)
+	assertCode(t, err, domain.ErrOrgNotFound)
+}
+
+func TestService_Invite(t *testing.T) {
+	s := newTestService()
+	ctx := context.Background()
+	organizationID := newTestOrganization(t, s)
+
+	tests := []struct {
+		name  string
+		actor *domain.User
+		email string
+		role  domain.OrgRole
+		code  errors.Code
+	}{
+		{name: "not a member", actor: other, email: "new@example.com", role: domain.OrgRoleMember, code: domain.ErrOrgNotFound},
+		{name: "member", actor: member, email: "new@example.com", role: domain.OrgRoleMember, code: domain.ErrPermissionDenied},
+		{name: "admin inviting an admin", actor: admin, email: "new@example.com", role: domain.OrgRoleAdmin, code: domain.ErrPermissionDenied},
+		{name: "owner role", actor: owner, email: "new@example.com", role: domain.OrgRoleOwner, code: domain.ErrInvalidOrgRole},
+		{name: "invalid email", actor: owner, email: "new", role: domain.OrgRoleMember, code: domain.ErrInvalidEmail},
+		{name: "already a member", actor: owner, email: member.Email, role: domain.OrgRoleMember, code: domain.ErrAlreadyMember},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.Invite(ctx, tt.actor, organizationID, tt.email, tt.role)
+			assertCode(t, err, tt.code)
+		})
+	}
+
+	assert.Empty(t, s.mailer.(*fakeMailer).emails)
+
+	inviteToken(t, s, admin, organizationID, "new@example.com", domain.OrgRoleMember)
+	inviteToken(t, s, owner, organizationID, "boss@example.com", domain.OrgRoleAdmin)
+
+	invitations, err := s.Invitations(ctx, admin, organizationID)
+	require.NoError(t, err)
+	require.Len(t, invitations, 2)
+
+	_, err = s.Invitations(ctx, member, organizationID)
+	assertCode(t, err, domain.ErrPermissionDenied)
+
+	require.NoError(t, s.RevokeInvitation(ctx, owner, organizationID, invitations[0].ID))
+	assertCode(t, s.RevokeInvitation(ctx, owner, organizationID, invitations[0].ID), domain.ErrInvitationNotFound)
+
+	invitations, err = s.Invitations(ctx, owner, organizationID)
+	require.NoError(t, err)
+	require.Len(t, invitations, 1)
+	assert.Equal(t, "boss@example.com", invitations[0].Email)
+}
+
+func TestService_AcceptInvitation(t *testing.T) {
+	s := newTestService()
+	ctx := context.Background()
+	organizationID := newTestOrganization(t, s)
+
+	token := inviteToken(t, s, owner, organizationID, other.Email, domain.OrgRoleAdmin)
+
+	invitation, organization, err := s.Invitation(ctx, token)
+	require.NoError(t, err)
+	assert.Equal(t, other.Email, invitation.Email)
+	assert.Equal(t, "Acme", organization.Name)
+
+	_, err = s.AcceptInvitation(ctx, member, token)
+	assertCode(t, err, domain.ErrInvitationEmail)
+
+	accepted, err := s.AcceptInvitation(ctx, &domain.User{ID: other.ID, Email: "OTHER@example.com"}, token)
+	require.NoError(t, err)
+	assert.Equal(t, &domain.UserOrganization{ID: organizationID, Name: "Acme", Role: domain.OrgRoleAdmin}, accepted)
+
+	// links are single use
+	_, err = s.AcceptInvitation(ctx, other, token)
+	assertCode(t, err, domain.ErrInvalidLink)
+}
+
+func TestService_AcceptInvitationRejected(t *testing.T) {
+	s := newTestService()
+	ctx := context.Background()
+	organizationID := newTestOrganization(t, s)
+	now := time.Now()
+	s.now = func() time.Time { return now }
+
+	token := inviteToken(t, s, owner, organizationID, other.Email, domain.OrgRoleMember)
+
+	tests := []struct {
+		name  string
+		token string
+		setup func()
+	}{
+		{name: "empty", token: ""},
+		{name: "malformed", token: "abc"},
+		{name: "tampered", token: "x" + token},
+		{name: "other key", token: token, setup: func() { s.config.Key = []byte("other") }},
+		{name: "expired", token: token, setup: func() { s.now = func() time.Time { return now.Add(defaultInvitationTTL) } }},
+		{name: "revoked", token: token, setup: func() {
+			require.NoError(t, s.RevokeInvitation(ctx, owner, organizationID, 1))
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, clock := s.config.Key, s.now
+			defer func() { s.config.Key, s.now = key, clock }()
+
+			if tt.setup != nil {
+				tt.setup()
+			}
+
+			_, err := s.AcceptInvitation(ctx, other, tt.token)
+			assertCode(t, err, domain.ErrInvalidLink)
+		})
+	}
+}
+
+func TestService_RemoveMember(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name   string
+		actor  *domain.User
+		userID int
+		code   errors.Code
+	}{
+		{name: "owner removes an admin", actor: owner, userID: admin.ID},
+		{name: "admin removes a member", actor: admin, userID: member.ID},
+		{name: "member leaves", actor: member, userID: member.ID},
+		{name: "admin leaves", actor: admin, userID: admin.ID},
+		{name: "member removes an admin", actor: member, userID: admin.ID, code: domain.ErrPermissionDenied},
+		{name: "admin removes the owner", actor: admin, userID: owner.ID, code: domain.ErrOwnerMembership},
+		{name: "owner leaves", actor: owner, userID: owner.ID, code: domain.ErrOwnerMembership},
+		{name: "unknown member", actor: owner, userID: other.ID, code: domain.ErrMemberNotFound},
+		{name: "not a member", actor: other, userID: member.ID, code: domain.ErrOrgNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService()
+			organizationID := newTestOrganization(t, s)
+
+			err := s.RemoveMember(ctx, tt.actor, organizationID, tt.userID)
+			if tt.code != "" {
+				assertCode(t, err, tt.code)
+				return
+			}
+
+			require.NoError(t, err)
+			_, err = s.Membership(ctx, organizationID, tt.userID)
+			assertCode(t, err, domain.ErrOrgNotFound)
+		})
+	}
+}
+
+func TestService_TransferOwnership(t *testing.T) {
+	s := newTestService()
+	ctx := context.Background()
+	organizationID := newTestOrganization(t, s)
+
+	assertCode(t, s.TransferOwnership(ctx, admin, organizationID, member.ID), domain.ErrPermissionDenied)
+	assertCode(t, s.TransferOwnership(ctx, owner, organizationID, owner.ID), domain.ErrOwnerMembership)
+	assertCode(t, s.TransferOwnership(ctx, owner, organizationID, other.ID), domain.ErrMemberNotFound)
+
+	require.NoError(t, s.TransferOwnership(ctx, owner, organizationID, member.ID))
+
+	membership, err := s.Membership(ctx, organizationID, member.ID)
+	require.NoError(t, err)
+	assert.Equal(t, domain.OrgRoleOwner, membership.Role)
+
+	membership, err = s.Membership(ctx, organizationID, owner.ID)
+	require.NoError(t, err)
+	assert.Equal(t, domain.OrgRoleAdmin, membership.Role)
+
+	// the previous owner can leave now
+	require.NoError(t, s.RemoveMember(ctx, owner, organizationID, owner.ID))
+}
@@ -0,0 +1,278 @@
+package passkey
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/pkg/errors"
+	"gitlab.com/evzpav/user-auth/pkg/log"
+	"gitlab.com/evzpav/user-auth/pkg/webauthn"
+)
+
+const (
+	defaultName   = "Passkey"
+	maxNameLength = 50
+)
+
+type service struct {
+	rp           *webauthn.RelyingParty
+	storage      domain.WebAuthnCredentialStorage
+	challenges   domain.WebAuthnChallengeStorage
+	userService  domain.UserService
+	now          func() time.Time
+	newChallenge func() (string, error)
+	log          log.Logger
+}
+
+func NewService(rp *webauthn.RelyingParty, storage domain.WebAuthnCredentialStorage, challenges domain.WebAuthnChallengeStorage, userService domain.UserService, log log.Logger) *service {
+	return &service{
+		rp:           rp,
+		storage:      storage,
+		challenges:   challenges,
+		userService:  userService,
+		now:          time.Now,
+		newChallenge: webauthn.NewChallenge,
+		log:          log,
+	}
+}
+
+// BeginRegistration returns the options to create a new credential for the user. The credentials
+// the user already has are excluded so an authenticator is not registered twice.
+func (s *service) BeginRegistration(ctx context.Context, user *domain.User) (*webauthn.CreationOptions, string, error) {
+	challenge, nonce, err := s.beginCeremony(ctx, domain.WebAuthnRegistration, user.ID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	credentials, err := s.storage.FindByUserID(ctx, user.ID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	exclude := make([][]byte, 0, len(credentials))
+	for _, credential := range credentials {
+		id, err := webauthn.DecodeID(credential.CredentialID)
+		if err != nil {
+			continue
+		}
+		exclude = append(exclude, id)
+	}
+
+	displayName := user.Name
+	if displayName == "" {
+		displayName = user.Email
+	}
+
+	return s.rp.CreationOptions(challenge, userHandle(user.ID), user.Email, displayName, exclude), nonce, nil
+}
+
+func (s *service) FinishRegistration(ctx context.Context, user *domain.User, nonce, name string, resp *webauthn.RegistrationResponse) (*domain.WebAuthnCredential, error) {
+	challenge, err := s.takeChallenge(ctx, nonce, domain.WebAuthnRegistration, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if challenge == "" {
+		return nil, errors.NewInvalidArgument(domain.ErrInvalidPasskey).WithMessage("the registration expired, start again")
+	}
+
+	verified, err := s.rp.VerifyRegistration(challenge, resp)
+	if err != nil {
+		s.log.Info().Sendf("passkey registration of user %d rejected: %v", user.ID, err)
+		return nil, errors.NewInvalidArgument(domain.ErrInvalidPasskey).WithMessage(err.Error())
+	}
+
+	credentialID := webauthn.EncodeID(verified.ID)
+	existing, err := s.storage.FindByCredentialID(ctx, credentialID)
+	if err != nil {
+		return nil, err
+	}
+
+	if existing != nil {
+		return nil, errors.NewDuplicatedRecord(domain.ErrPasskeyRegistered).WithMessage("passkey is already registered")
+	}
+
+	credential := &domain.WebAuthnCredential{
+		UserID:       user.ID,
+		Name:         normalizeName(name),
+		CredentialID: credentialID,
+		PublicKey:    verified.PublicKey,
+		SignCount:    verified.SignCount,
+		Transports:   strings.Join(verified.Transports, ","),
+		CreatedAt:    s.now(),
+	}
+
+	if err := s.storage.Insert(ctx, credential); err != nil {
+		return nil, err
+	}
+
+	return credential, nil
+}
+
+// BeginLogin returns the options to sign in with any discoverable credential of the site
+func (s *service) BeginLogin(ctx context.Context) (*webauthn.RequestOptions, string, error) {
+	challenge, nonce, err := s.beginCeremony(ctx, domain.WebAuthnLogin, 0)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return s.rp.RequestOptions(challenge, nil), nonce, nil
+}
+
+// FinishLogin takes the challenge of the nonce first, so a replayed response fails even when it was
+// captured with the cookie of the nonce
+func (s *service) FinishLogin(ctx context.Context, nonce string, resp *webauthn.AssertionResponse) (*domain.User, error) {
+	notAuthorized := errors.NewNotAuthorized(domain.ErrInvalidPasskey).WithMessage("invalid passkey")
+
+	challenge, err := s.takeChallenge(ctx, nonce, domain.WebAuthnLogin, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if challenge == "" {
+		return nil, notAuthorized
+	}
+
+	id, err := webauthn.DecodeID(resp.ID)
+	if err != nil {
+		return nil, notAuthorized
+	}
+
+	credential, err := s.storage.FindByCredentialID(ctx, webauthn.EncodeID(id))
+	if err != nil {
+		return nil, err
+	}
+
+	if credential == nil {
+		return nil, notAuthorized
+	}
+
+	// discoverable credentials return the user handle given on registration
+	if resp.Response.UserHandle != "" {
+		handle, err := webauthn.DecodeID(resp.Response.UserHandle)
+		if err != nil || string(handle) != string(userHandle(credential.UserID)) {
+			return nil, notAuthorized
+		}
+	}
+
+	signCount, err := s.rp.VerifyAssertion(challenge, credential.PublicKey, credential.SignCount, resp)
+	if err != nil {
+		if err == webauthn.ErrSignCount {
+			s.log.Warn().Sendf("passkey %d of user %d reported a lower signature counter, it may be cloned", credential.ID, credential.UserID)
+		}
+		return nil, notAuthorized
+	}
+
+	updated, err := s.storage.UpdateSignCount(ctx, credential.ID, signCount, s.now())
+	if err != nil {
+		return nil, err
+	}
+
+	if !updated {
+		s.log.Warn().Sendf("passkey %d of user %d was used concurrently with the same signature counter", credential.ID, credential.UserID)
+		return nil, notAuthorized
+	}
+
+	user, err := s.userService.FindByID(ctx, credential.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	if user == nil {
+		return nil, notAuthorized
+	}
+
+	return user, nil
+}
+
+func (s *service) List(ctx context.Context, userID int) ([]*domain.WebAuthnCredential, error) {
+	return s.storage.FindByUserID(ctx, userID)
+}
+
+func (s *service) Rename(ctx context.Context, userID, ID int, name string) error {
+	return s.storage.Rename(ctx, userID, ID, normalizeName(name))
+}
+
+func (s *service) Delete(ctx context.Context, userID, ID int) error {
+	return s.storage.Delete(ctx, userID, ID)
+}
+
+// beginCeremony stores a new challenge for the ceremony and returns it with the nonce that takes it
+// back. The expired challenges of the abandoned ceremonies are deleted first.
+func (s *service) beginCeremony(ctx context.Context, ceremony string, userID int) (string, string, error) {
+	now := s.now()
+	if err := s.challenges.DeleteExpired(ctx, now); err != nil {
+		return "", "", err
+	}
+
+	challenge, err := s.newChallenge()
+	if err != nil {
+		return "", "", err
+	}
+
+	nonce, err := webauthn.NewChallenge()
+	if err != nil {
+		return "", "", err
+	}
+
+	err = s.challenges.Insert(ctx, &domain.WebAuthnChallenge{
+		NonceHash: hashNonce(nonce),
+		Ceremony:  ceremony,
+		UserID:    userID,
+		Challenge: challenge,
+		CreatedAt: now,
+		ExpiresAt: now.Add(webauthn.Timeout),
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	return challenge, nonce, nil
+}
+
+// takeChallenge returns the challenge of the nonce, or "" when it is unknown, already taken,
+// expired or started for another ceremony or user
+func (s *service) takeChallenge(ctx context.Context, nonce, ceremony string, userID int) (string, error) {
+	if nonce == "" {
+		return "", nil
+	}
+
+	challenge, err := s.challenges.Take(ctx, hashNonce(nonce))
+	if err != nil {
+		return "", err
+	}
+
+	if challenge == nil || challenge.Ceremony != ceremony || challenge.UserID != userID || !s.now().Before(challenge.ExpiresAt) {
+		return "", nil
+	}
+
+	return challenge.Challenge, nil
+}
+
+func hashNonce(nonce string) string {
+	sum := sha256.Sum256([]byte(nonce))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// userHandle is the opaque user id stored by the authenticator, it must not contain personal data
+func userHandle(userID int) []byte {
+	return []byte(strconv.Itoa(userID))
+}
+
+func normalizeName(name string) string {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return defaultName
+	}
+
+	if runes := []rune(name); len(runes) > maxNameLength {
+		name = string(runes[:maxNameLength])
+	}
+
+	return name
+}
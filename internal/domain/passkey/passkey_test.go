@@ -0,0 +1,260 @@
+package passkey
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/pkg/errors"
+	"gitlab.com/evzpav/user-auth/pkg/log"
+	"gitlab.com/evzpav/user-auth/pkg/webauthn"
+)
+
+// the ceremonies are recorded for rp id "localhost", user 1 registers the credential used in the assertion
+var fixturesPath = filepath.Join("..", "..", "..", "pkg", "webauthn", "testdata")
+
+type fixture struct {
+	Challenge string          `json:"challenge"`
+	Response  json.RawMessage `json:"response"`
+}
+
+func loadFixture(t *testing.T, name string, resp interface{}) string {
+	bs, err := ioutil.ReadFile(filepath.Join(fixturesPath, name))
+	require.NoError(t, err)
+
+	var f fixture
+	require.NoError(t, json.Unmarshal(bs, &f))
+	require.NoError(t, json.Unmarshal(f.Response, resp))
+	return f.Challenge
+}
+
+type fakeStorage struct {
+	domain.WebAuthnCredentialStorage
+	credentials []*domain.WebAuthnCredential
+}
+
+func (f *fakeStorage) Insert(ctx context.Context, credential *domain.WebAuthnCredential) error {
+	credential.ID = len(f.credentials) + 1
+	f.credentials = append(f.credentials, credential)
+	return nil
+}
+
+func (f *fakeStorage) FindByCredentialID(ctx context.Context, credentialID string) (*domain.WebAuthnCredential, error) {
+	for _, c := range f.credentials {
+		if c.CredentialID == credentialID {
+			return c, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (f *fakeStorage) FindByUserID(ctx context.Context, userID int) ([]*domain.WebAuthnCredential, error) {
+	var list []*domain.WebAuthnCredential
+	for _, c := range f.credentials {
+		if c.UserID == userID {
+			list = append(list, c)
+		}
+	}
+
+	return list, nil
+}
+
+func (f *fakeStorage) UpdateSignCount(ctx context.Context, ID int, signCount uint32, lastUsedAt time.Time) (bool, error) {
+	for _, c := range f.credentials {
+		if c.ID == ID && (c.SignCount < signCount || c.SignCount == 0 && signCount == 0) {
+			c.SignCount = signCount
+			c.LastUsedAt = &lastUsedAt
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+type fakeChallengeStorage struct {
+	challenges map[string]*domain.WebAuthnChallenge
+}
+
+func (f *fakeChallengeStorage) Insert(ctx context.Context, challenge *domain.WebAuthnChallenge) error {
+	f.challenges[challenge.NonceHash] = challenge
+	return nil
+}
+
+func (f *fakeChallengeStorage) Take(ctx context.Context, nonceHash string) (*domain.WebAuthnChallenge, error) {
+	challenge := f.challenges[nonceHash]
+	delete(f.challenges, nonceHash)
+	return challenge, nil
+}
+
+func (f *fakeChallengeStorage) DeleteExpired(ctx context.Context, now time.Time) error {
+	return nil
+}
+
+type fakeUserService struct {
+	domain.UserService
+	users map[int]*domain.User
+}
+
+func (f *fakeUserService) FindByID(ctx context.Context, ID int) (*domain.User, error) {
+	return f.users[ID], nil
+}
+
+func newTestService(t *testing.T) (*service, *fakeStorage) {
+	rp, err := webauthn.New(webauthn.Config{RPID: "localhost", Origin: "http://localhost:8080"})
+	require.NoError(t, err)
+
+	storage := &fakeStorage{}
+	challenges := &fakeChallengeStorage{challenges: make(map[string]*domain.WebAuthnChallenge)}
+	users := &fakeUserService{users: map[int]*domain.User{
+		1: {ID: 1, Email: "user@example.com"},
+		2: {ID: 2, Email: "other@example.com"},
+	}}
+
+	return NewService(rp, storage, challenges, users, log.NewZeroLog("", "", log.Error)), storage
+}
+
+// withChallenge makes the next ceremony use the challenge recorded in the fixture
+func withChallenge(s *service, challenge string) {
+	s.newChallenge = func() (string, error) { return challenge, nil }
+}
+
+func register(t *testing.T, s *service, user *domain.User, name string) (*domain.WebAuthnCredential, error) {
+	var resp webauthn.RegistrationResponse
+	withChallenge(s, loadFixture(t, "registration_none_es256.json", &resp))
+
+	_, nonce, err := s.BeginRegistration(context.Background(), user)
+	require.NoError(t, err)
+
+	return s.FinishRegistration(context.Background(), user, nonce, name, &resp)
+}
+
+// beginLogin starts a login with the challenge of the assertion fixture and returns its nonce
+func beginLogin(t *testing.T, s *service, resp *webauthn.AssertionResponse) string {
+	withChallenge(s, loadFixture(t, "assertion_es256.json", resp))
+
+	_, nonce, err := s.BeginLogin(context.Background())
+	require.NoError(t, err)
+
+	return nonce
+}
+
+func TestService_Registration(t *testing.T) {
+	s, storage := newTestService(t)
+	ctx := context.Background()
+	user := &domain.User{ID: 1, Email: "user@example.com"}
+
+	options, nonce, err := s.BeginRegistration(ctx, user)
+	require.NoError(t, err)
+	assert.NotEmpty(t, nonce)
+	assert.NotEqual(t, options.Challenge, nonce, "the nonce does not reveal the challenge")
+	assert.Equal(t, "MQ", options.User.ID)
+	assert.Equal(t, "user@example.com", options.User.DisplayName)
+	assert.Empty(t, options.ExcludeCredentials)
+
+	credential, err := register(t, s, user, "  ")
+	require.NoError(t, err)
+	assert.Equal(t, "Passkey", credential.Name)
+	assert.Equal(t, "internal,hybrid", credential.Transports)
+	assert.Len(t, storage.credentials, 1)
+
+	options, _, err = s.BeginRegistration(ctx, user)
+	require.NoError(t, err)
+	require.Len(t, options.ExcludeCredentials, 1)
+	assert.Equal(t, credential.CredentialID, options.ExcludeCredentials[0].ID)
+
+	_, err = register(t, s, user, "Laptop")
+	_, ok := errors.DuplicatedRecordCast(err)
+	assert.True(t, ok)
+
+	var resp webauthn.RegistrationResponse
+	loadFixture(t, "registration_none_es256.json", &resp)
+	_, err = s.FinishRegistration(ctx, user, "unknown-nonce", "Laptop", &resp)
+	_, ok = errors.InvalidArgumentCast(err)
+	assert.True(t, ok)
+
+	// the challenge of another user is not taken
+	_, nonce, err = s.BeginRegistration(ctx, &domain.User{ID: 2})
+	require.NoError(t, err)
+	_, err = s.FinishRegistration(ctx, user, nonce, "Laptop", &resp)
+	_, ok = errors.InvalidArgumentCast(err)
+	assert.True(t, ok)
+}
+
+func TestService_Login(t *testing.T) {
+	s, storage := newTestService(t)
+	ctx := context.Background()
+
+	var resp webauthn.AssertionResponse
+	_, err := s.FinishLogin(ctx, beginLogin(t, s, &resp), &resp)
+	_, ok := errors.NotAuthorizedCast(err)
+	assert.True(t, ok, "unknown credential")
+
+	_, err = register(t, s, &domain.User{ID: 1}, "Phone")
+	require.NoError(t, err)
+
+	user, err := s.FinishLogin(ctx, beginLogin(t, s, &resp), &resp)
+	require.NoError(t, err)
+	assert.Equal(t, 1, user.ID)
+	assert.Equal(t, uint32(7), storage.credentials[0].SignCount)
+	assert.NotNil(t, storage.credentials[0].LastUsedAt)
+
+	// replaying the same assertion does not increase the counter
+	_, err = s.FinishLogin(ctx, beginLogin(t, s, &resp), &resp)
+	_, ok = errors.NotAuthorizedCast(err)
+	assert.True(t, ok)
+}
+
+func TestService_LoginReplayed(t *testing.T) {
+	s, storage := newTestService(t)
+	ctx := context.Background()
+
+	_, err := register(t, s, &domain.User{ID: 1}, "Phone")
+	require.NoError(t, err)
+
+	var resp webauthn.AssertionResponse
+	nonce := beginLogin(t, s, &resp)
+
+	_, err = s.FinishLogin(ctx, nonce, &resp)
+	require.NoError(t, err)
+
+	// the counter alone would accept the assertion again, the challenge of the nonce is gone
+	storage.credentials[0].SignCount = 0
+	_, err = s.FinishLogin(ctx, nonce, &resp)
+	_, ok := errors.NotAuthorizedCast(err)
+	assert.True(t, ok, "the same login finish fails the second time")
+	assert.Equal(t, uint32(0), storage.credentials[0].SignCount)
+
+	// a registration nonce does not finish a login, even with the challenge of the assertion
+	_, nonce, err = s.BeginRegistration(ctx, &domain.User{ID: 1})
+	require.NoError(t, err)
+	_, err = s.FinishLogin(ctx, nonce, &resp)
+	_, ok = errors.NotAuthorizedCast(err)
+	assert.True(t, ok)
+}
+
+func TestService_LoginUserHandleMismatch(t *testing.T) {
+	s, _ := newTestService(t)
+	ctx := context.Background()
+
+	_, err := register(t, s, &domain.User{ID: 2}, "Phone")
+	require.NoError(t, err)
+
+	var resp webauthn.AssertionResponse
+	_, err = s.FinishLogin(ctx, beginLogin(t, s, &resp), &resp)
+	_, ok := errors.NotAuthorizedCast(err)
+	assert.True(t, ok)
+}
+
+func TestNormalizeName(t *testing.T) {
+	assert.Equal(t, "Passkey", normalizeName(""))
+	assert.Equal(t, "YubiKey", normalizeName(" YubiKey "))
+	assert.Len(t, []rune(normalizeName(strings.Repeat("é", 80))), maxNameLength)
+}
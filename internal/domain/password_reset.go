@@ -0,0 +1,24 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// PasswordResetToken is a password recovery link, only the hash of the token is stored
+type PasswordResetToken struct {
+	ID        int        `json:"id"`
+	UserID    int        `json:"user_id"`
+	TokenHash string     `json:"-"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+}
+
+type PasswordResetTokenStorage interface {
+	Insert(ctx context.Context, token *PasswordResetToken) error
+	FindByHash(ctx context.Context, hash string) (*PasswordResetToken, error)
+	// MarkUsed returns false when the token was already used, so a token is only consumed once
+	MarkUsed(ctx context.Context, ID int, usedAt time.Time) (bool, error)
+	DeleteByUserID(ctx context.Context, userID int) error
+}
@@ -8,6 +8,11 @@ type Profile struct {
 	Address string `json:"address"`
 	Email   string `json:"email"`
 	Phone   string `json:"phone"`
+
+	EmailVerified bool `json:"email_verified"`
+	// Organization is the current organization, only set for the session tokens as the access
+	// tokens carry it in their claims
+	Organization *UserOrganization `json:"organization,omitempty"`
 }
 
 func (p *Profile) Validate() error {
@@ -0,0 +1,77 @@
+package domain
+
+import "context"
+
+// Permission allows an action in the admin area, roles grant them to users
+type Permission string
+
+const (
+	// PermissionUsersRead allows searching users and viewing their accounts, it opens the admin area
+	PermissionUsersRead          Permission = "users:read"
+	PermissionUsersWrite         Permission = "users:write"
+	PermissionUsersDelete        Permission = "users:delete"
+	PermissionUsersDisable       Permission = "users:disable"
+	PermissionUsersResetPassword Permission = "users:reset_password"
+	PermissionSessionsRevoke     Permission = "sessions:revoke"
+	// PermissionAuditRead allows querying the audit log of every user
+	PermissionAuditRead Permission = "audit:read"
+)
+
+// Permissions lists every permission, the admin role is seeded with all of them
+var Permissions = []Permission{
+	PermissionUsersRead,
+	PermissionUsersWrite,
+	PermissionUsersDelete,
+	PermissionUsersDisable,
+	PermissionUsersResetPassword,
+	PermissionSessionsRevoke,
+	PermissionAuditRead,
+}
+
+func (p Permission) Valid() bool {
+	for _, permission := range Permissions {
+		if p == permission {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RoleAdmin is seeded with every permission
+const RoleAdmin = "admin"
+
+type Role struct {
+	ID          int          `json:"id"`
+	Name        string       `json:"name"`
+	Description string       `json:"description"`
+	Permissions []Permission `json:"permissions"`
+}
+
+func (r *Role) HasPermission(permission Permission) bool {
+	for _, p := range r.Permissions {
+		if p == permission {
+			return true
+		}
+	}
+
+	return false
+}
+
+type RBACService interface {
+	Roles(ctx context.Context) ([]*Role, error)
+	UserRoles(ctx context.Context, userID int) ([]*Role, error)
+	HasPermission(ctx context.Context, userID int, permission Permission) (bool, error)
+	AssignRole(ctx context.Context, userID int, roleName string) error
+	RemoveRole(ctx context.Context, userID int, roleName string) error
+}
+
+// RoleStorage returns the roles with their permissions
+type RoleStorage interface {
+	List(ctx context.Context) ([]*Role, error)
+	FindByName(ctx context.Context, name string) (*Role, error)
+	FindByUserID(ctx context.Context, userID int) ([]*Role, error)
+	// AddUser does nothing when the user already has the role
+	AddUser(ctx context.Context, roleID, userID int) error
+	RemoveUser(ctx context.Context, roleID, userID int) error
+}
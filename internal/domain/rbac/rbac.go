@@ -0,0 +1,86 @@
+package rbac
+
+import (
+	"context"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/pkg/errors"
+	"gitlab.com/evzpav/user-auth/pkg/log"
+)
+
+type service struct {
+	storage domain.RoleStorage
+	log     log.Logger
+}
+
+func NewService(storage domain.RoleStorage, log log.Logger) *service {
+	return &service{
+		storage: storage,
+		log:     log,
+	}
+}
+
+func (s *service) Roles(ctx context.Context) ([]*domain.Role, error) {
+	return s.storage.List(ctx)
+}
+
+func (s *service) UserRoles(ctx context.Context, userID int) ([]*domain.Role, error) {
+	return s.storage.FindByUserID(ctx, userID)
+}
+
+// HasPermission tells whether any role of the user grants the permission
+func (s *service) HasPermission(ctx context.Context, userID int, permission domain.Permission) (bool, error) {
+	roles, err := s.storage.FindByUserID(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+
+	for _, role := range roles {
+		if role.HasPermission(permission) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (s *service) AssignRole(ctx context.Context, userID int, roleName string) error {
+	role, err := s.findRole(ctx, roleName)
+	if err != nil {
+		return err
+	}
+
+	if err := s.storage.AddUser(ctx, role.ID, userID); err != nil {
+		return err
+	}
+
+	s.log.Info().Sendf("assigned role %s to user %d", role.Name, userID)
+	return nil
+}
+
+func (s *service) RemoveRole(ctx context.Context, userID int, roleName string) error {
+	role, err := s.findRole(ctx, roleName)
+	if err != nil {
+		return err
+	}
+
+	if err := s.storage.RemoveUser(ctx, role.ID, userID); err != nil {
+		return err
+	}
+
+	s.log.Info().Sendf("removed role %s from user %d", role.Name, userID)
+	return nil
+}
+
+func (s *service) findRole(ctx context.Context, name string) (*domain.Role, error) {
+	role, err := s.storage.FindByName(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if role == nil {
+		return nil, errors.NewNotFound(domain.ErrRoleNotFound).WithMessage("role " + name + " not found")
+	}
+
+	return role, nil
+}
@@ -0,0 +1,49 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+type Session struct {
+	ID         int       `json:"id"`
+	UserID     int       `json:"user_id"`
+	TokenHash  string    `json:"-"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"user_agent"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	// OrganizationID is the organization the user is working in, nil when none
+	OrganizationID *int `json:"organization_id"`
+}
+
+// SessionMeta describes the device a session is created from
+type SessionMeta struct {
+	IP        string
+	UserAgent string
+	// OrganizationID is the current organization the session starts in
+	OrganizationID *int
+}
+
+type SessionService interface {
+	Create(ctx context.Context, user *User, meta SessionMeta) (string, *Session, error)
+	Authenticate(ctx context.Context, token string) (*User, *Session, error)
+	List(ctx context.Context, userID int) ([]*Session, error)
+	Revoke(ctx context.Context, userID, sessionID int) error
+	RevokeAll(ctx context.Context, userID int) error
+	// SetOrganization switches the current organization of the session, the caller checks the
+	// user is a member
+	SetOrganization(ctx context.Context, session *Session, organizationID *int) error
+}
+
+type SessionStorage interface {
+	Insert(ctx context.Context, session *Session) error
+	FindByTokenHash(ctx context.Context, hash string) (*Session, error)
+	FindByUserID(ctx context.Context, userID int) ([]*Session, error)
+	Touch(ctx context.Context, ID int, lastSeenAt, expiresAt time.Time) error
+	SetOrganization(ctx context.Context, ID int, organizationID *int) error
+	Delete(ctx context.Context, userID, ID int) error
+	DeleteByUserID(ctx context.Context, userID int) error
+	DeleteExpired(ctx context.Context, userID int, now time.Time) error
+}
@@ -0,0 +1,164 @@
+package session
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"time"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/pkg/errors"
+	"gitlab.com/evzpav/user-auth/pkg/log"
+)
+
+// last seen time is only written when older than this to avoid a write per request
+const touchInterval = time.Minute
+
+const maxUserAgentLength = 255
+
+type service struct {
+	storage     domain.SessionStorage
+	userService domain.UserService
+	ttl         time.Duration
+	now         func() time.Time
+	log         log.Logger
+}
+
+func NewService(storage domain.SessionStorage, userService domain.UserService, ttl time.Duration, log log.Logger) *service {
+	return &service{
+		storage:     storage,
+		userService: userService,
+		ttl:         ttl,
+		now:         time.Now,
+		log:         log,
+	}
+}
+
+// Create starts a new session for the user and returns the token to be given to the client.
+// Only the token hash is stored.
+func (s *service) Create(ctx context.Context, user *domain.User, meta domain.SessionMeta) (string, *domain.Session, error) {
+	if !user.Active() {
+		return "", nil, errors.NewRuleNotSatisfied(domain.ErrAccountDisabled).WithMessage("account disabled")
+	}
+
+	token, err := generateToken()
+	if err != nil {
+		return "", nil, err
+	}
+
+	userAgent := meta.UserAgent
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+
+	now := s.now()
+	session := &domain.Session{
+		UserID:     user.ID,
+		TokenHash:  hashToken(token),
+		IP:         meta.IP,
+		UserAgent:  userAgent,
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(s.ttl),
+
+		OrganizationID: meta.OrganizationID,
+	}
+
+	if err := s.storage.Insert(ctx, session); err != nil {
+		return "", nil, err
+	}
+
+	if err := s.storage.DeleteExpired(ctx, user.ID, now); err != nil {
+		s.log.Warn().Err(err).Sendf("failed to delete expired sessions of user %d", user.ID)
+	}
+
+	return token, session, nil
+}
+
+func (s *service) Authenticate(ctx context.Context, token string) (*domain.User, *domain.Session, error) {
+	notAuthorized := errors.NewNotAuthorized(domain.ErrInvalidCredentials)
+
+	if token == "" {
+		return nil, nil, notAuthorized
+	}
+
+	session, err := s.storage.FindByTokenHash(ctx, hashToken(token))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := s.now()
+	if session == nil || !now.Before(session.ExpiresAt) {
+		return nil, nil, notAuthorized
+	}
+
+	user, err := s.userService.FindByID(ctx, session.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// sessions are revoked when the account is disabled or deleted, this covers those started just before
+	if user == nil || !user.Active() {
+		return nil, nil, notAuthorized
+	}
+
+	if now.Sub(session.LastSeenAt) >= touchInterval {
+		session.LastSeenAt = now
+		session.ExpiresAt = now.Add(s.ttl)
+		if err := s.storage.Touch(ctx, session.ID, session.LastSeenAt, session.ExpiresAt); err != nil {
+			s.log.Warn().Err(err).Sendf("failed to update session %d last seen time", session.ID)
+		}
+	}
+
+	return user, session, nil
+}
+
+func (s *service) List(ctx context.Context, userID int) ([]*domain.Session, error) {
+	sessions, err := s.storage.FindByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.now()
+	active := make([]*domain.Session, 0, len(sessions))
+	for _, session := range sessions {
+		if now.Before(session.ExpiresAt) {
+			active = append(active, session)
+		}
+	}
+
+	return active, nil
+}
+
+func (s *service) Revoke(ctx context.Context, userID, sessionID int) error {
+	return s.storage.Delete(ctx, userID, sessionID)
+}
+
+func (s *service) RevokeAll(ctx context.Context, userID int) error {
+	return s.storage.DeleteByUserID(ctx, userID)
+}
+
+func (s *service) SetOrganization(ctx context.Context, session *domain.Session, organizationID *int) error {
+	if err := s.storage.SetOrganization(ctx, session.ID, organizationID); err != nil {
+		return err
+	}
+
+	session.OrganizationID = organizationID
+	return nil
+}
+
+func generateToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,216 @@
+package session
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/pkg/errors"
+	"gitlab.com/evzpav/user-auth/pkg/log"
+)
+
+type fakeUserService struct {
+	domain.UserService
+	users map[int]*domain.User
+}
+
+func (f *fakeUserService) FindByID(ctx context.Context, ID int) (*domain.User, error) {
+	return f.users[ID], nil
+}
+
+type fakeSessionStorage struct {
+	sessions []*domain.Session
+}
+
+func (f *fakeSessionStorage) Insert(ctx context.Context, session *domain.Session) error {
+	session.ID = len(f.sessions) + 1
+	f.sessions = append(f.sessions, session)
+	return nil
+}
+
+func (f *fakeSessionStorage) FindByTokenHash(ctx context.Context, hash string) (*domain.Session, error) {
+	for _, s := range f.sessions {
+		if s.TokenHash == hash {
+			copied := *s
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeSessionStorage) FindByUserID(ctx context.Context, userID int) ([]*domain.Session, error) {
+	var sessions []*domain.Session
+	for _, s := range f.sessions {
+		if s.UserID == userID {
+			sessions = append(sessions, s)
+		}
+	}
+	return sessions, nil
+}
+
+func (f *fakeSessionStorage) Touch(ctx context.Context, ID int, lastSeenAt, expiresAt time.Time) error {
+	for _, s := range f.sessions {
+		if s.ID == ID {
+			s.LastSeenAt = lastSeenAt
+			s.ExpiresAt = expiresAt
+		}
+	}
+	return nil
+}
+
+func (f *fakeSessionStorage) SetOrganization(ctx context.Context, ID int, organizationID *int) error {
+	for _, s := range f.sessions {
+		if s.ID == ID {
+			s.OrganizationID = organizationID
+		}
+	}
+	return nil
+}
+
+func (f *fakeSessionStorage) delete(match func(s *domain.Session) bool) {
+	kept := f.sessions[:0]
+	for _, s := range f.sessions {
+		if !match(s) {
+			kept = append(kept, s)
+		}
+	}
+	f.sessions = kept
+}
+
+func (f *fakeSessionStorage) Delete(ctx context.Context, userID, ID int) error {
+	f.delete(func(s *domain.Session) bool { return s.UserID == userID && s.ID == ID })
+	return nil
+}
+
+func (f *fakeSessionStorage) DeleteByUserID(ctx context.Context, userID int) error {
+	f.delete(func(s *domain.Session) bool { return s.UserID == userID })
+	return nil
+}
+
+func (f *fakeSessionStorage) DeleteExpired(ctx context.Context, userID int, now time.Time) error {
+	f.delete(func(s *domain.Session) bool { return s.UserID == userID && !now.Before(s.ExpiresAt) })
+	return nil
+}
+
+func newTestService() (*service, *fakeSessionStorage, *time.Time) {
+	storage := &fakeSessionStorage{}
+	users := &fakeUserService{users: map[int]*domain.User{1: {ID: 1}, 2: {ID: 2}}}
+
+	s := NewService(storage, users, time.Hour, log.NewZeroLog("", "", log.Error))
+
+	now := time.Unix(1600000000, 0)
+	s.now = func() time.Time { return now }
+
+	return s, storage, &now
+}
+
+func TestService_MultipleSessions(t *testing.T) {
+	s, _, _ := newTestService()
+	ctx := context.Background()
+	user := &domain.User{ID: 1}
+
+	laptop, _, err := s.Create(ctx, user, domain.SessionMeta{IP: "10.0.0.1", UserAgent: "laptop"})
+	require.NoError(t, err)
+
+	phone, phoneSession, err := s.Create(ctx, user, domain.SessionMeta{IP: "10.0.0.2", UserAgent: "phone"})
+	require.NoError(t, err)
+
+	for _, token := range []string{laptop, phone} {
+		authenticated, _, err := s.Authenticate(ctx, token)
+		require.NoError(t, err)
+		assert.Equal(t, 1, authenticated.ID)
+	}
+
+	sessions, err := s.List(ctx, 1)
+	require.NoError(t, err)
+	assert.Len(t, sessions, 2)
+
+	require.NoError(t, s.Revoke(ctx, 1, phoneSession.ID))
+
+	_, _, err = s.Authenticate(ctx, phone)
+	assert.Error(t, err)
+
+	_, _, err = s.Authenticate(ctx, laptop)
+	assert.NoError(t, err)
+}
+
+func TestService_RevokeOnlyOwnSessions(t *testing.T) {
+	s, _, _ := newTestService()
+	ctx := context.Background()
+
+	token, session, err := s.Create(ctx, &domain.User{ID: 1}, domain.SessionMeta{})
+	require.NoError(t, err)
+
+	require.NoError(t, s.Revoke(ctx, 2, session.ID))
+	require.NoError(t, s.RevokeAll(ctx, 2))
+
+	_, _, err = s.Authenticate(ctx, token)
+	assert.NoError(t, err)
+
+	require.NoError(t, s.RevokeAll(ctx, 1))
+
+	_, _, err = s.Authenticate(ctx, token)
+	assert.Error(t, err)
+}
+
+func TestService_ExpiryAndLastSeen(t *testing.T) {
+	s, storage, now := newTestService()
+	ctx := context.Background()
+
+	token, _, err := s.Create(ctx, &domain.User{ID: 1}, domain.SessionMeta{})
+	require.NoError(t, err)
+
+	*now = now.Add(30 * time.Minute)
+	_, session, err := s.Authenticate(ctx, token)
+	require.NoError(t, err)
+	assert.Equal(t, *now, storage.sessions[0].LastSeenAt)
+	assert.Equal(t, now.Add(time.Hour), session.ExpiresAt)
+
+	*now = now.Add(time.Hour)
+	_, _, err = s.Authenticate(ctx, token)
+	assert.Error(t, err)
+
+	sessions, err := s.List(ctx, 1)
+	require.NoError(t, err)
+	assert.Empty(t, sessions)
+}
+
+func TestService_DisabledUser(t *testing.T) {
+	s, _, _ := newTestService()
+	ctx := context.Background()
+	disabledAt := time.Unix(1600000000, 0)
+
+	_, _, err := s.Create(ctx, &domain.User{ID: 1, DisabledAt: &disabledAt}, domain.SessionMeta{})
+	describer, ok := errors.RuleNotSatisfiedCast(err)
+	require.True(t, ok, "expected rule not satisfied, got %v", err)
+	assert.Equal(t, domain.ErrAccountDisabled, describer.GetCode())
+
+	token, _, err := s.Create(ctx, &domain.User{ID: 1}, domain.SessionMeta{})
+	require.NoError(t, err)
+
+	// the account is disabled after the session started
+	s.userService.(*fakeUserService).users[1].DisabledAt = &disabledAt
+	_, _, err = s.Authenticate(ctx, token)
+	assert.Error(t, err)
+}
+
+func TestService_Organization(t *testing.T) {
+	s, _, _ := newTestService()
+	ctx := context.Background()
+	organizationID := 7
+
+	token, session, err := s.Create(ctx, &domain.User{ID: 1}, domain.SessionMeta{OrganizationID: &organizationID})
+	require.NoError(t, err)
+	require.NotNil(t, session.OrganizationID)
+	assert.Equal(t, 7, *session.OrganizationID)
+
+	require.NoError(t, s.SetOrganization(ctx, session, nil))
+	assert.Nil(t, session.OrganizationID)
+
+	_, authenticated, err := s.Authenticate(ctx, token)
+	require.NoError(t, err)
+	assert.Nil(t, authenticated.OrganizationID)
+}
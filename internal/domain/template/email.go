@@ -0,0 +1,44 @@
+package template
+
+import (
+	"bytes"
+	"html/template"
+	"strings"
+	texttemplate "text/template"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+)
+
+// RenderEmail builds an email from <name>.txt, defining the "subject" and the plain "text" body,
+// and <name>.html, defining the "content" of the HTML body laid out by base.html
+func (s *service) RenderEmail(name string, data interface{}) (*domain.Email, error) {
+	textTpl, err := texttemplate.ParseFiles(s.emailsPath + name + ".txt")
+	if err != nil {
+		return nil, err
+	}
+
+	var subject, text bytes.Buffer
+	if err := textTpl.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return nil, err
+	}
+
+	if err := textTpl.ExecuteTemplate(&text, "text", data); err != nil {
+		return nil, err
+	}
+
+	htmlTpl, err := template.ParseFiles(s.emailsPath+"base.html", s.emailsPath+name+".html")
+	if err != nil {
+		return nil, err
+	}
+
+	var html bytes.Buffer
+	if err := htmlTpl.ExecuteTemplate(&html, "base", data); err != nil {
+		return nil, err
+	}
+
+	return &domain.Email{
+		Subject: strings.TrimSpace(subject.String()),
+		Text:    strings.TrimSpace(text.String()) + "\n",
+		HTML:    html.String(),
+	}, nil
+}
@@ -0,0 +1,47 @@
+package template
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_RenderEmail(t *testing.T) {
+	s := &service{emailsPath: "emails/"}
+	link := "http://localhost/email/verify?token=a&b"
+
+	email, err := s.RenderEmail("verify_email", struct {
+		Email     string
+		Link      string
+		ExpiresAt time.Time
+	}{Email: "user@example.com", Link: link, ExpiresAt: time.Now()})
+	require.NoError(t, err)
+
+	assert.Equal(t, "Verify your email - user-auth", email.Subject)
+	assert.Contains(t, email.Text, link)
+	assert.Contains(t, email.HTML, `href="http://localhost/email/verify?token=a&amp;b"`)
+	assert.Contains(t, email.HTML, "<strong>user@example.com</strong>")
+
+	email, err = s.RenderEmail("reset_password", struct{ Link string }{Link: link})
+	require.NoError(t, err)
+	assert.Equal(t, "Recover password - user-auth", email.Subject)
+	assert.Contains(t, email.Text, link)
+
+	email, err = s.RenderEmail("org_invitation", struct {
+		Organization string
+		Inviter      string
+		Role         string
+		Email        string
+		Link         string
+		ExpiresAt    time.Time
+	}{Organization: "Acme", Inviter: "owner@example.com", Role: "member", Email: "user@example.com", Link: link, ExpiresAt: time.Now()})
+	require.NoError(t, err)
+	assert.Equal(t, "Join Acme - user-auth", email.Subject)
+	assert.Contains(t, email.Text, link)
+	assert.Contains(t, email.HTML, "<strong>Acme</strong>")
+
+	_, err = s.RenderEmail("unknown", nil)
+	assert.Error(t, err)
+}
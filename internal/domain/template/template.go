@@ -12,6 +12,7 @@ import (
 type service struct {
 	googleMapsClient domain.GoogleMapper
 	templatesPath    string
+	emailsPath       string
 	log              log.Logger
 }
 
@@ -21,11 +22,19 @@ func NewService(googleMapsClient domain.GoogleMapper, log log.Logger) *service {
 		log.Fatal().Err(err)
 	}
 
-	templatesPath := pwd + "/internal/domain/template/pages/"
+	return NewServiceWithRoot(pwd, googleMapsClient, log)
+}
+
+// NewServiceWithRoot loads the templates of the repository at root, for callers that do not run
+// from it like the tests of other packages
+func NewServiceWithRoot(root string, googleMapsClient domain.GoogleMapper, log log.Logger) *service {
+	templatesPath := root + "/internal/domain/template/pages/"
+	emailsPath := root + "/internal/domain/template/emails/"
 
 	return &service{
 		googleMapsClient: googleMapsClient,
 		templatesPath:    templatesPath,
+		emailsPath:       emailsPath,
 		log:              log,
 	}
 }
@@ -38,8 +47,9 @@ func (s *service) RetrieveParsedTemplate(name string) (*domain.HTMLTemplate, err
 		return nil, err
 	}
 
+	// the set is named after the first file of the glob, pages are rendered through the base layout
 	return &domain.HTMLTemplate{
-		Template: pageTpl,
+		Template: pageTpl.Lookup("base.html"),
 	}, nil
 
 }
@@ -0,0 +1,62 @@
+package domain
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// actions limited by the throttle service
+const (
+	ThrottleLogin          = "login"
+	ThrottleMFA            = "mfa"
+	ThrottleSignup         = "signup"
+	ThrottleForgotPassword = "forgot_password"
+	ThrottleVerifyEmail    = "verify_email"
+)
+
+// ThrottleKey is the subject attempts are counted for, an account or a client address
+type ThrottleKey struct {
+	Kind  string
+	Value string
+}
+
+func ThrottleEmail(email string) ThrottleKey {
+	return ThrottleKey{Kind: "email", Value: strings.ToLower(strings.TrimSpace(email))}
+}
+
+func ThrottleIP(ip string) ThrottleKey {
+	return ThrottleKey{Kind: "ip", Value: ip}
+}
+
+func ThrottleUser(userID int) ThrottleKey {
+	return ThrottleKey{Kind: "user", Value: strconv.Itoa(userID)}
+}
+
+// ThrottleService limits attempts of an action. Allow returns a RuleNotSatisfied
+// ErrTooManyAttempts error while any of the keys is locked out.
+type ThrottleService interface {
+	Allow(ctx context.Context, action string, keys ...ThrottleKey) error
+	Record(ctx context.Context, action string, keys ...ThrottleKey) error
+	Reset(ctx context.Context, action string, keys ...ThrottleKey) error
+}
+
+// ThrottleEntry counts the attempts of a key. The entry can be discarded after ExpiresAt.
+type ThrottleEntry struct {
+	Key         string
+	Attempts    int
+	LockedUntil *time.Time
+	ExpiresAt   time.Time
+}
+
+// ThrottleStore keeps the attempts. Stores shared by several instances must implement Increment
+// atomically.
+type ThrottleStore interface {
+	Get(ctx context.Context, key string) (*ThrottleEntry, error)
+	// Increment adds an attempt, starting over when the entry expired, and extends the expiration
+	// to at least now plus window
+	Increment(ctx context.Context, key string, now time.Time, window time.Duration) (*ThrottleEntry, error)
+	Lock(ctx context.Context, key string, until, expiresAt time.Time) error
+	Delete(ctx context.Context, key string) error
+}
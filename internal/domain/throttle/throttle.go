@@ -0,0 +1,164 @@
+package throttle
+
+import (
+	"context"
+	"time"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/pkg/errors"
+	"gitlab.com/evzpav/user-auth/pkg/log"
+)
+
+// Policy limits the attempts of an action for one kind of key. After MaxAttempts within Window
+// the key is locked out for Lockout, doubled on every further attempt up to MaxLockout. Attempts
+// are forgotten a Window after the last attempt or lockout.
+type Policy struct {
+	MaxAttempts int
+	Window      time.Duration
+	Lockout     time.Duration
+	MaxLockout  time.Duration
+}
+
+// Config holds the policies by action and key kind, actions or kinds without a policy are not
+// limited
+type Config map[string]map[string]Policy
+
+// DefaultConfig allows few attempts per account, since they target a single user, and more per
+// address, since several users can share one
+func DefaultConfig() Config {
+	return Config{
+		domain.ThrottleLogin: {
+			"email": {MaxAttempts: 5, Window: 15 * time.Minute, Lockout: time.Minute, MaxLockout: time.Hour},
+			"ip":    {MaxAttempts: 20, Window: 15 * time.Minute, Lockout: time.Minute, MaxLockout: time.Hour},
+		},
+		domain.ThrottleMFA: {
+			"user": {MaxAttempts: 5, Window: 15 * time.Minute, Lockout: time.Minute, MaxLockout: time.Hour},
+			"ip":   {MaxAttempts: 20, Window: 15 * time.Minute, Lockout: time.Minute, MaxLockout: time.Hour},
+		},
+		domain.ThrottleSignup: {
+			"ip": {MaxAttempts: 10, Window: time.Hour, Lockout: 10 * time.Minute, MaxLockout: 24 * time.Hour},
+		},
+		domain.ThrottleForgotPassword: {
+			"email": {MaxAttempts: 3, Window: time.Hour, Lockout: 15 * time.Minute, MaxLockout: 24 * time.Hour},
+			"ip":    {MaxAttempts: 10, Window: time.Hour, Lockout: 15 * time.Minute, MaxLockout: 24 * time.Hour},
+		},
+		domain.ThrottleVerifyEmail: {
+			"email": {MaxAttempts: 3, Window: time.Hour, Lockout: 15 * time.Minute, MaxLockout: 24 * time.Hour},
+			"ip":    {MaxAttempts: 10, Window: time.Hour, Lockout: 15 * time.Minute, MaxLockout: 24 * time.Hour},
+		},
+	}
+}
+
+type service struct {
+	store  domain.ThrottleStore
+	config Config
+	now    func() time.Time
+	log    log.Logger
+}
+
+func NewService(store domain.ThrottleStore, config Config, log log.Logger) *service {
+	return &service{
+		store:  store,
+		config: config,
+		now:    time.Now,
+		log:    log,
+	}
+}
+
+// Allow fails while any of the keys is locked out. The error does not tell which key is locked so
+// it does not reveal whether an account exists.
+func (s *service) Allow(ctx context.Context, action string, keys ...domain.ThrottleKey) error {
+	now := s.now()
+	for _, key := range keys {
+		if _, ok := s.policy(action, key); !ok {
+			continue
+		}
+
+		entry, err := s.store.Get(ctx, storeKey(action, key))
+		if err != nil {
+			return err
+		}
+
+		if entry != nil && entry.LockedUntil != nil && now.Before(*entry.LockedUntil) {
+			return tooManyAttempts()
+		}
+	}
+
+	return nil
+}
+
+// Record counts an attempt for every key and locks out the keys over their threshold
+func (s *service) Record(ctx context.Context, action string, keys ...domain.ThrottleKey) error {
+	now := s.now()
+	for _, key := range keys {
+		policy, ok := s.policy(action, key)
+		if !ok {
+			continue
+		}
+
+		k := storeKey(action, key)
+		entry, err := s.store.Increment(ctx, k, now, policy.Window)
+		if err != nil {
+			return err
+		}
+
+		if entry.Attempts < policy.MaxAttempts {
+			continue
+		}
+
+		lockout := policy.lockout(entry.Attempts)
+		until := now.Add(lockout)
+		if err := s.store.Lock(ctx, k, until, until.Add(policy.Window)); err != nil {
+			return err
+		}
+
+		s.log.Warn().Sendf("%s locked out for %s after %d attempts", k, lockout, entry.Attempts)
+	}
+
+	return nil
+}
+
+// Reset forgets the attempts of the keys, used after a successful attempt
+func (s *service) Reset(ctx context.Context, action string, keys ...domain.ThrottleKey) error {
+	for _, key := range keys {
+		if _, ok := s.policy(action, key); !ok {
+			continue
+		}
+
+		if err := s.store.Delete(ctx, storeKey(action, key)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *service) policy(action string, key domain.ThrottleKey) (Policy, bool) {
+	policy, ok := s.config[action][key.Kind]
+	return policy, ok && policy.MaxAttempts > 0
+}
+
+// lockout doubles the base lockout for every attempt past the threshold
+func (p Policy) lockout(attempts int) time.Duration {
+	lockout := p.Lockout
+	for i := p.MaxAttempts; i < attempts; i++ {
+		lockout *= 2
+		if lockout >= p.MaxLockout {
+			return p.MaxLockout
+		}
+	}
+
+	if p.MaxLockout > 0 && lockout > p.MaxLockout {
+		return p.MaxLockout
+	}
+
+	return lockout
+}
+
+func storeKey(action string, key domain.ThrottleKey) string {
+	return action + ":" + key.Kind + ":" + key.Value
+}
+
+func tooManyAttempts() error {
+	return errors.NewRuleNotSatisfied(domain.ErrTooManyAttempts).WithMessage("too many attempts, please try again later")
+}
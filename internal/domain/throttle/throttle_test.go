@@ -0,0 +1,157 @@
+package throttle
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/pkg/errors"
+	"gitlab.com/evzpav/user-auth/pkg/log"
+)
+
+type fakeStore struct {
+	entries map[string]*domain.ThrottleEntry
+}
+
+func (f *fakeStore) Get(ctx context.Context, key string) (*domain.ThrottleEntry, error) {
+	return f.entries[key], nil
+}
+
+func (f *fakeStore) Increment(ctx context.Context, key string, now time.Time, window time.Duration) (*domain.ThrottleEntry, error) {
+	entry, ok := f.entries[key]
+	if !ok || !now.Before(entry.ExpiresAt) {
+		entry = &domain.ThrottleEntry{Key: key}
+		f.entries[key] = entry
+	}
+
+	entry.Attempts++
+	if now.Add(window).After(entry.ExpiresAt) {
+		entry.ExpiresAt = now.Add(window)
+	}
+
+	return entry, nil
+}
+
+func (f *fakeStore) Lock(ctx context.Context, key string, until, expiresAt time.Time) error {
+	f.entries[key].LockedUntil = &until
+	if expiresAt.After(f.entries[key].ExpiresAt) {
+		f.entries[key].ExpiresAt = expiresAt
+	}
+
+	return nil
+}
+
+func (f *fakeStore) Delete(ctx context.Context, key string) error {
+	delete(f.entries, key)
+	return nil
+}
+
+var start = time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+
+func newTestService() (*service, *time.Time) {
+	now := start
+	config := Config{
+		domain.ThrottleLogin: {
+			"email": {MaxAttempts: 3, Window: 10 * time.Minute, Lockout: time.Minute, MaxLockout: 4 * time.Minute},
+			"ip":    {MaxAttempts: 5, Window: 10 * time.Minute, Lockout: time.Minute, MaxLockout: time.Hour},
+		},
+	}
+
+	s := NewService(&fakeStore{entries: make(map[string]*domain.ThrottleEntry)}, config, log.NewZeroLog("", "", log.Error))
+	s.now = func() time.Time { return now }
+	return s, &now
+}
+
+func fail(t *testing.T, s *service, keys ...domain.ThrottleKey) {
+	require.NoError(t, s.Record(context.Background(), domain.ThrottleLogin, keys...))
+}
+
+func assertLocked(t *testing.T, err error) {
+	describer, ok := errors.RuleNotSatisfiedCast(err)
+	require.True(t, ok, "expected too many attempts, got %v", err)
+	assert.Equal(t, domain.ErrTooManyAttempts, describer.GetCode())
+}
+
+func TestService_LockoutBackoff(t *testing.T) {
+	s, now := newTestService()
+	ctx := context.Background()
+	email := domain.ThrottleEmail("User@Example.com")
+
+	fail(t, s, email)
+	fail(t, s, email)
+	assert.NoError(t, s.Allow(ctx, domain.ThrottleLogin, email))
+
+	fail(t, s, email)
+	assertLocked(t, s.Allow(ctx, domain.ThrottleLogin, email))
+	assertLocked(t, s.Allow(ctx, domain.ThrottleLogin, domain.ThrottleEmail("user@example.com ")))
+	assert.NoError(t, s.Allow(ctx, domain.ThrottleLogin, domain.ThrottleEmail("other@example.com")))
+
+	// each attempt after a lockout doubles it
+	*now = now.Add(time.Minute)
+	assert.NoError(t, s.Allow(ctx, domain.ThrottleLogin, email))
+	fail(t, s, email)
+	*now = now.Add(time.Minute + 59*time.Second)
+	assertLocked(t, s.Allow(ctx, domain.ThrottleLogin, email))
+	*now = now.Add(time.Second)
+	assert.NoError(t, s.Allow(ctx, domain.ThrottleLogin, email))
+
+	// capped at the max lockout
+	fail(t, s, email)
+	fail(t, s, email)
+	*now = now.Add(4 * time.Minute)
+	assert.NoError(t, s.Allow(ctx, domain.ThrottleLogin, email))
+}
+
+func TestService_WindowExpiration(t *testing.T) {
+	s, now := newTestService()
+	ctx := context.Background()
+	email := domain.ThrottleEmail("user@example.com")
+
+	fail(t, s, email)
+	fail(t, s, email)
+	*now = now.Add(10 * time.Minute)
+	fail(t, s, email)
+
+	assert.NoError(t, s.Allow(ctx, domain.ThrottleLogin, email))
+}
+
+func TestService_PerIPAndReset(t *testing.T) {
+	s, _ := newTestService()
+	ctx := context.Background()
+	ip := domain.ThrottleIP("10.0.0.1")
+
+	for i := 0; i < 5; i++ {
+		email := domain.ThrottleEmail(string(rune('a'+i)) + "@example.com")
+		require.NoError(t, s.Allow(ctx, domain.ThrottleLogin, email, ip))
+		fail(t, s, email, ip)
+	}
+
+	// a new account from the same address is refused with the same error
+	assertLocked(t, s.Allow(ctx, domain.ThrottleLogin, domain.ThrottleEmail("new@example.com"), ip))
+
+	email := domain.ThrottleEmail("user@example.com")
+	fail(t, s, email)
+	fail(t, s, email)
+	require.NoError(t, s.Reset(ctx, domain.ThrottleLogin, email))
+	fail(t, s, email)
+	assert.NoError(t, s.Allow(ctx, domain.ThrottleLogin, email))
+
+	// actions without a policy are not limited
+	for i := 0; i < 10; i++ {
+		require.NoError(t, s.Record(ctx, domain.ThrottleSignup, ip))
+	}
+	assert.NoError(t, s.Allow(ctx, domain.ThrottleSignup, ip))
+}
+
+func TestPolicy_Lockout(t *testing.T) {
+	p := Policy{MaxAttempts: 5, Lockout: time.Minute, MaxLockout: 10 * time.Minute}
+
+	assert.Equal(t, time.Minute, p.lockout(5))
+	assert.Equal(t, 2*time.Minute, p.lockout(6))
+	assert.Equal(t, 8*time.Minute, p.lockout(8))
+	assert.Equal(t, 10*time.Minute, p.lockout(9))
+	assert.Equal(t, 10*time.Minute, p.lockout(1000))
+}
@@ -0,0 +1,61 @@
+package domain
+
+import (
+	"context"
+	"time"
+
+	"gitlab.com/evzpav/user-auth/pkg/jwt"
+)
+
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+type AccessClaims struct {
+	jwt.Claims
+	Email string `json:"email,omitempty"`
+	// OrganizationID and OrganizationRole are the current organization of the user and their role
+	// in it, when any
+	OrganizationID   int     `json:"org_id,omitempty"`
+	OrganizationRole OrgRole `json:"org_role,omitempty"`
+}
+
+type RefreshToken struct {
+	ID        int        `json:"id"`
+	UserID    int        `json:"user_id"`
+	TokenHash string     `json:"-"`
+	FamilyID  string     `json:"family_id"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+	// OrganizationID is the organization the tokens are issued for, kept across refreshes
+	OrganizationID *int `json:"organization_id"`
+}
+
+type TokenService interface {
+	// Issue signs an access token and creates a refresh token, organizationID is the current
+	// organization of the user, nil when none
+	Issue(ctx context.Context, user *User, organizationID *int) (*TokenPair, error)
+	Refresh(ctx context.Context, refreshToken string) (*TokenPair, error)
+	Revoke(ctx context.Context, refreshToken string) error
+	RevokeAll(ctx context.Context, userID int) error
+	VerifyAccessToken(token string) (*AccessClaims, error)
+	JWKS() *jwt.JWKS
+	// Sign signs other tokens with the current key, e.g. ID tokens
+	Sign(claims interface{}) (string, error)
+	// VerifySignature only checks the token was signed by one of the keys, the claims must be
+	// validated by the caller
+	VerifySignature(token string, claims interface{}) error
+}
+
+type RefreshTokenStorage interface {
+	Insert(ctx context.Context, token *RefreshToken) error
+	FindByHash(ctx context.Context, hash string) (*RefreshToken, error)
+	MarkUsed(ctx context.Context, ID int, usedAt time.Time) (bool, error)
+	RevokeFamily(ctx context.Context, familyID string, revokedAt time.Time) error
+	RevokeByUserID(ctx context.Context, userID int, revokedAt time.Time) error
+}
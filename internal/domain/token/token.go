@@ -0,0 +1,289 @@
+package token
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/pkg/errors"
+	"gitlab.com/evzpav/user-auth/pkg/jwt"
+	"gitlab.com/evzpav/user-auth/pkg/log"
+)
+
+const tokenType = "Bearer"
+
+type Config struct {
+	Issuer          string
+	Audience        string
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+}
+
+type service struct {
+	signingKey  *jwt.Key
+	jwks        *jwt.JWKS
+	publicKeys  jwt.PublicKeys
+	storage     domain.RefreshTokenStorage
+	userService domain.UserService
+	orgService  domain.OrganizationService
+	config      Config
+	now         func() time.Time
+	log         log.Logger
+}
+
+// NewService creates the token service. Every key is published and accepted for verification,
+// the key matching signingKeyID (or the first one when empty) signs new tokens. orgService is
+// optional, when nil the tokens carry no organization.
+func NewService(keys []*jwt.Key, signingKeyID string, storage domain.RefreshTokenStorage, userService domain.UserService, orgService domain.OrganizationService, config Config, log log.Logger) (*service, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("at least one signing key is required")
+	}
+
+	signingKey := keys[0]
+	if signingKeyID != "" {
+		signingKey = nil
+		for _, key := range keys {
+			if key.ID == signingKeyID {
+				signingKey = key
+			}
+		}
+
+		if signingKey == nil {
+			return nil, fmt.Errorf("signing key %q not found", signingKeyID)
+		}
+	}
+
+	jwks, err := jwt.NewJWKS(keys...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &service{
+		signingKey:  signingKey,
+		jwks:        jwks,
+		publicKeys:  jwks.PublicKeys(),
+		storage:     storage,
+		userService: userService,
+		orgService:  orgService,
+		config:      config,
+		now:         time.Now,
+		log:         log,
+	}, nil
+}
+
+func (s *service) JWKS() *jwt.JWKS {
+	return s.jwks
+}
+
+func (s *service) Issue(ctx context.Context, user *domain.User, organizationID *int) (*domain.TokenPair, error) {
+	return s.issue(ctx, user, organizationID, uuid.NewV4().String())
+}
+
+func (s *service) issue(ctx context.Context, user *domain.User, organizationID *int, familyID string) (*domain.TokenPair, error) {
+	now := s.now()
+
+	organization, err := s.organization(ctx, user, organizationID)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := domain.AccessClaims{
+		Claims: jwt.Claims{
+			Issuer:    s.config.Issuer,
+			Subject:   strconv.Itoa(user.ID),
+			Audience:  s.config.Audience,
+			IssuedAt:  now.Unix(),
+			NotBefore: now.Unix(),
+			ExpiresAt: now.Add(s.config.AccessTokenTTL).Unix(),
+			ID:        uuid.NewV4().String(),
+		},
+		Email: user.Email,
+	}
+
+	if organization != nil {
+		claims.OrganizationID = organization.ID
+		claims.OrganizationRole = organization.Role
+	}
+
+	accessToken, err := jwt.Sign(s.signingKey, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := generateRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.storage.Insert(ctx, &domain.RefreshToken{
+		UserID:    user.ID,
+		TokenHash: hashToken(refreshToken),
+		FamilyID:  familyID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.config.RefreshTokenTTL),
+
+		OrganizationID: membershipID(organization),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    tokenType,
+		ExpiresIn:    int(s.config.AccessTokenTTL.Seconds()),
+	}, nil
+}
+
+// Refresh exchanges a refresh token for a new pair. Every refresh token can be used only once,
+// presenting an already used one revokes the whole family as it was probably stolen.
+func (s *service) Refresh(ctx context.Context, refreshToken string) (*domain.TokenPair, error) {
+	invalidToken := errors.NewNotAuthorized(domain.ErrInvalidToken).WithMessage("invalid refresh token")
+
+	stored, err := s.storage.FindByHash(ctx, hashToken(refreshToken))
+	if err != nil {
+		return nil, err
+	}
+
+	if stored == nil || stored.RevokedAt != nil {
+		return nil, invalidToken
+	}
+
+	now := s.now()
+
+	if stored.UsedAt != nil {
+		return nil, s.revokeReusedFamily(ctx, stored, now)
+	}
+
+	if !now.Before(stored.ExpiresAt) {
+		return nil, invalidToken
+	}
+
+	marked, err := s.storage.MarkUsed(ctx, stored.ID, now)
+	if err != nil {
+		return nil, err
+	}
+
+	// someone else used the same token concurrently
+	if !marked {
+		return nil, s.revokeReusedFamily(ctx, stored, now)
+	}
+
+	user, err := s.userService.FindByID(ctx, stored.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	if user == nil || !user.Active() {
+		return nil, invalidToken
+	}
+
+	return s.issue(ctx, user, stored.OrganizationID, stored.FamilyID)
+}
+
+// organization returns the membership of the user in the organization, nil when there is none or
+// the user left it, the tokens are then issued without organization
+func (s *service) organization(ctx context.Context, user *domain.User, organizationID *int) (*domain.UserOrganization, error) {
+	if s.orgService == nil || organizationID == nil {
+		return nil, nil
+	}
+
+	organization, err := s.orgService.Membership(ctx, *organizationID, user.ID)
+	if _, ok := errors.NotFoundCast(err); ok {
+		return nil, nil
+	}
+
+	return organization, err
+}
+
+func membershipID(organization *domain.UserOrganization) *int {
+	if organization == nil {
+		return nil
+	}
+
+	return &organization.ID
+}
+
+func (s *service) revokeReusedFamily(ctx context.Context, stored *domain.RefreshToken, now time.Time) error {
+	s.log.Warn().Sendf("refresh token reuse detected for user %d, revoking token family %s", stored.UserID, stored.FamilyID)
+
+	if err := s.storage.RevokeFamily(ctx, stored.FamilyID, now); err != nil {
+		return err
+	}
+
+	return errors.NewNotAuthorized(domain.ErrTokenReused).WithMessage("refresh token already used")
+}
+
+func (s *service) Revoke(ctx context.Context, refreshToken string) error {
+	stored, err := s.storage.FindByHash(ctx, hashToken(refreshToken))
+	if err != nil {
+		return err
+	}
+
+	// RFC 7009: invalid tokens do not cause an error
+	if stored == nil {
+		return nil
+	}
+
+	return s.storage.RevokeFamily(ctx, stored.FamilyID, s.now())
+}
+
+// RevokeAll revokes every refresh token of the user, the access tokens already issued stay valid
+// until they expire
+func (s *service) RevokeAll(ctx context.Context, userID int) error {
+	return s.storage.RevokeByUserID(ctx, userID, s.now())
+}
+
+func (s *service) VerifyAccessToken(token string) (*domain.AccessClaims, error) {
+	invalidToken := errors.NewNotAuthorized(domain.ErrInvalidToken).WithMessage("invalid access token")
+
+	var claims domain.AccessClaims
+	if err := jwt.Verify(token, s.publicKeys, &claims); err != nil {
+		return nil, invalidToken
+	}
+
+	if err := claims.Validate(s.now(), s.config.Issuer, s.config.Audience); err != nil {
+		return nil, invalidToken
+	}
+
+	// ID tokens are signed with the same keys, their audience is a client and never the API
+	if claims.Audience != s.config.Audience {
+		return nil, invalidToken
+	}
+
+	return &claims, nil
+}
+
+func (s *service) Sign(claims interface{}) (string, error) {
+	return jwt.Sign(s.signingKey, claims)
+}
+
+func (s *service) VerifySignature(token string, claims interface{}) error {
+	if err := jwt.Verify(token, s.publicKeys, claims); err != nil {
+		return errors.NewNotAuthorized(domain.ErrInvalidToken).WithMessage("invalid token signature")
+	}
+
+	return nil
+}
+
+func generateRefreshToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,270 @@
+package token
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/pkg/errors"
+	"gitlab.com/evzpav/user-auth/pkg/jwt"
+	"gitlab.com/evzpav/user-auth/pkg/log"
+)
+
+type fakeUserService struct {
+	domain.UserService
+	users map[int]*domain.User
+}
+
+func (f *fakeUserService) FindByID(ctx context.Context, ID int) (*domain.User, error) {
+	return f.users[ID], nil
+}
+
+// fakeOrgService knows the memberships by organization then user
+type fakeOrgService struct {
+	domain.OrganizationService
+	memberships map[int]map[int]domain.OrgRole
+}
+
+func (f *fakeOrgService) Membership(ctx context.Context, organizationID, userID int) (*domain.UserOrganization, error) {
+	role, ok := f.memberships[organizationID][userID]
+	if !ok {
+		return nil, errors.NewNotFound(domain.ErrOrgNotFound)
+	}
+
+	return &domain.UserOrganization{ID: organizationID, Name: "Acme", Role: role}, nil
+}
+
+type fakeRefreshTokenStorage struct {
+	tokens []*domain.RefreshToken
+}
+
+func (f *fakeRefreshTokenStorage) Insert(ctx context.Context, token *domain.RefreshToken) error {
+	token.ID = len(f.tokens) + 1
+	f.tokens = append(f.tokens, token)
+	return nil
+}
+
+func (f *fakeRefreshTokenStorage) FindByHash(ctx context.Context, hash string) (*domain.RefreshToken, error) {
+	for _, t := range f.tokens {
+		if t.TokenHash == hash {
+			copied := *t
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeRefreshTokenStorage) MarkUsed(ctx context.Context, ID int, usedAt time.Time) (bool, error) {
+	for _, t := range f.tokens {
+		if t.ID == ID && t.UsedAt == nil {
+			t.UsedAt = &usedAt
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (f *fakeRefreshTokenStorage) RevokeFamily(ctx context.Context, familyID string, revokedAt time.Time) error {
+	for _, t := range f.tokens {
+		if t.FamilyID == familyID && t.RevokedAt == nil {
+			t.RevokedAt = &revokedAt
+		}
+	}
+	return nil
+}
+
+func (f *fakeRefreshTokenStorage) RevokeByUserID(ctx context.Context, userID int, revokedAt time.Time) error {
+	for _, t := range f.tokens {
+		if t.UserID == userID && t.RevokedAt == nil {
+			t.RevokedAt = &revokedAt
+		}
+	}
+	return nil
+}
+
+func newTestService(t *testing.T) (*service, *fakeRefreshTokenStorage) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	key, err := jwt.NewKey("test", priv)
+	require.NoError(t, err)
+
+	storage := &fakeRefreshTokenStorage{}
+	users := &fakeUserService{users: map[int]*domain.User{7: {ID: 7, Email: "user@example.com"}, 8: {ID: 8, Email: "other@example.com"}}}
+
+	organizations := &fakeOrgService{memberships: map[int]map[int]domain.OrgRole{3: {7: domain.OrgRoleAdmin}}}
+
+	s, err := NewService([]*jwt.Key{key}, "", storage, users, organizations, Config{
+		Issuer:          "user-auth",
+		AccessTokenTTL:  time.Minute,
+		RefreshTokenTTL: time.Hour,
+	}, log.NewZeroLog("", "", log.Error))
+	require.NoError(t, err)
+
+	now := time.Unix(1600000000, 0)
+	s.now = func() time.Time { return now }
+
+	return s, storage
+}
+
+func TestService_IssueAndVerify(t *testing.T) {
+	s, _ := newTestService(t)
+
+	pair, err := s.Issue(context.Background(), &domain.User{ID: 7, Email: "user@example.com"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer", pair.TokenType)
+	assert.Equal(t, 60, pair.ExpiresIn)
+
+	claims, err := s.VerifyAccessToken(pair.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, "7", claims.Subject)
+	assert.Equal(t, "user@example.com", claims.Email)
+
+	s.now = func() time.Time { return time.Unix(1600000000, 0).Add(time.Minute) }
+	_, err = s.VerifyAccessToken(pair.AccessToken)
+	_, ok := errors.NotAuthorizedCast(err)
+	assert.True(t, ok)
+}
+
+func TestService_RefreshRotation(t *testing.T) {
+	s, storage := newTestService(t)
+	ctx := context.Background()
+
+	first, err := s.Issue(ctx, &domain.User{ID: 7}, nil)
+	require.NoError(t, err)
+
+	second, err := s.Refresh(ctx, first.RefreshToken)
+	require.NoError(t, err)
+	assert.NotEqual(t, first.RefreshToken, second.RefreshToken)
+	assert.Equal(t, storage.tokens[0].FamilyID, storage.tokens[1].FamilyID)
+
+	// replaying the first token revokes the whole family, including the second token
+	_, err = s.Refresh(ctx, first.RefreshToken)
+	describer, ok := errors.NotAuthorizedCast(err)
+	require.True(t, ok)
+	assert.Equal(t, domain.ErrTokenReused, describer.GetCode())
+
+	_, err = s.Refresh(ctx, second.RefreshToken)
+	describer, ok = errors.NotAuthorizedCast(err)
+	require.True(t, ok)
+	assert.Equal(t, domain.ErrInvalidToken, describer.GetCode())
+}
+
+func TestService_RefreshExpired(t *testing.T) {
+	s, _ := newTestService(t)
+	ctx := context.Background()
+
+	pair, err := s.Issue(ctx, &domain.User{ID: 7}, nil)
+	require.NoError(t, err)
+
+	s.now = func() time.Time { return time.Unix(1600000000, 0).Add(time.Hour) }
+
+	_, err = s.Refresh(ctx, pair.RefreshToken)
+	_, ok := errors.NotAuthorizedCast(err)
+	assert.True(t, ok)
+}
+
+func TestService_Revoke(t *testing.T) {
+	s, _ := newTestService(t)
+	ctx := context.Background()
+
+	pair, err := s.Issue(ctx, &domain.User{ID: 7}, nil)
+	require.NoError(t, err)
+
+	require.NoError(t, s.Revoke(ctx, pair.RefreshToken))
+	require.NoError(t, s.Revoke(ctx, "unknown"))
+
+	_, err = s.Refresh(ctx, pair.RefreshToken)
+	_, ok := errors.NotAuthorizedCast(err)
+	assert.True(t, ok)
+}
+
+func TestService_RevokeAll(t *testing.T) {
+	s, _ := newTestService(t)
+	ctx := context.Background()
+
+	first, err := s.Issue(ctx, &domain.User{ID: 7}, nil)
+	require.NoError(t, err)
+	second, err := s.Issue(ctx, &domain.User{ID: 7}, nil)
+	require.NoError(t, err)
+	other, err := s.Issue(ctx, &domain.User{ID: 8}, nil)
+	require.NoError(t, err)
+
+	require.NoError(t, s.RevokeAll(ctx, 7))
+
+	for _, pair := range []*domain.TokenPair{first, second} {
+		_, err = s.Refresh(ctx, pair.RefreshToken)
+		_, ok := errors.NotAuthorizedCast(err)
+		assert.True(t, ok)
+	}
+
+	_, err = s.Refresh(ctx, other.RefreshToken)
+	assert.NoError(t, err)
+}
+
+func TestService_SignedTokensAreNotAccessTokens(t *testing.T) {
+	s, _ := newTestService(t)
+	now := s.now()
+
+	idToken, err := s.Sign(jwt.Claims{
+		Issuer:    "user-auth",
+		Subject:   "7",
+		Audience:  "client",
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(time.Minute).Unix(),
+	})
+	require.NoError(t, err)
+
+	var claims jwt.Claims
+	require.NoError(t, s.VerifySignature(idToken, &claims))
+	assert.Equal(t, "client", claims.Audience)
+
+	_, err = s.VerifyAccessToken(idToken)
+	_, ok := errors.NotAuthorizedCast(err)
+	assert.True(t, ok)
+
+	err = s.VerifySignature(idToken+"x", &claims)
+	_, ok = errors.NotAuthorizedCast(err)
+	assert.True(t, ok)
+}
+
+func TestService_Organization(t *testing.T) {
+	s, _ := newTestService(t)
+	ctx := context.Background()
+	organizationID := 3
+
+	pair, err := s.Issue(ctx, &domain.User{ID: 7}, &organizationID)
+	require.NoError(t, err)
+
+	claims, err := s.VerifyAccessToken(pair.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, 3, claims.OrganizationID)
+	assert.Equal(t, domain.OrgRoleAdmin, claims.OrganizationRole)
+
+	// the organization is kept across refreshes while the user is a member
+	refreshed, err := s.Refresh(ctx, pair.RefreshToken)
+	require.NoError(t, err)
+	claims, err = s.VerifyAccessToken(refreshed.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, 3, claims.OrganizationID)
+
+	delete(s.orgService.(*fakeOrgService).memberships[3], 7)
+	refreshed, err = s.Refresh(ctx, refreshed.RefreshToken)
+	require.NoError(t, err)
+	claims, err = s.VerifyAccessToken(refreshed.AccessToken)
+	require.NoError(t, err)
+	assert.Zero(t, claims.OrganizationID)
+	assert.Empty(t, claims.OrganizationRole)
+
+	// other users get no organization claims
+	pair, err = s.Issue(ctx, &domain.User{ID: 8}, &organizationID)
+	require.NoError(t, err)
+	claims, err = s.VerifyAccessToken(pair.AccessToken)
+	require.NoError(t, err)
+	assert.Zero(t, claims.OrganizationID)
+}
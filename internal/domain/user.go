@@ -3,18 +3,31 @@ package domain
 import (
 	"context"
 	"fmt"
+	"time"
 )
 
 type User struct {
-	ID            int    `json:"id"`
-	Name          string `json:"name"`
-	Address       string `json:"address"`
-	Email         string `json:"email"`
-	Password      string `json:"password"`
-	Phone         string `json:"phone"`
-	Token         string `json:"token"`
-	RecoveryToken string `json:"recovery_token"`
-	GoogleID      string `json:"google_id"`
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	Address  string `json:"address"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	Phone    string `json:"phone"`
+
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+
+	TOTPSecret       string `json:"-"`
+	TOTPEnabled      bool   `json:"totp_enabled"`
+	TOTPLastStep     int64  `json:"-"`
+	MFARecoveryCodes string `json:"-"`
+
+	// DisabledAt is set when an admin disabled the account, disabled users cannot sign in
+	DisabledAt *time.Time `json:"disabled_at"`
+	// DeletedAt is set when an admin deleted the account, the record is kept so it can be restored
+	DeletedAt *time.Time `json:"deleted_at"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
 }
 
 func (u *User) Validate() error {
@@ -22,29 +35,80 @@ func (u *User) Validate() error {
 		return fmt.Errorf("invalid email")
 	}
 
-	if len(u.Password) < 5 {
+	// users signed up with a login provider have no password until they set one
+	if u.Password != "" && len(u.Password) < 5 {
 		return fmt.Errorf("invalid password")
 	}
 
 	return nil
 }
 
+// EmailVerified tells whether the user proved to own the current email address
+func (u *User) EmailVerified() bool {
+	return u.EmailVerifiedAt != nil
+}
+
+// Disabled tells whether the account was disabled by an admin
+func (u *User) Disabled() bool {
+	return u.DisabledAt != nil
+}
+
+// Deleted tells whether the account was deleted by an admin
+func (u *User) Deleted() bool {
+	return u.DeletedAt != nil
+}
+
+// Active tells whether the user may sign in and keep using their sessions and tokens
+func (u *User) Active() bool {
+	return !u.Disabled() && !u.Deleted()
+}
+
+// HasPassword tells whether the user can sign in with a password
+func (u *User) HasPassword() bool {
+	return u.Password != ""
+}
+
 type UserService interface {
 	Create(ctx context.Context, user *User) error
 	FindByEmail(ctx context.Context, email string) (*User, error)
-	FindByToken(ctx context.Context, token string) (*User, error)
-	FindByRecoveryToken(ctx context.Context, token string) (*User, error)
-	FindByGoogleID(ctx context.Context, token string) (*User, error)
 	FindByID(ctx context.Context, ID int) (*User, error)
 	Update(ctx context.Context, user *User) error
+	List(ctx context.Context, filter *UserFilter) ([]*User, error)
+	Count(ctx context.Context, filter *UserFilter) (int, error)
+	UseTOTPStep(ctx context.Context, userID int, step int64) (bool, error)
+	ReplaceRecoveryCodes(ctx context.Context, userID int, current, replacement string) (bool, error)
+}
+
+// UserFilter selects the users to list, the zero value lists every user
+type UserFilter struct {
+	// Query matches the email and the name, case insensitively
+	Query string
+	// EmailPrefix matches the start of the email, case insensitively
+	EmailPrefix string
+	// Provider selects the users with an account of the login provider linked
+	Provider      string
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	Disabled      *bool
+	Deleted       *bool
+
+	// Limit and Offset page the results ordered by ID, they are ignored by Count
+	Limit  int
+	Offset int
 }
 
 type UserStorage interface {
 	Insert(ctx context.Context, user *User) error
 	FindByEmail(ctx context.Context, email string) (*User, error)
-	FindByToken(ctx context.Context, token string) (*User, error)
-	FindByRecoveryToken(ctx context.Context, token string) (*User, error)
-	FindByGoogleID(ctx context.Context, token string) (*User, error)
 	FindByID(ctx context.Context, ID int) (*User, error)
 	Update(ctx context.Context, user *User) error
+	// List returns the users of the filter ordered by ID
+	List(ctx context.Context, filter *UserFilter) ([]*User, error)
+	Count(ctx context.Context, filter *UserFilter) (int, error)
+	// UseTOTPStep records the time step of an accepted TOTP code in a single statement. It returns
+	// false when the recorded step is not older, i.e. the code was already used.
+	UseTOTPStep(ctx context.Context, userID int, step int64) (bool, error)
+	// ReplaceRecoveryCodes stores the replacement only if the recovery codes are still the current
+	// ones, it returns false when they were changed meanwhile
+	ReplaceRecoveryCodes(ctx context.Context, userID int, current, replacement string) (bool, error)
 }
@@ -2,6 +2,7 @@ package user
 
 import (
 	"context"
+	"strings"
 
 	"gitlab.com/evzpav/user-auth/internal/domain"
 	"gitlab.com/evzpav/user-auth/pkg/log"
@@ -39,18 +40,31 @@ func (us *service) FindByEmail(ctx context.Context, email string) (*domain.User,
 	return us.storage.FindByEmail(ctx, email)
 }
 
-func (us *service) FindByToken(ctx context.Context, token string) (*domain.User, error) {
-	return us.storage.FindByToken(ctx, token)
+func (us *service) FindByID(ctx context.Context, id int) (*domain.User, error) {
+	return us.storage.FindByID(ctx, id)
 }
 
-func (us *service) FindByRecoveryToken(ctx context.Context, token string) (*domain.User, error) {
-	return us.storage.FindByRecoveryToken(ctx, token)
+func (us *service) List(ctx context.Context, filter *domain.UserFilter) ([]*domain.User, error) {
+	return us.storage.List(ctx, normalizeFilter(filter))
 }
 
-func (us *service) FindByGoogleID(ctx context.Context, token string) (*domain.User, error) {
-	return us.storage.FindByGoogleID(ctx, token)
+func (us *service) Count(ctx context.Context, filter *domain.UserFilter) (int, error) {
+	return us.storage.Count(ctx, normalizeFilter(filter))
 }
 
-func (us *service) FindByID(ctx context.Context, id int) (*domain.User, error) {
-	return us.storage.FindByID(ctx, id)
+func (us *service) UseTOTPStep(ctx context.Context, userID int, step int64) (bool, error) {
+	return us.storage.UseTOTPStep(ctx, userID, step)
+}
+
+func (us *service) ReplaceRecoveryCodes(ctx context.Context, userID int, current, replacement string) (bool, error) {
+	return us.storage.ReplaceRecoveryCodes(ctx, userID, current, replacement)
+}
+
+// normalizeFilter trims the text filters, a copy is returned so the caller's filter is unchanged
+func normalizeFilter(filter *domain.UserFilter) *domain.UserFilter {
+	normalized := *filter
+	normalized.Query = strings.TrimSpace(normalized.Query)
+	normalized.EmailPrefix = strings.TrimSpace(normalized.EmailPrefix)
+	normalized.Provider = strings.TrimSpace(normalized.Provider)
+	return &normalized
 }
@@ -0,0 +1,74 @@
+package domain
+
+import (
+	"context"
+	"time"
+
+	"gitlab.com/evzpav/user-auth/pkg/webauthn"
+)
+
+// WebAuthnCredential is a passkey or security key registered by a user. CredentialID is base64url
+// encoded, PublicKey is the COSE encoded key of the credential.
+type WebAuthnCredential struct {
+	ID           int        `json:"id"`
+	UserID       int        `json:"user_id"`
+	Name         string     `json:"name"`
+	CredentialID string     `json:"credential_id"`
+	PublicKey    []byte     `json:"-"`
+	SignCount    uint32     `json:"-"`
+	Transports   string     `json:"-"`
+	CreatedAt    time.Time  `json:"created_at"`
+	LastUsedAt   *time.Time `json:"last_used_at"`
+}
+
+// Ceremonies of a WebAuthnChallenge
+const (
+	WebAuthnRegistration = "register"
+	WebAuthnLogin        = "login"
+)
+
+// WebAuthnChallenge is the challenge of a ceremony, it is kept on the server until the browser
+// returns the response of the authenticator. The browser holds a random nonce, only the hash of the
+// nonce is stored. UserID is 0 for the login ceremony.
+type WebAuthnChallenge struct {
+	ID        int       `json:"id"`
+	NonceHash string    `json:"-"`
+	Ceremony  string    `json:"ceremony"`
+	UserID    int       `json:"user_id"`
+	Challenge string    `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// WebAuthnService runs the registration and login ceremonies. The Begin methods keep the challenge
+// on the server and return a nonce the caller gives back to the Finish methods, a nonce is used once
+// whether the ceremony succeeds or not.
+type WebAuthnService interface {
+	BeginRegistration(ctx context.Context, user *User) (*webauthn.CreationOptions, string, error)
+	FinishRegistration(ctx context.Context, user *User, nonce, name string, resp *webauthn.RegistrationResponse) (*WebAuthnCredential, error)
+	BeginLogin(ctx context.Context) (*webauthn.RequestOptions, string, error)
+	FinishLogin(ctx context.Context, nonce string, resp *webauthn.AssertionResponse) (*User, error)
+	List(ctx context.Context, userID int) ([]*WebAuthnCredential, error)
+	Rename(ctx context.Context, userID, ID int, name string) error
+	Delete(ctx context.Context, userID, ID int) error
+}
+
+type WebAuthnCredentialStorage interface {
+	Insert(ctx context.Context, credential *WebAuthnCredential) error
+	FindByCredentialID(ctx context.Context, credentialID string) (*WebAuthnCredential, error)
+	FindByUserID(ctx context.Context, userID int) ([]*WebAuthnCredential, error)
+	// UpdateSignCount returns false when the stored counter is not lower than signCount anymore, so
+	// concurrent assertions with the same counter do not both succeed. A counter of 0 is only kept by
+	// the authenticators without counter.
+	UpdateSignCount(ctx context.Context, ID int, signCount uint32, lastUsedAt time.Time) (bool, error)
+	Rename(ctx context.Context, userID, ID int, name string) error
+	Delete(ctx context.Context, userID, ID int) error
+}
+
+type WebAuthnChallengeStorage interface {
+	Insert(ctx context.Context, challenge *WebAuthnChallenge) error
+	// Take deletes the challenge of the nonce hash and returns it, it returns nil when the challenge
+	// was already taken so a challenge is only used once
+	Take(ctx context.Context, nonceHash string) (*WebAuthnChallenge, error)
+	DeleteExpired(ctx context.Context, now time.Time) error
+}
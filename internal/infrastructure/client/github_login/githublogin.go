@@ -0,0 +1,145 @@
+package githublogin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/github"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/pkg/oidc"
+)
+
+// apiURL is the REST API of github.com
+const apiURL = "https://api.github.com"
+
+// githubUser is the part of the profile of GET /user used by the provider
+type githubUser struct {
+	ID    int64  `json:"id"`
+	Login string `json:"login"`
+	Name  string `json:"name"`
+}
+
+// githubEmail is an address of GET /user/emails
+type githubEmail struct {
+	Email    string `json:"email"`
+	Primary  bool   `json:"primary"`
+	Verified bool   `json:"verified"`
+}
+
+// provider signs users in with GitHub, which implements OAuth2 but not OpenID Connect, so the
+// account is read from the API instead of an ID token
+type provider struct {
+	config *oauth2.Config
+	apiURL string
+}
+
+func New(clientID, clientSecret, redirectURL string) *provider {
+	return NewWithEndpoint(clientID, clientSecret, redirectURL, github.Endpoint, apiURL)
+}
+
+// NewWithEndpoint creates the provider of a server implementing the GitHub endpoints, e.g. GitHub
+// Enterprise or the stand-in server of githublogintest
+func NewWithEndpoint(clientID, clientSecret, redirectURL string, endpoint oauth2.Endpoint, apiURL string) *provider {
+	return &provider{
+		config: &oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			RedirectURL:  redirectURL,
+			Scopes:       []string{"read:user", "user:email"},
+			Endpoint:     endpoint,
+		},
+		apiURL: strings.TrimRight(apiURL, "/"),
+	}
+}
+
+func (p *provider) Name() string {
+	return "github"
+}
+
+func (p *provider) DisplayName() string {
+	return "GitHub"
+}
+
+// AuthURL ignores the nonce, there is no ID token to carry it
+func (p *provider) AuthURL(ctx context.Context, state, nonce, codeVerifier string) (string, error) {
+	return p.config.AuthCodeURL(state,
+		oauth2.SetAuthURLParam("code_challenge", oidc.CodeChallenge(codeVerifier)),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+	), nil
+}
+
+// Exchange returns the account with its primary email, which is only verified when GitHub
+// verified it
+func (p *provider) Exchange(ctx context.Context, code, nonce, codeVerifier string) (*domain.ExternalUser, error) {
+	token, err := p.config.Exchange(ctx, code, oauth2.SetAuthURLParam("code_verifier", codeVerifier))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get token: %v", err)
+	}
+
+	client := p.config.Client(ctx, token)
+
+	var user githubUser
+	if err := p.get(ctx, client, "/user", &user); err != nil {
+		return nil, err
+	}
+
+	if user.ID == 0 {
+		return nil, fmt.Errorf("github user without id")
+	}
+
+	var emails []githubEmail
+	if err := p.get(ctx, client, "/user/emails", &emails); err != nil {
+		return nil, err
+	}
+
+	externalUser := &domain.ExternalUser{
+		Provider: p.Name(),
+		Subject:  strconv.FormatInt(user.ID, 10),
+		Name:     user.Name,
+	}
+
+	if externalUser.Name == "" {
+		externalUser.Name = user.Login
+	}
+
+	for _, email := range emails {
+		if email.Primary {
+			externalUser.Email = email.Email
+			externalUser.EmailVerified = email.Verified
+			break
+		}
+	}
+
+	return externalUser, nil
+}
+
+func (p *provider) get(ctx context.Context, client *http.Client, path string, v interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, p.apiURL+path, nil)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("failed to get %s: %v", path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to get %s: status %d", path, resp.StatusCode)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode %s: %v", path, err)
+	}
+
+	return nil
+}
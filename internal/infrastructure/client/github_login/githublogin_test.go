@@ -0,0 +1,90 @@
+package githublogin_test
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/internal/infrastructure/client/github_login/githublogintest"
+	"gitlab.com/evzpav/user-auth/pkg/oidc"
+)
+
+const redirectURL = "http://localhost/login/github/callback"
+
+// login follows the login url to the stand-in server and exchanges the code it redirects back
+// with, using verifier when set instead of the one of the challenge
+func login(t *testing.T, provider domain.LoginProvider, verifier string) (*domain.ExternalUser, error) {
+	ctx := context.Background()
+	codeVerifier, err := oidc.NewCodeVerifier()
+	require.NoError(t, err)
+
+	authURL, err := provider.AuthURL(ctx, "state-1", "", codeVerifier)
+	require.NoError(t, err)
+
+	noRedirect := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := noRedirect.Get(authURL)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	require.NoError(t, err)
+	assert.Equal(t, "state-1", location.Query().Get("state"))
+
+	if verifier == "" {
+		verifier = codeVerifier
+	}
+
+	return provider.Exchange(ctx, location.Query().Get("code"), "", verifier)
+}
+
+func TestProvider_Exchange(t *testing.T) {
+	server := githublogintest.NewServer()
+	defer server.Close()
+	provider := server.Provider(redirectURL)
+	assert.Equal(t, "github", provider.Name())
+
+	server.SignIn(&githublogintest.User{
+		ID:    1001,
+		Login: "octocat",
+		Emails: []githublogintest.Email{
+			{Email: "old@example.com", Verified: true},
+			{Email: "octocat@example.com", Primary: true, Verified: true},
+		},
+	})
+
+	user, err := login(t, provider, "")
+	require.NoError(t, err)
+	assert.Equal(t, &domain.ExternalUser{
+		Provider:      "github",
+		Subject:       "1001",
+		Email:         "octocat@example.com",
+		EmailVerified: true,
+		Name:          "octocat",
+	}, user)
+
+	server.SignIn(&githublogintest.User{
+		ID:     1002,
+		Login:  "unverified",
+		Name:   "Unverified User",
+		Emails: []githublogintest.Email{{Email: "unverified@example.com", Primary: true}},
+	})
+
+	user, err = login(t, provider, "")
+	require.NoError(t, err)
+	assert.Equal(t, "Unverified User", user.Name)
+	assert.False(t, user.EmailVerified, "only the verified primary email is trusted")
+
+	other, err := oidc.NewCodeVerifier()
+	require.NoError(t, err)
+	_, err = login(t, provider, other)
+	assert.Error(t, err, "the code verifier does not match the challenge")
+
+	server.SignIn(nil)
+	_, err = login(t, provider, "")
+	assert.Error(t, err, "the user denied the consent")
+}
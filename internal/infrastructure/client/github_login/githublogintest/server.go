@@ -0,0 +1,238 @@
+// Package githublogintest provides a stand-in for the GitHub OAuth server and API, so the GitHub
+// login runs in tests without reaching GitHub.
+package githublogintest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+
+	"golang.org/x/oauth2"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	githublogin "gitlab.com/evzpav/user-auth/internal/infrastructure/client/github_login"
+	"gitlab.com/evzpav/user-auth/pkg/oidc"
+)
+
+const (
+	ClientID     = "test-client-id"
+	ClientSecret = "test-client-secret"
+)
+
+// User is the account signed in at GitHub
+type User struct {
+	ID     int64
+	Login  string
+	Name   string
+	Emails []Email
+}
+
+// Email is an address of the account
+type Email struct {
+	Email    string
+	Primary  bool
+	Verified bool
+}
+
+type grant struct {
+	user          User
+	redirectURI   string
+	codeChallenge string
+}
+
+// Server implements the authorization and token endpoints and GET /api/user and
+// GET /api/user/emails. The consent screen is skipped: the authorization endpoint redirects back
+// at once with a code of the account given to SignIn, or with access_denied when there is none.
+type Server struct {
+	*httptest.Server
+
+	mu     sync.Mutex
+	user   *User
+	codes  map[string]grant
+	tokens map[string]User
+}
+
+// NewServer starts the server, it has to be closed by the caller
+func NewServer() *Server {
+	s := &Server{
+		codes:  make(map[string]grant),
+		tokens: make(map[string]User),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login/oauth/authorize", s.authorize)
+	mux.HandleFunc("/login/oauth/access_token", s.token)
+	mux.HandleFunc("/api/user", s.userProfile)
+	mux.HandleFunc("/api/user/emails", s.userEmails)
+	s.Server = httptest.NewServer(mux)
+
+	return s
+}
+
+// SignIn sets the account that consents to the next authorizations, nil denies them
+func (s *Server) SignIn(user *User) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.user = user
+}
+
+func (s *Server) Endpoint() oauth2.Endpoint {
+	return oauth2.Endpoint{
+		AuthURL:  s.URL + "/login/oauth/authorize",
+		TokenURL: s.URL + "/login/oauth/access_token",
+	}
+}
+
+func (s *Server) APIURL() string {
+	return s.URL + "/api"
+}
+
+// Provider creates a githublogin provider of the server
+func (s *Server) Provider(redirectURL string) domain.LoginProvider {
+	return githublogin.NewWithEndpoint(ClientID, ClientSecret, redirectURL, s.Endpoint(), s.APIURL())
+}
+
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	redirectURI, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil || redirectURI.Host == "" || query.Get("client_id") != ClientID {
+		http.Error(w, "invalid authorization request", http.StatusBadRequest)
+		return
+	}
+
+	if query.Get("code_challenge") != "" && query.Get("code_challenge_method") != "S256" {
+		http.Error(w, "only S256 code challenges are supported", http.StatusBadRequest)
+		return
+	}
+
+	params := redirectURI.Query()
+	params.Set("state", query.Get("state"))
+
+	s.mu.Lock()
+	if s.user == nil {
+		params.Set("error", "access_denied")
+	} else {
+		code := randomString()
+		s.codes[code] = grant{
+			user:          *s.user,
+			redirectURI:   query.Get("redirect_uri"),
+			codeChallenge: query.Get("code_challenge"),
+		}
+		params.Set("code", code)
+	}
+	s.mu.Unlock()
+
+	redirectURI.RawQuery = params.Encode()
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+// token answers in JSON, GitHub only does when asked with the Accept header, which the oauth2
+// package handles either way
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientID, clientSecret = r.FormValue("client_id"), r.FormValue("client_secret")
+	}
+
+	if clientID != ClientID || clientSecret != ClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "incorrect_client_credentials"})
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// codes are single use, like the real ones
+	code := r.FormValue("code")
+	grant, ok := s.codes[code]
+	delete(s.codes, code)
+	if !ok || grant.redirectURI != r.FormValue("redirect_uri") {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "bad_verification_code"})
+		return
+	}
+
+	if grant.codeChallenge != "" && oidc.CodeChallenge(r.FormValue("code_verifier")) != grant.codeChallenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "bad_verification_code"})
+		return
+	}
+
+	accessToken := randomString()
+	s.tokens[accessToken] = grant.user
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": accessToken,
+		"token_type":   "bearer",
+		"scope":        "read:user,user:email",
+	})
+}
+
+func (s *Server) authorizedUser(w http.ResponseWriter, r *http.Request) (User, bool) {
+	accessToken := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+	s.mu.Lock()
+	user, ok := s.tokens[accessToken]
+	s.mu.Unlock()
+
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"message": "Bad credentials"})
+	}
+
+	return user, ok
+}
+
+func (s *Server) userProfile(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.authorizedUser(w, r)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"id":    user.ID,
+		"login": user.Login,
+		"name":  user.Name,
+	})
+}
+
+func (s *Server) userEmails(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.authorizedUser(w, r)
+	if !ok {
+		return
+	}
+
+	emails := make([]map[string]interface{}, 0, len(user.Emails))
+	for _, email := range user.Emails {
+		emails = append(emails, map[string]interface{}{
+			"email":    email.Email,
+			"primary":  email.Primary,
+			"verified": email.Verified,
+		})
+	}
+
+	writeJSON(w, http.StatusOK, emails)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func randomString() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+
+	return hex.EncodeToString(b)
+}
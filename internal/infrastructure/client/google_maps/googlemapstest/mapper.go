@@ -0,0 +1,29 @@
+// Package googlemapstest provides a fake domain.GoogleMapper
+package googlemapstest
+
+import (
+	"strings"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+)
+
+// Mapper suggests the first of Addresses starting with the input, ignoring case, and nothing when
+// none does. Err is returned instead when set.
+type Mapper struct {
+	Addresses []string
+	Err       error
+}
+
+func (m *Mapper) GetAddressSuggestion(input string) (*domain.AutocompletePrediction, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+
+	for _, address := range m.Addresses {
+		if strings.HasPrefix(strings.ToLower(address), strings.ToLower(input)) {
+			return &domain.AutocompletePrediction{Suggestion: address}, nil
+		}
+	}
+
+	return &domain.AutocompletePrediction{Suggestion: ""}, nil
+}
@@ -0,0 +1,56 @@
+package oidclogin
+
+import (
+	"context"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/pkg/oidc"
+)
+
+type provider struct {
+	name        string
+	displayName string
+	client      *oidc.Client
+}
+
+// New creates the login provider of an OpenID Connect provider. name is the path segment of its
+// routes, /login/{name}, and displayName the text of its button on the login page.
+func New(name, displayName string, config oidc.Config) (*provider, error) {
+	client, err := oidc.New(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &provider{
+		name:        name,
+		displayName: displayName,
+		client:      client,
+	}, nil
+}
+
+func (p *provider) Name() string {
+	return p.name
+}
+
+func (p *provider) DisplayName() string {
+	return p.displayName
+}
+
+func (p *provider) AuthURL(ctx context.Context, state, nonce, codeVerifier string) (string, error) {
+	return p.client.AuthCodeURL(ctx, state, nonce, codeVerifier)
+}
+
+func (p *provider) Exchange(ctx context.Context, code, nonce, codeVerifier string) (*domain.ExternalUser, error) {
+	idToken, err := p.client.Exchange(ctx, code, nonce, codeVerifier)
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.ExternalUser{
+		Provider:      p.name,
+		Subject:       idToken.Subject,
+		Email:         idToken.Email,
+		EmailVerified: bool(idToken.EmailVerified),
+		Name:          idToken.Name,
+	}, nil
+}
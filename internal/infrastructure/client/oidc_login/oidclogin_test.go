@@ -0,0 +1,47 @@
+package oidclogin
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/pkg/oidc/oidctest"
+)
+
+func TestProvider(t *testing.T) {
+	server := oidctest.NewServer()
+	defer server.Close()
+	server.SignIn(&oidctest.User{Subject: "sub-1", Email: "user@example.com", EmailVerified: true, Name: "User"})
+
+	p, err := New("keycloak", "Keycloak", server.Config("http://localhost/login/keycloak/callback"))
+	require.NoError(t, err)
+	assert.Equal(t, "keycloak", p.Name())
+	assert.Equal(t, "Keycloak", p.DisplayName())
+
+	ctx := context.Background()
+	authURL, err := p.AuthURL(ctx, "state", "nonce", "verifier-verifier-verifier-verifier-verifier")
+	require.NoError(t, err)
+
+	noRedirect := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := noRedirect.Get(authURL)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	require.NoError(t, err)
+
+	user, err := p.Exchange(ctx, location.Query().Get("code"), "nonce", "verifier-verifier-verifier-verifier-verifier")
+	require.NoError(t, err)
+	assert.Equal(t, &domain.ExternalUser{
+		Provider:      "keycloak",
+		Subject:       "sub-1",
+		Email:         "user@example.com",
+		EmailVerified: true,
+		Name:          "User",
+	}, user)
+}
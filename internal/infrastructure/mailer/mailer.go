@@ -0,0 +1,19 @@
+// Package mailer holds the drivers delivering the emails of the application
+package mailer
+
+import (
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/pkg/mail"
+)
+
+func encode(from string, email *domain.Email) ([]byte, error) {
+	message := &mail.Message{
+		From:    from,
+		To:      []string{email.To},
+		Subject: email.Subject,
+		Text:    email.Text,
+		HTML:    email.HTML,
+	}
+
+	return message.Bytes()
+}
@@ -0,0 +1,163 @@
+package mailer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/evzpav/user-auth/internal/domain"
+)
+
+var testEmail = &domain.Email{
+	To:      "user@example.com",
+	Subject: "Verify your email - user-auth",
+	Text:    "Open the link",
+	HTML:    "<p>Open the link</p>",
+}
+
+func TestMemory(t *testing.T) {
+	m := NewMemory("no-reply@example.com")
+
+	require.NoError(t, m.Send(context.Background(), testEmail))
+	require.Len(t, m.Emails(), 1)
+	assert.Equal(t, *testEmail, m.Emails()[0])
+	assert.Contains(t, string(m.Raw()[0]), "From: no-reply@example.com\r\n")
+
+	assert.Error(t, m.Send(context.Background(), &domain.Email{To: "user@example.com\r\nBcc: other@example.com"}))
+	assert.Len(t, m.Emails(), 1)
+
+	m.Reset()
+	assert.Empty(t, m.Emails())
+}
+
+func TestOutbox(t *testing.T) {
+	var out bytes.Buffer
+	m, err := NewOutbox("no-reply@example.com", "", &out)
+	require.NoError(t, err)
+	require.NoError(t, m.Send(context.Background(), testEmail))
+	assert.Contains(t, out.String(), "To: user@example.com\r\n")
+
+	dir, err := ioutil.TempDir("", "outbox")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	m, err = NewOutbox("no-reply@example.com", filepath.Join(dir, "emails"), nil)
+	require.NoError(t, err)
+	require.NoError(t, m.Send(context.Background(), testEmail))
+	require.NoError(t, m.Send(context.Background(), testEmail))
+
+	files, err := filepath.Glob(filepath.Join(dir, "emails", "*.eml"))
+	require.NoError(t, err)
+	assert.Len(t, files, 2)
+}
+
+// serveSMTP answers a single SMTP conversation without TLS nor authentication and returns the
+// received message
+func serveSMTP(ln net.Listener) <-chan string {
+	received := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		tp := textproto.NewConn(conn)
+		_ = tp.PrintfLine("220 localhost ESMTP")
+		for {
+			line, err := tp.ReadLine()
+			if err != nil {
+				return
+			}
+
+			switch cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0]); cmd {
+			case "EHLO", "HELO":
+				_ = tp.PrintfLine("250 localhost")
+			case "DATA":
+				_ = tp.PrintfLine("354 go ahead")
+				data, _ := ioutil.ReadAll(tp.DotReader())
+				received <- string(data)
+				_ = tp.PrintfLine("250 queued")
+			case "QUIT":
+				_ = tp.PrintfLine("221 bye")
+				return
+			default:
+				_ = tp.PrintfLine("250 ok")
+			}
+		}
+	}()
+
+	return received
+}
+
+func TestSMTP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	received := serveSMTP(ln)
+	addr := ln.Addr().(*net.TCPAddr)
+
+	m, err := NewSMTP(SMTPConfig{Host: "127.0.0.1", Port: addr.Port, TLS: TLSNone, From: "user-auth <no-reply@example.com>"})
+	require.NoError(t, err)
+	require.NoError(t, m.Send(context.Background(), testEmail))
+
+	msg := <-received
+	header, err := textproto.NewReader(bufio.NewReader(strings.NewReader(msg))).ReadMIMEHeader()
+	require.NoError(t, err)
+	assert.Equal(t, "user@example.com", header.Get("To"))
+	assert.Equal(t, "user-auth <no-reply@example.com>", header.Get("From"))
+	assert.True(t, strings.HasPrefix(header.Get("Content-Type"), "multipart/alternative"))
+	assert.NotEmpty(t, header.Get("Message-ID"))
+	assert.NotEmpty(t, header.Get("Date"))
+}
+
+func TestNewSMTP_InvalidConfig(t *testing.T) {
+	_, err := NewSMTP(SMTPConfig{Port: 587, From: "no-reply@example.com"})
+	assert.Error(t, err)
+
+	_, err = NewSMTP(SMTPConfig{Host: "smtp.example.com", Port: 587, From: "not an address"})
+	assert.Error(t, err)
+
+	_, err = NewSMTP(SMTPConfig{Host: "smtp.example.com", Port: 587, TLS: "ssl", From: "no-reply@example.com"})
+	assert.Error(t, err)
+
+	m, err := NewSMTP(SMTPConfig{Host: "smtp.example.com", Port: 587, From: "no-reply@example.com"})
+	require.NoError(t, err)
+	assert.Equal(t, TLSStartTLS, m.config.TLS)
+}
+
+type fakeQueue struct {
+	kind    string
+	payload interface{}
+}
+
+func (f *fakeQueue) Enqueue(ctx context.Context, kind string, payload interface{}) error {
+	f.kind, f.payload = kind, payload
+	return nil
+}
+
+func TestQueued(t *testing.T) {
+	queue := &fakeQueue{}
+	require.NoError(t, NewQueued(queue).Send(context.Background(), testEmail))
+	assert.Equal(t, domain.JobSendEmail, queue.kind)
+
+	payload, err := json.Marshal(queue.payload)
+	require.NoError(t, err)
+
+	m := NewMemory("no-reply@example.com")
+	require.NoError(t, SendEmailJob(m)(context.Background(), payload))
+	assert.Equal(t, []domain.Email{*testEmail}, m.Emails())
+
+	assert.Error(t, SendEmailJob(m)(context.Background(), []byte("{")))
+}
@@ -0,0 +1,59 @@
+package mailer
+
+import (
+	"context"
+	"sync"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+)
+
+type memoryMailer struct {
+	from   string
+	mu     sync.Mutex
+	emails []domain.Email
+	raw    [][]byte
+}
+
+// NewMemory keeps the sent emails so tests can read them
+func NewMemory(from string) *memoryMailer {
+	return &memoryMailer{from: from}
+}
+
+// Send encodes the email like the other drivers so invalid emails fail the same way
+func (m *memoryMailer) Send(ctx context.Context, email *domain.Email) error {
+	msg, err := encode(m.from, email)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.emails = append(m.emails, *email)
+	m.raw = append(m.raw, msg)
+	return nil
+}
+
+// Emails returns the emails sent so far, the oldest first
+func (m *memoryMailer) Emails() []domain.Email {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]domain.Email(nil), m.emails...)
+}
+
+// Raw returns the encoded messages sent so far, the oldest first
+func (m *memoryMailer) Raw() [][]byte {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([][]byte(nil), m.raw...)
+}
+
+func (m *memoryMailer) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.emails = nil
+	m.raw = nil
+}
@@ -0,0 +1,60 @@
+package mailer
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+)
+
+type outboxMailer struct {
+	from string
+	dir  string
+	out  io.Writer
+	mu   sync.Mutex
+}
+
+// NewOutbox writes every email as a .eml file to dir, or to out when dir is empty, to read the
+// emails in development without a SMTP server
+func NewOutbox(from, dir string, out io.Writer) (*outboxMailer, error) {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return nil, err
+		}
+	}
+
+	return &outboxMailer{from: from, dir: dir, out: out}, nil
+}
+
+func (m *outboxMailer) Send(ctx context.Context, email *domain.Email) error {
+	msg, err := encode(m.from, email)
+	if err != nil {
+		return err
+	}
+
+	if m.dir != "" {
+		return ioutil.WriteFile(filepath.Join(m.dir, outboxFileName()), msg, 0600)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, err = fmt.Fprintf(m.out, "%s\r\n", msg)
+	return err
+}
+
+// outboxFileName sorts the emails by the time they were sent
+func outboxFileName() string {
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+
+	return fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405.000000000"), hex.EncodeToString(b))
+}
@@ -0,0 +1,34 @@
+package mailer
+
+import (
+	"context"
+	"encoding/json"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+)
+
+type queuedMailer struct {
+	queue domain.JobQueue
+}
+
+// NewQueued enqueues the emails so they survive restarts and are retried, SendEmailJob delivers
+// them with the configured driver
+func NewQueued(queue domain.JobQueue) *queuedMailer {
+	return &queuedMailer{queue: queue}
+}
+
+func (m *queuedMailer) Send(ctx context.Context, email *domain.Email) error {
+	return m.queue.Enqueue(ctx, domain.JobSendEmail, email)
+}
+
+// SendEmailJob is the handler of the domain.JobSendEmail jobs
+func SendEmailJob(mailer domain.Mailer) domain.JobHandler {
+	return func(ctx context.Context, payload []byte) error {
+		var email domain.Email
+		if err := json.Unmarshal(payload, &email); err != nil {
+			return err
+		}
+
+		return mailer.Send(ctx, &email)
+	}
+}
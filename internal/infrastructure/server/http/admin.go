@@ -0,0 +1,336 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/pkg/errors"
+)
+
+// adminDoneMessages are the confirmations shown after an action, the redirect carries only the key
+// so the page cannot be made to show arbitrary text
+var adminDoneMessages = map[string]string{
+	"disabled":         "The account was disabled and signed out everywhere.",
+	"enabled":          "The account was enabled.",
+	"password_reset":   "The password was cleared and a reset link was sent to the user.",
+	"sessions_revoked": "The user was signed out everywhere.",
+}
+
+// adminFormName names the token of the admin forms
+const adminFormName string = "admin_form"
+
+// adminFormState is the token the admin forms post with the action. It is signed and bound to the
+// session, so another site cannot post an action with the cookie of the admin.
+type adminFormState struct {
+	UserID    int
+	SessionID int
+}
+
+type adminUsersPage struct {
+	Query string
+	Users []*domain.User
+}
+
+type adminUserPage struct {
+	Account           *domain.AdminUser
+	Self              bool
+	CanDisable        bool
+	CanResetPassword  bool
+	CanRevokeSessions bool
+	CanReadAudit      bool
+	Message           string
+	FormToken         string
+}
+
+type adminAuditEventsPage struct {
+	Query   url.Values
+	Types   []domain.AuditEventType
+	Events  []auditEntry
+	Total   int
+	PrevURL string
+	NextURL string
+	Errors  map[string]string
+}
+
+type adminErrorPage struct {
+	Message string
+}
+
+// registerAdmin serves the admin area, every page requires PermissionUsersRead and each action the
+// permission it needs
+func (h *handler) registerAdmin(r *mux.Router) {
+	admin := r.PathPrefix("/admin").Subrouter()
+	admin.Use(h.requirePermission(domain.PermissionUsersRead))
+
+	admin.HandleFunc("", redirectToAdminUsers).Methods("GET")
+	admin.HandleFunc("/", redirectToAdminUsers).Methods("GET")
+	admin.HandleFunc("/users", h.getAdminUsers).Methods("GET")
+	admin.HandleFunc("/users/{id:[0-9]+}", h.getAdminUser).Methods("GET")
+
+	admin.Handle("/users/{id:[0-9]+}/disable",
+		h.requirePermission(domain.PermissionUsersDisable)(http.HandlerFunc(h.postAdminDisableUser))).Methods("POST")
+	admin.Handle("/users/{id:[0-9]+}/enable",
+		h.requirePermission(domain.PermissionUsersDisable)(http.HandlerFunc(h.postAdminEnableUser))).Methods("POST")
+	admin.Handle("/users/{id:[0-9]+}/reset-password",
+		h.requirePermission(domain.PermissionUsersResetPassword)(http.HandlerFunc(h.postAdminResetPassword))).Methods("POST")
+	admin.Handle("/users/{id:[0-9]+}/sessions/revoke",
+		h.requirePermission(domain.PermissionSessionsRevoke)(http.HandlerFunc(h.postAdminRevokeSessions))).Methods("POST")
+
+	if h.auditService != nil {
+		admin.Handle("/audit-events",
+			h.requirePermission(domain.PermissionAuditRead)(http.HandlerFunc(h.getAdminAuditEvents))).Methods("GET")
+	}
+}
+
+// requirePermission lets the request through when the signed in user has the permission. Users
+// without a session are sent to the login, and back to the page once signed in.
+func (h *handler) requirePermission(permission domain.Permission) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// nested guards reuse the session validated by the outer one
+			user, ok := userFromContext(r.Context())
+			if !ok {
+				var session *domain.Session
+				user, session, ok = h.currentSession(w, r)
+				if !ok {
+					if r.Method == http.MethodGet {
+						if err := h.setReturnTo(w, r, r.URL.RequestURI()); err != nil {
+							h.log.Error().Err(err).Sendf("failed to remember the admin page")
+						}
+					}
+
+					http.Redirect(w, r, "/login", http.StatusSeeOther)
+					return
+				}
+
+				ctx := context.WithValue(r.Context(), userContextKey, user)
+				ctx = context.WithValue(ctx, sessionContextKey, session)
+				r = r.WithContext(ctx)
+			}
+
+			allowed, err := h.rbacService.HasPermission(r.Context(), user.ID, permission)
+			if err != nil {
+				h.log.Error().Err(err).Sendf("failed to check permission %s of user %d", permission, user.ID)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			if !allowed {
+				w.WriteHeader(http.StatusForbidden)
+				h.writeTemplate(w, "admin_error", adminErrorPage{Message: "You do not have permission to access this page."})
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func redirectToAdminUsers(w http.ResponseWriter, r *http.Request) {
+	http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+}
+
+func (h *handler) getAdminUsers(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query().Get("q")
+
+	users, err := h.adminService.SearchUsers(r.Context(), query)
+	if err != nil {
+		h.writeAdminError(w, err)
+		return
+	}
+
+	h.writeTemplate(w, "admin_users", adminUsersPage{Query: query, Users: users})
+}
+
+func (h *handler) getAdminUser(w http.ResponseWriter, r *http.Request) {
+	admin, _ := userFromContext(r.Context())
+
+	userID, ok := adminUserID(w, r)
+	if !ok {
+		return
+	}
+
+	account, err := h.adminService.User(r.Context(), userID)
+	if err != nil {
+		h.writeAdminError(w, err)
+		return
+	}
+
+	roles, err := h.rbacService.UserRoles(r.Context(), admin.ID)
+	if err != nil {
+		h.writeAdminError(w, err)
+		return
+	}
+
+	session, _ := sessionFromContext(r.Context())
+	token, err := h.store.Codecs[0].Encode(adminFormName, adminFormState{UserID: admin.ID, SessionID: session.ID})
+	if err != nil {
+		h.writeAdminError(w, err)
+		return
+	}
+
+	h.writeTemplate(w, "admin_user", adminUserPage{
+		Account:           account,
+		Self:              admin.ID == account.User.ID,
+		CanDisable:        rolesHavePermission(roles, domain.PermissionUsersDisable),
+		CanResetPassword:  rolesHavePermission(roles, domain.PermissionUsersResetPassword),
+		CanRevokeSessions: rolesHavePermission(roles, domain.PermissionSessionsRevoke),
+		CanReadAudit:      h.auditService != nil && rolesHavePermission(roles, domain.PermissionAuditRead),
+		Message:           adminDoneMessages[r.URL.Query().Get("done")],
+		FormToken:         token,
+	})
+}
+
+// getAdminAuditEvents lists the events of the filter of the query string, newest first
+func (h *handler) getAdminAuditEvents(w http.ResponseWriter, r *http.Request) {
+	admin, _ := userFromContext(r.Context())
+	query := r.URL.Query()
+
+	pageData := adminAuditEventsPage{Query: query, Types: domain.AuditEventTypes}
+
+	filter, fieldErrors := auditFilterFromQuery(query)
+	page, perPage := adminAPIPage(query, fieldErrors)
+	if len(fieldErrors) > 0 {
+		pageData.Errors = fieldErrors
+		w.WriteHeader(http.StatusBadRequest)
+		h.writeTemplate(w, "admin_audit_events", pageData)
+		return
+	}
+
+	filter.Limit = perPage
+	filter.Offset = (page - 1) * perPage
+
+	events, total, err := h.auditService.List(r.Context(), filter)
+	if err != nil {
+		h.writeAdminError(w, err)
+		return
+	}
+
+	pageURL := func(page int) string {
+		if page < 1 {
+			return ""
+		}
+
+		values := url.Values{}
+		for name, value := range query {
+			values[name] = value
+		}
+		values.Set("page", strconv.Itoa(page))
+		return "/admin/audit-events?" + values.Encode()
+	}
+
+	pageData.Events = h.auditEntries(events, admin, true)
+	pageData.Total = total
+	pageData.PrevURL = pageURL(page - 1)
+	pageData.NextURL = pageURL(nextPage(page, perPage, total))
+
+	h.writeTemplate(w, "admin_audit_events", pageData)
+}
+
+func (h *handler) postAdminDisableUser(w http.ResponseWriter, r *http.Request) {
+	admin, _ := userFromContext(r.Context())
+	h.adminAction(w, r, "disabled", func(ctx context.Context, userID int) error {
+		return h.adminService.DisableUser(ctx, admin, userID)
+	})
+}
+
+func (h *handler) postAdminEnableUser(w http.ResponseWriter, r *http.Request) {
+	h.adminAction(w, r, "enabled", h.adminService.EnableUser)
+}
+
+func (h *handler) postAdminResetPassword(w http.ResponseWriter, r *http.Request) {
+	admin, _ := userFromContext(r.Context())
+	h.adminAction(w, r, "password_reset", func(ctx context.Context, userID int) error {
+		if err := h.adminService.ForcePasswordReset(ctx, userID); err != nil {
+			return err
+		}
+
+		h.audit(r, domain.AuditPasswordResetRequested, admin, &domain.User{ID: userID}, nil)
+		return nil
+	})
+}
+
+func (h *handler) postAdminRevokeSessions(w http.ResponseWriter, r *http.Request) {
+	h.adminAction(w, r, "sessions_revoked", h.adminService.RevokeSessions)
+}
+
+// adminAction runs the action on the user of the path and goes back to their page
+func (h *handler) adminAction(w http.ResponseWriter, r *http.Request, done string, action func(ctx context.Context, userID int) error) {
+	userID, ok := adminUserID(w, r)
+	if !ok {
+		return
+	}
+
+	if !h.validAdminForm(r) {
+		w.WriteHeader(http.StatusForbidden)
+		h.writeTemplate(w, "admin_error", adminErrorPage{Message: "The form expired, reload the page and try again."})
+		return
+	}
+
+	admin, _ := userFromContext(r.Context())
+	if err := h.auditedAdminAction(r, admin, userID, action); err != nil {
+		h.writeAdminError(w, err)
+		return
+	}
+
+	redirect := "/admin/users/" + strconv.Itoa(userID) + "?" + url.Values{"done": {done}}.Encode()
+	http.Redirect(w, r, redirect, http.StatusSeeOther)
+}
+
+// validAdminForm tells whether the request carries the form token of the session of the admin
+func (h *handler) validAdminForm(r *http.Request) bool {
+	admin, _ := userFromContext(r.Context())
+	session, _ := sessionFromContext(r.Context())
+
+	var state adminFormState
+	for _, codec := range h.store.Codecs {
+		if err := codec.Decode(adminFormName, r.PostFormValue("form_token"), &state); err != nil {
+			continue
+		}
+
+		return state.UserID == admin.ID && state.SessionID == session.ID
+	}
+
+	return false
+}
+
+func adminUserID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	userID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return 0, false
+	}
+
+	return userID, true
+}
+
+// writeAdminError renders the message of the error with the status the API would answer
+func (h *handler) writeAdminError(w http.ResponseWriter, err error) {
+	status := statusFromError(err)
+	message := http.StatusText(status)
+	if describer, ok := errors.DescriberCast(err); ok && describer.GetMessage() != "" {
+		message = describer.GetMessage()
+	}
+
+	if status == http.StatusInternalServerError {
+		h.log.Error().Err(err).Sendf("admin request failed: %v", err)
+	}
+
+	w.WriteHeader(status)
+	h.writeTemplate(w, "admin_error", adminErrorPage{Message: message})
+}
+
+func rolesHavePermission(roles []*domain.Role, permission domain.Permission) bool {
+	for _, role := range roles {
+		if role.HasPermission(permission) {
+			return true
+		}
+	}
+
+	return false
+}
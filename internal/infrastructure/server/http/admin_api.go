@@ -0,0 +1,385 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/pkg/errors"
+)
+
+const (
+	adminAPIDefaultPerPage = 50
+	adminAPIMaxPerPage     = 200
+)
+
+// adminAPIUser is a user as answered by the admin API, without the secrets of the account
+type adminAPIUser struct {
+	ID            int        `json:"id"`
+	Email         string     `json:"email"`
+	Name          string     `json:"name"`
+	Address       string     `json:"address"`
+	Phone         string     `json:"phone"`
+	EmailVerified bool       `json:"email_verified"`
+	MFAEnabled    bool       `json:"mfa_enabled"`
+	HasPassword   bool       `json:"has_password"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	DisabledAt    *time.Time `json:"disabled_at"`
+	DeletedAt     *time.Time `json:"deleted_at"`
+}
+
+type adminAPIUsersResponse struct {
+	Users   []adminAPIUser `json:"users"`
+	Page    int            `json:"page"`
+	PerPage int            `json:"per_page"`
+	Total   int            `json:"total"`
+}
+
+// adminAPIAuditEvent is an event with its changed fields decoded
+type adminAPIAuditEvent struct {
+	*domain.AuditEvent
+	Changes domain.AuditChanges `json:"changes"`
+}
+
+type adminAPIAuditEventsResponse struct {
+	Events  []adminAPIAuditEvent `json:"events"`
+	Page    int                  `json:"page"`
+	PerPage int                  `json:"per_page"`
+	Total   int                  `json:"total"`
+}
+
+type adminAPIUserRequest struct {
+	Email         string `json:"email"`
+	Name          string `json:"name"`
+	Address       string `json:"address"`
+	Phone         string `json:"phone"`
+	EmailVerified bool   `json:"email_verified"`
+}
+
+// adminAPIUserPatch changes only the fields present in the body
+type adminAPIUserPatch struct {
+	Email         *string `json:"email"`
+	Name          *string `json:"name"`
+	Address       *string `json:"address"`
+	Phone         *string `json:"phone"`
+	EmailVerified *bool   `json:"email_verified"`
+}
+
+// registerAdminAPI serves the JSON API of the operations tooling, authenticated with admin API keys
+// instead of sessions. It must be registered before the admin area, whose prefix it shares.
+func (h *handler) registerAdminAPI(r *mux.Router) {
+	api := r.PathPrefix("/admin/api").Subrouter()
+
+	api.Handle("/users", h.requireAPIKey(domain.PermissionUsersRead, h.apiAdminListUsers)).Methods("GET")
+	api.Handle("/users", h.requireAPIKey(domain.PermissionUsersWrite, h.apiAdminCreateUser)).Methods("POST")
+	api.Handle("/users/{id:[0-9]+}", h.requireAPIKey(domain.PermissionUsersRead, h.apiAdminGetUser)).Methods("GET")
+	api.Handle("/users/{id:[0-9]+}", h.requireAPIKey(domain.PermissionUsersWrite, h.apiAdminUpdateUser)).Methods("PATCH")
+	api.Handle("/users/{id:[0-9]+}", h.requireAPIKey(domain.PermissionUsersDelete, h.apiAdminDeleteUser)).Methods("DELETE")
+	api.Handle("/users/{id:[0-9]+}/restore", h.requireAPIKey(domain.PermissionUsersDelete, h.apiAdminRestoreUser)).Methods("POST")
+	api.Handle("/users/{id:[0-9]+}/disable", h.requireAPIKey(domain.PermissionUsersDisable, h.apiAdminDisableUser)).Methods("POST")
+	api.Handle("/users/{id:[0-9]+}/enable", h.requireAPIKey(domain.PermissionUsersDisable, h.apiAdminEnableUser)).Methods("POST")
+
+	if h.auditService != nil {
+		api.Handle("/audit-events", h.requireAPIKey(domain.PermissionAuditRead, h.apiAdminListAuditEvents)).Methods("GET")
+	}
+}
+
+// requireAPIKey lets the request through when its "Authorization: Bearer <key>" header holds an
+// admin API key granting the permission
+func (h *handler) requireAPIKey(permission domain.Permission, next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, err := h.adminKeyService.Authenticate(r.Context(), bearerToken(r))
+		if err != nil {
+			h.writeError(w, err)
+			return
+		}
+
+		if !key.HasPermission(permission) {
+			h.writeError(w, errors.NewRuleNotSatisfied(domain.ErrPermissionDenied).
+				WithMessage("the api key does not grant "+string(permission)))
+			return
+		}
+
+		next(w, r.WithContext(context.WithValue(r.Context(), adminAPIKeyContextKey, key)))
+	})
+}
+
+func (h *handler) apiAdminListUsers(w http.ResponseWriter, r *http.Request) {
+	filter, page, perPage, fieldErrors := adminAPIUserFilter(r)
+	if len(fieldErrors) > 0 {
+		h.writeFieldErrors(w, ErrValidationFailed, fieldErrors)
+		return
+	}
+
+	users, total, err := h.adminService.ListUsers(r.Context(), filter)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	resp := adminAPIUsersResponse{
+		Users:   make([]adminAPIUser, 0, len(users)),
+		Page:    page,
+		PerPage: perPage,
+		Total:   total,
+	}
+	for _, user := range users {
+		resp.Users = append(resp.Users, adminAPIUserFromUser(user))
+	}
+
+	h.writeJSON(w, http.StatusOK, resp)
+}
+
+// adminAPIUserFilter reads the filter of the query string. The deleted users are left out unless
+// the deleted parameter is given.
+func adminAPIUserFilter(r *http.Request) (*domain.UserFilter, int, int, map[string]string) {
+	query := r.URL.Query()
+	fieldErrors := make(map[string]string)
+	deleted := false
+
+	filter := &domain.UserFilter{
+		Query:       query.Get("q"),
+		EmailPrefix: query.Get("email_prefix"),
+		Provider:    query.Get("provider"),
+		Deleted:     &deleted,
+	}
+
+	for name, dst := range map[string]**time.Time{
+		"created_after":  &filter.CreatedAfter,
+		"created_before": &filter.CreatedBefore,
+	} {
+		if value := query.Get(name); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				fieldErrors[name] = "must be an RFC 3339 time"
+				continue
+			}
+			*dst = &t
+		}
+	}
+
+	for name, dst := range map[string]**bool{
+		"disabled": &filter.Disabled,
+		"deleted":  &filter.Deleted,
+	} {
+		if value := query.Get(name); value != "" {
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				fieldErrors[name] = "must be true or false"
+				continue
+			}
+			*dst = &b
+		}
+	}
+
+	page, perPage := adminAPIPage(query, fieldErrors)
+	filter.Limit = perPage
+	filter.Offset = (page - 1) * perPage
+
+	return filter, page, perPage, fieldErrors
+}
+
+// adminAPIPage reads the page and per_page parameters, the errors are added to fieldErrors
+func adminAPIPage(query url.Values, fieldErrors map[string]string) (int, int) {
+	page, perPage := 1, adminAPIDefaultPerPage
+	if value := query.Get("page"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			fieldErrors["page"] = "must be a positive number"
+		} else {
+			page = n
+		}
+	}
+
+	if value := query.Get("per_page"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > adminAPIMaxPerPage {
+			fieldErrors["per_page"] = "must be between 1 and " + strconv.Itoa(adminAPIMaxPerPage)
+		} else {
+			perPage = n
+		}
+	}
+
+	return page, perPage
+}
+
+func (h *handler) apiAdminListAuditEvents(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter, fieldErrors := auditFilterFromQuery(query)
+	page, perPage := adminAPIPage(query, fieldErrors)
+	if len(fieldErrors) > 0 {
+		h.writeFieldErrors(w, ErrValidationFailed, fieldErrors)
+		return
+	}
+
+	filter.Limit = perPage
+	filter.Offset = (page - 1) * perPage
+
+	events, total, err := h.auditService.List(r.Context(), filter)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	resp := adminAPIAuditEventsResponse{
+		Events:  make([]adminAPIAuditEvent, 0, len(events)),
+		Page:    page,
+		PerPage: perPage,
+		Total:   total,
+	}
+	for _, event := range events {
+		changes, err := event.ChangeSet()
+		if err != nil {
+			h.writeError(w, err)
+			return
+		}
+
+		resp.Events = append(resp.Events, adminAPIAuditEvent{AuditEvent: event, Changes: changes})
+	}
+
+	h.writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *handler) apiAdminGetUser(w http.ResponseWriter, r *http.Request) {
+	userID, ok := adminUserID(w, r)
+	if !ok {
+		return
+	}
+
+	account, err := h.adminService.User(r.Context(), userID)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, adminAPIUserFromUser(account.User))
+}
+
+func (h *handler) apiAdminCreateUser(w http.ResponseWriter, r *http.Request) {
+	var req adminAPIUserRequest
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+
+	user, err := h.adminService.CreateUser(r.Context(), &domain.AdminUserInput{
+		Email:         req.Email,
+		Name:          req.Name,
+		Address:       req.Address,
+		Phone:         req.Phone,
+		EmailVerified: req.EmailVerified,
+	})
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	h.logAdminAPI(r, "created user %d", user.ID)
+	h.audit(r, domain.AuditSignup, nil, user, nil)
+	h.writeJSON(w, http.StatusCreated, adminAPIUserFromUser(user))
+}
+
+func (h *handler) apiAdminUpdateUser(w http.ResponseWriter, r *http.Request) {
+	userID, ok := adminUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var req adminAPIUserPatch
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+
+	var user *domain.User
+	err := h.auditedAdminAction(r, nil, userID, func(ctx context.Context, userID int) error {
+		var err error
+		user, err = h.adminService.UpdateUser(ctx, userID, &domain.AdminUserUpdate{
+			Email:         req.Email,
+			Name:          req.Name,
+			Address:       req.Address,
+			Phone:         req.Phone,
+			EmailVerified: req.EmailVerified,
+		})
+		return err
+	})
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	h.logAdminAPI(r, "updated user %d", user.ID)
+	h.writeJSON(w, http.StatusOK, adminAPIUserFromUser(user))
+}
+
+func (h *handler) apiAdminDeleteUser(w http.ResponseWriter, r *http.Request) {
+	h.adminAPIAction(w, r, "deleted", h.adminService.DeleteUser)
+}
+
+func (h *handler) apiAdminRestoreUser(w http.ResponseWriter, r *http.Request) {
+	h.adminAPIAction(w, r, "restored", h.adminService.RestoreUser)
+}
+
+func (h *handler) apiAdminDisableUser(w http.ResponseWriter, r *http.Request) {
+	h.adminAPIAction(w, r, "disabled", func(ctx context.Context, userID int) error {
+		return h.adminService.DisableUser(ctx, nil, userID)
+	})
+}
+
+func (h *handler) apiAdminEnableUser(w http.ResponseWriter, r *http.Request) {
+	h.adminAPIAction(w, r, "enabled", h.adminService.EnableUser)
+}
+
+// adminAPIAction runs the action on the user of the path and answers with the user as it is now
+func (h *handler) adminAPIAction(w http.ResponseWriter, r *http.Request, done string, action func(ctx context.Context, userID int) error) {
+	userID, ok := adminUserID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.auditedAdminAction(r, nil, userID, action); err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	h.logAdminAPI(r, done+" user %d", userID)
+
+	account, err := h.adminService.User(r.Context(), userID)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, adminAPIUserFromUser(account.User))
+}
+
+// logAdminAPI records which key made the change
+func (h *handler) logAdminAPI(r *http.Request, format string, args ...interface{}) {
+	key, _ := r.Context().Value(adminAPIKeyContextKey).(*domain.AdminAPIKey)
+	if key == nil {
+		return
+	}
+
+	h.log.Info().Sendf("api key %d (%s): "+format, append([]interface{}{key.ID, key.Name}, args...)...)
+}
+
+func adminAPIUserFromUser(user *domain.User) adminAPIUser {
+	return adminAPIUser{
+		ID:            user.ID,
+		Email:         user.Email,
+		Name:          user.Name,
+		Address:       user.Address,
+		Phone:         user.Phone,
+		EmailVerified: user.EmailVerified(),
+		MFAEnabled:    user.TOTPEnabled,
+		HasPassword:   user.HasPassword(),
+		CreatedAt:     user.CreatedAt,
+		UpdatedAt:     user.UpdatedAt,
+		DisabledAt:    user.DisabledAt,
+		DeletedAt:     user.DeletedAt,
+	}
+}
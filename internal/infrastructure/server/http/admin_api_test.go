@@ -0,0 +1,221 @@
+package http_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+)
+
+type adminAPIUser struct {
+	ID            int
+	Email         string
+	Name          string
+	Password      string
+	EmailVerified bool       `json:"email_verified"`
+	HasPassword   bool       `json:"has_password"`
+	DisabledAt    *time.Time `json:"disabled_at"`
+	DeletedAt     *time.Time `json:"deleted_at"`
+}
+
+type adminAPIUsers struct {
+	Users   []adminAPIUser
+	Page    int
+	PerPage int `json:"per_page"`
+	Total   int
+}
+
+type adminAPIError struct {
+	Code   string
+	Errors map[string]string
+}
+
+// adminKey creates an admin API key granting the permissions
+func (ts *testServer) adminKey(t *testing.T, permissions ...domain.Permission) string {
+	_, key, err := ts.adminKeys.Create(context.Background(), "tooling", permissions)
+	require.NoError(t, err)
+	return key
+}
+
+// adminAPI calls the admin API with the key, the JSON answer is decoded into v when not nil
+func (ts *testServer) adminAPI(t *testing.T, method, path, key string, body, v interface{}) *http.Response {
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		require.NoError(t, err)
+		reader = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequest(method, ts.URL+path, reader)
+	require.NoError(t, err)
+	if key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	if v != nil {
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(v))
+	}
+	return resp
+}
+
+func TestHandler_AdminAPIKeys(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	var apiErr adminAPIError
+	resp := ts.adminAPI(t, "GET", "/admin/api/users", "", nil, &apiErr)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Equal(t, string(domain.ErrInvalidAPIKey), apiErr.Code)
+
+	// a session of an admin is not enough
+	admin := newBrowser(t)
+	ts.signupAdmin(t, admin, "admin@example.com")
+	resp, err := admin.Get(ts.URL + "/admin/api/users")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	readOnly := ts.adminKey(t, domain.PermissionUsersRead)
+	resp = ts.adminAPI(t, "GET", "/admin/api/users", readOnly, nil, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp = ts.adminAPI(t, "POST", "/admin/api/users", readOnly, map[string]string{"email": "new@example.com"}, &apiErr)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	assert.Equal(t, string(domain.ErrPermissionDenied), apiErr.Code)
+
+	keys, err := ts.adminKeys.List(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, ts.adminKeys.Revoke(context.Background(), keys[0].ID))
+
+	resp = ts.adminAPI(t, "GET", "/admin/api/users", readOnly, nil, nil)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, "revoked keys stop working")
+}
+
+func TestHandler_AdminAPIListUsers(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	key := ts.adminKey(t, domain.PermissionUsersRead)
+	var users []*domain.User
+	for _, email := range []string{"ann@example.com", "anna@example.com", "bob@example.com"} {
+		users = append(users, ts.signup(t, newBrowser(t), email, "secret-password"))
+	}
+	require.NoError(t, ts.identities.Insert(context.Background(), &domain.UserIdentity{
+		UserID: users[2].ID, Provider: "github", Subject: "4242", LinkedAt: time.Now(),
+	}))
+
+	var list adminAPIUsers
+	resp := ts.adminAPI(t, "GET", "/admin/api/users?email_prefix=ANN&per_page=1", key, nil, &list)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 2, list.Total)
+	assert.Equal(t, 1, list.Page)
+	assert.Equal(t, 1, list.PerPage)
+	require.Len(t, list.Users, 1)
+	assert.Equal(t, "ann@example.com", list.Users[0].Email)
+	assert.True(t, list.Users[0].HasPassword)
+	assert.Empty(t, list.Users[0].Password, "the password hash is not answered")
+
+	resp = ts.adminAPI(t, "GET", "/admin/api/users?email_prefix=ann&per_page=1&page=2", key, nil, &list)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Len(t, list.Users, 1)
+	assert.Equal(t, "anna@example.com", list.Users[0].Email)
+
+	resp = ts.adminAPI(t, "GET", "/admin/api/users?provider=github", key, nil, &list)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Len(t, list.Users, 1)
+	assert.Equal(t, "bob@example.com", list.Users[0].Email)
+
+	after := url.QueryEscape(time.Now().Add(time.Hour).Format(time.RFC3339))
+	resp = ts.adminAPI(t, "GET", "/admin/api/users?created_after="+after, key, nil, &list)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Zero(t, list.Total)
+
+	var apiErr adminAPIError
+	resp = ts.adminAPI(t, "GET", "/admin/api/users?created_before=yesterday&disabled=maybe&per_page=1000", key, nil, &apiErr)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, "VALIDATION_FAILED", apiErr.Code)
+	assert.Contains(t, apiErr.Errors, "created_before")
+	assert.Contains(t, apiErr.Errors, "disabled")
+	assert.Contains(t, apiErr.Errors, "per_page")
+}
+
+func TestHandler_AdminAPIManageUser(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	key := ts.adminKey(t, domain.PermissionUsersRead, domain.PermissionUsersWrite, domain.PermissionUsersDelete, domain.PermissionUsersDisable)
+
+	var user adminAPIUser
+	resp := ts.adminAPI(t, "POST", "/admin/api/users", key, map[string]interface{}{"email": "new@example.com", "name": "New", "email_verified": true}, &user)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, "new@example.com", user.Email)
+	assert.True(t, user.EmailVerified)
+	assert.False(t, user.HasPassword)
+
+	email := ts.lastEmail(t, "new@example.com")
+	link, err := url.Parse(resetLink.FindString(email.Text))
+	require.NoError(t, err, "the user chooses a password from the emailed link")
+	browser := newBrowser(t)
+	p := ts.post(t, browser, "/password/new", url.Values{"token": {link.Query().Get("token")}, "password": {"new-password"}})
+	assert.Contains(t, p.body, "password changed")
+
+	var apiErr adminAPIError
+	resp = ts.adminAPI(t, "POST", "/admin/api/users", key, map[string]string{"email": "NEW@example.com"}, &apiErr)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	assert.Equal(t, string(domain.ErrEmailAlreadyUsed), apiErr.Code)
+
+	userPath := "/admin/api/users/" + strconv.Itoa(user.ID)
+	resp = ts.adminAPI(t, "PATCH", userPath, key, map[string]string{"name": "Renamed"}, &user)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "Renamed", user.Name)
+	assert.True(t, user.EmailVerified, "the fields not given are kept")
+
+	resp = ts.adminAPI(t, "PATCH", userPath, key, map[string]string{"email": "invalid"}, &apiErr)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, string(domain.ErrInvalidProfile), apiErr.Code)
+
+	resp = ts.adminAPI(t, "DELETE", userPath, key, nil, &user)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NotNil(t, user.DeletedAt)
+
+	p = ts.post(t, browser, "/login", url.Values{"email": {"new@example.com"}, "password": {"new-password"}})
+	assert.Equal(t, http.StatusUnauthorized, p.status, "deleted users cannot sign in")
+
+	var list adminAPIUsers
+	ts.adminAPI(t, "GET", "/admin/api/users?q=new", key, nil, &list)
+	assert.Zero(t, list.Total, "the deleted users are not listed by default")
+	ts.adminAPI(t, "GET", "/admin/api/users?q=new&deleted=true", key, nil, &list)
+	assert.Equal(t, 1, list.Total)
+
+	resp = ts.adminAPI(t, "POST", userPath+"/restore", key, nil, &user)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Nil(t, user.DeletedAt)
+
+	resp = ts.adminAPI(t, "POST", userPath+"/disable", key, nil, &user)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NotNil(t, user.DisabledAt)
+	resp = ts.adminAPI(t, "POST", userPath+"/enable", key, nil, &user)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Nil(t, user.DisabledAt)
+
+	p = ts.post(t, browser, "/login", url.Values{"email": {"new@example.com"}, "password": {"new-password"}})
+	assert.Equal(t, "/profile", p.path)
+
+	resp = ts.adminAPI(t, "GET", "/admin/api/users/999", key, nil, &apiErr)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Equal(t, string(domain.ErrUserNotFound), apiErr.Code)
+}
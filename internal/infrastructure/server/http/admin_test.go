@@ -0,0 +1,219 @@
+package http_test
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+)
+
+// signupAdmin signs up a user with the admin role, the browser keeps the session
+func (ts *testServer) signupAdmin(t *testing.T, browser *http.Client, email string) *domain.User {
+	admin := ts.signup(t, browser, email, "admin-password")
+	require.NoError(t, ts.rbac.AssignRole(context.Background(), admin.ID, domain.RoleAdmin))
+	return admin
+}
+
+var adminFormToken = regexp.MustCompile(`name="form_token" value="([^"]+)"`)
+
+// adminForm returns the form the admin page of the user posts, with the token of the session of the
+// browser
+func (ts *testServer) adminForm(t *testing.T, browser *http.Client, userPath string) url.Values {
+	p := ts.get(t, browser, userPath)
+	match := adminFormToken.FindStringSubmatch(p.body)
+	require.Len(t, match, 2, p.body)
+
+	return url.Values{"form_token": {match[1]}}
+}
+
+func TestHandler_AdminRequiresPermission(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	browser := newBrowser(t)
+	p := ts.get(t, browser, "/admin/users?q=example")
+	assert.Equal(t, "/login", p.path, "the admin area requires a session")
+
+	user := ts.signup(t, newBrowser(t), "user@example.com", "secret-password")
+
+	p = ts.post(t, browser, "/login", url.Values{"email": {"user@example.com"}, "password": {"secret-password"}})
+	assert.Equal(t, http.StatusForbidden, p.status, "the login goes back to the admin area")
+	assert.Equal(t, "/admin/users", p.path)
+	assert.Contains(t, p.body, "You do not have permission")
+
+	p = ts.post(t, browser, "/admin/users/"+strconv.Itoa(user.ID)+"/disable", nil)
+	assert.Equal(t, http.StatusForbidden, p.status)
+
+	found, err := ts.users.FindByID(context.Background(), user.ID)
+	require.NoError(t, err)
+	assert.False(t, found.Disabled())
+
+	require.NoError(t, ts.rbac.AssignRole(context.Background(), user.ID, domain.RoleAdmin))
+
+	p = ts.get(t, browser, "/admin")
+	assert.Equal(t, http.StatusOK, p.status)
+	assert.Equal(t, "/admin/users", p.path)
+	assert.Contains(t, p.body, "user@example.com")
+
+	require.NoError(t, ts.rbac.RemoveRole(context.Background(), user.ID, domain.RoleAdmin))
+
+	p = ts.get(t, browser, "/admin/users")
+	assert.Equal(t, http.StatusForbidden, p.status, "removing the role takes effect right away")
+}
+
+func TestHandler_AdminSearchAndView(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	admin := newBrowser(t)
+	ts.signupAdmin(t, admin, "admin@example.com")
+	user := ts.signup(t, newBrowser(t), "jane@example.com", "secret-password")
+	ts.signup(t, newBrowser(t), "john@example.org", "secret-password")
+
+	p := ts.get(t, admin, "/admin/users?q=JANE")
+	assert.Equal(t, http.StatusOK, p.status)
+	assert.Contains(t, p.body, "jane@example.com")
+	assert.NotContains(t, p.body, "john@example.org")
+
+	p = ts.get(t, admin, "/admin/users?q=nobody")
+	assert.Contains(t, p.body, "No users found")
+
+	p = ts.get(t, admin, "/admin/users/"+strconv.Itoa(user.ID))
+	assert.Equal(t, http.StatusOK, p.status)
+	assert.Contains(t, p.body, "jane@example.com")
+	assert.Contains(t, p.body, "/admin/users/"+strconv.Itoa(user.ID)+"/disable")
+	assert.Contains(t, p.body, "Go-http-client", "the sessions of the user are listed")
+
+	p = ts.get(t, admin, "/admin/users/999")
+	assert.Equal(t, http.StatusNotFound, p.status)
+	assert.Contains(t, p.body, "user not found")
+}
+
+func TestHandler_AdminDisableAndEnable(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	admin := newBrowser(t)
+	adminUser := ts.signupAdmin(t, admin, "admin@example.com")
+
+	userBrowser := newBrowser(t)
+	user := ts.signup(t, userBrowser, "user@example.com", "secret-password")
+	pair, err := ts.tokens.Issue(context.Background(), user, nil)
+	require.NoError(t, err)
+
+	userPath := "/admin/users/" + strconv.Itoa(user.ID)
+	form := ts.adminForm(t, admin, userPath)
+	p := ts.post(t, admin, userPath+"/disable", form)
+	assert.Equal(t, http.StatusOK, p.status)
+	assert.Equal(t, userPath, p.path)
+	assert.Contains(t, p.body, "The account was disabled")
+	assert.Contains(t, p.body, userPath+"/enable")
+
+	p = ts.get(t, userBrowser, "/profile")
+	assert.Equal(t, "/login", p.path, "the sessions of the user are revoked")
+
+	var apiErr struct{ Code string }
+	resp := ts.getJSON(t, "/api/v1/profile", pair.AccessToken, &apiErr)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, "issued access tokens stop working")
+
+	_, err = ts.tokens.Refresh(context.Background(), pair.RefreshToken)
+	assert.Error(t, err, "the refresh tokens are revoked")
+
+	p = ts.post(t, userBrowser, "/login", url.Values{"email": {"user@example.com"}, "password": {"secret-password"}})
+	assert.Equal(t, http.StatusUnauthorized, p.status)
+	assert.Contains(t, p.body, "this account is disabled")
+
+	p = ts.post(t, admin, "/admin/users/"+strconv.Itoa(adminUser.ID)+"/disable", form)
+	assert.Equal(t, http.StatusUnprocessableEntity, p.status)
+	assert.Contains(t, p.body, "you cannot disable your own account")
+
+	p = ts.post(t, admin, userPath+"/enable", form)
+	assert.Equal(t, http.StatusOK, p.status)
+	assert.Contains(t, p.body, "The account was enabled")
+
+	p = ts.post(t, userBrowser, "/login", url.Values{"email": {"user@example.com"}, "password": {"secret-password"}})
+	assert.Equal(t, "/profile", p.path)
+}
+
+func TestHandler_AdminResetPasswordAndRevokeSessions(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	admin := newBrowser(t)
+	ts.signupAdmin(t, admin, "admin@example.com")
+
+	userBrowser := newBrowser(t)
+	user := ts.signup(t, userBrowser, "user@example.com", "secret-password")
+	userPath := "/admin/users/" + strconv.Itoa(user.ID)
+	form := ts.adminForm(t, admin, userPath)
+
+	p := ts.post(t, admin, userPath+"/sessions/revoke", form)
+	assert.Equal(t, http.StatusOK, p.status)
+	assert.Contains(t, p.body, "The user was signed out everywhere")
+
+	p = ts.get(t, userBrowser, "/profile")
+	assert.Equal(t, "/login", p.path)
+
+	p = ts.post(t, userBrowser, "/login", url.Values{"email": {"user@example.com"}, "password": {"secret-password"}})
+	require.Equal(t, "/profile", p.path)
+
+	p = ts.post(t, admin, userPath+"/reset-password", form)
+	assert.Equal(t, http.StatusOK, p.status)
+	assert.Contains(t, p.body, "a reset link was sent")
+
+	p = ts.get(t, userBrowser, "/profile")
+	assert.Equal(t, "/login", p.path)
+
+	p = ts.post(t, userBrowser, "/login", url.Values{"email": {"user@example.com"}, "password": {"secret-password"}})
+	assert.Equal(t, http.StatusUnauthorized, p.status, "the old password is cleared")
+
+	email := ts.lastEmail(t, "user@example.com")
+	assert.Equal(t, "Recover password - user-auth", email.Subject)
+	link, err := url.Parse(resetLink.FindString(email.Text))
+	require.NoError(t, err)
+
+	p = ts.post(t, userBrowser, "/password/new", url.Values{"token": {link.Query().Get("token")}, "password": {"new-password"}})
+	assert.Contains(t, p.body, "password changed")
+
+	p = ts.post(t, userBrowser, "/login", url.Values{"email": {"user@example.com"}, "password": {"new-password"}})
+	assert.Equal(t, "/profile", p.path)
+}
+
+func TestHandler_AdminFormsRequireToken(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	admin := newBrowser(t)
+	ts.signupAdmin(t, admin, "admin@example.com")
+	user := ts.signup(t, newBrowser(t), "user@example.com", "secret-password")
+	userPath := "/admin/users/" + strconv.Itoa(user.ID)
+
+	// a form of another site posts with the cookie of the admin but without the token
+	p := ts.post(t, admin, userPath+"/disable", url.Values{"reason": {"cross-site"}})
+	assert.Equal(t, http.StatusForbidden, p.status)
+	assert.Contains(t, p.body, "The form expired")
+
+	p = ts.post(t, admin, userPath+"/disable", url.Values{"form_token": {"forged"}})
+	assert.Equal(t, http.StatusForbidden, p.status)
+
+	// the token of another session of the admin does not work either
+	other := newBrowser(t)
+	ts.post(t, other, "/login", url.Values{"email": {"admin@example.com"}, "password": {"admin-password"}})
+	p = ts.post(t, admin, userPath+"/disable", ts.adminForm(t, other, userPath))
+	assert.Equal(t, http.StatusForbidden, p.status)
+
+	found, err := ts.users.FindByID(context.Background(), user.ID)
+	require.NoError(t, err)
+	assert.False(t, found.Disabled(), "no action ran")
+
+	p = ts.post(t, admin, userPath+"/disable", ts.adminForm(t, admin, userPath))
+	assert.Equal(t, http.StatusOK, p.status)
+	assert.Contains(t, p.body, "The account was disabled")
+}
@@ -0,0 +1,311 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/pkg/errors"
+)
+
+const apiPrefix string = "/api/v1"
+
+type contextKey string
+
+const (
+	userContextKey    contextKey = "user"
+	sessionContextKey contextKey = "session"
+	// adminAPIKeyContextKey holds the admin API key of the request
+	adminAPIKeyContextKey contextKey = "admin_api_key"
+	// apiKeyContextKey is set on the requests authenticated by a personal API key
+	apiKeyContextKey contextKey = "api_key"
+)
+
+type apiError struct {
+	Code    errors.Code       `json:"code"`
+	Message string            `json:"message"`
+	Args    errors.Args       `json:"args,omitempty"`
+	Errors  map[string]string `json:"errors,omitempty"`
+}
+
+type apiAuthRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type apiAuthResponse struct {
+	Token   string         `json:"token"`
+	Profile domain.Profile `json:"profile"`
+	*domain.TokenPair
+}
+
+type apiMFARequiredResponse struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+}
+
+type apiLoginMFARequest struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code"`
+}
+
+type apiRefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type apiForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type apiNewPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+type apiProfileRequest struct {
+	Name    string `json:"name"`
+	Email   string `json:"email"`
+	Address string `json:"address"`
+	Phone   string `json:"phone"`
+}
+
+func (h *handler) registerAPI(r *mux.Router) {
+	api := r.PathPrefix(apiPrefix).Subrouter()
+
+	api.HandleFunc("/signup", h.apiSignup).Methods("POST")
+	api.HandleFunc("/login", h.apiLogin).Methods("POST")
+	api.HandleFunc("/login/mfa", h.apiLoginMFA).Methods("POST")
+	api.HandleFunc("/logout", h.apiAuthenticated(h.apiLogout)).Methods("POST")
+	api.HandleFunc("/email/verify", h.apiVerifyEmail).Methods("POST")
+	api.HandleFunc("/email/resend", h.apiResendVerification).Methods("POST")
+	api.HandleFunc("/password/forgot", h.apiForgotPassword).Methods("POST")
+	api.HandleFunc("/password/new", h.apiNewPassword).Methods("POST")
+	api.HandleFunc("/profile", h.apiAuthenticated(h.apiGetProfile)).Methods("GET")
+	api.HandleFunc("/profile", h.apiAuthenticated(h.apiPutProfile)).Methods("PUT")
+
+	if h.tokenService != nil {
+		api.HandleFunc("/token/refresh", h.apiRefreshToken).Methods("POST")
+		api.HandleFunc("/token/revoke", h.apiRevokeToken).Methods("POST")
+	}
+}
+
+// apiAuthenticated accepts either an "Authorization: Bearer <token>" header, holding a session
+// token or a signed access token, or the session cookie used by the HTML pages.
+func (h *handler) apiAuthenticated(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := bearerToken(r)
+		if token == "" {
+			session, err := h.store.Get(r, authSession)
+			if err == nil {
+				token, _ = session.Values[authCookie].(string)
+			}
+		}
+
+		if token == "" {
+			h.writeError(w, ErrNotAuthorizedRequest)
+			return
+		}
+
+		user, session, err := h.authenticateBearer(r, token)
+		if describer, ok := errors.RuleNotSatisfiedCast(err); ok && describer.GetCode() == domain.ErrPermissionDenied {
+			h.writeError(w, err)
+			return
+		}
+
+		if err != nil || user == nil {
+			h.writeError(w, ErrNotAuthorizedRequest)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), userContextKey, user)
+		if session != nil {
+			ctx = context.WithValue(ctx, sessionContextKey, session)
+		}
+		if h.isAPIKey(token) {
+			ctx = context.WithValue(ctx, apiKeyContextKey, true)
+		}
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// authenticateBearer resolves the user of a session token, of a signed access token or of a
+// personal API key. No session is returned for the access tokens and the API keys.
+func (h *handler) authenticateBearer(r *http.Request, token string) (*domain.User, *domain.Session, error) {
+	ctx := r.Context()
+	if h.isAPIKey(token) {
+		return h.authenticateAPIKey(r, token)
+	}
+
+	if h.tokenService == nil || strings.Count(token, ".") != 2 {
+		return h.sessionService.Authenticate(ctx, token)
+	}
+
+	claims, err := h.tokenService.VerifyAccessToken(token)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	id, err := strconv.Atoi(claims.Subject)
+	if err != nil {
+		return nil, nil, ErrNotAuthorizedRequest
+	}
+
+	user, err := h.userService.FindByID(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// access tokens outlive the revoked sessions of a disabled or deleted account
+	if user != nil && !user.Active() {
+		return nil, nil, ErrNotAuthorizedRequest
+	}
+
+	return user, nil, nil
+}
+
+// authenticateAPIKey checks the key grants the request, reading needs profile:read or profile:write
+// and changing anything profile:write
+func (h *handler) authenticateAPIKey(r *http.Request, token string) (*domain.User, *domain.Session, error) {
+	key, user, err := h.apiKeyService.Authenticate(r.Context(), token)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	allowed := key.HasScope(domain.APIKeyScopeProfileWrite)
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		allowed = allowed || key.HasScope(domain.APIKeyScopeProfileRead)
+	}
+
+	if !allowed {
+		return nil, nil, errors.NewRuleNotSatisfied(domain.ErrPermissionDenied).WithMessage("the api key does not grant this request")
+	}
+
+	return user, nil, nil
+}
+
+func (h *handler) isAPIKey(token string) bool {
+	return h.apiKeyService != nil && strings.HasPrefix(token, domain.APIKeyPrefix)
+}
+
+// viaAPIKey tells if the request was authenticated by a personal API key
+func viaAPIKey(ctx context.Context) bool {
+	ok, _ := ctx.Value(apiKeyContextKey).(bool)
+	return ok
+}
+
+func bearerToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if len(header) < 7 || !strings.EqualFold(header[:7], "bearer ") {
+		return ""
+	}
+
+	return strings.TrimSpace(header[7:])
+}
+
+func userFromContext(ctx context.Context) (*domain.User, bool) {
+	user, ok := ctx.Value(userContextKey).(*domain.User)
+	return user, ok && user != nil
+}
+
+func sessionFromContext(ctx context.Context) (*domain.Session, bool) {
+	session, ok := ctx.Value(sessionContextKey).(*domain.Session)
+	return session, ok && session != nil
+}
+
+func (h *handler) decodeJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		h.writeError(w, ErrInvalidBodyRequest)
+		return false
+	}
+
+	return true
+}
+
+func (h *handler) writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+
+	if data == nil {
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		h.log.Error().Err(err).Sendf("failed to encode response: %v", err)
+	}
+}
+
+func (h *handler) writeError(w http.ResponseWriter, err error) {
+	h.writeFieldErrors(w, err, nil)
+}
+
+func (h *handler) writeFieldErrors(w http.ResponseWriter, err error, fieldErrors map[string]string) {
+	status := statusFromError(err)
+
+	resp := apiError{
+		Code:    ErrInternalRequestCode,
+		Message: http.StatusText(status),
+		Errors:  fieldErrors,
+	}
+
+	if describer, ok := errors.DescriberCast(err); ok {
+		resp.Code = describer.GetCode()
+		resp.Args = describer.GetArgs()
+		if msg := describer.GetMessage(); msg != "" {
+			resp.Message = msg
+		}
+	}
+
+	if status == http.StatusInternalServerError {
+		h.log.Error().Err(err).Sendf("api request failed: %v", err)
+	}
+
+	h.writeJSON(w, status, resp)
+}
+
+func statusFromError(err error) int {
+	if _, ok := errors.InvalidArgumentCast(err); ok {
+		return http.StatusBadRequest
+	}
+
+	if _, ok := errors.NotAuthorizedCast(err); ok {
+		return http.StatusUnauthorized
+	}
+
+	if _, ok := errors.NotFoundCast(err); ok {
+		return http.StatusNotFound
+	}
+
+	if _, ok := errors.DuplicatedRecordCast(err); ok {
+		return http.StatusConflict
+	}
+
+	if describer, ok := errors.RuleNotSatisfiedCast(err); ok {
+		switch describer.GetCode() {
+		case domain.ErrTooManyAttempts:
+			return http.StatusTooManyRequests
+		case domain.ErrEmailNotVerified, domain.ErrAccountDisabled, domain.ErrPermissionDenied:
+			return http.StatusForbidden
+		}
+		return http.StatusUnprocessableEntity
+	}
+
+	return http.StatusInternalServerError
+}
+
+func profileFromUser(user *domain.User) domain.Profile {
+	return domain.Profile{
+		ID:      user.ID,
+		Email:   user.Email,
+		Address: user.Address,
+		Phone:   user.Phone,
+		Name:    user.Name,
+
+		EmailVerified: user.EmailVerified(),
+	}
+}
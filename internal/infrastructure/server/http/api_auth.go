@@ -0,0 +1,273 @@
+package http
+
+import (
+	"net/http"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/pkg/errors"
+)
+
+func (h *handler) apiSignup(w http.ResponseWriter, r *http.Request) {
+	var req apiAuthRequest
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+
+	authUser := domain.NewAuthUser(req.Email, req.Password)
+	if !authUser.Validate() {
+		h.writeFieldErrors(w, ErrValidationFailed, authUser.Errors)
+		return
+	}
+
+	ip := domain.ThrottleIP(clientIP(r))
+	if err := h.allowAttempt(r.Context(), domain.ThrottleSignup, ip); err != nil {
+		h.writeError(w, err)
+		return
+	}
+	h.recordAttempt(r.Context(), domain.ThrottleSignup, ip)
+
+	user, err := h.authService.Signup(r.Context(), authUser)
+	if err != nil {
+		h.writeFieldErrors(w, err, authUser.Errors)
+		return
+	}
+
+	h.audit(r, domain.AuditSignup, user, user, nil)
+	h.sendVerificationEmail(r.Context(), user)
+
+	if !h.authService.EmailVerificationPolicy().AllowsLogin(user) {
+		h.writeJSON(w, http.StatusCreated, apiEmailVerificationRequiredResponse{
+			EmailVerificationRequired: true,
+			Profile:                   profileFromUser(user),
+		})
+		return
+	}
+
+	h.writeAuthResponse(w, r, http.StatusCreated, user)
+}
+
+func (h *handler) apiLogin(w http.ResponseWriter, r *http.Request) {
+	var req apiAuthRequest
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+
+	authUser := domain.NewAuthUser(req.Email, req.Password)
+	if !authUser.Validate() {
+		h.writeFieldErrors(w, ErrValidationFailed, authUser.Errors)
+		return
+	}
+
+	ctx := r.Context()
+	email, ip := domain.ThrottleEmail(authUser.Email), domain.ThrottleIP(clientIP(r))
+	if err := h.allowAttempt(ctx, domain.ThrottleLogin, email, ip); err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	user, err := h.authService.Authenticate(ctx, authUser)
+	if err != nil {
+		h.recordAttempt(ctx, domain.ThrottleLogin, email, ip)
+		h.auditByEmail(r, domain.AuditLoginFailed, authUser.Email)
+		h.writeFieldErrors(w, err, authUser.Errors)
+		return
+	}
+
+	h.resetAttempts(ctx, domain.ThrottleLogin, email)
+
+	if err := h.loginPolicy(user); err != nil {
+		h.audit(r, domain.AuditLoginFailed, nil, user, nil)
+		h.writeError(w, err)
+		return
+	}
+
+	if user.TOTPEnabled {
+		token, err := h.encodeMFAPending(user)
+		if err != nil {
+			h.writeError(w, err)
+			return
+		}
+
+		h.writeJSON(w, http.StatusOK, apiMFARequiredResponse{MFARequired: true, MFAToken: token})
+		return
+	}
+
+	if h.writeAuthResponse(w, r, http.StatusOK, user) {
+		h.audit(r, domain.AuditLoginSucceeded, user, user, nil)
+	}
+}
+
+// apiLoginMFA completes a login of a user with two-factor authentication enabled
+func (h *handler) apiLoginMFA(w http.ResponseWriter, r *http.Request) {
+	var req apiLoginMFARequest
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+
+	pending, err := h.decodeMFAPending(req.MFAToken)
+	if err != nil {
+		h.writeError(w, errors.NewNotAuthorized(domain.ErrInvalidToken).WithMessage("invalid or expired mfa token"))
+		return
+	}
+
+	user, err := h.userService.FindByID(r.Context(), pending.UserID)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	if user == nil {
+		h.writeError(w, errors.NewNotAuthorized(domain.ErrInvalidToken).WithMessage("invalid or expired mfa token"))
+		return
+	}
+
+	ctx := r.Context()
+	keys := []domain.ThrottleKey{domain.ThrottleUser(user.ID), domain.ThrottleIP(clientIP(r))}
+	if err := h.allowAttempt(ctx, domain.ThrottleMFA, keys...); err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	if err := h.mfaService.Verify(ctx, user, req.Code); err != nil {
+		h.recordAttempt(ctx, domain.ThrottleMFA, keys...)
+		h.audit(r, domain.AuditLoginFailed, nil, user, nil)
+		h.writeError(w, err)
+		return
+	}
+
+	h.resetAttempts(ctx, domain.ThrottleMFA, domain.ThrottleUser(user.ID))
+
+	if h.writeAuthResponse(w, r, http.StatusOK, user) {
+		h.audit(r, domain.AuditLoginSucceeded, user, user, nil)
+	}
+}
+
+// writeAuthResponse starts a session of the user and writes its tokens, it reports whether the
+// session was started
+func (h *handler) writeAuthResponse(w http.ResponseWriter, r *http.Request, status int, user *domain.User) bool {
+	if !h.authService.EmailVerificationPolicy().AllowsLogin(user) {
+		h.writeError(w, emailNotVerified())
+		return false
+	}
+
+	token, session, err := h.sessionService.Create(r.Context(), user, h.sessionMeta(r, user))
+	if err != nil {
+		h.writeError(w, err)
+		return false
+	}
+
+	resp := apiAuthResponse{
+		Token:   token,
+		Profile: h.apiProfile(r.Context(), user, session),
+	}
+
+	if h.tokenService != nil {
+		pair, err := h.tokenService.Issue(r.Context(), user, session.OrganizationID)
+		if err != nil {
+			h.writeError(w, err)
+			return false
+		}
+		resp.TokenPair = pair
+	}
+
+	h.writeJSON(w, status, resp)
+	return true
+}
+
+func (h *handler) apiRefreshToken(w http.ResponseWriter, r *http.Request) {
+	var req apiRefreshTokenRequest
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+
+	pair, err := h.tokenService.Refresh(r.Context(), req.RefreshToken)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, pair)
+}
+
+func (h *handler) apiRevokeToken(w http.ResponseWriter, r *http.Request) {
+	var req apiRefreshTokenRequest
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+
+	if err := h.tokenService.Revoke(r.Context(), req.RefreshToken); err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	h.writeJSON(w, http.StatusNoContent, nil)
+}
+
+func (h *handler) apiLogout(w http.ResponseWriter, r *http.Request) {
+	user, _ := userFromContext(r.Context())
+
+	if session, ok := sessionFromContext(r.Context()); ok {
+		if err := h.sessionService.Revoke(r.Context(), user.ID, session.ID); err != nil {
+			h.writeError(w, err)
+			return
+		}
+	}
+
+	h.audit(r, domain.AuditLogout, user, user, nil)
+	h.writeJSON(w, http.StatusNoContent, nil)
+}
+
+func (h *handler) apiForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req apiForgotPasswordRequest
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+
+	authUser := domain.NewAuthUser(req.Email, "")
+	if !authUser.ValidateEmail() {
+		h.writeFieldErrors(w, ErrValidationFailed, authUser.Errors)
+		return
+	}
+
+	keys := []domain.ThrottleKey{domain.ThrottleEmail(authUser.Email), domain.ThrottleIP(clientIP(r))}
+	if err := h.allowAttempt(r.Context(), domain.ThrottleForgotPassword, keys...); err != nil {
+		h.writeError(w, err)
+		return
+	}
+	h.recordAttempt(r.Context(), domain.ThrottleForgotPassword, keys...)
+
+	// the response is the same whether the email exists or not to avoid bruteforce
+	token, err := h.authService.SetUserRecoveryToken(r.Context(), authUser.Email)
+	if err == nil {
+		authUser.RecoveryToken = token
+		h.authService.SendResetPasswordLink(r.Context(), authUser)
+		h.auditByEmail(r, domain.AuditPasswordResetRequested, authUser.Email)
+	}
+
+	h.writeJSON(w, http.StatusAccepted, nil)
+}
+
+func (h *handler) apiNewPassword(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req apiNewPasswordRequest
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+
+	authUser := domain.NewAuthUser("", req.Password)
+	if !authUser.ValidatePassword() {
+		h.writeFieldErrors(w, ErrValidationFailed, authUser.Errors)
+		return
+	}
+
+	user, err := h.authService.ResetPassword(ctx, req.Token, authUser.Password)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	h.audit(r, domain.AuditPasswordResetCompleted, user, user, nil)
+
+	h.writeJSON(w, http.StatusNoContent, nil)
+}
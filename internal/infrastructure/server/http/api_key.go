@@ -0,0 +1,98 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/pkg/errors"
+)
+
+func (h *handler) loadAPIKeys(ctx context.Context, prof *profile, userID int) {
+	if h.apiKeyService == nil {
+		return
+	}
+
+	keys, err := h.apiKeyService.List(ctx, userID)
+	if err != nil {
+		h.log.Error().Err(err).Sendf("failed to list api keys")
+		return
+	}
+
+	// the revoked keys are kept in the storage but not shown
+	for _, key := range keys {
+		if key.RevokedAt == nil {
+			prof.APIKeys = append(prof.APIKeys, key)
+		}
+	}
+	prof.APIKeyScopes = domain.APIKeyScopes
+}
+
+// postCreateAPIKey requires the session cookie, the API keys cannot create other keys. The page
+// shows the plaintext of the key once.
+func (h *handler) postCreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	user, session, ok := h.currentSession(w, r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	days, err := strconv.Atoi(r.FormValue("expires_in_days"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	_, plaintext, err := h.apiKeyService.Create(r.Context(), user, r.FormValue("name"), r.Form["scope"], time.Duration(days)*24*time.Hour)
+	if err != nil {
+		if describer, ok := errors.InvalidArgumentCast(err); ok {
+			w.WriteHeader(http.StatusBadRequest)
+			h.writeProfile(w, r, user, session, map[string]string{"APIKeys": describer.GetMessage()})
+			return
+		}
+
+		h.log.Error().Err(err).Sendf("failed to create api key")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	prof := h.newProfile(r, user, session, nil)
+	prof.NewAPIKey = plaintext
+
+	w.Header().Set("Cache-Control", "no-store")
+	h.writeTemplate(w, "profile", prof)
+}
+
+func (h *handler) postRevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	user, _, ok := h.currentSession(w, r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	keyID, err := strconv.Atoi(r.FormValue("key_id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := h.apiKeyService.Revoke(r.Context(), user.ID, keyID); err != nil {
+		if _, ok := errors.NotFoundCast(err); ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		h.log.Error().Err(err).Sendf("failed to revoke api key")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/profile", http.StatusSeeOther)
+}
@@ -0,0 +1,150 @@
+package http_test
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+)
+
+var newAPIKey = regexp.MustCompile(`value="(upk_[\w-]+)"`)
+
+// createAPIKey creates a key from the profile page and returns its plaintext
+func (ts *testServer) createAPIKey(t *testing.T, browser *http.Client, name string, scopes ...string) string {
+	p := ts.post(t, browser, "/api-keys", url.Values{"name": {name}, "scope": scopes, "expires_in_days": {"30"}})
+	require.Equal(t, http.StatusOK, p.status, p.body)
+
+	match := newAPIKey.FindStringSubmatch(p.body)
+	require.Len(t, match, 2, "the key is shown once")
+	return match[1]
+}
+
+// withKey sends the request with the key and without following the redirects
+func (ts *testServer) withKey(t *testing.T, method, path, key, body string) *http.Response {
+	req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+key)
+	if method == http.MethodPost {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	return resp
+}
+
+func TestHandler_APIKeys(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	browser := newBrowser(t)
+	user := ts.signup(t, browser, "user@example.com", "secret-password")
+
+	readKey := ts.createAPIKey(t, browser, "read script", domain.APIKeyScopeProfileRead)
+
+	p := ts.get(t, browser, "/profile")
+	assert.Contains(t, p.body, "read script")
+	assert.Contains(t, p.body, readKey[:12], "the prefix tells the keys apart")
+	assert.NotContains(t, p.body, readKey, "the key is not shown again")
+
+	var profile domain.Profile
+	resp := ts.getJSON(t, "/api/v1/profile", readKey, &profile)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "user@example.com", profile.Email)
+
+	keys, err := ts.apiKeys.List(context.Background(), user.ID)
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	assert.NotNil(t, keys[0].LastUsedAt, "the use of the key is recorded")
+
+	resp = ts.withKey(t, "PUT", "/api/v1/profile", readKey, `{"email": "user@example.com", "name": "Script"}`)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode, "the read scope does not allow changes")
+
+	resp = ts.withKey(t, "POST", "/sessions/revoke-all", readKey, "")
+	assert.Equal(t, "/login", resp.Header.Get("Location"))
+	p = ts.get(t, browser, "/profile")
+	assert.Equal(t, "/profile", p.path, "the browser session is kept")
+
+	writeKey := ts.createAPIKey(t, browser, "write script", domain.APIKeyScopeProfileWrite)
+	resp = ts.withKey(t, "PUT", "/api/v1/profile", writeKey, `{"email": "user@example.com", "name": "Script"}`)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp = ts.withKey(t, "PUT", "/api/v1/profile", writeKey, `{"email": "attacker@example.com", "name": "Script"}`)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode, "keys cannot change the email")
+	resp = ts.getJSON(t, "/api/v1/profile", writeKey, &profile)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "user@example.com", profile.Email)
+
+	resp = ts.withKey(t, "POST", "/api-keys", writeKey, url.Values{"name": {"minted"}, "scope": {"profile:write"}, "expires_in_days": {"30"}}.Encode())
+	assert.Equal(t, "/login", resp.Header.Get("Location"), "keys cannot create other keys")
+
+	keys, err = ts.apiKeys.List(context.Background(), user.ID)
+	require.NoError(t, err)
+	p = ts.post(t, browser, "/api-keys/revoke", url.Values{"key_id": {strconv.Itoa(keys[0].ID)}})
+	assert.Equal(t, "/profile", p.path)
+	assert.NotContains(t, p.body, "read script")
+
+	resp = ts.getJSON(t, "/api/v1/profile", readKey, &struct{}{})
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, "revoked keys stop working")
+}
+
+func TestHandler_APIKeysCannotManageTheAccount(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	browser := newBrowser(t)
+	user := ts.signup(t, browser, "user@example.com", "secret-password")
+	readKey := ts.createAPIKey(t, browser, "read script", domain.APIKeyScopeProfileRead)
+	writeKey := ts.createAPIKey(t, browser, "write script", domain.APIKeyScopeProfileWrite)
+
+	resp := ts.withKey(t, "POST", "/passkeys/register/begin", writeKey, "")
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	resp = ts.withKey(t, "POST", "/passkeys/register/finish", writeKey, "{}")
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	for _, key := range []string{readKey, writeKey} {
+		resp = ts.withKey(t, "GET", "/mfa/setup", key, "")
+		assert.Equal(t, "/login", resp.Header.Get("Location"))
+	}
+
+	resp = ts.withKey(t, "POST", "/mfa/setup", writeKey, url.Values{"code": {"123456"}}.Encode())
+	assert.Equal(t, "/login", resp.Header.Get("Location"))
+
+	found, err := ts.users.FindByID(context.Background(), user.ID)
+	require.NoError(t, err)
+	assert.Empty(t, found.TOTPSecret, "no enrollment was started")
+	assert.False(t, found.TOTPEnabled)
+
+	resp = ts.withKey(t, "POST", "/sessions/revoke-all", writeKey, "")
+	assert.Equal(t, "/login", resp.Header.Get("Location"))
+	p := ts.get(t, browser, "/profile")
+	assert.Equal(t, "/profile", p.path, "the browser session is kept")
+}
+
+func TestHandler_APIKeyValidation(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	browser := newBrowser(t)
+	ts.signup(t, browser, "user@example.com", "secret-password")
+
+	p := ts.post(t, browser, "/api-keys", url.Values{"name": {"script"}, "expires_in_days": {"30"}})
+	assert.Equal(t, http.StatusBadRequest, p.status)
+	assert.Contains(t, p.body, "at least one scope is required")
+
+	p = ts.post(t, browser, "/api-keys", url.Values{"name": {"script"}, "scope": {"profile:read"}, "expires_in_days": {"3650"}})
+	assert.Equal(t, http.StatusBadRequest, p.status)
+	assert.Contains(t, p.body, "keys expire after a day to a year")
+}
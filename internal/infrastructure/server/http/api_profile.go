@@ -0,0 +1,73 @@
+package http
+
+import (
+	"context"
+	"net/http"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/pkg/errors"
+)
+
+func (h *handler) apiGetProfile(w http.ResponseWriter, r *http.Request) {
+	user, _ := userFromContext(r.Context())
+	session, _ := sessionFromContext(r.Context())
+
+	h.writeJSON(w, http.StatusOK, h.apiProfile(r.Context(), user, session))
+}
+
+// apiProfile is the profile of the user with the current organization of the session, if any
+func (h *handler) apiProfile(ctx context.Context, user *domain.User, session *domain.Session) domain.Profile {
+	p := profileFromUser(user)
+	p.Organization = h.currentOrganization(ctx, user, session)
+	return p
+}
+
+func (h *handler) apiPutProfile(w http.ResponseWriter, r *http.Request) {
+	user, _ := userFromContext(r.Context())
+
+	var req apiProfileRequest
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+
+	if !h.authService.EmailVerificationPolicy().AllowsProfileEdit(user) {
+		h.writeError(w, emailNotVerified())
+		return
+	}
+
+	// the email recovers the account, a leaked key must not be enough to take it over
+	if viaAPIKey(r.Context()) && req.Email != user.Email {
+		h.writeError(w, errors.NewRuleNotSatisfied(domain.ErrPermissionDenied).WithMessage("the email cannot be changed with an api key"))
+		return
+	}
+
+	userProfile := domain.Profile{
+		ID:      user.ID,
+		Name:    req.Name,
+		Email:   req.Email,
+		Address: req.Address,
+		Phone:   req.Phone,
+	}
+
+	if err := userProfile.Validate(); err != nil {
+		h.writeError(w, errors.NewInvalidArgument(domain.ErrInvalidProfile).WithMessage(err.Error()))
+		return
+	}
+
+	before := *user
+	emailChanged := setProfile(user, userProfile)
+
+	if err := h.userService.Update(r.Context(), user); err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	h.auditUserChanges(r, user, &before, user)
+
+	if emailChanged {
+		h.sendVerificationEmail(r.Context(), user)
+	}
+
+	session, _ := sessionFromContext(r.Context())
+	h.writeJSON(w, http.StatusOK, h.apiProfile(r.Context(), user, session))
+}
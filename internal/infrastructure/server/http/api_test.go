@@ -0,0 +1,74 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/pkg/errors"
+)
+
+func TestStatusFromError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{name: "invalid argument", err: errors.NewInvalidArgument("CODE"), want: http.StatusBadRequest},
+		{name: "not authorized", err: errors.NewNotAuthorized("CODE"), want: http.StatusUnauthorized},
+		{name: "not found", err: errors.NewNotFound("CODE"), want: http.StatusNotFound},
+		{name: "duplicated record", err: errors.NewDuplicatedRecord("CODE"), want: http.StatusConflict},
+		{name: "rule not satisfied", err: errors.NewRuleNotSatisfied("CODE"), want: http.StatusUnprocessableEntity},
+		{name: "too many attempts", err: errors.NewRuleNotSatisfied(domain.ErrTooManyAttempts), want: http.StatusTooManyRequests},
+		{name: "email not verified", err: errors.NewRuleNotSatisfied(domain.ErrEmailNotVerified), want: http.StatusForbidden},
+		{name: "account disabled", err: errors.NewRuleNotSatisfied(domain.ErrAccountDisabled), want: http.StatusForbidden},
+		{name: "permission denied", err: errors.NewRuleNotSatisfied(domain.ErrPermissionDenied), want: http.StatusForbidden},
+		{name: "plain error", err: fmt.Errorf("plain"), want: http.StatusInternalServerError},
+		{name: "nil error", err: nil, want: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, statusFromError(tt.err))
+		})
+	}
+}
+
+func TestBearerToken(t *testing.T) {
+	r, _ := http.NewRequest("GET", "/api/v1/profile", nil)
+	assert.Equal(t, "", bearerToken(r))
+
+	r.Header.Set("Authorization", "Bearer abc-123")
+	assert.Equal(t, "abc-123", bearerToken(r))
+
+	r.Header.Set("Authorization", "Basic abc-123")
+	assert.Equal(t, "", bearerToken(r))
+}
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		want       string
+	}{
+		{name: "direct connection", remoteAddr: "203.0.113.7:5123", want: "203.0.113.7"},
+		{name: "behind proxy", remoteAddr: "10.0.0.2:5123", forwarded: "198.51.100.1, 203.0.113.7", want: "203.0.113.7"},
+		{name: "loopback proxy", remoteAddr: "[::1]:5123", forwarded: "203.0.113.7", want: "203.0.113.7"},
+		{name: "spoofed header", remoteAddr: "203.0.113.7:5123", forwarded: "198.51.100.1", want: "203.0.113.7"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := http.NewRequest("POST", "/login", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.forwarded != "" {
+				r.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+
+			assert.Equal(t, tt.want, clientIP(r))
+		})
+	}
+}
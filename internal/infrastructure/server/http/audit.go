@@ -0,0 +1,260 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+)
+
+const auditLogPerPage = 50
+
+// auditDescriptions name the events on the pages
+var auditDescriptions = map[domain.AuditEventType]string{
+	domain.AuditLoginSucceeded:         "Signed in",
+	domain.AuditLoginFailed:            "Failed sign in",
+	domain.AuditLogout:                 "Signed out",
+	domain.AuditSignup:                 "Account created",
+	domain.AuditPasswordResetRequested: "Password reset requested",
+	domain.AuditPasswordResetCompleted: "Password reset",
+	domain.AuditProfileChanged:         "Profile changed",
+	domain.AuditProviderLinked:         "Login provider linked",
+}
+
+// auditEntry is an event as shown on the pages
+type auditEntry struct {
+	*domain.AuditEvent
+	Description string
+	Changes     domain.AuditChanges
+	// Actor tells who acted when it was not the user of the event, empty otherwise
+	Actor string
+	// Admin shows the ids of the users, for the admin area
+	Admin bool
+}
+
+type auditLogPage struct {
+	Events   []auditEntry
+	PrevPage int
+	NextPage int
+}
+
+// audit records the event of the request. A failure is only logged, the log must not stop users
+// from signing in.
+func (h *handler) audit(r *http.Request, eventType domain.AuditEventType, actor, subject *domain.User, changes domain.AuditChanges) {
+	if h.auditService == nil {
+		return
+	}
+
+	event := &domain.AuditEvent{
+		Type:      eventType,
+		IP:        clientIP(r),
+		UserAgent: r.UserAgent(),
+	}
+
+	if actor != nil {
+		actorID := actor.ID
+		event.ActorID = &actorID
+	}
+
+	if subject != nil {
+		userID := subject.ID
+		event.UserID = &userID
+	}
+
+	if key, ok := r.Context().Value(adminAPIKeyContextKey).(*domain.AdminAPIKey); ok {
+		keyID := key.ID
+		event.AdminAPIKeyID = &keyID
+	}
+
+	if err := h.auditService.Record(r.Context(), event, changes); err != nil {
+		h.log.Error().Err(err).Sendf("failed to record the %s audit event", eventType)
+	}
+}
+
+// auditByEmail records an event without actor about the account of the email, e.g. a rejected login.
+// The event has no user when no account has the email.
+func (h *handler) auditByEmail(r *http.Request, eventType domain.AuditEventType, email string) {
+	if h.auditService == nil {
+		return
+	}
+
+	user, err := h.userService.FindByEmail(r.Context(), email)
+	if err != nil {
+		h.log.Error().Err(err).Sendf("failed to find the user of the %s audit event", eventType)
+	}
+
+	h.audit(r, eventType, nil, user, nil)
+}
+
+// auditUserChanges records the changed fields of the account, nothing is recorded when no field
+// changed
+func (h *handler) auditUserChanges(r *http.Request, actor *domain.User, before, after *domain.User) {
+	changes := domain.UserChanges(before, after)
+	if len(changes) == 0 {
+		return
+	}
+
+	h.audit(r, domain.AuditProfileChanged, actor, after, changes)
+}
+
+// auditedAdminAction runs the action of an admin on the user and records the fields it changed. The
+// account is only read around the action when events are recorded.
+func (h *handler) auditedAdminAction(r *http.Request, actor *domain.User, userID int, action func(ctx context.Context, userID int) error) error {
+	if h.auditService == nil {
+		return action(r.Context(), userID)
+	}
+
+	before, err := h.adminService.User(r.Context(), userID)
+	if err != nil {
+		return err
+	}
+
+	if err := action(r.Context(), userID); err != nil {
+		return err
+	}
+
+	after, err := h.adminService.User(r.Context(), userID)
+	if err != nil {
+		h.log.Error().Err(err).Sendf("failed to find user %d to record the admin changes", userID)
+		return nil
+	}
+
+	h.auditUserChanges(r, actor, before.User, after.User)
+	return nil
+}
+
+// auditProviderLinked records the identity as the change of the event
+func (h *handler) auditProviderLinked(r *http.Request, actor *domain.User, identity *domain.UserIdentity) {
+	user := &domain.User{ID: identity.UserID}
+	h.audit(r, domain.AuditProviderLinked, actor, user, domain.AuditChanges{
+		"identity": {From: nil, To: identity.Provider},
+	})
+}
+
+// getAuditLog shows the events of the account of the user, newest first
+func (h *handler) getAuditLog(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.alreadyLoggedIn(w, r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	page := 1
+	if value := r.URL.Query().Get("page"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		page = n
+	}
+
+	events, total, err := h.auditService.List(r.Context(), &domain.AuditFilter{
+		UserID: &user.ID,
+		Limit:  auditLogPerPage,
+		Offset: (page - 1) * auditLogPerPage,
+	})
+	if err != nil {
+		h.log.Error().Err(err).Sendf("failed to list the audit log of user %d", user.ID)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	h.writeTemplate(w, "audit_log", auditLogPage{
+		Events:   h.auditEntries(events, user, false),
+		PrevPage: page - 1,
+		NextPage: nextPage(page, auditLogPerPage, total),
+	})
+}
+
+// auditEntries describes the events for the pages. The actor is told when it is not the user of the
+// event, which is the signed in user on their own log.
+func (h *handler) auditEntries(events []*domain.AuditEvent, viewer *domain.User, admin bool) []auditEntry {
+	entries := make([]auditEntry, 0, len(events))
+	for _, event := range events {
+		changes, err := event.ChangeSet()
+		if err != nil {
+			h.log.Error().Err(err).Sendf("invalid changes of audit event %d", event.ID)
+		}
+
+		entry := auditEntry{
+			AuditEvent:  event,
+			Description: auditDescriptions[event.Type],
+			Changes:     changes,
+			Admin:       admin,
+		}
+
+		switch {
+		case event.AdminAPIKeyID != nil:
+			entry.Actor = "admin API key " + strconv.Itoa(*event.AdminAPIKeyID)
+		case event.ActorID == nil || (event.UserID != nil && *event.ActorID == *event.UserID):
+		case admin:
+			entry.Actor = "user " + strconv.Itoa(*event.ActorID)
+		case *event.ActorID != viewer.ID:
+			entry.Actor = "an administrator"
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries
+}
+
+// auditFilterFromQuery reads the filter of the admin API and the admin area from the query string,
+// the times are RFC 3339 or dates
+func auditFilterFromQuery(query url.Values) (*domain.AuditFilter, map[string]string) {
+	fieldErrors := make(map[string]string)
+	filter := &domain.AuditFilter{
+		Type: domain.AuditEventType(query.Get("type")),
+		IP:   query.Get("ip"),
+	}
+
+	if filter.Type != "" && !filter.Type.Valid() {
+		fieldErrors["type"] = "unknown event type"
+	}
+
+	for name, dst := range map[string]**int{
+		"user_id":  &filter.UserID,
+		"actor_id": &filter.ActorID,
+	} {
+		if value := query.Get(name); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				fieldErrors[name] = "must be a number"
+				continue
+			}
+			*dst = &n
+		}
+	}
+
+	for name, dst := range map[string]**time.Time{
+		"after":  &filter.After,
+		"before": &filter.Before,
+	} {
+		if value := query.Get(name); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				t, err = time.Parse("2006-01-02", value)
+			}
+			if err != nil {
+				fieldErrors[name] = "must be an RFC 3339 time or a date"
+				continue
+			}
+			*dst = &t
+		}
+	}
+
+	return filter, fieldErrors
+}
+
+// nextPage returns the page after page, 0 when it is the last one
+func nextPage(page, perPage, total int) int {
+	if page*perPage >= total {
+		return 0
+	}
+
+	return page + 1
+}
@@ -0,0 +1,282 @@
+package http_test
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/pkg/oidc/oidctest"
+)
+
+type adminAPIAuditEvents struct {
+	Events []struct {
+		ID            int
+		Type          domain.AuditEventType
+		ActorID       *int `json:"actor_id"`
+		AdminAPIKeyID *int `json:"admin_api_key_id"`
+		UserID        *int `json:"user_id"`
+		IP            string
+		Changes       domain.AuditChanges
+	}
+	Page    int
+	PerPage int `json:"per_page"`
+	Total   int
+}
+
+// auditEvents returns the events about the user, oldest first
+func (ts *testServer) auditEvents(t *testing.T, userID int) []*domain.AuditEvent {
+	events, _, err := ts.audit.List(context.Background(), &domain.AuditFilter{UserID: &userID})
+	require.NoError(t, err)
+
+	for i, j := 0, len(events)-1; i < j; i, j = i+1, j-1 {
+		events[i], events[j] = events[j], events[i]
+	}
+
+	return events
+}
+
+func auditTypes(events []*domain.AuditEvent) []domain.AuditEventType {
+	types := make([]domain.AuditEventType, 0, len(events))
+	for _, event := range events {
+		types = append(types, event.Type)
+	}
+
+	return types
+}
+
+func TestHandler_AuditLog(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	browser := newBrowser(t)
+	user := ts.signup(t, browser, "user@example.com", "secret-password")
+
+	p := ts.post(t, browser, "/profile", url.Values{
+		"id":    {strconv.Itoa(user.ID)},
+		"name":  {"Jane Doe"},
+		"email": {"jane@example.com"},
+	})
+	require.Equal(t, http.StatusOK, p.status)
+
+	p = ts.get(t, browser, "/logout")
+	assert.Equal(t, "/login", p.path)
+
+	p = ts.post(t, browser, "/login", url.Values{"email": {"jane@example.com"}, "password": {"wrong-password"}})
+	assert.Equal(t, http.StatusUnauthorized, p.status)
+
+	p = ts.post(t, browser, "/login", url.Values{"email": {"jane@example.com"}, "password": {"secret-password"}})
+	assert.Equal(t, "/profile", p.path)
+	assert.Contains(t, p.body, `href="/audit-log"`)
+
+	p = ts.post(t, newBrowser(t), "/password/forgot", url.Values{"email": {"jane@example.com"}})
+	assert.Equal(t, http.StatusOK, p.status)
+	link, err := url.Parse(resetLink.FindString(ts.lastEmail(t, "jane@example.com").Text))
+	require.NoError(t, err)
+	p = ts.post(t, newBrowser(t), "/password/new", url.Values{"token": {link.Query().Get("token")}, "password": {"new-password"}})
+	assert.Contains(t, p.body, "password changed")
+
+	events := ts.auditEvents(t, user.ID)
+	assert.Equal(t, []domain.AuditEventType{
+		domain.AuditSignup,
+		domain.AuditProfileChanged,
+		domain.AuditLogout,
+		domain.AuditLoginFailed,
+		domain.AuditLoginSucceeded,
+		domain.AuditPasswordResetRequested,
+		domain.AuditPasswordResetCompleted,
+	}, auditTypes(events))
+
+	changed := events[1]
+	require.NotNil(t, changed.ActorID)
+	assert.Equal(t, user.ID, *changed.ActorID)
+	assert.NotEmpty(t, changed.IP)
+	assert.Equal(t, "Go-http-client/1.1", changed.UserAgent)
+
+	changes, err := changed.ChangeSet()
+	require.NoError(t, err)
+	assert.Equal(t, domain.AuditChanges{
+		"name":  {From: "", To: "Jane Doe"},
+		"email": {From: "user@example.com", To: "jane@example.com"},
+	}, changes)
+
+	assert.Nil(t, events[3].ActorID, "nobody was signed in on the failed login")
+	assert.Nil(t, events[5].ActorID, "the reset was requested without a session")
+
+	p = ts.post(t, browser, "/login", url.Values{"email": {"missing@example.com"}, "password": {"secret-password"}})
+	assert.Equal(t, http.StatusUnauthorized, p.status)
+	failed, total, err := ts.audit.List(context.Background(), &domain.AuditFilter{Type: domain.AuditLoginFailed})
+	require.NoError(t, err)
+	assert.Equal(t, 2, total)
+	assert.Nil(t, failed[0].UserID, "an unknown email has no account")
+
+	p = ts.get(t, browser, "/audit-log")
+	assert.Equal(t, "/login", p.path, "the password reset revoked the session")
+
+	ts.post(t, browser, "/login", url.Values{"email": {"jane@example.com"}, "password": {"new-password"}})
+	p = ts.get(t, browser, "/audit-log")
+	assert.Equal(t, http.StatusOK, p.status)
+	assert.Contains(t, p.body, "Failed sign in")
+	assert.Contains(t, p.body, "Profile changed")
+	assert.Contains(t, p.body, "user@example.com &rarr; jane@example.com")
+
+	p = ts.get(t, newBrowser(t), "/audit-log")
+	assert.Equal(t, "/login", p.path, "the log requires a session")
+}
+
+func TestHandler_AuditLogProviders(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	ts.google.SignIn(&oidctest.User{
+		Subject:       "google-1",
+		Name:          "Google User",
+		Email:         "google@example.com",
+		EmailVerified: true,
+	})
+
+	p := ts.get(t, newBrowser(t), "/login/google")
+	require.Equal(t, "/profile", p.path)
+	p = ts.get(t, newBrowser(t), "/login/google")
+	require.Equal(t, "/profile", p.path)
+
+	user := ts.identityUser(t, "google", "google-1")
+	require.NotNil(t, user)
+
+	events := ts.auditEvents(t, user.ID)
+	assert.Equal(t, []domain.AuditEventType{
+		domain.AuditSignup,
+		domain.AuditProviderLinked,
+		domain.AuditLoginSucceeded,
+		domain.AuditLoginSucceeded,
+	}, auditTypes(events), "the identity is linked once")
+
+	changes, err := events[1].ChangeSet()
+	require.NoError(t, err)
+	assert.Equal(t, "google", changes["identity"].To)
+
+	ts.google.SignIn(nil)
+	p = ts.get(t, newBrowser(t), "/login/google")
+	assert.Equal(t, http.StatusUnauthorized, p.status, "the user denied the consent")
+
+	ts.keycloak.SignIn(&oidctest.User{Subject: "kc-1", Email: "keycloak@example.com", EmailVerified: false})
+	p = ts.get(t, newBrowser(t), "/login/keycloak")
+	assert.Equal(t, http.StatusBadRequest, p.status, "the provider did not verify the email")
+
+	resp, err := http.Post(ts.URL+"/login/passkey/finish", "application/json", strings.NewReader(`{"credential": {"id": "unknown"}}`))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.NotEqual(t, http.StatusOK, resp.StatusCode)
+
+	failed, total, err := ts.audit.List(context.Background(), &domain.AuditFilter{Type: domain.AuditLoginFailed})
+	require.NoError(t, err)
+	assert.Equal(t, 3, total, "the failed provider and passkey logins are recorded")
+	for _, event := range failed {
+		assert.Nil(t, event.UserID)
+		assert.NotEmpty(t, event.IP)
+	}
+}
+
+func TestHandler_AdminAPIAuditEvents(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	user := ts.signup(t, newBrowser(t), "user@example.com", "secret-password")
+	ts.post(t, newBrowser(t), "/login", url.Values{"email": {"user@example.com"}, "password": {"wrong-password"}})
+
+	var apiErr adminAPIError
+	resp := ts.adminAPI(t, "GET", "/admin/api/audit-events", ts.adminKey(t, domain.PermissionUsersRead), nil, &apiErr)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	assert.Equal(t, string(domain.ErrPermissionDenied), apiErr.Code)
+
+	writeKey := ts.adminKey(t, domain.PermissionUsersWrite)
+	userPath := "/admin/api/users/" + strconv.Itoa(user.ID)
+	resp = ts.adminAPI(t, "PATCH", userPath, writeKey, map[string]string{"phone": "555-0100"}, nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	key := ts.adminKey(t, domain.PermissionAuditRead)
+
+	var list adminAPIAuditEvents
+	resp = ts.adminAPI(t, "GET", "/admin/api/audit-events?user_id="+strconv.Itoa(user.ID)+"&per_page=2", key, nil, &list)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 3, list.Total)
+	assert.Equal(t, 2, list.PerPage)
+	require.Len(t, list.Events, 2)
+
+	changed := list.Events[0]
+	assert.Equal(t, domain.AuditProfileChanged, changed.Type, "the newest event comes first")
+	assert.Nil(t, changed.ActorID)
+	assert.NotNil(t, changed.AdminAPIKeyID, "the key that made the change is recorded")
+	assert.Equal(t, domain.AuditChanges{"phone": {From: "", To: "555-0100"}}, changed.Changes)
+	assert.Equal(t, domain.AuditLoginFailed, list.Events[1].Type)
+
+	list = adminAPIAuditEvents{}
+	resp = ts.adminAPI(t, "GET", "/admin/api/audit-events?type=signup", key, nil, &list)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Len(t, list.Events, 1)
+	assert.Equal(t, user.ID, *list.Events[0].UserID)
+
+	resp = ts.adminAPI(t, "GET", "/admin/api/audit-events?type=unknown&after=yesterday", key, nil, &apiErr)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Contains(t, apiErr.Errors, "type")
+	assert.Contains(t, apiErr.Errors, "after")
+}
+
+func TestHandler_AdminAuditEvents(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	admin := newBrowser(t)
+	adminUser := ts.signupAdmin(t, admin, "admin@example.com")
+
+	userBrowser := newBrowser(t)
+	user := ts.signup(t, userBrowser, "user@example.com", "secret-password")
+
+	userPath := "/admin/users/" + strconv.Itoa(user.ID)
+	p := ts.get(t, admin, userPath)
+	assert.Contains(t, p.body, `href="/admin/audit-events?user_id=`+strconv.Itoa(user.ID)+`"`)
+
+	form := ts.adminForm(t, admin, userPath)
+	p = ts.post(t, admin, userPath+"/disable", form)
+	require.Equal(t, http.StatusOK, p.status)
+	p = ts.post(t, admin, userPath+"/reset-password", form)
+	require.Equal(t, http.StatusOK, p.status)
+
+	events := ts.auditEvents(t, user.ID)
+	assert.Equal(t, []domain.AuditEventType{
+		domain.AuditSignup,
+		domain.AuditProfileChanged,
+		domain.AuditPasswordResetRequested,
+	}, auditTypes(events))
+	for _, event := range events[1:] {
+		require.NotNil(t, event.ActorID)
+		assert.Equal(t, adminUser.ID, *event.ActorID, "the admin acted")
+	}
+
+	p = ts.get(t, admin, "/admin/audit-events?user_id="+strconv.Itoa(user.ID))
+	assert.Equal(t, http.StatusOK, p.status)
+	assert.Contains(t, p.body, "3 events")
+	assert.Contains(t, p.body, "disabled: false &rarr; true")
+	assert.Contains(t, p.body, "by user "+strconv.Itoa(adminUser.ID))
+
+	p = ts.get(t, admin, "/admin/audit-events?type=signup&after=2000-01-01")
+	assert.Equal(t, http.StatusOK, p.status)
+	assert.Contains(t, p.body, "2 events")
+
+	p = ts.get(t, admin, "/admin/audit-events?user_id=me")
+	assert.Equal(t, http.StatusBadRequest, p.status)
+
+	other := newBrowser(t)
+	ts.signup(t, other, "other@example.com", "other-password")
+	p = ts.get(t, other, "/admin/audit-events")
+	assert.Equal(t, http.StatusForbidden, p.status)
+
+	p = ts.get(t, userBrowser, "/audit-log")
+	assert.Equal(t, "/login", p.path, "the disabled user was signed out")
+}
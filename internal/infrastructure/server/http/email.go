@@ -0,0 +1,156 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/pkg/errors"
+)
+
+// resendVerificationMessage is the same whether the account exists or not
+const resendVerificationMessage = "if the account exists and its email is not verified, a new link was sent"
+
+type emailVerification struct {
+	Email   string
+	Message string
+	Resend  bool
+	Errors  map[string]string
+}
+
+type apiVerifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+type apiResendVerificationRequest struct {
+	Email string `json:"email"`
+}
+
+type apiEmailVerificationRequiredResponse struct {
+	EmailVerificationRequired bool           `json:"email_verification_required"`
+	Profile                   domain.Profile `json:"profile"`
+}
+
+func emailNotVerified() error {
+	return errors.NewRuleNotSatisfied(domain.ErrEmailNotVerified).WithMessage("email not verified")
+}
+
+// sendVerificationEmail queues the link, a failure does not fail the request since the user can
+// ask for a new link
+func (h *handler) sendVerificationEmail(ctx context.Context, user *domain.User) {
+	if err := h.authService.SendVerificationEmail(ctx, user); err != nil {
+		h.log.Error().Err(err).Sendf("failed to send verification email")
+	}
+}
+
+// writeEmailNotVerified renders the page asking to verify the email, used when the policy does
+// not let unverified users sign in
+func (h *handler) writeEmailNotVerified(w http.ResponseWriter, status int, user *domain.User, message string) {
+	w.WriteHeader(status)
+	h.writeTemplate(w, "verify_email", emailVerification{
+		Email:   user.Email,
+		Message: message,
+		Resend:  true,
+	})
+}
+
+func (h *handler) getVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+
+	if _, err := h.authService.VerifyEmail(r.Context(), token); err != nil {
+		if _, ok := errors.InvalidArgumentCast(err); !ok {
+			h.log.Error().Err(err).Sendf("failed to verify email")
+		}
+
+		w.WriteHeader(http.StatusBadRequest)
+		h.writeTemplate(w, "verify_email", emailVerification{
+			Resend: true,
+			Errors: map[string]string{"Link": "invalid or expired link"},
+		})
+		return
+	}
+
+	h.writeTemplate(w, "verify_email", emailVerification{Message: "your email is verified"})
+}
+
+// postResendVerification sends a new link to the email of the signed in user or to the email of
+// the form
+func (h *handler) postResendVerification(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	email := r.FormValue("email")
+	if user, ok := h.alreadyLoggedIn(w, r); ok {
+		email = user.Email
+	}
+
+	authUser := domain.NewAuthUser(email, "")
+	if !authUser.ValidateEmail() {
+		w.WriteHeader(http.StatusBadRequest)
+		h.writeTemplate(w, "verify_email", emailVerification{Email: email, Resend: true, Errors: authUser.Errors})
+		return
+	}
+
+	keys := []domain.ThrottleKey{domain.ThrottleEmail(authUser.Email), domain.ThrottleIP(clientIP(r))}
+	if err := h.allowAttempt(ctx, domain.ThrottleVerifyEmail, keys...); err != nil {
+		w.WriteHeader(http.StatusTooManyRequests)
+		h.writeTemplate(w, "verify_email", emailVerification{Email: email, Errors: map[string]string{"Link": tooManyAttemptsMessage}})
+		return
+	}
+	h.recordAttempt(ctx, domain.ThrottleVerifyEmail, keys...)
+
+	h.resendVerification(ctx, authUser.Email)
+
+	h.writeTemplate(w, "verify_email", emailVerification{Email: email, Message: resendVerificationMessage})
+}
+
+func (h *handler) resendVerification(ctx context.Context, email string) {
+	user, err := h.userService.FindByEmail(ctx, email)
+	if err != nil {
+		h.log.Error().Err(err).Sendf("failed to find user")
+		return
+	}
+
+	if user != nil && !user.EmailVerified() {
+		h.sendVerificationEmail(ctx, user)
+	}
+}
+
+func (h *handler) apiVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var req apiVerifyEmailRequest
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+
+	user, err := h.authService.VerifyEmail(r.Context(), strings.TrimSpace(req.Token))
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, profileFromUser(user))
+}
+
+func (h *handler) apiResendVerification(w http.ResponseWriter, r *http.Request) {
+	var req apiResendVerificationRequest
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+
+	authUser := domain.NewAuthUser(req.Email, "")
+	if !authUser.ValidateEmail() {
+		h.writeFieldErrors(w, ErrValidationFailed, authUser.Errors)
+		return
+	}
+
+	keys := []domain.ThrottleKey{domain.ThrottleEmail(authUser.Email), domain.ThrottleIP(clientIP(r))}
+	if err := h.allowAttempt(r.Context(), domain.ThrottleVerifyEmail, keys...); err != nil {
+		h.writeError(w, err)
+		return
+	}
+	h.recordAttempt(r.Context(), domain.ThrottleVerifyEmail, keys...)
+
+	h.resendVerification(r.Context(), authUser.Email)
+
+	h.writeJSON(w, http.StatusAccepted, nil)
+}
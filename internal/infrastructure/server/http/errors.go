@@ -17,4 +17,11 @@ var (
 
 	ErrNotAuthorizedRequest = errors.NewNotAuthorized(ErrNotAuthorizedRequestCode).
 				WithMessage("token not authorized")
+
+	ErrValidationFailedCode errors.Code = "VALIDATION_FAILED"
+
+	ErrValidationFailed = errors.NewInvalidArgument(ErrValidationFailedCode).
+				WithMessage("one or more fields are invalid")
+
+	ErrInternalRequestCode errors.Code = "INTERNAL_ERROR"
 )
@@ -1,7 +1,9 @@
 package http
 
 import (
+	"net"
 	"net/http"
+	"strings"
 
 	"github.com/gorilla/mux"
 	"github.com/gorilla/sessions"
@@ -12,8 +14,10 @@ import (
 
 const authSession string = "user_auth_session"
 const authCookie string = "user_auth"
-const googleSession string = "google_session"
-const googleCookie string = "google_cookie"
+const mfaSession string = "mfa_session"
+const mfaCookie string = "mfa_pending"
+const passkeySession string = "passkey_session"
+const passkeyCookie string = "passkey_nonce"
 const sessionLength int = 86400 * 7 // 1 week in seconds
 
 var defaultSessionOptions = &sessions.Options{
@@ -24,23 +28,68 @@ var defaultSessionOptions = &sessions.Options{
 
 type profile struct {
 	domain.Profile
-	Errors  map[string]string
-	Message string
+	Sessions          []*domain.Session
+	CurrentSessionID  int
+	MFAEnabled        bool
+	EmailVerified     bool
+	EditAllowed       bool
+	Passkeys          []*domain.WebAuthnCredential
+	Identities        []linkedIdentity
+	LinkableProviders []domain.LoginProvider
+	APIKeys           []*domain.APIKey
+	APIKeyScopes      []string
+	// NewAPIKey is the plaintext of the key just created, it is only shown once
+	NewAPIKey string
+	// Organizations are those of the user, the current one is Profile.Organization
+	Organizations        []*domain.UserOrganization
+	OrganizationsEnabled bool
+	AuditLogEnabled      bool
+	Errors               map[string]string
+	Message              string
 }
 
 type handler struct {
 	userService     domain.UserService
 	authService     domain.AuthService
 	templateService domain.TemplateService
+	sessionService  domain.SessionService
+	mfaService      domain.MFAService
+	webAuthnService domain.WebAuthnService
+	throttleService domain.ThrottleService
+	tokenService    domain.TokenService
+	oauthService    domain.OAuthService
+	rbacService     domain.RBACService
+	adminService    domain.AdminService
+	adminKeyService domain.AdminAPIKeyService
+	apiKeyService   domain.APIKeyService
+	orgService      domain.OrganizationService
+	auditService    domain.AuditService
 	store           *sessions.CookieStore
 	log             log.Logger
 }
 
-func NewHandler(userService domain.UserService, authService domain.AuthService, templateService domain.TemplateService, sessionKey string, log log.Logger) http.Handler {
+// NewHandler creates the router of the server. tokenService is optional, when nil signed access
+// tokens are not issued. oauthService is optional too, when nil the OAuth endpoints are not served,
+// and so is adminService for the admin area. The admin JSON API also needs adminKeyService.
+// apiKeyService is optional, when nil the users cannot create personal API keys, and so is
+// orgService for the organizations. auditService is optional too, when nil no event is recorded.
+func NewHandler(userService domain.UserService, authService domain.AuthService, templateService domain.TemplateService, sessionService domain.SessionService, mfaService domain.MFAService, webAuthnService domain.WebAuthnService, throttleService domain.ThrottleService, tokenService domain.TokenService, oauthService domain.OAuthService, rbacService domain.RBACService, adminService domain.AdminService, adminKeyService domain.AdminAPIKeyService, apiKeyService domain.APIKeyService, orgService domain.OrganizationService, auditService domain.AuditService, sessionKey string, log log.Logger) http.Handler {
 	handler := &handler{
 		userService:     userService,
 		authService:     authService,
 		templateService: templateService,
+		sessionService:  sessionService,
+		mfaService:      mfaService,
+		webAuthnService: webAuthnService,
+		throttleService: throttleService,
+		tokenService:    tokenService,
+		oauthService:    oauthService,
+		rbacService:     rbacService,
+		adminService:    adminService,
+		adminKeyService: adminKeyService,
+		apiKeyService:   apiKeyService,
+		orgService:      orgService,
+		auditService:    auditService,
 		store:           sessions.NewCookieStore([]byte(sessionKey)),
 		log:             log,
 	}
@@ -51,19 +100,71 @@ func NewHandler(userService domain.UserService, authService domain.AuthService,
 	r.HandleFunc("/", redirectToLogin).Methods("GET")
 	r.HandleFunc("/login", handler.getLogin).Methods("GET")
 	r.HandleFunc("/login", handler.postLogin).Methods("POST")
-	r.HandleFunc("/login/google", handler.getLoginGoogle).Methods("GET")
+	r.HandleFunc("/login/mfa", handler.getLoginMFA).Methods("GET")
+	r.HandleFunc("/login/mfa", handler.postLoginMFA).Methods("POST")
+	r.HandleFunc("/login/passkey/begin", handler.postPasskeyLoginBegin).Methods("POST")
+	r.HandleFunc("/login/passkey/finish", handler.postPasskeyLoginFinish).Methods("POST")
 	r.HandleFunc("/login/google/auth", handler.googleAuth).Methods("GET")
+	r.HandleFunc("/login/{provider}", handler.getLoginProvider).Methods("GET")
+	r.HandleFunc("/login/{provider}/callback", handler.getLoginProviderCallback).Methods("GET")
+	r.HandleFunc("/reauth", handler.getReauth).Methods("GET")
+	r.HandleFunc("/reauth", handler.postReauth).Methods("POST")
 	r.HandleFunc("/signup", handler.getSignup).Methods("GET")
 	r.HandleFunc("/signup", handler.postSignup).Methods("POST")
 	r.HandleFunc("/logout", handler.logout).Methods("GET")
+	r.HandleFunc("/email/verify", handler.getVerifyEmail).Methods("GET")
+	r.HandleFunc("/email/resend", handler.postResendVerification).Methods("POST")
 	r.HandleFunc("/password/forgot", handler.getForgotPassword).Methods("GET")
 	r.HandleFunc("/password/forgot", handler.postForgotPassword).Methods("POST")
 	r.HandleFunc("/password/new", handler.getNewPassword).Methods("GET")
 	r.HandleFunc("/password/new", handler.postNewPassword).Methods("POST")
 	r.HandleFunc("/profile", handler.postProfile).Methods("POST")
 	r.HandleFunc("/profile", handler.getProfile).Methods("GET")
+	r.HandleFunc("/profile/identities/unlink", handler.postUnlinkIdentity).Methods("POST")
+	r.HandleFunc("/mfa/setup", handler.getMFASetup).Methods("GET")
+	r.HandleFunc("/mfa/setup", handler.postMFASetup).Methods("POST")
+	r.HandleFunc("/mfa/disable", handler.postMFADisable).Methods("POST")
+	r.HandleFunc("/mfa/recovery-codes", handler.postMFARecoveryCodes).Methods("POST")
+	r.HandleFunc("/passkeys/register/begin", handler.postPasskeyRegisterBegin).Methods("POST")
+	r.HandleFunc("/passkeys/register/finish", handler.postPasskeyRegisterFinish).Methods("POST")
+	r.HandleFunc("/passkeys/rename", handler.postRenamePasskey).Methods("POST")
+	r.HandleFunc("/passkeys/delete", handler.postDeletePasskey).Methods("POST")
+	r.HandleFunc("/sessions/revoke", handler.postRevokeSession).Methods("POST")
+
+	if apiKeyService != nil {
+		r.HandleFunc("/api-keys", handler.postCreateAPIKey).Methods("POST")
+		r.HandleFunc("/api-keys/revoke", handler.postRevokeAPIKey).Methods("POST")
+	}
+
+	if orgService != nil {
+		handler.registerOrganizations(r)
+	}
+
+	if auditService != nil {
+		r.HandleFunc("/audit-log", handler.getAuditLog).Methods("GET")
+	}
+
+	r.HandleFunc("/sessions/revoke-all", handler.postRevokeAllSessions).Methods("POST")
 	r.HandleFunc("/address", handler.getAddressSuggestion).Methods("GET")
 
+	if tokenService != nil {
+		r.HandleFunc("/.well-known/jwks.json", handler.getJWKS).Methods("GET")
+	}
+
+	if oauthService != nil {
+		handler.registerOAuth(r)
+	}
+
+	if adminService != nil {
+		// the API has its own authentication, its routes go before the session guarded admin area
+		if adminKeyService != nil {
+			handler.registerAdminAPI(r)
+		}
+		handler.registerAdmin(r)
+	}
+
+	handler.registerAPI(r)
+
 	return r
 }
 
@@ -71,30 +172,115 @@ func redirectToLogin(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/login", http.StatusMovedPermanently)
 }
 
+// alreadyLoggedIn only accepts the session cookie. The bearer tokens and the API keys are accepted by
+// the scoped routes of the JSON API, never by the pages managing the account.
 func (h *handler) alreadyLoggedIn(w http.ResponseWriter, r *http.Request) (*domain.User, bool) {
+	user, _, ok := h.currentSession(w, r)
+	return user, ok
+}
+
+// currentSession validates the session token stored in the cookie against its session record
+func (h *handler) currentSession(w http.ResponseWriter, r *http.Request) (*domain.User, *domain.Session, bool) {
 	ctx := r.Context()
 	session, err := h.store.Get(r, authSession)
 	if err != nil {
-		return nil, false
+		return nil, nil, false
 	}
 
-	token, ok := session.Values[authCookie]
+	token, ok := session.Values[authCookie].(string)
 	if !ok {
-		return nil, false
+		return nil, nil, false
 	}
 
-	user, err := h.authService.AuthenticateToken(ctx, token.(string))
+	user, userSession, err := h.sessionService.Authenticate(ctx, token)
 	if err != nil {
-		return nil, false
+		return nil, nil, false
 	}
 
 	session.Options = defaultSessionOptions
-	session.Values[authCookie] = user.Token
 	if err := session.Save(r, w); err != nil {
-		return nil, false
+		return nil, nil, false
+	}
+
+	return user, userSession, true
+}
+
+// startSession creates a session record for the user and stores its token in the cookie
+func (h *handler) startSession(w http.ResponseWriter, r *http.Request, user *domain.User) error {
+	token, _, err := h.sessionService.Create(r.Context(), user, h.sessionMeta(r, user))
+	if err != nil {
+		return err
+	}
+
+	return h.getSessionAndSetCookie(w, r, token, authSession, authCookie, defaultSessionOptions)
+}
+
+// sessionMeta describes the device of the request, sessions start in the default organization of
+// the user
+func (h *handler) sessionMeta(r *http.Request, user *domain.User) domain.SessionMeta {
+	return domain.SessionMeta{
+		IP:        clientIP(r),
+		UserAgent: r.UserAgent(),
+
+		OrganizationID: h.defaultOrganizationID(r.Context(), user),
+	}
+}
+
+// clientIP returns the address appended by the reverse proxy to X-Forwarded-For, which is the
+// last entry, or the remote address of the connection. The header is only trusted when the
+// connection comes from a loopback or private address, otherwise any client could set it to avoid
+// being throttled.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" && isProxyAddress(host) {
+		parts := strings.Split(forwarded, ",")
+		if ip := strings.TrimSpace(parts[len(parts)-1]); ip != "" {
+			return ip
+		}
 	}
 
-	return user, true
+	return host
+}
+
+var proxyNetworks = parseNetworks("127.0.0.0/8", "10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "::1/128", "fc00::/7")
+
+func isProxyAddress(host string) bool {
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+
+	for _, network := range proxyNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func parseNetworks(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+
+	return networks
+}
+
+// denyFraming forbids other sites to show the page in a frame, where the user could be tricked into
+// confirming what the page asks
+func denyFraming(w http.ResponseWriter) {
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "frame-ancestors 'none'")
 }
 
 func (h *handler) writeTemplate(w http.ResponseWriter, templateName string, data interface{}) {
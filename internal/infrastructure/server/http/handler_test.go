@@ -0,0 +1,663 @@
+package http_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/internal/domain/admin"
+	"gitlab.com/evzpav/user-auth/internal/domain/adminkey"
+	"gitlab.com/evzpav/user-auth/internal/domain/apikey"
+	"gitlab.com/evzpav/user-auth/internal/domain/audit"
+	"gitlab.com/evzpav/user-auth/internal/domain/auth"
+	"gitlab.com/evzpav/user-auth/internal/domain/mfa"
+	"gitlab.com/evzpav/user-auth/internal/domain/oauth"
+	"gitlab.com/evzpav/user-auth/internal/domain/organization"
+	"gitlab.com/evzpav/user-auth/internal/domain/passkey"
+	"gitlab.com/evzpav/user-auth/internal/domain/rbac"
+	"gitlab.com/evzpav/user-auth/internal/domain/session"
+	"gitlab.com/evzpav/user-auth/internal/domain/template"
+	"gitlab.com/evzpav/user-auth/internal/domain/throttle"
+	"gitlab.com/evzpav/user-auth/internal/domain/token"
+	"gitlab.com/evzpav/user-auth/internal/domain/user"
+	"gitlab.com/evzpav/user-auth/internal/infrastructure/client/github_login/githublogintest"
+	"gitlab.com/evzpav/user-auth/internal/infrastructure/client/google_maps/googlemapstest"
+	oidclogin "gitlab.com/evzpav/user-auth/internal/infrastructure/client/oidc_login"
+	mailers "gitlab.com/evzpav/user-auth/internal/infrastructure/mailer"
+	server "gitlab.com/evzpav/user-auth/internal/infrastructure/server/http"
+	"gitlab.com/evzpav/user-auth/internal/infrastructure/storage/memory"
+	"gitlab.com/evzpav/user-auth/pkg/jwt"
+	"gitlab.com/evzpav/user-auth/pkg/log"
+	"gitlab.com/evzpav/user-auth/pkg/oidc/oidctest"
+	"gitlab.com/evzpav/user-auth/pkg/webauthn"
+)
+
+var resetLink = regexp.MustCompile(`https?://\S+/password/new\?token=[\w-]+`)
+
+// testServer runs the handler with the in-memory storages and mailer, the login providers and the
+// maps client are fakes
+type testServer struct {
+	*httptest.Server
+	users      domain.UserStorage
+	identities domain.UserIdentityStorage
+	emails     interface{ Emails() []domain.Email }
+	tokens     domain.TokenService
+	oauth      domain.OAuthService
+	rbac       domain.RBACService
+	adminKeys  domain.AdminAPIKeyService
+	apiKeys    domain.APIKeyService
+	orgs       domain.OrganizationService
+	audit      domain.AuditService
+	google     *oidctest.Server
+	keycloak   *oidctest.Server
+	github     *githublogintest.Server
+}
+
+// newTestServer signs in with google, on its legacy callback, and keycloak through stand-in
+// OpenID Connect providers, and with github through a stand-in of its API
+func newTestServer(t *testing.T) *testServer {
+	testLog := log.NewZeroLog("", "", log.Error)
+
+	// the platform url is only known once the server listens
+	var handler http.Handler
+	ts := &testServer{
+		Server: httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			handler.ServeHTTP(w, r)
+		})),
+		google:   oidctest.NewServer(),
+		keycloak: oidctest.NewServer(),
+		github:   githublogintest.NewServer(),
+	}
+
+	google, err := oidclogin.New("google", "Google", ts.google.Config(ts.URL+"/login/google/auth"))
+	require.NoError(t, err)
+	keycloak, err := oidclogin.New("keycloak", "Keycloak", ts.keycloak.Config(ts.URL+"/login/keycloak/callback"))
+	require.NoError(t, err)
+
+	root, err := filepath.Abs("../../../..")
+	require.NoError(t, err)
+
+	identities := memory.NewUserIdentityStorage()
+	users := memory.NewUserStorage().WithIdentities(identities)
+	mailer := mailers.NewMemory("user-auth@example.com")
+	ts.users, ts.identities, ts.emails = users, identities, mailer
+
+	userService := user.NewService(users, testLog)
+	templateService := template.NewServiceWithRoot(root, &googlemapstest.Mapper{Addresses: []string{"Main Street, 1"}}, testLog)
+	sessionService := session.NewService(memory.NewSessionStorage(), userService, time.Hour, testLog)
+	mfaService := mfa.NewService(userService, "user-auth", testLog)
+	throttleService := throttle.NewService(memory.NewThrottleStore(), throttle.DefaultConfig(), testLog)
+
+	relyingParty, err := webauthn.New(webauthn.Config{RPID: "127.0.0.1", RPName: "user-auth", Origin: ts.URL})
+	require.NoError(t, err)
+	webAuthnService := passkey.NewService(relyingParty, memory.NewWebAuthnCredentialStorage(), memory.NewWebAuthnChallengeStorage(), userService, testLog)
+
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	key, err := jwt.NewKey("test", privateKey)
+	require.NoError(t, err)
+	ts.orgs = organization.NewService(memory.NewOrganizationStorage(), memory.NewOrgInvitationStorage(), userService, mailer, templateService, ts.URL,
+		organization.Config{Key: []byte("invitation-key")}, testLog)
+
+	tokenService, err := token.NewService([]*jwt.Key{key}, "", memory.NewRefreshTokenStorage(), userService, ts.orgs, token.Config{
+		Issuer:          ts.URL,
+		AccessTokenTTL:  time.Minute,
+		RefreshTokenTTL: time.Hour,
+	}, testLog)
+	require.NoError(t, err)
+	ts.tokens = tokenService
+
+	authService := auth.NewService(userService, identities, memory.NewPasswordResetTokenStorage(), sessionService, tokenService, mailer, templateService,
+		[]domain.LoginProvider{google, keycloak, ts.github.Provider(ts.URL + "/login/github/callback")}, ts.URL, auth.EmailVerificationConfig{Key: []byte("verification-key")}, testLog)
+
+	ts.oauth = oauth.NewService(memory.NewOAuthClientStorage(), memory.NewOAuthAuthorizationCodeStorage(), memory.NewOAuthTokenStorage(), memory.NewOAuthConsentStorage(),
+		userService, tokenService, oauth.Config{Issuer: ts.URL}, testLog)
+
+	ts.rbac = rbac.NewService(memory.NewRoleStorage(), testLog)
+	adminService := admin.NewService(userService, ts.rbac, sessionService, authService, tokenService, testLog)
+
+	ts.adminKeys = adminkey.NewService(memory.NewAdminAPIKeyStorage(), testLog)
+	ts.apiKeys = apikey.NewService(memory.NewAPIKeyStorage(), userService, testLog)
+	ts.audit = audit.NewService(memory.NewAuditStorage(), testLog)
+
+	handler = server.NewHandler(userService, authService, templateService, sessionService, mfaService, webAuthnService, throttleService, tokenService, ts.oauth, ts.rbac, adminService, ts.adminKeys, ts.apiKeys, ts.orgs, ts.audit, "session-key", testLog)
+
+	return ts
+}
+
+func (ts *testServer) Close() {
+	ts.Server.Close()
+	ts.google.Close()
+	ts.keycloak.Close()
+	ts.github.Close()
+}
+
+// page is the response at the end of the redirects
+type page struct {
+	status int
+	path   string
+	header http.Header
+	body   string
+}
+
+// newBrowser returns a client keeping the cookies, like a browser
+func newBrowser(t *testing.T) *http.Client {
+	jar, err := cookiejar.New(nil)
+	require.NoError(t, err)
+
+	return &http.Client{Jar: jar}
+}
+
+func (ts *testServer) get(t *testing.T, browser *http.Client, path string) page {
+	resp, err := browser.Get(ts.URL + path)
+	require.NoError(t, err)
+
+	return readPage(t, resp)
+}
+
+func (ts *testServer) post(t *testing.T, browser *http.Client, path string, form url.Values) page {
+	resp, err := browser.PostForm(ts.URL+path, form)
+	require.NoError(t, err)
+
+	return readPage(t, resp)
+}
+
+func readPage(t *testing.T, resp *http.Response) page {
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	return page{
+		status: resp.StatusCode,
+		path:   resp.Request.URL.Path,
+		header: resp.Header,
+		body:   string(body),
+	}
+}
+
+func (ts *testServer) signup(t *testing.T, browser *http.Client, email, password string) *domain.User {
+	p := ts.post(t, browser, "/signup", url.Values{"email": {email}, "password": {password}})
+	require.Equal(t, http.StatusOK, p.status, p.body)
+	require.Equal(t, "/profile", p.path)
+
+	user, err := ts.users.FindByEmail(context.Background(), email)
+	require.NoError(t, err)
+	require.NotNil(t, user)
+
+	return user
+}
+
+// identityUser returns the user the account of the provider is linked to, nil when not linked
+func (ts *testServer) identityUser(t *testing.T, provider, subject string) *domain.User {
+	ctx := context.Background()
+	identity, err := ts.identities.FindBySubject(ctx, provider, subject)
+	require.NoError(t, err)
+	if identity == nil {
+		return nil
+	}
+
+	user, err := ts.users.FindByID(ctx, identity.UserID)
+	require.NoError(t, err)
+	require.NotNil(t, user)
+
+	return user
+}
+
+// lastEmail returns the last email sent to the address
+func (ts *testServer) lastEmail(t *testing.T, to string) domain.Email {
+	emails := ts.emails.Emails()
+	for i := len(emails) - 1; i >= 0; i-- {
+		if emails[i].To == to {
+			return emails[i]
+		}
+	}
+
+	require.FailNow(t, "no email sent to "+to)
+	return domain.Email{}
+}
+
+func TestHandler_SignupLoginProfileLogout(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	browser := newBrowser(t)
+
+	p := ts.get(t, browser, "/profile")
+	assert.Equal(t, "/login", p.path, "the profile requires a session")
+
+	p = ts.post(t, browser, "/signup", url.Values{"email": {"user@example.com"}, "password": {"abc"}})
+	assert.Equal(t, http.StatusBadRequest, p.status, "the password is too short")
+
+	user := ts.signup(t, browser, "user@example.com", "secret-password")
+	assert.NotEqual(t, "secret-password", user.Password, "the password is hashed")
+	assert.Equal(t, "Verify your email - user-auth", ts.lastEmail(t, "user@example.com").Subject)
+
+	p = ts.get(t, browser, "/profile")
+	assert.Equal(t, http.StatusOK, p.status)
+	assert.Contains(t, p.body, "user@example.com")
+
+	p = ts.get(t, browser, "/signup")
+	assert.Equal(t, "/profile", p.path, "signed in users skip the signup")
+
+	p = ts.post(t, browser, "/profile", url.Values{
+		"id":      {strconv.Itoa(user.ID)},
+		"name":    {"Jane Doe"},
+		"email":   {"user@example.com"},
+		"address": {"Main Street, 1"},
+		"phone":   {"123-45-678"},
+	})
+	assert.Equal(t, http.StatusOK, p.status)
+	assert.Contains(t, p.body, "Jane Doe")
+
+	updated, err := ts.users.FindByID(context.Background(), user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Jane Doe", updated.Name)
+	assert.Equal(t, "Main Street, 1", updated.Address)
+
+	p = ts.get(t, browser, "/logout")
+	assert.Equal(t, "/login", p.path)
+
+	p = ts.get(t, browser, "/profile")
+	assert.Equal(t, "/login", p.path, "the session is revoked by the logout")
+
+	p = ts.post(t, browser, "/login", url.Values{"email": {"user@example.com"}, "password": {"wrong-password"}})
+	assert.Equal(t, http.StatusUnauthorized, p.status)
+
+	p = ts.post(t, browser, "/login", url.Values{"email": {"USER@example.com"}, "password": {"secret-password"}})
+	assert.Equal(t, http.StatusOK, p.status)
+	assert.Equal(t, "/profile", p.path)
+	assert.Contains(t, p.body, "Jane Doe")
+
+	other := newBrowser(t)
+	p = ts.get(t, other, "/profile")
+	assert.Equal(t, "/login", p.path, "sessions are not shared between browsers")
+
+	p = ts.post(t, other, "/signup", url.Values{"email": {"User@Example.com"}, "password": {"other-password"}})
+	assert.Equal(t, http.StatusForbidden, p.status, "the email is taken")
+}
+
+func TestHandler_ForgotAndResetPassword(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	signedIn := newBrowser(t)
+	ts.signup(t, signedIn, "user@example.com", "old-password")
+
+	browser := newBrowser(t)
+	p := ts.post(t, browser, "/password/forgot", url.Values{"email": {"missing@example.com"}})
+	assert.Equal(t, http.StatusOK, p.status, "unknown emails get the same answer")
+	assert.Len(t, ts.emails.Emails(), 1, "only the verification email was sent")
+
+	p = ts.post(t, browser, "/password/forgot", url.Values{"email": {"user@example.com"}})
+	assert.Equal(t, http.StatusOK, p.status)
+
+	email := ts.lastEmail(t, "user@example.com")
+	assert.Equal(t, "Recover password - user-auth", email.Subject)
+	link, err := url.Parse(resetLink.FindString(email.Text))
+	require.NoError(t, err)
+	token := link.Query().Get("token")
+	require.NotEmpty(t, token)
+
+	p = ts.get(t, browser, link.RequestURI())
+	assert.Equal(t, http.StatusOK, p.status)
+
+	p = ts.post(t, browser, "/password/new", url.Values{"token": {token}, "password": {"new-password"}})
+	assert.Equal(t, http.StatusOK, p.status)
+	assert.Contains(t, p.body, "password changed")
+
+	p = ts.post(t, browser, "/password/new", url.Values{"token": {token}, "password": {"another-password"}})
+	assert.Equal(t, http.StatusBadRequest, p.status, "the link is single use")
+	assert.Contains(t, p.body, "invalid or expired link")
+
+	p = ts.get(t, signedIn, "/profile")
+	assert.Equal(t, "/login", p.path, "the sessions are revoked with the password change")
+
+	p = ts.post(t, browser, "/login", url.Values{"email": {"user@example.com"}, "password": {"old-password"}})
+	assert.Equal(t, http.StatusUnauthorized, p.status)
+
+	p = ts.post(t, browser, "/login", url.Values{"email": {"user@example.com"}, "password": {"new-password"}})
+	assert.Equal(t, "/profile", p.path)
+}
+
+func TestHandler_LoginPageProviders(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	p := ts.get(t, newBrowser(t), "/login")
+	assert.Equal(t, http.StatusOK, p.status)
+	assert.Contains(t, p.body, `href="/login/google"`)
+	assert.Contains(t, p.body, "Sign in with Keycloak")
+
+	p = ts.get(t, newBrowser(t), "/login/unknown")
+	assert.Equal(t, http.StatusNotFound, p.status)
+}
+
+func TestHandler_GoogleCallback(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	ts.google.SignIn(&oidctest.User{
+		Subject:       "google-1",
+		Name:          "Google User",
+		Email:         "google@example.com",
+		EmailVerified: true,
+	})
+
+	browser := newBrowser(t)
+	p := ts.get(t, browser, "/login/google")
+	assert.Equal(t, http.StatusOK, p.status, p.body)
+	assert.Equal(t, "/profile", p.path)
+	assert.Contains(t, p.body, "google@example.com")
+
+	user := ts.identityUser(t, "google", "google-1")
+	require.NotNil(t, user)
+	assert.Equal(t, "Google User", user.Name)
+	assert.False(t, user.HasPassword())
+	assert.True(t, user.EmailVerified())
+
+	p = ts.get(t, browser, "/logout")
+	assert.Equal(t, "/login", p.path)
+
+	p = ts.get(t, browser, "/login/google")
+	assert.Equal(t, "/profile", p.path, "signing in again finds the account")
+
+	again, err := ts.users.FindByEmail(context.Background(), "google@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, again.ID)
+
+	ts.google.SignIn(nil)
+	denied := newBrowser(t)
+	p = ts.get(t, denied, "/login/google")
+	assert.Equal(t, http.StatusUnauthorized, p.status, "the user denied the consent")
+	assert.Equal(t, "/login/google/auth", p.path)
+	assert.Contains(t, p.body, "canceled")
+
+	p = ts.get(t, denied, "/profile")
+	assert.Equal(t, "/login", p.path)
+}
+
+func TestHandler_ProviderCallback(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	ts.keycloak.SignIn(&oidctest.User{Subject: "kc-1", Email: "user@example.com", EmailVerified: false})
+	p := ts.get(t, newBrowser(t), "/login/keycloak")
+	assert.Equal(t, http.StatusBadRequest, p.status, "the provider did not verify the email")
+	assert.Equal(t, "/login/keycloak/callback", p.path)
+
+	// the account is not linked to a user whose email is not verified, whoever registers the
+	// address at a provider would take it over
+	user := ts.signup(t, newBrowser(t), "user@example.com", "secret-password")
+	require.False(t, user.EmailVerified())
+
+	ts.keycloak.SignIn(&oidctest.User{Subject: "kc-1", Name: "Keycloak User", Email: "user@example.com", EmailVerified: true})
+	p = ts.get(t, newBrowser(t), "/login/keycloak")
+	assert.Equal(t, http.StatusUnprocessableEntity, p.status)
+	assert.Contains(t, p.body, "link the account from your profile")
+	assert.Nil(t, ts.identityUser(t, "keycloak", "kc-1"))
+
+	unchanged, err := ts.users.FindByID(context.Background(), user.ID)
+	require.NoError(t, err)
+	assert.False(t, unchanged.EmailVerified())
+
+	// once both emails are verified the account is linked
+	verifiedAt := time.Now()
+	unchanged.EmailVerifiedAt = &verifiedAt
+	require.NoError(t, ts.users.Update(context.Background(), unchanged))
+
+	p = ts.get(t, newBrowser(t), "/login/keycloak")
+	assert.Equal(t, "/profile", p.path)
+
+	linked := ts.identityUser(t, "keycloak", "kc-1")
+	require.NotNil(t, linked)
+	assert.Equal(t, user.ID, linked.ID)
+	assert.Equal(t, "Keycloak User", linked.Name)
+
+	// a token of another client is rejected
+	ts.keycloak.Tamper(func(claims map[string]interface{}) { claims["aud"] = "other-client" })
+	p = ts.get(t, newBrowser(t), "/login/keycloak")
+	assert.Equal(t, http.StatusUnauthorized, p.status)
+}
+
+func TestHandler_GithubCallback(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	ts.github.SignIn(&githublogintest.User{
+		ID:     1001,
+		Login:  "octocat",
+		Emails: []githublogintest.Email{{Email: "octocat@example.com", Primary: true}},
+	})
+
+	p := ts.get(t, newBrowser(t), "/login/github")
+	assert.Equal(t, http.StatusBadRequest, p.status, "github did not verify the email")
+	assert.Equal(t, "/login/github/callback", p.path)
+
+	ts.github.SignIn(&githublogintest.User{
+		ID:     1001,
+		Login:  "octocat",
+		Emails: []githublogintest.Email{{Email: "octocat@example.com", Primary: true, Verified: true}},
+	})
+
+	browser := newBrowser(t)
+	p = ts.get(t, browser, "/login/github")
+	assert.Equal(t, http.StatusOK, p.status, p.body)
+	assert.Equal(t, "/profile", p.path)
+	assert.Contains(t, p.body, "octocat@example.com")
+
+	user := ts.identityUser(t, "github", "1001")
+	require.NotNil(t, user)
+	assert.Equal(t, "octocat", user.Name)
+	assert.True(t, user.EmailVerified())
+
+	// the account is found by its id after the primary email changed at github
+	ts.github.SignIn(&githublogintest.User{
+		ID:     1001,
+		Login:  "octocat",
+		Emails: []githublogintest.Email{{Email: "new@example.com", Primary: true, Verified: true}},
+	})
+
+	p = ts.get(t, newBrowser(t), "/login/github")
+	assert.Equal(t, "/profile", p.path)
+	assert.Contains(t, p.body, "octocat@example.com")
+}
+
+func TestHandler_ProviderCallbackState(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	ts.keycloak.SignIn(&oidctest.User{Subject: "kc-1", Email: "user@example.com", EmailVerified: true})
+
+	browser := newBrowser(t)
+	p := ts.get(t, browser, "/login/keycloak/callback?state=forged&code=code")
+	assert.Equal(t, http.StatusBadRequest, p.status, "there is no state to compare with")
+
+	// start a login to get a state in the cookie, then come back with another one
+	noRedirect := *browser
+	noRedirect.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	resp, err := noRedirect.Get(ts.URL + "/login/keycloak")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusTemporaryRedirect, resp.StatusCode)
+	assert.True(t, strings.HasPrefix(resp.Header.Get("Location"), ts.keycloak.URL+"/authorize?"))
+
+	p = ts.get(t, browser, "/login/keycloak/callback?state=forged&code=code")
+	assert.Equal(t, http.StatusBadRequest, p.status)
+
+	// the state of one provider is not accepted by the callback of another
+	resp, err = noRedirect.Get(ts.URL + "/login/keycloak")
+	require.NoError(t, err)
+	resp.Body.Close()
+	location, err := url.Parse(resp.Header.Get("Location"))
+	require.NoError(t, err)
+
+	p = ts.get(t, browser, "/login/google/auth?code=code&state="+location.Query().Get("state"))
+	assert.Equal(t, http.StatusBadRequest, p.status)
+
+	user, err := ts.users.FindByEmail(context.Background(), "user@example.com")
+	require.NoError(t, err)
+	assert.Nil(t, user, "no account is created")
+}
+
+func TestHandler_LinkAndUnlinkIdentity(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	browser := newBrowser(t)
+	user := ts.signup(t, browser, "user@example.com", "secret-password")
+
+	p := ts.get(t, browser, "/profile")
+	assert.Contains(t, p.body, `href="/login/github?intent=link"`)
+
+	// linking requires to confirm the password first
+	p = ts.get(t, browser, "/login/github?intent=link")
+	assert.Equal(t, http.StatusOK, p.status)
+	assert.Equal(t, "/reauth", p.path)
+
+	next := "/login/github?intent=link"
+	p = ts.post(t, browser, "/reauth", url.Values{"password": {"wrong-password"}, "next": {next}})
+	assert.Equal(t, http.StatusUnauthorized, p.status)
+
+	// the email at github does not need to match nor be verified, the user signed in at both
+	ts.github.SignIn(&githublogintest.User{
+		ID:     1001,
+		Login:  "octocat",
+		Emails: []githublogintest.Email{{Email: "octocat@example.com", Primary: true}},
+	})
+
+	p = ts.post(t, browser, "/reauth", url.Values{"password": {"secret-password"}, "next": {next}})
+	assert.Equal(t, http.StatusOK, p.status, p.body)
+	assert.Equal(t, "/profile", p.path)
+	assert.Contains(t, p.body, "octocat@example.com")
+
+	linked := ts.identityUser(t, "github", "1001")
+	require.NotNil(t, linked)
+	assert.Equal(t, user.ID, linked.ID)
+
+	// the linked account signs in
+	p = ts.get(t, newBrowser(t), "/login/github")
+	assert.Equal(t, "/profile", p.path)
+	assert.Contains(t, p.body, "user@example.com")
+
+	// and cannot be linked to another user
+	other := newBrowser(t)
+	ts.signup(t, other, "other@example.com", "other-password")
+	p = ts.post(t, other, "/reauth", url.Values{"password": {"other-password"}, "next": {next}})
+	assert.Equal(t, http.StatusConflict, p.status)
+	assert.Contains(t, p.body, "linked to another user")
+
+	identities, err := ts.identities.FindByUserID(context.Background(), user.ID)
+	require.NoError(t, err)
+	require.Len(t, identities, 1)
+	unlink := url.Values{"identity_id": {strconv.Itoa(identities[0].ID)}}
+
+	// a new session has to reauthenticate before unlinking
+	fresh := newBrowser(t)
+	p = ts.post(t, fresh, "/login", url.Values{"email": {"user@example.com"}, "password": {"secret-password"}})
+	require.Equal(t, "/profile", p.path)
+	p = ts.post(t, fresh, "/profile/identities/unlink", unlink)
+	assert.Equal(t, "/reauth", p.path)
+
+	p = ts.post(t, other, "/profile/identities/unlink", unlink)
+	assert.Equal(t, http.StatusNotFound, p.status, "the identity of another user")
+
+	p = ts.post(t, browser, "/profile/identities/unlink", unlink)
+	assert.Equal(t, http.StatusOK, p.status, p.body)
+	assert.Equal(t, "/profile", p.path)
+	assert.Nil(t, ts.identityUser(t, "github", "1001"))
+}
+
+func TestHandler_UnlinkLastLoginMethod(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	ts.google.SignIn(&oidctest.User{Subject: "google-1", Email: "google@example.com", EmailVerified: true})
+
+	browser := newBrowser(t)
+	p := ts.get(t, browser, "/login/google")
+	require.Equal(t, "/profile", p.path)
+
+	// users without a password reauthenticate with a linked account
+	p = ts.get(t, browser, "/reauth?next=/profile")
+	assert.NotContains(t, p.body, `type="password"`)
+	assert.Contains(t, p.body, `href="/login/google?intent=reauth&next=%2Fprofile"`)
+
+	p = ts.get(t, browser, "/login/google?intent=reauth&next=https://evil.example.com")
+	assert.Equal(t, http.StatusOK, p.status, p.body)
+	assert.Equal(t, "/profile", p.path, "only local paths are followed")
+
+	user := ts.identityUser(t, "google", "google-1")
+	require.NotNil(t, user)
+	identities, err := ts.identities.FindByUserID(context.Background(), user.ID)
+	require.NoError(t, err)
+	require.Len(t, identities, 1)
+
+	p = ts.post(t, browser, "/profile/identities/unlink", url.Values{"identity_id": {strconv.Itoa(identities[0].ID)}})
+	assert.Equal(t, http.StatusUnprocessableEntity, p.status)
+	assert.Contains(t, p.body, "only way to sign in")
+	assert.NotNil(t, ts.identityUser(t, "google", "google-1"))
+}
+
+func TestHandler_MFASetupQRCode(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	browser := newBrowser(t)
+	ts.signup(t, browser, "user@example.com", "secret-password")
+
+	p := ts.get(t, browser, "/mfa/setup")
+	assert.Equal(t, http.StatusOK, p.status)
+	assert.Contains(t, p.body, `<img src="data:image/png;base64,`, "the QR code is drawn by the server")
+	assert.NotContains(t, p.body, "<script", "the page loads no script")
+}
+
+func TestHandler_PasskeyLoginThrottled(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	finish := func() int {
+		resp, err := http.Post(ts.URL+"/login/passkey/finish", "application/json", strings.NewReader(`{"credential": {"id": "unknown"}}`))
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	for i := 0; i < 20; i++ {
+		require.NotEqual(t, http.StatusOK, finish())
+	}
+
+	assert.Equal(t, http.StatusTooManyRequests, finish(), "failed assertions count as failed logins of the address")
+
+	p := ts.post(t, newBrowser(t), "/login", url.Values{"email": {"user@example.com"}, "password": {"secret-password"}})
+	assert.Equal(t, http.StatusTooManyRequests, p.status, "the password login shares the limit")
+}
+
+func TestHandler_AddressSuggestion(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	browser := newBrowser(t)
+
+	p := ts.get(t, browser, "/address?q=ma")
+	assert.Equal(t, http.StatusBadRequest, p.status)
+
+	p = ts.get(t, browser, "/address?q=main")
+	assert.Equal(t, http.StatusOK, p.status)
+	assert.JSONEq(t, `{"suggestion": "Main Street, 1"}`, p.body)
+
+	p = ts.get(t, browser, "/address?q=unknown")
+	assert.JSONEq(t, `{"suggestion": ""}`, p.body)
+}
@@ -0,0 +1,90 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"gitlab.com/evzpav/user-auth/pkg/errors"
+)
+
+// linkedIdentity is an identity of the user shown on the profile page
+type linkedIdentity struct {
+	ID          int
+	DisplayName string
+	Email       string
+	LinkedAt    time.Time
+}
+
+// loadIdentities lists the linked accounts of the user and the providers they can still link
+func (h *handler) loadIdentities(ctx context.Context, prof *profile, userID int) {
+	identities, err := h.authService.Identities(ctx, userID)
+	if err != nil {
+		h.log.Error().Err(err).Sendf("failed to list linked accounts")
+		return
+	}
+
+	linked := make(map[string]bool)
+	for _, identity := range identities {
+		linked[identity.Provider] = true
+		prof.Identities = append(prof.Identities, linkedIdentity{
+			ID:          identity.ID,
+			DisplayName: h.providerDisplayName(identity.Provider),
+			Email:       identity.Email,
+			LinkedAt:    identity.LinkedAt,
+		})
+	}
+
+	for _, provider := range h.authService.LoginProviders() {
+		if !linked[provider.Name()] {
+			prof.LinkableProviders = append(prof.LinkableProviders, provider)
+		}
+	}
+}
+
+// providerDisplayName returns the name of the provider, identities of providers that are no
+// longer configured show their identifier
+func (h *handler) providerDisplayName(name string) string {
+	for _, provider := range h.authService.LoginProviders() {
+		if provider.Name() == name {
+			return provider.DisplayName()
+		}
+	}
+
+	return name
+}
+
+func (h *handler) postUnlinkIdentity(w http.ResponseWriter, r *http.Request) {
+	user, session, ok := h.currentSession(w, r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	if !h.recentlyReauthenticated(r, user, session) {
+		http.Redirect(w, r, reauthURL("/profile"), http.StatusSeeOther)
+		return
+	}
+
+	identityID, err := strconv.Atoi(r.FormValue("identity_id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := h.authService.UnlinkIdentity(r.Context(), user, identityID); err != nil {
+		message := "failed to unlink the account"
+		if describer, ok := errors.DescriberCast(err); ok && describer.GetMessage() != "" {
+			message = describer.GetMessage()
+		} else {
+			h.log.Error().Err(err).Sendf("failed to unlink identity")
+		}
+
+		w.WriteHeader(statusFromError(err))
+		h.writeProfile(w, r, user, session, map[string]string{"Identities": message})
+		return
+	}
+
+	http.Redirect(w, r, "/profile", http.StatusSeeOther)
+}
@@ -0,0 +1,15 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+func (h *handler) getJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+
+	if err := json.NewEncoder(w).Encode(h.tokenService.JWKS()); err != nil {
+		h.log.Error().Err(err).Sendf("failed to encode jwks: %v", err)
+	}
+}
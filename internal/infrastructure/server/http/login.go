@@ -13,7 +13,7 @@ func (h *handler) getLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	h.writeTemplate(w, "login", nil)
+	h.writeLogin(w, nil)
 }
 
 func (h *handler) postLogin(w http.ResponseWriter, r *http.Request) {
@@ -25,50 +25,73 @@ func (h *handler) postLogin(w http.ResponseWriter, r *http.Request) {
 	authUser := domain.NewAuthUser(r.FormValue("email"), r.FormValue("password"))
 	if !authUser.Validate() {
 		w.WriteHeader(http.StatusBadRequest)
-		h.writeTemplate(w, "login", authUser)
+		h.writeLogin(w, authUser)
 		return
 	}
 
-	user, err := h.authService.Authenticate(r.Context(), authUser)
-	if err != nil {
-		w.WriteHeader(http.StatusUnauthorized)
-		h.writeTemplate(w, "login", authUser)
+	ctx := r.Context()
+	email, ip := domain.ThrottleEmail(authUser.Email), domain.ThrottleIP(clientIP(r))
+	if err := h.allowAttempt(ctx, domain.ThrottleLogin, email, ip); err != nil {
+		h.writeTooManyAttempts(w, "login", authUser)
 		return
 	}
 
-	err = h.getSessionAndSetCookie(w, r, user.Token, authSession, authCookie, defaultSessionOptions)
+	user, err := h.authService.Authenticate(ctx, authUser)
 	if err != nil {
+		h.recordAttempt(ctx, domain.ThrottleLogin, email, ip)
+		h.auditByEmail(r, domain.AuditLoginFailed, authUser.Email)
 		w.WriteHeader(http.StatusUnauthorized)
-		h.writeTemplate(w, "login", authUser)
+		h.writeLogin(w, authUser)
 		return
 	}
 
-	http.Redirect(w, r, "/profile", http.StatusSeeOther)
+	// the address is not reset, a valid account must not clear the failures of other accounts
+	h.resetAttempts(ctx, domain.ThrottleLogin, email)
+
+	if err := h.completeLogin(w, r, user); err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		h.writeLogin(w, authUser)
+		return
+	}
 }
 
 func (h *handler) logout(w http.ResponseWriter, r *http.Request) {
-	user, ok := h.alreadyLoggedIn(w, r)
+	user, session, ok := h.currentSession(w, r)
 	if !ok {
 		http.Redirect(w, r, "/login", http.StatusSeeOther)
 		return
 	}
 
-	deleteCookieOptions := &sessions.Options{
-		Path:     "/",
-		MaxAge:   -1,
-		HttpOnly: true,
+	if err := h.endSession(w, r, user, session); err != nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
 	}
 
-	user.Token = ""
+	http.Redirect(w, r, "/login", http.StatusTemporaryRedirect)
+}
 
-	_ = h.getSessionAndSetCookie(w, r, user.Token, authSession, authCookie, deleteCookieOptions)
-	_ = h.getSessionAndSetCookie(w, r, user.Token, googleSession, googleCookie, deleteCookieOptions)
+// endSession clears the cookies and revokes the session of the user
+func (h *handler) endSession(w http.ResponseWriter, r *http.Request, user *domain.User, session *domain.Session) error {
+	h.clearSessionCookies(w, r)
 
-	if err := h.userService.Update(r.Context(), user); err != nil {
-		h.log.Error().Err(err).Sendf("failed to update user token")
-		http.Redirect(w, r, "/login", http.StatusSeeOther)
-		return
+	if err := h.sessionService.Revoke(r.Context(), user.ID, session.ID); err != nil {
+		h.log.Error().Err(err).Sendf("failed to revoke session")
+		return err
 	}
 
-	http.Redirect(w, r, "/login", http.StatusTemporaryRedirect)
+	h.audit(r, domain.AuditLogout, user, user, nil)
+	return nil
+}
+
+func (h *handler) clearSessionCookies(w http.ResponseWriter, r *http.Request) {
+	deleteCookieOptions := &sessions.Options{
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+	}
+
+	_ = h.getSessionAndSetCookie(w, r, "", authSession, authCookie, deleteCookieOptions)
+	_ = h.getSessionAndSetCookie(w, r, "", providerSession, providerStateValue, deleteCookieOptions)
+	_ = h.getSessionAndSetCookie(w, r, "", reauthSession, reauthCookie, deleteCookieOptions)
+	_ = h.getSessionAndSetCookie(w, r, "", returnToSession, returnToValue, deleteCookieOptions)
 }
@@ -0,0 +1,287 @@
+package http
+
+import (
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"net/http"
+	"time"
+
+	"rsc.io/qr"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/pkg/errors"
+)
+
+// time the user has to enter the second factor after the password was accepted
+const mfaPendingLength = 5 * time.Minute
+
+type mfaPending struct {
+	UserID    int
+	ExpiresAt int64
+}
+
+type mfaSetup struct {
+	Enrollment *domain.TOTPEnrollment
+	Errors     map[string]string
+}
+
+// QRCode is the key URI drawn as a PNG data URI, so the page loads no script to show it. It is
+// empty when the URI does not fit in a QR code, the key is still shown to be entered manually.
+func (m mfaSetup) QRCode() template.URL {
+	code, err := qr.Encode(m.Enrollment.URI, qr.M)
+	if err != nil {
+		return ""
+	}
+
+	return template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(code.PNG()))
+}
+
+type mfaRecoveryCodes struct {
+	Codes []string
+}
+
+// completeLogin starts the session of a user whose password or provider login was accepted. When
+// two-factor authentication is enabled the session is only started after the code is verified.
+func (h *handler) completeLogin(w http.ResponseWriter, r *http.Request, user *domain.User) error {
+	if err := h.loginPolicy(user); err != nil {
+		h.audit(r, domain.AuditLoginFailed, nil, user, nil)
+		if describer, ok := errors.DescriberCast(err); ok && describer.GetCode() == domain.ErrEmailNotVerified {
+			h.writeEmailNotVerified(w, http.StatusForbidden, user, "please verify your email before signing in")
+			return nil
+		}
+
+		h.writeLoginError(w, http.StatusForbidden, "this account is disabled")
+		return nil
+	}
+
+	if !user.TOTPEnabled {
+		if err := h.startSession(w, r, user); err != nil {
+			return err
+		}
+
+		h.audit(r, domain.AuditLoginSucceeded, user, user, nil)
+		http.Redirect(w, r, h.popReturnTo(w, r), http.StatusSeeOther)
+		return nil
+	}
+
+	token, err := h.encodeMFAPending(user)
+	if err != nil {
+		return err
+	}
+
+	options := *defaultSessionOptions
+	options.MaxAge = int(mfaPendingLength.Seconds())
+	if err := h.getSessionAndSetCookie(w, r, token, mfaSession, mfaCookie, &options); err != nil {
+		return err
+	}
+
+	http.Redirect(w, r, "/login/mfa", http.StatusSeeOther)
+	return nil
+}
+
+// loginPolicy returns why a user whose credentials were accepted cannot sign in, nil when they can.
+// Every login checks it before starting a session.
+func (h *handler) loginPolicy(user *domain.User) error {
+	if !user.Active() {
+		return errors.NewRuleNotSatisfied(domain.ErrAccountDisabled).WithMessage("this account is disabled")
+	}
+
+	if !h.authService.EmailVerificationPolicy().AllowsLogin(user) {
+		return emailNotVerified()
+	}
+
+	return nil
+}
+
+// encodeMFAPending signs the pending state with the session store keys so it can be handed to
+// browsers in a cookie and to API clients as a token
+func (h *handler) encodeMFAPending(user *domain.User) (string, error) {
+	pending := mfaPending{
+		UserID:    user.ID,
+		ExpiresAt: time.Now().Add(mfaPendingLength).Unix(),
+	}
+
+	return h.store.Codecs[0].Encode(mfaCookie, pending)
+}
+
+func (h *handler) decodeMFAPending(token string) (*mfaPending, error) {
+	var pending mfaPending
+	for _, codec := range h.store.Codecs {
+		if err := codec.Decode(mfaCookie, token, &pending); err != nil {
+			continue
+		}
+
+		if time.Now().Unix() >= pending.ExpiresAt {
+			return nil, fmt.Errorf("two-factor authentication expired")
+		}
+
+		return &pending, nil
+	}
+
+	return nil, fmt.Errorf("invalid two-factor authentication state")
+}
+
+func (h *handler) pendingMFAUser(r *http.Request) (*domain.User, error) {
+	session, err := h.store.Get(r, mfaSession)
+	if err != nil {
+		return nil, err
+	}
+
+	token, ok := session.Values[mfaCookie].(string)
+	if !ok {
+		return nil, fmt.Errorf("no pending two-factor authentication")
+	}
+
+	pending, err := h.decodeMFAPending(token)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := h.userService.FindByID(r.Context(), pending.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	if user == nil {
+		return nil, fmt.Errorf("user not found")
+	}
+
+	return user, nil
+}
+
+func (h *handler) getLoginMFA(w http.ResponseWriter, r *http.Request) {
+	if _, err := h.pendingMFAUser(r); err != nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	h.writeTemplate(w, "login_mfa", nil)
+}
+
+func (h *handler) postLoginMFA(w http.ResponseWriter, r *http.Request) {
+	user, err := h.pendingMFAUser(r)
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	ctx := r.Context()
+	keys := []domain.ThrottleKey{domain.ThrottleUser(user.ID), domain.ThrottleIP(clientIP(r))}
+	if err := h.allowAttempt(ctx, domain.ThrottleMFA, keys...); err != nil {
+		w.WriteHeader(http.StatusTooManyRequests)
+		h.writeTemplate(w, "login_mfa", map[string]interface{}{
+			"Errors": map[string]string{"Code": tooManyAttemptsMessage},
+		})
+		return
+	}
+
+	if err := h.mfaService.Verify(ctx, user, r.FormValue("code")); err != nil {
+		h.recordAttempt(ctx, domain.ThrottleMFA, keys...)
+		h.log.Info().Sendf("invalid two-factor code for user %d", user.ID)
+		h.audit(r, domain.AuditLoginFailed, nil, user, nil)
+		w.WriteHeader(http.StatusUnauthorized)
+		h.writeTemplate(w, "login_mfa", map[string]interface{}{
+			"Errors": map[string]string{"Code": "invalid authentication code"},
+		})
+		return
+	}
+
+	h.resetAttempts(ctx, domain.ThrottleMFA, domain.ThrottleUser(user.ID))
+
+	deleteOptions := *defaultSessionOptions
+	deleteOptions.MaxAge = -1
+	_ = h.getSessionAndSetCookie(w, r, "", mfaSession, mfaCookie, &deleteOptions)
+
+	if err := h.startSession(w, r, user); err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		h.writeLogin(w, nil)
+		return
+	}
+
+	h.audit(r, domain.AuditLoginSucceeded, user, user, nil)
+	http.Redirect(w, r, h.popReturnTo(w, r), http.StatusSeeOther)
+}
+
+func (h *handler) getMFASetup(w http.ResponseWriter, r *http.Request) {
+	user, _, ok := h.currentSession(w, r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	if user.TOTPEnabled {
+		http.Redirect(w, r, "/profile", http.StatusSeeOther)
+		return
+	}
+
+	enrollment, err := h.mfaService.BeginEnrollment(r.Context(), user)
+	if err != nil {
+		h.log.Error().Err(err).Sendf("failed to begin two-factor enrollment")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	h.writeTemplate(w, "mfa_setup", mfaSetup{Enrollment: enrollment})
+}
+
+func (h *handler) postMFASetup(w http.ResponseWriter, r *http.Request) {
+	user, _, ok := h.currentSession(w, r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	before := *user
+	codes, err := h.mfaService.ConfirmEnrollment(r.Context(), user, r.FormValue("code"))
+	if err != nil {
+		w.WriteHeader(statusFromError(err))
+		h.writeTemplate(w, "mfa_setup", mfaSetup{
+			Enrollment: &domain.TOTPEnrollment{
+				Secret: user.TOTPSecret,
+				URI:    r.FormValue("uri"),
+			},
+			Errors: map[string]string{"Code": "invalid authentication code"},
+		})
+		return
+	}
+
+	h.auditUserChanges(r, user, &before, user)
+	h.writeTemplate(w, "mfa_recovery_codes", mfaRecoveryCodes{Codes: codes})
+}
+
+func (h *handler) postMFADisable(w http.ResponseWriter, r *http.Request) {
+	user, session, ok := h.currentSession(w, r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	before := *user
+	if err := h.mfaService.Disable(r.Context(), user, r.FormValue("code")); err != nil {
+		w.WriteHeader(statusFromError(err))
+		h.writeProfile(w, r, user, session, map[string]string{"MFA": "invalid authentication code"})
+		return
+	}
+
+	h.auditUserChanges(r, user, &before, user)
+
+	http.Redirect(w, r, "/profile", http.StatusSeeOther)
+}
+
+func (h *handler) postMFARecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	user, session, ok := h.currentSession(w, r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	codes, err := h.mfaService.RegenerateRecoveryCodes(r.Context(), user, r.FormValue("code"))
+	if err != nil {
+		w.WriteHeader(statusFromError(err))
+		h.writeProfile(w, r, user, session, map[string]string{"MFA": "invalid authentication code"})
+		return
+	}
+
+	h.writeTemplate(w, "mfa_recovery_codes", mfaRecoveryCodes{Codes: codes})
+}
@@ -0,0 +1,362 @@
+package http
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/sessions"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/pkg/errors"
+)
+
+const returnToSession string = "return_to_session"
+const returnToValue string = "return_to"
+
+// returnToLength is the time the user has to sign in before going back to the authorization
+const returnToLength = 10 * time.Minute
+
+const oauthConsentName string = "oauth_consent"
+
+// oauthConsentLength is the time the user has to answer the consent page
+const oauthConsentLength = 10 * time.Minute
+
+// oauthConsentState carries the validated authorization request through the consent form. It is
+// signed and bound to the session, so another site cannot post a decision for the user.
+type oauthConsentState struct {
+	Request   domain.OAuthAuthorizationRequest
+	UserID    int
+	SessionID int
+	ExpiresAt int64
+}
+
+type oauthConsentPage struct {
+	ClientName string
+	Email      string
+	Scopes     []string
+	Consent    string
+}
+
+type oauthErrorPage struct {
+	Message string
+}
+
+// oauthError is the error response of the token, revocation and introspection endpoints
+type oauthError struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+func (h *handler) registerOAuth(r *mux.Router) {
+	r.HandleFunc("/oauth/authorize", h.getOAuthAuthorize).Methods("GET")
+	r.HandleFunc("/oauth/authorize", h.postOAuthAuthorize).Methods("POST")
+	r.HandleFunc("/oauth/token", h.postOAuthToken).Methods("POST")
+	r.HandleFunc("/oauth/revoke", h.postOAuthRevoke).Methods("POST")
+	r.HandleFunc("/oauth/introspect", h.postOAuthIntrospect).Methods("POST")
+
+	// ID tokens are signed with the keys of the token service
+	if h.tokenService != nil {
+		h.registerOIDC(r)
+	}
+}
+
+// setReturnTo remembers the local path to go back to once the user signed in
+func (h *handler) setReturnTo(w http.ResponseWriter, r *http.Request, path string) error {
+	options := *defaultSessionOptions
+	options.MaxAge = int(returnToLength.Seconds())
+	return h.getSessionAndSetCookie(w, r, path, returnToSession, returnToValue, &options)
+}
+
+// popReturnTo returns the path remembered by setReturnTo, or the profile, and forgets it
+func (h *handler) popReturnTo(w http.ResponseWriter, r *http.Request) string {
+	session, err := h.store.Get(r, returnToSession)
+	if err != nil {
+		return "/profile"
+	}
+
+	path, ok := session.Values[returnToValue].(string)
+	if !ok {
+		return "/profile"
+	}
+
+	session.Options = &sessions.Options{Path: "/", HttpOnly: true, MaxAge: -1}
+	session.Values = make(map[interface{}]interface{})
+	if err := session.Save(r, w); err != nil {
+		h.log.Error().Err(err).Sendf("failed to clear return to session")
+	}
+
+	return safeNext(path)
+}
+
+func oauthAuthorizationRequest(values url.Values) *domain.OAuthAuthorizationRequest {
+	return &domain.OAuthAuthorizationRequest{
+		ClientID:            values.Get("client_id"),
+		RedirectURI:         values.Get("redirect_uri"),
+		ResponseType:        values.Get("response_type"),
+		Scope:               values.Get("scope"),
+		State:               values.Get("state"),
+		CodeChallenge:       values.Get("code_challenge"),
+		CodeChallengeMethod: values.Get("code_challenge_method"),
+		Nonce:               values.Get("nonce"),
+	}
+}
+
+// redirectToClient sends the user back to the redirect URI of a validated request with params
+func redirectToClient(w http.ResponseWriter, r *http.Request, req *domain.OAuthAuthorizationRequest, params url.Values) {
+	u, err := url.Parse(req.RedirectURI)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+
+	query := u.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+
+	u.RawQuery = query.Encode()
+	http.Redirect(w, r, u.String(), http.StatusSeeOther)
+}
+
+// writeAuthorizeError redirects the error to the client, unless the client or its redirect URI
+// could not be verified, the user is then told on our page instead of being sent anywhere
+func (h *handler) writeAuthorizeError(w http.ResponseWriter, r *http.Request, client *domain.OAuthClient, req *domain.OAuthAuthorizationRequest, err error) {
+	describer, ok := errors.DescriberCast(err)
+	if !ok || client == nil {
+		h.writeOAuthErrorPage(w, err)
+		return
+	}
+
+	redirectToClient(w, r, req, url.Values{
+		"error":             {string(describer.GetCode())},
+		"error_description": {describer.GetMessage()},
+	})
+}
+
+// writeOAuthErrorPage tells the user about a request that cannot be sent back to the client
+func (h *handler) writeOAuthErrorPage(w http.ResponseWriter, err error) {
+	describer, ok := errors.DescriberCast(err)
+	if !ok {
+		h.log.Error().Err(err).Sendf("oauth request failed: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		h.writeTemplate(w, "oauth_error", oauthErrorPage{Message: "the request failed, try again later"})
+		return
+	}
+
+	w.WriteHeader(http.StatusBadRequest)
+	h.writeTemplate(w, "oauth_error", oauthErrorPage{Message: describer.GetMessage()})
+}
+
+func (h *handler) getOAuthAuthorize(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	req := oauthAuthorizationRequest(r.URL.Query())
+
+	client, err := h.oauthService.ValidateAuthorization(ctx, req)
+	if err != nil {
+		h.writeAuthorizeError(w, r, client, req, err)
+		return
+	}
+
+	user, session, ok := h.currentSession(w, r)
+	if !ok {
+		if err := h.setReturnTo(w, r, r.URL.RequestURI()); err != nil {
+			h.log.Error().Err(err).Sendf("failed to save return to session")
+		}
+
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	consented, err := h.oauthService.HasConsent(ctx, user, client, req.Scope)
+	if err != nil {
+		h.writeAuthorizeError(w, r, client, req, err)
+		return
+	}
+
+	if consented {
+		h.authorize(w, r, user, client, req)
+		return
+	}
+
+	consent, err := h.store.Codecs[0].Encode(oauthConsentName, oauthConsentState{
+		Request:   *req,
+		UserID:    user.ID,
+		SessionID: session.ID,
+		ExpiresAt: time.Now().Add(oauthConsentLength).Unix(),
+	})
+	if err != nil {
+		h.writeAuthorizeError(w, r, client, req, err)
+		return
+	}
+
+	denyFraming(w)
+	h.writeTemplate(w, "oauth_authorize", oauthConsentPage{
+		ClientName: client.Name,
+		Email:      user.Email,
+		Scopes:     strings.Fields(req.Scope),
+		Consent:    consent,
+	})
+}
+
+func (h *handler) decodeOAuthConsent(token string, user *domain.User, session *domain.Session) (*domain.OAuthAuthorizationRequest, bool) {
+	var state oauthConsentState
+	for _, codec := range h.store.Codecs {
+		if err := codec.Decode(oauthConsentName, token, &state); err != nil {
+			continue
+		}
+
+		if state.UserID != user.ID || state.SessionID != session.ID || time.Now().Unix() >= state.ExpiresAt {
+			return nil, false
+		}
+
+		return &state.Request, true
+	}
+
+	return nil, false
+}
+
+func (h *handler) postOAuthAuthorize(w http.ResponseWriter, r *http.Request) {
+	user, session, ok := h.currentSession(w, r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	req, ok := h.decodeOAuthConsent(r.FormValue("consent"), user, session)
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		h.writeTemplate(w, "oauth_error", oauthErrorPage{Message: "the authorization expired, go back to the application and try again"})
+		return
+	}
+
+	// the client may have been changed or deleted while the user was deciding
+	client, err := h.oauthService.ValidateAuthorization(r.Context(), req)
+	if err != nil {
+		h.writeAuthorizeError(w, r, client, req, err)
+		return
+	}
+
+	if r.FormValue("decision") != "allow" {
+		redirectToClient(w, r, req, url.Values{
+			"error":             {string(domain.ErrOAuthAccessDenied)},
+			"error_description": {"the user denied the authorization"},
+		})
+		return
+	}
+
+	h.authorize(w, r, user, client, req)
+}
+
+func (h *handler) authorize(w http.ResponseWriter, r *http.Request, user *domain.User, client *domain.OAuthClient, req *domain.OAuthAuthorizationRequest) {
+	code, err := h.oauthService.Authorize(r.Context(), user, req)
+	if err != nil {
+		h.writeAuthorizeError(w, r, client, req, err)
+		return
+	}
+
+	redirectToClient(w, r, req, url.Values{"code": {code}})
+}
+
+// oauthClientCredentials reads the client credentials from the Basic Authorization header, where
+// RFC 6749 form encodes them, or from the form
+func oauthClientCredentials(r *http.Request) (string, string) {
+	if clientID, clientSecret, ok := r.BasicAuth(); ok {
+		if id, err := url.QueryUnescape(clientID); err == nil {
+			clientID = id
+		}
+
+		if secret, err := url.QueryUnescape(clientSecret); err == nil {
+			clientSecret = secret
+		}
+
+		return clientID, clientSecret
+	}
+
+	return r.PostFormValue("client_id"), r.PostFormValue("client_secret")
+}
+
+// writeOAuthError writes the errors of RFC 6749, failed client authentications are 401
+func (h *handler) writeOAuthError(w http.ResponseWriter, err error) {
+	describer, ok := errors.DescriberCast(err)
+	if !ok {
+		h.log.Error().Err(err).Sendf("oauth request failed: %v", err)
+		h.writeJSON(w, http.StatusInternalServerError, oauthError{Error: "server_error"})
+		return
+	}
+
+	status := http.StatusBadRequest
+	if _, ok := errors.NotAuthorizedCast(err); ok {
+		w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+		status = http.StatusUnauthorized
+	}
+
+	h.writeJSON(w, status, oauthError{
+		Error:            string(describer.GetCode()),
+		ErrorDescription: describer.GetMessage(),
+	})
+}
+
+func (h *handler) postOAuthToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		h.writeOAuthError(w, errors.NewInvalidArgument(domain.ErrOAuthInvalidRequest).WithMessage("invalid form"))
+		return
+	}
+
+	clientID, clientSecret := oauthClientCredentials(r)
+	resp, err := h.oauthService.Token(r.Context(), &domain.OAuthTokenRequest{
+		GrantType:    r.PostFormValue("grant_type"),
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Code:         r.PostFormValue("code"),
+		RedirectURI:  r.PostFormValue("redirect_uri"),
+		CodeVerifier: r.PostFormValue("code_verifier"),
+		RefreshToken: r.PostFormValue("refresh_token"),
+		Scope:        r.PostFormValue("scope"),
+	})
+	if err != nil {
+		h.writeOAuthError(w, err)
+		return
+	}
+
+	w.Header().Set("Pragma", "no-cache")
+	h.writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *handler) postOAuthRevoke(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		h.writeOAuthError(w, errors.NewInvalidArgument(domain.ErrOAuthInvalidRequest).WithMessage("invalid form"))
+		return
+	}
+
+	clientID, clientSecret := oauthClientCredentials(r)
+	err := h.oauthService.Revoke(r.Context(), clientID, clientSecret, r.PostFormValue("token"), r.PostFormValue("token_type_hint"))
+	if err != nil {
+		h.writeOAuthError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *handler) postOAuthIntrospect(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		h.writeOAuthError(w, errors.NewInvalidArgument(domain.ErrOAuthInvalidRequest).WithMessage("invalid form"))
+		return
+	}
+
+	clientID, clientSecret := oauthClientCredentials(r)
+	introspection, err := h.oauthService.Introspect(r.Context(), clientID, clientSecret, r.PostFormValue("token"))
+	if err != nil {
+		h.writeOAuthError(w, err)
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, introspection)
+}
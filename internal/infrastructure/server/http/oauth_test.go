@@ -0,0 +1,329 @@
+package http_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+)
+
+const (
+	clientRedirectURI = "https://app.example.com/callback"
+	codeVerifier      = "dBjftJeZ4CVP-mJ0kS8hQm7Edq6Bt6NZ5C9zEtJ9Wv8a"
+)
+
+var consentInput = regexp.MustCompile(`name="consent" value="([^"]+)"`)
+
+func codeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// newOAuthBrowser keeps the cookies like newBrowser but stops at the redirects to the client,
+// whose location the test reads instead
+func newOAuthBrowser(t *testing.T, ts *testServer) *http.Client {
+	browser := newBrowser(t)
+	browser.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if !strings.HasPrefix(req.URL.String(), ts.URL) {
+			return http.ErrUseLastResponse
+		}
+
+		return nil
+	}
+
+	return browser
+}
+
+func (ts *testServer) registerClient(t *testing.T, confidential bool) (*domain.OAuthClient, string) {
+	client, secret, err := ts.oauth.RegisterClient(context.Background(), &domain.OAuthClientRegistration{
+		Name:         "Billing",
+		RedirectURIs: []string{clientRedirectURI},
+		Scopes:       []string{"profile", "email"},
+		Confidential: confidential,
+	})
+	require.NoError(t, err)
+
+	return client, secret
+}
+
+func authorizePath(clientID, scope, state string) string {
+	return "/oauth/authorize?" + url.Values{
+		"client_id":             {clientID},
+		"redirect_uri":          {clientRedirectURI},
+		"response_type":         {"code"},
+		"scope":                 {scope},
+		"state":                 {state},
+		"code_challenge":        {codeChallenge(codeVerifier)},
+		"code_challenge_method": {"S256"},
+	}.Encode()
+}
+
+// clientRedirect returns the query of the redirect to the client ending the response
+func clientRedirect(t *testing.T, resp *http.Response) url.Values {
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusSeeOther, resp.StatusCode)
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	require.NoError(t, err)
+	require.Equal(t, clientRedirectURI, location.Scheme+"://"+location.Host+location.Path)
+
+	return location.Query()
+}
+
+// oauthPost posts the form to an OAuth endpoint and decodes the JSON response in v
+func (ts *testServer) oauthPost(t *testing.T, path, clientID, clientSecret string, form url.Values, v interface{}) int {
+	// public clients identify themselves in the form, confidential ones authenticate with Basic
+	if clientSecret == "" {
+		form.Set("client_id", clientID)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, ts.URL+path, strings.NewReader(form.Encode()))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if clientSecret != "" {
+		req.SetBasicAuth(clientID, clientSecret)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	if v != nil && len(body) > 0 {
+		require.NoError(t, json.Unmarshal(body, v), string(body))
+	}
+
+	return resp.StatusCode
+}
+
+type oauthErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+func TestHandler_OAuthAuthorizationCode(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	user := ts.signup(t, newBrowser(t), "user@example.com", "password")
+	client, secret := ts.registerClient(t, true)
+
+	// the user signs in and comes back to the authorization
+	browser := newOAuthBrowser(t, ts)
+	p := ts.get(t, browser, authorizePath(client.ClientID, "profile", "xyz"))
+	require.Equal(t, "/login", p.path)
+
+	p = ts.post(t, browser, "/login", url.Values{"email": {"user@example.com"}, "password": {"password"}})
+	require.Equal(t, http.StatusOK, p.status, p.body)
+	require.Equal(t, "/oauth/authorize", p.path)
+	assert.Contains(t, p.body, "Billing")
+	assert.Contains(t, p.body, "profile")
+	assert.Equal(t, "DENY", p.header.Get("X-Frame-Options"), "the consent cannot be framed")
+	assert.Equal(t, "frame-ancestors 'none'", p.header.Get("Content-Security-Policy"))
+
+	match := consentInput.FindStringSubmatch(p.body)
+	require.Len(t, match, 2, p.body)
+
+	resp, err := browser.PostForm(ts.URL+"/oauth/authorize", url.Values{"consent": {match[1]}, "decision": {"allow"}})
+	require.NoError(t, err)
+	query := clientRedirect(t, resp)
+	assert.Equal(t, "xyz", query.Get("state"))
+	code := query.Get("code")
+	require.NotEmpty(t, code)
+
+	var errResp oauthErrorResponse
+	status := ts.oauthPost(t, "/oauth/token", client.ClientID, "wrong", url.Values{
+		"grant_type": {"authorization_code"}, "code": {code}, "redirect_uri": {clientRedirectURI}, "code_verifier": {codeVerifier},
+	}, &errResp)
+	assert.Equal(t, http.StatusUnauthorized, status)
+	assert.Equal(t, "invalid_client", errResp.Error)
+
+	status = ts.oauthPost(t, "/oauth/token", client.ClientID, secret, url.Values{
+		"grant_type": {"authorization_code"}, "code": {code}, "redirect_uri": {clientRedirectURI}, "code_verifier": {"wrong-verifier-wrong-verifier-wrong-verifier"},
+	}, &errResp)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "invalid_grant", errResp.Error)
+
+	var tokens domain.OAuthTokenResponse
+	status = ts.oauthPost(t, "/oauth/token", client.ClientID, secret, url.Values{
+		"grant_type": {"authorization_code"}, "code": {code}, "redirect_uri": {clientRedirectURI}, "code_verifier": {codeVerifier},
+	}, &tokens)
+	require.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "Bearer", tokens.TokenType)
+	assert.Equal(t, "profile", tokens.Scope)
+	require.NotEmpty(t, tokens.AccessToken)
+	require.NotEmpty(t, tokens.RefreshToken)
+
+	var introspection domain.OAuthIntrospection
+	status = ts.oauthPost(t, "/oauth/introspect", client.ClientID, secret, url.Values{"token": {tokens.AccessToken}}, &introspection)
+	require.Equal(t, http.StatusOK, status)
+	assert.True(t, introspection.Active)
+	assert.Equal(t, "user@example.com", introspection.Username)
+	assert.Equal(t, client.ClientID, introspection.ClientID)
+	assert.Equal(t, "profile", introspection.Scope)
+	assert.Equal(t, ts.URL, introspection.Issuer)
+	assert.Equal(t, strconv.Itoa(user.ID), introspection.Subject)
+
+	// the refresh token rotates, presenting the old one again revokes the new tokens
+	var refreshed domain.OAuthTokenResponse
+	status = ts.oauthPost(t, "/oauth/token", client.ClientID, secret, url.Values{
+		"grant_type": {"refresh_token"}, "refresh_token": {tokens.RefreshToken},
+	}, &refreshed)
+	require.Equal(t, http.StatusOK, status)
+	assert.NotEqual(t, tokens.RefreshToken, refreshed.RefreshToken)
+
+	status = ts.oauthPost(t, "/oauth/token", client.ClientID, secret, url.Values{
+		"grant_type": {"refresh_token"}, "refresh_token": {tokens.RefreshToken},
+	}, &errResp)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "invalid_grant", errResp.Error)
+
+	introspection = domain.OAuthIntrospection{}
+	ts.oauthPost(t, "/oauth/introspect", client.ClientID, secret, url.Values{"token": {refreshed.AccessToken}}, &introspection)
+	assert.False(t, introspection.Active)
+
+	// the code was used, it cannot be exchanged again
+	status = ts.oauthPost(t, "/oauth/token", client.ClientID, secret, url.Values{
+		"grant_type": {"authorization_code"}, "code": {code}, "redirect_uri": {clientRedirectURI}, "code_verifier": {codeVerifier},
+	}, &errResp)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "invalid_grant", errResp.Error)
+
+	// the consent is remembered, the code is issued right away
+	resp, err = browser.Get(ts.URL + authorizePath(client.ClientID, "profile", "abc"))
+	require.NoError(t, err)
+	query = clientRedirect(t, resp)
+	assert.Equal(t, "abc", query.Get("state"))
+	assert.NotEmpty(t, query.Get("code"))
+}
+
+func TestHandler_OAuthPublicClientAndRevoke(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	browser := newOAuthBrowser(t, ts)
+	ts.signup(t, browser, "user@example.com", "password")
+	client, _ := ts.registerClient(t, false)
+	resourceServer, resourceSecret := ts.registerClient(t, true)
+
+	p := ts.get(t, browser, authorizePath(client.ClientID, "", "xyz"))
+	require.Equal(t, http.StatusOK, p.status, p.body)
+	assert.Contains(t, p.body, "email", "the scope defaults to the scopes of the client")
+	match := consentInput.FindStringSubmatch(p.body)
+	require.Len(t, match, 2, p.body)
+
+	resp, err := browser.PostForm(ts.URL+"/oauth/authorize", url.Values{"consent": {match[1]}, "decision": {"allow"}})
+	require.NoError(t, err)
+	code := clientRedirect(t, resp).Get("code")
+
+	var tokens domain.OAuthTokenResponse
+	status := ts.oauthPost(t, "/oauth/token", client.ClientID, "", url.Values{
+		"grant_type": {"authorization_code"}, "code": {code}, "redirect_uri": {clientRedirectURI}, "code_verifier": {codeVerifier},
+	}, &tokens)
+	require.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "profile email", tokens.Scope)
+
+	// public clients cannot introspect
+	var errResp oauthErrorResponse
+	status = ts.oauthPost(t, "/oauth/introspect", client.ClientID, "", url.Values{"token": {tokens.AccessToken}}, &errResp)
+	assert.Equal(t, http.StatusUnauthorized, status)
+	assert.Equal(t, "invalid_client", errResp.Error)
+
+	// revoking the refresh token revokes the access token of the same grant
+	status = ts.oauthPost(t, "/oauth/revoke", client.ClientID, "", url.Values{"token": {tokens.RefreshToken}, "token_type_hint": {"refresh_token"}}, nil)
+	require.Equal(t, http.StatusOK, status)
+
+	var introspection domain.OAuthIntrospection
+	ts.oauthPost(t, "/oauth/introspect", resourceServer.ClientID, resourceSecret, url.Values{"token": {tokens.AccessToken}}, &introspection)
+	assert.False(t, introspection.Active)
+
+	// unknown tokens are ignored
+	status = ts.oauthPost(t, "/oauth/revoke", client.ClientID, "", url.Values{"token": {"unknown"}}, nil)
+	assert.Equal(t, http.StatusOK, status)
+}
+
+func TestHandler_OAuthClientCredentials(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	client, secret := ts.registerClient(t, true)
+	public, _ := ts.registerClient(t, false)
+
+	var tokens domain.OAuthTokenResponse
+	status := ts.oauthPost(t, "/oauth/token", client.ClientID, secret, url.Values{"grant_type": {"client_credentials"}, "scope": {"email"}}, &tokens)
+	require.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "email", tokens.Scope)
+	assert.Empty(t, tokens.RefreshToken, "the client authenticates again instead")
+
+	var introspection domain.OAuthIntrospection
+	ts.oauthPost(t, "/oauth/introspect", client.ClientID, secret, url.Values{"token": {tokens.AccessToken}}, &introspection)
+	assert.True(t, introspection.Active)
+	assert.Empty(t, introspection.Subject, "the token is not issued for a user")
+
+	var errResp oauthErrorResponse
+	status = ts.oauthPost(t, "/oauth/token", client.ClientID, secret, url.Values{"grant_type": {"client_credentials"}, "scope": {"admin"}}, &errResp)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "invalid_scope", errResp.Error)
+
+	status = ts.oauthPost(t, "/oauth/token", public.ClientID, "", url.Values{"grant_type": {"client_credentials"}}, &errResp)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "unauthorized_client", errResp.Error)
+
+	status = ts.oauthPost(t, "/oauth/token", client.ClientID, secret, url.Values{"grant_type": {"password"}}, &errResp)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "unsupported_grant_type", errResp.Error)
+}
+
+func TestHandler_OAuthAuthorizeErrors(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	browser := newOAuthBrowser(t, ts)
+	ts.signup(t, browser, "user@example.com", "password")
+	client, _ := ts.registerClient(t, true)
+
+	// errors about the client are not redirected, the redirect URI cannot be trusted
+	p := ts.get(t, browser, authorizePath("unknown", "profile", "xyz"))
+	assert.Equal(t, http.StatusBadRequest, p.status)
+	assert.Contains(t, p.body, "unknown client")
+
+	p = ts.get(t, browser, strings.Replace(authorizePath(client.ClientID, "profile", "xyz"), "app.example.com", "evil.example.com", 1))
+	assert.Equal(t, http.StatusBadRequest, p.status)
+
+	resp, err := browser.Get(ts.URL + authorizePath(client.ClientID, "admin", "xyz"))
+	require.NoError(t, err)
+	query := clientRedirect(t, resp)
+	assert.Equal(t, "invalid_scope", query.Get("error"))
+	assert.Equal(t, "xyz", query.Get("state"))
+
+	resp, err = browser.Get(ts.URL + strings.Replace(authorizePath(client.ClientID, "profile", "xyz"), "S256", "plain", 1))
+	require.NoError(t, err)
+	assert.Equal(t, "invalid_request", clientRedirect(t, resp).Get("error"))
+
+	// denying redirects without code
+	p = ts.get(t, browser, authorizePath(client.ClientID, "profile", "xyz"))
+	match := consentInput.FindStringSubmatch(p.body)
+	require.Len(t, match, 2, p.body)
+
+	resp, err = browser.PostForm(ts.URL+"/oauth/authorize", url.Values{"consent": {match[1]}, "decision": {"deny"}})
+	require.NoError(t, err)
+	query = clientRedirect(t, resp)
+	assert.Equal(t, "access_denied", query.Get("error"))
+	assert.Empty(t, query.Get("code"))
+
+	// the consent form only works in the session it was shown in
+	other := newOAuthBrowser(t, ts)
+	p = ts.post(t, other, "/login", url.Values{"email": {"user@example.com"}, "password": {"password"}})
+	require.Equal(t, "/profile", p.path)
+	p = ts.post(t, other, "/oauth/authorize", url.Values{"consent": {match[1]}, "decision": {"allow"}})
+	assert.Equal(t, http.StatusBadRequest, p.status)
+}
@@ -0,0 +1,195 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/pkg/errors"
+)
+
+const oauthLogoutName string = "oauth_logout"
+
+// oauthLogoutLength is the time the user has to confirm the logout
+const oauthLogoutLength = 10 * time.Minute
+
+// oauthLogoutState carries the validated logout request through the confirmation form, signed and
+// bound to the session like the consent
+type oauthLogoutState struct {
+	Logout    domain.OIDCLogout
+	UserID    int
+	SessionID int
+	ExpiresAt int64
+}
+
+type oauthLogoutPage struct {
+	Email  string
+	Logout string
+}
+
+func (h *handler) registerOIDC(r *mux.Router) {
+	r.HandleFunc("/.well-known/openid-configuration", h.getOpenIDConfiguration).Methods("GET")
+	r.HandleFunc("/userinfo", h.getUserInfo).Methods("GET", "POST")
+	r.HandleFunc("/oauth/logout", h.getOAuthLogout).Methods("GET")
+	r.HandleFunc("/oauth/logout", h.postOAuthLogout).Methods("POST")
+}
+
+func (h *handler) getOpenIDConfiguration(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	h.writeJSON(w, http.StatusOK, h.oauthService.OpenIDConfiguration())
+}
+
+// getUserInfo takes the access token from the Authorization header, or from the form as RFC 6750
+// allows for POST requests
+func (h *handler) getUserInfo(w http.ResponseWriter, r *http.Request) {
+	token := bearerToken(r)
+	if token == "" && r.Method == http.MethodPost {
+		token = r.PostFormValue("access_token")
+	}
+
+	userInfo, err := h.oauthService.UserInfo(r.Context(), token)
+	if err != nil {
+		h.writeBearerError(w, err)
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, userInfo)
+}
+
+// writeBearerError writes the errors of RFC 6750, which are also told in the WWW-Authenticate
+// header
+func (h *handler) writeBearerError(w http.ResponseWriter, err error) {
+	describer, ok := errors.DescriberCast(err)
+	if !ok {
+		h.log.Error().Err(err).Sendf("userinfo request failed: %v", err)
+		h.writeJSON(w, http.StatusInternalServerError, oauthError{Error: "server_error"})
+		return
+	}
+
+	status := http.StatusUnauthorized
+	if _, ok := errors.RuleNotSatisfiedCast(err); ok {
+		status = http.StatusForbidden
+	}
+
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error=%q, error_description=%q`, describer.GetCode(), describer.GetMessage()))
+	h.writeJSON(w, status, oauthError{
+		Error:            string(describer.GetCode()),
+		ErrorDescription: describer.GetMessage(),
+	})
+}
+
+// getOAuthLogout is the end session endpoint of RP-initiated logout. The user is signed out right
+// away when the ID token hint names them, otherwise they confirm it, so another site cannot sign
+// them out.
+func (h *handler) getOAuthLogout(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	logout, err := h.oauthService.ValidateLogout(r.Context(), &domain.OIDCLogoutRequest{
+		IDTokenHint:           query.Get("id_token_hint"),
+		ClientID:              query.Get("client_id"),
+		PostLogoutRedirectURI: query.Get("post_logout_redirect_uri"),
+		State:                 query.Get("state"),
+	})
+	if err != nil {
+		h.writeOAuthErrorPage(w, err)
+		return
+	}
+
+	user, session, ok := h.currentSession(w, r)
+	if !ok {
+		redirectAfterLogout(w, r, logout)
+		return
+	}
+
+	if logout.UserID == user.ID {
+		h.endOAuthSession(w, r, user, session, logout)
+		return
+	}
+
+	state, err := h.store.Codecs[0].Encode(oauthLogoutName, oauthLogoutState{
+		Logout:    *logout,
+		UserID:    user.ID,
+		SessionID: session.ID,
+		ExpiresAt: time.Now().Add(oauthLogoutLength).Unix(),
+	})
+	if err != nil {
+		h.writeOAuthErrorPage(w, err)
+		return
+	}
+
+	denyFraming(w)
+	h.writeTemplate(w, "oauth_logout", oauthLogoutPage{Email: user.Email, Logout: state})
+}
+
+func (h *handler) decodeOAuthLogout(token string, user *domain.User, session *domain.Session) (*domain.OIDCLogout, bool) {
+	var state oauthLogoutState
+	for _, codec := range h.store.Codecs {
+		if err := codec.Decode(oauthLogoutName, token, &state); err != nil {
+			continue
+		}
+
+		if state.UserID != user.ID || state.SessionID != session.ID || time.Now().Unix() >= state.ExpiresAt {
+			return nil, false
+		}
+
+		return &state.Logout, true
+	}
+
+	return nil, false
+}
+
+func (h *handler) postOAuthLogout(w http.ResponseWriter, r *http.Request) {
+	user, session, ok := h.currentSession(w, r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	logout, ok := h.decodeOAuthLogout(r.FormValue("logout"), user, session)
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		h.writeTemplate(w, "oauth_error", oauthErrorPage{Message: "the logout expired, go back to the application and try again"})
+		return
+	}
+
+	if r.FormValue("decision") != "logout" {
+		http.Redirect(w, r, "/profile", http.StatusSeeOther)
+		return
+	}
+
+	h.endOAuthSession(w, r, user, session, logout)
+}
+
+func (h *handler) endOAuthSession(w http.ResponseWriter, r *http.Request, user *domain.User, session *domain.Session, logout *domain.OIDCLogout) {
+	if err := h.endSession(w, r, user, session); err != nil {
+		h.writeOAuthErrorPage(w, err)
+		return
+	}
+
+	redirectAfterLogout(w, r, logout)
+}
+
+// redirectAfterLogout sends the user back to the client with its state, or to the login page
+func redirectAfterLogout(w http.ResponseWriter, r *http.Request, logout *domain.OIDCLogout) {
+	if logout.RedirectURI == "" {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	u, err := url.Parse(logout.RedirectURI)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if logout.State != "" {
+		query := u.Query()
+		query.Set("state", logout.State)
+		u.RawQuery = query.Encode()
+	}
+
+	http.Redirect(w, r, u.String(), http.StatusSeeOther)
+}
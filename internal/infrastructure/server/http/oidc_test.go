@@ -0,0 +1,192 @@
+package http_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/pkg/jwt"
+)
+
+const postLogoutRedirectURI = "https://app.example.com/logged-out"
+
+var logoutInput = regexp.MustCompile(`name="logout" value="([^"]+)"`)
+
+func (ts *testServer) registerOIDCClient(t *testing.T) (*domain.OAuthClient, string) {
+	client, secret, err := ts.oauth.RegisterClient(context.Background(), &domain.OAuthClientRegistration{
+		Name:                   "Billing",
+		RedirectURIs:           []string{clientRedirectURI},
+		PostLogoutRedirectURIs: []string{postLogoutRedirectURI},
+		Scopes:                 []string{"openid", "profile", "email", "phone"},
+		Confidential:           true,
+	})
+	require.NoError(t, err)
+
+	return client, secret
+}
+
+func (ts *testServer) getJSON(t *testing.T, path, accessToken string, v interface{}) *http.Response {
+	req, err := http.NewRequest(http.MethodGet, ts.URL+path, nil)
+	require.NoError(t, err)
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(v))
+	return resp
+}
+
+// signInOIDC signs the user in through the authorization with the openid scope and returns the
+// tokens, the browser keeps the session
+func (ts *testServer) signInOIDC(t *testing.T, browser *http.Client, email string, client *domain.OAuthClient, secret string) domain.OAuthTokenResponse {
+	p := ts.get(t, browser, authorizePath(client.ClientID, "openid profile email", "xyz")+"&nonce=n-0S6_WzA2Mj")
+	require.Equal(t, "/login", p.path)
+
+	p = ts.post(t, browser, "/login", url.Values{"email": {email}, "password": {"password"}})
+	require.Equal(t, http.StatusOK, p.status, p.body)
+	match := consentInput.FindStringSubmatch(p.body)
+	require.Len(t, match, 2, p.body)
+
+	resp, err := browser.PostForm(ts.URL+"/oauth/authorize", url.Values{"consent": {match[1]}, "decision": {"allow"}})
+	require.NoError(t, err)
+	code := clientRedirect(t, resp).Get("code")
+
+	var tokens domain.OAuthTokenResponse
+	status := ts.oauthPost(t, "/oauth/token", client.ClientID, secret, url.Values{
+		"grant_type": {"authorization_code"}, "code": {code}, "redirect_uri": {clientRedirectURI}, "code_verifier": {codeVerifier},
+	}, &tokens)
+	require.Equal(t, http.StatusOK, status)
+
+	return tokens
+}
+
+// logoutRedirect returns the location of a redirect leaving the server
+func logoutRedirect(t *testing.T, resp *http.Response) *url.URL {
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusSeeOther, resp.StatusCode)
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	require.NoError(t, err)
+
+	return location
+}
+
+func TestHandler_OpenIDConnect(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	user := ts.signup(t, newBrowser(t), "user@example.com", "password")
+	user.Name = "Jane Doe"
+	require.NoError(t, ts.users.Update(context.Background(), user))
+	client, secret := ts.registerOIDCClient(t)
+
+	var config domain.OpenIDConfiguration
+	resp := ts.getJSON(t, "/.well-known/openid-configuration", "", &config)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, ts.URL, config.Issuer)
+	assert.Equal(t, ts.URL+"/oauth/token", config.TokenEndpoint)
+	assert.Equal(t, ts.URL+"/userinfo", config.UserInfoEndpoint)
+	assert.Equal(t, []string{"EdDSA"}, config.IDTokenSigningAlgValuesSupported)
+
+	tokens := ts.signInOIDC(t, newOAuthBrowser(t, ts), "user@example.com", client, secret)
+	require.NotEmpty(t, tokens.IDToken)
+
+	// relying parties verify the ID token with the published keys
+	var jwks jwt.JWKS
+	ts.getJSON(t, "/.well-known/jwks.json", "", &jwks)
+	var claims domain.IDTokenClaims
+	require.NoError(t, jwt.Verify(tokens.IDToken, jwks.PublicKeys(), &claims))
+	assert.Equal(t, ts.URL, claims.Issuer)
+	assert.Equal(t, strconv.Itoa(user.ID), claims.Subject)
+	assert.Equal(t, client.ClientID, claims.Audience)
+	assert.Equal(t, "n-0S6_WzA2Mj", claims.Nonce)
+	assert.Equal(t, "Jane Doe", claims.Name)
+	assert.Equal(t, "user@example.com", claims.Email)
+	require.NotNil(t, claims.EmailVerified)
+	assert.False(t, *claims.EmailVerified)
+
+	// the ID token is not an access token of the API
+	var apiErr interface{}
+	resp = ts.getJSON(t, "/api/v1/profile", tokens.IDToken, &apiErr)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	var userInfo domain.OIDCUserInfo
+	resp = ts.getJSON(t, "/userinfo", tokens.AccessToken, &userInfo)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, strconv.Itoa(user.ID), userInfo.Subject)
+	assert.Equal(t, "Jane Doe", userInfo.Name)
+	assert.Equal(t, "user@example.com", userInfo.Email)
+	assert.Empty(t, userInfo.PhoneNumber, "the phone scope was not requested")
+
+	// the access token can also be posted in the form
+	var posted domain.OIDCUserInfo
+	status := ts.oauthPost(t, "/userinfo", "", "", url.Values{"access_token": {tokens.AccessToken}}, &posted)
+	require.Equal(t, http.StatusOK, status)
+	assert.Equal(t, userInfo.Subject, posted.Subject)
+
+	var errResp oauthErrorResponse
+	resp = ts.getJSON(t, "/userinfo", "unknown", &errResp)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Equal(t, "invalid_token", errResp.Error)
+	assert.Contains(t, resp.Header.Get("WWW-Authenticate"), `Bearer error="invalid_token"`)
+}
+
+func TestHandler_OpenIDConnectLogout(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	ts.signup(t, newBrowser(t), "user@example.com", "password")
+	ts.signup(t, newBrowser(t), "other@example.com", "password")
+	client, secret := ts.registerOIDCClient(t)
+
+	// with the ID token of the user the logout happens right away
+	browser := newOAuthBrowser(t, ts)
+	tokens := ts.signInOIDC(t, browser, "user@example.com", client, secret)
+	resp, err := browser.Get(ts.URL + "/oauth/logout?" + url.Values{
+		"id_token_hint":            {tokens.IDToken},
+		"post_logout_redirect_uri": {postLogoutRedirectURI},
+		"state":                    {"af0ifjsldkj"},
+	}.Encode())
+	require.NoError(t, err)
+	location := logoutRedirect(t, resp)
+	assert.Equal(t, postLogoutRedirectURI+"?state=af0ifjsldkj", location.String())
+	assert.Equal(t, "/login", ts.get(t, browser, "/profile").path)
+
+	// without hint the user confirms
+	browser = newOAuthBrowser(t, ts)
+	ts.signInOIDC(t, browser, "other@example.com", client, secret)
+	p := ts.get(t, browser, "/oauth/logout?"+url.Values{
+		"client_id":                {client.ClientID},
+		"post_logout_redirect_uri": {postLogoutRedirectURI},
+	}.Encode())
+	require.Equal(t, http.StatusOK, p.status, p.body)
+	assert.Equal(t, "DENY", p.header.Get("X-Frame-Options"), "the confirmation cannot be framed")
+	assert.Equal(t, "frame-ancestors 'none'", p.header.Get("Content-Security-Policy"))
+	match := logoutInput.FindStringSubmatch(p.body)
+	require.Len(t, match, 2, p.body)
+
+	p = ts.post(t, browser, "/oauth/logout", url.Values{"logout": {match[1]}, "decision": {"stay"}})
+	assert.Equal(t, "/profile", p.path)
+
+	resp, err = browser.PostForm(ts.URL+"/oauth/logout", url.Values{"logout": {match[1]}, "decision": {"logout"}})
+	require.NoError(t, err)
+	assert.Equal(t, postLogoutRedirectURI, logoutRedirect(t, resp).String())
+	assert.Equal(t, "/login", ts.get(t, browser, "/profile").path)
+
+	// the redirect must be registered for the client
+	p = ts.get(t, newOAuthBrowser(t, ts), "/oauth/logout?"+url.Values{
+		"client_id":                {client.ClientID},
+		"post_logout_redirect_uri": {"https://evil.example.com/"},
+	}.Encode())
+	assert.Equal(t, http.StatusBadRequest, p.status)
+}
@@ -0,0 +1,400 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/pkg/errors"
+)
+
+// orgDoneMessages are the confirmations shown after an action, the redirect carries only the key
+// so the page cannot be made to show arbitrary text
+var orgDoneMessages = map[string]string{
+	"created":     "The organization was created, it is now your current organization.",
+	"invited":     "The invitation was sent.",
+	"revoked":     "The invitation was revoked.",
+	"removed":     "The member was removed.",
+	"transferred": "The ownership was transferred, you are now an admin.",
+	"joined":      "Welcome, you joined the organization.",
+}
+
+type organizationPage struct {
+	Organization  *domain.UserOrganization
+	Members       []*domain.OrgMember
+	Invitations   []*domain.OrgInvitation
+	CurrentUserID int
+	CanManage     bool
+	IsOwner       bool
+	// InvitableRoles are the roles the user may grant, only owners invite admins
+	InvitableRoles []domain.OrgRole
+	Message        string
+}
+
+type invitationPage struct {
+	Invitation   *domain.OrgInvitation
+	Organization *domain.Organization
+	Token        string
+	// User is the signed in user, nil when the invitation goes through the login or the signup
+	User  *domain.User
+	Error string
+}
+
+type organizationErrorPage struct {
+	Message string
+}
+
+func (h *handler) registerOrganizations(r *mux.Router) {
+	r.HandleFunc("/organizations", h.postCreateOrganization).Methods("POST")
+	r.HandleFunc("/organizations/switch", h.postSwitchOrganization).Methods("POST")
+	r.HandleFunc("/organizations/{id:[0-9]+}", h.getOrganization).Methods("GET")
+	r.HandleFunc("/organizations/{id:[0-9]+}/invitations", h.postInvite).Methods("POST")
+	r.HandleFunc("/organizations/{id:[0-9]+}/invitations/revoke", h.postRevokeInvitation).Methods("POST")
+	r.HandleFunc("/organizations/{id:[0-9]+}/members/remove", h.postRemoveMember).Methods("POST")
+	r.HandleFunc("/organizations/{id:[0-9]+}/transfer", h.postTransferOwnership).Methods("POST")
+	r.HandleFunc("/invitations/accept", h.getAcceptInvitation).Methods("GET")
+	r.HandleFunc("/invitations/accept", h.postAcceptInvitation).Methods("POST")
+}
+
+// defaultOrganizationID is the organization new sessions start in, nil when the user has none
+func (h *handler) defaultOrganizationID(ctx context.Context, user *domain.User) *int {
+	if h.orgService == nil {
+		return nil
+	}
+
+	organization, err := h.orgService.DefaultOrganization(ctx, user.ID)
+	if err != nil {
+		h.log.Error().Err(err).Sendf("failed to find the default organization of user %d", user.ID)
+		return nil
+	}
+
+	if organization == nil {
+		return nil
+	}
+
+	return &organization.ID
+}
+
+// currentOrganization is the organization of the session while the user is still a member of it
+func (h *handler) currentOrganization(ctx context.Context, user *domain.User, session *domain.Session) *domain.UserOrganization {
+	if h.orgService == nil || session == nil || session.OrganizationID == nil {
+		return nil
+	}
+
+	organization, err := h.orgService.Membership(ctx, *session.OrganizationID, user.ID)
+	if err != nil {
+		if _, ok := errors.NotFoundCast(err); !ok {
+			h.log.Error().Err(err).Sendf("failed to find the current organization of session %d", session.ID)
+		}
+		return nil
+	}
+
+	return organization
+}
+
+func (h *handler) loadOrganizations(ctx context.Context, prof *profile, user *domain.User, session *domain.Session) {
+	if h.orgService == nil {
+		return
+	}
+
+	organizations, err := h.orgService.List(ctx, user.ID)
+	if err != nil {
+		h.log.Error().Err(err).Sendf("failed to list organizations")
+		return
+	}
+
+	prof.OrganizationsEnabled = true
+	prof.Organizations = organizations
+	prof.Profile.Organization = h.currentOrganization(ctx, user, session)
+}
+
+func (h *handler) postCreateOrganization(w http.ResponseWriter, r *http.Request) {
+	user, session, ok := h.currentSession(w, r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	organization, err := h.orgService.Create(r.Context(), user, r.FormValue("name"))
+	if err != nil {
+		if describer, ok := errors.InvalidArgumentCast(err); ok {
+			w.WriteHeader(http.StatusBadRequest)
+			h.writeProfile(w, r, user, session, map[string]string{"Organizations": describer.GetMessage()})
+			return
+		}
+
+		h.writeOrganizationError(w, err)
+		return
+	}
+
+	if err := h.sessionService.SetOrganization(r.Context(), session, &organization.ID); err != nil {
+		h.writeOrganizationError(w, err)
+		return
+	}
+
+	h.redirectToOrganization(w, r, organization.ID, "created")
+}
+
+// postSwitchOrganization changes the current organization of the session, an empty id leaves the
+// session without organization
+func (h *handler) postSwitchOrganization(w http.ResponseWriter, r *http.Request) {
+	user, session, ok := h.currentSession(w, r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	var organizationID *int
+	if value := r.FormValue("organization_id"); value != "" {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if _, err := h.orgService.Membership(r.Context(), id, user.ID); err != nil {
+			h.writeOrganizationError(w, err)
+			return
+		}
+		organizationID = &id
+	}
+
+	if err := h.sessionService.SetOrganization(r.Context(), session, organizationID); err != nil {
+		h.writeOrganizationError(w, err)
+		return
+	}
+
+	http.Redirect(w, r, "/profile", http.StatusSeeOther)
+}
+
+func (h *handler) getOrganization(w http.ResponseWriter, r *http.Request) {
+	user, _, ok := h.currentSession(w, r)
+	if !ok {
+		if err := h.setReturnTo(w, r, r.URL.RequestURI()); err != nil {
+			h.log.Error().Err(err).Sendf("failed to remember the organization page")
+		}
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	organizationID, ok := organizationIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	organization, err := h.orgService.Membership(ctx, organizationID, user.ID)
+	if err != nil {
+		h.writeOrganizationError(w, err)
+		return
+	}
+
+	members, err := h.orgService.Members(ctx, user, organizationID)
+	if err != nil {
+		h.writeOrganizationError(w, err)
+		return
+	}
+
+	page := organizationPage{
+		Organization:  organization,
+		Members:       members,
+		CurrentUserID: user.ID,
+		CanManage:     organization.Role.CanManageMembers(),
+		IsOwner:       organization.Role == domain.OrgRoleOwner,
+		Message:       orgDoneMessages[r.URL.Query().Get("done")],
+	}
+
+	if page.CanManage {
+		if page.Invitations, err = h.orgService.Invitations(ctx, user, organizationID); err != nil {
+			h.writeOrganizationError(w, err)
+			return
+		}
+
+		page.InvitableRoles = []domain.OrgRole{domain.OrgRoleMember}
+		if page.IsOwner {
+			page.InvitableRoles = domain.OrgRoles
+		}
+	}
+
+	h.writeTemplate(w, "organization", page)
+}
+
+func (h *handler) postInvite(w http.ResponseWriter, r *http.Request) {
+	h.organizationAction(w, r, "invited", func(ctx context.Context, user *domain.User, organizationID int) error {
+		_, err := h.orgService.Invite(ctx, user, organizationID, r.FormValue("email"), domain.OrgRole(r.FormValue("role")))
+		return err
+	})
+}
+
+func (h *handler) postRevokeInvitation(w http.ResponseWriter, r *http.Request) {
+	h.organizationAction(w, r, "revoked", func(ctx context.Context, user *domain.User, organizationID int) error {
+		invitationID, err := strconv.Atoi(r.FormValue("invitation_id"))
+		if err != nil {
+			return ErrInvalidBodyRequest
+		}
+
+		return h.orgService.RevokeInvitation(ctx, user, organizationID, invitationID)
+	})
+}
+
+// postRemoveMember removes a member, members leaving the organization are sent to their profile
+func (h *handler) postRemoveMember(w http.ResponseWriter, r *http.Request) {
+	user, session, ok := h.currentSession(w, r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	organizationID, ok := organizationIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	userID, err := strconv.Atoi(r.FormValue("user_id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := h.orgService.RemoveMember(r.Context(), user, organizationID, userID); err != nil {
+		h.writeOrganizationError(w, err)
+		return
+	}
+
+	if userID != user.ID {
+		h.redirectToOrganization(w, r, organizationID, "removed")
+		return
+	}
+
+	if session.OrganizationID != nil && *session.OrganizationID == organizationID {
+		if err := h.sessionService.SetOrganization(r.Context(), session, h.defaultOrganizationID(r.Context(), user)); err != nil {
+			h.log.Error().Err(err).Sendf("failed to switch the organization of session %d", session.ID)
+		}
+	}
+
+	http.Redirect(w, r, "/profile", http.StatusSeeOther)
+}
+
+func (h *handler) postTransferOwnership(w http.ResponseWriter, r *http.Request) {
+	h.organizationAction(w, r, "transferred", func(ctx context.Context, user *domain.User, organizationID int) error {
+		userID, err := strconv.Atoi(r.FormValue("user_id"))
+		if err != nil {
+			return ErrInvalidBodyRequest
+		}
+
+		return h.orgService.TransferOwnership(ctx, user, organizationID, userID)
+	})
+}
+
+// getAcceptInvitation shows the invitation of the link. Users not signed in are sent back here
+// once they logged in or signed up.
+func (h *handler) getAcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+
+	invitation, organization, err := h.orgService.Invitation(r.Context(), token)
+	if err != nil {
+		h.writeOrganizationError(w, err)
+		return
+	}
+
+	page := invitationPage{Invitation: invitation, Organization: organization, Token: token}
+
+	user, _, ok := h.currentSession(w, r)
+	if !ok {
+		if err := h.setReturnTo(w, r, r.URL.RequestURI()); err != nil {
+			h.log.Error().Err(err).Sendf("failed to remember the invitation")
+		}
+	} else {
+		page.User = user
+	}
+
+	h.writeTemplate(w, "invitation", page)
+}
+
+// postAcceptInvitation makes the user a member and switches the session to the organization
+func (h *handler) postAcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	user, session, ok := h.currentSession(w, r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	token := r.FormValue("token")
+	organization, err := h.orgService.AcceptInvitation(r.Context(), user, token)
+	if err != nil {
+		if describer, ok := errors.RuleNotSatisfiedCast(err); ok && describer.GetCode() == domain.ErrInvitationEmail {
+			invitation, org, err := h.orgService.Invitation(r.Context(), token)
+			if err == nil {
+				w.WriteHeader(http.StatusForbidden)
+				h.writeTemplate(w, "invitation", invitationPage{Invitation: invitation, Organization: org, Token: token, User: user, Error: describer.GetMessage()})
+				return
+			}
+		}
+
+		h.writeOrganizationError(w, err)
+		return
+	}
+
+	if err := h.sessionService.SetOrganization(r.Context(), session, &organization.ID); err != nil {
+		h.log.Error().Err(err).Sendf("failed to switch the organization of session %d", session.ID)
+	}
+
+	h.redirectToOrganization(w, r, organization.ID, "joined")
+}
+
+// organizationAction runs the action of the signed in user on the organization of the path and goes
+// back to its page
+func (h *handler) organizationAction(w http.ResponseWriter, r *http.Request, done string, action func(ctx context.Context, user *domain.User, organizationID int) error) {
+	user, _, ok := h.currentSession(w, r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	organizationID, ok := organizationIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	if err := action(r.Context(), user, organizationID); err != nil {
+		h.writeOrganizationError(w, err)
+		return
+	}
+
+	h.redirectToOrganization(w, r, organizationID, done)
+}
+
+func (h *handler) redirectToOrganization(w http.ResponseWriter, r *http.Request, organizationID int, done string) {
+	redirect := "/organizations/" + strconv.Itoa(organizationID) + "?" + url.Values{"done": {done}}.Encode()
+	http.Redirect(w, r, redirect, http.StatusSeeOther)
+}
+
+func organizationIDParam(w http.ResponseWriter, r *http.Request) (int, bool) {
+	organizationID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return 0, false
+	}
+
+	return organizationID, true
+}
+
+// writeOrganizationError renders the message of the error with the status the API would answer
+func (h *handler) writeOrganizationError(w http.ResponseWriter, err error) {
+	status := statusFromError(err)
+	message := http.StatusText(status)
+	if describer, ok := errors.DescriberCast(err); ok && describer.GetMessage() != "" {
+		message = describer.GetMessage()
+	}
+
+	if status == http.StatusInternalServerError {
+		h.log.Error().Err(err).Sendf("organization request failed: %v", err)
+	}
+
+	w.WriteHeader(status)
+	h.writeTemplate(w, "organization_error", organizationErrorPage{Message: message})
+}
@@ -0,0 +1,162 @@
+package http_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+)
+
+var (
+	invitationLink = regexp.MustCompile(`https?://\S+/invitations/accept\?token=[\w.-]+`)
+	organizationID = regexp.MustCompile(`^/organizations/(\d+)$`)
+)
+
+// createOrganization creates an organization from the profile page and returns its id
+func (ts *testServer) createOrganization(t *testing.T, browser *http.Client, name string) int {
+	p := ts.post(t, browser, "/organizations", url.Values{"name": {name}})
+	require.Equal(t, http.StatusOK, p.status, p.body)
+
+	match := organizationID.FindStringSubmatch(p.path)
+	require.Len(t, match, 2, "the new organization is shown")
+	assert.Contains(t, p.body, "The organization was created")
+
+	id, err := strconv.Atoi(match[1])
+	require.NoError(t, err)
+	return id
+}
+
+// invite sends an invitation and returns the path of its link
+func (ts *testServer) invite(t *testing.T, browser *http.Client, organizationID int, email string, role domain.OrgRole) string {
+	p := ts.post(t, browser, "/organizations/"+strconv.Itoa(organizationID)+"/invitations", url.Values{"email": {email}, "role": {string(role)}})
+	require.Equal(t, http.StatusOK, p.status, p.body)
+	assert.Contains(t, p.body, "The invitation was sent")
+
+	link := invitationLink.FindString(ts.lastEmail(t, email).Text)
+	require.NotEmpty(t, link, "the invitation email has the link")
+	return strings.TrimPrefix(link, ts.URL)
+}
+
+// apiLogin signs in through the JSON API
+func (ts *testServer) apiLogin(t *testing.T, email, password string) (domain.Profile, *domain.AccessClaims) {
+	body, err := json.Marshal(map[string]string{"email": email, "password": password})
+	require.NoError(t, err)
+
+	resp, err := http.Post(ts.URL+"/api/v1/login", "application/json", bytes.NewReader(body))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var auth struct {
+		Profile     domain.Profile `json:"profile"`
+		AccessToken string         `json:"access_token"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&auth))
+
+	claims, err := ts.tokens.VerifyAccessToken(auth.AccessToken)
+	require.NoError(t, err)
+	return auth.Profile, claims
+}
+
+func TestHandler_Organizations(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	owner := newBrowser(t)
+	ts.signup(t, owner, "owner@example.com", "secret-password")
+	acme := ts.createOrganization(t, owner, "Acme")
+
+	p := ts.get(t, owner, "/profile")
+	assert.Contains(t, p.body, "Acme")
+
+	link := ts.invite(t, owner, acme, "member@example.com", domain.OrgRoleMember)
+	p = ts.get(t, owner, "/organizations/"+strconv.Itoa(acme))
+	assert.Contains(t, p.body, "member@example.com", "the pending invitation is listed")
+
+	member := newBrowser(t)
+	p = ts.get(t, member, link)
+	require.Equal(t, http.StatusOK, p.status, p.body)
+	assert.Contains(t, p.body, "You are invited to join <strong>Acme</strong> as member")
+
+	p = ts.post(t, member, "/signup", url.Values{"email": {"member@example.com"}, "password": {"secret-password"}})
+	require.Equal(t, "/invitations/accept", p.path, "the signup comes back to the invitation")
+	assert.Contains(t, p.body, "Join Acme")
+
+	token, err := url.Parse(link)
+	require.NoError(t, err)
+	p = ts.post(t, member, "/invitations/accept", url.Values{"token": {token.Query().Get("token")}})
+	require.Equal(t, http.StatusOK, p.status, p.body)
+	assert.Equal(t, "/organizations/"+strconv.Itoa(acme), p.path)
+	assert.Contains(t, p.body, "Welcome, you joined the organization.")
+	assert.NotContains(t, p.body, "INVITATIONS", "members do not manage the organization")
+
+	p = ts.post(t, member, "/invitations/accept", url.Values{"token": {token.Query().Get("token")}})
+	assert.Equal(t, http.StatusBadRequest, p.status, "the invitation is accepted once")
+
+	profile, claims := ts.apiLogin(t, "member@example.com", "secret-password")
+	require.NotNil(t, profile.Organization, "new sessions start in the organization")
+	assert.Equal(t, "Acme", profile.Organization.Name)
+	assert.Equal(t, domain.OrgRoleMember, profile.Organization.Role)
+	assert.Equal(t, acme, claims.OrganizationID)
+	assert.Equal(t, domain.OrgRoleMember, claims.OrganizationRole)
+
+	memberUser, err := ts.users.FindByEmail(context.Background(), "member@example.com")
+	require.NoError(t, err)
+
+	p = ts.post(t, member, "/organizations/"+strconv.Itoa(acme)+"/transfer", url.Values{"user_id": {strconv.Itoa(memberUser.ID)}})
+	assert.Equal(t, http.StatusForbidden, p.status, "only the owner transfers the ownership")
+
+	p = ts.post(t, owner, "/organizations/"+strconv.Itoa(acme)+"/transfer", url.Values{"user_id": {strconv.Itoa(memberUser.ID)}})
+	require.Equal(t, http.StatusOK, p.status, p.body)
+	assert.Contains(t, p.body, "you are now an admin")
+
+	_, claims = ts.apiLogin(t, "member@example.com", "secret-password")
+	assert.Equal(t, domain.OrgRoleOwner, claims.OrganizationRole)
+
+	ownerUser, err := ts.users.FindByEmail(context.Background(), "owner@example.com")
+	require.NoError(t, err)
+	p = ts.post(t, member, "/organizations/"+strconv.Itoa(acme)+"/members/remove", url.Values{"user_id": {strconv.Itoa(ownerUser.ID)}})
+	require.Equal(t, http.StatusOK, p.status, p.body)
+	assert.Contains(t, p.body, "The member was removed.")
+
+	p = ts.get(t, owner, "/organizations/"+strconv.Itoa(acme))
+	assert.Equal(t, http.StatusNotFound, p.status, "removed members lose access")
+
+	_, claims = ts.apiLogin(t, "owner@example.com", "secret-password")
+	assert.Zero(t, claims.OrganizationID)
+}
+
+func TestHandler_OrganizationInvitationEmailMismatch(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	owner := newBrowser(t)
+	ts.signup(t, owner, "owner@example.com", "secret-password")
+	acme := ts.createOrganization(t, owner, "Acme")
+	link := ts.invite(t, owner, acme, "invited@example.com", domain.OrgRoleMember)
+
+	other := newBrowser(t)
+	ts.signup(t, other, "other@example.com", "secret-password")
+
+	token, err := url.Parse(link)
+	require.NoError(t, err)
+	p := ts.post(t, other, "/invitations/accept", url.Values{"token": {token.Query().Get("token")}})
+	assert.Equal(t, http.StatusForbidden, p.status)
+	assert.Contains(t, p.body, "invited@example.com", "the page tells which account to use")
+
+	p = ts.get(t, other, "/organizations/"+strconv.Itoa(acme))
+	assert.Equal(t, http.StatusNotFound, p.status)
+
+	p = ts.get(t, other, "/invitations/accept?token=forged")
+	assert.Equal(t, http.StatusBadRequest, p.status)
+}
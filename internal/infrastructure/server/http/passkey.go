@@ -0,0 +1,201 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/pkg/webauthn"
+)
+
+type passkeyRegistrationRequest struct {
+	Name       string                        `json:"name"`
+	Credential webauthn.RegistrationResponse `json:"credential"`
+}
+
+type passkeyLoginRequest struct {
+	Credential webauthn.AssertionResponse `json:"credential"`
+}
+
+type passkeyLoginResponse struct {
+	Redirect string `json:"redirect"`
+}
+
+func (h *handler) loadPasskeys(ctx context.Context, prof *profile, userID int) {
+	passkeys, err := h.webAuthnService.List(ctx, userID)
+	if err != nil {
+		h.log.Error().Err(err).Sendf("failed to list passkeys")
+		return
+	}
+
+	prof.Passkeys = passkeys
+}
+
+// setPasskeyNonce keeps the nonce of the ceremony in a short lived cookie until the browser returns
+// the authenticator response, the challenge itself stays on the server
+func (h *handler) setPasskeyNonce(w http.ResponseWriter, r *http.Request, nonce string) error {
+	options := *defaultSessionOptions
+	options.MaxAge = int(webauthn.Timeout.Seconds())
+
+	return h.getSessionAndSetCookie(w, r, nonce, passkeySession, passkeyCookie, &options)
+}
+
+// popPasskeyNonce returns the nonce of the ceremony and clears the cookie, the service takes the
+// challenge of the nonce so a copy of the cookie is useless once the ceremony is finished
+func (h *handler) popPasskeyNonce(w http.ResponseWriter, r *http.Request) string {
+	session, err := h.store.Get(r, passkeySession)
+	if err != nil {
+		return ""
+	}
+
+	nonce, _ := session.Values[passkeyCookie].(string)
+
+	deleteOptions := *defaultSessionOptions
+	deleteOptions.MaxAge = -1
+	_ = h.getSessionAndSetCookie(w, r, "", passkeySession, passkeyCookie, &deleteOptions)
+
+	return nonce
+}
+
+func (h *handler) postPasskeyRegisterBegin(w http.ResponseWriter, r *http.Request) {
+	user, _, ok := h.currentSession(w, r)
+	if !ok {
+		h.writeError(w, ErrNotAuthorizedRequest)
+		return
+	}
+
+	options, nonce, err := h.webAuthnService.BeginRegistration(r.Context(), user)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	if err := h.setPasskeyNonce(w, r, nonce); err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, options)
+}
+
+func (h *handler) postPasskeyRegisterFinish(w http.ResponseWriter, r *http.Request) {
+	user, _, ok := h.currentSession(w, r)
+	if !ok {
+		h.writeError(w, ErrNotAuthorizedRequest)
+		return
+	}
+
+	var req passkeyRegistrationRequest
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+
+	nonce := h.popPasskeyNonce(w, r)
+	credential, err := h.webAuthnService.FinishRegistration(r.Context(), user, nonce, req.Name, &req.Credential)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	h.writeJSON(w, http.StatusCreated, credential)
+}
+
+func (h *handler) postPasskeyLoginBegin(w http.ResponseWriter, r *http.Request) {
+	options, nonce, err := h.webAuthnService.BeginLogin(r.Context())
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	if err := h.setPasskeyNonce(w, r, nonce); err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, options)
+}
+
+// postPasskeyLoginFinish starts the session right away, passkeys require user verification on the
+// authenticator so they are not followed by the TOTP step. The failed assertions count against the
+// login attempts of the address like wrong passwords.
+func (h *handler) postPasskeyLoginFinish(w http.ResponseWriter, r *http.Request) {
+	var req passkeyLoginRequest
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+
+	ctx := r.Context()
+	ip := domain.ThrottleIP(clientIP(r))
+	if err := h.allowAttempt(ctx, domain.ThrottleLogin, ip); err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	nonce := h.popPasskeyNonce(w, r)
+	user, err := h.webAuthnService.FinishLogin(ctx, nonce, &req.Credential)
+	if err != nil {
+		h.recordAttempt(ctx, domain.ThrottleLogin, ip)
+		h.audit(r, domain.AuditLoginFailed, nil, nil, nil)
+		h.writeError(w, err)
+		return
+	}
+
+	if err := h.loginPolicy(user); err != nil {
+		h.audit(r, domain.AuditLoginFailed, nil, user, nil)
+		h.writeError(w, err)
+		return
+	}
+
+	if err := h.startSession(w, r, user); err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	h.audit(r, domain.AuditLoginSucceeded, user, user, nil)
+	h.writeJSON(w, http.StatusOK, passkeyLoginResponse{Redirect: h.popReturnTo(w, r)})
+}
+
+func (h *handler) postRenamePasskey(w http.ResponseWriter, r *http.Request) {
+	user, _, ok := h.currentSession(w, r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	passkeyID, err := strconv.Atoi(r.FormValue("passkey_id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := h.webAuthnService.Rename(r.Context(), user.ID, passkeyID, r.FormValue("name")); err != nil {
+		h.log.Error().Err(err).Sendf("failed to rename passkey")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/profile", http.StatusSeeOther)
+}
+
+func (h *handler) postDeletePasskey(w http.ResponseWriter, r *http.Request) {
+	user, _, ok := h.currentSession(w, r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	passkeyID, err := strconv.Atoi(r.FormValue("passkey_id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := h.webAuthnService.Delete(r.Context(), user.ID, passkeyID); err != nil {
+		h.log.Error().Err(err).Sendf("failed to delete passkey")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/profile", http.StatusSeeOther)
+}
@@ -2,9 +2,9 @@ package http
 
 import (
 	"net/http"
-	"strings"
 
 	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/pkg/errors"
 )
 
 func (h *handler) getForgotPassword(w http.ResponseWriter, r *http.Request) {
@@ -21,6 +21,13 @@ func (h *handler) postForgotPassword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	keys := []domain.ThrottleKey{domain.ThrottleEmail(authUser.Email), domain.ThrottleIP(clientIP(r))}
+	if err := h.allowAttempt(ctx, domain.ThrottleForgotPassword, keys...); err != nil {
+		h.writeTooManyAttempts(w, "forgot_password", authUser)
+		return
+	}
+	h.recordAttempt(ctx, domain.ThrottleForgotPassword, keys...)
+
 	token, err := h.authService.SetUserRecoveryToken(ctx, authUser.Email)
 	if err != nil {
 		w.WriteHeader(http.StatusOK)
@@ -30,7 +37,8 @@ func (h *handler) postForgotPassword(w http.ResponseWriter, r *http.Request) {
 
 	authUser.RecoveryToken = token
 
-	go h.authService.SendResetPasswordLink(ctx, authUser)
+	h.authService.SendResetPasswordLink(ctx, authUser)
+	h.auditByEmail(r, domain.AuditPasswordResetRequested, authUser.Email)
 
 	h.writeTemplate(w, "email_sent", nil)
 }
@@ -64,37 +72,24 @@ func (h *handler) postNewPassword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token := r.FormValue("token")
-	if strings.TrimSpace(token) == "" {
-		w.WriteHeader(http.StatusBadRequest)
-		reply.Errors["Link"] = "invalid link"
-		h.writeTemplate(w, "new_password", reply)
-		return
-	}
-
-	user, err := h.userService.FindByRecoveryToken(ctx, token)
+	user, err := h.authService.ResetPassword(ctx, r.FormValue("token"), authUser.Password)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		reply.Errors["Link"] = "invalid link"
-		h.writeTemplate(w, "new_password", reply)
-		return
-	}
-
-	if user == nil {
-		w.WriteHeader(http.StatusBadRequest)
-		reply.Errors["Link"] = "invalid link"
-		h.writeTemplate(w, "new_password", reply)
-		return
-	}
-
-	if err := h.authService.SetNewPassword(ctx, user, authUser.Password); err != nil {
-		h.log.Error().Err(err)
+		if _, ok := errors.InvalidArgumentCast(err); ok {
+			w.WriteHeader(http.StatusBadRequest)
+			reply.Errors["Link"] = "invalid or expired link"
+			h.writeTemplate(w, "new_password", reply)
+			return
+		}
+
+		h.log.Error().Err(err).Sendf("failed to reset password: %v", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		reply.Errors["Link"] = "failed to change password"
 		h.writeTemplate(w, "new_password", reply)
 		return
 	}
 
+	h.audit(r, domain.AuditPasswordResetCompleted, user, user, nil)
+
 	reply.Errors = nil
 	reply.Message = "password changed"
 	h.writeTemplate(w, "new_password", reply)
@@ -9,28 +9,45 @@ import (
 )
 
 func (h *handler) getProfile(w http.ResponseWriter, r *http.Request) {
-	user, ok := h.alreadyLoggedIn(w, r)
+	user, session, ok := h.currentSession(w, r)
 	if !ok {
 		http.Redirect(w, r, "/login", http.StatusSeeOther)
 		return
 	}
 
+	h.writeProfile(w, r, user, session, nil)
+}
+
+// writeProfile renders the profile page of the user with the security settings of the account
+func (h *handler) writeProfile(w http.ResponseWriter, r *http.Request, user *domain.User, session *domain.Session, errs map[string]string) {
+	h.writeTemplate(w, "profile", h.newProfile(r, user, session, errs))
+}
+
+func (h *handler) newProfile(r *http.Request, user *domain.User, session *domain.Session, errs map[string]string) profile {
+	if errs == nil {
+		errs = make(map[string]string)
+	}
+
 	prof := profile{
-		Profile: domain.Profile{
-			ID:      user.ID,
-			Email:   user.Email,
-			Address: user.Address,
-			Phone:   user.Phone,
-			Name:    user.Name,
-		},
-		Errors: make(map[string]string),
+		Profile:         profileFromUser(user),
+		MFAEnabled:      user.TOTPEnabled,
+		EmailVerified:   user.EmailVerified(),
+		EditAllowed:     h.authService.EmailVerificationPolicy().AllowsProfileEdit(user),
+		AuditLogEnabled: h.auditService != nil,
+		Errors:          errs,
 	}
 
-	h.writeTemplate(w, "profile", prof)
+	h.loadSessions(r.Context(), &prof, session)
+	h.loadPasskeys(r.Context(), &prof, user.ID)
+	h.loadIdentities(r.Context(), &prof, user.ID)
+	h.loadAPIKeys(r.Context(), &prof, user.ID)
+	h.loadOrganizations(r.Context(), &prof, user, session)
+
+	return prof
 }
 
 func (h *handler) postProfile(w http.ResponseWriter, r *http.Request) {
-	user, ok := h.alreadyLoggedIn(w, r)
+	user, session, ok := h.currentSession(w, r)
 	if !ok {
 		http.Redirect(w, r, "/login", http.StatusSeeOther)
 		return
@@ -61,10 +78,14 @@ func (h *handler) postProfile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user.Name = userProfile.Name
-	user.Email = userProfile.Email
-	user.Address = userProfile.Address
-	user.Phone = userProfile.Phone
+	if !h.authService.EmailVerificationPolicy().AllowsProfileEdit(user) {
+		w.WriteHeader(http.StatusForbidden)
+		h.writeProfile(w, r, user, session, map[string]string{"Credentials": "please verify your email before editing your profile"})
+		return
+	}
+
+	before := *user
+	emailChanged := setProfile(user, userProfile.Profile)
 
 	if err := h.userService.Update(ctx, user); err != nil {
 		h.log.Error().Err(err).Sendf("failed to update user profile")
@@ -72,7 +93,29 @@ func (h *handler) postProfile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	h.writeTemplate(w, "profile", userProfile)
+	h.auditUserChanges(r, user, &before, user)
+
+	if emailChanged {
+		h.sendVerificationEmail(ctx, user)
+	}
+
+	h.writeProfile(w, r, user, session, nil)
+}
+
+// setProfile copies the profile to the user, a new email has to be verified again
+func setProfile(user *domain.User, p domain.Profile) bool {
+	emailChanged := user.Email != p.Email
+
+	user.Name = p.Name
+	user.Email = p.Email
+	user.Address = p.Address
+	user.Phone = p.Phone
+
+	if emailChanged {
+		user.EmailVerifiedAt = nil
+	}
+
+	return emailChanged
 }
 
 func (h *handler) getAddressSuggestion(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,317 @@
+package http
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/sessions"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/pkg/errors"
+	"gitlab.com/evzpav/user-auth/pkg/oidc"
+)
+
+// providerSession keeps the state of a login at a provider until it redirects back
+const providerSession string = "provider_session"
+
+const (
+	providerNameValue     = "provider"
+	providerStateValue    = "state"
+	providerNonceValue    = "nonce"
+	providerVerifierValue = "code_verifier"
+	providerIntentValue   = "intent"
+	providerNextValue     = "next"
+)
+
+// intents of a provider login other than signing in, both need a signed in user
+const (
+	linkIntent   = "link"
+	reauthIntent = "reauth"
+)
+
+// providerLoginLength is the time users have to sign in at the provider
+const providerLoginLength int = 10 * 60
+
+// loginPage is the data of the login template
+type loginPage struct {
+	*domain.AuthUser
+	Providers []domain.LoginProvider
+}
+
+// writeLogin renders the login page with the buttons of the login providers
+func (h *handler) writeLogin(w http.ResponseWriter, authUser *domain.AuthUser) {
+	if authUser == nil {
+		authUser = domain.NewAuthUser("", "")
+	}
+
+	h.writeTemplate(w, "login", loginPage{
+		AuthUser:  authUser,
+		Providers: h.authService.LoginProviders(),
+	})
+}
+
+// writeLoginError renders the login page with the message of a failed provider login
+func (h *handler) writeLoginError(w http.ResponseWriter, status int, message string) {
+	authUser := domain.NewAuthUser("", "")
+	authUser.Errors["Credentials"] = message
+	w.WriteHeader(status)
+	h.writeLogin(w, authUser)
+}
+
+// getLoginProvider redirects to the provider to sign in, or with the intent query parameter to
+// link the account to the signed in user or to reauthenticate them
+func (h *handler) getLoginProvider(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	intent := query.Get("intent")
+	next := ""
+
+	switch intent {
+	case "":
+		if _, ok := h.alreadyLoggedIn(w, r); ok {
+			http.Redirect(w, r, "/profile", http.StatusSeeOther)
+			return
+		}
+	case linkIntent, reauthIntent:
+		user, session, ok := h.currentSession(w, r)
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+
+		if intent == linkIntent && !h.recentlyReauthenticated(r, user, session) {
+			http.Redirect(w, r, reauthURL(r.URL.RequestURI()), http.StatusSeeOther)
+			return
+		}
+
+		next = safeNext(query.Get("next"))
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	provider := mux.Vars(r)["provider"]
+	state := h.authService.GenerateToken()
+
+	nonce, err := oidc.NewNonce()
+	if err != nil {
+		h.log.Error().Err(err).Sendf("failed to generate nonce")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	codeVerifier, err := oidc.NewCodeVerifier()
+	if err != nil {
+		h.log.Error().Err(err).Sendf("failed to generate code verifier")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	authURL, err := h.authService.LoginProviderURL(r.Context(), provider, state, nonce, codeVerifier)
+	if err != nil {
+		if _, ok := errors.NotFoundCast(err); ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		h.log.Error().Err(err).Sendf("failed to get the login url of %s", provider)
+		h.writeLoginError(w, http.StatusBadGateway, "failed to sign in with the provider")
+		return
+	}
+
+	session, err := h.store.Get(r, providerSession)
+	if err != nil {
+		h.log.Info().Err(err).Sendf("failed to get provider session")
+	}
+
+	session.Options = &sessions.Options{
+		Path:     "/",
+		HttpOnly: true,
+		MaxAge:   providerLoginLength,
+	}
+	session.Values[providerNameValue] = provider
+	session.Values[providerStateValue] = state
+	session.Values[providerNonceValue] = nonce
+	session.Values[providerVerifierValue] = codeVerifier
+	session.Values[providerIntentValue] = intent
+	session.Values[providerNextValue] = next
+
+	if err := session.Save(r, w); err != nil {
+		h.log.Error().Err(err).Sendf("failed to save provider session")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, authURL, http.StatusTemporaryRedirect)
+}
+
+func (h *handler) getLoginProviderCallback(w http.ResponseWriter, r *http.Request) {
+	h.loginProviderCallback(w, r, mux.Vars(r)["provider"])
+}
+
+// googleAuth is the callback registered at Google before the providers were configurable
+func (h *handler) googleAuth(w http.ResponseWriter, r *http.Request) {
+	h.loginProviderCallback(w, r, "google")
+}
+
+// providerLogin is the state of a login at a provider kept in the provider session
+type providerLogin struct {
+	name         string
+	state        string
+	nonce        string
+	codeVerifier string
+	intent       string
+	next         string
+}
+
+// popProviderLogin returns the state of the login and clears it, it is used once also when the
+// provider reports an error
+func (h *handler) popProviderLogin(w http.ResponseWriter, r *http.Request) providerLogin {
+	session, err := h.store.Get(r, providerSession)
+	if err != nil {
+		h.log.Info().Err(err).Sendf("failed to get provider session")
+	}
+
+	var login providerLogin
+	login.name, _ = session.Values[providerNameValue].(string)
+	login.state, _ = session.Values[providerStateValue].(string)
+	login.nonce, _ = session.Values[providerNonceValue].(string)
+	login.codeVerifier, _ = session.Values[providerVerifierValue].(string)
+	login.intent, _ = session.Values[providerIntentValue].(string)
+	login.next, _ = session.Values[providerNextValue].(string)
+
+	session.Options = &sessions.Options{Path: "/", HttpOnly: true, MaxAge: -1}
+	session.Values = make(map[interface{}]interface{})
+	if err := session.Save(r, w); err != nil {
+		h.log.Error().Err(err).Sendf("failed to clear provider session")
+	}
+
+	return login
+}
+
+// providerErrorMessage returns the message of the error for the user, unexpected errors are logged
+func (h *handler) providerErrorMessage(err error, provider string) string {
+	if describer, ok := errors.DescriberCast(err); ok && describer.GetMessage() != "" {
+		return describer.GetMessage()
+	}
+
+	h.log.Error().Err(err).Sendf("failed to sign in with %s", provider)
+	return "failed to sign in with the provider"
+}
+
+func (h *handler) loginProviderCallback(w http.ResponseWriter, r *http.Request, provider string) {
+	login := h.popProviderLogin(w, r)
+
+	if login.intent != "" {
+		h.identityProviderCallback(w, r, provider, login)
+		return
+	}
+
+	if _, ok := h.alreadyLoggedIn(w, r); ok {
+		http.Redirect(w, r, "/profile", http.StatusSeeOther)
+		return
+	}
+
+	query := r.URL.Query()
+	if !validProviderCallback(login, provider, query.Get("state")) {
+		h.log.Info().Sendf("invalid login state of %s", provider)
+		h.writeLoginError(w, http.StatusBadRequest, "invalid or expired login, please try again")
+		return
+	}
+
+	if providerErr := query.Get("error"); providerErr != "" {
+		h.log.Info().Sendf("%s login failed: %s", provider, providerErr)
+		h.audit(r, domain.AuditLoginFailed, nil, nil, nil)
+		h.writeLoginError(w, http.StatusUnauthorized, "sign in with the provider was canceled")
+		return
+	}
+
+	result, err := h.authService.LoginWithProvider(r.Context(), provider, query.Get("code"), login.nonce, login.codeVerifier)
+	if err != nil {
+		// the account at the provider is not trusted, the event has no user
+		h.audit(r, domain.AuditLoginFailed, nil, nil, nil)
+		h.writeLoginError(w, statusFromError(err), h.providerErrorMessage(err, provider))
+		return
+	}
+
+	if result.SignedUp {
+		h.audit(r, domain.AuditSignup, result.User, result.User, nil)
+	}
+
+	if result.Linked != nil {
+		h.auditProviderLinked(r, result.User, result.Linked)
+	}
+
+	if err := h.completeLogin(w, r, result.User); err != nil {
+		h.writeLoginError(w, http.StatusUnauthorized, "failed to sign in with the provider")
+		return
+	}
+}
+
+func validProviderCallback(login providerLogin, provider, state string) bool {
+	return login.state != "" && login.name == provider && subtle.ConstantTimeCompare([]byte(login.state), []byte(state)) == 1
+}
+
+// identityProviderCallback links the account to the signed in user or reauthenticates them,
+// failures are shown on the profile page
+func (h *handler) identityProviderCallback(w http.ResponseWriter, r *http.Request, provider string, login providerLogin) {
+	user, session, ok := h.currentSession(w, r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	writeError := func(status int, message string) {
+		w.WriteHeader(status)
+		h.writeProfile(w, r, user, session, map[string]string{"Identities": message})
+	}
+
+	query := r.URL.Query()
+	if !validProviderCallback(login, provider, query.Get("state")) {
+		h.log.Info().Sendf("invalid %s state of %s", login.intent, provider)
+		writeError(http.StatusBadRequest, "invalid or expired login, please try again")
+		return
+	}
+
+	if providerErr := query.Get("error"); providerErr != "" {
+		h.log.Info().Sendf("%s %s failed: %s", provider, login.intent, providerErr)
+		writeError(http.StatusUnauthorized, "sign in with the provider was canceled")
+		return
+	}
+
+	ctx := r.Context()
+	code := query.Get("code")
+
+	switch login.intent {
+	case linkIntent:
+		if !h.recentlyReauthenticated(r, user, session) {
+			writeError(http.StatusUnauthorized, "confirm it is you before linking an account")
+			return
+		}
+
+		identity, err := h.authService.LinkProvider(ctx, user, provider, code, login.nonce, login.codeVerifier)
+		if err != nil {
+			writeError(statusFromError(err), h.providerErrorMessage(err, provider))
+			return
+		}
+
+		h.auditProviderLinked(r, user, identity)
+
+		http.Redirect(w, r, "/profile", http.StatusSeeOther)
+	case reauthIntent:
+		if err := h.authService.ReauthenticateWithProvider(ctx, user, provider, code, login.nonce, login.codeVerifier); err != nil {
+			writeError(statusFromError(err), h.providerErrorMessage(err, provider))
+			return
+		}
+
+		if err := h.setReauthenticated(w, r, user, session); err != nil {
+			h.log.Error().Err(err).Sendf("failed to save reauth session")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		http.Redirect(w, r, safeNext(login.next), http.StatusSeeOther)
+	default:
+		writeError(http.StatusBadRequest, "invalid or expired login, please try again")
+	}
+}
@@ -0,0 +1,163 @@
+package http
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+)
+
+const reauthSession string = "reauth_session"
+const reauthCookie string = "reauth"
+
+// reauthLength is the time sensitive settings can be changed after the user confirmed who they are
+const reauthLength = 10 * time.Minute
+
+// reauthState is bound to the session, signing in again on another device does not carry it over
+type reauthState struct {
+	UserID    int
+	SessionID int
+	ExpiresAt int64
+}
+
+type reauthPage struct {
+	Next        string
+	HasPassword bool
+	Providers   []domain.LoginProvider
+	Errors      map[string]string
+}
+
+// safeNext returns the local path to go back to after reauthenticating, other sites are ignored
+func safeNext(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/profile"
+	}
+
+	return next
+}
+
+func reauthURL(next string) string {
+	return "/reauth?next=" + url.QueryEscape(next)
+}
+
+// setReauthenticated marks the session as recently reauthenticated
+func (h *handler) setReauthenticated(w http.ResponseWriter, r *http.Request, user *domain.User, session *domain.Session) error {
+	state := reauthState{
+		UserID:    user.ID,
+		SessionID: session.ID,
+		ExpiresAt: time.Now().Add(reauthLength).Unix(),
+	}
+
+	token, err := h.store.Codecs[0].Encode(reauthCookie, state)
+	if err != nil {
+		return err
+	}
+
+	options := *defaultSessionOptions
+	options.MaxAge = int(reauthLength.Seconds())
+	return h.getSessionAndSetCookie(w, r, token, reauthSession, reauthCookie, &options)
+}
+
+func (h *handler) recentlyReauthenticated(r *http.Request, user *domain.User, session *domain.Session) bool {
+	cookieSession, err := h.store.Get(r, reauthSession)
+	if err != nil {
+		return false
+	}
+
+	token, ok := cookieSession.Values[reauthCookie].(string)
+	if !ok {
+		return false
+	}
+
+	var state reauthState
+	for _, codec := range h.store.Codecs {
+		if err := codec.Decode(reauthCookie, token, &state); err != nil {
+			continue
+		}
+
+		return state.UserID == user.ID && state.SessionID == session.ID && time.Now().Unix() < state.ExpiresAt
+	}
+
+	return false
+}
+
+// linkedProviders returns the configured providers the user has an identity at
+func (h *handler) linkedProviders(r *http.Request, user *domain.User) []domain.LoginProvider {
+	identities, err := h.authService.Identities(r.Context(), user.ID)
+	if err != nil {
+		h.log.Error().Err(err).Sendf("failed to list linked accounts")
+		return nil
+	}
+
+	var providers []domain.LoginProvider
+	for _, provider := range h.authService.LoginProviders() {
+		for _, identity := range identities {
+			if identity.Provider == provider.Name() {
+				providers = append(providers, provider)
+				break
+			}
+		}
+	}
+
+	return providers
+}
+
+func (h *handler) writeReauth(w http.ResponseWriter, r *http.Request, user *domain.User, next string, errs map[string]string) {
+	if errs == nil {
+		errs = make(map[string]string)
+	}
+
+	h.writeTemplate(w, "reauth", reauthPage{
+		Next:        next,
+		HasPassword: user.HasPassword(),
+		Providers:   h.linkedProviders(r, user),
+		Errors:      errs,
+	})
+}
+
+func (h *handler) getReauth(w http.ResponseWriter, r *http.Request) {
+	user, _, ok := h.currentSession(w, r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	h.writeReauth(w, r, user, safeNext(r.URL.Query().Get("next")), nil)
+}
+
+func (h *handler) postReauth(w http.ResponseWriter, r *http.Request) {
+	user, session, ok := h.currentSession(w, r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	ctx := r.Context()
+	next := safeNext(r.FormValue("next"))
+	email, ip := domain.ThrottleEmail(user.Email), domain.ThrottleIP(clientIP(r))
+	if err := h.allowAttempt(ctx, domain.ThrottleLogin, email, ip); err != nil {
+		w.WriteHeader(http.StatusTooManyRequests)
+		h.writeReauth(w, r, user, next, map[string]string{"Credentials": tooManyAttemptsMessage})
+		return
+	}
+
+	authUser := domain.NewAuthUser(user.Email, r.FormValue("password"))
+	if _, err := h.authService.Authenticate(ctx, authUser); err != nil {
+		h.recordAttempt(ctx, domain.ThrottleLogin, email, ip)
+		w.WriteHeader(http.StatusUnauthorized)
+		h.writeReauth(w, r, user, next, authUser.Errors)
+		return
+	}
+
+	h.resetAttempts(ctx, domain.ThrottleLogin, email)
+
+	if err := h.setReauthenticated(w, r, user, session); err != nil {
+		h.log.Error().Err(err).Sendf("failed to save reauth session")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, next, http.StatusSeeOther)
+}
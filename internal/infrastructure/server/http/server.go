@@ -10,8 +10,9 @@ import (
 
 // Server ...
 type Server struct {
-	server *http.Server
-	log    log.Logger
+	server     *http.Server
+	onShutdown []func(ctx context.Context) error
+	log        log.Logger
 }
 
 // New ...
@@ -38,6 +39,12 @@ func (s *Server) ListenAndServe() {
 	}()
 }
 
+// OnShutdown registers a function called after the in-flight requests finished, within the
+// shutdown timeout, e.g. to drain background workers
+func (s *Server) OnShutdown(f func(ctx context.Context) error) {
+	s.onShutdown = append(s.onShutdown, f)
+}
+
 // Shutdown ...
 func (s *Server) Shutdown() {
 	s.log.Info().Send("Shutting down server")
@@ -49,5 +56,11 @@ func (s *Server) Shutdown() {
 		return
 	}
 
+	for _, f := range s.onShutdown {
+		if err := f(ctx); err != nil {
+			s.log.Error().Err(err).Sendf("Could not drain in 60s: %q", err)
+		}
+	}
+
 	s.log.Info().Sendf("Server gracefully stopped")
 }
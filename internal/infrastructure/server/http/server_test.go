@@ -1,6 +1,7 @@
 package http_test
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -28,3 +29,20 @@ func TestServer_ListenAndServe(t *testing.T) {
 
 	assert.True(t, result)
 }
+
+func TestServer_ShutdownDrains(t *testing.T) {
+	log := log.NewZeroLog("", "", log.Error)
+	server := http.New(nil, "localhost", "9996", log)
+	server.ListenAndServe()
+
+	var drained bool
+	server.OnShutdown(func(ctx context.Context) error {
+		_, ok := ctx.Deadline()
+		drained = ok
+		return nil
+	})
+
+	server.Shutdown()
+
+	assert.True(t, drained)
+}
@@ -0,0 +1,65 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+)
+
+func (h *handler) loadSessions(ctx context.Context, prof *profile, current *domain.Session) {
+	sessions, err := h.sessionService.List(ctx, current.UserID)
+	if err != nil {
+		h.log.Error().Err(err).Sendf("failed to list sessions")
+		return
+	}
+
+	prof.Sessions = sessions
+	prof.CurrentSessionID = current.ID
+}
+
+func (h *handler) postRevokeSession(w http.ResponseWriter, r *http.Request) {
+	user, current, ok := h.currentSession(w, r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	sessionID, err := strconv.Atoi(r.FormValue("session_id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := h.sessionService.Revoke(r.Context(), user.ID, sessionID); err != nil {
+		h.log.Error().Err(err).Sendf("failed to revoke session")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if sessionID == current.ID {
+		h.clearSessionCookies(w, r)
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	http.Redirect(w, r, "/profile", http.StatusSeeOther)
+}
+
+func (h *handler) postRevokeAllSessions(w http.ResponseWriter, r *http.Request) {
+	user, _, ok := h.currentSession(w, r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	if err := h.sessionService.RevokeAll(r.Context(), user.ID); err != nil {
+		h.log.Error().Err(err).Sendf("failed to revoke sessions")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	h.clearSessionCookies(w, r)
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
@@ -28,18 +28,34 @@ func (h *handler) postSignup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.authService.Signup(r.Context(), authUser); err != nil {
+	ip := domain.ThrottleIP(clientIP(r))
+	if err := h.allowAttempt(r.Context(), domain.ThrottleSignup, ip); err != nil {
+		h.writeTooManyAttempts(w, "signup", authUser)
+		return
+	}
+	h.recordAttempt(r.Context(), domain.ThrottleSignup, ip)
+
+	user, err := h.authService.Signup(r.Context(), authUser)
+	if err != nil {
 		w.WriteHeader(http.StatusForbidden)
 		h.writeTemplate(w, "signup", authUser)
 		return
 	}
 
-	if err := h.getSessionAndSetCookie(w, r, authUser.Token, authSession, authCookie, defaultSessionOptions); err != nil {
+	h.audit(r, domain.AuditSignup, user, user, nil)
+	h.sendVerificationEmail(r.Context(), user)
+
+	if !h.authService.EmailVerificationPolicy().AllowsLogin(user) {
+		h.writeEmailNotVerified(w, http.StatusCreated, user, "account created, check your email to verify it before signing in")
+		return
+	}
+
+	if err := h.startSession(w, r, user); err != nil {
 		w.WriteHeader(http.StatusUnauthorized)
 		h.writeTemplate(w, "signup", authUser)
 		return
 	}
 
-	http.Redirect(w, r, "/profile", http.StatusSeeOther)
+	http.Redirect(w, r, h.popReturnTo(w, r), http.StatusSeeOther)
 
 }
@@ -0,0 +1,53 @@
+package http
+
+import (
+	"context"
+	"net/http"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/pkg/errors"
+)
+
+// tooManyAttemptsMessage is shown for every throttled action so the response does not tell
+// whether the account exists
+const tooManyAttemptsMessage = "too many attempts, please try again later"
+
+// allowAttempt returns an error when the action is throttled for any of the keys. Failures of the
+// throttle store are logged and do not block the request.
+func (h *handler) allowAttempt(ctx context.Context, action string, keys ...domain.ThrottleKey) error {
+	err := h.throttleService.Allow(ctx, action, keys...)
+	if err == nil {
+		return nil
+	}
+
+	if _, ok := errors.RuleNotSatisfiedCast(err); ok {
+		return err
+	}
+
+	h.log.Error().Err(err).Sendf("failed to check %s attempts", action)
+	return nil
+}
+
+func (h *handler) recordAttempt(ctx context.Context, action string, keys ...domain.ThrottleKey) {
+	if err := h.throttleService.Record(ctx, action, keys...); err != nil {
+		h.log.Error().Err(err).Sendf("failed to record %s attempt", action)
+	}
+}
+
+func (h *handler) resetAttempts(ctx context.Context, action string, keys ...domain.ThrottleKey) {
+	if err := h.throttleService.Reset(ctx, action, keys...); err != nil {
+		h.log.Error().Err(err).Sendf("failed to reset %s attempts", action)
+	}
+}
+
+// writeTooManyAttempts renders the page of the throttled form with the generic message
+func (h *handler) writeTooManyAttempts(w http.ResponseWriter, templateName string, authUser *domain.AuthUser) {
+	authUser.Errors["Credentials"] = tooManyAttemptsMessage
+	w.WriteHeader(http.StatusTooManyRequests)
+	if templateName == "login" {
+		h.writeLogin(w, authUser)
+		return
+	}
+
+	h.writeTemplate(w, templateName, authUser)
+}
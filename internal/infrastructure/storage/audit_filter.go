@@ -0,0 +1,37 @@
+package storage
+
+import (
+	"github.com/jinzhu/gorm"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+)
+
+// FilterAuditEvents adds the conditions of the filter to a query of the audit_events table, the SQL
+// storages share it since it is valid in every database
+func FilterAuditEvents(db *gorm.DB, filter *domain.AuditFilter) *gorm.DB {
+	if filter.UserID != nil {
+		db = db.Where(`audit_events.user_id = (?)`, *filter.UserID)
+	}
+
+	if filter.ActorID != nil {
+		db = db.Where(`audit_events.actor_id = (?)`, *filter.ActorID)
+	}
+
+	if filter.Type != "" {
+		db = db.Where(`audit_events.type = (?)`, filter.Type)
+	}
+
+	if filter.IP != "" {
+		db = db.Where(`audit_events.ip = (?)`, filter.IP)
+	}
+
+	if filter.After != nil {
+		db = db.Where(`audit_events.created_at >= (?)`, filter.After.UTC())
+	}
+
+	if filter.Before != nil {
+		db = db.Where(`audit_events.created_at < (?)`, filter.Before.UTC())
+	}
+
+	return db
+}
@@ -5,4 +5,8 @@ import "gitlab.com/evzpav/user-auth/pkg/errors"
 const (
 	ErrUserNotFound   errors.Code = "USER_NOT_FOUND"
 	ErrUserDuplicated errors.Code = "USER_DUPLICATED"
+
+	ErrIdentityDuplicated errors.Code = "IDENTITY_DUPLICATED"
+
+	ErrOAuthClientDuplicated errors.Code = "OAUTH_CLIENT_DUPLICATED"
 )
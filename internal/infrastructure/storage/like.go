@@ -0,0 +1,17 @@
+package storage
+
+import "strings"
+
+// likeEscaper escapes the wildcards of LIKE with "!", the storages declare it with ESCAPE '!' since
+// the default escape character differs between the databases
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+// ContainsPattern returns the LIKE pattern matching the lower cased values that contain the query
+func ContainsPattern(query string) string {
+	return "%" + likeEscaper.Replace(strings.ToLower(query)) + "%"
+}
+
+// PrefixPattern returns the LIKE pattern matching the lower cased values that start with the prefix
+func PrefixPattern(prefix string) string {
+	return likeEscaper.Replace(strings.ToLower(prefix)) + "%"
+}
@@ -0,0 +1,86 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+)
+
+type adminAPIKeyStorage struct {
+	mu     sync.Mutex
+	lastID int
+	keys   map[int]*domain.AdminAPIKey
+}
+
+func NewAdminAPIKeyStorage() *adminAPIKeyStorage {
+	return &adminAPIKeyStorage{
+		keys: make(map[int]*domain.AdminAPIKey),
+	}
+}
+
+func (ks *adminAPIKeyStorage) Insert(ctx context.Context, key *domain.AdminAPIKey) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	ks.lastID++
+	key.ID = ks.lastID
+
+	stored := *key
+	ks.keys[stored.ID] = &stored
+	return nil
+}
+
+func (ks *adminAPIKeyStorage) FindByHash(ctx context.Context, hash string) (*domain.AdminAPIKey, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	for _, key := range ks.keys {
+		if key.KeyHash == hash {
+			copied := *key
+			return &copied, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (ks *adminAPIKeyStorage) List(ctx context.Context) ([]*domain.AdminAPIKey, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	keys := make([]*domain.AdminAPIKey, 0, len(ks.keys))
+	for _, key := range ks.keys {
+		copied := *key
+		keys = append(keys, &copied)
+	}
+
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+	return keys, nil
+}
+
+func (ks *adminAPIKeyStorage) Revoke(ctx context.Context, ID int, revokedAt time.Time) (bool, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	key, ok := ks.keys[ID]
+	if !ok || key.RevokedAt != nil {
+		return false, nil
+	}
+
+	key.RevokedAt = &revokedAt
+	return true, nil
+}
+
+func (ks *adminAPIKeyStorage) Touch(ctx context.Context, ID int, lastUsedAt time.Time) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	if key, ok := ks.keys[ID]; ok {
+		key.LastUsedAt = &lastUsedAt
+	}
+
+	return nil
+}
@@ -0,0 +1,88 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+)
+
+type apiKeyStorage struct {
+	mu     sync.Mutex
+	lastID int
+	keys   map[int]*domain.APIKey
+}
+
+func NewAPIKeyStorage() *apiKeyStorage {
+	return &apiKeyStorage{
+		keys: make(map[int]*domain.APIKey),
+	}
+}
+
+func (ks *apiKeyStorage) Insert(ctx context.Context, key *domain.APIKey) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	ks.lastID++
+	key.ID = ks.lastID
+
+	stored := *key
+	ks.keys[stored.ID] = &stored
+	return nil
+}
+
+func (ks *apiKeyStorage) FindByHash(ctx context.Context, hash string) (*domain.APIKey, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	for _, key := range ks.keys {
+		if key.KeyHash == hash {
+			copied := *key
+			return &copied, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (ks *apiKeyStorage) FindByUserID(ctx context.Context, userID int) ([]*domain.APIKey, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	var keys []*domain.APIKey
+	for _, key := range ks.keys {
+		if key.UserID == userID {
+			copied := *key
+			keys = append(keys, &copied)
+		}
+	}
+
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+	return keys, nil
+}
+
+func (ks *apiKeyStorage) Revoke(ctx context.Context, userID, ID int, revokedAt time.Time) (bool, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	key, ok := ks.keys[ID]
+	if !ok || key.UserID != userID || key.RevokedAt != nil {
+		return false, nil
+	}
+
+	key.RevokedAt = &revokedAt
+	return true, nil
+}
+
+func (ks *apiKeyStorage) Touch(ctx context.Context, ID int, lastUsedAt time.Time) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	if key, ok := ks.keys[ID]; ok {
+		key.LastUsedAt = &lastUsedAt
+	}
+
+	return nil
+}
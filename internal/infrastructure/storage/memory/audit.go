@@ -0,0 +1,102 @@
+package memory
+
+import (
+	"context"
+	"sync"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+)
+
+type auditStorage struct {
+	mu     sync.RWMutex
+	events []*domain.AuditEvent
+}
+
+func NewAuditStorage() *auditStorage {
+	return &auditStorage{}
+}
+
+func (as *auditStorage) Insert(ctx context.Context, event *domain.AuditEvent) error {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+
+	event.ID = len(as.events) + 1
+
+	stored := *event
+	as.events = append(as.events, &stored)
+	return nil
+}
+
+// List walks the events from the last appended, which is the order of the databases
+func (as *auditStorage) List(ctx context.Context, filter *domain.AuditFilter) ([]*domain.AuditEvent, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	as.mu.RLock()
+	defer as.mu.RUnlock()
+
+	var events []*domain.AuditEvent
+	skipped := 0
+	for i := len(as.events) - 1; i >= 0; i-- {
+		if filter.Limit > 0 && len(events) == filter.Limit {
+			break
+		}
+
+		if !matchesAuditFilter(as.events[i], filter) {
+			continue
+		}
+
+		if skipped < filter.Offset {
+			skipped++
+			continue
+		}
+
+		copied := *as.events[i]
+		events = append(events, &copied)
+	}
+
+	return events, nil
+}
+
+func (as *auditStorage) Count(ctx context.Context, filter *domain.AuditFilter) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	as.mu.RLock()
+	defer as.mu.RUnlock()
+
+	count := 0
+	for _, event := range as.events {
+		if matchesAuditFilter(event, filter) {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func matchesAuditFilter(event *domain.AuditEvent, filter *domain.AuditFilter) bool {
+	if filter.UserID != nil && (event.UserID == nil || *event.UserID != *filter.UserID) {
+		return false
+	}
+
+	if filter.ActorID != nil && (event.ActorID == nil || *event.ActorID != *filter.ActorID) {
+		return false
+	}
+
+	if filter.Type != "" && event.Type != filter.Type {
+		return false
+	}
+
+	if filter.IP != "" && event.IP != filter.IP {
+		return false
+	}
+
+	if filter.After != nil && event.CreatedAt.Before(*filter.After) {
+		return false
+	}
+
+	return filter.Before == nil || event.CreatedAt.Before(*filter.Before)
+}
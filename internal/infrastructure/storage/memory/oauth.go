@@ -0,0 +1,250 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/internal/infrastructure/storage"
+	"gitlab.com/evzpav/user-auth/pkg/errors"
+)
+
+type oauthClientStorage struct {
+	mu      sync.RWMutex
+	lastID  int
+	clients map[string]*domain.OAuthClient
+}
+
+func NewOAuthClientStorage() *oauthClientStorage {
+	return &oauthClientStorage{
+		clients: make(map[string]*domain.OAuthClient),
+	}
+}
+
+func (cs *oauthClientStorage) Insert(ctx context.Context, client *domain.OAuthClient) error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	if _, ok := cs.clients[client.ClientID]; ok {
+		return errors.NewDuplicatedRecord(storage.ErrOAuthClientDuplicated)
+	}
+
+	cs.lastID++
+	client.ID = cs.lastID
+
+	stored := *client
+	cs.clients[stored.ClientID] = &stored
+	return nil
+}
+
+func (cs *oauthClientStorage) FindByClientID(ctx context.Context, clientID string) (*domain.OAuthClient, error) {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	client, ok := cs.clients[clientID]
+	if !ok {
+		return nil, nil
+	}
+
+	copied := *client
+	return &copied, nil
+}
+
+func (cs *oauthClientStorage) List(ctx context.Context) ([]*domain.OAuthClient, error) {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	var clients []*domain.OAuthClient
+	for _, client := range cs.clients {
+		copied := *client
+		clients = append(clients, &copied)
+	}
+
+	sort.Slice(clients, func(i, j int) bool { return clients[i].ID < clients[j].ID })
+	return clients, nil
+}
+
+func (cs *oauthClientStorage) Delete(ctx context.Context, clientID string) error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	delete(cs.clients, clientID)
+	return nil
+}
+
+type oauthAuthorizationCodeStorage struct {
+	mu     sync.Mutex
+	lastID int
+	codes  map[int]*domain.OAuthAuthorizationCode
+}
+
+func NewOAuthAuthorizationCodeStorage() *oauthAuthorizationCodeStorage {
+	return &oauthAuthorizationCodeStorage{
+		codes: make(map[int]*domain.OAuthAuthorizationCode),
+	}
+}
+
+func (cs *oauthAuthorizationCodeStorage) Insert(ctx context.Context, code *domain.OAuthAuthorizationCode) error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	cs.lastID++
+	code.ID = cs.lastID
+
+	stored := *code
+	cs.codes[stored.ID] = &stored
+	return nil
+}
+
+func (cs *oauthAuthorizationCodeStorage) FindByHash(ctx context.Context, hash string) (*domain.OAuthAuthorizationCode, error) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	for _, code := range cs.codes {
+		if code.CodeHash == hash {
+			copied := *code
+			return &copied, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (cs *oauthAuthorizationCodeStorage) MarkUsed(ctx context.Context, ID int, usedAt time.Time) (bool, error) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	code, ok := cs.codes[ID]
+	if !ok || code.UsedAt != nil {
+		return false, nil
+	}
+
+	code.UsedAt = &usedAt
+	return true, nil
+}
+
+type oauthTokenStorage struct {
+	mu     sync.Mutex
+	lastID int
+	tokens map[int]*domain.OAuthToken
+}
+
+func NewOAuthTokenStorage() *oauthTokenStorage {
+	return &oauthTokenStorage{
+		tokens: make(map[int]*domain.OAuthToken),
+	}
+}
+
+func (ts *oauthTokenStorage) Insert(ctx context.Context, token *domain.OAuthToken) error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	ts.lastID++
+	token.ID = ts.lastID
+
+	stored := *token
+	ts.tokens[stored.ID] = &stored
+	return nil
+}
+
+func (ts *oauthTokenStorage) FindByHash(ctx context.Context, hash string) (*domain.OAuthToken, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	for _, token := range ts.tokens {
+		if token.TokenHash == hash {
+			copied := *token
+			return &copied, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (ts *oauthTokenStorage) MarkUsed(ctx context.Context, ID int, usedAt time.Time) (bool, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	token, ok := ts.tokens[ID]
+	if !ok || token.UsedAt != nil {
+		return false, nil
+	}
+
+	token.UsedAt = &usedAt
+	return true, nil
+}
+
+func (ts *oauthTokenStorage) Revoke(ctx context.Context, ID int, revokedAt time.Time) error {
+	return ts.revokeWhere(revokedAt, func(token *domain.OAuthToken) bool { return token.ID == ID })
+}
+
+func (ts *oauthTokenStorage) RevokeFamily(ctx context.Context, familyID string, revokedAt time.Time) error {
+	return ts.revokeWhere(revokedAt, func(token *domain.OAuthToken) bool { return token.FamilyID == familyID })
+}
+
+func (ts *oauthTokenStorage) RevokeByClientID(ctx context.Context, clientID string, revokedAt time.Time) error {
+	return ts.revokeWhere(revokedAt, func(token *domain.OAuthToken) bool { return token.ClientID == clientID })
+}
+
+func (ts *oauthTokenStorage) revokeWhere(revokedAt time.Time, match func(*domain.OAuthToken) bool) error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	for _, token := range ts.tokens {
+		if token.RevokedAt == nil && match(token) {
+			revoked := revokedAt
+			token.RevokedAt = &revoked
+		}
+	}
+
+	return nil
+}
+
+type oauthConsentStorage struct {
+	mu       sync.RWMutex
+	lastID   int
+	consents map[int]*domain.OAuthConsent
+}
+
+func NewOAuthConsentStorage() *oauthConsentStorage {
+	return &oauthConsentStorage{
+		consents: make(map[int]*domain.OAuthConsent),
+	}
+}
+
+func (cs *oauthConsentStorage) Find(ctx context.Context, userID int, clientID string) (*domain.OAuthConsent, error) {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	for _, consent := range cs.consents {
+		if consent.UserID == userID && consent.ClientID == clientID {
+			copied := *consent
+			return &copied, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (cs *oauthConsentStorage) Save(ctx context.Context, consent *domain.OAuthConsent) error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	for _, stored := range cs.consents {
+		if stored.UserID == consent.UserID && stored.ClientID == consent.ClientID {
+			stored.Scope = consent.Scope
+			stored.GrantedAt = consent.GrantedAt
+			consent.ID = stored.ID
+			return nil
+		}
+	}
+
+	cs.lastID++
+	consent.ID = cs.lastID
+
+	stored := *consent
+	cs.consents[stored.ID] = &stored
+	return nil
+}
@@ -0,0 +1,18 @@
+package memory
+
+import (
+	"testing"
+
+	"gitlab.com/evzpav/user-auth/internal/infrastructure/storage/storagetest"
+)
+
+func TestOAuthStorage(t *testing.T) {
+	storagetest.RunOAuthStorage(t, func(t *testing.T) storagetest.OAuthStorages {
+		return storagetest.OAuthStorages{
+			Clients:  NewOAuthClientStorage(),
+			Codes:    NewOAuthAuthorizationCodeStorage(),
+			Tokens:   NewOAuthTokenStorage(),
+			Consents: NewOAuthConsentStorage(),
+		}
+	})
+}
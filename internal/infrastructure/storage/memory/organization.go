@@ -0,0 +1,229 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+)
+
+type membershipKey struct {
+	organizationID int
+	userID         int
+}
+
+type organizationStorage struct {
+	mu            sync.Mutex
+	lastID        int
+	organizations map[int]*domain.Organization
+	memberships   map[membershipKey]*domain.OrgMembership
+}
+
+func NewOrganizationStorage() *organizationStorage {
+	return &organizationStorage{
+		organizations: make(map[int]*domain.Organization),
+		memberships:   make(map[membershipKey]*domain.OrgMembership),
+	}
+}
+
+func (s *organizationStorage) Insert(ctx context.Context, organization *domain.Organization, owner *domain.OrgMembership) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastID++
+	organization.ID = s.lastID
+	owner.OrganizationID = organization.ID
+
+	stored := *organization
+	s.organizations[stored.ID] = &stored
+
+	membership := *owner
+	s.memberships[membershipKey{membership.OrganizationID, membership.UserID}] = &membership
+	return nil
+}
+
+func (s *organizationStorage) FindByID(ctx context.Context, ID int) (*domain.Organization, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	organization, ok := s.organizations[ID]
+	if !ok {
+		return nil, nil
+	}
+
+	copied := *organization
+	return &copied, nil
+}
+
+func (s *organizationStorage) FindMembership(ctx context.Context, organizationID, userID int) (*domain.OrgMembership, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	membership, ok := s.memberships[membershipKey{organizationID, userID}]
+	if !ok {
+		return nil, nil
+	}
+
+	copied := *membership
+	return &copied, nil
+}
+
+func (s *organizationStorage) FindMembers(ctx context.Context, organizationID int) ([]*domain.OrgMembership, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var memberships []*domain.OrgMembership
+	for key, membership := range s.memberships {
+		if key.organizationID == organizationID {
+			copied := *membership
+			memberships = append(memberships, &copied)
+		}
+	}
+
+	sort.Slice(memberships, func(i, j int) bool {
+		if !memberships[i].CreatedAt.Equal(memberships[j].CreatedAt) {
+			return memberships[i].CreatedAt.Before(memberships[j].CreatedAt)
+		}
+		return memberships[i].UserID < memberships[j].UserID
+	})
+	return memberships, nil
+}
+
+func (s *organizationStorage) FindMemberships(ctx context.Context, userID int) ([]*domain.OrgMembership, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var memberships []*domain.OrgMembership
+	for key, membership := range s.memberships {
+		if key.userID == userID {
+			copied := *membership
+			memberships = append(memberships, &copied)
+		}
+	}
+
+	sort.Slice(memberships, func(i, j int) bool {
+		if !memberships[i].CreatedAt.Equal(memberships[j].CreatedAt) {
+			return memberships[i].CreatedAt.Before(memberships[j].CreatedAt)
+		}
+		return memberships[i].OrganizationID < memberships[j].OrganizationID
+	})
+	return memberships, nil
+}
+
+func (s *organizationStorage) InsertMembership(ctx context.Context, membership *domain.OrgMembership) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := *membership
+	s.memberships[membershipKey{stored.OrganizationID, stored.UserID}] = &stored
+	return nil
+}
+
+func (s *organizationStorage) DeleteMembership(ctx context.Context, organizationID, userID int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := membershipKey{organizationID, userID}
+	if _, ok := s.memberships[key]; !ok {
+		return false, nil
+	}
+
+	delete(s.memberships, key)
+	return true, nil
+}
+
+func (s *organizationStorage) TransferOwnership(ctx context.Context, organizationID, ownerID, userID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if owner, ok := s.memberships[membershipKey{organizationID, ownerID}]; ok {
+		owner.Role = domain.OrgRoleAdmin
+	}
+
+	if member, ok := s.memberships[membershipKey{organizationID, userID}]; ok {
+		member.Role = domain.OrgRoleOwner
+	}
+
+	return nil
+}
+
+type orgInvitationStorage struct {
+	mu          sync.Mutex
+	lastID      int
+	invitations map[int]*domain.OrgInvitation
+}
+
+func NewOrgInvitationStorage() *orgInvitationStorage {
+	return &orgInvitationStorage{
+		invitations: make(map[int]*domain.OrgInvitation),
+	}
+}
+
+func (is *orgInvitationStorage) Insert(ctx context.Context, invitation *domain.OrgInvitation) error {
+	is.mu.Lock()
+	defer is.mu.Unlock()
+
+	is.lastID++
+	invitation.ID = is.lastID
+
+	stored := *invitation
+	is.invitations[stored.ID] = &stored
+	return nil
+}
+
+func (is *orgInvitationStorage) FindByID(ctx context.Context, ID int) (*domain.OrgInvitation, error) {
+	is.mu.Lock()
+	defer is.mu.Unlock()
+
+	invitation, ok := is.invitations[ID]
+	if !ok {
+		return nil, nil
+	}
+
+	copied := *invitation
+	return &copied, nil
+}
+
+func (is *orgInvitationStorage) FindPending(ctx context.Context, organizationID int, now time.Time) ([]*domain.OrgInvitation, error) {
+	is.mu.Lock()
+	defer is.mu.Unlock()
+
+	var invitations []*domain.OrgInvitation
+	for _, invitation := range is.invitations {
+		if invitation.OrganizationID == organizationID && invitation.Pending(now) {
+			copied := *invitation
+			invitations = append(invitations, &copied)
+		}
+	}
+
+	sort.Slice(invitations, func(i, j int) bool { return invitations[i].ID < invitations[j].ID })
+	return invitations, nil
+}
+
+func (is *orgInvitationStorage) Accept(ctx context.Context, ID int, acceptedAt time.Time) (bool, error) {
+	is.mu.Lock()
+	defer is.mu.Unlock()
+
+	invitation, ok := is.invitations[ID]
+	if !ok || invitation.AcceptedAt != nil || invitation.RevokedAt != nil {
+		return false, nil
+	}
+
+	invitation.AcceptedAt = &acceptedAt
+	return true, nil
+}
+
+func (is *orgInvitationStorage) Revoke(ctx context.Context, organizationID, ID int, revokedAt time.Time) (bool, error) {
+	is.mu.Lock()
+	defer is.mu.Unlock()
+
+	invitation, ok := is.invitations[ID]
+	if !ok || invitation.OrganizationID != organizationID || invitation.AcceptedAt != nil || invitation.RevokedAt != nil {
+		return false, nil
+	}
+
+	invitation.RevokedAt = &revokedAt
+	return true, nil
+}
@@ -0,0 +1,73 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+)
+
+type passwordResetTokenStorage struct {
+	mu     sync.Mutex
+	lastID int
+	tokens map[int]*domain.PasswordResetToken
+}
+
+func NewPasswordResetTokenStorage() *passwordResetTokenStorage {
+	return &passwordResetTokenStorage{
+		tokens: make(map[int]*domain.PasswordResetToken),
+	}
+}
+
+func (ps *passwordResetTokenStorage) Insert(ctx context.Context, token *domain.PasswordResetToken) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	ps.lastID++
+	token.ID = ps.lastID
+
+	stored := *token
+	ps.tokens[stored.ID] = &stored
+	return nil
+}
+
+func (ps *passwordResetTokenStorage) FindByHash(ctx context.Context, hash string) (*domain.PasswordResetToken, error) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	for _, token := range ps.tokens {
+		if token.TokenHash == hash {
+			copied := *token
+			return &copied, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (ps *passwordResetTokenStorage) MarkUsed(ctx context.Context, ID int, usedAt time.Time) (bool, error) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	token, ok := ps.tokens[ID]
+	if !ok || token.UsedAt != nil {
+		return false, nil
+	}
+
+	token.UsedAt = &usedAt
+	return true, nil
+}
+
+func (ps *passwordResetTokenStorage) DeleteByUserID(ctx context.Context, userID int) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	for ID, token := range ps.tokens {
+		if token.UserID == userID {
+			delete(ps.tokens, ID)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,82 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+)
+
+type refreshTokenStorage struct {
+	mu     sync.Mutex
+	lastID int
+	tokens map[int]*domain.RefreshToken
+}
+
+func NewRefreshTokenStorage() *refreshTokenStorage {
+	return &refreshTokenStorage{
+		tokens: make(map[int]*domain.RefreshToken),
+	}
+}
+
+func (rs *refreshTokenStorage) Insert(ctx context.Context, token *domain.RefreshToken) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	rs.lastID++
+	token.ID = rs.lastID
+
+	stored := *token
+	rs.tokens[stored.ID] = &stored
+	return nil
+}
+
+func (rs *refreshTokenStorage) FindByHash(ctx context.Context, hash string) (*domain.RefreshToken, error) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	for _, token := range rs.tokens {
+		if token.TokenHash == hash {
+			copied := *token
+			return &copied, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (rs *refreshTokenStorage) MarkUsed(ctx context.Context, ID int, usedAt time.Time) (bool, error) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	token, ok := rs.tokens[ID]
+	if !ok || token.UsedAt != nil {
+		return false, nil
+	}
+
+	token.UsedAt = &usedAt
+	return true, nil
+}
+
+func (rs *refreshTokenStorage) RevokeFamily(ctx context.Context, familyID string, revokedAt time.Time) error {
+	return rs.revokeWhere(revokedAt, func(token *domain.RefreshToken) bool { return token.FamilyID == familyID })
+}
+
+func (rs *refreshTokenStorage) RevokeByUserID(ctx context.Context, userID int, revokedAt time.Time) error {
+	return rs.revokeWhere(revokedAt, func(token *domain.RefreshToken) bool { return token.UserID == userID })
+}
+
+func (rs *refreshTokenStorage) revokeWhere(revokedAt time.Time, match func(*domain.RefreshToken) bool) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	for _, token := range rs.tokens {
+		if token.RevokedAt == nil && match(token) {
+			revoked := revokedAt
+			token.RevokedAt = &revoked
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,109 @@
+package memory
+
+import (
+	"context"
+	"sync"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+)
+
+// roleStorage keeps the role assignments in memory, the roles are fixed and seeded like the
+// migrations of the databases do
+type roleStorage struct {
+	mu        sync.RWMutex
+	roles     []*domain.Role
+	userRoles map[int]map[int]bool
+}
+
+func NewRoleStorage() *roleStorage {
+	return &roleStorage{
+		roles: []*domain.Role{
+			{
+				ID:          1,
+				Name:        domain.RoleAdmin,
+				Description: "Manages the accounts of the users",
+				Permissions: append([]domain.Permission(nil), domain.Permissions...),
+			},
+		},
+		userRoles: make(map[int]map[int]bool),
+	}
+}
+
+func (rs *roleStorage) List(ctx context.Context) ([]*domain.Role, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	roles := make([]*domain.Role, 0, len(rs.roles))
+	for _, role := range rs.roles {
+		roles = append(roles, copyRole(role))
+	}
+
+	return roles, nil
+}
+
+func (rs *roleStorage) FindByName(ctx context.Context, name string) (*domain.Role, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, role := range rs.roles {
+		if role.Name == name {
+			return copyRole(role), nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (rs *roleStorage) FindByUserID(ctx context.Context, userID int) ([]*domain.Role, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+
+	var roles []*domain.Role
+	for _, role := range rs.roles {
+		if rs.userRoles[userID][role.ID] {
+			roles = append(roles, copyRole(role))
+		}
+	}
+
+	return roles, nil
+}
+
+func (rs *roleStorage) AddUser(ctx context.Context, roleID, userID int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	if rs.userRoles[userID] == nil {
+		rs.userRoles[userID] = make(map[int]bool)
+	}
+	rs.userRoles[userID][roleID] = true
+
+	return nil
+}
+
+func (rs *roleStorage) RemoveUser(ctx context.Context, roleID, userID int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	delete(rs.userRoles[userID], roleID)
+	return nil
+}
+
+func copyRole(role *domain.Role) *domain.Role {
+	copied := *role
+	copied.Permissions = append([]domain.Permission(nil), role.Permissions...)
+	return &copied
+}
@@ -0,0 +1,125 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+)
+
+type sessionStorage struct {
+	mu       sync.Mutex
+	lastID   int
+	sessions map[int]*domain.Session
+}
+
+func NewSessionStorage() *sessionStorage {
+	return &sessionStorage{
+		sessions: make(map[int]*domain.Session),
+	}
+}
+
+func (ss *sessionStorage) Insert(ctx context.Context, session *domain.Session) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	ss.lastID++
+	session.ID = ss.lastID
+
+	stored := *session
+	ss.sessions[stored.ID] = &stored
+	return nil
+}
+
+func (ss *sessionStorage) FindByTokenHash(ctx context.Context, hash string) (*domain.Session, error) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	for _, session := range ss.sessions {
+		if session.TokenHash == hash {
+			copied := *session
+			return &copied, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// FindByUserID returns the sessions of the user, the most recently seen first
+func (ss *sessionStorage) FindByUserID(ctx context.Context, userID int) ([]*domain.Session, error) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	var sessions []*domain.Session
+	for _, session := range ss.sessions {
+		if session.UserID == userID {
+			copied := *session
+			sessions = append(sessions, &copied)
+		}
+	}
+
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt) })
+	return sessions, nil
+}
+
+func (ss *sessionStorage) Touch(ctx context.Context, ID int, lastSeenAt, expiresAt time.Time) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	if session, ok := ss.sessions[ID]; ok {
+		session.LastSeenAt = lastSeenAt
+		session.ExpiresAt = expiresAt
+	}
+
+	return nil
+}
+
+func (ss *sessionStorage) SetOrganization(ctx context.Context, ID int, organizationID *int) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	if session, ok := ss.sessions[ID]; ok {
+		session.OrganizationID = organizationID
+	}
+
+	return nil
+}
+
+func (ss *sessionStorage) Delete(ctx context.Context, userID, ID int) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	if session, ok := ss.sessions[ID]; ok && session.UserID == userID {
+		delete(ss.sessions, ID)
+	}
+
+	return nil
+}
+
+func (ss *sessionStorage) DeleteByUserID(ctx context.Context, userID int) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	for ID, session := range ss.sessions {
+		if session.UserID == userID {
+			delete(ss.sessions, ID)
+		}
+	}
+
+	return nil
+}
+
+func (ss *sessionStorage) DeleteExpired(ctx context.Context, userID int, now time.Time) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	for ID, session := range ss.sessions {
+		if session.UserID == userID && !session.ExpiresAt.After(now) {
+			delete(ss.sessions, ID)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,100 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+)
+
+// expired entries are removed at most once per interval
+const sweepInterval = time.Minute
+
+// throttleStore keeps the attempts in the memory of the process, it is only suited for a single
+// instance
+type throttleStore struct {
+	mu        sync.Mutex
+	entries   map[string]*domain.ThrottleEntry
+	lastSweep time.Time
+}
+
+func NewThrottleStore() *throttleStore {
+	return &throttleStore{
+		entries: make(map[string]*domain.ThrottleEntry),
+	}
+}
+
+func (ts *throttleStore) Get(ctx context.Context, key string) (*domain.ThrottleEntry, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	entry, ok := ts.entries[key]
+	if !ok {
+		return nil, nil
+	}
+
+	copied := *entry
+	return &copied, nil
+}
+
+func (ts *throttleStore) Increment(ctx context.Context, key string, now time.Time, window time.Duration) (*domain.ThrottleEntry, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	ts.sweep(now)
+
+	entry, ok := ts.entries[key]
+	if !ok || !now.Before(entry.ExpiresAt) {
+		entry = &domain.ThrottleEntry{Key: key}
+		ts.entries[key] = entry
+	}
+
+	entry.Attempts++
+	if expiresAt := now.Add(window); expiresAt.After(entry.ExpiresAt) {
+		entry.ExpiresAt = expiresAt
+	}
+
+	copied := *entry
+	return &copied, nil
+}
+
+func (ts *throttleStore) Lock(ctx context.Context, key string, until, expiresAt time.Time) error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	entry, ok := ts.entries[key]
+	if !ok {
+		entry = &domain.ThrottleEntry{Key: key}
+		ts.entries[key] = entry
+	}
+
+	entry.LockedUntil = &until
+	if expiresAt.After(entry.ExpiresAt) {
+		entry.ExpiresAt = expiresAt
+	}
+
+	return nil
+}
+
+func (ts *throttleStore) Delete(ctx context.Context, key string) error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	delete(ts.entries, key)
+	return nil
+}
+
+func (ts *throttleStore) sweep(now time.Time) {
+	if now.Sub(ts.lastSweep) < sweepInterval {
+		return
+	}
+
+	for key, entry := range ts.entries {
+		if !now.Before(entry.ExpiresAt) {
+			delete(ts.entries, key)
+		}
+	}
+
+	ts.lastSweep = now
+}
@@ -0,0 +1,44 @@
+package memory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestThrottleStore(t *testing.T) {
+	store := NewThrottleStore()
+	ctx := context.Background()
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	entry, err := store.Get(ctx, "login:ip:10.0.0.1")
+	require.NoError(t, err)
+	assert.Nil(t, entry)
+
+	_, err = store.Increment(ctx, "login:ip:10.0.0.1", now, time.Minute)
+	require.NoError(t, err)
+	entry, err = store.Increment(ctx, "login:ip:10.0.0.1", now.Add(30*time.Second), time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, 2, entry.Attempts)
+	assert.Equal(t, now.Add(90*time.Second), entry.ExpiresAt)
+
+	until := now.Add(time.Hour)
+	require.NoError(t, store.Lock(ctx, "login:ip:10.0.0.1", until, until.Add(time.Minute)))
+	entry, err = store.Get(ctx, "login:ip:10.0.0.1")
+	require.NoError(t, err)
+	assert.Equal(t, until, *entry.LockedUntil)
+
+	// the count starts over once the entry expired, and the entry is swept
+	entry, err = store.Increment(ctx, "login:ip:10.0.0.1", until.Add(time.Minute), time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, 1, entry.Attempts)
+	assert.Nil(t, entry.LockedUntil)
+
+	require.NoError(t, store.Delete(ctx, "login:ip:10.0.0.1"))
+	entry, err = store.Get(ctx, "login:ip:10.0.0.1")
+	require.NoError(t, err)
+	assert.Nil(t, entry)
+}
@@ -0,0 +1,261 @@
+package memory
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/internal/infrastructure/storage"
+	"gitlab.com/evzpav/user-auth/pkg/errors"
+)
+
+// userStorage keeps the users in the memory of the process. It is the reference implementation of
+// domain.UserStorage and backs the tests that do not need a database.
+type userStorage struct {
+	mu         sync.RWMutex
+	lastID     int
+	users      map[int]*domain.User
+	byEmail    map[string]int
+	identities *userIdentityStorage
+}
+
+func NewUserStorage() *userStorage {
+	return &userStorage{
+		users:   make(map[int]*domain.User),
+		byEmail: make(map[string]int),
+	}
+}
+
+// WithIdentities lets List filter the users by login provider like the databases do with a join,
+// without it no user matches a provider
+func (us *userStorage) WithIdentities(identities *userIdentityStorage) *userStorage {
+	us.identities = identities
+	return us
+}
+
+// Insert assigns the next ID to the user, emails differing only in case are duplicated
+func (us *userStorage) Insert(ctx context.Context, inputUser *domain.User) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	us.mu.Lock()
+	defer us.mu.Unlock()
+
+	email := strings.ToLower(inputUser.Email)
+	if _, ok := us.byEmail[email]; ok {
+		return errors.NewDuplicatedRecord(storage.ErrUserDuplicated)
+	}
+
+	now := time.Now().UTC()
+	if inputUser.CreatedAt.IsZero() {
+		inputUser.CreatedAt = now
+	}
+	inputUser.UpdatedAt = now
+
+	us.lastID++
+	inputUser.ID = us.lastID
+
+	stored := *inputUser
+	us.users[stored.ID] = &stored
+	us.byEmail[email] = stored.ID
+
+	return nil
+}
+
+func (us *userStorage) FindByEmail(ctx context.Context, email string) (*domain.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	us.mu.RLock()
+	defer us.mu.RUnlock()
+
+	ID, ok := us.byEmail[strings.ToLower(email)]
+	if !ok {
+		return nil, nil
+	}
+
+	return us.copy(ID), nil
+}
+
+func (us *userStorage) FindByID(ctx context.Context, ID int) (*domain.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	us.mu.RLock()
+	defer us.mu.RUnlock()
+
+	return us.copy(ID), nil
+}
+
+// Update replaces the stored user with the same ID, it fails when the new email belongs to another
+// user
+func (us *userStorage) Update(ctx context.Context, inputUser *domain.User) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	us.mu.Lock()
+	defer us.mu.Unlock()
+
+	current, ok := us.users[inputUser.ID]
+	if !ok {
+		return errors.NewNotFound(storage.ErrUserNotFound)
+	}
+
+	email := strings.ToLower(inputUser.Email)
+	if ID, ok := us.byEmail[email]; ok && ID != inputUser.ID {
+		return errors.NewDuplicatedRecord(storage.ErrUserDuplicated)
+	}
+
+	inputUser.UpdatedAt = time.Now().UTC()
+
+	delete(us.byEmail, strings.ToLower(current.Email))
+	stored := *inputUser
+	us.users[stored.ID] = &stored
+	us.byEmail[email] = stored.ID
+
+	return nil
+}
+
+func (us *userStorage) UseTOTPStep(ctx context.Context, userID int, step int64) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	us.mu.Lock()
+	defer us.mu.Unlock()
+
+	user, ok := us.users[userID]
+	if !ok || user.TOTPLastStep >= step {
+		return false, nil
+	}
+
+	user.TOTPLastStep = step
+	return true, nil
+}
+
+func (us *userStorage) ReplaceRecoveryCodes(ctx context.Context, userID int, current, replacement string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	us.mu.Lock()
+	defer us.mu.Unlock()
+
+	user, ok := us.users[userID]
+	if !ok || user.MFARecoveryCodes != current {
+		return false, nil
+	}
+
+	user.MFARecoveryCodes = replacement
+	return true, nil
+}
+
+// List walks the users by ID, which is the order of the databases
+func (us *userStorage) List(ctx context.Context, filter *domain.UserFilter) ([]*domain.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	us.mu.RLock()
+	defer us.mu.RUnlock()
+
+	var users []*domain.User
+	skipped := 0
+	for ID := 1; ID <= us.lastID; ID++ {
+		if filter.Limit > 0 && len(users) == filter.Limit {
+			break
+		}
+
+		user, ok := us.users[ID]
+		if !ok || !us.matches(user, filter) {
+			continue
+		}
+
+		if skipped < filter.Offset {
+			skipped++
+			continue
+		}
+
+		users = append(users, us.copy(ID))
+	}
+
+	return users, nil
+}
+
+func (us *userStorage) Count(ctx context.Context, filter *domain.UserFilter) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	us.mu.RLock()
+	defer us.mu.RUnlock()
+
+	count := 0
+	for _, user := range us.users {
+		if us.matches(user, filter) {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func (us *userStorage) matches(user *domain.User, filter *domain.UserFilter) bool {
+	email := strings.ToLower(user.Email)
+
+	if query := strings.ToLower(filter.Query); !strings.Contains(email, query) && !strings.Contains(strings.ToLower(user.Name), query) {
+		return false
+	}
+
+	if !strings.HasPrefix(email, strings.ToLower(filter.EmailPrefix)) {
+		return false
+	}
+
+	if filter.Provider != "" && (us.identities == nil || !us.identities.linked(user.ID, filter.Provider)) {
+		return false
+	}
+
+	if filter.CreatedAfter != nil && user.CreatedAt.Before(*filter.CreatedAfter) {
+		return false
+	}
+
+	if filter.CreatedBefore != nil && !user.CreatedAt.Before(*filter.CreatedBefore) {
+		return false
+	}
+
+	if filter.Disabled != nil && user.Disabled() != *filter.Disabled {
+		return false
+	}
+
+	return filter.Deleted == nil || user.Deleted() == *filter.Deleted
+}
+
+// copy returns a copy of the stored user so callers cannot change it without Update
+func (us *userStorage) copy(ID int) *domain.User {
+	user, ok := us.users[ID]
+	if !ok {
+		return nil
+	}
+
+	copied := *user
+	if user.EmailVerifiedAt != nil {
+		verifiedAt := *user.EmailVerifiedAt
+		copied.EmailVerifiedAt = &verifiedAt
+	}
+	if user.DisabledAt != nil {
+		disabledAt := *user.DisabledAt
+		copied.DisabledAt = &disabledAt
+	}
+	if user.DeletedAt != nil {
+		deletedAt := *user.DeletedAt
+		copied.DeletedAt = &deletedAt
+	}
+
+	return &copied
+}
@@ -0,0 +1,113 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/internal/infrastructure/storage"
+	"gitlab.com/evzpav/user-auth/pkg/errors"
+)
+
+type userIdentityStorage struct {
+	mu         sync.RWMutex
+	lastID     int
+	identities map[int]*domain.UserIdentity
+}
+
+func NewUserIdentityStorage() *userIdentityStorage {
+	return &userIdentityStorage{
+		identities: make(map[int]*domain.UserIdentity),
+	}
+}
+
+func (is *userIdentityStorage) Insert(ctx context.Context, identity *domain.UserIdentity) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	is.mu.Lock()
+	defer is.mu.Unlock()
+
+	for _, stored := range is.identities {
+		if stored.Provider == identity.Provider && stored.Subject == identity.Subject {
+			return errors.NewDuplicatedRecord(storage.ErrIdentityDuplicated)
+		}
+	}
+
+	is.lastID++
+	identity.ID = is.lastID
+
+	stored := *identity
+	is.identities[stored.ID] = &stored
+	return nil
+}
+
+func (is *userIdentityStorage) FindBySubject(ctx context.Context, provider, subject string) (*domain.UserIdentity, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	is.mu.RLock()
+	defer is.mu.RUnlock()
+
+	for _, identity := range is.identities {
+		if identity.Provider == provider && identity.Subject == subject {
+			copied := *identity
+			return &copied, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// FindByUserID returns the identities of the user, the first linked first
+func (is *userIdentityStorage) FindByUserID(ctx context.Context, userID int) ([]*domain.UserIdentity, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	is.mu.RLock()
+	defer is.mu.RUnlock()
+
+	var identities []*domain.UserIdentity
+	for _, identity := range is.identities {
+		if identity.UserID == userID {
+			copied := *identity
+			identities = append(identities, &copied)
+		}
+	}
+
+	sort.Slice(identities, func(i, j int) bool { return identities[i].ID < identities[j].ID })
+	return identities, nil
+}
+
+func (is *userIdentityStorage) Delete(ctx context.Context, userID, ID int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	is.mu.Lock()
+	defer is.mu.Unlock()
+
+	if identity, ok := is.identities[ID]; ok && identity.UserID == userID {
+		delete(is.identities, ID)
+	}
+
+	return nil
+}
+
+// linked tells whether the user has an account of the provider linked
+func (is *userIdentityStorage) linked(userID int, provider string) bool {
+	is.mu.RLock()
+	defer is.mu.RUnlock()
+
+	for _, identity := range is.identities {
+		if identity.UserID == userID && identity.Provider == provider {
+			return true
+		}
+	}
+
+	return false
+}
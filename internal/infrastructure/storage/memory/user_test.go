@@ -0,0 +1,63 @@
+package memory
+
+import (
+	"testing"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/internal/infrastructure/storage/storagetest"
+)
+
+func TestUserStorage(t *testing.T) {
+	storagetest.RunUserStorage(t, func(t *testing.T) domain.UserStorage {
+		return NewUserStorage()
+	})
+}
+
+func TestUserIdentityStorage(t *testing.T) {
+	storagetest.RunUserIdentityStorage(t, func(t *testing.T) domain.UserIdentityStorage {
+		return NewUserIdentityStorage()
+	})
+}
+
+func TestRoleStorage(t *testing.T) {
+	storagetest.RunRoleStorage(t, func(t *testing.T) domain.RoleStorage {
+		return NewRoleStorage()
+	})
+}
+
+func TestUserFilter(t *testing.T) {
+	storagetest.RunUserFilter(t, func(t *testing.T) storagetest.UserFilterStorages {
+		identities := NewUserIdentityStorage()
+		return storagetest.UserFilterStorages{
+			Users:      NewUserStorage().WithIdentities(identities),
+			Identities: identities,
+		}
+	})
+}
+
+func TestAdminAPIKeyStorage(t *testing.T) {
+	storagetest.RunAdminAPIKeyStorage(t, func(t *testing.T) domain.AdminAPIKeyStorage {
+		return NewAdminAPIKeyStorage()
+	})
+}
+
+func TestAPIKeyStorage(t *testing.T) {
+	storagetest.RunAPIKeyStorage(t, func(t *testing.T) domain.APIKeyStorage {
+		return NewAPIKeyStorage()
+	})
+}
+
+func TestOrganizationStorage(t *testing.T) {
+	storagetest.RunOrganizationStorage(t, func(t *testing.T) storagetest.OrganizationStorages {
+		return storagetest.OrganizationStorages{
+			Organizations: NewOrganizationStorage(),
+			Invitations:   NewOrgInvitationStorage(),
+		}
+	})
+}
+
+func TestAuditStorage(t *testing.T) {
+	storagetest.RunAuditStorage(t, func(t *testing.T) domain.AuditStorage {
+		return NewAuditStorage()
+	})
+}
@@ -0,0 +1,59 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+)
+
+type webAuthnChallengeStorage struct {
+	mu         sync.Mutex
+	lastID     int
+	challenges map[string]*domain.WebAuthnChallenge
+}
+
+func NewWebAuthnChallengeStorage() *webAuthnChallengeStorage {
+	return &webAuthnChallengeStorage{
+		challenges: make(map[string]*domain.WebAuthnChallenge),
+	}
+}
+
+func (ws *webAuthnChallengeStorage) Insert(ctx context.Context, challenge *domain.WebAuthnChallenge) error {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	ws.lastID++
+	challenge.ID = ws.lastID
+
+	stored := *challenge
+	ws.challenges[stored.NonceHash] = &stored
+	return nil
+}
+
+func (ws *webAuthnChallengeStorage) Take(ctx context.Context, nonceHash string) (*domain.WebAuthnChallenge, error) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	challenge, ok := ws.challenges[nonceHash]
+	if !ok {
+		return nil, nil
+	}
+
+	delete(ws.challenges, nonceHash)
+	return challenge, nil
+}
+
+func (ws *webAuthnChallengeStorage) DeleteExpired(ctx context.Context, now time.Time) error {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	for nonceHash, challenge := range ws.challenges {
+		if !now.Before(challenge.ExpiresAt) {
+			delete(ws.challenges, nonceHash)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,101 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+)
+
+type webAuthnCredentialStorage struct {
+	mu          sync.Mutex
+	lastID      int
+	credentials map[int]*domain.WebAuthnCredential
+}
+
+func NewWebAuthnCredentialStorage() *webAuthnCredentialStorage {
+	return &webAuthnCredentialStorage{
+		credentials: make(map[int]*domain.WebAuthnCredential),
+	}
+}
+
+func (ws *webAuthnCredentialStorage) Insert(ctx context.Context, credential *domain.WebAuthnCredential) error {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	ws.lastID++
+	credential.ID = ws.lastID
+
+	stored := *credential
+	ws.credentials[stored.ID] = &stored
+	return nil
+}
+
+func (ws *webAuthnCredentialStorage) FindByCredentialID(ctx context.Context, credentialID string) (*domain.WebAuthnCredential, error) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	for _, credential := range ws.credentials {
+		if credential.CredentialID == credentialID {
+			copied := *credential
+			return &copied, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// FindByUserID returns the credentials of the user, the oldest first
+func (ws *webAuthnCredentialStorage) FindByUserID(ctx context.Context, userID int) ([]*domain.WebAuthnCredential, error) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	var credentials []*domain.WebAuthnCredential
+	for _, credential := range ws.credentials {
+		if credential.UserID == userID {
+			copied := *credential
+			credentials = append(credentials, &copied)
+		}
+	}
+
+	sort.Slice(credentials, func(i, j int) bool { return credentials[i].ID < credentials[j].ID })
+	return credentials, nil
+}
+
+func (ws *webAuthnCredentialStorage) UpdateSignCount(ctx context.Context, ID int, signCount uint32, lastUsedAt time.Time) (bool, error) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	credential, ok := ws.credentials[ID]
+	if !ok || (signCount == 0 && credential.SignCount != 0) || (signCount != 0 && credential.SignCount >= signCount) {
+		return false, nil
+	}
+
+	credential.SignCount = signCount
+	credential.LastUsedAt = &lastUsedAt
+	return true, nil
+}
+
+func (ws *webAuthnCredentialStorage) Rename(ctx context.Context, userID, ID int, name string) error {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	if credential, ok := ws.credentials[ID]; ok && credential.UserID == userID {
+		credential.Name = name
+	}
+
+	return nil
+}
+
+func (ws *webAuthnCredentialStorage) Delete(ctx context.Context, userID, ID int) error {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	if credential, ok := ws.credentials[ID]; ok && credential.UserID == userID {
+		delete(ws.credentials, ID)
+	}
+
+	return nil
+}
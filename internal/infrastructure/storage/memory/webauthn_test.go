@@ -0,0 +1,16 @@
+package memory
+
+import (
+	"testing"
+
+	"gitlab.com/evzpav/user-auth/internal/infrastructure/storage/storagetest"
+)
+
+func TestWebAuthnStorage(t *testing.T) {
+	storagetest.RunWebAuthnStorage(t, func(t *testing.T) storagetest.WebAuthnStorages {
+		return storagetest.WebAuthnStorages{
+			Credentials: NewWebAuthnCredentialStorage(),
+			Challenges:  NewWebAuthnChallengeStorage(),
+		}
+	})
+}
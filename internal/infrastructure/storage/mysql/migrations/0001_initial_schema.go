@@ -0,0 +1,113 @@
+package migrations
+
+import "gitlab.com/evzpav/user-auth/pkg/migrate"
+
+func init() {
+	register(migrate.Migration{
+		Version: 1,
+		Name:    "initial_schema",
+		Prepare: upgradeLegacyUsers,
+		Up: `
+CREATE TABLE IF NOT EXISTS users(
+   id SERIAL,
+   email VARCHAR(50) NOT NULL,
+   password CHAR(60) NOT NULL,
+   name VARCHAR(50),
+   address VARCHAR(100),
+   phone VARCHAR(30),
+   google_id VARCHAR(50),
+   email_verified_at DATETIME NULL,
+   totp_secret VARCHAR(64),
+   totp_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+   totp_last_step BIGINT NOT NULL DEFAULT 0,
+   mfa_recovery_codes TEXT
+);
+
+CREATE TABLE IF NOT EXISTS refresh_tokens(
+   id SERIAL,
+   user_id BIGINT UNSIGNED NOT NULL,
+   token_hash CHAR(64) NOT NULL,
+   family_id CHAR(36) NOT NULL,
+   created_at DATETIME NOT NULL,
+   expires_at DATETIME NOT NULL,
+   used_at DATETIME NULL,
+   revoked_at DATETIME NULL,
+   UNIQUE INDEX refresh_tokens_token_hash (token_hash),
+   INDEX refresh_tokens_family_id (family_id)
+);
+
+CREATE TABLE IF NOT EXISTS password_reset_tokens(
+   id SERIAL,
+   user_id BIGINT UNSIGNED NOT NULL,
+   token_hash CHAR(64) NOT NULL,
+   created_at DATETIME NOT NULL,
+   expires_at DATETIME NOT NULL,
+   used_at DATETIME NULL,
+   UNIQUE INDEX password_reset_tokens_token_hash (token_hash),
+   INDEX password_reset_tokens_user_id (user_id)
+);
+
+CREATE TABLE IF NOT EXISTS sessions(
+   id SERIAL,
+   user_id BIGINT UNSIGNED NOT NULL,
+   token_hash CHAR(64) NOT NULL,
+   ip VARCHAR(45),
+   user_agent VARCHAR(255),
+   created_at DATETIME NOT NULL,
+   last_seen_at DATETIME NOT NULL,
+   expires_at DATETIME NOT NULL,
+   UNIQUE INDEX sessions_token_hash (token_hash),
+   INDEX sessions_user_id (user_id)
+);
+
+CREATE TABLE IF NOT EXISTS web_authn_credentials(
+   id SERIAL,
+   user_id BIGINT UNSIGNED NOT NULL,
+   name VARCHAR(50) NOT NULL,
+   credential_id VARCHAR(1400) CHARACTER SET ascii NOT NULL,
+   public_key BLOB NOT NULL,
+   sign_count INT UNSIGNED NOT NULL DEFAULT 0,
+   transports VARCHAR(255),
+   created_at DATETIME NOT NULL,
+   last_used_at DATETIME NULL,
+   UNIQUE INDEX web_authn_credentials_credential_id (credential_id),
+   INDEX web_authn_credentials_user_id (user_id)
+);
+
+CREATE TABLE IF NOT EXISTS throttle_entries(
+   throttle_key VARCHAR(255) NOT NULL PRIMARY KEY,
+   attempts INT NOT NULL DEFAULT 0,
+   locked_until DATETIME NULL,
+   expires_at DATETIME NOT NULL,
+   INDEX throttle_entries_expires_at (expires_at)
+);
+
+CREATE TABLE IF NOT EXISTS jobs(
+   id SERIAL,
+   kind VARCHAR(50) NOT NULL,
+   payload MEDIUMTEXT NOT NULL,
+   status VARCHAR(10) NOT NULL,
+   attempts INT NOT NULL DEFAULT 0,
+   max_attempts INT NOT NULL,
+   next_run_at DATETIME NOT NULL,
+   locked_until DATETIME NULL,
+   claim_token CHAR(36) NULL,
+   last_error TEXT,
+   created_at DATETIME NOT NULL,
+   updated_at DATETIME NOT NULL,
+   finished_at DATETIME NULL,
+   INDEX jobs_status_next_run_at (status, next_run_at),
+   INDEX jobs_claim_token (claim_token)
+);
+`,
+		Down: `
+DROP TABLE IF EXISTS jobs;
+DROP TABLE IF EXISTS throttle_entries;
+DROP TABLE IF EXISTS web_authn_credentials;
+DROP TABLE IF EXISTS sessions;
+DROP TABLE IF EXISTS password_reset_tokens;
+DROP TABLE IF EXISTS refresh_tokens;
+DROP TABLE IF EXISTS users;
+`,
+	})
+}
@@ -0,0 +1,45 @@
+package migrations
+
+import "gitlab.com/evzpav/user-auth/pkg/migrate"
+
+func init() {
+	register(migrate.Migration{
+		Version: 2,
+		Name:    "users_constraints_and_timestamps",
+		Prepare: checkDuplicatedEmails,
+		Up: `
+ALTER TABLE users
+   ADD PRIMARY KEY (id),
+   ADD UNIQUE INDEX users_email (email),
+   ADD INDEX users_google_id (google_id),
+   ADD COLUMN created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+   ADD COLUMN updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP;
+
+ALTER TABLE refresh_tokens
+   ADD PRIMARY KEY (id),
+   ADD INDEX refresh_tokens_user_id (user_id);
+
+ALTER TABLE password_reset_tokens ADD PRIMARY KEY (id);
+ALTER TABLE sessions ADD PRIMARY KEY (id);
+ALTER TABLE web_authn_credentials ADD PRIMARY KEY (id);
+ALTER TABLE jobs ADD PRIMARY KEY (id);
+`,
+		Down: `
+ALTER TABLE jobs DROP PRIMARY KEY;
+ALTER TABLE web_authn_credentials DROP PRIMARY KEY;
+ALTER TABLE sessions DROP PRIMARY KEY;
+ALTER TABLE password_reset_tokens DROP PRIMARY KEY;
+
+ALTER TABLE refresh_tokens
+   DROP INDEX refresh_tokens_user_id,
+   DROP PRIMARY KEY;
+
+ALTER TABLE users
+   DROP COLUMN updated_at,
+   DROP COLUMN created_at,
+   DROP INDEX users_google_id,
+   DROP INDEX users_email,
+   DROP PRIMARY KEY;
+`,
+	})
+}
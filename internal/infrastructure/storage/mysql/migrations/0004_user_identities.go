@@ -0,0 +1,47 @@
+package migrations
+
+import "gitlab.com/evzpav/user-auth/pkg/migrate"
+
+func init() {
+	register(migrate.Migration{
+		Version: 4,
+		Name:    "user_identities",
+		Up: `
+CREATE TABLE IF NOT EXISTS user_identities(
+   id SERIAL,
+   user_id BIGINT UNSIGNED NOT NULL,
+   provider VARCHAR(50) CHARACTER SET ascii NOT NULL,
+   subject VARCHAR(255) CHARACTER SET ascii COLLATE ascii_bin NOT NULL,
+   email VARCHAR(255) NOT NULL DEFAULT '',
+   linked_at DATETIME NOT NULL,
+   UNIQUE INDEX user_identities_provider_subject (provider, subject),
+   INDEX user_identities_user_id (user_id)
+);
+
+INSERT IGNORE INTO user_identities (user_id, provider, subject, email, linked_at)
+   SELECT id, 'google', google_id, email, created_at FROM users WHERE google_id IS NOT NULL AND google_id <> '';
+
+INSERT IGNORE INTO user_identities (user_id, provider, subject, email, linked_at)
+   SELECT id, 'github', github_id, email, created_at FROM users WHERE github_id IS NOT NULL AND github_id <> '';
+
+ALTER TABLE users
+   DROP INDEX users_github_id,
+   DROP INDEX users_google_id,
+   DROP COLUMN github_id,
+   DROP COLUMN google_id;
+`,
+		Down: `
+ALTER TABLE users
+   ADD COLUMN google_id VARCHAR(50),
+   ADD COLUMN github_id VARCHAR(50),
+   ADD INDEX users_google_id (google_id),
+   ADD INDEX users_github_id (github_id);
+
+UPDATE users SET
+   google_id = (SELECT MIN(subject) FROM user_identities WHERE user_id = users.id AND provider = 'google'),
+   github_id = (SELECT MIN(subject) FROM user_identities WHERE user_id = users.id AND provider = 'github');
+
+DROP TABLE user_identities;
+`,
+	})
+}
@@ -0,0 +1,69 @@
+package migrations
+
+import "gitlab.com/evzpav/user-auth/pkg/migrate"
+
+func init() {
+	register(migrate.Migration{
+		Version: 5,
+		Name:    "oauth",
+		Up: `
+CREATE TABLE IF NOT EXISTS oauth_clients(
+   id SERIAL,
+   client_id CHAR(36) CHARACTER SET ascii NOT NULL,
+   secret_hash VARCHAR(64) CHARACTER SET ascii NOT NULL DEFAULT '',
+   name VARCHAR(255) NOT NULL,
+   redirect_uris TEXT NOT NULL,
+   scopes VARCHAR(1000) NOT NULL DEFAULT '',
+   created_at DATETIME NOT NULL,
+   UNIQUE INDEX oauth_clients_client_id (client_id)
+);
+
+CREATE TABLE IF NOT EXISTS oauth_authorization_codes(
+   id SERIAL,
+   code_hash CHAR(64) NOT NULL,
+   client_id CHAR(36) CHARACTER SET ascii NOT NULL,
+   user_id BIGINT UNSIGNED NOT NULL,
+   redirect_uri TEXT NOT NULL,
+   scope VARCHAR(1000) NOT NULL DEFAULT '',
+   code_challenge VARCHAR(64) CHARACTER SET ascii NOT NULL,
+   family_id CHAR(36) NOT NULL,
+   created_at DATETIME NOT NULL,
+   expires_at DATETIME NOT NULL,
+   used_at DATETIME NULL,
+   UNIQUE INDEX oauth_authorization_codes_code_hash (code_hash)
+);
+
+CREATE TABLE IF NOT EXISTS oauth_tokens(
+   id SERIAL,
+   token_hash CHAR(64) NOT NULL,
+   kind VARCHAR(20) NOT NULL,
+   client_id CHAR(36) CHARACTER SET ascii NOT NULL,
+   user_id BIGINT UNSIGNED NOT NULL DEFAULT 0,
+   scope VARCHAR(1000) NOT NULL DEFAULT '',
+   family_id CHAR(36) NOT NULL,
+   created_at DATETIME NOT NULL,
+   expires_at DATETIME NOT NULL,
+   used_at DATETIME NULL,
+   revoked_at DATETIME NULL,
+   UNIQUE INDEX oauth_tokens_token_hash (token_hash),
+   INDEX oauth_tokens_family_id (family_id),
+   INDEX oauth_tokens_client_id (client_id)
+);
+
+CREATE TABLE IF NOT EXISTS oauth_consents(
+   id SERIAL,
+   user_id BIGINT UNSIGNED NOT NULL,
+   client_id CHAR(36) CHARACTER SET ascii NOT NULL,
+   scope VARCHAR(1000) NOT NULL DEFAULT '',
+   granted_at DATETIME NOT NULL,
+   UNIQUE INDEX oauth_consents_user_id_client_id (user_id, client_id)
+);
+`,
+		Down: `
+DROP TABLE IF EXISTS oauth_consents;
+DROP TABLE IF EXISTS oauth_tokens;
+DROP TABLE IF EXISTS oauth_authorization_codes;
+DROP TABLE IF EXISTS oauth_clients;
+`,
+	})
+}
@@ -0,0 +1,24 @@
+package migrations
+
+import "gitlab.com/evzpav/user-auth/pkg/migrate"
+
+func init() {
+	register(migrate.Migration{
+		Version: 6,
+		Name:    "oidc",
+		Up: `
+ALTER TABLE oauth_clients
+   ADD COLUMN post_logout_redirect_uris TEXT NOT NULL;
+
+ALTER TABLE oauth_authorization_codes
+   ADD COLUMN nonce VARCHAR(255) NOT NULL DEFAULT '';
+`,
+		Down: `
+ALTER TABLE oauth_authorization_codes
+   DROP COLUMN nonce;
+
+ALTER TABLE oauth_clients
+   DROP COLUMN post_logout_redirect_uris;
+`,
+	})
+}
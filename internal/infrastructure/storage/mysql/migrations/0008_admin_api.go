@@ -0,0 +1,47 @@
+package migrations
+
+import "gitlab.com/evzpav/user-auth/pkg/migrate"
+
+func init() {
+	register(migrate.Migration{
+		Version: 8,
+		Name:    "admin_api",
+		Up: `
+ALTER TABLE users
+   ADD COLUMN deleted_at DATETIME NULL,
+   ADD INDEX users_created_at (created_at);
+
+CREATE TABLE IF NOT EXISTS admin_api_keys(
+   id SERIAL,
+   name VARCHAR(255) NOT NULL,
+   prefix VARCHAR(20) CHARACTER SET ascii NOT NULL,
+   key_hash CHAR(64) CHARACTER SET ascii NOT NULL,
+   permissions VARCHAR(1000) NOT NULL DEFAULT '',
+   created_at DATETIME NOT NULL,
+   last_used_at DATETIME NULL,
+   revoked_at DATETIME NULL,
+   UNIQUE INDEX admin_api_keys_key_hash (key_hash)
+);
+
+INSERT INTO permissions (name, description) VALUES
+   ('users:write', 'Create and update accounts'),
+   ('users:delete', 'Delete and restore accounts');
+
+INSERT INTO role_permissions (role_id, permission_id)
+   SELECT roles.id, permissions.id FROM roles, permissions
+   WHERE roles.name = 'admin' AND permissions.name IN ('users:write', 'users:delete');
+`,
+		Down: `
+DELETE role_permissions FROM role_permissions
+   JOIN permissions ON permissions.id = role_permissions.permission_id
+   WHERE permissions.name IN ('users:write', 'users:delete');
+DELETE FROM permissions WHERE name IN ('users:write', 'users:delete');
+
+DROP TABLE admin_api_keys;
+
+ALTER TABLE users
+   DROP INDEX users_created_at,
+   DROP COLUMN deleted_at;
+`,
+	})
+}
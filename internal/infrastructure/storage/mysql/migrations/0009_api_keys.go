@@ -0,0 +1,29 @@
+package migrations
+
+import "gitlab.com/evzpav/user-auth/pkg/migrate"
+
+func init() {
+	register(migrate.Migration{
+		Version: 9,
+		Name:    "api_keys",
+		Up: `
+CREATE TABLE IF NOT EXISTS api_keys(
+   id SERIAL,
+   user_id BIGINT UNSIGNED NOT NULL,
+   name VARCHAR(255) NOT NULL,
+   prefix VARCHAR(20) CHARACTER SET ascii NOT NULL,
+   key_hash CHAR(64) CHARACTER SET ascii NOT NULL,
+   scopes VARCHAR(1000) NOT NULL DEFAULT '',
+   created_at DATETIME NOT NULL,
+   expires_at DATETIME NOT NULL,
+   last_used_at DATETIME NULL,
+   revoked_at DATETIME NULL,
+   UNIQUE INDEX api_keys_key_hash (key_hash),
+   INDEX api_keys_user_id (user_id)
+);
+`,
+		Down: `
+DROP TABLE api_keys;
+`,
+	})
+}
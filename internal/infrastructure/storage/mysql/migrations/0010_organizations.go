@@ -0,0 +1,52 @@
+package migrations
+
+import "gitlab.com/evzpav/user-auth/pkg/migrate"
+
+func init() {
+	register(migrate.Migration{
+		Version: 10,
+		Name:    "organizations",
+		Up: `
+CREATE TABLE IF NOT EXISTS organizations(
+   id SERIAL,
+   name VARCHAR(255) NOT NULL,
+   created_at DATETIME NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS organization_members(
+   organization_id BIGINT UNSIGNED NOT NULL,
+   user_id BIGINT UNSIGNED NOT NULL,
+   role VARCHAR(20) CHARACTER SET ascii NOT NULL,
+   created_at DATETIME NOT NULL,
+   PRIMARY KEY (organization_id, user_id),
+   INDEX organization_members_user_id (user_id)
+);
+
+CREATE TABLE IF NOT EXISTS organization_invitations(
+   id SERIAL,
+   organization_id BIGINT UNSIGNED NOT NULL,
+   email VARCHAR(255) NOT NULL,
+   role VARCHAR(20) CHARACTER SET ascii NOT NULL,
+   invited_by BIGINT UNSIGNED NOT NULL,
+   created_at DATETIME NOT NULL,
+   expires_at DATETIME NOT NULL,
+   accepted_at DATETIME NULL,
+   revoked_at DATETIME NULL,
+   INDEX organization_invitations_organization_id (organization_id)
+);
+
+ALTER TABLE sessions ADD COLUMN organization_id BIGINT UNSIGNED NULL;
+
+ALTER TABLE refresh_tokens ADD COLUMN organization_id BIGINT UNSIGNED NULL;
+`,
+		Down: `
+ALTER TABLE refresh_tokens DROP COLUMN organization_id;
+
+ALTER TABLE sessions DROP COLUMN organization_id;
+
+DROP TABLE organization_invitations;
+DROP TABLE organization_members;
+DROP TABLE organizations;
+`,
+	})
+}
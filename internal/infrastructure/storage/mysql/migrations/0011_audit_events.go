@@ -0,0 +1,40 @@
+package migrations
+
+import "gitlab.com/evzpav/user-auth/pkg/migrate"
+
+func init() {
+	register(migrate.Migration{
+		Version: 11,
+		Name:    "audit_events",
+		Up: `
+CREATE TABLE IF NOT EXISTS audit_events(
+   id SERIAL,
+   type VARCHAR(40) CHARACTER SET ascii NOT NULL,
+   actor_id BIGINT UNSIGNED NULL,
+   admin_api_key_id BIGINT UNSIGNED NULL,
+   user_id BIGINT UNSIGNED NULL,
+   ip VARCHAR(45) NOT NULL DEFAULT '',
+   user_agent VARCHAR(512) NOT NULL DEFAULT '',
+   changes TEXT NOT NULL,
+   created_at DATETIME NOT NULL,
+   INDEX audit_events_user_id (user_id),
+   INDEX audit_events_actor_id (actor_id),
+   INDEX audit_events_created_at (created_at)
+);
+
+INSERT INTO permissions (name, description) VALUES ('audit:read', 'Query the audit log');
+
+INSERT INTO role_permissions (role_id, permission_id)
+   SELECT roles.id, permissions.id FROM roles, permissions
+   WHERE roles.name = 'admin' AND permissions.name = 'audit:read';
+`,
+		Down: `
+DELETE role_permissions FROM role_permissions
+   JOIN permissions ON permissions.id = role_permissions.permission_id
+   WHERE permissions.name = 'audit:read';
+DELETE FROM permissions WHERE name = 'audit:read';
+
+DROP TABLE audit_events;
+`,
+	})
+}
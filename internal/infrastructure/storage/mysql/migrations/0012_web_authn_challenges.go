@@ -0,0 +1,26 @@
+package migrations
+
+import "gitlab.com/evzpav/user-auth/pkg/migrate"
+
+func init() {
+	register(migrate.Migration{
+		Version: 12,
+		Name:    "web_authn_challenges",
+		Up: `
+CREATE TABLE IF NOT EXISTS web_authn_challenges(
+   id SERIAL,
+   nonce_hash VARCHAR(64) CHARACTER SET ascii NOT NULL,
+   ceremony VARCHAR(10) CHARACTER SET ascii NOT NULL,
+   user_id BIGINT UNSIGNED NOT NULL DEFAULT 0,
+   challenge VARCHAR(64) CHARACTER SET ascii NOT NULL,
+   created_at DATETIME NOT NULL,
+   expires_at DATETIME NOT NULL,
+   UNIQUE INDEX web_authn_challenges_nonce_hash (nonce_hash),
+   INDEX web_authn_challenges_expires_at (expires_at)
+);
+`,
+		Down: `
+DROP TABLE web_authn_challenges;
+`,
+	})
+}
@@ -0,0 +1,82 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// legacyUserColumns are the columns of the users table of 0001 missing from the table created by
+// docker/mysql/init.sql before the migrations existed
+var legacyUserColumns = []struct {
+	name       string
+	definition string
+}{
+	{"email_verified_at", "DATETIME NULL"},
+	{"totp_secret", "VARCHAR(64)"},
+	{"totp_enabled", "BOOLEAN NOT NULL DEFAULT FALSE"},
+	{"totp_last_step", "BIGINT NOT NULL DEFAULT 0"},
+	{"mfa_recovery_codes", "TEXT"},
+}
+
+// upgradeLegacyUsers adds the missing columns to a users table created before the migrations, which
+// CREATE TABLE IF NOT EXISTS would leave as is. The legacy token columns are kept, they are unused.
+func upgradeLegacyUsers(ctx context.Context, tx *sql.Tx) error {
+	var tables int
+	err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM information_schema.tables
+		WHERE table_schema = DATABASE() AND table_name = 'users'`).Scan(&tables)
+	if err != nil || tables == 0 {
+		return err
+	}
+
+	for _, column := range legacyUserColumns {
+		var found int
+		err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM information_schema.columns
+			WHERE table_schema = DATABASE() AND table_name = 'users' AND column_name = ?`, column.name).Scan(&found)
+		if err != nil {
+			return err
+		}
+
+		if found > 0 {
+			continue
+		}
+
+		if _, err := tx.ExecContext(ctx, "ALTER TABLE users ADD COLUMN "+column.name+" "+column.definition); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkDuplicatedEmails stops the migration adding the unique index of the email while users share
+// one. Emails are grouped with the case insensitive collation of the column, like the index.
+func checkDuplicatedEmails(ctx context.Context, tx *sql.Tx) error {
+	rows, err := tx.QueryContext(ctx, `SELECT email FROM users GROUP BY email HAVING COUNT(*) > 1 ORDER BY email LIMIT 10`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var emails []string
+	for rows.Next() {
+		var email string
+		if err := rows.Scan(&email); err != nil {
+			return err
+		}
+
+		emails = append(emails, email)
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if len(emails) > 0 {
+		return fmt.Errorf("several users have the email %s, merge or delete the duplicated accounts and run the migrations again",
+			strings.Join(emails, ", "))
+	}
+
+	return nil
+}
@@ -1,13 +1,42 @@
 package mysql
 
 import (
-	_ "github.com/jinzhu/gorm/dialects/mysql"
+	"time"
+
+	driver "github.com/go-sql-driver/mysql"
 	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/mysql"
+
+	"gitlab.com/evzpav/user-auth/internal/infrastructure/storage/sqlstore"
 )
 
+// Dialect runs the storages of sqlstore on mysql. The assignments of ON DUPLICATE KEY UPDATE are
+// evaluated left to right, so the attempts and lock are reset based on the previous expiration.
+var Dialect = sqlstore.Dialect{
+	IsUniqueViolation: isDuplicateEntry,
+	ClaimJobs: `UPDATE jobs SET status = ?, attempts = attempts + 1, claim_token = ?, locked_until = ?, updated_at = ?
+		WHERE (status = ? AND next_run_at <= ?) OR (status = ? AND locked_until <= ?)
+		ORDER BY next_run_at, id LIMIT ?`,
+	IncrementThrottle: `INSERT INTO throttle_entries (throttle_key, attempts, expires_at) VALUES (?, 1, ?)
+		ON DUPLICATE KEY UPDATE
+			attempts = IF(expires_at <= ?, 1, attempts + 1),
+			locked_until = IF(expires_at <= ?, NULL, locked_until),
+			expires_at = GREATEST(expires_at, VALUES(expires_at))`,
+	InsertUserRole: `INSERT IGNORE INTO user_roles (user_id, role_id) VALUES (?, ?)`,
+}
+
 // New creates new database connection to a mysql database
 func New(url string) (*gorm.DB, error) {
-	db, err := gorm.Open("mysql", url)
+	cfg, err := driver.ParseDSN(url)
+	if err != nil {
+		return nil, err
+	}
+
+	// timestamps are stored in UTC and scanned into time.Time
+	cfg.ParseTime = true
+	cfg.Loc = time.UTC
+
+	db, err := gorm.Open("mysql", cfg.FormatDSN())
 	if err != nil {
 		return nil, err
 	}
@@ -15,3 +44,9 @@ func New(url string) (*gorm.DB, error) {
 	db.LogMode(true)
 	return db, nil
 }
+
+// isDuplicateEntry tells if the statement failed because of a unique index
+func isDuplicateEntry(err error) bool {
+	mysqlErr, ok := err.(*driver.MySQLError)
+	return ok && mysqlErr.Number == 1062
+}
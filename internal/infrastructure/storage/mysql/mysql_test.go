@@ -1,26 +1,27 @@
-package mysql_test
+package mysql
 
-// func TestNew(t *testing.T) {
-// 	container := mock.NewPGContainer(t)
+import (
+	"os"
+	"testing"
 
-// 	defer container.Shutdown()
+	"github.com/stretchr/testify/require"
 
-// 	dbLogTest, err := postgres.New("postgres://postgres:postgres@"+container.Addr+"/postgres?sslmode=disable", 0, true)
-// 	if err != nil {
-// 		t.Fatalf("Error establishing connection %v", err)
-// 	}
-// 	dbLogTest.Close()
+	"gitlab.com/evzpav/user-auth/internal/infrastructure/storage/mysql/migrations"
+	"gitlab.com/evzpav/user-auth/internal/infrastructure/storage/storagetest"
+)
 
-// 	db, err := postgres.New("postgres://postgres:postgres@"+container.Addr+"/postgres?sslmode=disable", 1, true)
-// 	if err != nil {
-// 		t.Fatalf("Error establishing connection %v", err)
-// 	}
+// envVarTestURL points to a disposable database, its tables are emptied by the tests
+const envVarTestURL = "MYSQL_TEST_URL"
 
-// 	var user model.User
-// 	db.Select(&user)
+func TestStorages(t *testing.T) {
+	url := os.Getenv(envVarTestURL)
+	if url == "" {
+		t.Skipf("%s is not set", envVarTestURL)
+	}
 
-// 	assert.NotNil(t, db)
+	db, err := New(url)
+	require.NoError(t, err)
+	defer db.Close()
 
-// 	db.Close()
-
-// }
+	storagetest.RunSQLStorages(t, storagetest.SQLDriver{Name: "mysql", DB: db, Dialect: Dialect, Migrations: migrations.All()})
+}
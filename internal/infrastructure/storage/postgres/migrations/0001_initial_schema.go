@@ -0,0 +1,121 @@
+package migrations
+
+import "gitlab.com/evzpav/user-auth/pkg/migrate"
+
+func init() {
+	register(migrate.Migration{
+		Version: 1,
+		Name:    "initial_schema",
+		Up: `
+CREATE EXTENSION IF NOT EXISTS citext;
+
+CREATE TABLE IF NOT EXISTS users(
+   id BIGSERIAL PRIMARY KEY,
+   email CITEXT NOT NULL,
+   password CHAR(60) NOT NULL,
+   name VARCHAR(50),
+   address VARCHAR(100),
+   phone VARCHAR(30),
+   google_id VARCHAR(50),
+   email_verified_at TIMESTAMPTZ NULL,
+   totp_secret VARCHAR(64),
+   totp_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+   totp_last_step BIGINT NOT NULL DEFAULT 0,
+   mfa_recovery_codes TEXT,
+   CONSTRAINT users_email UNIQUE (email)
+);
+
+CREATE TABLE IF NOT EXISTS refresh_tokens(
+   id BIGSERIAL PRIMARY KEY,
+   user_id BIGINT NOT NULL,
+   token_hash CHAR(64) NOT NULL,
+   family_id CHAR(36) NOT NULL,
+   created_at TIMESTAMPTZ NOT NULL,
+   expires_at TIMESTAMPTZ NOT NULL,
+   used_at TIMESTAMPTZ NULL,
+   revoked_at TIMESTAMPTZ NULL,
+   CONSTRAINT refresh_tokens_token_hash UNIQUE (token_hash)
+);
+
+CREATE INDEX IF NOT EXISTS refresh_tokens_family_id ON refresh_tokens (family_id);
+CREATE INDEX IF NOT EXISTS refresh_tokens_user_id ON refresh_tokens (user_id);
+
+CREATE TABLE IF NOT EXISTS password_reset_tokens(
+   id BIGSERIAL PRIMARY KEY,
+   user_id BIGINT NOT NULL,
+   token_hash CHAR(64) NOT NULL,
+   created_at TIMESTAMPTZ NOT NULL,
+   expires_at TIMESTAMPTZ NOT NULL,
+   used_at TIMESTAMPTZ NULL,
+   CONSTRAINT password_reset_tokens_token_hash UNIQUE (token_hash)
+);
+
+CREATE INDEX IF NOT EXISTS password_reset_tokens_user_id ON password_reset_tokens (user_id);
+
+CREATE TABLE IF NOT EXISTS sessions(
+   id BIGSERIAL PRIMARY KEY,
+   user_id BIGINT NOT NULL,
+   token_hash CHAR(64) NOT NULL,
+   ip VARCHAR(45),
+   user_agent VARCHAR(255),
+   created_at TIMESTAMPTZ NOT NULL,
+   last_seen_at TIMESTAMPTZ NOT NULL,
+   expires_at TIMESTAMPTZ NOT NULL,
+   CONSTRAINT sessions_token_hash UNIQUE (token_hash)
+);
+
+CREATE INDEX IF NOT EXISTS sessions_user_id ON sessions (user_id);
+
+CREATE TABLE IF NOT EXISTS web_authn_credentials(
+   id BIGSERIAL PRIMARY KEY,
+   user_id BIGINT NOT NULL,
+   name VARCHAR(50) NOT NULL,
+   credential_id VARCHAR(1400) NOT NULL,
+   public_key BYTEA NOT NULL,
+   sign_count BIGINT NOT NULL DEFAULT 0,
+   transports VARCHAR(255),
+   created_at TIMESTAMPTZ NOT NULL,
+   last_used_at TIMESTAMPTZ NULL,
+   CONSTRAINT web_authn_credentials_credential_id UNIQUE (credential_id)
+);
+
+CREATE INDEX IF NOT EXISTS web_authn_credentials_user_id ON web_authn_credentials (user_id);
+
+CREATE TABLE IF NOT EXISTS throttle_entries(
+   throttle_key VARCHAR(255) NOT NULL PRIMARY KEY,
+   attempts INT NOT NULL DEFAULT 0,
+   locked_until TIMESTAMPTZ NULL,
+   expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS throttle_entries_expires_at ON throttle_entries (expires_at);
+
+CREATE TABLE IF NOT EXISTS jobs(
+   id BIGSERIAL PRIMARY KEY,
+   kind VARCHAR(50) NOT NULL,
+   payload TEXT NOT NULL,
+   status VARCHAR(10) NOT NULL,
+   attempts INT NOT NULL DEFAULT 0,
+   max_attempts INT NOT NULL,
+   next_run_at TIMESTAMPTZ NOT NULL,
+   locked_until TIMESTAMPTZ NULL,
+   claim_token CHAR(36) NULL,
+   last_error TEXT,
+   created_at TIMESTAMPTZ NOT NULL,
+   updated_at TIMESTAMPTZ NOT NULL,
+   finished_at TIMESTAMPTZ NULL
+);
+
+CREATE INDEX IF NOT EXISTS jobs_status_next_run_at ON jobs (status, next_run_at);
+`,
+		Down: `
+DROP TABLE IF EXISTS jobs;
+DROP TABLE IF EXISTS throttle_entries;
+DROP TABLE IF EXISTS web_authn_credentials;
+DROP TABLE IF EXISTS sessions;
+DROP TABLE IF EXISTS password_reset_tokens;
+DROP TABLE IF EXISTS refresh_tokens;
+DROP TABLE IF EXISTS users;
+`,
+	})
+}
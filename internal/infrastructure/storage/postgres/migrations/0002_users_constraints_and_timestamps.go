@@ -0,0 +1,24 @@
+package migrations
+
+import "gitlab.com/evzpav/user-auth/pkg/migrate"
+
+func init() {
+	register(migrate.Migration{
+		Version: 2,
+		Name:    "users_constraints_and_timestamps",
+		Up: `
+ALTER TABLE users
+   ADD COLUMN created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+   ADD COLUMN updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+CREATE INDEX users_google_id ON users (google_id);
+`,
+		Down: `
+DROP INDEX users_google_id;
+
+ALTER TABLE users
+   DROP COLUMN updated_at,
+   DROP COLUMN created_at;
+`,
+	})
+}
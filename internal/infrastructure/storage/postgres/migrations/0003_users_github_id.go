@@ -0,0 +1,20 @@
+package migrations
+
+import "gitlab.com/evzpav/user-auth/pkg/migrate"
+
+func init() {
+	register(migrate.Migration{
+		Version: 3,
+		Name:    "users_github_id",
+		Up: `
+ALTER TABLE users ADD COLUMN github_id VARCHAR(50);
+
+CREATE INDEX users_github_id ON users (github_id);
+`,
+		Down: `
+DROP INDEX users_github_id;
+
+ALTER TABLE users DROP COLUMN github_id;
+`,
+	})
+}
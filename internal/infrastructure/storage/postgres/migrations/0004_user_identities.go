@@ -0,0 +1,55 @@
+package migrations
+
+import "gitlab.com/evzpav/user-auth/pkg/migrate"
+
+func init() {
+	register(migrate.Migration{
+		Version: 4,
+		Name:    "user_identities",
+		Up: `
+CREATE TABLE IF NOT EXISTS user_identities(
+   id BIGSERIAL PRIMARY KEY,
+   user_id BIGINT NOT NULL,
+   provider VARCHAR(50) NOT NULL,
+   subject VARCHAR(255) NOT NULL,
+   email VARCHAR(255) NOT NULL DEFAULT '',
+   linked_at TIMESTAMPTZ NOT NULL,
+   CONSTRAINT user_identities_provider_subject UNIQUE (provider, subject)
+);
+
+CREATE INDEX IF NOT EXISTS user_identities_user_id ON user_identities (user_id);
+
+INSERT INTO user_identities (user_id, provider, subject, email, linked_at)
+   SELECT id, 'google', google_id, email, created_at FROM users WHERE google_id IS NOT NULL AND google_id <> ''
+   ON CONFLICT DO NOTHING;
+
+INSERT INTO user_identities (user_id, provider, subject, email, linked_at)
+   SELECT id, 'github', github_id, email, created_at FROM users WHERE github_id IS NOT NULL AND github_id <> ''
+   ON CONFLICT DO NOTHING;
+
+DROP INDEX users_github_id;
+DROP INDEX users_google_id;
+
+-- users of login providers have an empty password, which CHAR pads with spaces
+ALTER TABLE users
+   DROP COLUMN github_id,
+   DROP COLUMN google_id,
+   ALTER COLUMN password TYPE VARCHAR(60);
+`,
+		Down: `
+ALTER TABLE users
+   ADD COLUMN google_id VARCHAR(50),
+   ADD COLUMN github_id VARCHAR(50),
+   ALTER COLUMN password TYPE CHAR(60);
+
+CREATE INDEX users_google_id ON users (google_id);
+CREATE INDEX users_github_id ON users (github_id);
+
+UPDATE users SET
+   google_id = (SELECT MIN(subject) FROM user_identities WHERE user_id = users.id AND provider = 'google'),
+   github_id = (SELECT MIN(subject) FROM user_identities WHERE user_id = users.id AND provider = 'github');
+
+DROP TABLE user_identities;
+`,
+	})
+}
@@ -0,0 +1,70 @@
+package migrations
+
+import "gitlab.com/evzpav/user-auth/pkg/migrate"
+
+func init() {
+	register(migrate.Migration{
+		Version: 5,
+		Name:    "oauth",
+		Up: `
+CREATE TABLE IF NOT EXISTS oauth_clients(
+   id BIGSERIAL PRIMARY KEY,
+   client_id CHAR(36) NOT NULL,
+   secret_hash VARCHAR(64) NOT NULL DEFAULT '',
+   name VARCHAR(255) NOT NULL,
+   redirect_uris TEXT NOT NULL,
+   scopes VARCHAR(1000) NOT NULL DEFAULT '',
+   created_at TIMESTAMPTZ NOT NULL,
+   CONSTRAINT oauth_clients_client_id UNIQUE (client_id)
+);
+
+CREATE TABLE IF NOT EXISTS oauth_authorization_codes(
+   id BIGSERIAL PRIMARY KEY,
+   code_hash CHAR(64) NOT NULL,
+   client_id CHAR(36) NOT NULL,
+   user_id BIGINT NOT NULL,
+   redirect_uri TEXT NOT NULL,
+   scope VARCHAR(1000) NOT NULL DEFAULT '',
+   code_challenge VARCHAR(64) NOT NULL,
+   family_id CHAR(36) NOT NULL,
+   created_at TIMESTAMPTZ NOT NULL,
+   expires_at TIMESTAMPTZ NOT NULL,
+   used_at TIMESTAMPTZ NULL,
+   CONSTRAINT oauth_authorization_codes_code_hash UNIQUE (code_hash)
+);
+
+CREATE TABLE IF NOT EXISTS oauth_tokens(
+   id BIGSERIAL PRIMARY KEY,
+   token_hash CHAR(64) NOT NULL,
+   kind VARCHAR(20) NOT NULL,
+   client_id CHAR(36) NOT NULL,
+   user_id BIGINT NOT NULL DEFAULT 0,
+   scope VARCHAR(1000) NOT NULL DEFAULT '',
+   family_id CHAR(36) NOT NULL,
+   created_at TIMESTAMPTZ NOT NULL,
+   expires_at TIMESTAMPTZ NOT NULL,
+   used_at TIMESTAMPTZ NULL,
+   revoked_at TIMESTAMPTZ NULL,
+   CONSTRAINT oauth_tokens_token_hash UNIQUE (token_hash)
+);
+
+CREATE INDEX IF NOT EXISTS oauth_tokens_family_id ON oauth_tokens (family_id);
+CREATE INDEX IF NOT EXISTS oauth_tokens_client_id ON oauth_tokens (client_id);
+
+CREATE TABLE IF NOT EXISTS oauth_consents(
+   id BIGSERIAL PRIMARY KEY,
+   user_id BIGINT NOT NULL,
+   client_id CHAR(36) NOT NULL,
+   scope VARCHAR(1000) NOT NULL DEFAULT '',
+   granted_at TIMESTAMPTZ NOT NULL,
+   CONSTRAINT oauth_consents_user_id_client_id UNIQUE (user_id, client_id)
+);
+`,
+		Down: `
+DROP TABLE IF EXISTS oauth_consents;
+DROP TABLE IF EXISTS oauth_tokens;
+DROP TABLE IF EXISTS oauth_authorization_codes;
+DROP TABLE IF EXISTS oauth_clients;
+`,
+	})
+}
@@ -0,0 +1,44 @@
+package migrations
+
+import "gitlab.com/evzpav/user-auth/pkg/migrate"
+
+func init() {
+	register(migrate.Migration{
+		Version: 8,
+		Name:    "admin_api",
+		Up: `
+ALTER TABLE users ADD COLUMN deleted_at TIMESTAMPTZ NULL;
+
+CREATE INDEX users_created_at ON users (created_at);
+
+CREATE TABLE IF NOT EXISTS admin_api_keys(
+   id BIGSERIAL PRIMARY KEY,
+   name VARCHAR(255) NOT NULL,
+   prefix VARCHAR(20) NOT NULL,
+   key_hash CHAR(64) NOT NULL,
+   permissions VARCHAR(1000) NOT NULL DEFAULT '',
+   created_at TIMESTAMPTZ NOT NULL,
+   last_used_at TIMESTAMPTZ NULL,
+   revoked_at TIMESTAMPTZ NULL,
+   CONSTRAINT admin_api_keys_key_hash UNIQUE (key_hash)
+);
+
+INSERT INTO permissions (name, description) VALUES
+   ('users:write', 'Create and update accounts'),
+   ('users:delete', 'Delete and restore accounts');
+
+INSERT INTO role_permissions (role_id, permission_id)
+   SELECT roles.id, permissions.id FROM roles, permissions
+   WHERE roles.name = 'admin' AND permissions.name IN ('users:write', 'users:delete');
+`,
+		Down: `
+DELETE FROM role_permissions WHERE permission_id IN (SELECT id FROM permissions WHERE name IN ('users:write', 'users:delete'));
+DELETE FROM permissions WHERE name IN ('users:write', 'users:delete');
+
+DROP TABLE admin_api_keys;
+
+DROP INDEX users_created_at;
+ALTER TABLE users DROP COLUMN deleted_at;
+`,
+	})
+}
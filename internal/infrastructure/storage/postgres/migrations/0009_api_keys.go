@@ -0,0 +1,30 @@
+package migrations
+
+import "gitlab.com/evzpav/user-auth/pkg/migrate"
+
+func init() {
+	register(migrate.Migration{
+		Version: 9,
+		Name:    "api_keys",
+		Up: `
+CREATE TABLE IF NOT EXISTS api_keys(
+   id BIGSERIAL PRIMARY KEY,
+   user_id BIGINT NOT NULL,
+   name VARCHAR(255) NOT NULL,
+   prefix VARCHAR(20) NOT NULL,
+   key_hash CHAR(64) NOT NULL,
+   scopes VARCHAR(1000) NOT NULL DEFAULT '',
+   created_at TIMESTAMPTZ NOT NULL,
+   expires_at TIMESTAMPTZ NOT NULL,
+   last_used_at TIMESTAMPTZ NULL,
+   revoked_at TIMESTAMPTZ NULL,
+   CONSTRAINT api_keys_key_hash UNIQUE (key_hash)
+);
+
+CREATE INDEX IF NOT EXISTS api_keys_user_id ON api_keys (user_id);
+`,
+		Down: `
+DROP TABLE api_keys;
+`,
+	})
+}
@@ -0,0 +1,54 @@
+package migrations
+
+import "gitlab.com/evzpav/user-auth/pkg/migrate"
+
+func init() {
+	register(migrate.Migration{
+		Version: 10,
+		Name:    "organizations",
+		Up: `
+CREATE TABLE IF NOT EXISTS organizations(
+   id BIGSERIAL PRIMARY KEY,
+   name VARCHAR(255) NOT NULL,
+   created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS organization_members(
+   organization_id BIGINT NOT NULL,
+   user_id BIGINT NOT NULL,
+   role VARCHAR(20) NOT NULL,
+   created_at TIMESTAMPTZ NOT NULL,
+   PRIMARY KEY (organization_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS organization_members_user_id ON organization_members (user_id);
+
+CREATE TABLE IF NOT EXISTS organization_invitations(
+   id BIGSERIAL PRIMARY KEY,
+   organization_id BIGINT NOT NULL,
+   email VARCHAR(255) NOT NULL,
+   role VARCHAR(20) NOT NULL,
+   invited_by BIGINT NOT NULL,
+   created_at TIMESTAMPTZ NOT NULL,
+   expires_at TIMESTAMPTZ NOT NULL,
+   accepted_at TIMESTAMPTZ NULL,
+   revoked_at TIMESTAMPTZ NULL
+);
+
+CREATE INDEX IF NOT EXISTS organization_invitations_organization_id ON organization_invitations (organization_id);
+
+ALTER TABLE sessions ADD COLUMN organization_id BIGINT NULL;
+
+ALTER TABLE refresh_tokens ADD COLUMN organization_id BIGINT NULL;
+`,
+		Down: `
+ALTER TABLE refresh_tokens DROP COLUMN organization_id;
+
+ALTER TABLE sessions DROP COLUMN organization_id;
+
+DROP TABLE organization_invitations;
+DROP TABLE organization_members;
+DROP TABLE organizations;
+`,
+	})
+}
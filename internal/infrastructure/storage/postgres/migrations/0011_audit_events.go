@@ -0,0 +1,39 @@
+package migrations
+
+import "gitlab.com/evzpav/user-auth/pkg/migrate"
+
+func init() {
+	register(migrate.Migration{
+		Version: 11,
+		Name:    "audit_events",
+		Up: `
+CREATE TABLE IF NOT EXISTS audit_events(
+   id BIGSERIAL PRIMARY KEY,
+   type VARCHAR(40) NOT NULL,
+   actor_id BIGINT NULL,
+   admin_api_key_id BIGINT NULL,
+   user_id BIGINT NULL,
+   ip VARCHAR(45) NOT NULL DEFAULT '',
+   user_agent VARCHAR(512) NOT NULL DEFAULT '',
+   changes TEXT NOT NULL DEFAULT '',
+   created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS audit_events_user_id ON audit_events (user_id);
+CREATE INDEX IF NOT EXISTS audit_events_actor_id ON audit_events (actor_id);
+CREATE INDEX IF NOT EXISTS audit_events_created_at ON audit_events (created_at);
+
+INSERT INTO permissions (name, description) VALUES ('audit:read', 'Query the audit log');
+
+INSERT INTO role_permissions (role_id, permission_id)
+   SELECT roles.id, permissions.id FROM roles, permissions
+   WHERE roles.name = 'admin' AND permissions.name = 'audit:read';
+`,
+		Down: `
+DELETE FROM role_permissions WHERE permission_id IN (SELECT id FROM permissions WHERE name = 'audit:read');
+DELETE FROM permissions WHERE name = 'audit:read';
+
+DROP TABLE audit_events;
+`,
+	})
+}
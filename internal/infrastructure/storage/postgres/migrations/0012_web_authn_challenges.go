@@ -0,0 +1,27 @@
+package migrations
+
+import "gitlab.com/evzpav/user-auth/pkg/migrate"
+
+func init() {
+	register(migrate.Migration{
+		Version: 12,
+		Name:    "web_authn_challenges",
+		Up: `
+CREATE TABLE IF NOT EXISTS web_authn_challenges(
+   id BIGSERIAL PRIMARY KEY,
+   nonce_hash VARCHAR(64) NOT NULL,
+   ceremony VARCHAR(10) NOT NULL,
+   user_id BIGINT NOT NULL DEFAULT 0,
+   challenge VARCHAR(64) NOT NULL,
+   created_at TIMESTAMPTZ NOT NULL,
+   expires_at TIMESTAMPTZ NOT NULL,
+   CONSTRAINT web_authn_challenges_nonce_hash UNIQUE (nonce_hash)
+);
+
+CREATE INDEX IF NOT EXISTS web_authn_challenges_expires_at ON web_authn_challenges (expires_at);
+`,
+		Down: `
+DROP TABLE web_authn_challenges;
+`,
+	})
+}
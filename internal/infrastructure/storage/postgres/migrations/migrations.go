@@ -0,0 +1,16 @@
+// Package migrations holds the schema of the postgres storage, new migrations are created with
+// user-auth migrate create <name>
+package migrations
+
+import "gitlab.com/evzpav/user-auth/pkg/migrate"
+
+var migrations []migrate.Migration
+
+func register(migration migrate.Migration) {
+	migrations = append(migrations, migration)
+}
+
+// All returns the migrations of the postgres storage
+func All() []migrate.Migration {
+	return migrations
+}
@@ -0,0 +1,45 @@
+package postgres
+
+import (
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/postgres"
+	"github.com/lib/pq"
+
+	"gitlab.com/evzpav/user-auth/internal/infrastructure/storage/sqlstore"
+)
+
+// Dialect runs the storages of sqlstore on postgres. The due jobs are locked with SKIP LOCKED, and
+// the assignments of ON CONFLICT DO UPDATE all read the row as it was before the statement.
+var Dialect = sqlstore.Dialect{
+	IsUniqueViolation: isUniqueViolation,
+	ClaimJobs: `UPDATE jobs SET status = ?, attempts = attempts + 1, claim_token = ?, locked_until = ?, updated_at = ?
+		WHERE id IN (
+			SELECT id FROM jobs
+			WHERE (status = ? AND next_run_at <= ?) OR (status = ? AND locked_until <= ?)
+			ORDER BY next_run_at, id LIMIT ?
+			FOR UPDATE SKIP LOCKED
+		)`,
+	IncrementThrottle: `INSERT INTO throttle_entries (throttle_key, attempts, expires_at) VALUES (?, 1, ?)
+		ON CONFLICT (throttle_key) DO UPDATE SET
+			attempts = CASE WHEN throttle_entries.expires_at <= ? THEN 1 ELSE throttle_entries.attempts + 1 END,
+			locked_until = CASE WHEN throttle_entries.expires_at <= ? THEN NULL ELSE throttle_entries.locked_until END,
+			expires_at = GREATEST(throttle_entries.expires_at, EXCLUDED.expires_at)`,
+	InsertUserRole: `INSERT INTO user_roles (user_id, role_id) VALUES (?, ?) ON CONFLICT DO NOTHING`,
+}
+
+// New creates new database connection to a postgres database
+func New(url string) (*gorm.DB, error) {
+	db, err := gorm.Open("postgres", url)
+	if err != nil {
+		return nil, err
+	}
+
+	db.LogMode(true)
+	return db, nil
+}
+
+// isUniqueViolation tells if the statement failed because of a unique index
+func isUniqueViolation(err error) bool {
+	pqErr, ok := err.(*pq.Error)
+	return ok && pqErr.Code == "23505"
+}
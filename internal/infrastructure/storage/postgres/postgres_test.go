@@ -0,0 +1,27 @@
+package postgres
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/evzpav/user-auth/internal/infrastructure/storage/postgres/migrations"
+	"gitlab.com/evzpav/user-auth/internal/infrastructure/storage/storagetest"
+)
+
+// envVarTestURL points to a disposable database, its tables are emptied by the tests
+const envVarTestURL = "POSTGRES_TEST_URL"
+
+func TestStorages(t *testing.T) {
+	url := os.Getenv(envVarTestURL)
+	if url == "" {
+		t.Skipf("%s is not set", envVarTestURL)
+	}
+
+	db, err := New(url)
+	require.NoError(t, err)
+	defer db.Close()
+
+	storagetest.RunSQLStorages(t, storagetest.SQLDriver{Name: "postgres", DB: db, Dialect: Dialect, Migrations: migrations.All()})
+}
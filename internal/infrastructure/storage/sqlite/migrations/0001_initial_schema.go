@@ -0,0 +1,114 @@
+package migrations
+
+import "gitlab.com/evzpav/user-auth/pkg/migrate"
+
+func init() {
+	register(migrate.Migration{
+		Version: 1,
+		Name:    "initial_schema",
+		Up: `
+CREATE TABLE IF NOT EXISTS users(
+   id INTEGER PRIMARY KEY AUTOINCREMENT,
+   email TEXT NOT NULL COLLATE NOCASE UNIQUE,
+   password TEXT NOT NULL,
+   name TEXT,
+   address TEXT,
+   phone TEXT,
+   google_id TEXT,
+   email_verified_at DATETIME NULL,
+   totp_secret TEXT,
+   totp_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+   totp_last_step INTEGER NOT NULL DEFAULT 0,
+   mfa_recovery_codes TEXT
+);
+
+CREATE TABLE IF NOT EXISTS refresh_tokens(
+   id INTEGER PRIMARY KEY AUTOINCREMENT,
+   user_id INTEGER NOT NULL,
+   token_hash TEXT NOT NULL UNIQUE,
+   family_id TEXT NOT NULL,
+   created_at DATETIME NOT NULL,
+   expires_at DATETIME NOT NULL,
+   used_at DATETIME NULL,
+   revoked_at DATETIME NULL
+);
+
+CREATE INDEX IF NOT EXISTS refresh_tokens_family_id ON refresh_tokens (family_id);
+CREATE INDEX IF NOT EXISTS refresh_tokens_user_id ON refresh_tokens (user_id);
+
+CREATE TABLE IF NOT EXISTS password_reset_tokens(
+   id INTEGER PRIMARY KEY AUTOINCREMENT,
+   user_id INTEGER NOT NULL,
+   token_hash TEXT NOT NULL UNIQUE,
+   created_at DATETIME NOT NULL,
+   expires_at DATETIME NOT NULL,
+   used_at DATETIME NULL
+);
+
+CREATE INDEX IF NOT EXISTS password_reset_tokens_user_id ON password_reset_tokens (user_id);
+
+CREATE TABLE IF NOT EXISTS sessions(
+   id INTEGER PRIMARY KEY AUTOINCREMENT,
+   user_id INTEGER NOT NULL,
+   token_hash TEXT NOT NULL UNIQUE,
+   ip TEXT,
+   user_agent TEXT,
+   created_at DATETIME NOT NULL,
+   last_seen_at DATETIME NOT NULL,
+   expires_at DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS sessions_user_id ON sessions (user_id);
+
+CREATE TABLE IF NOT EXISTS web_authn_credentials(
+   id INTEGER PRIMARY KEY AUTOINCREMENT,
+   user_id INTEGER NOT NULL,
+   name TEXT NOT NULL,
+   credential_id TEXT NOT NULL UNIQUE,
+   public_key BLOB NOT NULL,
+   sign_count INTEGER NOT NULL DEFAULT 0,
+   transports TEXT,
+   created_at DATETIME NOT NULL,
+   last_used_at DATETIME NULL
+);
+
+CREATE INDEX IF NOT EXISTS web_authn_credentials_user_id ON web_authn_credentials (user_id);
+
+CREATE TABLE IF NOT EXISTS throttle_entries(
+   throttle_key TEXT NOT NULL PRIMARY KEY,
+   attempts INTEGER NOT NULL DEFAULT 0,
+   locked_until DATETIME NULL,
+   expires_at DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS throttle_entries_expires_at ON throttle_entries (expires_at);
+
+CREATE TABLE IF NOT EXISTS jobs(
+   id INTEGER PRIMARY KEY AUTOINCREMENT,
+   kind TEXT NOT NULL,
+   payload TEXT NOT NULL,
+   status TEXT NOT NULL,
+   attempts INTEGER NOT NULL DEFAULT 0,
+   max_attempts INTEGER NOT NULL,
+   next_run_at DATETIME NOT NULL,
+   locked_until DATETIME NULL,
+   claim_token TEXT NULL,
+   last_error TEXT,
+   created_at DATETIME NOT NULL,
+   updated_at DATETIME NOT NULL,
+   finished_at DATETIME NULL
+);
+
+CREATE INDEX IF NOT EXISTS jobs_status_next_run_at ON jobs (status, next_run_at);
+`,
+		Down: `
+DROP TABLE IF EXISTS jobs;
+DROP TABLE IF EXISTS throttle_entries;
+DROP TABLE IF EXISTS web_authn_credentials;
+DROP TABLE IF EXISTS sessions;
+DROP TABLE IF EXISTS password_reset_tokens;
+DROP TABLE IF EXISTS refresh_tokens;
+DROP TABLE IF EXISTS users;
+`,
+	})
+}
@@ -0,0 +1,23 @@
+package migrations
+
+import "gitlab.com/evzpav/user-auth/pkg/migrate"
+
+func init() {
+	register(migrate.Migration{
+		Version: 2,
+		Name:    "users_constraints_and_timestamps",
+		Up: `
+-- sqlite only adds columns with a constant default, existing users get the date of the migration
+ALTER TABLE users ADD COLUMN created_at DATETIME NOT NULL DEFAULT '1970-01-01 00:00:00';
+ALTER TABLE users ADD COLUMN updated_at DATETIME NOT NULL DEFAULT '1970-01-01 00:00:00';
+UPDATE users SET created_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP;
+
+CREATE INDEX users_google_id ON users (google_id);
+`,
+		Down: `
+DROP INDEX users_google_id;
+ALTER TABLE users DROP COLUMN updated_at;
+ALTER TABLE users DROP COLUMN created_at;
+`,
+	})
+}
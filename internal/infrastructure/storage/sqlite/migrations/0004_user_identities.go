@@ -0,0 +1,47 @@
+package migrations
+
+import "gitlab.com/evzpav/user-auth/pkg/migrate"
+
+func init() {
+	register(migrate.Migration{
+		Version: 4,
+		Name:    "user_identities",
+		Up: `
+CREATE TABLE IF NOT EXISTS user_identities(
+   id INTEGER PRIMARY KEY AUTOINCREMENT,
+   user_id INTEGER NOT NULL,
+   provider TEXT NOT NULL,
+   subject TEXT NOT NULL,
+   email TEXT NOT NULL DEFAULT '',
+   linked_at DATETIME NOT NULL,
+   UNIQUE (provider, subject)
+);
+
+CREATE INDEX IF NOT EXISTS user_identities_user_id ON user_identities (user_id);
+
+INSERT OR IGNORE INTO user_identities (user_id, provider, subject, email, linked_at)
+   SELECT id, 'google', google_id, email, created_at FROM users WHERE google_id IS NOT NULL AND google_id <> '';
+
+INSERT OR IGNORE INTO user_identities (user_id, provider, subject, email, linked_at)
+   SELECT id, 'github', github_id, email, created_at FROM users WHERE github_id IS NOT NULL AND github_id <> '';
+
+DROP INDEX users_github_id;
+DROP INDEX users_google_id;
+ALTER TABLE users DROP COLUMN github_id;
+ALTER TABLE users DROP COLUMN google_id;
+`,
+		Down: `
+ALTER TABLE users ADD COLUMN google_id TEXT;
+ALTER TABLE users ADD COLUMN github_id TEXT;
+
+CREATE INDEX users_google_id ON users (google_id);
+CREATE INDEX users_github_id ON users (github_id);
+
+UPDATE users SET
+   google_id = (SELECT MIN(subject) FROM user_identities WHERE user_id = users.id AND provider = 'google'),
+   github_id = (SELECT MIN(subject) FROM user_identities WHERE user_id = users.id AND provider = 'github');
+
+DROP TABLE user_identities;
+`,
+	})
+}
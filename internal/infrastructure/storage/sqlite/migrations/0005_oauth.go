@@ -0,0 +1,67 @@
+package migrations
+
+import "gitlab.com/evzpav/user-auth/pkg/migrate"
+
+func init() {
+	register(migrate.Migration{
+		Version: 5,
+		Name:    "oauth",
+		Up: `
+CREATE TABLE IF NOT EXISTS oauth_clients(
+   id INTEGER PRIMARY KEY AUTOINCREMENT,
+   client_id TEXT NOT NULL UNIQUE,
+   secret_hash TEXT NOT NULL DEFAULT '',
+   name TEXT NOT NULL,
+   redirect_uris TEXT NOT NULL,
+   scopes TEXT NOT NULL DEFAULT '',
+   created_at DATETIME NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS oauth_authorization_codes(
+   id INTEGER PRIMARY KEY AUTOINCREMENT,
+   code_hash TEXT NOT NULL UNIQUE,
+   client_id TEXT NOT NULL,
+   user_id INTEGER NOT NULL,
+   redirect_uri TEXT NOT NULL,
+   scope TEXT NOT NULL DEFAULT '',
+   code_challenge TEXT NOT NULL,
+   family_id TEXT NOT NULL,
+   created_at DATETIME NOT NULL,
+   expires_at DATETIME NOT NULL,
+   used_at DATETIME NULL
+);
+
+CREATE TABLE IF NOT EXISTS oauth_tokens(
+   id INTEGER PRIMARY KEY AUTOINCREMENT,
+   token_hash TEXT NOT NULL UNIQUE,
+   kind TEXT NOT NULL,
+   client_id TEXT NOT NULL,
+   user_id INTEGER NOT NULL DEFAULT 0,
+   scope TEXT NOT NULL DEFAULT '',
+   family_id TEXT NOT NULL,
+   created_at DATETIME NOT NULL,
+   expires_at DATETIME NOT NULL,
+   used_at DATETIME NULL,
+   revoked_at DATETIME NULL
+);
+
+CREATE INDEX IF NOT EXISTS oauth_tokens_family_id ON oauth_tokens (family_id);
+CREATE INDEX IF NOT EXISTS oauth_tokens_client_id ON oauth_tokens (client_id);
+
+CREATE TABLE IF NOT EXISTS oauth_consents(
+   id INTEGER PRIMARY KEY AUTOINCREMENT,
+   user_id INTEGER NOT NULL,
+   client_id TEXT NOT NULL,
+   scope TEXT NOT NULL DEFAULT '',
+   granted_at DATETIME NOT NULL,
+   UNIQUE (user_id, client_id)
+);
+`,
+		Down: `
+DROP TABLE IF EXISTS oauth_consents;
+DROP TABLE IF EXISTS oauth_tokens;
+DROP TABLE IF EXISTS oauth_authorization_codes;
+DROP TABLE IF EXISTS oauth_clients;
+`,
+	})
+}
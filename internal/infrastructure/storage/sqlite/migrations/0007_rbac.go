@@ -0,0 +1,56 @@
+package migrations
+
+import "gitlab.com/evzpav/user-auth/pkg/migrate"
+
+func init() {
+	register(migrate.Migration{
+		Version: 7,
+		Name:    "rbac",
+		Up: `
+ALTER TABLE users ADD COLUMN disabled_at DATETIME NULL;
+
+CREATE TABLE IF NOT EXISTS permissions(
+   id INTEGER PRIMARY KEY AUTOINCREMENT,
+   name TEXT NOT NULL UNIQUE,
+   description TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS roles(
+   id INTEGER PRIMARY KEY AUTOINCREMENT,
+   name TEXT NOT NULL UNIQUE,
+   description TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions(
+   role_id INTEGER NOT NULL,
+   permission_id INTEGER NOT NULL,
+   PRIMARY KEY (role_id, permission_id)
+);
+
+CREATE TABLE IF NOT EXISTS user_roles(
+   user_id INTEGER NOT NULL,
+   role_id INTEGER NOT NULL,
+   PRIMARY KEY (user_id, role_id)
+);
+
+INSERT INTO permissions (name, description) VALUES
+   ('users:read', 'Search users and view their accounts'),
+   ('users:disable', 'Disable and enable accounts'),
+   ('users:reset_password', 'Force a password reset'),
+   ('sessions:revoke', 'Revoke the sessions of a user');
+
+INSERT INTO roles (name, description) VALUES ('admin', 'Manages the accounts of the users');
+
+INSERT INTO role_permissions (role_id, permission_id)
+   SELECT roles.id, permissions.id FROM roles, permissions WHERE roles.name = 'admin';
+`,
+		Down: `
+DROP TABLE user_roles;
+DROP TABLE role_permissions;
+DROP TABLE roles;
+DROP TABLE permissions;
+
+ALTER TABLE users DROP COLUMN disabled_at;
+`,
+	})
+}
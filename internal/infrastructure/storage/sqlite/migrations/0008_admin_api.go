@@ -0,0 +1,43 @@
+package migrations
+
+import "gitlab.com/evzpav/user-auth/pkg/migrate"
+
+func init() {
+	register(migrate.Migration{
+		Version: 8,
+		Name:    "admin_api",
+		Up: `
+ALTER TABLE users ADD COLUMN deleted_at DATETIME NULL;
+
+CREATE INDEX users_created_at ON users (created_at);
+
+CREATE TABLE IF NOT EXISTS admin_api_keys(
+   id INTEGER PRIMARY KEY AUTOINCREMENT,
+   name TEXT NOT NULL,
+   prefix TEXT NOT NULL,
+   key_hash TEXT NOT NULL UNIQUE,
+   permissions TEXT NOT NULL DEFAULT '',
+   created_at DATETIME NOT NULL,
+   last_used_at DATETIME NULL,
+   revoked_at DATETIME NULL
+);
+
+INSERT INTO permissions (name, description) VALUES
+   ('users:write', 'Create and update accounts'),
+   ('users:delete', 'Delete and restore accounts');
+
+INSERT INTO role_permissions (role_id, permission_id)
+   SELECT roles.id, permissions.id FROM roles, permissions
+   WHERE roles.name = 'admin' AND permissions.name IN ('users:write', 'users:delete');
+`,
+		Down: `
+DELETE FROM role_permissions WHERE permission_id IN (SELECT id FROM permissions WHERE name IN ('users:write', 'users:delete'));
+DELETE FROM permissions WHERE name IN ('users:write', 'users:delete');
+
+DROP TABLE admin_api_keys;
+
+DROP INDEX users_created_at;
+ALTER TABLE users DROP COLUMN deleted_at;
+`,
+	})
+}
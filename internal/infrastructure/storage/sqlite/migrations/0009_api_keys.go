@@ -0,0 +1,29 @@
+package migrations
+
+import "gitlab.com/evzpav/user-auth/pkg/migrate"
+
+func init() {
+	register(migrate.Migration{
+		Version: 9,
+		Name:    "api_keys",
+		Up: `
+CREATE TABLE IF NOT EXISTS api_keys(
+   id INTEGER PRIMARY KEY AUTOINCREMENT,
+   user_id INTEGER NOT NULL,
+   name TEXT NOT NULL,
+   prefix TEXT NOT NULL,
+   key_hash TEXT NOT NULL UNIQUE,
+   scopes TEXT NOT NULL DEFAULT '',
+   created_at DATETIME NOT NULL,
+   expires_at DATETIME NOT NULL,
+   last_used_at DATETIME NULL,
+   revoked_at DATETIME NULL
+);
+
+CREATE INDEX IF NOT EXISTS api_keys_user_id ON api_keys (user_id);
+`,
+		Down: `
+DROP TABLE api_keys;
+`,
+	})
+}
@@ -0,0 +1,54 @@
+package migrations
+
+import "gitlab.com/evzpav/user-auth/pkg/migrate"
+
+func init() {
+	register(migrate.Migration{
+		Version: 10,
+		Name:    "organizations",
+		Up: `
+CREATE TABLE IF NOT EXISTS organizations(
+   id INTEGER PRIMARY KEY AUTOINCREMENT,
+   name TEXT NOT NULL,
+   created_at DATETIME NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS organization_members(
+   organization_id INTEGER NOT NULL,
+   user_id INTEGER NOT NULL,
+   role TEXT NOT NULL,
+   created_at DATETIME NOT NULL,
+   PRIMARY KEY (organization_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS organization_members_user_id ON organization_members (user_id);
+
+CREATE TABLE IF NOT EXISTS organization_invitations(
+   id INTEGER PRIMARY KEY AUTOINCREMENT,
+   organization_id INTEGER NOT NULL,
+   email TEXT NOT NULL,
+   role TEXT NOT NULL,
+   invited_by INTEGER NOT NULL,
+   created_at DATETIME NOT NULL,
+   expires_at DATETIME NOT NULL,
+   accepted_at DATETIME NULL,
+   revoked_at DATETIME NULL
+);
+
+CREATE INDEX IF NOT EXISTS organization_invitations_organization_id ON organization_invitations (organization_id);
+
+ALTER TABLE sessions ADD COLUMN organization_id INTEGER NULL;
+
+ALTER TABLE refresh_tokens ADD COLUMN organization_id INTEGER NULL;
+`,
+		Down: `
+ALTER TABLE refresh_tokens DROP COLUMN organization_id;
+
+ALTER TABLE sessions DROP COLUMN organization_id;
+
+DROP TABLE organization_invitations;
+DROP TABLE organization_members;
+DROP TABLE organizations;
+`,
+	})
+}
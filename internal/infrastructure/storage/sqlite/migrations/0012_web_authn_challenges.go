@@ -0,0 +1,26 @@
+package migrations
+
+import "gitlab.com/evzpav/user-auth/pkg/migrate"
+
+func init() {
+	register(migrate.Migration{
+		Version: 12,
+		Name:    "web_authn_challenges",
+		Up: `
+CREATE TABLE IF NOT EXISTS web_authn_challenges(
+   id INTEGER PRIMARY KEY AUTOINCREMENT,
+   nonce_hash TEXT NOT NULL UNIQUE,
+   ceremony TEXT NOT NULL,
+   user_id INTEGER NOT NULL DEFAULT 0,
+   challenge TEXT NOT NULL,
+   created_at DATETIME NOT NULL,
+   expires_at DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS web_authn_challenges_expires_at ON web_authn_challenges (expires_at);
+`,
+		Down: `
+DROP TABLE web_authn_challenges;
+`,
+	})
+}
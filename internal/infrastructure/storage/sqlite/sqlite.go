@@ -0,0 +1,110 @@
+package sqlite
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+
+	"gitlab.com/evzpav/user-auth/internal/infrastructure/storage/sqlstore"
+)
+
+const driverName = "sqlite-utc"
+
+func init() {
+	sql.Register(driverName, utcDriver{})
+}
+
+// Dialect runs the storages of sqlstore on sqlite. Sqlite runs one write at a time so concurrent
+// workers never claim the same job. Timestamps are text in UTC so MAX returns the latest.
+var Dialect = sqlstore.Dialect{
+	IsUniqueViolation: isUniqueViolation,
+	ClaimJobs: `UPDATE jobs SET status = ?, attempts = attempts + 1, claim_token = ?, locked_until = ?, updated_at = ?
+		WHERE id IN (
+			SELECT id FROM jobs
+			WHERE (status = ? AND next_run_at <= ?) OR (status = ? AND locked_until <= ?)
+			ORDER BY next_run_at, id LIMIT ?
+		)`,
+	IncrementThrottle: `INSERT INTO throttle_entries (throttle_key, attempts, expires_at) VALUES (?, 1, ?)
+		ON CONFLICT (throttle_key) DO UPDATE SET
+			attempts = CASE WHEN throttle_entries.expires_at <= ? THEN 1 ELSE throttle_entries.attempts + 1 END,
+			locked_until = CASE WHEN throttle_entries.expires_at <= ? THEN NULL ELSE throttle_entries.locked_until END,
+			expires_at = MAX(throttle_entries.expires_at, excluded.expires_at)`,
+	InsertUserRole: `INSERT OR IGNORE INTO user_roles (user_id, role_id) VALUES (?, ?)`,
+}
+
+// New opens the sqlite database at path, creating it when missing. The database runs in WAL mode
+// so reads are not blocked by the single writer.
+func New(path string) (*gorm.DB, error) {
+	sqlDB, err := sql.Open(driverName, dsn(path))
+	if err != nil {
+		return nil, err
+	}
+
+	// every connection to an in-memory database opens a new empty one
+	if isMemory(path) {
+		sqlDB.SetMaxOpenConns(1)
+	}
+
+	db, err := gorm.Open("sqlite3", sqlDB)
+	if err != nil {
+		sqlDB.Close()
+		return nil, err
+	}
+
+	db.LogMode(true)
+	return db, nil
+}
+
+func dsn(path string) string {
+	pragmas := "_pragma=busy_timeout(5000)&_pragma=foreign_keys(1)&_time_format=sqlite"
+	if !isMemory(path) {
+		pragmas += "&_pragma=journal_mode(WAL)"
+	}
+
+	if strings.Contains(path, "?") {
+		return path + "&" + pragmas
+	}
+
+	return path + "?" + pragmas
+}
+
+func isMemory(path string) bool {
+	return strings.Contains(path, ":memory:") || strings.Contains(path, "mode=memory")
+}
+
+// isUniqueViolation tells if the statement failed because of a unique index
+func isUniqueViolation(err error) bool {
+	sqliteErr, ok := err.(*sqlite.Error)
+	return ok && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE
+}
+
+// utcDriver writes timestamps in UTC. Sqlite stores them as text, so they only compare and sort
+// correctly when they have the same offset.
+type utcDriver struct{}
+
+func (utcDriver) Open(name string) (driver.Conn, error) {
+	conn, err := (&sqlite.Driver{}).Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return utcConn{conn}, nil
+}
+
+type utcConn struct {
+	driver.Conn
+}
+
+func (utcConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if t, ok := nv.Value.(time.Time); ok {
+		nv.Value = t.UTC()
+		return nil
+	}
+
+	return driver.ErrSkip
+}
@@ -0,0 +1,65 @@
+package sqlite
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/internal/infrastructure/storage/sqlite/migrations"
+	"gitlab.com/evzpav/user-auth/internal/infrastructure/storage/sqlstore"
+	"gitlab.com/evzpav/user-auth/internal/infrastructure/storage/storagetest"
+	"gitlab.com/evzpav/user-auth/pkg/log"
+	"gitlab.com/evzpav/user-auth/pkg/migrate"
+)
+
+var testLog = log.NewZeroLog("", "", log.Error)
+
+func TestNew_WAL(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sqlite")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "user-auth.db")
+	db, err := New(path)
+	require.NoError(t, err)
+	defer db.Close()
+	db.LogMode(false)
+
+	migrator, err := migrate.New(db.DB(), "sqlite", migrations.All())
+	require.NoError(t, err)
+	_, err = migrator.Up(context.Background())
+	require.NoError(t, err)
+
+	var mode string
+	require.NoError(t, db.DB().QueryRow("PRAGMA journal_mode").Scan(&mode))
+	assert.Equal(t, "wal", mode)
+
+	// opening again keeps the data
+	users, err := sqlstore.NewUserStorage(db, Dialect, testLog)
+	require.NoError(t, err)
+	require.NoError(t, users.Insert(context.Background(), &domain.User{Email: "user@example.com", Password: "x"}))
+
+	reopened, err := New(path)
+	require.NoError(t, err)
+	defer reopened.Close()
+
+	users, err = sqlstore.NewUserStorage(reopened, Dialect, testLog)
+	require.NoError(t, err)
+	user, err := users.FindByEmail(context.Background(), "user@example.com")
+	require.NoError(t, err)
+	assert.NotNil(t, user)
+}
+
+func TestStorages(t *testing.T) {
+	db, err := New(":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	storagetest.RunSQLStorages(t, storagetest.SQLDriver{Name: "sqlite", DB: db, Dialect: Dialect, Migrations: migrations.All()})
+}
@@ -0,0 +1,68 @@
+package sqlstore
+
+import (
+	"context"
+	"time"
+
+	"github.com/jinzhu/gorm"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/pkg/log"
+)
+
+const adminAPIKeysTable = "admin_api_keys"
+
+type adminAPIKeyStorage struct {
+	db  *gorm.DB
+	log log.Logger
+}
+
+func NewAdminAPIKeyStorage(db *gorm.DB, log log.Logger) (*adminAPIKeyStorage, error) {
+	return &adminAPIKeyStorage{
+		db:  db,
+		log: log,
+	}, nil
+}
+
+func (ks *adminAPIKeyStorage) Insert(ctx context.Context, key *domain.AdminAPIKey) error {
+	return ks.db.Table(adminAPIKeysTable).Create(key).Error
+}
+
+func (ks *adminAPIKeyStorage) FindByHash(ctx context.Context, hash string) (*domain.AdminAPIKey, error) {
+	var key domain.AdminAPIKey
+	if err := ks.db.Table(adminAPIKeysTable).Where(`admin_api_keys.key_hash=(?)`, hash).Find(&key).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return &key, nil
+}
+
+func (ks *adminAPIKeyStorage) List(ctx context.Context) ([]*domain.AdminAPIKey, error) {
+	var keys []*domain.AdminAPIKey
+	if err := ks.db.Table(adminAPIKeysTable).Order("id").Find(&keys).Error; err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+func (ks *adminAPIKeyStorage) Revoke(ctx context.Context, ID int, revokedAt time.Time) (bool, error) {
+	result := ks.db.Table(adminAPIKeysTable).
+		Where(`admin_api_keys.id=(?) AND admin_api_keys.revoked_at IS NULL`, ID).
+		Update("revoked_at", revokedAt)
+	if result.Error != nil {
+		return false, result.Error
+	}
+
+	return result.RowsAffected == 1, nil
+}
+
+func (ks *adminAPIKeyStorage) Touch(ctx context.Context, ID int, lastUsedAt time.Time) error {
+	return ks.db.Table(adminAPIKeysTable).
+		Where(`admin_api_keys.id=(?)`, ID).
+		Update("last_used_at", lastUsedAt).Error
+}
@@ -0,0 +1,68 @@
+package sqlstore
+
+import (
+	"context"
+	"time"
+
+	"github.com/jinzhu/gorm"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/pkg/log"
+)
+
+const apiKeysTable = "api_keys"
+
+type apiKeyStorage struct {
+	db  *gorm.DB
+	log log.Logger
+}
+
+func NewAPIKeyStorage(db *gorm.DB, log log.Logger) (*apiKeyStorage, error) {
+	return &apiKeyStorage{
+		db:  db,
+		log: log,
+	}, nil
+}
+
+func (ks *apiKeyStorage) Insert(ctx context.Context, key *domain.APIKey) error {
+	return ks.db.Table(apiKeysTable).Create(key).Error
+}
+
+func (ks *apiKeyStorage) FindByHash(ctx context.Context, hash string) (*domain.APIKey, error) {
+	var key domain.APIKey
+	if err := ks.db.Table(apiKeysTable).Where(`api_keys.key_hash=(?)`, hash).Find(&key).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return &key, nil
+}
+
+func (ks *apiKeyStorage) FindByUserID(ctx context.Context, userID int) ([]*domain.APIKey, error) {
+	var keys []*domain.APIKey
+	if err := ks.db.Table(apiKeysTable).Where(`api_keys.user_id=(?)`, userID).Order("id").Find(&keys).Error; err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+func (ks *apiKeyStorage) Revoke(ctx context.Context, userID, ID int, revokedAt time.Time) (bool, error) {
+	result := ks.db.Table(apiKeysTable).
+		Where(`api_keys.id=(?) AND api_keys.user_id=(?) AND api_keys.revoked_at IS NULL`, ID, userID).
+		Update("revoked_at", revokedAt)
+	if result.Error != nil {
+		return false, result.Error
+	}
+
+	return result.RowsAffected == 1, nil
+}
+
+func (ks *apiKeyStorage) Touch(ctx context.Context, ID int, lastUsedAt time.Time) error {
+	return ks.db.Table(apiKeysTable).
+		Where(`api_keys.id=(?)`, ID).
+		Update("last_used_at", lastUsedAt).Error
+}
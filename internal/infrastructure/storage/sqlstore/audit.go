@@ -0,0 +1,63 @@
+package sqlstore
+
+import (
+	"context"
+
+	"github.com/jinzhu/gorm"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/internal/infrastructure/storage"
+	"gitlab.com/evzpav/user-auth/pkg/log"
+)
+
+const auditEventsTable = "audit_events"
+
+type auditStorage struct {
+	db  *gorm.DB
+	log log.Logger
+}
+
+func NewAuditStorage(db *gorm.DB, log log.Logger) (*auditStorage, error) {
+	return &auditStorage{
+		db:  db,
+		log: log,
+	}, nil
+}
+
+func (as *auditStorage) Insert(ctx context.Context, event *domain.AuditEvent) error {
+	return as.db.Table(auditEventsTable).Create(event).Error
+}
+
+func (as *auditStorage) List(ctx context.Context, filter *domain.AuditFilter) ([]*domain.AuditEvent, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	db := storage.FilterAuditEvents(as.db.Table(auditEventsTable), filter).Order("id DESC")
+	if filter.Limit > 0 {
+		db = db.Limit(filter.Limit)
+	}
+	if filter.Offset > 0 {
+		db = db.Offset(filter.Offset)
+	}
+
+	var events []*domain.AuditEvent
+	if err := db.Find(&events).Error; err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+func (as *auditStorage) Count(ctx context.Context, filter *domain.AuditFilter) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	var count int
+	if err := storage.FilterAuditEvents(as.db.Table(auditEventsTable), filter).Count(&count).Error; err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
@@ -0,0 +1,25 @@
+// Package sqlstore holds the gorm storages shared by the mysql, postgres and sqlite drivers. The
+// driver packages open the connection, hold the migrations and declare their Dialect.
+package sqlstore
+
+// Dialect holds what the storages do differently on each database. The statements take their
+// arguments in the order documented on each field.
+type Dialect struct {
+	// IsUniqueViolation tells if the statement failed because of a unique index
+	IsUniqueViolation func(err error) bool
+
+	// ClaimJobs marks the due jobs, and the running jobs whose lock expired, as claimed. Concurrent
+	// workers, also of other instances, must never claim the same job. The arguments are the running
+	// status, the claim token, the end of the lock, the update time, then the pending status and
+	// now, the running status and now, and the limit.
+	ClaimJobs string
+
+	// IncrementThrottle inserts the throttle entry with one attempt, or counts an attempt on the
+	// existing one. The attempts and the lock start over when the entry expired. The arguments are
+	// the key, the expiration of the window, and now twice.
+	IncrementThrottle string
+
+	// InsertUserRole gives the role to the user, doing nothing when the user already has it. The
+	// arguments are the user and the role.
+	InsertUserRole string
+}
@@ -0,0 +1,66 @@
+package sqlstore
+
+import (
+	"context"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	uuid "github.com/satori/go.uuid"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/pkg/log"
+)
+
+type jobStorage struct {
+	db      *gorm.DB
+	dialect Dialect
+	log     log.Logger
+}
+
+func NewJobStorage(db *gorm.DB, dialect Dialect, log log.Logger) (*jobStorage, error) {
+	return &jobStorage{
+		db:      db,
+		dialect: dialect,
+		log:     log,
+	}, nil
+}
+
+func (js *jobStorage) Insert(ctx context.Context, job *domain.Job) error {
+	return js.db.Create(job).Error
+}
+
+// Claim marks the jobs with a token in a single UPDATE of the dialect, so concurrent workers never
+// claim the same job, and then reads the jobs back by the token
+func (js *jobStorage) Claim(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*domain.Job, error) {
+	token := uuid.NewV4().String()
+
+	err := js.db.Exec(js.dialect.ClaimJobs,
+		domain.JobRunning, token, now.Add(lease), now,
+		domain.JobPending, now, domain.JobRunning, now, limit).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var jobs []*domain.Job
+	if err := js.db.Where(`jobs.claim_token=(?) AND jobs.status=(?)`, token, domain.JobRunning).Find(&jobs).Error; err != nil {
+		return nil, err
+	}
+
+	return jobs, nil
+}
+
+func (js *jobStorage) Release(ctx context.Context, job *domain.Job) error {
+	return js.db.Model(&domain.Job{}).Where(`jobs.id=(?) AND jobs.claim_token=(?)`, job.ID, job.ClaimToken).Updates(map[string]interface{}{
+		"status":       job.Status,
+		"payload":      job.Payload,
+		"next_run_at":  job.NextRunAt,
+		"locked_until": job.LockedUntil,
+		"last_error":   job.LastError,
+		"updated_at":   job.UpdatedAt,
+		"finished_at":  job.FinishedAt,
+	}).Error
+}
+
+func (js *jobStorage) DeleteFinished(ctx context.Context, before time.Time) error {
+	return js.db.Where(`jobs.status=(?) AND jobs.finished_at <= (?)`, domain.JobDone, before).Delete(&domain.Job{}).Error
+}
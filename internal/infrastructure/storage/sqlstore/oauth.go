@@ -0,0 +1,219 @@
+package sqlstore
+
+import (
+	"context"
+	"time"
+
+	"github.com/jinzhu/gorm"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/internal/infrastructure/storage"
+	"gitlab.com/evzpav/user-auth/pkg/errors"
+	"gitlab.com/evzpav/user-auth/pkg/log"
+)
+
+// gorm would name the tables of the OAuth models o_auth_*, the storages name them explicitly
+const (
+	oauthClientsTable            = "oauth_clients"
+	oauthAuthorizationCodesTable = "oauth_authorization_codes"
+	oauthTokensTable             = "oauth_tokens"
+	oauthConsentsTable           = "oauth_consents"
+)
+
+type oauthClientStorage struct {
+	db      *gorm.DB
+	dialect Dialect
+	log     log.Logger
+}
+
+func NewOAuthClientStorage(db *gorm.DB, dialect Dialect, log log.Logger) (*oauthClientStorage, error) {
+	return &oauthClientStorage{
+		db:      db,
+		dialect: dialect,
+		log:     log,
+	}, nil
+}
+
+func (cs *oauthClientStorage) Insert(ctx context.Context, client *domain.OAuthClient) error {
+	if err := cs.db.Table(oauthClientsTable).Create(client).Error; err != nil {
+		if cs.dialect.IsUniqueViolation(err) {
+			return errors.NewDuplicatedRecord(storage.ErrOAuthClientDuplicated)
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func (cs *oauthClientStorage) FindByClientID(ctx context.Context, clientID string) (*domain.OAuthClient, error) {
+	var client domain.OAuthClient
+	if err := cs.db.Table(oauthClientsTable).Where(`oauth_clients.client_id=(?)`, clientID).Find(&client).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return &client, nil
+}
+
+func (cs *oauthClientStorage) List(ctx context.Context) ([]*domain.OAuthClient, error) {
+	var clients []*domain.OAuthClient
+	if err := cs.db.Table(oauthClientsTable).Order("id").Find(&clients).Error; err != nil {
+		return nil, err
+	}
+
+	return clients, nil
+}
+
+func (cs *oauthClientStorage) Delete(ctx context.Context, clientID string) error {
+	return cs.db.Table(oauthClientsTable).Where(`oauth_clients.client_id=(?)`, clientID).Delete(&domain.OAuthClient{}).Error
+}
+
+type oauthAuthorizationCodeStorage struct {
+	db  *gorm.DB
+	log log.Logger
+}
+
+func NewOAuthAuthorizationCodeStorage(db *gorm.DB, log log.Logger) (*oauthAuthorizationCodeStorage, error) {
+	return &oauthAuthorizationCodeStorage{
+		db:  db,
+		log: log,
+	}, nil
+}
+
+func (cs *oauthAuthorizationCodeStorage) Insert(ctx context.Context, code *domain.OAuthAuthorizationCode) error {
+	return cs.db.Table(oauthAuthorizationCodesTable).Create(code).Error
+}
+
+func (cs *oauthAuthorizationCodeStorage) FindByHash(ctx context.Context, hash string) (*domain.OAuthAuthorizationCode, error) {
+	var code domain.OAuthAuthorizationCode
+	if err := cs.db.Table(oauthAuthorizationCodesTable).Where(`oauth_authorization_codes.code_hash=(?)`, hash).Find(&code).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return &code, nil
+}
+
+func (cs *oauthAuthorizationCodeStorage) MarkUsed(ctx context.Context, ID int, usedAt time.Time) (bool, error) {
+	result := cs.db.Table(oauthAuthorizationCodesTable).
+		Where(`oauth_authorization_codes.id=(?) AND oauth_authorization_codes.used_at IS NULL`, ID).
+		Update("used_at", usedAt)
+	if result.Error != nil {
+		return false, result.Error
+	}
+
+	return result.RowsAffected == 1, nil
+}
+
+type oauthTokenStorage struct {
+	db  *gorm.DB
+	log log.Logger
+}
+
+func NewOAuthTokenStorage(db *gorm.DB, log log.Logger) (*oauthTokenStorage, error) {
+	return &oauthTokenStorage{
+		db:  db,
+		log: log,
+	}, nil
+}
+
+func (ts *oauthTokenStorage) Insert(ctx context.Context, token *domain.OAuthToken) error {
+	return ts.db.Table(oauthTokensTable).Create(token).Error
+}
+
+func (ts *oauthTokenStorage) FindByHash(ctx context.Context, hash string) (*domain.OAuthToken, error) {
+	var token domain.OAuthToken
+	if err := ts.db.Table(oauthTokensTable).Where(`oauth_tokens.token_hash=(?)`, hash).Find(&token).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+func (ts *oauthTokenStorage) MarkUsed(ctx context.Context, ID int, usedAt time.Time) (bool, error) {
+	result := ts.db.Table(oauthTokensTable).
+		Where(`oauth_tokens.id=(?) AND oauth_tokens.used_at IS NULL`, ID).
+		Update("used_at", usedAt)
+	if result.Error != nil {
+		return false, result.Error
+	}
+
+	return result.RowsAffected == 1, nil
+}
+
+func (ts *oauthTokenStorage) Revoke(ctx context.Context, ID int, revokedAt time.Time) error {
+	return ts.db.Table(oauthTokensTable).
+		Where(`oauth_tokens.id=(?) AND oauth_tokens.revoked_at IS NULL`, ID).
+		Update("revoked_at", revokedAt).Error
+}
+
+func (ts *oauthTokenStorage) RevokeFamily(ctx context.Context, familyID string, revokedAt time.Time) error {
+	return ts.db.Table(oauthTokensTable).
+		Where(`oauth_tokens.family_id=(?) AND oauth_tokens.revoked_at IS NULL`, familyID).
+		Update("revoked_at", revokedAt).Error
+}
+
+func (ts *oauthTokenStorage) RevokeByClientID(ctx context.Context, clientID string, revokedAt time.Time) error {
+	return ts.db.Table(oauthTokensTable).
+		Where(`oauth_tokens.client_id=(?) AND oauth_tokens.revoked_at IS NULL`, clientID).
+		Update("revoked_at", revokedAt).Error
+}
+
+type oauthConsentStorage struct {
+	db      *gorm.DB
+	dialect Dialect
+	log     log.Logger
+}
+
+func NewOAuthConsentStorage(db *gorm.DB, dialect Dialect, log log.Logger) (*oauthConsentStorage, error) {
+	return &oauthConsentStorage{
+		db:      db,
+		dialect: dialect,
+		log:     log,
+	}, nil
+}
+
+func (cs *oauthConsentStorage) Find(ctx context.Context, userID int, clientID string) (*domain.OAuthConsent, error) {
+	var consent domain.OAuthConsent
+	if err := cs.db.Table(oauthConsentsTable).Where(`oauth_consents.user_id=(?) AND oauth_consents.client_id=(?)`, userID, clientID).Find(&consent).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return &consent, nil
+}
+
+// Save updates the consent of the user and client or inserts it. A consent inserted concurrently
+// hits the unique index, the scope it saved is kept.
+func (cs *oauthConsentStorage) Save(ctx context.Context, consent *domain.OAuthConsent) error {
+	result := cs.db.Table(oauthConsentsTable).
+		Where(`oauth_consents.user_id=(?) AND oauth_consents.client_id=(?)`, consent.UserID, consent.ClientID).
+		Updates(map[string]interface{}{"scope": consent.Scope, "granted_at": consent.GrantedAt})
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected > 0 {
+		return nil
+	}
+
+	if err := cs.db.Table(oauthConsentsTable).Create(consent).Error; err != nil && !cs.dialect.IsUniqueViolation(err) {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,189 @@
+package sqlstore
+
+import (
+	"context"
+	"time"
+
+	"github.com/jinzhu/gorm"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/pkg/log"
+)
+
+const (
+	organizationsTable       = "organizations"
+	organizationMembersTable = "organization_members"
+	orgInvitationsTable      = "organization_invitations"
+)
+
+type organizationStorage struct {
+	db  *gorm.DB
+	log log.Logger
+}
+
+func NewOrganizationStorage(db *gorm.DB, log log.Logger) (*organizationStorage, error) {
+	return &organizationStorage{
+		db:  db,
+		log: log,
+	}, nil
+}
+
+func (s *organizationStorage) Insert(ctx context.Context, organization *domain.Organization, owner *domain.OrgMembership) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Table(organizationsTable).Create(organization).Error; err != nil {
+			return err
+		}
+
+		owner.OrganizationID = organization.ID
+		return tx.Table(organizationMembersTable).Create(owner).Error
+	})
+}
+
+func (s *organizationStorage) FindByID(ctx context.Context, ID int) (*domain.Organization, error) {
+	var organization domain.Organization
+	if err := s.db.Table(organizationsTable).Where(`organizations.id=(?)`, ID).Find(&organization).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return &organization, nil
+}
+
+func (s *organizationStorage) FindMembership(ctx context.Context, organizationID, userID int) (*domain.OrgMembership, error) {
+	var membership domain.OrgMembership
+	err := s.db.Table(organizationMembersTable).
+		Where(`organization_members.organization_id=(?) AND organization_members.user_id=(?)`, organizationID, userID).
+		Find(&membership).Error
+	if err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return &membership, nil
+}
+
+func (s *organizationStorage) FindMembers(ctx context.Context, organizationID int) ([]*domain.OrgMembership, error) {
+	var memberships []*domain.OrgMembership
+	err := s.db.Table(organizationMembersTable).
+		Where(`organization_members.organization_id=(?)`, organizationID).
+		Order("created_at, user_id").
+		Find(&memberships).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return memberships, nil
+}
+
+func (s *organizationStorage) FindMemberships(ctx context.Context, userID int) ([]*domain.OrgMembership, error) {
+	var memberships []*domain.OrgMembership
+	err := s.db.Table(organizationMembersTable).
+		Where(`organization_members.user_id=(?)`, userID).
+		Order("created_at, organization_id").
+		Find(&memberships).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return memberships, nil
+}
+
+func (s *organizationStorage) InsertMembership(ctx context.Context, membership *domain.OrgMembership) error {
+	return s.db.Table(organizationMembersTable).Create(membership).Error
+}
+
+func (s *organizationStorage) DeleteMembership(ctx context.Context, organizationID, userID int) (bool, error) {
+	result := s.db.Table(organizationMembersTable).
+		Where(`organization_members.organization_id=(?) AND organization_members.user_id=(?)`, organizationID, userID).
+		Delete(&domain.OrgMembership{})
+	if result.Error != nil {
+		return false, result.Error
+	}
+
+	return result.RowsAffected == 1, nil
+}
+
+func (s *organizationStorage) TransferOwnership(ctx context.Context, organizationID, ownerID, userID int) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Table(organizationMembersTable).
+			Where(`organization_members.organization_id=(?) AND organization_members.user_id=(?)`, organizationID, ownerID).
+			Update("role", domain.OrgRoleAdmin).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Table(organizationMembersTable).
+			Where(`organization_members.organization_id=(?) AND organization_members.user_id=(?)`, organizationID, userID).
+			Update("role", domain.OrgRoleOwner).Error
+	})
+}
+
+type orgInvitationStorage struct {
+	db  *gorm.DB
+	log log.Logger
+}
+
+func NewOrgInvitationStorage(db *gorm.DB, log log.Logger) (*orgInvitationStorage, error) {
+	return &orgInvitationStorage{
+		db:  db,
+		log: log,
+	}, nil
+}
+
+func (is *orgInvitationStorage) Insert(ctx context.Context, invitation *domain.OrgInvitation) error {
+	return is.db.Table(orgInvitationsTable).Create(invitation).Error
+}
+
+func (is *orgInvitationStorage) FindByID(ctx context.Context, ID int) (*domain.OrgInvitation, error) {
+	var invitation domain.OrgInvitation
+	if err := is.db.Table(orgInvitationsTable).Where(`organization_invitations.id=(?)`, ID).Find(&invitation).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return &invitation, nil
+}
+
+func (is *orgInvitationStorage) FindPending(ctx context.Context, organizationID int, now time.Time) ([]*domain.OrgInvitation, error) {
+	var invitations []*domain.OrgInvitation
+	err := is.db.Table(orgInvitationsTable).
+		Where(`organization_invitations.organization_id=(?) AND organization_invitations.accepted_at IS NULL AND organization_invitations.revoked_at IS NULL AND organization_invitations.expires_at > (?)`, organizationID, now).
+		Order("id").
+		Find(&invitations).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return invitations, nil
+}
+
+func (is *orgInvitationStorage) Accept(ctx context.Context, ID int, acceptedAt time.Time) (bool, error) {
+	result := is.db.Table(orgInvitationsTable).
+		Where(`organization_invitations.id=(?) AND organization_invitations.accepted_at IS NULL AND organization_invitations.revoked_at IS NULL`, ID).
+		Update("accepted_at", acceptedAt)
+	if result.Error != nil {
+		return false, result.Error
+	}
+
+	return result.RowsAffected == 1, nil
+}
+
+func (is *orgInvitationStorage) Revoke(ctx context.Context, organizationID, ID int, revokedAt time.Time) (bool, error) {
+	result := is.db.Table(orgInvitationsTable).
+		Where(`organization_invitations.id=(?) AND organization_invitations.organization_id=(?) AND organization_invitations.accepted_at IS NULL AND organization_invitations.revoked_at IS NULL`, ID, organizationID).
+		Update("revoked_at", revokedAt)
+	if result.Error != nil {
+		return false, result.Error
+	}
+
+	return result.RowsAffected == 1, nil
+}
@@ -0,0 +1,55 @@
+package sqlstore
+
+import (
+	"context"
+	"time"
+
+	"github.com/jinzhu/gorm"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/pkg/log"
+)
+
+type passwordResetTokenStorage struct {
+	db  *gorm.DB
+	log log.Logger
+}
+
+func NewPasswordResetTokenStorage(db *gorm.DB, log log.Logger) (*passwordResetTokenStorage, error) {
+	return &passwordResetTokenStorage{
+		db:  db,
+		log: log,
+	}, nil
+}
+
+func (ps *passwordResetTokenStorage) Insert(ctx context.Context, token *domain.PasswordResetToken) error {
+	return ps.db.Create(token).Error
+}
+
+func (ps *passwordResetTokenStorage) FindByHash(ctx context.Context, hash string) (*domain.PasswordResetToken, error) {
+	var token domain.PasswordResetToken
+	if err := ps.db.Where(`password_reset_tokens.token_hash=(?)`, hash).Find(&token).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+func (ps *passwordResetTokenStorage) MarkUsed(ctx context.Context, ID int, usedAt time.Time) (bool, error) {
+	result := ps.db.Model(&domain.PasswordResetToken{}).
+		Where(`password_reset_tokens.id=(?) AND password_reset_tokens.used_at IS NULL`, ID).
+		Update("used_at", usedAt)
+	if result.Error != nil {
+		return false, result.Error
+	}
+
+	return result.RowsAffected == 1, nil
+}
+
+func (ps *passwordResetTokenStorage) DeleteByUserID(ctx context.Context, userID int) error {
+	return ps.db.Where(`password_reset_tokens.user_id=(?)`, userID).Delete(&domain.PasswordResetToken{}).Error
+}
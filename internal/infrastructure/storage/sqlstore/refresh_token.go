@@ -0,0 +1,63 @@
+package sqlstore
+
+import (
+	"context"
+	"time"
+
+	"github.com/jinzhu/gorm"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/pkg/log"
+)
+
+type refreshTokenStorage struct {
+	db  *gorm.DB
+	log log.Logger
+}
+
+func NewRefreshTokenStorage(db *gorm.DB, log log.Logger) (*refreshTokenStorage, error) {
+	return &refreshTokenStorage{
+		db:  db,
+		log: log,
+	}, nil
+}
+
+func (rs *refreshTokenStorage) Insert(ctx context.Context, token *domain.RefreshToken) error {
+	return rs.db.Create(token).Error
+}
+
+func (rs *refreshTokenStorage) FindByHash(ctx context.Context, hash string) (*domain.RefreshToken, error) {
+	var token domain.RefreshToken
+	if err := rs.db.Where(`refresh_tokens.token_hash=(?)`, hash).Find(&token).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+func (rs *refreshTokenStorage) MarkUsed(ctx context.Context, ID int, usedAt time.Time) (bool, error) {
+	result := rs.db.Model(&domain.RefreshToken{}).
+		Where(`refresh_tokens.id=(?) AND refresh_tokens.used_at IS NULL`, ID).
+		Update("used_at", usedAt)
+	if result.Error != nil {
+		return false, result.Error
+	}
+
+	return result.RowsAffected == 1, nil
+}
+
+func (rs *refreshTokenStorage) RevokeFamily(ctx context.Context, familyID string, revokedAt time.Time) error {
+	return rs.db.Model(&domain.RefreshToken{}).
+		Where(`refresh_tokens.family_id=(?) AND refresh_tokens.revoked_at IS NULL`, familyID).
+		Update("revoked_at", revokedAt).Error
+}
+
+func (rs *refreshTokenStorage) RevokeByUserID(ctx context.Context, userID int, revokedAt time.Time) error {
+	return rs.db.Model(&domain.RefreshToken{}).
+		Where(`refresh_tokens.user_id=(?) AND refresh_tokens.revoked_at IS NULL`, userID).
+		Update("revoked_at", revokedAt).Error
+}
@@ -0,0 +1,141 @@
+package sqlstore
+
+import (
+	"context"
+
+	"github.com/jinzhu/gorm"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/pkg/log"
+)
+
+// roleRow is a row of the roles table, the permissions are joined from role_permissions
+type roleRow struct {
+	ID          int
+	Name        string
+	Description string
+}
+
+type rolePermissionRow struct {
+	RoleID int
+	Name   string
+}
+
+type roleStorage struct {
+	db      *gorm.DB
+	dialect Dialect
+	log     log.Logger
+}
+
+func NewRoleStorage(db *gorm.DB, dialect Dialect, log log.Logger) (*roleStorage, error) {
+	return &roleStorage{
+		db:      db,
+		dialect: dialect,
+		log:     log,
+	}, nil
+}
+
+func (rs *roleStorage) List(ctx context.Context) ([]*domain.Role, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var rows []roleRow
+	if err := rs.db.Table("roles").Order("id").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	return rs.withPermissions(rows)
+}
+
+func (rs *roleStorage) FindByName(ctx context.Context, name string) (*domain.Role, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var rows []roleRow
+	if err := rs.db.Table("roles").Where(`roles.name=(?)`, name).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	roles, err := rs.withPermissions(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	return roles[0], nil
+}
+
+func (rs *roleStorage) FindByUserID(ctx context.Context, userID int) ([]*domain.Role, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var rows []roleRow
+	err := rs.db.Table("roles").
+		Select("roles.id, roles.name, roles.description").
+		Joins("JOIN user_roles ON user_roles.role_id = roles.id").
+		Where(`user_roles.user_id=(?)`, userID).
+		Order("roles.id").
+		Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return rs.withPermissions(rows)
+}
+
+func (rs *roleStorage) AddUser(ctx context.Context, roleID, userID int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return rs.db.Exec(rs.dialect.InsertUserRole, userID, roleID).Error
+}
+
+func (rs *roleStorage) RemoveUser(ctx context.Context, roleID, userID int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return rs.db.Exec(`DELETE FROM user_roles WHERE user_id = ? AND role_id = ?`, userID, roleID).Error
+}
+
+// withPermissions loads the permissions of the roles in one query
+func (rs *roleStorage) withPermissions(rows []roleRow) ([]*domain.Role, error) {
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	roles := make([]*domain.Role, 0, len(rows))
+	byID := make(map[int]*domain.Role, len(rows))
+	IDs := make([]int, 0, len(rows))
+	for _, row := range rows {
+		role := &domain.Role{ID: row.ID, Name: row.Name, Description: row.Description}
+		roles = append(roles, role)
+		byID[role.ID] = role
+		IDs = append(IDs, role.ID)
+	}
+
+	var permissions []rolePermissionRow
+	err := rs.db.Table("role_permissions").
+		Select("role_permissions.role_id, permissions.name").
+		Joins("JOIN permissions ON permissions.id = role_permissions.permission_id").
+		Where(`role_permissions.role_id IN (?)`, IDs).
+		Order("permissions.id").
+		Find(&permissions).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, permission := range permissions {
+		role := byID[permission.RoleID]
+		role.Permissions = append(role.Permissions, domain.Permission(permission.Name))
+	}
+
+	return roles, nil
+}
@@ -0,0 +1,72 @@
+package sqlstore
+
+import (
+	"context"
+	"time"
+
+	"github.com/jinzhu/gorm"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/pkg/log"
+)
+
+type sessionStorage struct {
+	db  *gorm.DB
+	log log.Logger
+}
+
+func NewSessionStorage(db *gorm.DB, log log.Logger) (*sessionStorage, error) {
+	return &sessionStorage{
+		db:  db,
+		log: log,
+	}, nil
+}
+
+func (ss *sessionStorage) Insert(ctx context.Context, session *domain.Session) error {
+	return ss.db.Create(session).Error
+}
+
+func (ss *sessionStorage) FindByTokenHash(ctx context.Context, hash string) (*domain.Session, error) {
+	var session domain.Session
+	if err := ss.db.Where(`sessions.token_hash=(?)`, hash).Find(&session).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+func (ss *sessionStorage) FindByUserID(ctx context.Context, userID int) ([]*domain.Session, error) {
+	var sessions []*domain.Session
+	if err := ss.db.Where(`sessions.user_id=(?)`, userID).Order("last_seen_at desc").Find(&sessions).Error; err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+func (ss *sessionStorage) Touch(ctx context.Context, ID int, lastSeenAt, expiresAt time.Time) error {
+	return ss.db.Model(&domain.Session{}).Where(`sessions.id=(?)`, ID).Updates(map[string]interface{}{
+		"last_seen_at": lastSeenAt,
+		"expires_at":   expiresAt,
+	}).Error
+}
+
+func (ss *sessionStorage) SetOrganization(ctx context.Context, ID int, organizationID *int) error {
+	return ss.db.Model(&domain.Session{}).Where(`sessions.id=(?)`, ID).Update("organization_id", organizationID).Error
+}
+
+func (ss *sessionStorage) Delete(ctx context.Context, userID, ID int) error {
+	return ss.db.Where(`sessions.user_id=(?) AND sessions.id=(?)`, userID, ID).Delete(&domain.Session{}).Error
+}
+
+func (ss *sessionStorage) DeleteByUserID(ctx context.Context, userID int) error {
+	return ss.db.Where(`sessions.user_id=(?)`, userID).Delete(&domain.Session{}).Error
+}
+
+func (ss *sessionStorage) DeleteExpired(ctx context.Context, userID int, now time.Time) error {
+	return ss.db.Where(`sessions.user_id=(?) AND sessions.expires_at <= (?)`, userID, now).Delete(&domain.Session{}).Error
+}
@@ -0,0 +1,96 @@
+package sqlstore
+
+import (
+	"context"
+	"time"
+
+	"github.com/jinzhu/gorm"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/pkg/log"
+)
+
+// throttleEntry maps domain.ThrottleEntry since "key" is a reserved word in MySQL
+type throttleEntry struct {
+	ThrottleKey string
+	Attempts    int
+	LockedUntil *time.Time
+	ExpiresAt   time.Time
+}
+
+func (throttleEntry) TableName() string {
+	return "throttle_entries"
+}
+
+// throttleStore shares the attempts between instances of the server
+type throttleStore struct {
+	db      *gorm.DB
+	dialect Dialect
+	log     log.Logger
+}
+
+func NewThrottleStore(db *gorm.DB, dialect Dialect, log log.Logger) (*throttleStore, error) {
+	return &throttleStore{
+		db:      db,
+		dialect: dialect,
+		log:     log,
+	}, nil
+}
+
+func (ts *throttleStore) Get(ctx context.Context, key string) (*domain.ThrottleEntry, error) {
+	var entry throttleEntry
+	if err := ts.db.Where(`throttle_entries.throttle_key=(?)`, key).Find(&entry).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return entry.toDomain(), nil
+}
+
+// Increment counts the attempt in a single upsert of the dialect, so concurrent attempts are all
+// counted, and then reads the entry back
+func (ts *throttleStore) Increment(ctx context.Context, key string, now time.Time, window time.Duration) (*domain.ThrottleEntry, error) {
+	if err := ts.db.Exec(ts.dialect.IncrementThrottle, key, now.Add(window), now, now).Error; err != nil {
+		return nil, err
+	}
+
+	if err := ts.db.Where(`throttle_entries.expires_at <= (?)`, now).Delete(&throttleEntry{}).Error; err != nil {
+		ts.log.Warn().Err(err).Sendf("failed to delete expired throttle entries")
+	}
+
+	entry, err := ts.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if entry == nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	return entry, nil
+}
+
+// Lock keeps the latest expiration, sqlite stores the timestamps as text in UTC so they compare
+// like the other databases
+func (ts *throttleStore) Lock(ctx context.Context, key string, until, expiresAt time.Time) error {
+	return ts.db.Exec(`UPDATE throttle_entries SET locked_until = ?,
+			expires_at = CASE WHEN expires_at < ? THEN ? ELSE expires_at END
+		WHERE throttle_key = ?`,
+		until, expiresAt, expiresAt, key).Error
+}
+
+func (ts *throttleStore) Delete(ctx context.Context, key string) error {
+	return ts.db.Where(`throttle_entries.throttle_key=(?)`, key).Delete(&throttleEntry{}).Error
+}
+
+func (e *throttleEntry) toDomain() *domain.ThrottleEntry {
+	return &domain.ThrottleEntry{
+		Key:         e.ThrottleKey,
+		Attempts:    e.Attempts,
+		LockedUntil: e.LockedUntil,
+		ExpiresAt:   e.ExpiresAt,
+	}
+}
@@ -0,0 +1,160 @@
+package sqlstore
+
+import (
+	"context"
+
+	"github.com/jinzhu/gorm"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/internal/infrastructure/storage"
+	"gitlab.com/evzpav/user-auth/pkg/errors"
+	"gitlab.com/evzpav/user-auth/pkg/log"
+)
+
+type userStorage struct {
+	db      *gorm.DB
+	dialect Dialect
+	log     log.Logger
+}
+
+// NewUserStorage queries without the soft delete of gorm, deleted users are still found by the
+// admins and keep their email taken
+func NewUserStorage(db *gorm.DB, dialect Dialect, log log.Logger) (*userStorage, error) {
+	return &userStorage{
+		db:      db.Unscoped(),
+		dialect: dialect,
+		log:     log,
+	}, nil
+}
+
+// Insert relies on the unique index of the email, the migrations of each database make it case
+// insensitive so addresses differing only in case are duplicated
+func (us *userStorage) Insert(ctx context.Context, inputUser *domain.User) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := us.db.Create(inputUser).Error; err != nil {
+		if us.dialect.IsUniqueViolation(err) {
+			return errors.NewDuplicatedRecord(storage.ErrUserDuplicated)
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func (us *userStorage) FindByEmail(ctx context.Context, email string) (*domain.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var user domain.User
+	if err := us.db.Where(`users.email=(?)`, email).Find(&user).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+func (us *userStorage) FindByID(ctx context.Context, ID int) (*domain.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var user domain.User
+	if err := us.db.Where(`users.id=(?)`, ID).Find(&user).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+func (us *userStorage) Update(ctx context.Context, inputUser *domain.User) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := us.db.Save(inputUser).Error; err != nil {
+		if us.dialect.IsUniqueViolation(err) {
+			return errors.NewDuplicatedRecord(storage.ErrUserDuplicated)
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func (us *userStorage) UseTOTPStep(ctx context.Context, userID int, step int64) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	result := us.db.Model(&domain.User{}).
+		Where(`users.id=(?) AND users.totp_last_step<(?)`, userID, step).
+		UpdateColumn("totp_last_step", step)
+	if result.Error != nil {
+		return false, result.Error
+	}
+
+	return result.RowsAffected == 1, nil
+}
+
+func (us *userStorage) ReplaceRecoveryCodes(ctx context.Context, userID int, current, replacement string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	result := us.db.Model(&domain.User{}).
+		Where(`users.id=(?) AND users.mfa_recovery_codes=(?)`, userID, current).
+		UpdateColumn("mfa_recovery_codes", replacement)
+	if result.Error != nil {
+		return false, result.Error
+	}
+
+	return result.RowsAffected == 1, nil
+}
+
+func (us *userStorage) List(ctx context.Context, filter *domain.UserFilter) ([]*domain.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	db := storage.FilterUsers(us.db, filter).Order("id")
+	if filter.Limit > 0 {
+		db = db.Limit(filter.Limit)
+	}
+	if filter.Offset > 0 {
+		db = db.Offset(filter.Offset)
+	}
+
+	var users []*domain.User
+	if err := db.Find(&users).Error; err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+func (us *userStorage) Count(ctx context.Context, filter *domain.UserFilter) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	var count int
+	if err := storage.FilterUsers(us.db.Model(&domain.User{}), filter).Count(&count).Error; err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
@@ -0,0 +1,82 @@
+package sqlstore
+
+import (
+	"context"
+
+	"github.com/jinzhu/gorm"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/internal/infrastructure/storage"
+	"gitlab.com/evzpav/user-auth/pkg/errors"
+	"gitlab.com/evzpav/user-auth/pkg/log"
+)
+
+type userIdentityStorage struct {
+	db      *gorm.DB
+	dialect Dialect
+	log     log.Logger
+}
+
+func NewUserIdentityStorage(db *gorm.DB, dialect Dialect, log log.Logger) (*userIdentityStorage, error) {
+	return &userIdentityStorage{
+		db:      db,
+		dialect: dialect,
+		log:     log,
+	}, nil
+}
+
+// Insert relies on the unique index of the provider and subject, an account is linked to one user
+func (is *userIdentityStorage) Insert(ctx context.Context, identity *domain.UserIdentity) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := is.db.Create(identity).Error; err != nil {
+		if is.dialect.IsUniqueViolation(err) {
+			return errors.NewDuplicatedRecord(storage.ErrIdentityDuplicated)
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func (is *userIdentityStorage) FindBySubject(ctx context.Context, provider, subject string) (*domain.UserIdentity, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var identity domain.UserIdentity
+	if err := is.db.Where(`user_identities.provider=(?) AND user_identities.subject=(?)`, provider, subject).Find(&identity).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return &identity, nil
+}
+
+// FindByUserID returns the identities of the user, the first linked first
+func (is *userIdentityStorage) FindByUserID(ctx context.Context, userID int) ([]*domain.UserIdentity, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var identities []*domain.UserIdentity
+	if err := is.db.Where(`user_identities.user_id=(?)`, userID).Order("id").Find(&identities).Error; err != nil {
+		return nil, err
+	}
+
+	return identities, nil
+}
+
+func (is *userIdentityStorage) Delete(ctx context.Context, userID, ID int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return is.db.Where(`user_identities.user_id=(?) AND user_identities.id=(?)`, userID, ID).Delete(&domain.UserIdentity{}).Error
+}
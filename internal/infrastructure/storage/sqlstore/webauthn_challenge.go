@@ -0,0 +1,55 @@
+package sqlstore
+
+import (
+	"context"
+	"time"
+
+	"github.com/jinzhu/gorm"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/pkg/log"
+)
+
+type webAuthnChallengeStorage struct {
+	db  *gorm.DB
+	log log.Logger
+}
+
+func NewWebAuthnChallengeStorage(db *gorm.DB, log log.Logger) (*webAuthnChallengeStorage, error) {
+	return &webAuthnChallengeStorage{
+		db:  db,
+		log: log,
+	}, nil
+}
+
+func (ws *webAuthnChallengeStorage) Insert(ctx context.Context, challenge *domain.WebAuthnChallenge) error {
+	return ws.db.Create(challenge).Error
+}
+
+// Take finds the challenge and deletes it by ID, the request that deletes the row is the only one
+// to get the challenge back
+func (ws *webAuthnChallengeStorage) Take(ctx context.Context, nonceHash string) (*domain.WebAuthnChallenge, error) {
+	var challenge domain.WebAuthnChallenge
+	if err := ws.db.Where(`web_authn_challenges.nonce_hash=(?)`, nonceHash).Find(&challenge).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	result := ws.db.Where(`web_authn_challenges.id=(?)`, challenge.ID).Delete(&domain.WebAuthnChallenge{})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	if result.RowsAffected != 1 {
+		return nil, nil
+	}
+
+	return &challenge, nil
+}
+
+func (ws *webAuthnChallengeStorage) DeleteExpired(ctx context.Context, now time.Time) error {
+	return ws.db.Where(`web_authn_challenges.expires_at<=(?)`, now).Delete(&domain.WebAuthnChallenge{}).Error
+}
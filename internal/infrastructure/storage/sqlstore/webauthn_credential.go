@@ -0,0 +1,76 @@
+package sqlstore
+
+import (
+	"context"
+	"time"
+
+	"github.com/jinzhu/gorm"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/pkg/log"
+)
+
+type webAuthnCredentialStorage struct {
+	db  *gorm.DB
+	log log.Logger
+}
+
+func NewWebAuthnCredentialStorage(db *gorm.DB, log log.Logger) (*webAuthnCredentialStorage, error) {
+	return &webAuthnCredentialStorage{
+		db:  db,
+		log: log,
+	}, nil
+}
+
+func (ws *webAuthnCredentialStorage) Insert(ctx context.Context, credential *domain.WebAuthnCredential) error {
+	return ws.db.Create(credential).Error
+}
+
+func (ws *webAuthnCredentialStorage) FindByCredentialID(ctx context.Context, credentialID string) (*domain.WebAuthnCredential, error) {
+	var credential domain.WebAuthnCredential
+	if err := ws.db.Where(`web_authn_credentials.credential_id=(?)`, credentialID).Find(&credential).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return &credential, nil
+}
+
+func (ws *webAuthnCredentialStorage) FindByUserID(ctx context.Context, userID int) ([]*domain.WebAuthnCredential, error) {
+	var credentials []*domain.WebAuthnCredential
+	if err := ws.db.Where(`web_authn_credentials.user_id=(?)`, userID).Order("created_at").Find(&credentials).Error; err != nil {
+		return nil, err
+	}
+
+	return credentials, nil
+}
+
+func (ws *webAuthnCredentialStorage) UpdateSignCount(ctx context.Context, ID int, signCount uint32, lastUsedAt time.Time) (bool, error) {
+	db := ws.db.Model(&domain.WebAuthnCredential{}).Where(`web_authn_credentials.id=(?)`, ID)
+	if signCount == 0 {
+		db = db.Where(`web_authn_credentials.sign_count=0`)
+	} else {
+		db = db.Where(`web_authn_credentials.sign_count<(?)`, signCount)
+	}
+
+	result := db.Updates(map[string]interface{}{
+		"sign_count":   signCount,
+		"last_used_at": lastUsedAt,
+	})
+	if result.Error != nil {
+		return false, result.Error
+	}
+
+	return result.RowsAffected == 1, nil
+}
+
+func (ws *webAuthnCredentialStorage) Rename(ctx context.Context, userID, ID int, name string) error {
+	return ws.db.Model(&domain.WebAuthnCredential{}).Where(`web_authn_credentials.user_id=(?) AND web_authn_credentials.id=(?)`, userID, ID).Update("name", name).Error
+}
+
+func (ws *webAuthnCredentialStorage) Delete(ctx context.Context, userID, ID int) error {
+	return ws.db.Where(`web_authn_credentials.user_id=(?) AND web_authn_credentials.id=(?)`, userID, ID).Delete(&domain.WebAuthnCredential{}).Error
+}
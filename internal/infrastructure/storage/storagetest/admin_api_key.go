@@ -0,0 +1,122 @@
+package storagetest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+)
+
+// RunAdminAPIKeyStorage checks the domain.AdminAPIKeyStorage contract. newStorage is called once per
+// subtest and must return a storage without keys.
+func RunAdminAPIKeyStorage(t *testing.T, newStorage func(t *testing.T) domain.AdminAPIKeyStorage) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, keys domain.AdminAPIKeyStorage)
+	}{
+		{"InsertAndFind", testAdminAPIKeyInsertAndFind},
+		{"List", testAdminAPIKeyList},
+		{"Revoke", testAdminAPIKeyRevoke},
+		{"Touch", testAdminAPIKeyTouch},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newStorage(t))
+		})
+	}
+}
+
+func newAdminAPIKey(name, hash string) *domain.AdminAPIKey {
+	return &domain.AdminAPIKey{
+		Name:        name,
+		Prefix:      domain.AdminAPIKeyPrefix + hash[:8],
+		KeyHash:     hash,
+		Permissions: "users:read users:write",
+		CreatedAt:   time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC),
+	}
+}
+
+func testAdminAPIKeyInsertAndFind(t *testing.T, keys domain.AdminAPIKeyStorage) {
+	ctx := context.Background()
+
+	key := newAdminAPIKey("support tool", "hash-0000000001")
+	require.NoError(t, keys.Insert(ctx, key))
+	assert.NotZero(t, key.ID)
+
+	found, err := keys.FindByHash(ctx, "hash-0000000001")
+	require.NoError(t, err)
+	require.NotNil(t, found)
+	assert.Equal(t, key.ID, found.ID)
+	assert.Equal(t, "support tool", found.Name)
+	assert.Equal(t, key.Prefix, found.Prefix)
+	assert.Equal(t, "users:read users:write", found.Permissions)
+	assert.True(t, key.CreatedAt.Equal(found.CreatedAt))
+	assert.Nil(t, found.LastUsedAt)
+	assert.Nil(t, found.RevokedAt)
+
+	found, err = keys.FindByHash(ctx, "hash-missing")
+	require.NoError(t, err)
+	assert.Nil(t, found, "missing keys are nil without error")
+}
+
+func testAdminAPIKeyList(t *testing.T, keys domain.AdminAPIKeyStorage) {
+	ctx := context.Background()
+
+	list, err := keys.List(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, list)
+
+	require.NoError(t, keys.Insert(ctx, newAdminAPIKey("first", "hash-0000000001")))
+	require.NoError(t, keys.Insert(ctx, newAdminAPIKey("second", "hash-0000000002")))
+
+	list, err = keys.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	assert.Equal(t, "first", list[0].Name)
+	assert.Equal(t, "second", list[1].Name)
+}
+
+func testAdminAPIKeyRevoke(t *testing.T, keys domain.AdminAPIKeyStorage) {
+	ctx := context.Background()
+	at := time.Date(2020, 6, 2, 12, 0, 0, 0, time.UTC)
+
+	key := newAdminAPIKey("support tool", "hash-0000000001")
+	require.NoError(t, keys.Insert(ctx, key))
+
+	revoked, err := keys.Revoke(ctx, key.ID, at)
+	require.NoError(t, err)
+	assert.True(t, revoked)
+
+	found, err := keys.FindByHash(ctx, "hash-0000000001")
+	require.NoError(t, err)
+	require.NotNil(t, found.RevokedAt)
+	assert.True(t, at.Equal(*found.RevokedAt))
+
+	revoked, err = keys.Revoke(ctx, key.ID, at.Add(time.Hour))
+	require.NoError(t, err)
+	assert.False(t, revoked, "revoking again does nothing")
+
+	revoked, err = keys.Revoke(ctx, key.ID+1000, at)
+	require.NoError(t, err)
+	assert.False(t, revoked)
+}
+
+func testAdminAPIKeyTouch(t *testing.T, keys domain.AdminAPIKeyStorage) {
+	ctx := context.Background()
+	at := time.Date(2020, 6, 2, 12, 0, 0, 0, time.UTC)
+
+	key := newAdminAPIKey("support tool", "hash-0000000001")
+	require.NoError(t, keys.Insert(ctx, key))
+	require.NoError(t, keys.Touch(ctx, key.ID, at))
+
+	found, err := keys.FindByHash(ctx, "hash-0000000001")
+	require.NoError(t, err)
+	require.NotNil(t, found.LastUsedAt)
+	assert.True(t, at.Equal(*found.LastUsedAt))
+}
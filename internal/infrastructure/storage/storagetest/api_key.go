@@ -0,0 +1,128 @@
+package storagetest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+)
+
+// RunAPIKeyStorage checks the domain.APIKeyStorage contract. newStorage is called once per subtest
+// and must return a storage without keys.
+func RunAPIKeyStorage(t *testing.T, newStorage func(t *testing.T) domain.APIKeyStorage) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, keys domain.APIKeyStorage)
+	}{
+		{"InsertAndFind", testAPIKeyInsertAndFind},
+		{"FindByUserID", testAPIKeyFindByUserID},
+		{"Revoke", testAPIKeyRevoke},
+		{"Touch", testAPIKeyTouch},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newStorage(t))
+		})
+	}
+}
+
+func newAPIKey(userID int, name, hash string) *domain.APIKey {
+	created := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	return &domain.APIKey{
+		UserID:    userID,
+		Name:      name,
+		Prefix:    domain.APIKeyPrefix + hash[:8],
+		KeyHash:   hash,
+		Scopes:    "profile:read",
+		CreatedAt: created,
+		ExpiresAt: created.Add(30 * 24 * time.Hour),
+	}
+}
+
+func testAPIKeyInsertAndFind(t *testing.T, keys domain.APIKeyStorage) {
+	ctx := context.Background()
+
+	key := newAPIKey(1, "deploy script", "hash-0000000001")
+	require.NoError(t, keys.Insert(ctx, key))
+	assert.NotZero(t, key.ID)
+
+	found, err := keys.FindByHash(ctx, "hash-0000000001")
+	require.NoError(t, err)
+	require.NotNil(t, found)
+	assert.Equal(t, key.ID, found.ID)
+	assert.Equal(t, 1, found.UserID)
+	assert.Equal(t, "deploy script", found.Name)
+	assert.Equal(t, key.Prefix, found.Prefix)
+	assert.Equal(t, "profile:read", found.Scopes)
+	assert.True(t, key.CreatedAt.Equal(found.CreatedAt))
+	assert.True(t, key.ExpiresAt.Equal(found.ExpiresAt))
+	assert.Nil(t, found.LastUsedAt)
+	assert.Nil(t, found.RevokedAt)
+
+	found, err = keys.FindByHash(ctx, "hash-missing")
+	require.NoError(t, err)
+	assert.Nil(t, found, "missing keys are nil without error")
+}
+
+func testAPIKeyFindByUserID(t *testing.T, keys domain.APIKeyStorage) {
+	ctx := context.Background()
+
+	require.NoError(t, keys.Insert(ctx, newAPIKey(1, "first", "hash-0000000001")))
+	require.NoError(t, keys.Insert(ctx, newAPIKey(2, "other user", "hash-0000000002")))
+	require.NoError(t, keys.Insert(ctx, newAPIKey(1, "second", "hash-0000000003")))
+
+	list, err := keys.FindByUserID(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	assert.Equal(t, "first", list[0].Name)
+	assert.Equal(t, "second", list[1].Name)
+
+	list, err = keys.FindByUserID(ctx, 3)
+	require.NoError(t, err)
+	assert.Empty(t, list)
+}
+
+func testAPIKeyRevoke(t *testing.T, keys domain.APIKeyStorage) {
+	ctx := context.Background()
+	at := time.Date(2020, 6, 2, 12, 0, 0, 0, time.UTC)
+
+	key := newAPIKey(1, "deploy script", "hash-0000000001")
+	require.NoError(t, keys.Insert(ctx, key))
+
+	revoked, err := keys.Revoke(ctx, 2, key.ID, at)
+	require.NoError(t, err)
+	assert.False(t, revoked, "only the owner revokes the key")
+
+	revoked, err = keys.Revoke(ctx, 1, key.ID, at)
+	require.NoError(t, err)
+	assert.True(t, revoked)
+
+	found, err := keys.FindByHash(ctx, "hash-0000000001")
+	require.NoError(t, err)
+	require.NotNil(t, found.RevokedAt)
+	assert.True(t, at.Equal(*found.RevokedAt))
+
+	revoked, err = keys.Revoke(ctx, 1, key.ID, at.Add(time.Hour))
+	require.NoError(t, err)
+	assert.False(t, revoked, "revoking again does nothing")
+}
+
+func testAPIKeyTouch(t *testing.T, keys domain.APIKeyStorage) {
+	ctx := context.Background()
+	at := time.Date(2020, 6, 2, 12, 0, 0, 0, time.UTC)
+
+	key := newAPIKey(1, "deploy script", "hash-0000000001")
+	require.NoError(t, keys.Insert(ctx, key))
+	require.NoError(t, keys.Touch(ctx, key.ID, at))
+
+	found, err := keys.FindByHash(ctx, "hash-0000000001")
+	require.NoError(t, err)
+	require.NotNil(t, found.LastUsedAt)
+	assert.True(t, at.Equal(*found.LastUsedAt))
+}
@@ -0,0 +1,146 @@
+package storagetest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+)
+
+// RunAuditStorage checks the domain.AuditStorage contract. newStorage is called once per subtest and
+// must return a storage without events.
+func RunAuditStorage(t *testing.T, newStorage func(t *testing.T) domain.AuditStorage) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, events domain.AuditStorage)
+	}{
+		{"InsertAndList", testAuditInsertAndList},
+		{"Filter", testAuditFilter},
+		{"Page", testAuditPage},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newStorage(t))
+		})
+	}
+}
+
+var auditStart = time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+
+func intPtr(i int) *int {
+	return &i
+}
+
+// insertAuditEvents inserts the events in order, an hour apart
+func insertAuditEvents(t *testing.T, events domain.AuditStorage, list ...*domain.AuditEvent) {
+	for i, event := range list {
+		event.CreatedAt = auditStart.Add(time.Duration(i) * time.Hour)
+		require.NoError(t, events.Insert(context.Background(), event))
+		require.NotZero(t, event.ID)
+	}
+}
+
+func testAuditInsertAndList(t *testing.T, events domain.AuditStorage) {
+	ctx := context.Background()
+
+	event := &domain.AuditEvent{
+		Type:      domain.AuditProfileChanged,
+		ActorID:   intPtr(1),
+		UserID:    intPtr(2),
+		IP:        "203.0.113.7",
+		UserAgent: "Mozilla/5.0",
+		Changes:   `{"email":{"from":"old@example.com","to":"new@example.com"}}`,
+	}
+	insertAuditEvents(t, events, event, &domain.AuditEvent{Type: domain.AuditLoginFailed, AdminAPIKeyID: intPtr(3)})
+
+	list, err := events.List(ctx, &domain.AuditFilter{})
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	assert.Equal(t, domain.AuditLoginFailed, list[0].Type, "the newest event comes first")
+	assert.Nil(t, list[0].ActorID)
+	assert.Nil(t, list[0].UserID)
+	require.NotNil(t, list[0].AdminAPIKeyID)
+	assert.Equal(t, 3, *list[0].AdminAPIKeyID)
+
+	found := list[1]
+	assert.Equal(t, event.ID, found.ID)
+	assert.Equal(t, domain.AuditProfileChanged, found.Type)
+	require.NotNil(t, found.ActorID)
+	assert.Equal(t, 1, *found.ActorID)
+	require.NotNil(t, found.UserID)
+	assert.Equal(t, 2, *found.UserID)
+	assert.Equal(t, "203.0.113.7", found.IP)
+	assert.Equal(t, "Mozilla/5.0", found.UserAgent)
+	assert.JSONEq(t, event.Changes, found.Changes)
+	assert.True(t, auditStart.Equal(found.CreatedAt))
+}
+
+func testAuditFilter(t *testing.T, events domain.AuditStorage) {
+	ctx := context.Background()
+
+	insertAuditEvents(t, events,
+		&domain.AuditEvent{Type: domain.AuditSignup, ActorID: intPtr(1), UserID: intPtr(1), IP: "203.0.113.7"},
+		&domain.AuditEvent{Type: domain.AuditLoginFailed, UserID: intPtr(1), IP: "198.51.100.1"},
+		&domain.AuditEvent{Type: domain.AuditLoginSucceeded, ActorID: intPtr(2), UserID: intPtr(2), IP: "203.0.113.7"},
+		&domain.AuditEvent{Type: domain.AuditProfileChanged, ActorID: intPtr(2), UserID: intPtr(1), IP: "203.0.113.7"},
+	)
+
+	after, before := auditStart.Add(time.Hour), auditStart.Add(3*time.Hour)
+	tests := []struct {
+		name   string
+		filter domain.AuditFilter
+		want   []domain.AuditEventType
+	}{
+		{"all", domain.AuditFilter{}, []domain.AuditEventType{domain.AuditProfileChanged, domain.AuditLoginSucceeded, domain.AuditLoginFailed, domain.AuditSignup}},
+		{"user", domain.AuditFilter{UserID: intPtr(1)}, []domain.AuditEventType{domain.AuditProfileChanged, domain.AuditLoginFailed, domain.AuditSignup}},
+		{"actor", domain.AuditFilter{ActorID: intPtr(2)}, []domain.AuditEventType{domain.AuditProfileChanged, domain.AuditLoginSucceeded}},
+		{"type", domain.AuditFilter{Type: domain.AuditLoginFailed}, []domain.AuditEventType{domain.AuditLoginFailed}},
+		{"ip", domain.AuditFilter{IP: "203.0.113.7", UserID: intPtr(1)}, []domain.AuditEventType{domain.AuditProfileChanged, domain.AuditSignup}},
+		{"time", domain.AuditFilter{After: &after, Before: &before}, []domain.AuditEventType{domain.AuditLoginSucceeded, domain.AuditLoginFailed}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter := tt.filter
+
+			list, err := events.List(ctx, &filter)
+			require.NoError(t, err)
+
+			types := make([]domain.AuditEventType, 0, len(list))
+			for _, event := range list {
+				types = append(types, event.Type)
+			}
+			assert.Equal(t, tt.want, types)
+
+			count, err := events.Count(ctx, &filter)
+			require.NoError(t, err)
+			assert.Equal(t, len(tt.want), count)
+		})
+	}
+}
+
+func testAuditPage(t *testing.T, events domain.AuditStorage) {
+	ctx := context.Background()
+
+	var inserted []*domain.AuditEvent
+	for i := 0; i < 5; i++ {
+		inserted = append(inserted, &domain.AuditEvent{Type: domain.AuditLogout, UserID: intPtr(1)})
+	}
+	insertAuditEvents(t, events, inserted...)
+
+	list, err := events.List(ctx, &domain.AuditFilter{Limit: 2, Offset: 1})
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	assert.Equal(t, inserted[3].ID, list[0].ID)
+	assert.Equal(t, inserted[2].ID, list[1].ID)
+
+	count, err := events.Count(ctx, &domain.AuditFilter{Limit: 2, Offset: 1})
+	require.NoError(t, err)
+	assert.Equal(t, 5, count, "the count ignores the page")
+}
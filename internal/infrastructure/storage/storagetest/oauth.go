@@ -0,0 +1,254 @@
+package storagetest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/internal/infrastructure/storage"
+	"gitlab.com/evzpav/user-auth/pkg/errors"
+)
+
+// OAuthStorages are the storages of the authorization server, they share a database
+type OAuthStorages struct {
+	Clients  domain.OAuthClientStorage
+	Codes    domain.OAuthAuthorizationCodeStorage
+	Tokens   domain.OAuthTokenStorage
+	Consents domain.OAuthConsentStorage
+}
+
+// RunOAuthStorage checks the contracts of the OAuth storages. newStorages is called once per
+// subtest and must return empty storages.
+func RunOAuthStorage(t *testing.T, newStorages func(t *testing.T) OAuthStorages) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, storages OAuthStorages)
+	}{
+		{"Clients", testOAuthClients},
+		{"AuthorizationCodes", testOAuthAuthorizationCodes},
+		{"Tokens", testOAuthTokens},
+		{"Consents", testOAuthConsents},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newStorages(t))
+		})
+	}
+}
+
+func testOAuthClients(t *testing.T, storages OAuthStorages) {
+	ctx := context.Background()
+	clients := storages.Clients
+
+	found, err := clients.FindByClientID(ctx, "b6a7c3e2-0d7e-4a55-9d5e-0d3c1f6b8a01")
+	require.NoError(t, err)
+	assert.Nil(t, found, "missing clients are nil without error")
+
+	confidential := &domain.OAuthClient{
+		ClientID:               "b6a7c3e2-0d7e-4a55-9d5e-0d3c1f6b8a01",
+		SecretHash:             "hash",
+		Name:                   "Billing",
+		RedirectURIs:           "https://billing.example.com/callback https://billing.example.com/other",
+		PostLogoutRedirectURIs: "https://billing.example.com/logged-out",
+		Scopes:                 "profile email",
+		CreatedAt:              time.Now().UTC().Truncate(time.Second),
+	}
+	require.NoError(t, clients.Insert(ctx, confidential))
+	assert.NotZero(t, confidential.ID)
+
+	public := &domain.OAuthClient{
+		ClientID:     "b6a7c3e2-0d7e-4a55-9d5e-0d3c1f6b8a02",
+		Name:         "Mobile",
+		RedirectURIs: "com.example.app:/callback",
+		CreatedAt:    time.Now().UTC().Truncate(time.Second),
+	}
+	require.NoError(t, clients.Insert(ctx, public))
+
+	err = clients.Insert(ctx, &domain.OAuthClient{ClientID: public.ClientID, Name: "Other", CreatedAt: time.Now()})
+	describer, ok := errors.DuplicatedRecordCast(err)
+	require.True(t, ok, "expected duplicated record, got %v", err)
+	assert.Equal(t, storage.ErrOAuthClientDuplicated, describer.GetCode())
+
+	found, err = clients.FindByClientID(ctx, confidential.ClientID)
+	require.NoError(t, err)
+	require.NotNil(t, found)
+	assert.Equal(t, confidential.ID, found.ID)
+	assert.Equal(t, "hash", found.SecretHash)
+	assert.Equal(t, confidential.Name, found.Name)
+	assert.Equal(t, confidential.RedirectURIs, found.RedirectURIs)
+	assert.Equal(t, confidential.PostLogoutRedirectURIs, found.PostLogoutRedirectURIs)
+	assert.Equal(t, confidential.Scopes, found.Scopes)
+	assert.WithinDuration(t, confidential.CreatedAt, found.CreatedAt, time.Second)
+
+	list, err := clients.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	assert.Equal(t, confidential.ClientID, list[0].ClientID)
+	assert.Equal(t, public.ClientID, list[1].ClientID)
+	assert.False(t, list[1].Confidential())
+
+	require.NoError(t, clients.Delete(ctx, confidential.ClientID))
+	found, err = clients.FindByClientID(ctx, confidential.ClientID)
+	require.NoError(t, err)
+	assert.Nil(t, found)
+}
+
+func testOAuthAuthorizationCodes(t *testing.T, storages OAuthStorages) {
+	ctx := context.Background()
+	codes := storages.Codes
+	now := time.Now().UTC().Truncate(time.Second)
+
+	found, err := codes.FindByHash(ctx, "hash")
+	require.NoError(t, err)
+	assert.Nil(t, found)
+
+	code := &domain.OAuthAuthorizationCode{
+		CodeHash:      "hash",
+		ClientID:      "client",
+		UserID:        1,
+		RedirectURI:   "https://app.example.com/callback",
+		Scope:         "profile",
+		CodeChallenge: "challenge",
+		Nonce:         "nonce",
+		FamilyID:      "family",
+		CreatedAt:     now,
+		ExpiresAt:     now.Add(time.Minute),
+	}
+	require.NoError(t, codes.Insert(ctx, code))
+	assert.NotZero(t, code.ID)
+
+	found, err = codes.FindByHash(ctx, "hash")
+	require.NoError(t, err)
+	require.NotNil(t, found)
+	assert.Equal(t, code.ID, found.ID)
+	assert.Equal(t, code.RedirectURI, found.RedirectURI)
+	assert.Equal(t, code.CodeChallenge, found.CodeChallenge)
+	assert.Equal(t, code.Nonce, found.Nonce)
+	assert.Equal(t, code.FamilyID, found.FamilyID)
+	assert.WithinDuration(t, code.ExpiresAt, found.ExpiresAt, time.Second)
+	assert.Nil(t, found.UsedAt)
+
+	used, err := codes.MarkUsed(ctx, code.ID, now)
+	require.NoError(t, err)
+	assert.True(t, used)
+
+	used, err = codes.MarkUsed(ctx, code.ID, now)
+	require.NoError(t, err)
+	assert.False(t, used, "a code is used once")
+
+	found, err = codes.FindByHash(ctx, "hash")
+	require.NoError(t, err)
+	require.NotNil(t, found)
+	assert.NotNil(t, found.UsedAt)
+}
+
+func newOAuthToken(hash, kind, clientID, familyID string) *domain.OAuthToken {
+	now := time.Now().UTC().Truncate(time.Second)
+	return &domain.OAuthToken{
+		TokenHash: hash,
+		Kind:      kind,
+		ClientID:  clientID,
+		UserID:    1,
+		Scope:     "profile",
+		FamilyID:  familyID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(time.Hour),
+	}
+}
+
+func findOAuthToken(t *testing.T, tokens domain.OAuthTokenStorage, hash string) *domain.OAuthToken {
+	token, err := tokens.FindByHash(context.Background(), hash)
+	require.NoError(t, err)
+	require.NotNil(t, token)
+	return token
+}
+
+func testOAuthTokens(t *testing.T, storages OAuthStorages) {
+	ctx := context.Background()
+	tokens := storages.Tokens
+	now := time.Now()
+
+	access := newOAuthToken("access", domain.OAuthAccessToken, "client", "family")
+	refresh := newOAuthToken("refresh", domain.OAuthRefreshToken, "client", "family")
+	other := newOAuthToken("other", domain.OAuthAccessToken, "client", "other-family")
+	service := newOAuthToken("service", domain.OAuthAccessToken, "service", "service-family")
+	service.UserID = 0
+	for _, token := range []*domain.OAuthToken{access, refresh, other, service} {
+		require.NoError(t, tokens.Insert(ctx, token))
+		assert.NotZero(t, token.ID)
+	}
+
+	found, err := tokens.FindByHash(ctx, "missing")
+	require.NoError(t, err)
+	assert.Nil(t, found)
+
+	found = findOAuthToken(t, tokens, "refresh")
+	assert.Equal(t, refresh.ID, found.ID)
+	assert.Equal(t, domain.OAuthRefreshToken, found.Kind)
+	assert.Equal(t, "client", found.ClientID)
+	assert.Equal(t, 1, found.UserID)
+	assert.Equal(t, "profile", found.Scope)
+	assert.True(t, found.Active(now))
+	assert.Equal(t, 0, findOAuthToken(t, tokens, "service").UserID)
+
+	used, err := tokens.MarkUsed(ctx, refresh.ID, now)
+	require.NoError(t, err)
+	assert.True(t, used)
+	used, err = tokens.MarkUsed(ctx, refresh.ID, now)
+	require.NoError(t, err)
+	assert.False(t, used, "a refresh token is used once")
+
+	require.NoError(t, tokens.Revoke(ctx, access.ID, now))
+	assert.False(t, findOAuthToken(t, tokens, "access").Active(now))
+	assert.True(t, findOAuthToken(t, tokens, "refresh").Active(now))
+
+	require.NoError(t, tokens.RevokeFamily(ctx, "family", now))
+	assert.False(t, findOAuthToken(t, tokens, "refresh").Active(now))
+	assert.True(t, findOAuthToken(t, tokens, "other").Active(now), "other families are kept")
+
+	require.NoError(t, tokens.RevokeByClientID(ctx, "client", now))
+	assert.False(t, findOAuthToken(t, tokens, "other").Active(now))
+	assert.True(t, findOAuthToken(t, tokens, "service").Active(now), "tokens of other clients are kept")
+}
+
+func testOAuthConsents(t *testing.T, storages OAuthStorages) {
+	ctx := context.Background()
+	consents := storages.Consents
+	now := time.Now().UTC().Truncate(time.Second)
+
+	found, err := consents.Find(ctx, 1, "client")
+	require.NoError(t, err)
+	assert.Nil(t, found)
+
+	require.NoError(t, consents.Save(ctx, &domain.OAuthConsent{UserID: 1, ClientID: "client", Scope: "profile", GrantedAt: now}))
+	require.NoError(t, consents.Save(ctx, &domain.OAuthConsent{UserID: 2, ClientID: "client", Scope: "email", GrantedAt: now}))
+
+	found, err = consents.Find(ctx, 1, "client")
+	require.NoError(t, err)
+	require.NotNil(t, found)
+	assert.Equal(t, "profile", found.Scope)
+
+	// saving again replaces the scope
+	later := now.Add(time.Hour)
+	require.NoError(t, consents.Save(ctx, &domain.OAuthConsent{UserID: 1, ClientID: "client", Scope: "profile email", GrantedAt: later}))
+	found, err = consents.Find(ctx, 1, "client")
+	require.NoError(t, err)
+	require.NotNil(t, found)
+	assert.Equal(t, "profile email", found.Scope)
+	assert.WithinDuration(t, later, found.GrantedAt, time.Second)
+
+	found, err = consents.Find(ctx, 2, "client")
+	require.NoError(t, err)
+	require.NotNil(t, found)
+	assert.Equal(t, "email", found.Scope)
+
+	found, err = consents.Find(ctx, 1, "other")
+	require.NoError(t, err)
+	assert.Nil(t, found)
+}
@@ -0,0 +1,206 @@
+package storagetest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+)
+
+// OrganizationStorages are the storages of the organizations
+type OrganizationStorages struct {
+	Organizations domain.OrganizationStorage
+	Invitations   domain.OrgInvitationStorage
+}
+
+// RunOrganizationStorage checks the domain.OrganizationStorage and domain.OrgInvitationStorage
+// contracts. newStorages is called once per subtest and must return empty storages.
+func RunOrganizationStorage(t *testing.T, newStorages func(t *testing.T) OrganizationStorages) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, s OrganizationStorages)
+	}{
+		{"InsertAndFind", testOrganizationInsertAndFind},
+		{"Memberships", testOrganizationMemberships},
+		{"TransferOwnership", testOrganizationTransferOwnership},
+		{"Invitations", testOrgInvitations},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newStorages(t))
+		})
+	}
+}
+
+var orgCreated = time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+
+// newTestOrganization inserts an organization owned by the user
+func newTestOrganization(t *testing.T, s OrganizationStorages, name string, ownerID int) *domain.Organization {
+	organization := &domain.Organization{Name: name, CreatedAt: orgCreated}
+	owner := &domain.OrgMembership{UserID: ownerID, Role: domain.OrgRoleOwner, CreatedAt: orgCreated}
+	require.NoError(t, s.Organizations.Insert(context.Background(), organization, owner))
+	return organization
+}
+
+func testOrganizationInsertAndFind(t *testing.T, s OrganizationStorages) {
+	ctx := context.Background()
+
+	organization := newTestOrganization(t, s, "Acme", 1)
+	assert.NotZero(t, organization.ID)
+
+	found, err := s.Organizations.FindByID(ctx, organization.ID)
+	require.NoError(t, err)
+	require.NotNil(t, found)
+	assert.Equal(t, "Acme", found.Name)
+	assert.True(t, orgCreated.Equal(found.CreatedAt))
+
+	owner, err := s.Organizations.FindMembership(ctx, organization.ID, 1)
+	require.NoError(t, err)
+	require.NotNil(t, owner, "the owner membership is created with the organization")
+	assert.Equal(t, domain.OrgRoleOwner, owner.Role)
+
+	found, err = s.Organizations.FindByID(ctx, organization.ID+100)
+	require.NoError(t, err)
+	assert.Nil(t, found, "missing organizations are nil without error")
+
+	owner, err = s.Organizations.FindMembership(ctx, organization.ID, 2)
+	require.NoError(t, err)
+	assert.Nil(t, owner, "missing memberships are nil without error")
+}
+
+func testOrganizationMemberships(t *testing.T, s OrganizationStorages) {
+	ctx := context.Background()
+
+	acme := newTestOrganization(t, s, "Acme", 1)
+	globex := newTestOrganization(t, s, "Globex", 2)
+
+	require.NoError(t, s.Organizations.InsertMembership(ctx, &domain.OrgMembership{
+		OrganizationID: acme.ID, UserID: 2, Role: domain.OrgRoleMember, CreatedAt: orgCreated.Add(time.Hour),
+	}))
+	require.NoError(t, s.Organizations.InsertMembership(ctx, &domain.OrgMembership{
+		OrganizationID: acme.ID, UserID: 3, Role: domain.OrgRoleAdmin, CreatedAt: orgCreated.Add(time.Minute),
+	}))
+
+	members, err := s.Organizations.FindMembers(ctx, acme.ID)
+	require.NoError(t, err)
+	require.Len(t, members, 3)
+	assert.Equal(t, []int{1, 3, 2}, []int{members[0].UserID, members[1].UserID, members[2].UserID}, "members are ordered by join date")
+	assert.Equal(t, domain.OrgRoleAdmin, members[1].Role)
+
+	memberships, err := s.Organizations.FindMemberships(ctx, 2)
+	require.NoError(t, err)
+	require.Len(t, memberships, 2)
+	assert.Equal(t, globex.ID, memberships[0].OrganizationID)
+	assert.Equal(t, acme.ID, memberships[1].OrganizationID)
+
+	deleted, err := s.Organizations.DeleteMembership(ctx, acme.ID, 2)
+	require.NoError(t, err)
+	assert.True(t, deleted)
+
+	deleted, err = s.Organizations.DeleteMembership(ctx, acme.ID, 2)
+	require.NoError(t, err)
+	assert.False(t, deleted, "deleting again does nothing")
+
+	memberships, err = s.Organizations.FindMemberships(ctx, 2)
+	require.NoError(t, err)
+	require.Len(t, memberships, 1)
+	assert.Equal(t, globex.ID, memberships[0].OrganizationID)
+}
+
+func testOrganizationTransferOwnership(t *testing.T, s OrganizationStorages) {
+	ctx := context.Background()
+
+	acme := newTestOrganization(t, s, "Acme", 1)
+	require.NoError(t, s.Organizations.InsertMembership(ctx, &domain.OrgMembership{
+		OrganizationID: acme.ID, UserID: 2, Role: domain.OrgRoleMember, CreatedAt: orgCreated,
+	}))
+	other := newTestOrganization(t, s, "Globex", 1)
+
+	require.NoError(t, s.Organizations.TransferOwnership(ctx, acme.ID, 1, 2))
+
+	previous, err := s.Organizations.FindMembership(ctx, acme.ID, 1)
+	require.NoError(t, err)
+	assert.Equal(t, domain.OrgRoleAdmin, previous.Role)
+
+	owner, err := s.Organizations.FindMembership(ctx, acme.ID, 2)
+	require.NoError(t, err)
+	assert.Equal(t, domain.OrgRoleOwner, owner.Role)
+
+	unchanged, err := s.Organizations.FindMembership(ctx, other.ID, 1)
+	require.NoError(t, err)
+	assert.Equal(t, domain.OrgRoleOwner, unchanged.Role, "the other organizations are unchanged")
+}
+
+func testOrgInvitations(t *testing.T, s OrganizationStorages) {
+	ctx := context.Background()
+	now := orgCreated.Add(time.Hour)
+
+	newInvitation := func(organizationID int, email string, expiresAt time.Time) *domain.OrgInvitation {
+		invitation := &domain.OrgInvitation{
+			OrganizationID: organizationID,
+			Email:          email,
+			Role:           domain.OrgRoleMember,
+			InvitedBy:      1,
+			CreatedAt:      orgCreated,
+			ExpiresAt:      expiresAt,
+		}
+		require.NoError(t, s.Invitations.Insert(ctx, invitation))
+		return invitation
+	}
+
+	pending := newInvitation(1, "pending@example.com", now.Add(time.Hour))
+	accepted := newInvitation(1, "accepted@example.com", now.Add(time.Hour))
+	revoked := newInvitation(1, "revoked@example.com", now.Add(time.Hour))
+	newInvitation(1, "expired@example.com", now)
+	newInvitation(2, "other@example.com", now.Add(time.Hour))
+	assert.NotZero(t, pending.ID)
+
+	found, err := s.Invitations.FindByID(ctx, pending.ID)
+	require.NoError(t, err)
+	require.NotNil(t, found)
+	assert.Equal(t, "pending@example.com", found.Email)
+	assert.Equal(t, domain.OrgRoleMember, found.Role)
+	assert.Equal(t, 1, found.InvitedBy)
+	assert.True(t, now.Add(time.Hour).Equal(found.ExpiresAt))
+	assert.Nil(t, found.AcceptedAt)
+
+	ok, err := s.Invitations.Accept(ctx, accepted.ID, now)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = s.Invitations.Accept(ctx, accepted.ID, now)
+	require.NoError(t, err)
+	assert.False(t, ok, "invitations are accepted once")
+
+	ok, err = s.Invitations.Revoke(ctx, 2, revoked.ID, now)
+	require.NoError(t, err)
+	assert.False(t, ok, "only the organization of the invitation revokes it")
+
+	ok, err = s.Invitations.Revoke(ctx, 1, revoked.ID, now)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = s.Invitations.Accept(ctx, revoked.ID, now)
+	require.NoError(t, err)
+	assert.False(t, ok, "revoked invitations cannot be accepted")
+
+	found, err = s.Invitations.FindByID(ctx, accepted.ID)
+	require.NoError(t, err)
+	require.NotNil(t, found.AcceptedAt)
+	assert.True(t, now.Equal(*found.AcceptedAt))
+
+	list, err := s.Invitations.FindPending(ctx, 1, now)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, pending.ID, list[0].ID)
+
+	found, err = s.Invitations.FindByID(ctx, pending.ID+100)
+	require.NoError(t, err)
+	assert.Nil(t, found, "missing invitations are nil without error")
+}
@@ -0,0 +1,92 @@
+package storagetest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+)
+
+// RunRoleStorage checks the domain.RoleStorage contract. newStorage is called once per subtest and
+// must return a storage with the seeded roles and no assignments.
+func RunRoleStorage(t *testing.T, newStorage func(t *testing.T) domain.RoleStorage) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, roles domain.RoleStorage)
+	}{
+		{"SeededAdmin", testRoleSeededAdmin},
+		{"FindByName", testRoleFindByName},
+		{"AddAndRemoveUser", testRoleAddAndRemoveUser},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newStorage(t))
+		})
+	}
+}
+
+func testRoleSeededAdmin(t *testing.T, roles domain.RoleStorage) {
+	list, err := roles.List(context.Background())
+	require.NoError(t, err)
+
+	var admin *domain.Role
+	for _, role := range list {
+		if role.Name == domain.RoleAdmin {
+			admin = role
+		}
+	}
+
+	require.NotNil(t, admin, "the admin role is seeded")
+	assert.ElementsMatch(t, domain.Permissions, admin.Permissions)
+}
+
+func testRoleFindByName(t *testing.T, roles domain.RoleStorage) {
+	ctx := context.Background()
+
+	role, err := roles.FindByName(ctx, domain.RoleAdmin)
+	require.NoError(t, err)
+	require.NotNil(t, role)
+	assert.NotZero(t, role.ID)
+	assert.True(t, role.HasPermission(domain.PermissionUsersRead))
+
+	role, err = roles.FindByName(ctx, "missing")
+	require.NoError(t, err)
+	assert.Nil(t, role, "missing roles are nil without error")
+}
+
+func testRoleAddAndRemoveUser(t *testing.T, roles domain.RoleStorage) {
+	ctx := context.Background()
+
+	admin, err := roles.FindByName(ctx, domain.RoleAdmin)
+	require.NoError(t, err)
+	require.NotNil(t, admin)
+
+	found, err := roles.FindByUserID(ctx, 1)
+	require.NoError(t, err)
+	assert.Empty(t, found)
+
+	require.NoError(t, roles.AddUser(ctx, admin.ID, 1))
+	require.NoError(t, roles.AddUser(ctx, admin.ID, 1), "adding the role again does nothing")
+
+	found, err = roles.FindByUserID(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, found, 1)
+	assert.Equal(t, admin.Name, found[0].Name)
+	assert.ElementsMatch(t, admin.Permissions, found[0].Permissions)
+
+	found, err = roles.FindByUserID(ctx, 2)
+	require.NoError(t, err)
+	assert.Empty(t, found, "roles are per user")
+
+	require.NoError(t, roles.RemoveUser(ctx, admin.ID, 1))
+	require.NoError(t, roles.RemoveUser(ctx, admin.ID, 1))
+
+	found, err = roles.FindByUserID(ctx, 1)
+	require.NoError(t, err)
+	assert.Empty(t, found)
+}
@@ -0,0 +1,292 @@
+package storagetest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/internal/infrastructure/storage/sqlstore"
+	"gitlab.com/evzpav/user-auth/pkg/log"
+	"gitlab.com/evzpav/user-auth/pkg/migrate"
+)
+
+var testLog = log.NewZeroLog("", "", log.Error)
+
+// SQLDriver is a database of a driver package to run the sqlstore storages on
+type SQLDriver struct {
+	// Name is the name of the driver in the migrations table
+	Name       string
+	DB         *gorm.DB
+	Dialect    sqlstore.Dialect
+	Migrations []migrate.Migration
+}
+
+// RunSQLStorages migrates the database of the driver and checks every sqlstore storage on it. The
+// rows of the tables are deleted before each suite, the database must be disposable.
+func RunSQLStorages(t *testing.T, driver SQLDriver) {
+	db := driver.DB
+	dialect := driver.Dialect
+	db.LogMode(false)
+
+	migrator, err := migrate.New(db.DB(), driver.Name, driver.Migrations)
+	require.NoError(t, err)
+	_, err = migrator.Up(context.Background())
+	require.NoError(t, err)
+
+	empty := func(t *testing.T, tables ...string) {
+		for _, table := range tables {
+			require.NoError(t, db.Exec("DELETE FROM "+table).Error)
+		}
+	}
+
+	t.Run("UserStorage", func(t *testing.T) {
+		RunUserStorage(t, func(t *testing.T) domain.UserStorage {
+			empty(t, "users")
+
+			users, err := sqlstore.NewUserStorage(db, dialect, testLog)
+			require.NoError(t, err)
+
+			return users
+		})
+	})
+
+	t.Run("UserIdentityStorage", func(t *testing.T) {
+		RunUserIdentityStorage(t, func(t *testing.T) domain.UserIdentityStorage {
+			empty(t, "user_identities")
+
+			identities, err := sqlstore.NewUserIdentityStorage(db, dialect, testLog)
+			require.NoError(t, err)
+
+			return identities
+		})
+	})
+
+	t.Run("RoleStorage", func(t *testing.T) {
+		RunRoleStorage(t, func(t *testing.T) domain.RoleStorage {
+			empty(t, "user_roles")
+
+			roles, err := sqlstore.NewRoleStorage(db, dialect, testLog)
+			require.NoError(t, err)
+
+			return roles
+		})
+	})
+
+	t.Run("UserFilter", func(t *testing.T) {
+		RunUserFilter(t, func(t *testing.T) UserFilterStorages {
+			empty(t, "user_identities", "users")
+
+			users, err := sqlstore.NewUserStorage(db, dialect, testLog)
+			require.NoError(t, err)
+			identities, err := sqlstore.NewUserIdentityStorage(db, dialect, testLog)
+			require.NoError(t, err)
+
+			return UserFilterStorages{Users: users, Identities: identities}
+		})
+	})
+
+	t.Run("AdminAPIKeyStorage", func(t *testing.T) {
+		RunAdminAPIKeyStorage(t, func(t *testing.T) domain.AdminAPIKeyStorage {
+			empty(t, "admin_api_keys")
+
+			keys, err := sqlstore.NewAdminAPIKeyStorage(db, testLog)
+			require.NoError(t, err)
+
+			return keys
+		})
+	})
+
+	t.Run("APIKeyStorage", func(t *testing.T) {
+		RunAPIKeyStorage(t, func(t *testing.T) domain.APIKeyStorage {
+			empty(t, "api_keys")
+
+			keys, err := sqlstore.NewAPIKeyStorage(db, testLog)
+			require.NoError(t, err)
+
+			return keys
+		})
+	})
+
+	t.Run("OrganizationStorage", func(t *testing.T) {
+		RunOrganizationStorage(t, func(t *testing.T) OrganizationStorages {
+			empty(t, "organizations", "organization_members", "organization_invitations")
+
+			organizations, err := sqlstore.NewOrganizationStorage(db, testLog)
+			require.NoError(t, err)
+			invitations, err := sqlstore.NewOrgInvitationStorage(db, testLog)
+			require.NoError(t, err)
+
+			return OrganizationStorages{Organizations: organizations, Invitations: invitations}
+		})
+	})
+
+	t.Run("AuditStorage", func(t *testing.T) {
+		RunAuditStorage(t, func(t *testing.T) domain.AuditStorage {
+			empty(t, "audit_events")
+
+			events, err := sqlstore.NewAuditStorage(db, testLog)
+			require.NoError(t, err)
+
+			return events
+		})
+	})
+
+	t.Run("OAuthStorage", func(t *testing.T) {
+		RunOAuthStorage(t, func(t *testing.T) OAuthStorages {
+			empty(t, "oauth_clients", "oauth_authorization_codes", "oauth_tokens", "oauth_consents")
+
+			clients, err := sqlstore.NewOAuthClientStorage(db, dialect, testLog)
+			require.NoError(t, err)
+			codes, err := sqlstore.NewOAuthAuthorizationCodeStorage(db, testLog)
+			require.NoError(t, err)
+			tokens, err := sqlstore.NewOAuthTokenStorage(db, testLog)
+			require.NoError(t, err)
+			consents, err := sqlstore.NewOAuthConsentStorage(db, dialect, testLog)
+			require.NoError(t, err)
+
+			return OAuthStorages{Clients: clients, Codes: codes, Tokens: tokens, Consents: consents}
+		})
+	})
+
+	t.Run("WebAuthnStorage", func(t *testing.T) {
+		RunWebAuthnStorage(t, func(t *testing.T) WebAuthnStorages {
+			empty(t, "web_authn_credentials", "web_authn_challenges")
+
+			credentials, err := sqlstore.NewWebAuthnCredentialStorage(db, testLog)
+			require.NoError(t, err)
+			challenges, err := sqlstore.NewWebAuthnChallengeStorage(db, testLog)
+			require.NoError(t, err)
+
+			return WebAuthnStorages{Credentials: credentials, Challenges: challenges}
+		})
+	})
+
+	t.Run("ThrottleStore", func(t *testing.T) {
+		empty(t, "throttle_entries")
+		testSQLThrottleStore(t, db, dialect)
+	})
+
+	t.Run("JobStorage", func(t *testing.T) {
+		empty(t, "jobs")
+		testSQLJobStorage(t, db, dialect)
+	})
+
+	t.Run("PasswordResetTokenStorage", func(t *testing.T) {
+		empty(t, "password_reset_tokens")
+		testSQLPasswordResetTokenStorage(t, db)
+	})
+}
+
+func testSQLThrottleStore(t *testing.T, db *gorm.DB, dialect sqlstore.Dialect) {
+	store, err := sqlstore.NewThrottleStore(db, dialect, testLog)
+	require.NoError(t, err)
+	ctx := context.Background()
+	now := time.Now()
+
+	entry, err := store.Increment(ctx, "login:user", now, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, 1, entry.Attempts)
+
+	entry, err = store.Increment(ctx, "login:user", now.Add(time.Second), time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, 2, entry.Attempts)
+
+	require.NoError(t, store.Lock(ctx, "login:user", now.Add(time.Hour), now.Add(time.Hour)))
+	entry, err = store.Get(ctx, "login:user")
+	require.NoError(t, err)
+	require.NotNil(t, entry.LockedUntil)
+	assert.True(t, now.Add(time.Hour).Equal(entry.ExpiresAt))
+
+	// a shorter lock keeps the latest expiration
+	require.NoError(t, store.Lock(ctx, "login:user", now.Add(time.Minute), now.Add(time.Minute)))
+	entry, err = store.Get(ctx, "login:user")
+	require.NoError(t, err)
+	assert.True(t, now.Add(time.Hour).Equal(entry.ExpiresAt))
+
+	// attempts after the expiration start over
+	entry, err = store.Increment(ctx, "login:user", now.Add(2*time.Hour), time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, 1, entry.Attempts)
+	assert.Nil(t, entry.LockedUntil)
+
+	require.NoError(t, store.Delete(ctx, "login:user"))
+	entry, err = store.Get(ctx, "login:user")
+	require.NoError(t, err)
+	assert.Nil(t, entry)
+}
+
+func testSQLJobStorage(t *testing.T, db *gorm.DB, dialect sqlstore.Dialect) {
+	jobs, err := sqlstore.NewJobStorage(db, dialect, testLog)
+	require.NoError(t, err)
+	ctx := context.Background()
+	now := time.Now()
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, jobs.Insert(ctx, &domain.Job{
+			Kind:        domain.JobSendEmail,
+			Payload:     "{}",
+			Status:      domain.JobPending,
+			MaxAttempts: 3,
+			NextRunAt:   now.Add(time.Duration(i) * time.Minute),
+			CreatedAt:   now,
+			UpdatedAt:   now,
+		}))
+	}
+
+	claimed, err := jobs.Claim(ctx, now, time.Minute, 5)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	assert.Equal(t, domain.JobRunning, claimed[0].Status)
+	assert.Equal(t, 1, claimed[0].Attempts)
+	assert.NotEmpty(t, claimed[0].ClaimToken)
+
+	// running jobs are claimed again once the lease ends
+	claimed, err = jobs.Claim(ctx, now.Add(2*time.Minute), time.Minute, 5)
+	require.NoError(t, err)
+	assert.Len(t, claimed, 3)
+
+	job := claimed[0]
+	finishedAt := now.Add(3 * time.Minute)
+	job.Status = domain.JobDone
+	job.Payload = ""
+	job.FinishedAt = &finishedAt
+	require.NoError(t, jobs.Release(ctx, job))
+
+	var released domain.Job
+	require.NoError(t, db.First(&released, job.ID).Error)
+	assert.Equal(t, domain.JobDone, released.Status)
+	assert.Empty(t, released.Payload)
+	require.NoError(t, jobs.DeleteFinished(ctx, finishedAt))
+
+	claimed, err = jobs.Claim(ctx, now.Add(time.Hour), time.Minute, 5)
+	require.NoError(t, err)
+	assert.Len(t, claimed, 2)
+}
+
+func testSQLPasswordResetTokenStorage(t *testing.T, db *gorm.DB) {
+	tokens, err := sqlstore.NewPasswordResetTokenStorage(db, testLog)
+	require.NoError(t, err)
+	ctx := context.Background()
+	now := time.Now()
+
+	token := &domain.PasswordResetToken{UserID: 1, TokenHash: "hash", CreatedAt: now, ExpiresAt: now.Add(time.Hour)}
+	require.NoError(t, tokens.Insert(ctx, token))
+
+	used, err := tokens.MarkUsed(ctx, token.ID, now)
+	require.NoError(t, err)
+	assert.True(t, used)
+
+	used, err = tokens.MarkUsed(ctx, token.ID, now)
+	require.NoError(t, err)
+	assert.False(t, used)
+
+	require.NoError(t, tokens.DeleteByUserID(ctx, 1))
+	found, err := tokens.FindByHash(ctx, "hash")
+	require.NoError(t, err)
+	assert.Nil(t, found)
+}
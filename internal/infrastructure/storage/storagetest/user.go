@@ -0,0 +1,429 @@
+// Package storagetest holds conformance suites the storage implementations run in their own tests,
+// so every driver honors the same contract.
+package storagetest
+
+import (
+	"context"
+	stderrors "errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/internal/infrastructure/storage"
+	"gitlab.com/evzpav/user-auth/pkg/errors"
+)
+
+// concurrentInserts of the same email in the concurrency test
+const concurrentInserts = 8
+
+// RunUserStorage checks the domain.UserStorage contract. newStorage is called once per subtest and
+// must return a storage without users.
+func RunUserStorage(t *testing.T, newStorage func(t *testing.T) domain.UserStorage) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, users domain.UserStorage)
+	}{
+		{"Insert", testUserInsert},
+		{"InsertDuplicatedEmail", testUserInsertDuplicatedEmail},
+		{"InsertConcurrentDuplicates", testUserInsertConcurrentDuplicates},
+		{"FindByEmail", testUserFindByEmail},
+		{"FindByID", testUserFindByID},
+		{"Update", testUserUpdate},
+		{"UpdateDuplicatedEmail", testUserUpdateDuplicatedEmail},
+		{"ListQuery", testUserListQuery},
+		{"UseTOTPStep", testUserUseTOTPStep},
+		{"ReplaceRecoveryCodes", testUserReplaceRecoveryCodes},
+		{"CanceledContext", testUserCanceledContext},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newStorage(t))
+		})
+	}
+}
+
+func newUser(email string) *domain.User {
+	return &domain.User{
+		Name:     "User",
+		Address:  "Main Street, 1",
+		Email:    email,
+		Password: "$2a$10$hash",
+		Phone:    "+55 51 99999-0000",
+	}
+}
+
+func requireDuplicated(t *testing.T, err error) {
+	t.Helper()
+
+	describer, ok := errors.DuplicatedRecordCast(err)
+	require.True(t, ok, "expected a duplicated record error, got %v", err)
+	assert.Equal(t, storage.ErrUserDuplicated, describer.GetCode())
+}
+
+// assertSameUser compares the stored fields, timestamps are compared to the second since drivers
+// store them with different precision
+func assertSameUser(t *testing.T, expected, actual *domain.User) {
+	t.Helper()
+
+	require.NotNil(t, actual)
+	assert.Equal(t, expected.ID, actual.ID)
+	assert.Equal(t, expected.Name, actual.Name)
+	assert.Equal(t, expected.Address, actual.Address)
+	assert.Equal(t, expected.Email, actual.Email)
+	assert.Equal(t, expected.Password, actual.Password)
+	assert.Equal(t, expected.Phone, actual.Phone)
+	assert.Equal(t, expected.TOTPSecret, actual.TOTPSecret)
+	assert.Equal(t, expected.TOTPEnabled, actual.TOTPEnabled)
+	assert.Equal(t, expected.TOTPLastStep, actual.TOTPLastStep)
+	assert.Equal(t, expected.MFARecoveryCodes, actual.MFARecoveryCodes)
+
+	if expected.EmailVerifiedAt == nil {
+		assert.Nil(t, actual.EmailVerifiedAt)
+	} else if assert.NotNil(t, actual.EmailVerifiedAt) {
+		assert.WithinDuration(t, *expected.EmailVerifiedAt, *actual.EmailVerifiedAt, time.Second)
+	}
+
+	if expected.DisabledAt == nil {
+		assert.Nil(t, actual.DisabledAt)
+	} else if assert.NotNil(t, actual.DisabledAt) {
+		assert.WithinDuration(t, *expected.DisabledAt, *actual.DisabledAt, time.Second)
+	}
+
+	if expected.DeletedAt == nil {
+		assert.Nil(t, actual.DeletedAt)
+	} else if assert.NotNil(t, actual.DeletedAt) {
+		assert.WithinDuration(t, *expected.DeletedAt, *actual.DeletedAt, time.Second)
+	}
+
+	assert.WithinDuration(t, expected.CreatedAt, actual.CreatedAt, time.Second)
+}
+
+func testUserInsert(t *testing.T, users domain.UserStorage) {
+	ctx := context.Background()
+	verifiedAt := time.Now().UTC().Truncate(time.Second)
+
+	user := newUser("user@example.com")
+	user.EmailVerifiedAt = &verifiedAt
+	user.TOTPSecret = "JBSWY3DPEHPK3PXP"
+	user.TOTPEnabled = true
+	user.TOTPLastStep = 52707160
+	user.MFARecoveryCodes = "code1,code2"
+
+	require.NoError(t, users.Insert(ctx, user))
+	assert.NotZero(t, user.ID)
+	assert.False(t, user.CreatedAt.IsZero(), "created_at is set on insert")
+
+	// users signed up with a login provider have no password
+	other := newUser("other@example.com")
+	other.Password = ""
+	require.NoError(t, users.Insert(ctx, other))
+	assert.NotEqual(t, user.ID, other.ID)
+
+	found, err := users.FindByID(ctx, user.ID)
+	require.NoError(t, err)
+	assertSameUser(t, user, found)
+
+	found, err = users.FindByID(ctx, other.ID)
+	require.NoError(t, err)
+	assertSameUser(t, other, found)
+}
+
+func testUserInsertDuplicatedEmail(t *testing.T, users domain.UserStorage) {
+	ctx := context.Background()
+	require.NoError(t, users.Insert(ctx, newUser("User@Example.com")))
+
+	requireDuplicated(t, users.Insert(ctx, newUser("User@Example.com")))
+	requireDuplicated(t, users.Insert(ctx, newUser("user@example.com")))
+	requireDuplicated(t, users.Insert(ctx, newUser("USER@EXAMPLE.COM")))
+}
+
+func testUserInsertConcurrentDuplicates(t *testing.T, users domain.UserStorage) {
+	ctx := context.Background()
+	errs := make([]error, concurrentInserts)
+
+	var wg sync.WaitGroup
+	for i := 0; i < concurrentInserts; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			// every goroutine uses a different case so a case sensitive check would let several in
+			email := "race@example.com"
+			if i%2 == 1 {
+				email = strings.ToUpper(email)
+			}
+			if i%3 == 1 {
+				email = strings.Title(email)
+			}
+
+			errs[i] = users.Insert(ctx, newUser(email))
+		}(i)
+	}
+	wg.Wait()
+
+	inserted := 0
+	for _, err := range errs {
+		if err == nil {
+			inserted++
+			continue
+		}
+
+		requireDuplicated(t, err)
+	}
+	assert.Equal(t, 1, inserted, "exactly one insert must succeed")
+
+	found, err := users.FindByEmail(ctx, "race@example.com")
+	require.NoError(t, err)
+	assert.NotNil(t, found)
+}
+
+func testUserFindByEmail(t *testing.T, users domain.UserStorage) {
+	ctx := context.Background()
+
+	found, err := users.FindByEmail(ctx, "user@example.com")
+	require.NoError(t, err)
+	assert.Nil(t, found, "missing users are nil without error")
+
+	user := newUser("User@Example.com")
+	require.NoError(t, users.Insert(ctx, user))
+	require.NoError(t, users.Insert(ctx, newUser("other@example.com")))
+
+	for _, email := range []string{"User@Example.com", "user@example.com", "USER@EXAMPLE.COM"} {
+		found, err := users.FindByEmail(ctx, email)
+		require.NoError(t, err)
+		assertSameUser(t, user, found)
+	}
+}
+
+func testUserFindByID(t *testing.T, users domain.UserStorage) {
+	ctx := context.Background()
+
+	found, err := users.FindByID(ctx, 1)
+	require.NoError(t, err)
+	assert.Nil(t, found, "missing users are nil without error")
+
+	user := newUser("user@example.com")
+	require.NoError(t, users.Insert(ctx, user))
+
+	found, err = users.FindByID(ctx, user.ID)
+	require.NoError(t, err)
+	assertSameUser(t, user, found)
+
+	found, err = users.FindByID(ctx, user.ID+1)
+	require.NoError(t, err)
+	assert.Nil(t, found)
+}
+
+func testUserUpdate(t *testing.T, users domain.UserStorage) {
+	ctx := context.Background()
+
+	user := newUser("user@example.com")
+	require.NoError(t, users.Insert(ctx, user))
+	other := newUser("other@example.com")
+	require.NoError(t, users.Insert(ctx, other))
+
+	found, err := users.FindByID(ctx, user.ID)
+	require.NoError(t, err)
+	require.NotNil(t, found)
+
+	verifiedAt := time.Now().UTC().Truncate(time.Second)
+	found.Name = "Renamed"
+	found.Email = "renamed@example.com"
+	found.Password = "$2a$10$other"
+	found.EmailVerifiedAt = &verifiedAt
+	found.TOTPEnabled = true
+	found.TOTPLastStep = 7
+	found.DisabledAt = &verifiedAt
+	found.DeletedAt = &verifiedAt
+	require.NoError(t, users.Update(ctx, found))
+
+	updated, err := users.FindByID(ctx, user.ID)
+	require.NoError(t, err)
+	assertSameUser(t, found, updated)
+
+	old, err := users.FindByEmail(ctx, "user@example.com")
+	require.NoError(t, err)
+	assert.Nil(t, old, "the previous email is released")
+
+	untouched, err := users.FindByID(ctx, other.ID)
+	require.NoError(t, err)
+	assertSameUser(t, other, untouched)
+
+	// the released email can be taken again
+	require.NoError(t, users.Insert(ctx, newUser("user@example.com")))
+}
+
+func testUserUpdateDuplicatedEmail(t *testing.T, users domain.UserStorage) {
+	ctx := context.Background()
+
+	user := newUser("user@example.com")
+	require.NoError(t, users.Insert(ctx, user))
+	require.NoError(t, users.Insert(ctx, newUser("other@example.com")))
+
+	user.Email = "Other@Example.com"
+	requireDuplicated(t, users.Update(ctx, user))
+
+	found, err := users.FindByID(ctx, user.ID)
+	require.NoError(t, err)
+	require.NotNil(t, found)
+	assert.Equal(t, "user@example.com", found.Email)
+
+	// changing only the case of its own email is not a duplicate
+	found.Email = "USER@example.com"
+	require.NoError(t, users.Update(ctx, found))
+}
+
+func testUserListQuery(t *testing.T, users domain.UserStorage) {
+	ctx := context.Background()
+
+	alice := newUser("alice@example.com")
+	alice.Name = "Alice Smith"
+	bob := newUser("bob@example.org")
+	bob.Name = "Bob Jones"
+	carol := newUser("carol_smith@example.com")
+	carol.Name = "Carol"
+	for _, user := range []*domain.User{alice, bob, carol} {
+		require.NoError(t, users.Insert(ctx, user))
+	}
+
+	emails := func(found []*domain.User) []string {
+		var emails []string
+		for _, user := range found {
+			emails = append(emails, user.Email)
+		}
+		return emails
+	}
+
+	found, err := users.List(ctx, &domain.UserFilter{Limit: 10})
+	require.NoError(t, err)
+	assert.Equal(t, []string{alice.Email, bob.Email, carol.Email}, emails(found), "an empty query lists every user by ID")
+	assertSameUser(t, alice, found[0])
+
+	found, err = users.List(ctx, &domain.UserFilter{Query: "SMITH", Limit: 10})
+	require.NoError(t, err)
+	assert.Equal(t, []string{alice.Email, carol.Email}, emails(found), "the name and the email match case insensitively")
+
+	found, err = users.List(ctx, &domain.UserFilter{Query: "example.org", Limit: 10})
+	require.NoError(t, err)
+	assert.Equal(t, []string{bob.Email}, emails(found))
+
+	found, err = users.List(ctx, &domain.UserFilter{Query: "l_s", Limit: 10})
+	require.NoError(t, err)
+	assert.Equal(t, []string{carol.Email}, emails(found), "wildcards of LIKE match literally")
+
+	found, err = users.List(ctx, &domain.UserFilter{Query: "%", Limit: 10})
+	require.NoError(t, err)
+	assert.Empty(t, found)
+
+	found, err = users.List(ctx, &domain.UserFilter{Query: "example", Limit: 2})
+	require.NoError(t, err)
+	assert.Equal(t, []string{alice.Email, bob.Email}, emails(found))
+
+	found, err = users.List(ctx, &domain.UserFilter{Query: "example", Limit: 2, Offset: 1})
+	require.NoError(t, err)
+	assert.Equal(t, []string{bob.Email, carol.Email}, emails(found))
+
+	count, err := users.Count(ctx, &domain.UserFilter{Query: "smith", Limit: 1})
+	require.NoError(t, err)
+	assert.Equal(t, 2, count, "the count ignores the paging")
+}
+
+func testUserUseTOTPStep(t *testing.T, users domain.UserStorage) {
+	ctx := context.Background()
+
+	user := newUser("user@example.com")
+	user.TOTPLastStep = 10
+	require.NoError(t, users.Insert(ctx, user))
+
+	used, err := users.UseTOTPStep(ctx, user.ID, 10)
+	require.NoError(t, err)
+	assert.False(t, used, "the recorded step was already used")
+
+	used, err = users.UseTOTPStep(ctx, user.ID, 11)
+	require.NoError(t, err)
+	assert.True(t, used)
+
+	used, err = users.UseTOTPStep(ctx, user.ID, 11)
+	require.NoError(t, err)
+	assert.False(t, used, "a step is used once")
+
+	found, err := users.FindByID(ctx, user.ID)
+	require.NoError(t, err)
+	require.NotNil(t, found)
+	assert.Equal(t, int64(11), found.TOTPLastStep)
+
+	used, err = users.UseTOTPStep(ctx, user.ID+1, 12)
+	require.NoError(t, err)
+	assert.False(t, used, "a missing user uses nothing")
+}
+
+func testUserReplaceRecoveryCodes(t *testing.T, users domain.UserStorage) {
+	ctx := context.Background()
+
+	user := newUser("user@example.com")
+	user.MFARecoveryCodes = `["a","b"]`
+	require.NoError(t, users.Insert(ctx, user))
+
+	replaced, err := users.ReplaceRecoveryCodes(ctx, user.ID, `["a","b"]`, `["b"]`)
+	require.NoError(t, err)
+	assert.True(t, replaced)
+
+	// a request that read the codes before the replacement
+	replaced, err = users.ReplaceRecoveryCodes(ctx, user.ID, `["a","b"]`, `["b"]`)
+	require.NoError(t, err)
+	assert.False(t, replaced)
+
+	found, err := users.FindByID(ctx, user.ID)
+	require.NoError(t, err)
+	require.NotNil(t, found)
+	assert.Equal(t, `["b"]`, found.MFARecoveryCodes)
+}
+
+func testUserCanceledContext(t *testing.T, users domain.UserStorage) {
+	user := newUser("user@example.com")
+	require.NoError(t, users.Insert(context.Background(), user))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	calls := map[string]func() error{
+		"Insert": func() error { return users.Insert(ctx, newUser("canceled@example.com")) },
+		"FindByEmail": func() error {
+			_, err := users.FindByEmail(ctx, user.Email)
+			return err
+		},
+		"FindByID": func() error {
+			_, err := users.FindByID(ctx, user.ID)
+			return err
+		},
+		"List": func() error {
+			_, err := users.List(ctx, &domain.UserFilter{Limit: 10})
+			return err
+		},
+		"Update": func() error {
+			updated := *user
+			updated.Name = "Canceled"
+			return users.Update(ctx, &updated)
+		},
+	}
+
+	for name, call := range calls {
+		err := call()
+		assert.True(t, stderrors.Is(err, context.Canceled), "%s returned %v instead of context.Canceled", name, err)
+	}
+
+	found, err := users.FindByEmail(context.Background(), "canceled@example.com")
+	require.NoError(t, err)
+	assert.Nil(t, found, "a canceled insert stores nothing")
+
+	found, err = users.FindByID(context.Background(), user.ID)
+	require.NoError(t, err)
+	assertSameUser(t, user, found)
+}
@@ -0,0 +1,140 @@
+package storagetest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+)
+
+// UserFilterStorages are the storages the user filters read, the provider filter joins the
+// identities
+type UserFilterStorages struct {
+	Users      domain.UserStorage
+	Identities domain.UserIdentityStorage
+}
+
+// RunUserFilter checks the filters of domain.UserStorage List and Count. newStorages is called once
+// per subtest and must return storages without users nor identities.
+func RunUserFilter(t *testing.T, newStorages func(t *testing.T) UserFilterStorages) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, s UserFilterStorages)
+	}{
+		{"EmailPrefix", testUserFilterEmailPrefix},
+		{"Provider", testUserFilterProvider},
+		{"CreatedRange", testUserFilterCreatedRange},
+		{"DisabledAndDeleted", testUserFilterDisabledAndDeleted},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newStorages(t))
+		})
+	}
+}
+
+// listIDs lists the users of the filter and checks Count agrees
+func listIDs(t *testing.T, users domain.UserStorage, filter *domain.UserFilter) []int {
+	t.Helper()
+	ctx := context.Background()
+
+	found, err := users.List(ctx, filter)
+	require.NoError(t, err)
+
+	IDs := []int{}
+	for _, user := range found {
+		IDs = append(IDs, user.ID)
+	}
+
+	count, err := users.Count(ctx, filter)
+	require.NoError(t, err)
+	assert.Equal(t, len(IDs), count)
+
+	return IDs
+}
+
+func insertUsers(t *testing.T, users domain.UserStorage, emails ...string) []*domain.User {
+	t.Helper()
+
+	var inserted []*domain.User
+	for _, email := range emails {
+		user := newUser(email)
+		require.NoError(t, users.Insert(context.Background(), user))
+		inserted = append(inserted, user)
+	}
+
+	return inserted
+}
+
+func testUserFilterEmailPrefix(t *testing.T, s UserFilterStorages) {
+	inserted := insertUsers(t, s.Users, "Ann@example.com", "anna@example.com", "bob@ann.com", "an_y@example.com")
+
+	assert.Equal(t, []int{inserted[0].ID, inserted[1].ID, inserted[3].ID}, listIDs(t, s.Users, &domain.UserFilter{EmailPrefix: "AN"}))
+	assert.Equal(t, []int{inserted[0].ID, inserted[1].ID}, listIDs(t, s.Users, &domain.UserFilter{EmailPrefix: "ann"}))
+	assert.Equal(t, []int{inserted[3].ID}, listIDs(t, s.Users, &domain.UserFilter{EmailPrefix: "an_"}), "wildcards of LIKE match literally")
+}
+
+func testUserFilterProvider(t *testing.T, s UserFilterStorages) {
+	ctx := context.Background()
+	inserted := insertUsers(t, s.Users, "google@example.com", "both@example.com", "password@example.com")
+
+	link := func(user *domain.User, provider string) {
+		require.NoError(t, s.Identities.Insert(ctx, &domain.UserIdentity{
+			UserID:   user.ID,
+			Provider: provider,
+			Subject:  provider + "-" + user.Email,
+			Email:    user.Email,
+			LinkedAt: time.Now().UTC(),
+		}))
+	}
+	link(inserted[0], "google")
+	link(inserted[1], "google")
+	link(inserted[1], "github")
+
+	assert.Equal(t, []int{inserted[0].ID, inserted[1].ID}, listIDs(t, s.Users, &domain.UserFilter{Provider: "google"}))
+	assert.Equal(t, []int{inserted[1].ID}, listIDs(t, s.Users, &domain.UserFilter{Provider: "github"}))
+	assert.Empty(t, listIDs(t, s.Users, &domain.UserFilter{Provider: "keycloak"}))
+}
+
+func testUserFilterCreatedRange(t *testing.T, s UserFilterStorages) {
+	ctx := context.Background()
+	base := time.Now().UTC().Truncate(time.Second).Add(-72 * time.Hour)
+
+	var IDs []int
+	for i, email := range []string{"first@example.com", "second@example.com", "third@example.com"} {
+		user := newUser(email)
+		user.CreatedAt = base.Add(time.Duration(i) * 24 * time.Hour)
+		require.NoError(t, s.Users.Insert(ctx, user))
+		IDs = append(IDs, user.ID)
+	}
+
+	after := base.Add(24 * time.Hour)
+	before := base.Add(48 * time.Hour)
+	assert.Equal(t, IDs[1:], listIDs(t, s.Users, &domain.UserFilter{CreatedAfter: &after}), "the start is included")
+	assert.Equal(t, IDs[:2], listIDs(t, s.Users, &domain.UserFilter{CreatedBefore: &before}), "the end is excluded")
+	assert.Equal(t, IDs[1:2], listIDs(t, s.Users, &domain.UserFilter{CreatedAfter: &after, CreatedBefore: &before}))
+}
+
+func testUserFilterDisabledAndDeleted(t *testing.T, s UserFilterStorages) {
+	ctx := context.Background()
+	inserted := insertUsers(t, s.Users, "active@example.com", "disabled@example.com", "deleted@example.com")
+
+	now := time.Now().UTC()
+	inserted[1].DisabledAt = &now
+	require.NoError(t, s.Users.Update(ctx, inserted[1]))
+	inserted[2].DeletedAt = &now
+	require.NoError(t, s.Users.Update(ctx, inserted[2]))
+
+	yes, no := true, false
+	assert.Equal(t, []int{inserted[1].ID}, listIDs(t, s.Users, &domain.UserFilter{Disabled: &yes}))
+	assert.Equal(t, []int{inserted[0].ID, inserted[2].ID}, listIDs(t, s.Users, &domain.UserFilter{Disabled: &no}))
+	assert.Equal(t, []int{inserted[2].ID}, listIDs(t, s.Users, &domain.UserFilter{Deleted: &yes}))
+	assert.Equal(t, []int{inserted[0].ID}, listIDs(t, s.Users, &domain.UserFilter{Disabled: &no, Deleted: &no}))
+	assert.Len(t, listIDs(t, s.Users, &domain.UserFilter{}), 3)
+}
@@ -0,0 +1,131 @@
+package storagetest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+	"gitlab.com/evzpav/user-auth/internal/infrastructure/storage"
+	"gitlab.com/evzpav/user-auth/pkg/errors"
+)
+
+// RunUserIdentityStorage checks the domain.UserIdentityStorage contract. newStorage is called once
+// per subtest and must return a storage without identities.
+func RunUserIdentityStorage(t *testing.T, newStorage func(t *testing.T) domain.UserIdentityStorage) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, identities domain.UserIdentityStorage)
+	}{
+		{"InsertAndFind", testUserIdentityInsertAndFind},
+		{"InsertDuplicated", testUserIdentityInsertDuplicated},
+		{"Delete", testUserIdentityDelete},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newStorage(t))
+		})
+	}
+}
+
+func newIdentity(userID int, provider, subject string) *domain.UserIdentity {
+	return &domain.UserIdentity{
+		UserID:   userID,
+		Provider: provider,
+		Subject:  subject,
+		Email:    subject + "@example.com",
+		LinkedAt: time.Now().UTC().Truncate(time.Second),
+	}
+}
+
+func assertSameIdentity(t *testing.T, expected, actual *domain.UserIdentity) {
+	if !assert.NotNil(t, actual) {
+		return
+	}
+
+	assert.Equal(t, expected.ID, actual.ID)
+	assert.Equal(t, expected.UserID, actual.UserID)
+	assert.Equal(t, expected.Provider, actual.Provider)
+	assert.Equal(t, expected.Subject, actual.Subject)
+	assert.Equal(t, expected.Email, actual.Email)
+	assert.WithinDuration(t, expected.LinkedAt, actual.LinkedAt, time.Second)
+}
+
+func testUserIdentityInsertAndFind(t *testing.T, identities domain.UserIdentityStorage) {
+	ctx := context.Background()
+
+	found, err := identities.FindBySubject(ctx, "google", "sub-1")
+	require.NoError(t, err)
+	assert.Nil(t, found, "missing identities are nil without error")
+
+	google := newIdentity(1, "google", "sub-1")
+	require.NoError(t, identities.Insert(ctx, google))
+	assert.NotZero(t, google.ID)
+
+	// the same subject at another provider is another account
+	github := newIdentity(1, "github", "sub-1")
+	require.NoError(t, identities.Insert(ctx, github))
+	other := newIdentity(2, "google", "sub-2")
+	require.NoError(t, identities.Insert(ctx, other))
+
+	found, err = identities.FindBySubject(ctx, "google", "sub-1")
+	require.NoError(t, err)
+	assertSameIdentity(t, google, found)
+
+	found, err = identities.FindBySubject(ctx, "github", "sub-1")
+	require.NoError(t, err)
+	assertSameIdentity(t, github, found)
+
+	found, err = identities.FindBySubject(ctx, "google", "SUB-1")
+	require.NoError(t, err)
+	assert.Nil(t, found, "subjects are case sensitive")
+
+	byUser, err := identities.FindByUserID(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, byUser, 2)
+	assertSameIdentity(t, google, byUser[0])
+	assertSameIdentity(t, github, byUser[1])
+
+	byUser, err = identities.FindByUserID(ctx, 3)
+	require.NoError(t, err)
+	assert.Empty(t, byUser)
+}
+
+func testUserIdentityInsertDuplicated(t *testing.T, identities domain.UserIdentityStorage) {
+	ctx := context.Background()
+	require.NoError(t, identities.Insert(ctx, newIdentity(1, "google", "sub-1")))
+
+	err := identities.Insert(ctx, newIdentity(2, "google", "sub-1"))
+	describer, ok := errors.DuplicatedRecordCast(err)
+	require.True(t, ok, "expected duplicated record, got %v", err)
+	assert.Equal(t, storage.ErrIdentityDuplicated, describer.GetCode())
+
+	found, err := identities.FindBySubject(ctx, "google", "sub-1")
+	require.NoError(t, err)
+	require.NotNil(t, found)
+	assert.Equal(t, 1, found.UserID, "the account stays linked to the first user")
+}
+
+func testUserIdentityDelete(t *testing.T, identities domain.UserIdentityStorage) {
+	ctx := context.Background()
+	identity := newIdentity(1, "google", "sub-1")
+	require.NoError(t, identities.Insert(ctx, identity))
+
+	require.NoError(t, identities.Delete(ctx, 2, identity.ID))
+	found, err := identities.FindBySubject(ctx, "google", "sub-1")
+	require.NoError(t, err)
+	assert.NotNil(t, found, "identities of other users are not deleted")
+
+	require.NoError(t, identities.Delete(ctx, 1, identity.ID))
+	found, err = identities.FindBySubject(ctx, "google", "sub-1")
+	require.NoError(t, err)
+	assert.Nil(t, found)
+
+	// the account can be linked again
+	require.NoError(t, identities.Insert(ctx, newIdentity(2, "google", "sub-1")))
+}
@@ -0,0 +1,150 @@
+package storagetest
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+)
+
+// WebAuthnStorages are the storages of the passkey ceremonies
+type WebAuthnStorages struct {
+	Credentials domain.WebAuthnCredentialStorage
+	Challenges  domain.WebAuthnChallengeStorage
+}
+
+// RunWebAuthnStorage checks the contracts of the passkey storages. newStorages is called once per
+// subtest and must return empty storages.
+func RunWebAuthnStorage(t *testing.T, newStorages func(t *testing.T) WebAuthnStorages) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, storages WebAuthnStorages)
+	}{
+		{"UpdateSignCount", testWebAuthnUpdateSignCount},
+		{"TakeChallenge", testWebAuthnTakeChallenge},
+		{"TakeChallengeConcurrently", testWebAuthnTakeChallengeConcurrently},
+		{"DeleteExpiredChallenges", testWebAuthnDeleteExpiredChallenges},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newStorages(t))
+		})
+	}
+}
+
+func newWebAuthnChallenge(nonceHash string, expiresAt time.Time) *domain.WebAuthnChallenge {
+	return &domain.WebAuthnChallenge{
+		NonceHash: nonceHash,
+		Ceremony:  domain.WebAuthnLogin,
+		Challenge: "challenge-" + nonceHash,
+		CreatedAt: expiresAt.Add(-5 * time.Minute),
+		ExpiresAt: expiresAt,
+	}
+}
+
+func testWebAuthnUpdateSignCount(t *testing.T, storages WebAuthnStorages) {
+	ctx := context.Background()
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	credential := &domain.WebAuthnCredential{UserID: 1, Name: "Phone", CredentialID: "credential", PublicKey: []byte{1}, CreatedAt: now}
+	require.NoError(t, storages.Credentials.Insert(ctx, credential))
+
+	updated, err := storages.Credentials.UpdateSignCount(ctx, credential.ID, 0, now)
+	require.NoError(t, err)
+	assert.True(t, updated, "authenticators without counter keep 0")
+
+	updated, err = storages.Credentials.UpdateSignCount(ctx, credential.ID, 5, now)
+	require.NoError(t, err)
+	assert.True(t, updated)
+
+	updated, err = storages.Credentials.UpdateSignCount(ctx, credential.ID, 5, now)
+	require.NoError(t, err)
+	assert.False(t, updated, "the same counter is used once")
+
+	updated, err = storages.Credentials.UpdateSignCount(ctx, credential.ID, 0, now)
+	require.NoError(t, err)
+	assert.False(t, updated, "the counter does not go back to 0")
+
+	found, err := storages.Credentials.FindByCredentialID(ctx, "credential")
+	require.NoError(t, err)
+	require.NotNil(t, found)
+	assert.Equal(t, uint32(5), found.SignCount)
+	require.NotNil(t, found.LastUsedAt)
+}
+
+func testWebAuthnTakeChallenge(t *testing.T, storages WebAuthnStorages) {
+	ctx := context.Background()
+	expiresAt := time.Date(2020, 6, 1, 12, 5, 0, 0, time.UTC)
+
+	challenge := newWebAuthnChallenge("nonce-1", expiresAt)
+	challenge.Ceremony = domain.WebAuthnRegistration
+	challenge.UserID = 7
+	require.NoError(t, storages.Challenges.Insert(ctx, challenge))
+	assert.NotZero(t, challenge.ID)
+
+	taken, err := storages.Challenges.Take(ctx, "nonce-1")
+	require.NoError(t, err)
+	require.NotNil(t, taken)
+	assert.Equal(t, "challenge-nonce-1", taken.Challenge)
+	assert.Equal(t, domain.WebAuthnRegistration, taken.Ceremony)
+	assert.Equal(t, 7, taken.UserID)
+	assert.True(t, expiresAt.Equal(taken.ExpiresAt))
+
+	taken, err = storages.Challenges.Take(ctx, "nonce-1")
+	require.NoError(t, err)
+	assert.Nil(t, taken, "a challenge is taken once")
+
+	taken, err = storages.Challenges.Take(ctx, "nonce-missing")
+	require.NoError(t, err)
+	assert.Nil(t, taken)
+}
+
+func testWebAuthnTakeChallengeConcurrently(t *testing.T, storages WebAuthnStorages) {
+	ctx := context.Background()
+	require.NoError(t, storages.Challenges.Insert(ctx, newWebAuthnChallenge("nonce-1", time.Now().Add(time.Minute))))
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	taken := 0
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			challenge, err := storages.Challenges.Take(ctx, "nonce-1")
+			assert.NoError(t, err)
+			if challenge != nil {
+				mu.Lock()
+				taken++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 1, taken)
+}
+
+func testWebAuthnDeleteExpiredChallenges(t *testing.T, storages WebAuthnStorages) {
+	ctx := context.Background()
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	require.NoError(t, storages.Challenges.Insert(ctx, newWebAuthnChallenge("nonce-expired", now)))
+	require.NoError(t, storages.Challenges.Insert(ctx, newWebAuthnChallenge("nonce-valid", now.Add(time.Minute))))
+	require.NoError(t, storages.Challenges.DeleteExpired(ctx, now))
+
+	taken, err := storages.Challenges.Take(ctx, "nonce-expired")
+	require.NoError(t, err)
+	assert.Nil(t, taken)
+
+	taken, err = storages.Challenges.Take(ctx, "nonce-valid")
+	require.NoError(t, err)
+	assert.NotNil(t, taken)
+}
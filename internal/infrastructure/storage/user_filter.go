@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"github.com/jinzhu/gorm"
+
+	"gitlab.com/evzpav/user-auth/internal/domain"
+)
+
+// FilterUsers adds the conditions of the filter to a query of the users table, the SQL storages
+// share it since it is valid in every database
+func FilterUsers(db *gorm.DB, filter *domain.UserFilter) *gorm.DB {
+	if filter.Query != "" {
+		pattern := ContainsPattern(filter.Query)
+		db = db.Where(`LOWER(users.email) LIKE (?) ESCAPE '!' OR LOWER(users.name) LIKE (?) ESCAPE '!'`, pattern, pattern)
+	}
+
+	if filter.EmailPrefix != "" {
+		db = db.Where(`LOWER(users.email) LIKE (?) ESCAPE '!'`, PrefixPattern(filter.EmailPrefix))
+	}
+
+	if filter.Provider != "" {
+		db = db.Where(`EXISTS (SELECT 1 FROM user_identities WHERE user_identities.user_id = users.id AND user_identities.provider = (?))`, filter.Provider)
+	}
+
+	if filter.CreatedAfter != nil {
+		db = db.Where(`users.created_at >= (?)`, filter.CreatedAfter.UTC())
+	}
+
+	if filter.CreatedBefore != nil {
+		db = db.Where(`users.created_at < (?)`, filter.CreatedBefore.UTC())
+	}
+
+	if filter.Disabled != nil {
+		db = db.Where(nullCondition("users.disabled_at", *filter.Disabled))
+	}
+
+	if filter.Deleted != nil {
+		db = db.Where(nullCondition("users.deleted_at", *filter.Deleted))
+	}
+
+	return db
+}
+
+func nullCondition(column string, set bool) string {
+	if set {
+		return column + " IS NOT NULL"
+	}
+
+	return column + " IS NULL"
+}
@@ -0,0 +1,183 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"fmt"
+	"math/big"
+)
+
+// JWK is the JSON Web Key representation (RFC 7517) of a public key
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use,omitempty"`
+	Algorithm string `json:"alg,omitempty"`
+
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+
+	// EC and OKP
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+	Y     string `json:"y,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// PublicKeys indexes verification keys by key ID
+type PublicKeys map[string]JWK
+
+// NewJWK builds the public JWK of a signing key
+func NewJWK(key *Key) (JWK, error) {
+	jwk := JWK{
+		KeyID:     key.ID,
+		Use:       "sig",
+		Algorithm: key.Algorithm,
+	}
+
+	switch pub := key.Public().(type) {
+	case *rsa.PublicKey:
+		jwk.KeyType = "RSA"
+		jwk.N = b64.EncodeToString(pub.N.Bytes())
+		jwk.E = b64.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		jwk.KeyType = "EC"
+		jwk.Curve = pub.Curve.Params().Name
+		jwk.X = b64.EncodeToString(padLeft(pub.X.Bytes(), size))
+		jwk.Y = b64.EncodeToString(padLeft(pub.Y.Bytes(), size))
+	case ed25519.PublicKey:
+		jwk.KeyType = "OKP"
+		jwk.Curve = "Ed25519"
+		jwk.X = b64.EncodeToString(pub)
+	default:
+		return JWK{}, fmt.Errorf("unsupported public key type %T", pub)
+	}
+
+	return jwk, nil
+}
+
+// PublicKey decodes the JWK into a crypto public key
+func (k JWK) PublicKey() (crypto.PublicKey, error) {
+	switch k.KeyType {
+	case "RSA":
+		n, err := b64.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := b64.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "EC":
+		if k.Curve != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Curve)
+		}
+
+		x, err := b64.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+
+		y, err := b64.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+
+		return &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}, nil
+	case "OKP":
+		if k.Curve != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Curve)
+		}
+
+		x, err := b64.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid ed25519 key size")
+		}
+
+		return ed25519.PublicKey(x), nil
+	}
+
+	return nil, fmt.Errorf("unsupported key type %q", k.KeyType)
+}
+
+// NewJWKS builds the public key set of the signing keys
+func NewJWKS(keys ...*Key) (*JWKS, error) {
+	set := &JWKS{Keys: make([]JWK, 0, len(keys))}
+	for _, key := range keys {
+		jwk, err := NewJWK(key)
+		if err != nil {
+			return nil, err
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	return set, nil
+}
+
+// PublicKeys indexes the key set by key ID
+func (s *JWKS) PublicKeys() PublicKeys {
+	keys := make(PublicKeys, len(s.Keys))
+	for _, k := range s.Keys {
+		keys[k.KeyID] = k
+	}
+
+	return keys
+}
+
+func (pk PublicKeys) lookup(kid, alg string) (crypto.PublicKey, bool) {
+	jwk, ok := pk[kid]
+	if !ok {
+		return nil, false
+	}
+
+	if jwk.Algorithm != "" && jwk.Algorithm != alg {
+		return nil, false
+	}
+
+	if algorithmFor(jwk) != alg {
+		return nil, false
+	}
+
+	pub, err := jwk.PublicKey()
+	if err != nil {
+		return nil, false
+	}
+
+	return pub, true
+}
+
+func algorithmFor(jwk JWK) string {
+	switch jwk.KeyType {
+	case "RSA":
+		return RS256
+	case "EC":
+		return ES256
+	case "OKP":
+		return EdDSA
+	}
+
+	return ""
+}
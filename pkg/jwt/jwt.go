@@ -0,0 +1,190 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+var (
+	ErrMalformed        = errors.New("malformed token")
+	ErrUnknownKey       = errors.New("unknown signing key")
+	ErrInvalidSignature = errors.New("invalid token signature")
+	ErrExpired          = errors.New("token is expired")
+	ErrNotYetValid      = errors.New("token is not valid yet")
+	ErrInvalidIssuer    = errors.New("invalid token issuer")
+	ErrInvalidAudience  = errors.New("invalid token audience")
+)
+
+var b64 = base64.RawURLEncoding
+
+type header struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ,omitempty"`
+	KeyID     string `json:"kid,omitempty"`
+}
+
+// Claims are the registered claims of RFC 7519
+type Claims struct {
+	Issuer    string `json:"iss,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	Audience  string `json:"aud,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	NotBefore int64  `json:"nbf,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	ID        string `json:"jti,omitempty"`
+}
+
+// Validate checks the time based claims and, when not empty, the expected issuer and audience
+func (c *Claims) Validate(now time.Time, issuer, audience string) error {
+	if c.ExpiresAt != 0 && now.Unix() >= c.ExpiresAt {
+		return ErrExpired
+	}
+
+	if c.NotBefore != 0 && now.Unix() < c.NotBefore {
+		return ErrNotYetValid
+	}
+
+	if issuer != "" && c.Issuer != issuer {
+		return ErrInvalidIssuer
+	}
+
+	if audience != "" && c.Audience != audience {
+		return ErrInvalidAudience
+	}
+
+	return nil
+}
+
+// Sign serializes the claims and signs them with the key in the JWS compact format
+func Sign(key *Key, claims interface{}) (string, error) {
+	h, err := json.Marshal(header{Algorithm: key.Algorithm, Type: "JWT", KeyID: key.ID})
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := b64.EncodeToString(h) + "." + b64.EncodeToString(payload)
+
+	signature, err := sign(key, []byte(signingInput))
+	if err != nil {
+		return "", err
+	}
+
+	return signingInput + "." + b64.EncodeToString(signature), nil
+}
+
+func sign(key *Key, input []byte) ([]byte, error) {
+	switch k := key.signer.(type) {
+	case ed25519.PrivateKey:
+		return ed25519.Sign(k, input), nil
+	case *rsa.PrivateKey:
+		digest := sha256.Sum256(input)
+		return rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+	case *ecdsa.PrivateKey:
+		digest := sha256.Sum256(input)
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		if err != nil {
+			return nil, err
+		}
+
+		size := (k.Curve.Params().BitSize + 7) / 8
+		return append(padLeft(r.Bytes(), size), padLeft(s.Bytes(), size)...), nil
+	}
+
+	return nil, fmt.Errorf("unsupported key type %T", key.signer)
+}
+
+// Verify checks the signature of token against the public key registered for its key ID and
+// decodes the payload into claims
+func Verify(token string, keys PublicKeys, claims interface{}) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return ErrMalformed
+	}
+
+	rawHeader, err := b64.DecodeString(parts[0])
+	if err != nil {
+		return ErrMalformed
+	}
+
+	var h header
+	if err := json.Unmarshal(rawHeader, &h); err != nil {
+		return ErrMalformed
+	}
+
+	pub, ok := keys.lookup(h.KeyID, h.Algorithm)
+	if !ok {
+		return ErrUnknownKey
+	}
+
+	signature, err := b64.DecodeString(parts[2])
+	if err != nil {
+		return ErrMalformed
+	}
+
+	if !verify(h.Algorithm, pub, []byte(parts[0]+"."+parts[1]), signature) {
+		return ErrInvalidSignature
+	}
+
+	payload, err := b64.DecodeString(parts[1])
+	if err != nil {
+		return ErrMalformed
+	}
+
+	if err := json.Unmarshal(payload, claims); err != nil {
+		return ErrMalformed
+	}
+
+	return nil
+}
+
+func padLeft(b []byte, size int) []byte {
+	if len(b) >= size {
+		return b
+	}
+
+	padded := make([]byte, size)
+	copy(padded[size-len(b):], b)
+	return padded
+}
+
+func verify(alg string, pub crypto.PublicKey, input, signature []byte) bool {
+	switch alg {
+	case EdDSA:
+		k, ok := pub.(ed25519.PublicKey)
+		return ok && ed25519.Verify(k, input, signature)
+	case RS256:
+		k, ok := pub.(*rsa.PublicKey)
+		if !ok {
+			return false
+		}
+		digest := sha256.Sum256(input)
+		return rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], signature) == nil
+	case ES256:
+		k, ok := pub.(*ecdsa.PublicKey)
+		if !ok || len(signature) != 64 {
+			return false
+		}
+		digest := sha256.Sum256(input)
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		return ecdsa.Verify(k, digest[:], r, s)
+	}
+
+	return false
+}
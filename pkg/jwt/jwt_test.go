@@ -0,0 +1,122 @@
+package jwt_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/evzpav/user-auth/pkg/jwt"
+)
+
+func newSigners(t *testing.T) map[string]crypto.Signer {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	return map[string]crypto.Signer{
+		jwt.RS256: rsaKey,
+		jwt.ES256: ecKey,
+		jwt.EdDSA: edKey,
+	}
+}
+
+func TestSignAndVerify(t *testing.T) {
+	for alg, signer := range newSigners(t) {
+		t.Run(alg, func(t *testing.T) {
+			key, err := jwt.NewKey("key-"+alg, signer)
+			require.NoError(t, err)
+			assert.Equal(t, alg, key.Algorithm)
+
+			set, err := jwt.NewJWKS(key)
+			require.NoError(t, err)
+
+			// the key set must survive a JSON round trip as other services fetch it
+			bs, err := json.Marshal(set)
+			require.NoError(t, err)
+			var fetched jwt.JWKS
+			require.NoError(t, json.Unmarshal(bs, &fetched))
+
+			token, err := jwt.Sign(key, jwt.Claims{Subject: "42", Issuer: "user-auth"})
+			require.NoError(t, err)
+
+			var claims jwt.Claims
+			require.NoError(t, jwt.Verify(token, fetched.PublicKeys(), &claims))
+			assert.Equal(t, "42", claims.Subject)
+
+			parts := strings.Split(token, ".")
+			tampered := parts[0] + "." + parts[1] + "x." + parts[2]
+			assert.Equal(t, jwt.ErrInvalidSignature, jwt.Verify(tampered, fetched.PublicKeys(), &claims))
+		})
+	}
+}
+
+func TestVerify_UnknownKey(t *testing.T) {
+	signers := newSigners(t)
+
+	signing, err := jwt.NewKey("a", signers[jwt.EdDSA])
+	require.NoError(t, err)
+	other, err := jwt.NewKey("b", signers[jwt.ES256])
+	require.NoError(t, err)
+
+	set, err := jwt.NewJWKS(other)
+	require.NoError(t, err)
+
+	token, err := jwt.Sign(signing, jwt.Claims{Subject: "42"})
+	require.NoError(t, err)
+
+	var claims jwt.Claims
+	assert.Equal(t, jwt.ErrUnknownKey, jwt.Verify(token, set.PublicKeys(), &claims))
+	assert.Equal(t, jwt.ErrMalformed, jwt.Verify("not-a-token", set.PublicKeys(), &claims))
+}
+
+func TestClaims_Validate(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	claims := jwt.Claims{
+		Issuer:    "user-auth",
+		Audience:  "api",
+		IssuedAt:  now.Unix(),
+		NotBefore: now.Unix(),
+		ExpiresAt: now.Add(time.Minute).Unix(),
+	}
+
+	assert.NoError(t, claims.Validate(now, "user-auth", "api"))
+	assert.Equal(t, jwt.ErrExpired, claims.Validate(now.Add(time.Minute), "", ""))
+	assert.Equal(t, jwt.ErrNotYetValid, claims.Validate(now.Add(-time.Second), "", ""))
+	assert.Equal(t, jwt.ErrInvalidIssuer, claims.Validate(now, "other", ""))
+	assert.Equal(t, jwt.ErrInvalidAudience, claims.Validate(now, "", "other"))
+}
+
+func TestParsePrivateKeyPEM(t *testing.T) {
+	for alg, signer := range newSigners(t) {
+		t.Run(alg, func(t *testing.T) {
+			der, err := x509.MarshalPKCS8PrivateKey(signer)
+			require.NoError(t, err)
+
+			parsed, err := jwt.ParsePrivateKeyPEM(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+			require.NoError(t, err)
+
+			key, err := jwt.NewKey("parsed", parsed)
+			require.NoError(t, err)
+			assert.Equal(t, alg, key.Algorithm)
+		})
+	}
+
+	_, err := jwt.ParsePrivateKeyPEM([]byte("garbage"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,125 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// Supported signing algorithms
+const (
+	RS256 = "RS256"
+	ES256 = "ES256"
+	EdDSA = "EdDSA"
+)
+
+// Key is a private key used to sign tokens, identified by its key ID
+type Key struct {
+	ID        string
+	Algorithm string
+	signer    crypto.Signer
+}
+
+// NewKey creates a signing key and picks the algorithm from the key type
+func NewKey(id string, signer crypto.Signer) (*Key, error) {
+	if id == "" {
+		return nil, fmt.Errorf("key id is required")
+	}
+
+	var alg string
+	switch k := signer.(type) {
+	case *rsa.PrivateKey:
+		if k.N.BitLen() < 2048 {
+			return nil, fmt.Errorf("rsa key %s must have at least 2048 bits", id)
+		}
+		alg = RS256
+	case *ecdsa.PrivateKey:
+		if k.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("ecdsa key %s must use the P-256 curve", id)
+		}
+		alg = ES256
+	case ed25519.PrivateKey:
+		alg = EdDSA
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", signer)
+	}
+
+	return &Key{
+		ID:        id,
+		Algorithm: alg,
+		signer:    signer,
+	}, nil
+}
+
+// Public returns the public part of the key
+func (k *Key) Public() crypto.PublicKey {
+	return k.signer.Public()
+}
+
+// ParsePrivateKeyPEM parses a PKCS#1, SEC 1 or PKCS#8 PEM encoded private key
+func ParsePrivateKeyPEM(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found")
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("unsupported private key type %T", key)
+		}
+		return signer, nil
+	}
+
+	return nil, fmt.Errorf("unsupported PEM block type %q", block.Type)
+}
+
+// LoadKeyFiles reads PEM private keys from the given paths. The file name without
+// extension is used as the key ID.
+func LoadKeyFiles(paths ...string) ([]*Key, error) {
+	keys := make([]*Key, 0, len(paths))
+	for _, path := range paths {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read key %s: %v", path, err)
+		}
+
+		signer, err := ParsePrivateKeyPEM(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse key %s: %v", path, err)
+		}
+
+		id := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		key, err := NewKey(id, signer)
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
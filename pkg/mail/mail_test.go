@@ -0,0 +1,99 @@
+package mail_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	netmail "net/mail"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/evzpav/user-auth/pkg/mail"
+)
+
+func TestMessage_Bytes(t *testing.T) {
+	m := &mail.Message{
+		From:    "user-auth <no-reply@example.com>",
+		To:      []string{"user@example.com"},
+		Subject: "Verificação de email",
+		Text:    "Open the link: https://example.com/email/verify?token=abc",
+		HTML:    `<p><a href="https://example.com/email/verify?token=abc">Verify</a></p>`,
+		Date:    time.Date(2020, 5, 1, 10, 0, 0, 0, time.UTC),
+	}
+
+	raw, err := m.Bytes()
+	require.NoError(t, err)
+
+	msg, err := netmail.ReadMessage(bytes.NewReader(raw))
+	require.NoError(t, err)
+
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	require.NoError(t, err)
+	assert.Equal(t, "Verificação de email", subject)
+	assert.Equal(t, "Fri, 01 May 2020 10:00:00 +0000", msg.Header.Get("Date"))
+	assert.Contains(t, msg.Header.Get("Message-ID"), "@example.com>")
+	assert.Equal(t, "1.0", msg.Header.Get("MIME-Version"))
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	assert.Equal(t, "multipart/alternative", mediaType)
+
+	reader := multipart.NewReader(msg.Body, params["boundary"])
+	var types, bodies []string
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			break
+		}
+
+		// the multipart reader decodes quoted printable parts and drops the header
+		body, err := ioutil.ReadAll(part)
+		require.NoError(t, err)
+		types = append(types, part.Header.Get("Content-Type"))
+		bodies = append(bodies, string(body))
+	}
+
+	assert.Equal(t, []string{"text/plain; charset=utf-8", "text/html; charset=utf-8"}, types)
+	assert.Equal(t, []string{m.Text, m.HTML}, bodies)
+}
+
+func TestMessage_BytesTextOnly(t *testing.T) {
+	m := &mail.Message{From: "no-reply@example.com", To: []string{"user@example.com"}, Subject: "Hi", Text: "Olá"}
+
+	raw, err := m.Bytes()
+	require.NoError(t, err)
+
+	msg, err := netmail.ReadMessage(bytes.NewReader(raw))
+	require.NoError(t, err)
+	assert.Equal(t, "text/plain; charset=utf-8", msg.Header.Get("Content-Type"))
+
+	body, err := ioutil.ReadAll(quotedprintable.NewReader(msg.Body))
+	require.NoError(t, err)
+	assert.Equal(t, "Olá", string(body))
+	assert.False(t, m.Date.IsZero())
+}
+
+func TestMessage_BytesRejectsHeaderInjection(t *testing.T) {
+	m := &mail.Message{From: "no-reply@example.com", To: []string{"user@example.com\r\nBcc: other@example.com"}, Text: "hi"}
+	_, err := m.Bytes()
+	assert.Equal(t, mail.ErrInvalidHeader, err)
+
+	m = &mail.Message{From: "no-reply@example.com", Subject: "hi\nBcc: other@example.com", To: []string{"user@example.com"}}
+	_, err = m.Bytes()
+	assert.Equal(t, mail.ErrInvalidHeader, err)
+
+	_, err = (&mail.Message{From: "no-reply@example.com"}).Bytes()
+	assert.Error(t, err)
+}
+
+func TestNewMessageID(t *testing.T) {
+	id := mail.NewMessageID("no-reply@example.com")
+	assert.True(t, strings.HasPrefix(id, "<") && strings.HasSuffix(id, "@example.com>"))
+	assert.NotEqual(t, id, mail.NewMessageID("no-reply@example.com"))
+	assert.True(t, strings.HasSuffix(mail.NewMessageID("invalid"), "@localhost>"))
+}
@@ -0,0 +1,72 @@
+package migrate
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+)
+
+var (
+	validName = regexp.MustCompile(`^[a-z0-9_]+$`)
+	fileName  = regexp.MustCompile(`^(\d+)_[a-z0-9_]+\.go$`)
+)
+
+const template = `package %s
+
+import "gitlab.com/evzpav/user-auth/pkg/migrate"
+
+func init() {
+	register(migrate.Migration{
+		Version: %d,
+		Name:    %q,
+		Up: ` + "`" + `
+` + "`" + `,
+		Down: ` + "`" + `
+` + "`" + `,
+	})
+}
+`
+
+// Create writes the skeleton of the next migration in the migrations package at dir and returns
+// its path. The version follows the highest one of the files in dir.
+func Create(dir, name string) (string, error) {
+	if !validName.MatchString(name) {
+		return "", fmt.Errorf("invalid migration name %q, use lower case letters, digits and _", name)
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+
+	version := 0
+	for _, file := range files {
+		match := fileName.FindStringSubmatch(file.Name())
+		if match == nil {
+			continue
+		}
+
+		if v, _ := strconv.Atoi(match[1]); v > version {
+			version = v
+		}
+	}
+	version++
+
+	path := filepath.Join(dir, fmt.Sprintf("%04d_%s.go", version, name))
+	content := fmt.Sprintf(template, filepath.Base(dir), version, name)
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := f.WriteString(content); err != nil {
+		f.Close()
+		return "", err
+	}
+
+	return path, f.Close()
+}
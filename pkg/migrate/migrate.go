@@ -0,0 +1,297 @@
+// Package migrate applies versioned schema migrations and records them in the schema_migrations
+// table of the database.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Migration changes the schema from the previous version. Up and Down hold SQL statements, each one
+// ending with a semicolon at the end of a line.
+type Migration struct {
+	Version int
+	Name    string
+	// Prepare is optional, it runs in the transaction before Up for the checks and changes that
+	// depend on what is found in the database. An error stops the migration.
+	Prepare func(ctx context.Context, tx *sql.Tx) error
+	Up      string
+	Down    string
+}
+
+// Status of a migration, AppliedAt is nil when it is pending
+type Status struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+type dialect struct {
+	createTable string
+	placeholder func(n int) string
+}
+
+var dialects = map[string]dialect{
+	"mysql": {
+		createTable: `CREATE TABLE IF NOT EXISTS schema_migrations(
+			version BIGINT NOT NULL PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			applied_at DATETIME NOT NULL
+		)`,
+		placeholder: func(int) string { return "?" },
+	},
+	"postgres": {
+		createTable: `CREATE TABLE IF NOT EXISTS schema_migrations(
+			version BIGINT NOT NULL PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL
+		)`,
+		placeholder: func(n int) string { return fmt.Sprintf("$%d", n) },
+	},
+	"sqlite": {
+		createTable: `CREATE TABLE IF NOT EXISTS schema_migrations(
+			version INTEGER NOT NULL PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at DATETIME NOT NULL
+		)`,
+		placeholder: func(int) string { return "?" },
+	},
+}
+
+type Migrator struct {
+	db         *sql.DB
+	dialect    dialect
+	migrations []Migration
+	now        func() time.Time
+}
+
+// New creates a migrator of a mysql, postgres or sqlite database. Migrations are sorted by version,
+// versions must be positive and unique.
+func New(db *sql.DB, driver string, migrations []Migration) (*Migrator, error) {
+	d, ok := dialects[driver]
+	if !ok {
+		return nil, fmt.Errorf("unsupported migration driver %q", driver)
+	}
+
+	sorted := make([]Migration, len(migrations))
+	copy(sorted, migrations)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+
+	for i, m := range sorted {
+		if m.Version <= 0 {
+			return nil, fmt.Errorf("migration %q has invalid version %d", m.Name, m.Version)
+		}
+
+		if i > 0 && sorted[i-1].Version == m.Version {
+			return nil, fmt.Errorf("migrations %q and %q have the same version %d", sorted[i-1].Name, m.Name, m.Version)
+		}
+	}
+
+	return &Migrator{
+		db:         db,
+		dialect:    d,
+		migrations: sorted,
+		now:        time.Now,
+	}, nil
+}
+
+// Up applies the pending migrations in order and returns them. It stops at the first failure, the
+// migrations applied before it are kept.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+
+		err := m.run(ctx, migration.Prepare, migration.Up, func(tx *sql.Tx) error {
+			_, err := tx.ExecContext(ctx, fmt.Sprintf("INSERT INTO schema_migrations (version, name, applied_at) VALUES (%s, %s, %s)",
+				m.dialect.placeholder(1), m.dialect.placeholder(2), m.dialect.placeholder(3)),
+				migration.Version, migration.Name, m.now().UTC())
+			return err
+		})
+		if err != nil {
+			return done, fmt.Errorf("migration %d %s failed: %v", migration.Version, migration.Name, err)
+		}
+
+		done = append(done, migration)
+	}
+
+	return done, nil
+}
+
+// Down reverts the last applied migration and returns it, or nil when none is applied
+func (m *Migrator) Down(ctx context.Context) (*Migration, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	last := 0
+	for version := range applied {
+		if version > last {
+			last = version
+		}
+	}
+
+	if last == 0 {
+		return nil, nil
+	}
+
+	migration, ok := m.find(last)
+	if !ok {
+		return nil, fmt.Errorf("migration %d is applied but unknown to this build", last)
+	}
+
+	err = m.run(ctx, nil, migration.Down, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM schema_migrations WHERE version = %s", m.dialect.placeholder(1)), migration.Version)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reverting migration %d %s failed: %v", migration.Version, migration.Name, err)
+	}
+
+	return &migration, nil
+}
+
+// Status lists the known migrations in order with their application date
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	status := make([]Status, len(m.migrations))
+	for i, migration := range m.migrations {
+		status[i].Migration = migration
+		if appliedAt, ok := applied[migration.Version]; ok {
+			appliedAt := appliedAt
+			status[i].AppliedAt = &appliedAt
+		}
+	}
+
+	return status, nil
+}
+
+// Pending returns the migrations not applied yet
+func (m *Migrator) Pending(ctx context.Context) ([]Migration, error) {
+	status, err := m.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []Migration
+	for _, s := range status {
+		if s.AppliedAt == nil {
+			pending = append(pending, s.Migration)
+		}
+	}
+
+	return pending, nil
+}
+
+func (m *Migrator) applied(ctx context.Context) (map[int]time.Time, error) {
+	if _, err := m.db.ExecContext(ctx, m.dialect.createTable); err != nil {
+		return nil, err
+	}
+
+	rows, err := m.db.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+
+		applied[version] = appliedAt
+	}
+
+	return applied, rows.Err()
+}
+
+// run executes the statements and records the change in a transaction. MySQL commits schema
+// changes implicitly, a failed migration there may be partially applied.
+func (m *Migrator) run(ctx context.Context, prepare func(ctx context.Context, tx *sql.Tx) error, script string, record func(tx *sql.Tx) error) error {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if prepare != nil {
+		if err := prepare(ctx, tx); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	for _, statement := range Statements(script) {
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if err := record(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m *Migrator) find(version int) (Migration, bool) {
+	for _, migration := range m.migrations {
+		if migration.Version == version {
+			return migration, true
+		}
+	}
+
+	return Migration{}, false
+}
+
+// Statements splits a script on the semicolons ending a line, blank statements and lines starting
+// with -- are skipped
+func Statements(script string) []string {
+	var statements []string
+	var current []string
+
+	flush := func() {
+		statement := strings.TrimSpace(strings.Join(current, "\n"))
+		if statement != "" {
+			statements = append(statements, statement)
+		}
+		current = nil
+	}
+
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+
+		if strings.HasSuffix(trimmed, ";") {
+			current = append(current, strings.TrimSuffix(strings.TrimRight(line, " \t\r"), ";"))
+			flush()
+			continue
+		}
+
+		current = append(current, line)
+	}
+
+	flush()
+	return statements
+}
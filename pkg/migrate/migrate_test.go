@@ -0,0 +1,230 @@
+package migrate_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	_ "modernc.org/sqlite"
+
+	"gitlab.com/evzpav/user-auth/pkg/migrate"
+)
+
+var testMigrations = []migrate.Migration{
+	{
+		Version: 2,
+		Name:    "add_users_name",
+		Up:      "ALTER TABLE users ADD COLUMN name TEXT;",
+		Down:    "ALTER TABLE users DROP COLUMN name;",
+	},
+	{
+		Version: 1,
+		Name:    "create_users",
+		Up: `
+-- users of the test
+CREATE TABLE users(
+   id INTEGER PRIMARY KEY
+);
+CREATE INDEX users_id ON users (id);
+`,
+		Down: "DROP TABLE users;",
+	},
+}
+
+func newTestDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite", ":memory:")
+	require.NoError(t, err)
+	db.SetMaxOpenConns(1)
+
+	return db
+}
+
+func columns(t *testing.T, db *sql.DB) []string {
+	rows, err := db.Query("SELECT name FROM pragma_table_info('users') ORDER BY cid")
+	require.NoError(t, err)
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		require.NoError(t, rows.Scan(&name))
+		names = append(names, name)
+	}
+
+	return names
+}
+
+func TestMigrator(t *testing.T) {
+	db := newTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	m, err := migrate.New(db, "sqlite", testMigrations)
+	require.NoError(t, err)
+
+	pending, err := m.Pending(ctx)
+	require.NoError(t, err)
+	assert.Len(t, pending, 2)
+
+	applied, err := m.Up(ctx)
+	require.NoError(t, err)
+	require.Len(t, applied, 2)
+	assert.Equal(t, 1, applied[0].Version)
+	assert.Equal(t, []string{"id", "name"}, columns(t, db))
+
+	applied, err = m.Up(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, applied)
+
+	status, err := m.Status(ctx)
+	require.NoError(t, err)
+	require.Len(t, status, 2)
+	assert.NotNil(t, status[0].AppliedAt)
+	assert.NotNil(t, status[1].AppliedAt)
+
+	reverted, err := m.Down(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, reverted.Version)
+	assert.Equal(t, []string{"id"}, columns(t, db))
+
+	status, err = m.Status(ctx)
+	require.NoError(t, err)
+	assert.NotNil(t, status[0].AppliedAt)
+	assert.Nil(t, status[1].AppliedAt)
+
+	reverted, err = m.Down(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, reverted.Version)
+
+	reverted, err = m.Down(ctx)
+	require.NoError(t, err)
+	assert.Nil(t, reverted)
+}
+
+func TestMigrator_FailedMigrationIsRolledBack(t *testing.T) {
+	db := newTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	broken := append(testMigrations, migrate.Migration{
+		Version: 3,
+		Name:    "broken",
+		Up:      "CREATE TABLE tokens(id INTEGER);\nALTER TABLE missing ADD COLUMN name TEXT;",
+	})
+
+	m, err := migrate.New(db, "sqlite", broken)
+	require.NoError(t, err)
+
+	applied, err := m.Up(ctx)
+	assert.Error(t, err)
+	assert.Len(t, applied, 2)
+
+	var tables int
+	require.NoError(t, db.QueryRow("SELECT count(*) FROM sqlite_master WHERE name = 'tokens'").Scan(&tables))
+	assert.Zero(t, tables)
+
+	pending, err := m.Pending(ctx)
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.Equal(t, 3, pending[0].Version)
+}
+
+func TestMigrator_Prepare(t *testing.T) {
+	db := newTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	// the legacy table has no name, Prepare adds the column Up expects
+	_, err := db.Exec("CREATE TABLE users(id INTEGER PRIMARY KEY)")
+	require.NoError(t, err)
+
+	duplicated := errors.New("duplicated users")
+	prepared := []migrate.Migration{
+		{
+			Version: 1,
+			Name:    "upgrade_users",
+			Prepare: func(ctx context.Context, tx *sql.Tx) error {
+				_, err := tx.ExecContext(ctx, "ALTER TABLE users ADD COLUMN name TEXT")
+				return err
+			},
+			Up: "CREATE INDEX users_name ON users (name);",
+		},
+		{
+			Version: 2,
+			Name:    "check_users",
+			Prepare: func(ctx context.Context, tx *sql.Tx) error {
+				return duplicated
+			},
+			Up: "CREATE TABLE tokens(id INTEGER);",
+		},
+	}
+
+	m, err := migrate.New(db, "sqlite", prepared)
+	require.NoError(t, err)
+
+	applied, err := m.Up(ctx)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "duplicated users")
+	require.Len(t, applied, 1)
+	assert.Equal(t, []string{"id", "name"}, columns(t, db))
+
+	var tables int
+	require.NoError(t, db.QueryRow("SELECT count(*) FROM sqlite_master WHERE name = 'tokens'").Scan(&tables))
+	assert.Zero(t, tables, "the migration stopped by Prepare did not run")
+}
+
+func TestNew_Invalid(t *testing.T) {
+	_, err := migrate.New(nil, "oracle", nil)
+	assert.Error(t, err)
+
+	_, err = migrate.New(nil, "sqlite", []migrate.Migration{{Version: 0, Name: "zero"}})
+	assert.Error(t, err)
+
+	_, err = migrate.New(nil, "sqlite", []migrate.Migration{{Version: 1, Name: "a"}, {Version: 1, Name: "b"}})
+	assert.Error(t, err)
+}
+
+func TestStatements(t *testing.T) {
+	script := `
+-- comment
+CREATE TABLE a(
+   id INT
+);
+
+INSERT INTO a VALUES (1);INSERT INTO a VALUES (2);
+UPDATE a SET id = 3`
+
+	assert.Equal(t, []string{
+		"CREATE TABLE a(\n   id INT\n)",
+		"INSERT INTO a VALUES (1);INSERT INTO a VALUES (2)",
+		"UPDATE a SET id = 3",
+	}, migrate.Statements(script))
+}
+
+func TestCreate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "migrations")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "0007_add_roles.go"), nil, 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "migrations.go"), nil, 0644))
+
+	path, err := migrate.Create(dir, "add_orgs")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "0008_add_orgs.go"), path)
+
+	content, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "package "+filepath.Base(dir))
+	assert.Contains(t, string(content), "Version: 8,")
+	assert.Contains(t, string(content), `Name:    "add_orgs",`)
+
+	_, err = migrate.Create(dir, "Add Orgs")
+	assert.Error(t, err)
+}
@@ -0,0 +1,8 @@
+package oidc
+
+import "time"
+
+// SetNow replaces the clock of the client
+func SetNow(c *Client, now func() time.Time) {
+	c.now = now
+}
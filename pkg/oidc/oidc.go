@@ -0,0 +1,421 @@
+// Package oidc signs users in with OpenID Connect providers. The endpoints and keys of a provider
+// are read from its discovery document, logins use the authorization code flow with PKCE and the
+// ID tokens are validated against the keys of the provider and the nonce of the login.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"gitlab.com/evzpav/user-auth/pkg/jwt"
+)
+
+var (
+	ErrMissingIDToken  = errors.New("token response without id_token")
+	ErrInvalidIssuer   = errors.New("id token issued by another provider")
+	ErrInvalidAudience = errors.New("id token issued to another client")
+	ErrExpired         = errors.New("id token is expired")
+	ErrInvalidNonce    = errors.New("id token nonce does not match the login")
+	ErrMissingSubject  = errors.New("id token without subject")
+	ErrSubjectMismatch = errors.New("userinfo of another subject than the id token")
+)
+
+const (
+	// allowed clock difference with the provider
+	leeway = time.Minute
+	// keys are fetched again at most once per interval when a token is signed by an unknown key
+	keysRefreshInterval = time.Minute
+	discoveryPath       = "/.well-known/openid-configuration"
+)
+
+// DefaultScopes are requested when the config has none
+var DefaultScopes = []string{"openid", "email", "profile"}
+
+// Metadata is the part of the discovery document used by the client
+type Metadata struct {
+	Issuer                        string   `json:"issuer"`
+	AuthorizationEndpoint         string   `json:"authorization_endpoint"`
+	TokenEndpoint                 string   `json:"token_endpoint"`
+	UserinfoEndpoint              string   `json:"userinfo_endpoint"`
+	JWKSURI                       string   `json:"jwks_uri"`
+	CodeChallengeMethodsSupported []string `json:"code_challenge_methods_supported"`
+}
+
+type Config struct {
+	// Issuer is the url of the provider, its discovery document is at Issuer + /.well-known/openid-configuration
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	// Scopes must include openid, DefaultScopes when empty
+	Scopes []string
+	// HTTPClient defaults to http.DefaultClient
+	HTTPClient *http.Client
+}
+
+// IDToken holds the claims of a validated ID token, completed with the userinfo endpoint when the
+// token has no email
+type IDToken struct {
+	Issuer          string   `json:"iss"`
+	Subject         string   `json:"sub"`
+	Audience        Audience `json:"aud"`
+	AuthorizedParty string   `json:"azp,omitempty"`
+	ExpiresAt       int64    `json:"exp"`
+	IssuedAt        int64    `json:"iat"`
+	Nonce           string   `json:"nonce,omitempty"`
+	Email           string   `json:"email,omitempty"`
+	EmailVerified   Bool     `json:"email_verified,omitempty"`
+	Name            string   `json:"name,omitempty"`
+}
+
+type userInfo struct {
+	Subject       string `json:"sub"`
+	Email         string `json:"email"`
+	EmailVerified Bool   `json:"email_verified"`
+	Name          string `json:"name"`
+}
+
+// Client is the relying party of one provider. The discovery document is fetched on first use so
+// an unavailable provider does not prevent the service from starting.
+type Client struct {
+	config     Config
+	httpClient *http.Client
+	now        func() time.Time
+
+	mu            sync.Mutex
+	metadata      *Metadata
+	keys          jwt.PublicKeys
+	keysFetchedAt time.Time
+}
+
+func New(config Config) (*Client, error) {
+	if config.Issuer == "" || config.ClientID == "" || config.RedirectURL == "" {
+		return nil, fmt.Errorf("issuer, client id and redirect url are required")
+	}
+
+	if len(config.Scopes) == 0 {
+		config.Scopes = DefaultScopes
+	}
+
+	hasOpenID := false
+	for _, scope := range config.Scopes {
+		hasOpenID = hasOpenID || scope == "openid"
+	}
+	if !hasOpenID {
+		return nil, fmt.Errorf("scopes must include openid")
+	}
+
+	httpClient := config.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	return &Client{
+		config:     config,
+		httpClient: httpClient,
+		now:        time.Now,
+	}, nil
+}
+
+// AuthCodeURL returns the url of the provider the user is sent to. The state, nonce and code
+// verifier must be kept by the caller for Exchange.
+func (c *Client) AuthCodeURL(ctx context.Context, state, nonce, codeVerifier string) (string, error) {
+	metadata, err := c.Metadata(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return c.oauth2Config(metadata).AuthCodeURL(state,
+		oauth2.SetAuthURLParam("nonce", nonce),
+		oauth2.SetAuthURLParam("code_challenge", CodeChallenge(codeVerifier)),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+	), nil
+}
+
+// Exchange redeems the authorization code and returns the validated ID token
+func (c *Client) Exchange(ctx context.Context, code, nonce, codeVerifier string) (*IDToken, error) {
+	metadata, err := c.Metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, c.httpClient)
+	token, err := c.oauth2Config(metadata).Exchange(ctx, code, oauth2.SetAuthURLParam("code_verifier", codeVerifier))
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange code: %v", err)
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return nil, ErrMissingIDToken
+	}
+
+	idToken, err := c.Verify(ctx, rawIDToken, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	if idToken.Email == "" && metadata.UserinfoEndpoint != "" {
+		if err := c.completeFromUserInfo(ctx, metadata, token, idToken); err != nil {
+			return nil, err
+		}
+	}
+
+	return idToken, nil
+}
+
+// Verify checks the signature, issuer, audience, expiration and nonce of an ID token
+func (c *Client) Verify(ctx context.Context, rawIDToken, nonce string) (*IDToken, error) {
+	metadata, err := c.Metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := c.publicKeys(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var idToken IDToken
+	err = jwt.Verify(rawIDToken, keys, &idToken)
+	if err == jwt.ErrUnknownKey {
+		// the provider may have rotated its keys
+		if keys, err = c.publicKeys(ctx, true); err != nil {
+			return nil, err
+		}
+		err = jwt.Verify(rawIDToken, keys, &idToken)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if idToken.Issuer != metadata.Issuer {
+		return nil, ErrInvalidIssuer
+	}
+
+	if !idToken.Audience.Contains(c.config.ClientID) {
+		return nil, ErrInvalidAudience
+	}
+
+	if len(idToken.Audience) > 1 && idToken.AuthorizedParty != c.config.ClientID {
+		return nil, ErrInvalidAudience
+	}
+
+	now := c.now()
+	if now.Add(-leeway).Unix() >= idToken.ExpiresAt || now.Add(leeway).Unix() < idToken.IssuedAt {
+		return nil, ErrExpired
+	}
+
+	if subtle.ConstantTimeCompare([]byte(idToken.Nonce), []byte(nonce)) != 1 || nonce == "" {
+		return nil, ErrInvalidNonce
+	}
+
+	if idToken.Subject == "" {
+		return nil, ErrMissingSubject
+	}
+
+	return &idToken, nil
+}
+
+// Metadata returns the discovery document of the provider, fetched once
+func (c *Client) Metadata(ctx context.Context) (*Metadata, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.metadata != nil {
+		return c.metadata, nil
+	}
+
+	var metadata Metadata
+	if err := c.getJSON(ctx, strings.TrimSuffix(c.config.Issuer, "/")+discoveryPath, "", &metadata); err != nil {
+		return nil, fmt.Errorf("failed to discover %s: %v", c.config.Issuer, err)
+	}
+
+	if metadata.Issuer != c.config.Issuer {
+		return nil, fmt.Errorf("discovery document of %s has issuer %s", c.config.Issuer, metadata.Issuer)
+	}
+
+	if metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" || metadata.JWKSURI == "" {
+		return nil, fmt.Errorf("discovery document of %s misses endpoints", c.config.Issuer)
+	}
+
+	c.metadata = &metadata
+	return c.metadata, nil
+}
+
+func (c *Client) publicKeys(ctx context.Context, refresh bool) (jwt.PublicKeys, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.keys != nil && (!refresh || c.now().Sub(c.keysFetchedAt) < keysRefreshInterval) {
+		return c.keys, nil
+	}
+
+	var set jwt.JWKS
+	if err := c.getJSON(ctx, c.metadata.JWKSURI, "", &set); err != nil {
+		return nil, fmt.Errorf("failed to fetch keys of %s: %v", c.config.Issuer, err)
+	}
+
+	keys := make(jwt.PublicKeys, len(set.Keys))
+	for _, key := range set.Keys {
+		if key.Use == "" || key.Use == "sig" {
+			keys[key.KeyID] = key
+		}
+	}
+
+	c.keys, c.keysFetchedAt = keys, c.now()
+	return c.keys, nil
+}
+
+func (c *Client) completeFromUserInfo(ctx context.Context, metadata *Metadata, token *oauth2.Token, idToken *IDToken) error {
+	var info userInfo
+	if err := c.getJSON(ctx, metadata.UserinfoEndpoint, token.AccessToken, &info); err != nil {
+		return fmt.Errorf("failed to get userinfo: %v", err)
+	}
+
+	// the response is not signed, it is only trusted for the subject of the ID token
+	if info.Subject != idToken.Subject {
+		return ErrSubjectMismatch
+	}
+
+	idToken.Email = info.Email
+	idToken.EmailVerified = info.EmailVerified
+	if idToken.Name == "" {
+		idToken.Name = info.Name
+	}
+
+	return nil
+}
+
+func (c *Client) oauth2Config(metadata *Metadata) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     c.config.ClientID,
+		ClientSecret: c.config.ClientSecret,
+		RedirectURL:  c.config.RedirectURL,
+		Scopes:       c.config.Scopes,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  metadata.AuthorizationEndpoint,
+			TokenURL: metadata.TokenEndpoint,
+		},
+	}
+}
+
+func (c *Client) getJSON(ctx context.Context, url, accessToken string, v interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Accept", "application/json")
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+
+	resp, err := c.httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status %d from %s", resp.StatusCode, url)
+	}
+
+	return json.Unmarshal(body, v)
+}
+
+// NewCodeVerifier returns a random PKCE code verifier (RFC 7636)
+func NewCodeVerifier() (string, error) {
+	return randomString(32)
+}
+
+// NewNonce returns a random value binding the ID token to the login
+func NewNonce() (string, error) {
+	return randomString(16)
+}
+
+// CodeChallenge derives the S256 code challenge sent with the authorization request
+func CodeChallenge(codeVerifier string) string {
+	sum := sha256.Sum256([]byte(codeVerifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func randomString(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Audience is the aud claim, a single string or an array of strings
+type Audience []string
+
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return err
+	}
+
+	*a = many
+	return nil
+}
+
+func (a Audience) MarshalJSON() ([]byte, error) {
+	if len(a) == 1 {
+		return json.Marshal(a[0])
+	}
+
+	return json.Marshal([]string(a))
+}
+
+func (a Audience) Contains(clientID string) bool {
+	for _, aud := range a {
+		if aud == clientID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Bool accepts the "true" and "false" strings some providers send for boolean claims
+type Bool bool
+
+func (b *Bool) UnmarshalJSON(data []byte) error {
+	switch strings.Trim(string(data), `"`) {
+	case "true":
+		*b = true
+	case "false", "null":
+		*b = false
+	default:
+		return fmt.Errorf("invalid boolean %s", data)
+	}
+
+	return nil
+}
@@ -0,0 +1,209 @@
+package oidc_test
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/evzpav/user-auth/pkg/oidc"
+	"gitlab.com/evzpav/user-auth/pkg/oidc/oidctest"
+)
+
+const redirectURL = "http://localhost/login/test/callback"
+
+var testUser = &oidctest.User{Subject: "user-1", Email: "user@example.com", EmailVerified: true, Name: "User"}
+
+type login struct {
+	nonce, verifier string
+	query           url.Values
+}
+
+// authorize follows the login url to the provider and returns the query of the redirect back
+func authorize(t *testing.T, client *oidc.Client) login {
+	nonce, err := oidc.NewNonce()
+	require.NoError(t, err)
+	verifier, err := oidc.NewCodeVerifier()
+	require.NoError(t, err)
+
+	authURL, err := client.AuthCodeURL(context.Background(), "state-1", nonce, verifier)
+	require.NoError(t, err)
+
+	parsed, err := url.Parse(authURL)
+	require.NoError(t, err)
+	assert.Equal(t, nonce, parsed.Query().Get("nonce"))
+	assert.Equal(t, oidc.CodeChallenge(verifier), parsed.Query().Get("code_challenge"))
+	assert.Equal(t, "S256", parsed.Query().Get("code_challenge_method"))
+
+	noRedirect := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := noRedirect.Get(authURL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusFound, resp.StatusCode)
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(location.String(), redirectURL+"?"))
+	assert.Equal(t, "state-1", location.Query().Get("state"))
+
+	return login{nonce: nonce, verifier: verifier, query: location.Query()}
+}
+
+func newClient(t *testing.T, provider *oidctest.Server) *oidc.Client {
+	client, err := oidc.New(provider.Config(redirectURL))
+	require.NoError(t, err)
+
+	return client
+}
+
+func TestClient_Exchange(t *testing.T) {
+	provider := oidctest.NewServer()
+	defer provider.Close()
+	provider.SignIn(testUser)
+	client := newClient(t, provider)
+	ctx := context.Background()
+
+	l := authorize(t, client)
+	idToken, err := client.Exchange(ctx, l.query.Get("code"), l.nonce, l.verifier)
+	require.NoError(t, err)
+	assert.Equal(t, provider.URL, idToken.Issuer)
+	assert.Equal(t, "user-1", idToken.Subject)
+	assert.Equal(t, "user@example.com", idToken.Email)
+	assert.True(t, bool(idToken.EmailVerified))
+	assert.Equal(t, "User", idToken.Name)
+
+	_, err = client.Exchange(ctx, l.query.Get("code"), l.nonce, l.verifier)
+	assert.Error(t, err, "codes are single use")
+
+	l = authorize(t, client)
+	_, err = client.Exchange(ctx, l.query.Get("code"), "other-nonce", l.verifier)
+	assert.Equal(t, oidc.ErrInvalidNonce, err)
+
+	l = authorize(t, client)
+	other, err := oidc.NewCodeVerifier()
+	require.NoError(t, err)
+	_, err = client.Exchange(ctx, l.query.Get("code"), l.nonce, other)
+	assert.Error(t, err, "the code verifier does not match the challenge")
+
+	provider.SignIn(nil)
+	l = authorize(t, client)
+	assert.Equal(t, "access_denied", l.query.Get("error"))
+}
+
+func TestClient_ExchangeUserInfo(t *testing.T) {
+	provider := oidctest.NewServer()
+	defer provider.Close()
+	provider.SignIn(testUser)
+	provider.UserInfoOnly(true)
+	client := newClient(t, provider)
+
+	l := authorize(t, client)
+	idToken, err := client.Exchange(context.Background(), l.query.Get("code"), l.nonce, l.verifier)
+	require.NoError(t, err)
+	assert.Equal(t, "user@example.com", idToken.Email)
+	assert.True(t, bool(idToken.EmailVerified))
+	assert.Equal(t, "User", idToken.Name)
+}
+
+func TestClient_ExchangeInvalidIDToken(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(claims map[string]interface{})
+		err    error
+	}{
+		{name: "issuer", tamper: func(c map[string]interface{}) { c["iss"] = "https://other.example.com" }, err: oidc.ErrInvalidIssuer},
+		{name: "audience", tamper: func(c map[string]interface{}) { c["aud"] = "other-client" }, err: oidc.ErrInvalidAudience},
+		{name: "audiences without azp", tamper: func(c map[string]interface{}) { c["aud"] = []string{oidctest.ClientID, "other-client"} }, err: oidc.ErrInvalidAudience},
+		{name: "expired", tamper: func(c map[string]interface{}) { c["exp"] = time.Now().Add(-2 * time.Minute).Unix() }, err: oidc.ErrExpired},
+		{name: "issued in the future", tamper: func(c map[string]interface{}) { c["iat"] = time.Now().Add(time.Hour).Unix() }, err: oidc.ErrExpired},
+		{name: "subject", tamper: func(c map[string]interface{}) { c["sub"] = "" }, err: oidc.ErrMissingSubject},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := oidctest.NewServer()
+			defer provider.Close()
+			provider.SignIn(testUser)
+			provider.Tamper(tt.tamper)
+			client := newClient(t, provider)
+
+			l := authorize(t, client)
+			_, err := client.Exchange(context.Background(), l.query.Get("code"), l.nonce, l.verifier)
+			assert.Equal(t, tt.err, err)
+		})
+	}
+}
+
+func TestClient_ExchangeClaimFormats(t *testing.T) {
+	provider := oidctest.NewServer()
+	defer provider.Close()
+	provider.SignIn(testUser)
+	provider.Tamper(func(c map[string]interface{}) {
+		c["aud"] = []string{oidctest.ClientID, "other-client"}
+		c["azp"] = oidctest.ClientID
+		c["email_verified"] = "true"
+	})
+	client := newClient(t, provider)
+
+	l := authorize(t, client)
+	idToken, err := client.Exchange(context.Background(), l.query.Get("code"), l.nonce, l.verifier)
+	require.NoError(t, err)
+	assert.True(t, bool(idToken.EmailVerified))
+	assert.True(t, idToken.Audience.Contains("other-client"))
+}
+
+func TestClient_KeyRotation(t *testing.T) {
+	provider := oidctest.NewServer()
+	defer provider.Close()
+	provider.SignIn(testUser)
+	client := newClient(t, provider)
+	ctx := context.Background()
+
+	now := time.Now()
+	oidc.SetNow(client, func() time.Time { return now })
+
+	l := authorize(t, client)
+	_, err := client.Exchange(ctx, l.query.Get("code"), l.nonce, l.verifier)
+	require.NoError(t, err)
+
+	provider.RotateKey()
+
+	l = authorize(t, client)
+	_, err = client.Exchange(ctx, l.query.Get("code"), l.nonce, l.verifier)
+	assert.Error(t, err, "the keys are not fetched again right away")
+
+	now = now.Add(2 * time.Minute)
+	l = authorize(t, client)
+	_, err = client.Exchange(ctx, l.query.Get("code"), l.nonce, l.verifier)
+	assert.NoError(t, err)
+}
+
+func TestClient_Discovery(t *testing.T) {
+	provider := oidctest.NewServer()
+	defer provider.Close()
+
+	config := provider.Config(redirectURL)
+	config.Issuer += "/"
+	client, err := oidc.New(config)
+	require.NoError(t, err)
+
+	_, err = client.Metadata(context.Background())
+	assert.Error(t, err, "the issuer of the document must be the configured one")
+
+	metadata, err := newClient(t, provider).Metadata(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, provider.URL+"/token", metadata.TokenEndpoint)
+}
+
+func TestNew_Invalid(t *testing.T) {
+	_, err := oidc.New(oidc.Config{ClientID: "id", RedirectURL: redirectURL})
+	assert.Error(t, err)
+
+	_, err = oidc.New(oidc.Config{Issuer: "https://example.com", ClientID: "id", RedirectURL: redirectURL, Scopes: []string{"email"}})
+	assert.Error(t, err)
+}
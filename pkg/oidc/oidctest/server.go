@@ -0,0 +1,296 @@
+// Package oidctest provides a stand-in OpenID Connect provider, so logins run in tests without
+// reaching a real provider.
+package oidctest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"gitlab.com/evzpav/user-auth/pkg/jwt"
+	"gitlab.com/evzpav/user-auth/pkg/oidc"
+)
+
+const (
+	ClientID     = "test-client-id"
+	ClientSecret = "test-client-secret"
+)
+
+// User is the account signed in at the provider
+type User struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+type grant struct {
+	user          User
+	redirectURI   string
+	nonce         string
+	codeChallenge string
+}
+
+// Server implements discovery, the authorization, token, userinfo and keys endpoints. The consent
+// screen is skipped: the authorization endpoint redirects back at once with a code of the account
+// given to SignIn, or with access_denied when there is none.
+type Server struct {
+	*httptest.Server
+
+	mu           sync.Mutex
+	key          *jwt.Key
+	user         *User
+	codes        map[string]grant
+	tokens       map[string]User
+	userInfoOnly bool
+	tamper       func(claims map[string]interface{})
+}
+
+// NewServer starts the server, it has to be closed by the caller
+func NewServer() *Server {
+	s := &Server{
+		codes:  make(map[string]grant),
+		tokens: make(map[string]User),
+	}
+	s.RotateKey()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", s.discovery)
+	mux.HandleFunc("/jwks", s.jwks)
+	mux.HandleFunc("/authorize", s.authorize)
+	mux.HandleFunc("/token", s.token)
+	mux.HandleFunc("/userinfo", s.userInfo)
+	s.Server = httptest.NewServer(mux)
+
+	return s
+}
+
+// Config returns the client configuration of the provider
+func (s *Server) Config(redirectURL string) oidc.Config {
+	return oidc.Config{
+		Issuer:       s.URL,
+		ClientID:     ClientID,
+		ClientSecret: ClientSecret,
+		RedirectURL:  redirectURL,
+	}
+}
+
+// SignIn sets the account that consents to the next authorizations, nil denies them
+func (s *Server) SignIn(user *User) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.user = user
+}
+
+// UserInfoOnly leaves the email and name out of the next ID tokens, they are only in userinfo
+func (s *Server) UserInfoOnly(userInfoOnly bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.userInfoOnly = userInfoOnly
+}
+
+// Tamper changes the claims of the next ID tokens before they are signed, nil stops it
+func (s *Server) Tamper(tamper func(claims map[string]interface{})) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tamper = tamper
+}
+
+// RotateKey signs the next ID tokens with a new key
+func (s *Server) RotateKey() {
+	signer, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+
+	key, err := jwt.NewKey(randomString(), signer)
+	if err != nil {
+		panic(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.key = key
+}
+
+func (s *Server) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                s.URL,
+		"authorization_endpoint":                s.URL + "/authorize",
+		"token_endpoint":                        s.URL + "/token",
+		"userinfo_endpoint":                     s.URL + "/userinfo",
+		"jwks_uri":                              s.URL + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{jwt.ES256},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (s *Server) jwks(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	set, err := jwt.NewJWKS(s.key)
+	s.mu.Unlock()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, set)
+}
+
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	redirectURI, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil || redirectURI.Host == "" || query.Get("client_id") != ClientID || query.Get("response_type") != "code" {
+		http.Error(w, "invalid authorization request", http.StatusBadRequest)
+		return
+	}
+
+	if !strings.Contains(" "+query.Get("scope")+" ", " openid ") || query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		http.Error(w, "openid scope and S256 code challenge are required", http.StatusBadRequest)
+		return
+	}
+
+	params := redirectURI.Query()
+	params.Set("state", query.Get("state"))
+
+	s.mu.Lock()
+	if s.user == nil {
+		params.Set("error", "access_denied")
+	} else {
+		code := randomString()
+		s.codes[code] = grant{
+			user:          *s.user,
+			redirectURI:   query.Get("redirect_uri"),
+			nonce:         query.Get("nonce"),
+			codeChallenge: query.Get("code_challenge"),
+		}
+		params.Set("code", code)
+	}
+	s.mu.Unlock()
+
+	redirectURI.RawQuery = params.Encode()
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientID, clientSecret = r.FormValue("client_id"), r.FormValue("client_secret")
+	}
+
+	if clientID != ClientID || clientSecret != ClientSecret {
+		writeError(w, http.StatusUnauthorized, "invalid_client")
+		return
+	}
+
+	if r.FormValue("grant_type") != "authorization_code" {
+		writeError(w, http.StatusBadRequest, "unsupported_grant_type")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// codes are single use, also when the request fails
+	code := r.FormValue("code")
+	grant, ok := s.codes[code]
+	delete(s.codes, code)
+	if !ok || grant.redirectURI != r.FormValue("redirect_uri") || oidc.CodeChallenge(r.FormValue("code_verifier")) != grant.codeChallenge {
+		writeError(w, http.StatusBadRequest, "invalid_grant")
+		return
+	}
+
+	now := time.Now()
+	claims := map[string]interface{}{
+		"iss":   s.URL,
+		"sub":   grant.user.Subject,
+		"aud":   ClientID,
+		"exp":   now.Add(time.Hour).Unix(),
+		"iat":   now.Unix(),
+		"nonce": grant.nonce,
+	}
+
+	if !s.userInfoOnly {
+		claims["email"] = grant.user.Email
+		claims["email_verified"] = grant.user.EmailVerified
+		claims["name"] = grant.user.Name
+	}
+
+	if s.tamper != nil {
+		s.tamper(claims)
+	}
+
+	idToken, err := jwt.Sign(s.key, claims)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "server_error")
+		return
+	}
+
+	accessToken := randomString()
+	s.tokens[accessToken] = grant.user
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+func (s *Server) userInfo(w http.ResponseWriter, r *http.Request) {
+	accessToken := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+	s.mu.Lock()
+	user, ok := s.tokens[accessToken]
+	s.mu.Unlock()
+
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "invalid_token")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"sub":            user.Subject,
+		"email":          user.Email,
+		"email_verified": user.EmailVerified,
+		"name":           user.Name,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, code string) {
+	writeJSON(w, status, map[string]string{"error": code})
+}
+
+func randomString() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+
+	return hex.EncodeToString(b)
+}
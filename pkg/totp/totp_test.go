@@ -0,0 +1,65 @@
+package totp_test
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/evzpav/user-auth/pkg/totp"
+)
+
+// RFC 6238 appendix B, SHA1 variant
+func TestCode_RFC6238Vectors(t *testing.T) {
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{unix: 59, want: "94287082"},
+		{unix: 1111111109, want: "07081804"},
+		{unix: 1111111111, want: "14050471"},
+		{unix: 1234567890, want: "89005924"},
+		{unix: 2000000000, want: "69279037"},
+		{unix: 20000000000, want: "65353130"},
+	}
+
+	for _, tt := range tests {
+		code, err := totp.Code(secret, totp.Step(time.Unix(tt.unix, 0)), 8)
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, code)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := totp.NewSecret()
+	require.NoError(t, err)
+
+	now := time.Unix(1600000000, 0)
+	code, err := totp.Code(secret, totp.Step(now), totp.Digits)
+	require.NoError(t, err)
+
+	step, ok := totp.Validate(secret, code, now, 1)
+	assert.True(t, ok)
+	assert.Equal(t, totp.Step(now), step)
+
+	_, ok = totp.Validate(secret, code, now.Add(totp.Period), 1)
+	assert.True(t, ok)
+
+	_, ok = totp.Validate(secret, code, now.Add(2*totp.Period), 1)
+	assert.False(t, ok)
+
+	_, ok = totp.Validate(secret, "12345", now, 1)
+	assert.False(t, ok)
+}
+
+func TestURI(t *testing.T) {
+	uri := totp.URI("user-auth", "user@example.com", "JBSWY3DPEHPK3PXP")
+
+	assert.True(t, strings.HasPrefix(uri, "otpauth://totp/user-auth:user@example.com?"))
+	assert.Contains(t, uri, "secret=JBSWY3DPEHPK3PXP")
+	assert.Contains(t, uri, "issuer=user-auth")
+}
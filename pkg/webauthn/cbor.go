@@ -0,0 +1,179 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+var errCBOR = errors.New("malformed cbor")
+
+// maximum nesting accepted, attestation objects and COSE keys are only a few levels deep
+const cborMaxDepth = 16
+
+// decodeCBOR decodes the first CBOR (RFC 7049) item of data and returns it with the number of bytes
+// it used. Only the subset emitted by authenticators is supported: integers, byte and text strings,
+// arrays, maps and the simple values false, true and null. Integers are returned as int64, maps as
+// map[interface{}]interface{} with int64 or string keys.
+func decodeCBOR(data []byte) (interface{}, int, error) {
+	d := cborDecoder{data: data}
+	v, err := d.decode(0)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return v, d.pos, nil
+}
+
+type cborDecoder struct {
+	data []byte
+	pos  int
+}
+
+func (d *cborDecoder) decode(depth int) (interface{}, error) {
+	if depth > cborMaxDepth {
+		return nil, errCBOR
+	}
+
+	if d.pos >= len(d.data) {
+		return nil, errCBOR
+	}
+
+	initial := d.data[d.pos]
+	d.pos++
+	major, info := initial>>5, initial&0x1f
+
+	if major == 7 {
+		switch info {
+		case 20:
+			return false, nil
+		case 21:
+			return true, nil
+		case 22:
+			return nil, nil
+		default:
+			return nil, errCBOR
+		}
+	}
+
+	arg, err := d.argument(info)
+	if err != nil {
+		return nil, err
+	}
+
+	switch major {
+	case 0:
+		if arg > math.MaxInt64 {
+			return nil, errCBOR
+		}
+		return int64(arg), nil
+	case 1:
+		if arg > math.MaxInt64 {
+			return nil, errCBOR
+		}
+		return -1 - int64(arg), nil
+	case 2:
+		return d.bytes(arg)
+	case 3:
+		b, err := d.bytes(arg)
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
+	case 4:
+		if arg > uint64(len(d.data)-d.pos) {
+			return nil, errCBOR
+		}
+
+		items := make([]interface{}, 0, arg)
+		for i := uint64(0); i < arg; i++ {
+			item, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	case 5:
+		if arg > uint64(len(d.data)-d.pos) {
+			return nil, errCBOR
+		}
+
+		m := make(map[interface{}]interface{}, arg)
+		for i := uint64(0); i < arg; i++ {
+			key, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, errCBOR
+			}
+
+			if _, ok := m[key]; ok {
+				return nil, errCBOR
+			}
+
+			value, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			m[key] = value
+		}
+		return m, nil
+	}
+
+	// tags (major type 6) are not used by WebAuthn
+	return nil, errCBOR
+}
+
+// argument reads the value encoded in the additional information of the initial byte.
+// Indefinite lengths are rejected.
+func (d *cborDecoder) argument(info byte) (uint64, error) {
+	var size int
+	switch {
+	case info < 24:
+		return uint64(info), nil
+	case info == 24:
+		size = 1
+	case info == 25:
+		size = 2
+	case info == 26:
+		size = 4
+	case info == 27:
+		size = 8
+	default:
+		return 0, errCBOR
+	}
+
+	if len(d.data)-d.pos < size {
+		return 0, errCBOR
+	}
+
+	b := d.data[d.pos : d.pos+size]
+	d.pos += size
+
+	switch size {
+	case 1:
+		return uint64(b[0]), nil
+	case 2:
+		return uint64(binary.BigEndian.Uint16(b)), nil
+	case 4:
+		return uint64(binary.BigEndian.Uint32(b)), nil
+	default:
+		return binary.BigEndian.Uint64(b), nil
+	}
+}
+
+func (d *cborDecoder) bytes(length uint64) ([]byte, error) {
+	if length > uint64(len(d.data)-d.pos) {
+		return nil, errCBOR
+	}
+
+	b := make([]byte, length)
+	copy(b, d.data[d.pos:])
+	d.pos += int(length)
+	return b, nil
+}
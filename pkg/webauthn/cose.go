@@ -0,0 +1,160 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/asn1"
+	"math/big"
+)
+
+// COSE algorithm identifiers (RFC 8152) supported for credentials
+const (
+	AlgES256 int64 = -7
+	AlgEdDSA int64 = -8
+	AlgRS256 int64 = -257
+)
+
+// SupportedAlgorithms are offered to authenticators in order of preference
+var SupportedAlgorithms = []int64{AlgES256, AlgEdDSA, AlgRS256}
+
+// COSE key parameters
+const (
+	coseKty int64 = 1
+	coseAlg int64 = 3
+
+	coseKtyOKP int64 = 1
+	coseKtyEC2 int64 = 2
+	coseKtyRSA int64 = 3
+
+	coseCrvP256    int64 = 1
+	coseCrvEd25519 int64 = 6
+)
+
+// publicKey is a credential public key decoded from its COSE_Key encoding
+type publicKey struct {
+	algorithm int64
+	key       crypto.PublicKey
+}
+
+// parsePublicKey decodes a COSE_Key of one of the supported algorithms
+func parsePublicKey(data []byte) (*publicKey, error) {
+	v, n, err := decodeCBOR(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if n != len(data) {
+		return nil, ErrUnsupportedKey
+	}
+
+	return publicKeyFromCOSE(v)
+}
+
+func publicKeyFromCOSE(v interface{}) (*publicKey, error) {
+	m, ok := v.(map[interface{}]interface{})
+	if !ok {
+		return nil, ErrUnsupportedKey
+	}
+
+	kty, _ := m[coseKty].(int64)
+	alg, _ := m[coseAlg].(int64)
+
+	switch {
+	case kty == coseKtyEC2 && alg == AlgES256:
+		crv, _ := m[int64(-1)].(int64)
+		x, _ := m[int64(-2)].([]byte)
+		y, _ := m[int64(-3)].([]byte)
+		if crv != coseCrvP256 || len(x) != 32 || len(y) != 32 {
+			return nil, ErrUnsupportedKey
+		}
+
+		key := &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return nil, ErrUnsupportedKey
+		}
+
+		return &publicKey{algorithm: alg, key: key}, nil
+
+	case kty == coseKtyOKP && alg == AlgEdDSA:
+		crv, _ := m[int64(-1)].(int64)
+		x, _ := m[int64(-2)].([]byte)
+		if crv != coseCrvEd25519 || len(x) != ed25519.PublicKeySize {
+			return nil, ErrUnsupportedKey
+		}
+
+		return &publicKey{algorithm: alg, key: ed25519.PublicKey(x)}, nil
+
+	case kty == coseKtyRSA && alg == AlgRS256:
+		n, _ := m[int64(-1)].([]byte)
+		e, _ := m[int64(-2)].([]byte)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return nil, ErrUnsupportedKey
+		}
+
+		key := &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+
+		return &publicKey{algorithm: alg, key: key}, nil
+	}
+
+	return nil, ErrUnsupportedKey
+}
+
+// verifySignature checks a WebAuthn signature, which for ECDSA is ASN.1 DER encoded
+func verifySignature(alg int64, key crypto.PublicKey, data, sig []byte) error {
+	switch alg {
+	case AlgES256:
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return ErrInvalidSignature
+		}
+
+		var esig struct {
+			R, S *big.Int
+		}
+		rest, err := asn1.Unmarshal(sig, &esig)
+		if err != nil || len(rest) != 0 {
+			return ErrInvalidSignature
+		}
+
+		digest := sha256.Sum256(data)
+		if !ecdsa.Verify(pub, digest[:], esig.R, esig.S) {
+			return ErrInvalidSignature
+		}
+
+		return nil
+
+	case AlgEdDSA:
+		pub, ok := key.(ed25519.PublicKey)
+		if !ok || !ed25519.Verify(pub, data, sig) {
+			return ErrInvalidSignature
+		}
+
+		return nil
+
+	case AlgRS256:
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return ErrInvalidSignature
+		}
+
+		digest := sha256.Sum256(data)
+		if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig); err != nil {
+			return ErrInvalidSignature
+		}
+
+		return nil
+	}
+
+	return ErrUnsupportedKey
+}
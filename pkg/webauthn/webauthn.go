@@ -0,0 +1,483 @@
+// Package webauthn implements the relying party side of the Web Authentication ceremonies
+// (https://www.w3.org/TR/webauthn-2/) needed to register passkeys and security keys and to sign in
+// with them. Attestation is not used to establish trust in the authenticator, so only the "none"
+// and "packed" formats are accepted.
+package webauthn
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	ErrMalformed              = errors.New("malformed webauthn response")
+	ErrInvalidType            = errors.New("unexpected client data type")
+	ErrInvalidChallenge       = errors.New("challenge does not match")
+	ErrInvalidOrigin          = errors.New("origin does not match")
+	ErrInvalidRPID            = errors.New("relying party id does not match")
+	ErrUserNotPresent         = errors.New("user presence was not confirmed")
+	ErrUserNotVerified        = errors.New("user was not verified by the authenticator")
+	ErrUnsupportedKey         = errors.New("unsupported credential public key")
+	ErrUnsupportedAttestation = errors.New("unsupported attestation format")
+	ErrInvalidSignature       = errors.New("invalid signature")
+	ErrSignCount              = errors.New("signature counter did not increase, the authenticator may be cloned")
+)
+
+// Timeout is the time the browser waits for the user to interact with the authenticator
+const Timeout = 5 * time.Minute
+
+var b64 = base64.RawURLEncoding
+
+// authenticator data flags
+const (
+	flagUserPresent       byte = 0x01
+	flagUserVerified      byte = 0x04
+	flagAttestedData      byte = 0x40
+	flagExtensionIncluded byte = 0x80
+)
+
+// Config identifies the relying party. RPID is the domain of the site, Origin the full origin
+// (scheme, host and port) pages are served from.
+type Config struct {
+	RPID   string
+	RPName string
+	Origin string
+}
+
+type RelyingParty struct {
+	config Config
+	rpHash [32]byte
+}
+
+func New(config Config) (*RelyingParty, error) {
+	if config.RPID == "" || config.Origin == "" {
+		return nil, errors.New("webauthn: relying party id and origin are required")
+	}
+
+	if config.RPName == "" {
+		config.RPName = config.RPID
+	}
+
+	return &RelyingParty{
+		config: config,
+		rpHash: sha256.Sum256([]byte(config.RPID)),
+	}, nil
+}
+
+// NewChallenge returns a random base64url encoded challenge
+func NewChallenge() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return b64.EncodeToString(b), nil
+}
+
+// Binary values of the options and responses are base64url encoded without padding, the page has
+// to convert them from and to ArrayBuffers around navigator.credentials calls.
+
+type RPEntity struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type UserEntity struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+type CredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int64  `json:"alg"`
+}
+
+type CredentialDescriptor struct {
+	Type       string   `json:"type"`
+	ID         string   `json:"id"`
+	Transports []string `json:"transports,omitempty"`
+}
+
+type AuthenticatorSelection struct {
+	ResidentKey        string `json:"residentKey"`
+	RequireResidentKey bool   `json:"requireResidentKey"`
+	UserVerification   string `json:"userVerification"`
+}
+
+// CreationOptions are the PublicKeyCredentialCreationOptions of navigator.credentials.create
+type CreationOptions struct {
+	Challenge              string                 `json:"challenge"`
+	RP                     RPEntity               `json:"rp"`
+	User                   UserEntity             `json:"user"`
+	PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+}
+
+// RequestOptions are the PublicKeyCredentialRequestOptions of navigator.credentials.get
+type RequestOptions struct {
+	Challenge        string                 `json:"challenge"`
+	Timeout          int64                  `json:"timeout"`
+	RPID             string                 `json:"rpId"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+// RegistrationResponse is the PublicKeyCredential returned by navigator.credentials.create
+type RegistrationResponse struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string   `json:"clientDataJSON"`
+		AttestationObject string   `json:"attestationObject"`
+		Transports        []string `json:"transports"`
+	} `json:"response"`
+}
+
+// AssertionResponse is the PublicKeyCredential returned by navigator.credentials.get
+type AssertionResponse struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string `json:"clientDataJSON"`
+		AuthenticatorData string `json:"authenticatorData"`
+		Signature         string `json:"signature"`
+		UserHandle        string `json:"userHandle"`
+	} `json:"response"`
+}
+
+// Credential is a verified newly registered credential. PublicKey is kept COSE encoded.
+type Credential struct {
+	ID         []byte
+	PublicKey  []byte
+	SignCount  uint32
+	Transports []string
+}
+
+// CreationOptions builds the options to register a credential for the user. userID is the opaque
+// user handle returned by the authenticator on login, exclude lists the credentials the user
+// already registered so the same authenticator is not registered twice.
+func (rp *RelyingParty) CreationOptions(challenge string, userID []byte, name, displayName string, exclude [][]byte) *CreationOptions {
+	params := make([]CredentialParameter, len(SupportedAlgorithms))
+	for i, alg := range SupportedAlgorithms {
+		params[i] = CredentialParameter{Type: "public-key", Alg: alg}
+	}
+
+	return &CreationOptions{
+		Challenge: challenge,
+		RP: RPEntity{
+			ID:   rp.config.RPID,
+			Name: rp.config.RPName,
+		},
+		User: UserEntity{
+			ID:          b64.EncodeToString(userID),
+			Name:        name,
+			DisplayName: displayName,
+		},
+		PubKeyCredParams:   params,
+		Timeout:            int64(Timeout / time.Millisecond),
+		ExcludeCredentials: descriptors(exclude),
+		AuthenticatorSelection: AuthenticatorSelection{
+			ResidentKey:      "preferred",
+			UserVerification: "required",
+		},
+		Attestation: "none",
+	}
+}
+
+// RequestOptions builds the options to sign in. An empty allow list lets the user pick any
+// discoverable credential of the site.
+func (rp *RelyingParty) RequestOptions(challenge string, allow [][]byte) *RequestOptions {
+	return &RequestOptions{
+		Challenge:        challenge,
+		Timeout:          int64(Timeout / time.Millisecond),
+		RPID:             rp.config.RPID,
+		AllowCredentials: descriptors(allow),
+		UserVerification: "required",
+	}
+}
+
+func descriptors(ids [][]byte) []CredentialDescriptor {
+	list := make([]CredentialDescriptor, len(ids))
+	for i, id := range ids {
+		list[i] = CredentialDescriptor{Type: "public-key", ID: b64.EncodeToString(id)}
+	}
+
+	return list
+}
+
+// VerifyRegistration runs the registration ceremony checks (WebAuthn §7.1) of the response to
+// options created with challenge.
+func (rp *RelyingParty) VerifyRegistration(challenge string, resp *RegistrationResponse) (*Credential, error) {
+	clientDataJSON, err := b64.DecodeString(resp.Response.ClientDataJSON)
+	if err != nil {
+		return nil, ErrMalformed
+	}
+
+	if err := rp.verifyClientData(clientDataJSON, "webauthn.create", challenge); err != nil {
+		return nil, err
+	}
+
+	rawAttestation, err := b64.DecodeString(resp.Response.AttestationObject)
+	if err != nil {
+		return nil, ErrMalformed
+	}
+
+	v, n, err := decodeCBOR(rawAttestation)
+	if err != nil || n != len(rawAttestation) {
+		return nil, ErrMalformed
+	}
+
+	attestation, ok := v.(map[interface{}]interface{})
+	if !ok {
+		return nil, ErrMalformed
+	}
+
+	format, _ := attestation["fmt"].(string)
+	statement, _ := attestation["attStmt"].(map[interface{}]interface{})
+	rawAuthData, _ := attestation["authData"].([]byte)
+	if statement == nil || rawAuthData == nil {
+		return nil, ErrMalformed
+	}
+
+	authData, err := rp.parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+
+	if authData.credentialID == nil {
+		return nil, ErrMalformed
+	}
+
+	key, err := parsePublicKey(authData.credentialKey)
+	if err != nil {
+		return nil, err
+	}
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte{}, rawAuthData...), clientDataHash[:]...)
+	if err := verifyAttestation(format, statement, key, signed); err != nil {
+		return nil, err
+	}
+
+	return &Credential{
+		ID:         authData.credentialID,
+		PublicKey:  authData.credentialKey,
+		SignCount:  authData.signCount,
+		Transports: resp.Response.Transports,
+	}, nil
+}
+
+// VerifyAssertion runs the authentication ceremony checks (WebAuthn §7.2) of the response against
+// the stored public key and signature counter of the credential. It returns the new counter.
+func (rp *RelyingParty) VerifyAssertion(challenge string, credentialKey []byte, signCount uint32, resp *AssertionResponse) (uint32, error) {
+	clientDataJSON, err := b64.DecodeString(resp.Response.ClientDataJSON)
+	if err != nil {
+		return 0, ErrMalformed
+	}
+
+	rawAuthData, err := b64.DecodeString(resp.Response.AuthenticatorData)
+	if err != nil {
+		return 0, ErrMalformed
+	}
+
+	sig, err := b64.DecodeString(resp.Response.Signature)
+	if err != nil {
+		return 0, ErrMalformed
+	}
+
+	if err := rp.verifyClientData(clientDataJSON, "webauthn.get", challenge); err != nil {
+		return 0, err
+	}
+
+	authData, err := rp.parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return 0, err
+	}
+
+	key, err := parsePublicKey(credentialKey)
+	if err != nil {
+		return 0, err
+	}
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte{}, rawAuthData...), clientDataHash[:]...)
+	if err := verifySignature(key.algorithm, key.key, signed, sig); err != nil {
+		return 0, err
+	}
+
+	// authenticators without a counter always report zero
+	if (authData.signCount != 0 || signCount != 0) && authData.signCount <= signCount {
+		return 0, ErrSignCount
+	}
+
+	return authData.signCount, nil
+}
+
+type clientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+func (rp *RelyingParty) verifyClientData(raw []byte, ceremony, challenge string) error {
+	var cd clientData
+	if err := json.Unmarshal(raw, &cd); err != nil {
+		return ErrMalformed
+	}
+
+	if cd.Type != ceremony {
+		return ErrInvalidType
+	}
+
+	if challenge == "" || subtle.ConstantTimeCompare([]byte(cd.Challenge), []byte(challenge)) != 1 {
+		return ErrInvalidChallenge
+	}
+
+	if cd.Origin != rp.config.Origin || cd.CrossOrigin {
+		return ErrInvalidOrigin
+	}
+
+	return nil
+}
+
+type authenticatorData struct {
+	flags         byte
+	signCount     uint32
+	credentialID  []byte
+	credentialKey []byte
+}
+
+// parseAuthenticatorData decodes the authenticator data and checks the relying party id hash and
+// the user presence and verification flags
+func (rp *RelyingParty) parseAuthenticatorData(data []byte) (*authenticatorData, error) {
+	if len(data) < 37 {
+		return nil, ErrMalformed
+	}
+
+	if subtle.ConstantTimeCompare(data[:32], rp.rpHash[:]) != 1 {
+		return nil, ErrInvalidRPID
+	}
+
+	ad := &authenticatorData{
+		flags:     data[32],
+		signCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+
+	if ad.flags&flagUserPresent == 0 {
+		return nil, ErrUserNotPresent
+	}
+
+	if ad.flags&flagUserVerified == 0 {
+		return nil, ErrUserNotVerified
+	}
+
+	rest := data[37:]
+	if ad.flags&flagAttestedData != 0 {
+		// aaguid (16 bytes) and credential id length (2 bytes)
+		if len(rest) < 18 {
+			return nil, ErrMalformed
+		}
+
+		idLength := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if idLength == 0 || len(rest) < idLength {
+			return nil, ErrMalformed
+		}
+
+		ad.credentialID = append([]byte{}, rest[:idLength]...)
+		rest = rest[idLength:]
+
+		_, n, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, ErrMalformed
+		}
+
+		ad.credentialKey = append([]byte{}, rest[:n]...)
+		rest = rest[n:]
+	}
+
+	if ad.flags&flagExtensionIncluded != 0 {
+		_, n, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, ErrMalformed
+		}
+		rest = rest[n:]
+	}
+
+	if len(rest) != 0 {
+		return nil, ErrMalformed
+	}
+
+	return ad, nil
+}
+
+// verifyAttestation checks the attestation statement signature. Certificates of packed full
+// attestation are not chained to a trust anchor since any authenticator is accepted.
+func verifyAttestation(format string, statement map[interface{}]interface{}, key *publicKey, signed []byte) error {
+	switch format {
+	case "none":
+		if len(statement) != 0 {
+			return ErrMalformed
+		}
+
+		return nil
+
+	case "packed":
+		alg, _ := statement["alg"].(int64)
+		sig, _ := statement["sig"].([]byte)
+		if sig == nil {
+			return ErrMalformed
+		}
+
+		x5c, ok := statement["x5c"].([]interface{})
+		if !ok {
+			// self attestation is signed by the credential key itself
+			if alg != key.algorithm {
+				return ErrUnsupportedAttestation
+			}
+
+			return verifySignature(alg, key.key, signed, sig)
+		}
+
+		if len(x5c) == 0 {
+			return ErrMalformed
+		}
+
+		der, _ := x5c[0].([]byte)
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return ErrMalformed
+		}
+
+		if cert.Version != 3 {
+			return ErrUnsupportedAttestation
+		}
+
+		return verifySignature(alg, cert.PublicKey, signed, sig)
+	}
+
+	return ErrUnsupportedAttestation
+}
+
+// EncodeID encodes a credential id or user handle as used in options and responses
+func EncodeID(id []byte) string {
+	return b64.EncodeToString(id)
+}
+
+// DecodeID decodes a base64url credential id or user handle
+func DecodeID(id string) ([]byte, error) {
+	return b64.DecodeString(strings.TrimRight(id, "="))
+}
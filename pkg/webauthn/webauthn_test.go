@@ -0,0 +1,165 @@
+package webauthn_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/evzpav/user-auth/pkg/webauthn"
+)
+
+// fixtures are responses recorded from a software authenticator for rp id "localhost"
+type fixture struct {
+	RPID      string          `json:"rp_id"`
+	Origin    string          `json:"origin"`
+	Challenge string          `json:"challenge"`
+	PublicKey string          `json:"public_key"`
+	SignCount uint32          `json:"sign_count"`
+	Response  json.RawMessage `json:"response"`
+}
+
+func loadFixture(t *testing.T, name string) *fixture {
+	bs, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	require.NoError(t, err)
+
+	var f fixture
+	require.NoError(t, json.Unmarshal(bs, &f))
+	return &f
+}
+
+func newRelyingParty(t *testing.T, f *fixture) *webauthn.RelyingParty {
+	rp, err := webauthn.New(webauthn.Config{RPID: f.RPID, RPName: "user-auth", Origin: f.Origin})
+	require.NoError(t, err)
+	return rp
+}
+
+func registration(t *testing.T, f *fixture) *webauthn.RegistrationResponse {
+	var resp webauthn.RegistrationResponse
+	require.NoError(t, json.Unmarshal(f.Response, &resp))
+	return &resp
+}
+
+func assertion(t *testing.T, f *fixture) *webauthn.AssertionResponse {
+	var resp webauthn.AssertionResponse
+	require.NoError(t, json.Unmarshal(f.Response, &resp))
+	return &resp
+}
+
+func TestVerifyRegistration(t *testing.T) {
+	tests := []struct {
+		fixture    string
+		signCount  uint32
+		transports []string
+	}{
+		{fixture: "registration_none_es256.json", signCount: 0, transports: []string{"internal", "hybrid"}},
+		{fixture: "registration_packed_eddsa.json", signCount: 1, transports: []string{"usb"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			f := loadFixture(t, tt.fixture)
+			resp := registration(t, f)
+
+			credential, err := newRelyingParty(t, f).VerifyRegistration(f.Challenge, resp)
+			require.NoError(t, err)
+			assert.Equal(t, resp.ID, base64.RawURLEncoding.EncodeToString(credential.ID))
+			assert.NotEmpty(t, credential.PublicKey)
+			assert.Equal(t, tt.signCount, credential.SignCount)
+			assert.Equal(t, tt.transports, credential.Transports)
+		})
+	}
+}
+
+func TestVerifyRegistration_Rejected(t *testing.T) {
+	f := loadFixture(t, "registration_none_es256.json")
+
+	_, err := newRelyingParty(t, f).VerifyRegistration("other-challenge", registration(t, f))
+	assert.Equal(t, webauthn.ErrInvalidChallenge, err)
+
+	rp, err := webauthn.New(webauthn.Config{RPID: f.RPID, Origin: "https://evil.example.com"})
+	require.NoError(t, err)
+	_, err = rp.VerifyRegistration(f.Challenge, registration(t, f))
+	assert.Equal(t, webauthn.ErrInvalidOrigin, err)
+
+	rp, err = webauthn.New(webauthn.Config{RPID: "example.com", Origin: f.Origin})
+	require.NoError(t, err)
+	_, err = rp.VerifyRegistration(f.Challenge, registration(t, f))
+	assert.Equal(t, webauthn.ErrInvalidRPID, err)
+
+	// an assertion cannot be replayed as a registration
+	a := loadFixture(t, "assertion_es256.json")
+	resp := registration(t, f)
+	resp.Response.ClientDataJSON = assertion(t, a).Response.ClientDataJSON
+	_, err = newRelyingParty(t, f).VerifyRegistration(a.Challenge, resp)
+	assert.Equal(t, webauthn.ErrInvalidType, err)
+
+	resp = registration(t, f)
+	resp.Response.AttestationObject = resp.Response.AttestationObject[:40]
+	_, err = newRelyingParty(t, f).VerifyRegistration(f.Challenge, resp)
+	assert.Equal(t, webauthn.ErrMalformed, err)
+}
+
+func TestVerifyRegistration_PackedInvalidSignature(t *testing.T) {
+	f := loadFixture(t, "registration_packed_eddsa.json")
+	resp := registration(t, f)
+
+	// the client data is signed by the attestation, changing it breaks the signature
+	clientData, err := base64.RawURLEncoding.DecodeString(resp.Response.ClientDataJSON)
+	require.NoError(t, err)
+	resp.Response.ClientDataJSON = base64.RawURLEncoding.EncodeToString(append(clientData, ' '))
+
+	_, err = newRelyingParty(t, f).VerifyRegistration(f.Challenge, resp)
+	assert.Equal(t, webauthn.ErrInvalidSignature, err)
+}
+
+func TestVerifyAssertion(t *testing.T) {
+	f := loadFixture(t, "assertion_es256.json")
+	rp := newRelyingParty(t, f)
+	key, err := base64.RawURLEncoding.DecodeString(f.PublicKey)
+	require.NoError(t, err)
+
+	signCount, err := rp.VerifyAssertion(f.Challenge, key, f.SignCount, assertion(t, f))
+	require.NoError(t, err)
+	assert.Equal(t, f.SignCount+1, signCount)
+
+	_, err = rp.VerifyAssertion(f.Challenge, key, signCount, assertion(t, f))
+	assert.Equal(t, webauthn.ErrSignCount, err)
+
+	_, err = rp.VerifyAssertion("other-challenge", key, f.SignCount, assertion(t, f))
+	assert.Equal(t, webauthn.ErrInvalidChallenge, err)
+
+	resp := assertion(t, f)
+	sig, err := base64.RawURLEncoding.DecodeString(resp.Response.Signature)
+	require.NoError(t, err)
+	sig[len(sig)-1] ^= 0xff
+	resp.Response.Signature = base64.RawURLEncoding.EncodeToString(sig)
+	_, err = rp.VerifyAssertion(f.Challenge, key, f.SignCount, resp)
+	assert.Equal(t, webauthn.ErrInvalidSignature, err)
+
+	// the key of another credential does not verify the signature
+	other := loadFixture(t, "registration_packed_eddsa.json")
+	credential, err := newRelyingParty(t, other).VerifyRegistration(other.Challenge, registration(t, other))
+	require.NoError(t, err)
+	_, err = rp.VerifyAssertion(f.Challenge, credential.PublicKey, f.SignCount, assertion(t, f))
+	assert.Equal(t, webauthn.ErrInvalidSignature, err)
+}
+
+func TestCreationOptions(t *testing.T) {
+	rp, err := webauthn.New(webauthn.Config{RPID: "localhost", Origin: "http://localhost:8080"})
+	require.NoError(t, err)
+
+	options := rp.CreationOptions("challenge", []byte("42"), "user@example.com", "User", [][]byte{[]byte("cred")})
+	assert.Equal(t, "localhost", options.RP.ID)
+	assert.Equal(t, "localhost", options.RP.Name)
+	assert.Equal(t, "NDI", options.User.ID)
+	assert.Equal(t, "Y3JlZA", options.ExcludeCredentials[0].ID)
+	assert.Equal(t, "required", options.AuthenticatorSelection.UserVerification)
+	assert.Len(t, options.PubKeyCredParams, len(webauthn.SupportedAlgorithms))
+
+	_, err = webauthn.New(webauthn.Config{RPID: "localhost"})
+	assert.Error(t, err)
+}